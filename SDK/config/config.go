@@ -16,6 +16,26 @@ const (
 const (
 	DTAgentStatus  = 1
 	DTPluginStatus = 2
+	DTPluginEvent  = 3
+	DTPluginClock  = 4
+	// opaque offset of the plugin, persisted by the agent
+	DTPluginCheckpoint = 5
+	// liveness of the plugin, sent periodically by the sandbox
+	DTPluginHeartbeat = 6
+	// outcome of a task, correlated by the token of it
+	DTPluginTaskResult = 7
+	// a part of a record larger than the chunk size, reassembled by the
+	// agent
+	DTPluginChunk = 8
+	// metadata of the agent and the host, the first record of every stream
+	// to the server
+	DTAgentRegister = 9
+	// what the plugin supports, advertised once it starts
+	DTPluginCapabilities = 10
+	// audit of a response action taken by the agent, one for every action
+	DTAgentResponse = 11
+	// a chunk of the file fetched by the server, in base64
+	DTAgentFile = 12
 
 	// Linux
 	DTMemfdCreate           = 614
@@ -41,4 +61,74 @@ const (
 	TaskAgentUpdate   = 2
 	TaskAgentSetenv   = 3
 	TaskAgentRestart  = 4
+	// the agent sends the clock to the plugin, and the plugin replies with
+	// DTPluginClock
+	TaskClockSync = 5
+	// the last DTPluginCheckpoint, delivered once the plugin starts
+	TaskCheckpointRestore = 6
+	// the routing policy of records in the agent, in json
+	TaskAgentRouting = 7
+	// the dedup and sampling policy of records in the agent, in json
+	TaskAgentSampling = 8
+	// the redaction policy of record fields in the agent, in json
+	TaskAgentRedaction = 9
+	// the server acknowledges DTAgentRegister of the stream
+	TaskAgentRegistered = 10
+	// the labels of the agent attached to every record, in json
+	TaskAgentLabels = 11
+	// the recurring tasks of plugins scheduled by cron, in json
+	TaskAgentSchedule = 12
+	// cancels the task of the token in data. The agent drops it if it's
+	// still queued, otherwise the context of the handler running it in the
+	// plugin is cancelled.
+	TaskCancel = 13
+	// the response action taken by the agent itself, in json
+	TaskAgentResponse = 14
+)
+
+// Status of a task in DTPluginTaskResult. The plugin reports succeeded,
+// failed or cancelled, the others are reported by the agent. The agent
+// reports cancelled as well for the task cancelled before it's delivered.
+const (
+	TaskStatusDelivered = "delivered"
+	TaskStatusRejected  = "rejected"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	TaskStatusCancelled = "cancelled"
+)
+
+// Environment variables of the named pipes on Windows, which has no fd
+// inherited as fd 3 and 4. The plugin reads tasks from the task pipe and
+// writes records to the record pipe.
+const (
+	TaskPipeEnv   = "HADES_TASK_PIPE"
+	RecordPipeEnv = "HADES_RECORD_PIPE"
+)
+
+// RecordRingEnv is the fd of the shared memory ring in the plugin, which
+// carries the records in place of the record pipe once it's attached
+const RecordRingEnv = "HADES_RECORD_RING"
+
+// FramingEnv is the framing version offered by the agent, the plugin which
+// supports it switches to it by the first frame, see framing.V2
+const FramingEnv = "HADES_FRAMING"
+
+// AgentIDEnv is the id of the agent which starts the plugin, see
+// transport.AgentID
+const AgentIDEnv = "HADES_AGENT_ID"
+
+// ElkeidAgentIDEnv is set by the agent of Elkeid, the plugin started by it
+// sends the records in the way of Elkeid
+const ElkeidAgentIDEnv = "SPECIFIED_AGENT_ID"
+
+// ChunkSizeEnv is the largest record the agent reads in place, a larger one
+// is split into DTPluginChunk records by the plugin
+const ChunkSizeEnv = "HADES_CHUNK_SIZE"
+
+// Protocol features of the plugin advertised in DTPluginCapabilities
+const (
+	FeatureFramingV2  = "framing_v2"
+	FeatureChunking   = "chunking"
+	FeatureRing       = "ring"
+	FeatureTaskCancel = "task_cancel"
 )
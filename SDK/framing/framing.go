@@ -0,0 +1,249 @@
+// Package framing is the length-prefixed framing shared by the agent and
+// plugins. A frame is laid out as
+//
+//	[magic][version][length][codec][checksum][payload]
+//
+// The length is a little-endian uint32 of the payload size. All but the
+// length are optional by Options, and the zero Options is the plain frame
+// used on the pipes between the agent and plugins. V2 is the one with
+// checksums, which plugins switch to once the agent offers it.
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// ByteOrder of the length prefix
+var ByteOrder = binary.LittleEndian
+
+// PrefixSize is the size of the length prefix
+const PrefixSize = 4
+
+// ChecksumSize is the size of the CRC32C of the payload
+const ChecksumSize = 4
+
+var (
+	ErrFrameTooLarge = errors.New("frame is too large")
+	ErrBadMagic      = errors.New("frame magic mismatch")
+	ErrBadVersion    = errors.New("frame version mismatch")
+	ErrChecksum      = errors.New("frame checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Options of the frame layout, nil for the plain frame
+type Options struct {
+	// Magic is written before the length prefix, and checked on read
+	Magic []byte
+	// Version, if it's not zero, is a byte after the magic, and checked on
+	// read
+	Version byte
+	// WithCodec adds a byte after the length prefix which tells how the
+	// payload is encoded. It's written from Codec, and read into Codec.
+	WithCodec bool
+	Codec     byte
+	// Checksum adds the CRC32C of the payload before it, and it's verified
+	// on read
+	Checksum bool
+}
+
+// MagicV2 starts the frames of V2. Read as a plain length prefix, it's far
+// larger than any frame allowed, so a V2 frame is never taken for a plain
+// one.
+var MagicV2 = []byte{'H', 'D', 'S', 0xff}
+
+// V2 is the framing with checksums between the agent and plugins. The agent
+// offers it by config.FramingEnv, and the plugin which supports it writes
+// an empty V2 frame first and all the records in V2 then. The agent sends
+// the tasks in V2 once it reads the first V2 frame. A corrupted frame is
+// skipped, and the reader resyncs by Sync to the next magic.
+var V2 = &Options{Magic: MagicV2, Version: 2, Checksum: true}
+
+// HeaderSize returns the size of bytes before the payload
+func HeaderSize(opts *Options) int {
+	if opts == nil {
+		return PrefixSize
+	}
+	size := len(opts.Magic) + PrefixSize
+	if opts.Version != 0 {
+		size++
+	}
+	if opts.WithCodec {
+		size++
+	}
+	if opts.Checksum {
+		size += ChecksumSize
+	}
+	return size
+}
+
+func putHeader(dst []byte, payload []byte, opts *Options) {
+	if opts == nil {
+		ByteOrder.PutUint32(dst, uint32(len(payload)))
+		return
+	}
+	n := copy(dst, opts.Magic)
+	if opts.Version != 0 {
+		dst[n] = opts.Version
+		n++
+	}
+	ByteOrder.PutUint32(dst[n:], uint32(len(payload)))
+	n += PrefixSize
+	if opts.WithCodec {
+		dst[n] = opts.Codec
+		n++
+	}
+	if opts.Checksum {
+		ByteOrder.PutUint32(dst[n:], Checksum(payload))
+	}
+}
+
+// Checksum returns the CRC32C of the payload
+func Checksum(payload []byte) uint32 { return crc32.Checksum(payload, castagnoli) }
+
+// Header is the parsed header of a frame
+type Header struct {
+	Size     uint64
+	Codec    byte
+	Checksum uint32
+}
+
+// ParseHeader parses the header of HeaderSize(opts) bytes, the magic and
+// the version are checked
+func ParseHeader(header []byte, opts *Options) (h Header, err error) {
+	if opts == nil {
+		h.Size = uint64(ByteOrder.Uint32(header))
+		return
+	}
+	if !bytes.HasPrefix(header, opts.Magic) {
+		return h, ErrBadMagic
+	}
+	n := len(opts.Magic)
+	if opts.Version != 0 {
+		if header[n] != opts.Version {
+			return h, ErrBadVersion
+		}
+		n++
+	}
+	h.Size = uint64(ByteOrder.Uint32(header[n:]))
+	n += PrefixSize
+	if opts.WithCodec {
+		h.Codec = header[n]
+		n++
+	}
+	if opts.Checksum {
+		h.Checksum = ByteOrder.Uint32(header[n:])
+	}
+	return
+}
+
+// Verify checks the payload against the checksum in the header, if it's
+// enabled
+func (h Header) Verify(payload []byte, opts *Options) error {
+	if opts != nil && opts.Checksum && Checksum(payload) != h.Checksum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// IsV2 reports whether the prefix of a frame is the magic of V2
+func IsV2(prefix []byte) bool { return bytes.HasPrefix(prefix, MagicV2) }
+
+// Sync discards the bytes in r until the next magic, and returns how many
+// are discarded. A V2 stream is resynced by it after a corrupted frame.
+func Sync(r *bufio.Reader, magic []byte) (discarded int, err error) {
+	for {
+		if _, err = r.Peek(len(magic)); err != nil {
+			return
+		}
+		buffered, _ := r.Peek(r.Buffered())
+		if i := bytes.Index(buffered, magic); i >= 0 {
+			r.Discard(i)
+			return discarded + i, nil
+		}
+		// the tail may be the start of a magic
+		n := len(buffered) - len(magic) + 1
+		r.Discard(n)
+		discarded += n
+	}
+}
+
+// Marshaler is implemented by the gogo generated messages, both in SDK
+// and the agent
+type Marshaler interface {
+	Size() int
+	MarshalToSizedBuffer(dAtA []byte) (int, error)
+}
+
+// Encode marshals the message into a complete frame, in a single buffer so
+// it can be written with one call
+func Encode(m Marshaler, opts *Options) (dst []byte, err error) {
+	size := m.Size()
+	if uint64(size) > math.MaxUint32 {
+		return nil, ErrFrameTooLarge
+	}
+	header := HeaderSize(opts)
+	dst = make([]byte, header+size)
+	if _, err = m.MarshalToSizedBuffer(dst[header:]); err != nil {
+		return nil, err
+	}
+	putHeader(dst, dst[header:], opts)
+	return
+}
+
+// WriteFrame writes the payload as a frame. Header and payload go in a single
+// Write, so frames from concurrent writers never interleave on a pipe.
+func WriteFrame(w io.Writer, payload []byte, opts *Options) (err error) {
+	if uint64(len(payload)) > math.MaxUint32 {
+		return ErrFrameTooLarge
+	}
+	header := HeaderSize(opts)
+	buf := make([]byte, header+len(payload))
+	copy(buf[header:], payload)
+	putHeader(buf, buf[header:], opts)
+	_, err = w.Write(buf)
+	return
+}
+
+// ReadFrame reads a frame and returns the payload. A payload larger than
+// maxSize is not read and ErrFrameTooLarge is returned, the stream can't be
+// recovered after that. maxSize <= 0 means no limit. The codec byte, if
+// enabled, is stored in opts.Codec. A payload of a mismatched checksum is
+// read, and ErrChecksum is returned along with it.
+func ReadFrame(r io.Reader, maxSize int, opts *Options) (payload []byte, err error) {
+	var array [24]byte
+	header := array[:]
+	if size := HeaderSize(opts); size <= len(array) {
+		header = array[:size]
+	} else {
+		header = make([]byte, size)
+	}
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	h, err := ParseHeader(header, opts)
+	if err != nil {
+		return
+	}
+	if maxSize > 0 && h.Size > uint64(maxSize) {
+		return nil, ErrFrameTooLarge
+	}
+	if opts != nil && opts.WithCodec {
+		opts.Codec = h.Codec
+	}
+	payload = make([]byte, h.Size)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	err = h.Verify(payload, opts)
+	return
+}
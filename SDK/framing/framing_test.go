@@ -0,0 +1,184 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type rawMessage []byte
+
+func (m rawMessage) Size() int { return len(m) }
+
+func (m rawMessage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return copy(dAtA, m), nil
+}
+
+func TestPlainFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, []byte("abc"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{3, 0, 0, 0, 'a', 'b', 'c'}) {
+		t.Fatalf("unexpected frame: %v", buf.Bytes())
+	}
+	encoded, err := Encode(rawMessage("abc"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, buf.Bytes()) {
+		t.Fatalf("Encode and WriteFrame mismatch: %v, %v", encoded, buf.Bytes())
+	}
+	payload, err := ReadFrame(&buf, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "abc" {
+		t.Fatalf("unexpected payload: %q", payload)
+	}
+	if _, err = ReadFrame(&buf, 0, nil); err != io.EOF {
+		t.Fatalf("expect EOF on an empty stream, got %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, opts := range []*Options{
+		nil,
+		{},
+		{Magic: []byte("HD")},
+		{WithCodec: true, Codec: 1},
+		{Magic: []byte("HADES"), WithCodec: true, Codec: 2},
+		{Magic: bytes.Repeat([]byte{0xff}, 32)},
+	} {
+		var buf bytes.Buffer
+		for _, payload := range []string{"", "a", "frame"} {
+			if err := WriteFrame(&buf, []byte(payload), opts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := buf.Len(); n != 3*HeaderSize(opts)+len("aframe") {
+			t.Fatalf("%+v: unexpected stream length %d", opts, n)
+		}
+		for _, payload := range []string{"", "a", "frame"} {
+			var read *Options
+			if opts != nil {
+				read = &Options{Magic: opts.Magic, WithCodec: opts.WithCodec}
+			}
+			got, err := ReadFrame(&buf, 0, read)
+			if err != nil {
+				t.Fatalf("%+v: %v", opts, err)
+			}
+			if string(got) != payload {
+				t.Fatalf("%+v: payload %q, expect %q", opts, got, payload)
+			}
+			if read != nil && read.Codec != opts.Codec {
+				t.Fatalf("%+v: codec %d, expect %d", opts, read.Codec, opts.Codec)
+			}
+		}
+	}
+}
+
+func TestBadMagic(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, []byte("abc"), &Options{Magic: []byte("HD")})
+	if _, err := ReadFrame(&buf, 0, &Options{Magic: []byte("HX")}); err != ErrBadMagic {
+		t.Fatalf("expect bad magic, got %v", err)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, []byte("abcd"), nil)
+	frame := buf.Bytes()
+	if _, err := ReadFrame(bytes.NewReader(frame), 3, nil); err != ErrFrameTooLarge {
+		t.Fatalf("expect frame too large, got %v", err)
+	}
+	if _, err := ReadFrame(bytes.NewReader(frame), 4, nil); err != nil {
+		t.Fatalf("frame at the max size: %v", err)
+	}
+	// the length is checked before the payload is allocated
+	huge := []byte{0xff, 0xff, 0xff, 0xff}
+	if _, err := ReadFrame(bytes.NewReader(huge), 1024, nil); err != ErrFrameTooLarge {
+		t.Fatalf("expect frame too large, got %v", err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, []byte("abcd"), &Options{Magic: []byte("HD"), WithCodec: true})
+	frame := buf.Bytes()
+	for i := 1; i < len(frame); i++ {
+		_, err := ReadFrame(bytes.NewReader(frame[:i]), 0, &Options{Magic: []byte("HD"), WithCodec: true})
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated at %d: expect unexpected EOF, got %v", i, err)
+		}
+	}
+}
+
+type shortWriter struct{ writes int }
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return len(b), nil
+}
+
+func TestSingleWrite(t *testing.T) {
+	w := &shortWriter{}
+	if err := WriteFrame(w, []byte("abc"), &Options{Magic: []byte("HD"), WithCodec: true}); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("frame is written in %d calls", w.writes)
+	}
+}
+
+func TestV2(t *testing.T) {
+	var buf bytes.Buffer
+	for _, payload := range []string{"", "first", "second", "third"} {
+		if err := WriteFrame(&buf, []byte(payload), V2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream := buf.Bytes()
+	if !IsV2(stream) || HeaderSize(V2) != 13 {
+		t.Fatalf("unexpected frame: %v", stream[:HeaderSize(V2)])
+	}
+	// flip a byte of the payload of "first", and the version of "second"
+	first := 2*HeaderSize(V2) + 1
+	stream[first] ^= 0xff
+	second := first + len("first") - 1 + len(MagicV2)
+	stream[second] = 3
+	r := bufio.NewReader(bytes.NewReader(stream))
+	if payload, err := ReadFrame(r, 0, V2); err != nil || len(payload) != 0 {
+		t.Fatalf("unexpected empty frame: %q, %v", payload, err)
+	}
+	if _, err := ReadFrame(r, 0, V2); err != ErrChecksum {
+		t.Fatalf("expect checksum mismatch, got %v", err)
+	}
+	// the header is consumed, and the payload is left
+	if _, err := ReadFrame(r, 0, V2); err != ErrBadVersion {
+		t.Fatalf("expect version mismatch, got %v", err)
+	}
+	n, err := Sync(r, MagicV2)
+	if err != nil || n != len("second") {
+		t.Fatalf("unexpected sync: %d, %v", n, err)
+	}
+	if payload, err := ReadFrame(r, 0, V2); err != nil || string(payload) != "third" {
+		t.Fatalf("unexpected frame after sync: %q, %v", payload, err)
+	}
+	if _, err = Sync(r, MagicV2); err != io.EOF {
+		t.Fatalf("expect EOF at the end, got %v", err)
+	}
+}
+
+func TestSyncPartialMagic(t *testing.T) {
+	// the magic spans the buffers of the reader
+	stream := append(bytes.Repeat([]byte{'H'}, 30), MagicV2...)
+	r := bufio.NewReaderSize(bytes.NewReader(stream), 16)
+	n, err := Sync(r, MagicV2)
+	if err != nil || n != 30 {
+		t.Fatalf("unexpected sync: %d, %v", n, err)
+	}
+}
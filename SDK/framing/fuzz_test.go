@@ -0,0 +1,56 @@
+//go:build go1.18
+
+package framing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzReadFrame(f *testing.F) {
+	f.Add([]byte{3, 0, 0, 0, 'a', 'b', 'c'}, false)
+	f.Add([]byte{'H', 'D', 1, 0, 0, 0, 7, 'a'}, true)
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff}, false)
+	f.Fuzz(func(t *testing.T, data []byte, framed bool) {
+		var opts *Options
+		if framed {
+			opts = &Options{Magic: []byte("HD"), WithCodec: true}
+		}
+		r := bytes.NewReader(data)
+		for {
+			payload, err := ReadFrame(r, 1024, opts)
+			if err != nil {
+				return
+			}
+			if len(payload) > 1024 {
+				t.Fatalf("payload of %d bytes exceeds the max size", len(payload))
+			}
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte("abc"), []byte("HD"), true, byte(1))
+	f.Add([]byte{}, []byte{}, false, byte(0))
+	f.Fuzz(func(t *testing.T, payload, magic []byte, withCodec bool, codec byte) {
+		opts := &Options{Magic: magic, WithCodec: withCodec, Codec: codec}
+		var buf bytes.Buffer
+		if err := WriteFrame(&buf, payload, opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != HeaderSize(opts)+len(payload) {
+			t.Fatalf("frame length %d, expect %d", buf.Len(), HeaderSize(opts)+len(payload))
+		}
+		read := &Options{Magic: magic, WithCodec: withCodec}
+		got, err := ReadFrame(&buf, len(payload), read)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("payload mismatch: %v, %v", got, payload)
+		}
+		if withCodec && read.Codec != codec {
+			t.Fatalf("codec %d, expect %d", read.Codec, codec)
+		}
+	})
+}
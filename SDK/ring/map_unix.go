@@ -0,0 +1,52 @@
+//go:build !windows
+
+package ring
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// Map maps the whole file shared, for both read and write
+func Map(f *os.File) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() <= HeaderSize || fi.Size() > HeaderSize+MaxSize {
+		return nil, ErrBadHeader
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// FromEnv opens the ring passed by the agent, it returns nil without error
+// if there is none
+func FromEnv() (*Ring, error) {
+	value, ok := os.LookupEnv(config.RecordRingEnv)
+	if !ok {
+		return nil, nil
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 3 {
+		return nil, ErrBadHeader
+	}
+	f := os.NewFile(uintptr(fd), "ring")
+	// the mapping stays after the file is closed
+	defer f.Close()
+	mem, err := Map(f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Open(mem)
+	if err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Unmap releases the memory, the ring must not be used after
+func (r *Ring) Unmap() error { return syscall.Munmap(r.mem) }
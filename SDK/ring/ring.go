@@ -0,0 +1,251 @@
+// Package ring is the ring buffer in shared memory which carries the records
+// from a plugin to the agent in place of the record pipe. The agent creates
+// the memory and passes it to the plugin as a file, the plugin attaches to it
+// by config.RecordRingEnv, and falls back to the pipe if it can't.
+//
+// The ring is a byte stream with a single writer and a single reader, the
+// frames written to it are the same with the ones on the pipe. The memory is
+// laid out as
+//
+//	[header, a page][data, a power of two]
+//
+// Both sides poll for data or space instead of a syscall per write, with a
+// short spin and then a growing sleep.
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	Magic   = 0x48524e47
+	Version = 1
+	// HeaderSize is the size before the data, the positions are on separate
+	// cache lines
+	HeaderSize = 4096
+	// MinSize and MaxSize bound the data size
+	MinSize = 64 * 1024
+	MaxSize = 1 << 30
+
+	offsetMagic    = 0
+	offsetVersion  = 4
+	offsetSize     = 8
+	offsetHead     = 64
+	offsetTail     = 128
+	offsetAttached = 192
+	offsetWClosed  = 196
+	offsetRClosed  = 200
+)
+
+var (
+	ErrBadHeader = errors.New("ring header mismatch")
+	ErrCorrupted = errors.New("ring positions are corrupted")
+	ErrClosed    = errors.New("ring is closed by the reader")
+	// ErrUnsupported is returned by Map on the platforms without mmap
+	ErrUnsupported = errors.New("ring is not supported on this platform")
+)
+
+// the waits of both sides, spinRounds of yields and then sleeps doubled
+// from minWait up to maxWait
+var (
+	spinRounds = 64
+	minWait    = 50 * time.Microsecond
+	maxWait    = 5 * time.Millisecond
+)
+
+// Ring is one side of the shared memory, the writer or the reader
+type Ring struct {
+	mem  []byte
+	data []byte
+	// the data size is kept in the process, the one in the header is
+	// writable by the other side
+	mask uint64
+	// head is moved by the writer, and tail by the reader. Both grow
+	// forever, the offset in data is the position & mask.
+	head     *uint64
+	tail     *uint64
+	attached *uint32
+	wclosed  *uint32
+	rclosed  *uint32
+	// set by Stop in the reader process
+	stopped uint32
+}
+
+// Size rounds the size up to a power of two in the bounds, and adds the
+// header. It's the size of the memory to create.
+func Size(size int) int {
+	if size < MinSize {
+		size = MinSize
+	}
+	if size > MaxSize {
+		size = MaxSize
+	}
+	n := MinSize
+	for n < size {
+		n <<= 1
+	}
+	return HeaderSize + n
+}
+
+// Init writes the header to the memory created by the agent, which is sized
+// by Size
+func Init(mem []byte) (*Ring, error) {
+	if len(mem) <= HeaderSize || !isPowerOfTwo(len(mem)-HeaderSize) {
+		return nil, ErrBadHeader
+	}
+	binary.LittleEndian.PutUint32(mem[offsetMagic:], Magic)
+	binary.LittleEndian.PutUint32(mem[offsetVersion:], Version)
+	binary.LittleEndian.PutUint64(mem[offsetSize:], uint64(len(mem)-HeaderSize))
+	return newRing(mem), nil
+}
+
+// Open checks the header of the memory passed to the plugin
+func Open(mem []byte) (*Ring, error) {
+	if len(mem) <= HeaderSize ||
+		binary.LittleEndian.Uint32(mem[offsetMagic:]) != Magic ||
+		binary.LittleEndian.Uint32(mem[offsetVersion:]) != Version ||
+		binary.LittleEndian.Uint64(mem[offsetSize:]) != uint64(len(mem)-HeaderSize) ||
+		!isPowerOfTwo(len(mem)-HeaderSize) {
+		return nil, ErrBadHeader
+	}
+	return newRing(mem), nil
+}
+
+func newRing(mem []byte) *Ring {
+	return &Ring{
+		mem:      mem,
+		data:     mem[HeaderSize:],
+		mask:     uint64(len(mem) - HeaderSize - 1),
+		head:     (*uint64)(unsafe.Pointer(&mem[offsetHead])),
+		tail:     (*uint64)(unsafe.Pointer(&mem[offsetTail])),
+		attached: (*uint32)(unsafe.Pointer(&mem[offsetAttached])),
+		wclosed:  (*uint32)(unsafe.Pointer(&mem[offsetWClosed])),
+		rclosed:  (*uint32)(unsafe.Pointer(&mem[offsetRClosed])),
+	}
+}
+
+func isPowerOfTwo(n int) bool { return n > 0 && n&(n-1) == 0 }
+
+// Attach is called by the writer once it takes over the records from the
+// pipe
+func (r *Ring) Attach() { atomic.StoreUint32(r.attached, 1) }
+
+// Attached reports whether the writer is attached
+func (r *Ring) Attached() bool { return atomic.LoadUint32(r.attached) != 0 }
+
+// CloseWrite tells the reader no more data is coming, it reads io.EOF once
+// the ring is drained
+func (r *Ring) CloseWrite() { atomic.StoreUint32(r.wclosed, 1) }
+
+// CloseRead tells the writer the data is not read anymore, the blocked
+// writes return ErrClosed
+func (r *Ring) CloseRead() { atomic.StoreUint32(r.rclosed, 1) }
+
+// Stop is CloseWrite of the reader side, for the writer which is gone
+// without it
+func (r *Ring) Stop() { atomic.StoreUint32(&r.stopped, 1) }
+
+// Buffered returns the size of data written and not read yet
+func (r *Ring) Buffered() int {
+	return int(atomic.LoadUint64(r.head) - atomic.LoadUint64(r.tail))
+}
+
+// Write copies all of p to the ring, it waits for the space if the ring is
+// full
+func (r *Ring) Write(p []byte) (n int, err error) {
+	size := r.mask + 1
+	head := atomic.LoadUint64(r.head)
+	for round := 0; len(p) != 0; {
+		used := head - atomic.LoadUint64(r.tail)
+		if used > size {
+			return n, ErrCorrupted
+		}
+		if used == size {
+			if atomic.LoadUint32(r.rclosed) != 0 {
+				return n, ErrClosed
+			}
+			wait(round)
+			round++
+			continue
+		}
+		round = 0
+		c := r.copyIn(head, p[:minUint64(uint64(len(p)), size-used)])
+		head += uint64(c)
+		// the data is visible before the position
+		atomic.StoreUint64(r.head, head)
+		p = p[c:]
+		n += c
+	}
+	return
+}
+
+// Read copies the data available to p, it waits if the ring is empty, and
+// returns io.EOF once the writer is closed or stopped and the ring is drained
+func (r *Ring) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return
+	}
+	size := r.mask + 1
+	tail := atomic.LoadUint64(r.tail)
+	for round := 0; ; round++ {
+		// checked before the head, so the data written before the close is
+		// not missed
+		closed := atomic.LoadUint32(r.wclosed) != 0 || atomic.LoadUint32(&r.stopped) != 0
+		used := atomic.LoadUint64(r.head) - tail
+		if used > size {
+			return 0, ErrCorrupted
+		}
+		if used != 0 {
+			n = r.copyOut(tail, p[:minUint64(uint64(len(p)), used)])
+			atomic.StoreUint64(r.tail, tail+uint64(n))
+			return
+		}
+		if closed {
+			return 0, io.EOF
+		}
+		wait(round)
+	}
+}
+
+// copyIn copies p at the position, in two parts if it wraps
+func (r *Ring) copyIn(pos uint64, p []byte) int {
+	off := pos & r.mask
+	c := copy(r.data[off:], p)
+	return c + copy(r.data, p[c:])
+}
+
+// copyOut copies to p from the position, in two parts if it wraps
+func (r *Ring) copyOut(pos uint64, p []byte) int {
+	off := pos & r.mask
+	c := copy(p, r.data[off:])
+	return c + copy(p[c:], r.data)
+}
+
+func wait(round int) {
+	if round < spinRounds {
+		runtime.Gosched()
+		return
+	}
+	d := maxWait
+	if shift := round - spinRounds; shift < 16 {
+		if d = minWait << uint(shift); d > maxWait {
+			d = maxWait
+		}
+	}
+	time.Sleep(d)
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+var _ io.ReadWriter = (*Ring)(nil)
@@ -0,0 +1,106 @@
+package ring
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func newTestRing(t *testing.T, size int) *Ring {
+	r, err := Init(make([]byte, Size(size)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSize(t *testing.T) {
+	for _, c := range []struct{ in, out int }{
+		{0, MinSize}, {MinSize, MinSize}, {MinSize + 1, 2 * MinSize}, {MaxSize * 2, MaxSize},
+	} {
+		if got := Size(c.in) - HeaderSize; got != c.out {
+			t.Fatalf("size of %d is %d, expect %d", c.in, got, c.out)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	mem := make([]byte, Size(0))
+	if _, err := Open(mem); !errors.Is(err, ErrBadHeader) {
+		t.Fatalf("uninitialized ring is opened: %v", err)
+	}
+	if _, err := Init(mem); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(mem); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(mem[:len(mem)-1]); !errors.Is(err, ErrBadHeader) {
+		t.Fatalf("truncated ring is opened: %v", err)
+	}
+}
+
+// TestStream writes more than the size through the ring in random chunks, so
+// the positions wrap several times
+func TestStream(t *testing.T) {
+	w := newTestRing(t, 0)
+	r, err := Open(w.mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 5*MinSize+123)
+	rand.Read(data)
+	go func() {
+		for p := data; len(p) != 0; {
+			n := rand.Intn(MinSize/2) + 1
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Error(err)
+				return
+			}
+			p = p[n:]
+		}
+		w.CloseWrite()
+	}()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes mismatch, written %d", len(got), len(data))
+	}
+}
+
+func TestStop(t *testing.T) {
+	r := newTestRing(t, 0)
+	r.Write([]byte("abc"))
+	r.Stop()
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "abc" {
+		t.Fatalf("read %q, %v after stop", got, err)
+	}
+}
+
+func TestCloseRead(t *testing.T) {
+	r := newTestRing(t, 0)
+	r.CloseRead()
+	// the write blocks on the full ring until it sees the close
+	if n, err := r.Write(make([]byte, MinSize+1)); !errors.Is(err, ErrClosed) || n != MinSize {
+		t.Fatalf("write %d, %v to the closed ring", n, err)
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	r := newTestRing(t, 0)
+	*r.head = MinSize + 1
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("corrupted head is read: %v", err)
+	}
+	if _, err := r.Write(make([]byte, 1)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("corrupted head is written: %v", err)
+	}
+}
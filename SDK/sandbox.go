@@ -2,6 +2,7 @@ package SDK
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/chriskaliX/SDK/clock"
+	"github.com/chriskaliX/SDK/config"
 	"github.com/chriskaliX/SDK/logger"
 	"github.com/chriskaliX/SDK/transport"
 	"github.com/chriskaliX/SDK/util/hash"
@@ -26,10 +28,12 @@ type ISandbox interface {
 	Shutdown()
 	// Sandbox attributes and context
 	Name() string
+	AgentID() string
 	Context() context.Context
 	Cancel()
 	// Client related
 	SendRecord(*transport.Record) error
+	Checkpoint([]byte) error
 	SetSendHook(transport.SendHookFunction)
 	// Hash Wrapper
 	GetHash(string) string
@@ -48,9 +52,10 @@ type Sandbox struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	// others
-	sigs  chan os.Signal
-	debug bool
-	Task  chan *transport.Task
+	sigs         chan os.Signal
+	debug        bool
+	capabilities transport.Capabilities
+	Task         chan *transport.Task
 }
 
 type SandboxConfig struct {
@@ -58,8 +63,20 @@ type SandboxConfig struct {
 	Hash      bool
 	Name      string
 	LogConfig *logger.Config
+	// HeartbeatInterval should be well below the heartbeat_timeout set in
+	// the agent, DefaultHeartbeatInterval if it's 0
+	HeartbeatInterval time.Duration
+	// AsyncQueueSize enables the async send of records with a queue of the
+	// size, and Overflow decides what to do once it's full
+	AsyncQueueSize int
+	Overflow       transport.OverflowPolicy
+	// Capabilities are advertised to the agent once Run starts the plugin,
+	// so the handlers registered by Client.OnTask until then are in them
+	Capabilities transport.Capabilities
 }
 
+const DefaultHeartbeatInterval = 10 * time.Second
+
 func NewSandbox() *Sandbox {
 	return &Sandbox{}
 }
@@ -73,6 +90,7 @@ func (s *Sandbox) Init(sconfig *SandboxConfig) error {
 	// Required fields initialization
 	s.Clock = clock.New(time.Second)
 	s.Client = transport.New(s.Clock)
+	s.Client.SetAsync(sconfig.AsyncQueueSize, sconfig.Overflow)
 	sconfig.LogConfig.Clock = s.Clock
 	sconfig.LogConfig.Client = s.Client
 	s.Logger = logger.New(sconfig.LogConfig)
@@ -90,8 +108,10 @@ func (s *Sandbox) Init(sconfig *SandboxConfig) error {
 	if s.Debug() {
 		s.Client.SetSendHook(s.Client.SendDebug)
 	}
+	s.capabilities = sconfig.Capabilities
 	// Sandbox internal cron job
 	go s.ReceiveTask()
+	go s.Heartbeat(sconfig.HeartbeatInterval)
 	return nil
 }
 
@@ -102,6 +122,11 @@ func (s *Sandbox) Run(mfunc func(ISandbox) error) (err error) {
 	if err = mfunc(s); err != nil {
 		return err
 	}
+	if !s.debug {
+		if err := s.Client.Advertise(s.capabilities); err != nil {
+			s.Logger.Error(fmt.Sprintf("advertise capabilities failed: %s", err.Error()))
+		}
+	}
 	s.Logger.Info(fmt.Sprintf("%s is running", s.name))
 	// os.Interrupt for command line
 	signal.Notify(s.sigs, syscall.SIGTERM, os.Interrupt)
@@ -138,6 +163,12 @@ func (s *Sandbox) Name() string {
 	return s.name
 }
 
+// AgentID returns the id of the agent which starts the plugin, empty in
+// debug
+func (s *Sandbox) AgentID() string {
+	return transport.AgentID()
+}
+
 func (s *Sandbox) Debug() bool {
 	return s.debug
 }
@@ -146,6 +177,12 @@ func (s *Sandbox) SendRecord(rec *transport.Record) error {
 	return s.Client.SendRecord(rec)
 }
 
+// Checkpoint saves the offset of the plugin in the agent. The last one is
+// received from Task as TaskCheckpointRestore once the plugin restarts.
+func (s *Sandbox) Checkpoint(offset []byte) error {
+	return s.Client.SendRecord(transport.CheckpointRecord(offset))
+}
+
 func (s *Sandbox) Context() context.Context {
 	return s.ctx
 }
@@ -162,6 +199,29 @@ func (s *Sandbox) GetHash(path string) string {
 	return s.Hash.GetHash(path)
 }
 
+// Heartbeat sends the heartbeat record periodically until the sandbox is
+// cancelled, so the agent knows the process and the pipe still work.
+func (s *Sandbox) Heartbeat(interval time.Duration) {
+	if s.debug {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Client.SendRecord(transport.HeartbeatRecord()); err != nil {
+			s.Logger.Error(err)
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // check pid file if it's not debug
 func (s *Sandbox) Lockfile() error {
 	if s.debug {
@@ -200,11 +260,33 @@ func (s *Sandbox) ReceiveTask() {
 			return
 		default:
 			task, err := s.Client.ReceiveTask()
+			// read timeout, check the context and read again
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
 			if err != nil {
 				s.Logger.Error(err)
 				time.Sleep(5 * time.Second)
 				continue
 			}
+			// reply the clock to the agent directly
+			if task.DataType == config.TaskClockSync {
+				s.Client.SendRecord(transport.ClockRecord(task, s.Clock.Now()))
+				continue
+			}
+			// cancels the task of the token, run by a handler of OnTask
+			if task.DataType == config.TaskCancel {
+				var err error
+				if !s.Client.CancelTask(task.Data) {
+					err = transport.ErrTaskNotRunning
+				}
+				s.Client.SendTaskResult(task, "", err)
+				continue
+			}
+			// tasks with a handler registered by Client.OnTask
+			if s.Client.Dispatch(s.ctx, task) {
+				continue
+			}
 			s.Task <- task
 		}
 	}
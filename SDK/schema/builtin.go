@@ -0,0 +1,42 @@
+package schema
+
+import "github.com/chriskaliX/SDK/config"
+
+// the eBPF events carry the event in json in the data field
+var ebpfDataTypes = []int32{
+	config.DTMemfdCreate, config.DTExecveAt, config.DTExecve, config.DTCommitCreds,
+	config.DTPrctl, config.DTPtrace, config.DTSecuritySocketConnect,
+	config.DTSecuritySocketBind, config.DTUdpRecvmsg, config.DTDoInitModule,
+	config.DTKernelReadFile, config.DTSecurityInodeCreate, config.DTSecuritySbMount,
+	config.DTCallUsermodehelper, config.DTSecurityFileIoctl,
+}
+
+func init() {
+	Default.MustRegister(
+		&Schema{DataType: config.DTPluginClock, Version: 1, Fields: []Field{
+			{Name: "agent_ts", Type: Int, Required: true},
+			{Name: "plugin_ts", Type: Int, Required: true},
+		}},
+		&Schema{DataType: config.DTPluginCheckpoint, Version: 1, Fields: []Field{
+			{Name: "offset", Type: String, Required: true},
+		}},
+		&Schema{DataType: config.DTPluginHeartbeat, Version: 1},
+		&Schema{DataType: config.DTPluginTaskResult, Version: 1, Fields: []Field{
+			{Name: "token", Type: String, Required: true},
+			{Name: "status", Type: String, Required: true},
+			{Name: "output", Type: String},
+			{Name: "error", Type: String},
+		}},
+		&Schema{DataType: config.DTPluginCapabilities, Version: 1, Fields: []Field{
+			{Name: "data_types", Type: String},
+			{Name: "task_types", Type: String},
+			{Name: "features", Type: String},
+			{Name: "config_schema", Type: String},
+		}},
+	)
+	for _, dt := range ebpfDataTypes {
+		Default.MustRegister(&Schema{DataType: dt, Version: 1, Fields: []Field{
+			{Name: "data", Type: String, Required: true},
+		}})
+	}
+}
@@ -0,0 +1,207 @@
+// Package schema is the registry of the versioned schemas of the record
+// payloads by the data type. The plugins stamp the records with the latest
+// version of the data type they are built with, and the agent validates the
+// known ones and upgrades the older versions before they leave the host.
+//
+// The first version of a data type is 1, and each version after it is the
+// previous one with some fields renamed, added or removed. A record of
+// version 0 is unversioned, it's never upgraded.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Type of the value of a field, the values are strings in the payload
+type Type string
+
+const (
+	String Type = "string"
+	Int    Type = "int"
+	Bool   Type = "bool"
+)
+
+var (
+	ErrUnknown = errors.New("schema is unknown")
+	// ErrNewer is returned for the version newer than the ones known, the
+	// record is from a newer plugin
+	ErrNewer = errors.New("schema version is newer than the known ones")
+)
+
+// Field of a payload
+type Field struct {
+	Name     string
+	Type     Type
+	Required bool
+}
+
+// Schema of a version of the data type. Renamed, Defaults and Removed are
+// the changes from the previous version, they are applied in the order to
+// upgrade the payload.
+type Schema struct {
+	DataType int32
+	Version  int32
+	Fields   []Field
+	// new names of the fields renamed, by the old names
+	Renamed map[string]string
+	// values of the fields added
+	Defaults map[string]string
+	Removed  []string
+}
+
+// Registry of the schemas, it's safe for concurrent use
+type Registry struct {
+	mu sync.RWMutex
+	// versions by the data type, the index is the version - 1
+	schemas map[int32][]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[int32][]*Schema)}
+}
+
+// Default is the registry with the schemas of the data types of the SDK
+var Default = NewRegistry()
+
+// Register adds the next version of the data type
+func (r *Registry) Register(s *Schema) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions := r.schemas[s.DataType]
+	if s.Version != int32(len(versions))+1 {
+		return fmt.Errorf("schema of %d: version %d is not the next one of %d", s.DataType, s.Version, len(versions))
+	}
+	names := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		if names[f.Name] {
+			return fmt.Errorf("schema of %d: field %s is duplicated", s.DataType, f.Name)
+		}
+		switch f.Type {
+		case String, Int, Bool:
+		default:
+			return fmt.Errorf("schema of %d: field %s has unknown type %s", s.DataType, f.Name, f.Type)
+		}
+		names[f.Name] = true
+	}
+	r.schemas[s.DataType] = append(versions, s)
+	return nil
+}
+
+// MustRegister registers the schemas, it panics on the error
+func (r *Registry) MustRegister(schemas ...*Schema) {
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Latest returns the latest version of the data type, 0 if it's unknown
+func (r *Registry) Latest(dataType int32) int32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int32(len(r.schemas[dataType]))
+}
+
+// Get returns the version of the data type
+func (r *Registry) Get(dataType, version int32) (*Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.schemas[dataType]
+	if version <= 0 || int(version) > len(versions) {
+		return nil, false
+	}
+	return versions[version-1], true
+}
+
+// DataTypes returns the data types known, sorted
+func (r *Registry) DataTypes() []int32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dts := make([]int32, 0, len(r.schemas))
+	for dt := range r.schemas {
+		dts = append(dts, dt)
+	}
+	sort.Slice(dts, func(i, j int) bool { return dts[i] < dts[j] })
+	return dts
+}
+
+// Upgrade upgrades the fields of the version to the latest one in place, and
+// returns the latest version. The unversioned and unknown payloads are left
+// as they are.
+func (r *Registry) Upgrade(dataType, version int32, fields map[string]string) (int32, error) {
+	r.mu.RLock()
+	versions := r.schemas[dataType]
+	r.mu.RUnlock()
+	switch {
+	case version == 0:
+		return 0, nil
+	case len(versions) == 0:
+		return version, ErrUnknown
+	case int(version) > len(versions):
+		return version, ErrNewer
+	}
+	for _, s := range versions[version:] {
+		s.upgrade(fields)
+	}
+	return int32(len(versions)), nil
+}
+
+func (s *Schema) upgrade(fields map[string]string) {
+	for from, to := range s.Renamed {
+		if value, ok := fields[from]; ok {
+			delete(fields, from)
+			fields[to] = value
+		}
+	}
+	for name, value := range s.Defaults {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	for _, name := range s.Removed {
+		delete(fields, name)
+	}
+}
+
+// Validate checks the fields against the version of the data type, the
+// fields not in the schema are allowed
+func (r *Registry) Validate(dataType, version int32, fields map[string]string) error {
+	s, ok := r.Get(dataType, version)
+	if !ok {
+		if version > r.Latest(dataType) && r.Latest(dataType) != 0 {
+			return ErrNewer
+		}
+		return ErrUnknown
+	}
+	return s.Validate(fields)
+}
+
+// Validate checks the required fields are set, and the values are of the
+// types
+func (s *Schema) Validate(fields map[string]string) error {
+	for _, f := range s.Fields {
+		value, ok := fields[f.Name]
+		if !ok {
+			if f.Required {
+				return fmt.Errorf("field %s is required", f.Name)
+			}
+			continue
+		}
+		var err error
+		switch f.Type {
+		case Int:
+			_, err = strconv.ParseInt(value, 10, 64)
+		case Bool:
+			_, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s is not %s: %q", f.Name, f.Type, value)
+		}
+	}
+	return nil
+}
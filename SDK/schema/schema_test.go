@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func testRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	r.MustRegister(
+		&Schema{DataType: 1000, Version: 1, Fields: []Field{
+			{Name: "exe", Type: String, Required: true},
+			{Name: "pid", Type: Int},
+		}},
+		&Schema{DataType: 1000, Version: 2, Fields: []Field{
+			{Name: "path", Type: String, Required: true},
+			{Name: "pid", Type: Int},
+			{Name: "container", Type: Bool, Required: true},
+		}, Renamed: map[string]string{"exe": "path"}, Defaults: map[string]string{"container": "false"}},
+		&Schema{DataType: 1000, Version: 3, Fields: []Field{
+			{Name: "path", Type: String, Required: true},
+			{Name: "container", Type: Bool, Required: true},
+		}, Removed: []string{"pid"}},
+	)
+	return r
+}
+
+func TestUpgrade(t *testing.T) {
+	r := testRegistry(t)
+	fields := map[string]string{"exe": "/bin/sh", "pid": "42", "argv": "sh"}
+	version, err := r.Upgrade(1000, 1, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 || !reflect.DeepEqual(fields, map[string]string{"path": "/bin/sh", "container": "false", "argv": "sh"}) {
+		t.Fatalf("unexpected upgrade to %d: %v", version, fields)
+	}
+	if err = r.Validate(1000, version, fields); err != nil {
+		t.Fatal(err)
+	}
+	// the unversioned ones are never upgraded
+	if version, err = r.Upgrade(1000, 0, map[string]string{}); version != 0 || err != nil {
+		t.Fatalf("unversioned record is upgraded to %d: %v", version, err)
+	}
+	if _, err = r.Upgrade(1000, 4, map[string]string{}); err != ErrNewer {
+		t.Fatalf("unexpected error of the newer version: %v", err)
+	}
+	if _, err = r.Upgrade(1001, 1, map[string]string{}); err != ErrUnknown {
+		t.Fatalf("unexpected error of the unknown data type: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := testRegistry(t)
+	for _, c := range []struct {
+		version int32
+		fields  map[string]string
+		valid   bool
+	}{
+		{1, map[string]string{"exe": "/bin/sh"}, true},
+		{1, map[string]string{"exe": "/bin/sh", "pid": "x"}, false},
+		{1, map[string]string{"pid": "42"}, false},
+		{3, map[string]string{"path": "/bin/sh", "container": "yes"}, false},
+		{3, map[string]string{"path": "/bin/sh", "container": "true"}, true},
+	} {
+		if err := r.Validate(1000, c.version, c.fields); (err == nil) != c.valid {
+			t.Errorf("%v of version %d should be valid: %v, %v", c.fields, c.version, c.valid, err)
+		}
+	}
+	if err := r.Validate(1000, 4, nil); err != ErrNewer {
+		t.Fatalf("unexpected error of the newer version: %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := testRegistry(t)
+	for _, s := range []*Schema{
+		{DataType: 1000, Version: 5},
+		{DataType: 1001, Version: 2},
+		{DataType: 1001, Version: 1, Fields: []Field{{Name: "a", Type: String}, {Name: "a", Type: Int}}},
+		{DataType: 1001, Version: 1, Fields: []Field{{Name: "a", Type: "float"}}},
+	} {
+		if err := r.Register(s); err == nil {
+			t.Errorf("schema should be invalid: %+v", s)
+		}
+	}
+	if r.Latest(1000) != 3 || r.Latest(1001) != 0 || !reflect.DeepEqual(r.DataTypes(), []int32{1000}) {
+		t.Fatalf("unexpected registry: %v", r.DataTypes())
+	}
+}
+
+func TestDefault(t *testing.T) {
+	for _, dt := range []int32{config.DTPluginTaskResult, config.DTPluginClock, config.DTExecve} {
+		if Default.Latest(dt) != 1 {
+			t.Errorf("schema of %d is not registered", dt)
+		}
+	}
+	if err := Default.Validate(config.DTPluginClock, 1, map[string]string{"agent_ts": "1", "plugin_ts": "2"}); err != nil {
+		t.Fatal(err)
+	}
+}
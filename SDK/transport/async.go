@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"errors"
+	"sync"
+)
+
+// OverflowPolicy decides what SendRecord does once the queue of the async
+// mode is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the flusher makes room for the record
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the record queued first for the new one
+	OverflowDropOldest
+	// OverflowDropNewest discards the new record, SendRecord returns
+	// ErrQueueFull
+	OverflowDropNewest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	}
+	return "unknown"
+}
+
+var (
+	ErrQueueFull   = errors.New("send queue is full")
+	ErrQueueClosed = errors.New("send queue is closed")
+)
+
+// sendQueue holds the encoded records of the async mode. The sequences
+// count the records pushed and the ones done with, written or dropped, so
+// Flush waits for the records sent before it only.
+type sendQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	frames  [][]byte
+	size    int
+	policy  OverflowPolicy
+	closed  bool
+	pushed  uint64
+	done    uint64
+	dropped uint64
+	// the last write error of the flusher, returned by next Flush
+	err  error
+	exit chan struct{}
+}
+
+// SetAsync makes SendRecord encode the record and put it into a queue of
+// size records, which is written by a background flusher. Records queued
+// together are written at once and coalesced as set by SetCoalesce. It
+// should be called before any record is sent, and only the first call with
+// a size > 0 takes effect.
+func (c *Client) SetAsync(size int, policy OverflowPolicy) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if size <= 0 || c.sendQueue() != nil {
+		return
+	}
+	q := &sendQueue{size: size, policy: policy, exit: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	c.queue.Store(q)
+	go c.runQueue(q)
+}
+
+func (c *Client) sendQueue() *sendQueue {
+	q, _ := c.queue.Load().(*sendQueue)
+	return q
+}
+
+// AsyncStats returns the records waiting in the queue and the ones dropped
+// by the overflow policy
+func (c *Client) AsyncStats() (queued int, dropped uint64) {
+	q := c.sendQueue()
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.frames), q.dropped
+}
+
+func (q *sendQueue) push(frame []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && len(q.frames) >= q.size {
+		switch q.policy {
+		case OverflowDropOldest:
+			q.frames[0] = nil
+			q.frames = q.frames[1:]
+			q.dropped++
+			q.done++
+			q.cond.Broadcast()
+		case OverflowDropNewest:
+			q.dropped++
+			return ErrQueueFull
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.frames = append(q.frames, frame)
+	q.pushed++
+	q.cond.Broadcast()
+	return nil
+}
+
+// wait blocks until the records pushed so far are done with
+func (q *sendQueue) wait() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for seq := q.pushed; q.done < seq && !(q.closed && len(q.frames) == 0); {
+		q.cond.Wait()
+	}
+	err := q.err
+	q.err = nil
+	return err
+}
+
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.exit
+}
+
+// runQueue takes all the records queued at a time and writes them under
+// one lock of the writer
+func (c *Client) runQueue(q *sendQueue) {
+	defer close(q.exit)
+	for {
+		q.mu.Lock()
+		for len(q.frames) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.frames) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		batch := q.frames
+		q.frames = make([][]byte, 0, len(batch))
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		var err error
+		c.wmu.Lock()
+		for _, frame := range batch {
+			if _, err = c.writer.Write(frame); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = c.coalesce()
+		}
+		c.wmu.Unlock()
+
+		q.mu.Lock()
+		q.done += uint64(len(batch))
+		if err != nil {
+			q.err = err
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockWriter holds the writes until it's released
+type blockWriter struct {
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func (w *blockWriter) unblock() { w.once.Do(func() { close(w.release) }) }
+
+func TestAsyncFlush(t *testing.T) {
+	c, _, counter := newTestClient(nil)
+	c.SetAsync(16, OverflowBlock)
+	size := 0
+	for i := 0; i < 10; i++ {
+		size += send(t, c)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, bytes := counter.count(); bytes != size {
+		t.Fatalf("queued records are not flushed: %d of %d bytes", bytes, size)
+	}
+	size += send(t, c)
+	c.Close()
+	if _, bytes := counter.count(); bytes != size {
+		t.Fatalf("close does not drain the queue: %d of %d bytes", bytes, size)
+	}
+	if err := c.SendRecord(testRecord()); err != ErrQueueClosed {
+		t.Fatalf("send after close: %v", err)
+	}
+}
+
+// fill sends records until the flusher is blocked on the writer and the
+// queue is full
+func fill(t *testing.T, c *Client, size int) {
+	// the first record is taken by the flusher, and the buffer of the
+	// writer is bypassed by a record as large as it
+	big := &Record{DataType: 1, Data: &Payload{Fields: map[string]string{"data": string(make([]byte, 512*1024))}}}
+	if err := c.SendRecord(big); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for queued, _ := c.AsyncStats(); queued != 0; queued, _ = c.AsyncStats() {
+		if time.Now().After(deadline) {
+			t.Fatal("record is not taken by the flusher")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < size; i++ {
+		send(t, c)
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		t.Run(policy.String(), func(t *testing.T) {
+			w := &blockWriter{release: make(chan struct{})}
+			defer w.unblock()
+			c, _, _ := newTestClient(w)
+			c.SetAsync(4, policy)
+			fill(t, c, 4)
+			sent := make(chan error, 1)
+			go func() { sent <- c.SendRecord(testRecord()) }()
+			var err error
+			select {
+			case err = <-sent:
+				if policy == OverflowBlock {
+					t.Fatal("send does not block on the full queue")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if policy != OverflowBlock {
+					t.Fatal("send blocks on the full queue")
+				}
+				w.unblock()
+				err = <-sent
+			}
+			queued, dropped := c.AsyncStats()
+			switch policy {
+			case OverflowDropOldest:
+				if err != nil || queued != 4 || dropped != 1 {
+					t.Fatalf("unexpected stats: %v, %d queued, %d dropped", err, queued, dropped)
+				}
+			case OverflowDropNewest:
+				if err != ErrQueueFull || queued != 4 || dropped != 1 {
+					t.Fatalf("unexpected stats: %v, %d queued, %d dropped", err, queued, dropped)
+				}
+			case OverflowBlock:
+				if err != nil || dropped != 0 {
+					t.Fatalf("unexpected stats: %v, %d dropped", err, dropped)
+				}
+			}
+			w.unblock()
+			if err = c.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func BenchmarkAsync(b *testing.B) {
+	c, _, _ := newTestClient(io.Discard)
+	c.SetAsync(4096, OverflowBlock)
+	rec := testRecord()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.SendRecord(rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+	c.Flush()
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// Capabilities is what the plugin supports, advertised by Advertise once it
+// starts. The agent keeps the last one and forwards it to the server, which
+// validates the tasks and the configs for the plugin by it.
+type Capabilities struct {
+	// DataTypes are the records the plugin sends
+	DataTypes []int32
+	// TaskTypes are the tasks it handles, the ones registered by OnTask if
+	// it's empty
+	TaskTypes []int32
+	// ConfigSchema is the json schema of the config in DETAIL
+	ConfigSchema string
+}
+
+// Features returns the protocol features in use, negotiated with the agent
+// when the client is created
+func (c *Client) Features() (features []string) {
+	if c.framing != nil {
+		features = append(features, config.FeatureFramingV2)
+	}
+	if c.ring != nil {
+		features = append(features, config.FeatureRing)
+	}
+	if atomic.LoadInt64(&c.chunkSize) > 0 {
+		features = append(features, config.FeatureChunking)
+	}
+	if len(c.taskTypes()) != 0 {
+		features = append(features, config.FeatureTaskCancel)
+	}
+	return
+}
+
+// taskTypes returns the data types of the handlers in order
+func (c *Client) taskTypes() []int32 {
+	c.tasks.mu.RLock()
+	defer c.tasks.mu.RUnlock()
+	types := make([]int32, 0, len(c.tasks.handlers))
+	for dt := range c.tasks.handlers {
+		types = append(types, dt)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// CapabilitiesRecord carries the capabilities along with the features in
+// use, the lists are joined by commas
+func (c *Client) CapabilitiesRecord(caps Capabilities) *Record {
+	if len(caps.TaskTypes) == 0 {
+		caps.TaskTypes = c.taskTypes()
+	}
+	fields := map[string]string{
+		"data_types": joinTypes(caps.DataTypes),
+		"task_types": joinTypes(caps.TaskTypes),
+		"features":   strings.Join(c.Features(), ","),
+	}
+	if caps.ConfigSchema != "" {
+		fields["config_schema"] = caps.ConfigSchema
+	}
+	return &Record{
+		DataType: config.DTPluginCapabilities,
+		Data:     &Payload{Fields: fields},
+	}
+}
+
+// Advertise sends the capabilities to the agent. It's called once the
+// handlers are registered, and again whenever they change.
+func (c *Client) Advertise(caps Capabilities) error {
+	return c.SendRecord(c.CapabilitiesRecord(caps))
+}
+
+func joinTypes(types []int32) string {
+	s := make([]string, 0, len(types))
+	for _, t := range types {
+		s = append(s, strconv.Itoa(int(t)))
+	}
+	return strings.Join(s, ",")
+}
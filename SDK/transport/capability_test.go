@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+func TestCapabilitiesRecord(t *testing.T) {
+	c, _, _ := newTestClient(io.Discard)
+	rec := c.CapabilitiesRecord(Capabilities{DataTypes: []int32{3000, 3001}})
+	if rec.DataType != config.DTPluginCapabilities {
+		t.Fatalf("unexpected data type %d", rec.DataType)
+	}
+	fields := rec.Data.Fields
+	if fields["data_types"] != "3000,3001" || fields["task_types"] != "" || fields["features"] != "" {
+		t.Fatalf("unexpected capabilities: %v", fields)
+	}
+	if _, ok := fields["config_schema"]; ok {
+		t.Fatal("empty config schema is sent")
+	}
+	// the handlers and the features negotiated
+	handler := func(ctx context.Context, task *Task) (string, error) { return "", nil }
+	c.OnTask(2001, handler)
+	c.OnTask(2000, handler)
+	c.framing = framing.V2
+	c.SetChunkSize(64 * 1024)
+	fields = c.CapabilitiesRecord(Capabilities{ConfigSchema: `{"type":"object"}`}).Data.Fields
+	expect := map[string]string{
+		"data_types":    "",
+		"task_types":    "2000,2001",
+		"features":      "framing_v2,chunking,task_cancel",
+		"config_schema": `{"type":"object"}`,
+	}
+	for k, v := range expect {
+		if fields[k] != v {
+			t.Errorf("%s is %q, expect %q", k, fields[k], v)
+		}
+	}
+}
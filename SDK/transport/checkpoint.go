@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+var ErrNotCheckpoint = errors.New("task is not a checkpoint restore")
+
+// CheckpointRecord carries the offset of the plugin, e.g. the position in a
+// log. The agent keeps the last one and delivers it back by
+// TaskCheckpointRestore after the plugin restarts.
+func CheckpointRecord(offset []byte) *Record {
+	return &Record{
+		DataType: config.DTPluginCheckpoint,
+		Data: &Payload{
+			Fields: map[string]string{
+				"offset": base64.StdEncoding.EncodeToString(offset),
+			},
+		},
+	}
+}
+
+// CheckpointOffset returns the offset restored by the agent
+func CheckpointOffset(task *Task) ([]byte, error) {
+	if task.GetDataType() != config.TaskCheckpointRestore {
+		return nil, ErrNotCheckpoint
+	}
+	return base64.StdEncoding.DecodeString(task.GetData())
+}
@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestCheckpoint(t *testing.T) {
+	offset := []byte{0, 1, 2, 0xff}
+	rec := CheckpointRecord(offset)
+	if rec.DataType != config.DTPluginCheckpoint {
+		t.Fatalf("unexpected data type: %d", rec.DataType)
+	}
+	// the agent echoes the field back as it is
+	task := &Task{DataType: config.TaskCheckpointRestore, Data: rec.Data.Fields["offset"]}
+	restored, err := CheckpointOffset(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, offset) {
+		t.Fatalf("offset %v is restored as %v", offset, restored)
+	}
+	if _, err := CheckpointOffset(&Task{DataType: config.TaskClockSync}); err != ErrNotCheckpoint {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// chunkOverhead is reserved in a chunk for the fields other than the data
+const chunkOverhead = 128
+
+// minChunkSize bounds the chunk size offered, so a chunk carries more data
+// than the fields around it
+const minChunkSize = 4 * chunkOverhead
+
+// negotiateChunking enables the chunking if the agent offers a chunk size
+func (c *Client) negotiateChunking() {
+	if size, err := strconv.Atoi(os.Getenv(config.ChunkSizeEnv)); err == nil {
+		c.SetChunkSize(size)
+	}
+}
+
+// SetChunkSize splits the records larger than size into DTPluginChunk
+// records, which the agent reassembles. Zero disables the chunking, and it's
+// the default unless the agent offers one by config.ChunkSizeEnv.
+func (c *Client) SetChunkSize(size int) {
+	if size > 0 && size < minChunkSize {
+		size = minChunkSize
+	}
+	atomic.StoreInt64(&c.chunkSize, int64(size))
+}
+
+// encodeChunks encodes the record into the frames of the chunks, which are
+// written in a single Write. The chunks of a record are never interleaved
+// with other records then, and the agent keeps one record in reassembly
+// only.
+func (c *Client) encodeChunks(rec *Record, chunkSize int) (dst []byte, err error) {
+	var data []byte
+	if data, err = rec.Marshal(); err != nil {
+		return
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&c.chunkSeq, 1), 10)
+	size := chunkSize - chunkOverhead
+	total := (len(data) + size - 1) / size
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		// the fields are not validated as utf-8 by gogo, so the data is
+		// carried as it is
+		chunk := &Record{
+			DataType:  config.DTPluginChunk,
+			Timestamp: rec.Timestamp,
+			Data: &Payload{Fields: map[string]string{
+				"id":    id,
+				"seq":   strconv.Itoa(seq),
+				"total": strconv.Itoa(total),
+				"data":  string(data[seq*size : end]),
+			}},
+		}
+		var frame []byte
+		if frame, err = framing.Encode(chunk, c.framing); err != nil {
+			return
+		}
+		dst = append(dst, frame...)
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+func TestChunk(t *testing.T) {
+	var out bytes.Buffer
+	c, _, _ := newTestClient(&out)
+	c.SetChunkSize(1024)
+	large := &Record{DataType: 1000, Data: &Payload{Fields: map[string]string{"content": strings.Repeat("x", 5000)}}}
+	if err := c.SendRecord(large); err != nil {
+		t.Fatal(err)
+	}
+	send(t, c)
+	c.Flush()
+	r := bufio.NewReader(&out)
+	var data []byte
+	for seq := 0; seq < 6; seq++ {
+		payload, err := framing.ReadFrame(r, 1024, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk := &Record{}
+		if err = chunk.Unmarshal(payload); err != nil {
+			t.Fatal(err)
+		}
+		fields := chunk.GetData().GetFields()
+		if chunk.DataType != config.DTPluginChunk || fields["id"] != "1" || fields["seq"] != strconv.Itoa(seq) || fields["total"] != "6" {
+			t.Fatalf("unexpected chunk %d: %s, %s of %s", chunk.DataType, fields["id"], fields["seq"], fields["total"])
+		}
+		data = append(data, fields["data"]...)
+	}
+	assembled := &Record{}
+	if err := assembled.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if assembled.DataType != 1000 || assembled.Data.Fields["content"] != large.Data.Fields["content"] {
+		t.Fatalf("unexpected assembled record: %d", assembled.DataType)
+	}
+	// the small one is not chunked
+	payload, err := framing.ReadFrame(r, 1024, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := &Record{}
+	if err = small.Unmarshal(payload); err != nil || small.DataType != 1000 {
+		t.Fatalf("unexpected record: %v, %v", small, err)
+	}
+}
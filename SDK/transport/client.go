@@ -2,17 +2,25 @@ package transport
 
 import (
 	"bufio"
-	"encoding/binary"
+	"errors"
 	fmt "fmt"
 	io "io"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chriskaliX/SDK/clock"
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+	"github.com/chriskaliX/SDK/ring"
+	"github.com/chriskaliX/SDK/schema"
 )
 
 type SendHookFunction func(*Record) error
 
-const ElkeidEnv = "SPECIFIED_AGENT_ID"
+// Deprecated: use AgentID, or config.ElkeidAgentIDEnv
+const ElkeidEnv = config.ElkeidAgentIDEnv
 
 var _ ITransport = (*Client)(nil)
 
@@ -29,39 +37,143 @@ type ITransport interface {
 }
 
 type Client struct {
+	// first in the struct for the 64-bit alignment on 32-bit platforms.
+	// The corrupted task frames skipped in V2, and the records larger than
+	// chunkSize are split into chunks numbered by chunkSeq.
+	corruptedTasks uint64
+	chunkSize      int64
+	chunkSeq       uint64
+
 	rx     io.ReadCloser
 	tx     io.WriteCloser
 	reader *bufio.Reader
 	writer *bufio.Writer
-	rmu    *sync.Mutex
-	wmu    *sync.Mutex
+	// the pipe which tasks are read from, and the timeout for waiting
+	// next task. Zero means block until the task arrives
+	rpipe       *os.File
+	readTimeout time.Duration
+	rmu         *sync.Mutex
+	wmu         *sync.Mutex
 	// Hook function for Elkeid
 	hook  SendHookFunction
 	clock clock.IClock
+	// write coalescing, guarded by wmu. Records are flushed once they reach
+	// coalesceBytes, or coalesceDelay after the first one is buffered
+	coalesceDelay time.Duration
+	coalesceBytes int
+	pendingSince  time.Time
+	flushTimer    *time.Timer
+	// *sendQueue of the async mode, unset if records are written by
+	// SendRecord. It's read by the periodic flush, so it's stored atomically
+	queue atomic.Value
+	// handlers of tasks registered by OnTask
+	tasks dispatcher
+	// the ring which records are written to in place of the pipe, if it's
+	// attached
+	ring *ring.Ring
+	// framing of records, nil for the plain one. taskV2 is set once a task
+	// comes in V2, guarded by rmu.
+	framing *framing.Options
+	taskV2  bool
+}
+
+// negotiateFraming switches the records to V2 if the agent offers it. The
+// empty frame written first tells the agent to send the tasks in V2 too.
+func (c *Client) negotiateFraming() {
+	if os.Getenv(config.FramingEnv) != "2" {
+		return
+	}
+	c.framing = framing.V2
+	framing.WriteFrame(c.writer, nil, c.framing)
+}
+
+// CorruptedTasks returns the task frames skipped for corruption
+func (c *Client) CorruptedTasks() uint64 { return atomic.LoadUint64(&c.corruptedTasks) }
+
+// encodeRecord encodes the record into a frame, or the frames of the chunks
+// if it's larger than the chunk size
+func (c *Client) encodeRecord(rec *Record) ([]byte, error) {
+	if chunkSize := int(atomic.LoadInt64(&c.chunkSize)); chunkSize > 0 && rec.Size() > chunkSize {
+		return c.encodeChunks(rec, chunkSize)
+	}
+	return framing.Encode(rec, c.framing)
 }
 
 func (c *Client) SetSendHook(hook SendHookFunction) {
 	c.hook = hook
 }
 
+// SetReadTimeout bounds the wait for the length prefix of next task. When
+// it's exceeded, ReceiveTask returns os.ErrDeadlineExceeded and the caller
+// is free to check its context and read again.
+func (c *Client) SetReadTimeout(d time.Duration) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	c.readTimeout = d
+}
+
+// SetCoalesce enables the coalescing of records, a zero value disables the
+// corresponding threshold. Without both, records are flushed by the periodic
+// flush or when the buffer is full.
+func (c *Client) SetCoalesce(delay time.Duration, bytes int) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.coalesceDelay = delay
+	c.coalesceBytes = bytes
+}
+
+// coalesce decides whether to flush after a record is buffered. The delay is
+// checked by the clock on each send, and by a timer in case no more record
+// comes.
+func (c *Client) coalesce() (err error) {
+	if c.coalesceDelay <= 0 && c.coalesceBytes <= 0 {
+		return
+	}
+	if c.coalesceBytes > 0 && c.writer.Buffered() >= c.coalesceBytes {
+		return c.flush()
+	}
+	if c.coalesceDelay <= 0 {
+		return
+	}
+	now := c.clock.Now()
+	if c.pendingSince.IsZero() {
+		c.pendingSince = now
+		c.flushTimer = time.AfterFunc(c.coalesceDelay, func() { c.Flush() })
+		return
+	}
+	if now.Sub(c.pendingSince) >= c.coalesceDelay {
+		return c.flush()
+	}
+	return
+}
+
+// flush writes the buffered records, wmu must be held
+func (c *Client) flush() (err error) {
+	c.pendingSince = time.Time{}
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+	if c.writer.Buffered() != 0 {
+		err = c.writer.Flush()
+	}
+	return
+}
+
 // Plugin Client send record to agent. Add an extra size flag to simplify
 // the operation which agent side decodes.
 // Sync With Elkeid
 func (c *Client) SendElkeid(rec *Record) (err error) {
 	c.wmu.Lock()
 	defer c.wmu.Unlock()
-	size := rec.Size()
-	err = binary.Write(c.writer, binary.LittleEndian, uint32(size))
-	if err != nil {
+	var buf []byte
+	if buf, err = c.encodeRecord(rec); err != nil {
 		return
 	}
-	var buf []byte
-	buf, err = rec.Marshal()
-	if err != nil {
+	if _, err = c.writer.Write(buf); err != nil {
 		return
 	}
-	_, err = c.writer.Write(buf)
-	return
+	return c.coalesce()
 }
 
 func (c *Client) SendDebug(rec *Record) (err error) {
@@ -73,38 +185,43 @@ func (c *Client) SendDebug(rec *Record) (err error) {
 func (c *Client) SendRecord(rec *Record) (err error) {
 	// fill up with the ts by ticker
 	rec.Timestamp = c.clock.Now().Unix()
+	// the records of the known data types are of the schemas the plugin is
+	// built with
+	if rec.SchemaVersion == 0 {
+		rec.SchemaVersion = schema.Default.Latest(rec.DataType)
+	}
 	// check hook
 	if c.hook != nil {
 		return c.hook(rec)
 	}
+	// encoded here, so the record is free to be reused once it returns
+	if q := c.sendQueue(); q != nil {
+		var buf []byte
+		if buf, err = c.encodeRecord(rec); err != nil {
+			return
+		}
+		return q.push(buf)
+	}
 	c.wmu.Lock()
 	defer c.wmu.Unlock()
 	var buf []byte
-	if buf, err = rec.Marshal(); err != nil {
+	if buf, err = c.encodeRecord(rec); err != nil {
 		return
 	}
-	if err = binary.Write(c.writer, binary.LittleEndian, uint32(len(buf))); err != nil {
+	if _, err = c.writer.Write(buf); err != nil {
 		return
 	}
-	_, err = c.writer.Write(buf)
-	return
+	return c.coalesce()
 }
 
 func (c *Client) ReceiveTask() (t *Task, err error) {
 	c.rmu.Lock()
 	defer c.rmu.Unlock()
-	var len uint32
-	err = binary.Read(c.reader, binary.LittleEndian, &len)
-	if err != nil {
+	if err = c.waitFrame(); err != nil {
 		return
 	}
 	var buf []byte
-	buf, err = c.reader.Peek(int(len))
-	if err != nil {
-		return
-	}
-	_, err = c.reader.Discard(int(len))
-	if err != nil {
+	if buf, err = c.readTask(); err != nil {
 		return
 	}
 	t = &Task{}
@@ -112,17 +229,71 @@ func (c *Client) ReceiveTask() (t *Task, err error) {
 	return
 }
 
+// readTask reads the payload of next task. The agent sends the plain frames
+// until it reads the first V2 one, and V2 ones after. Then a frame without
+// the magic is corrupted, and the stream is resynced to the next magic.
+func (c *Client) readTask() (buf []byte, err error) {
+	for {
+		var prefix []byte
+		if prefix, err = c.reader.Peek(len(framing.MagicV2)); err != nil {
+			return
+		}
+		if framing.IsV2(prefix) {
+			c.taskV2 = true
+			buf, err = framing.ReadFrame(c.reader, maxTaskSize, framing.V2)
+			if errors.Is(err, framing.ErrChecksum) || errors.Is(err, framing.ErrBadVersion) ||
+				errors.Is(err, framing.ErrFrameTooLarge) {
+				atomic.AddUint64(&c.corruptedTasks, 1)
+				continue
+			}
+			return
+		}
+		if !c.taskV2 {
+			return framing.ReadFrame(c.reader, maxTaskSize, nil)
+		}
+		atomic.AddUint64(&c.corruptedTasks, 1)
+		if _, err = framing.Sync(c.reader, framing.MagicV2); err != nil {
+			return
+		}
+	}
+}
+
+// waitFrame peeks the length prefix within the read timeout. Peek does not
+// consume, so a partial prefix stays in the buffer for the next read.
+func (c *Client) waitFrame() (err error) {
+	if c.readTimeout <= 0 || c.rpipe == nil {
+		return
+	}
+	// deadline is not supported by the fd, just block on the read
+	if c.rpipe.SetReadDeadline(time.Now().Add(c.readTimeout)) != nil {
+		return
+	}
+	defer c.rpipe.SetReadDeadline(time.Time{})
+	_, err = c.reader.Peek(PrefixSize)
+	return
+}
+
+// Flush writes the records sent before it, including the ones queued in the
+// async mode
 func (c *Client) Flush() (err error) {
+	if q := c.sendQueue(); q != nil {
+		if err = q.wait(); err != nil {
+			return
+		}
+	}
 	c.wmu.Lock()
 	defer c.wmu.Unlock()
-	if c.writer.Buffered() != 0 {
-		err = c.writer.Flush()
-	}
-	return
+	return c.flush()
 }
 
 func (c *Client) Close() {
-	c.writer.Flush()
+	if q := c.sendQueue(); q != nil {
+		q.close()
+	}
+	c.Flush()
+	if c.ring != nil {
+		c.ring.CloseWrite()
+	}
 	c.rx.Close()
 	c.tx.Close()
 }
@@ -6,24 +6,40 @@ import (
 	"bufio"
 	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/chriskaliX/SDK/clock"
+	"github.com/chriskaliX/SDK/ring"
 )
 
 func New(clock clock.IClock) (c *Client) {
+	// The fd is inherited in blocking mode, set it to non-blocking before
+	// os.NewFile so that it's pollable and supports read deadline
+	syscall.SetNonblock(3, true)
+	rpipe := os.NewFile(3, "pipe")
 	c = &Client{
 		rx: os.Stdin,
 		tx: os.Stdout,
 		// MAX_SIZE = 1 MB
-		reader: bufio.NewReaderSize(os.NewFile(3, "pipe"), 1024*1024),
+		reader: bufio.NewReaderSize(rpipe, 1024*1024),
+		rpipe:  rpipe,
 		writer: bufio.NewWriterSize(os.NewFile(4, "pipe"), 512*1024),
 		rmu:    &sync.Mutex{},
 		wmu:    &sync.Mutex{},
 		clock:  clock,
 	}
+	// records go to the shared memory ring if the agent offers one, and to
+	// the pipe if it can't be attached
+	if r, err := ring.FromEnv(); err == nil && r != nil {
+		c.ring = r
+		c.writer = bufio.NewWriterSize(r, 512*1024)
+		r.Attach()
+	}
+	c.negotiateFraming()
+	c.negotiateChunking()
 	// Elkeid, only for linux
-	if _, ok := os.LookupEnv(ElkeidEnv); ok {
+	if underElkeid() {
 		c.SetSendHook(c.SendElkeid)
 	}
 	go func() {
@@ -0,0 +1,253 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// fakeClock is moved by the test only
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) Add(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+}
+
+func (f *fakeClock) Reset(time.Duration) {}
+func (f *fakeClock) Close()              {}
+
+// countWriter counts the writes which go to the pipe
+type countWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	writes int
+	bytes  int
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.writes++
+	c.bytes += len(b)
+	c.mu.Unlock()
+	if c.w == nil {
+		return len(b), nil
+	}
+	return c.w.Write(b)
+}
+
+func (c *countWriter) count() (writes, bytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writes, c.bytes
+}
+
+func newTestClient(w io.Writer) (*Client, *fakeClock, *countWriter) {
+	clock := &fakeClock{t: time.Unix(1, 0)}
+	counter := &countWriter{w: w}
+	rx, _ := os.Open(os.DevNull)
+	tx, _ := os.Open(os.DevNull)
+	return &Client{
+		rx:     rx,
+		tx:     tx,
+		writer: bufio.NewWriterSize(counter, 512*1024),
+		rmu:    &sync.Mutex{},
+		wmu:    &sync.Mutex{},
+		clock:  clock,
+	}, clock, counter
+}
+
+func testRecord() *Record {
+	return &Record{DataType: 1000, Data: &Payload{Fields: map[string]string{"exe": "/bin/sh"}}}
+}
+
+// send returns the frame size, the timestamp is stamped by SendRecord
+func send(t *testing.T, c *Client) int {
+	rec := testRecord()
+	if err := c.SendRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	return PrefixSize + rec.Size()
+}
+
+func TestSchemaVersion(t *testing.T) {
+	c, _, _ := newTestClient(nil)
+	var sent []*Record
+	c.hook = func(rec *Record) error {
+		sent = append(sent, rec)
+		return nil
+	}
+	c.SendRecord(TaskResultRecord(&Task{Token: "t"}, "", nil))
+	c.SendRecord(&Record{DataType: config.DTPluginTaskResult, SchemaVersion: 2})
+	c.SendRecord(testRecord())
+	if sent[0].SchemaVersion != 1 || sent[1].SchemaVersion != 2 || sent[2].SchemaVersion != 0 {
+		t.Fatalf("unexpected schema versions: %d, %d, %d", sent[0].SchemaVersion, sent[1].SchemaVersion, sent[2].SchemaVersion)
+	}
+}
+
+func TestCoalesceBytes(t *testing.T) {
+	c, _, counter := newTestClient(nil)
+	size := send(t, c)
+	c.Flush()
+	c.SetCoalesce(0, 3*size)
+	send(t, c)
+	send(t, c)
+	if writes, _ := counter.count(); writes != 1 {
+		t.Fatalf("flushed before the byte threshold: %d", writes)
+	}
+	send(t, c)
+	if writes, bytes := counter.count(); writes != 2 || bytes != 4*size {
+		t.Fatalf("unexpected writes at the byte threshold: %d, %d bytes", writes, bytes)
+	}
+}
+
+func TestCoalesceDelay(t *testing.T) {
+	c, clock, counter := newTestClient(nil)
+	c.SetCoalesce(time.Hour, 0)
+	size := send(t, c)
+	clock.Add(30 * time.Minute)
+	size += send(t, c)
+	if writes, _ := counter.count(); writes != 0 {
+		t.Fatalf("flushed before the delay: %d", writes)
+	}
+	clock.Add(30 * time.Minute)
+	size += send(t, c)
+	if writes, bytes := counter.count(); writes != 1 || bytes != size {
+		t.Fatalf("unexpected writes after the delay: %d, %d bytes", writes, bytes)
+	}
+	// the timer flushes if no more record comes
+	c.SetCoalesce(20*time.Millisecond, 0)
+	send(t, c)
+	deadline := time.Now().Add(time.Second)
+	for writes, _ := counter.count(); writes != 2; writes, _ = counter.count() {
+		if time.Now().After(deadline) {
+			t.Fatal("pending record is not flushed by the timer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesceFlushClose(t *testing.T) {
+	c, _, counter := newTestClient(nil)
+	c.SetCoalesce(time.Hour, 1<<20)
+	send(t, c)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if writes, _ := counter.count(); writes != 1 {
+		t.Fatalf("explicit flush is not immediate: %d", writes)
+	}
+	send(t, c)
+	c.Close()
+	if writes, _ := counter.count(); writes != 2 {
+		t.Fatalf("close does not flush: %d", writes)
+	}
+}
+
+func benchmarkCoalesce(b *testing.B, delay time.Duration, bytes int) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	go io.Copy(io.Discard, r)
+	c, _, counter := newTestClient(w)
+	c.SetCoalesce(delay, bytes)
+	rec := testRecord()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = c.SendRecord(rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+	c.Flush()
+	b.StopTimer()
+	writes, _ := counter.count()
+	b.ReportMetric(float64(writes)/float64(b.N), "writes/record")
+	w.Close()
+}
+
+func BenchmarkCoalesce(b *testing.B) {
+	b.Run("every-record", func(b *testing.B) {
+		benchmarkCoalesce(b, 0, 1)
+	})
+	b.Run("bytes-64k", func(b *testing.B) {
+		benchmarkCoalesce(b, 0, 64*1024)
+	})
+	b.Run("delay-10ms", func(b *testing.B) {
+		benchmarkCoalesce(b, 10*time.Millisecond, 64*1024)
+	})
+}
+
+func TestFramingV2(t *testing.T) {
+	var out bytes.Buffer
+	c, _, _ := newTestClient(&out)
+	os.Setenv(config.FramingEnv, "2")
+	defer os.Unsetenv(config.FramingEnv)
+	c.negotiateFraming()
+	send(t, c)
+	c.Flush()
+	r := bufio.NewReader(&out)
+	if payload, err := framing.ReadFrame(r, 0, framing.V2); err != nil || len(payload) != 0 {
+		t.Fatalf("unexpected first frame: %q, %v", payload, err)
+	}
+	payload, err := framing.ReadFrame(r, 0, framing.V2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &Record{}
+	if err = rec.Unmarshal(payload); err != nil || rec.DataType != 1000 {
+		t.Fatalf("unexpected record: %v, %v", rec, err)
+	}
+}
+
+func TestReadTaskV2(t *testing.T) {
+	var stream []byte
+	task := func(token string, opts *framing.Options) []byte {
+		frame, _ := framing.Encode(&Task{Token: token}, opts)
+		return frame
+	}
+	corrupted := task("corrupted", framing.V2)
+	corrupted[len(corrupted)-1] ^= 0xff
+	// plain tasks before the agent switches, and then V2 ones with garbage
+	stream = append(stream, task("plain", nil)...)
+	stream = append(stream, task("first", framing.V2)...)
+	stream = append(stream, "garbage"...)
+	stream = append(stream, corrupted...)
+	stream = append(stream, task("last", framing.V2)...)
+	c, _, _ := newTestClient(nil)
+	c.reader = bufio.NewReader(bytes.NewReader(stream))
+	for _, token := range []string{"plain", "first", "last"} {
+		task, err := c.ReceiveTask()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Token != token {
+			t.Fatalf("unexpected task %s, expect %s", task.Token, token)
+		}
+	}
+	if _, err := c.ReceiveTask(); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+	if n := c.CorruptedTasks(); n != 2 {
+		t.Fatalf("unexpected corrupted tasks: %d", n)
+	}
+}
@@ -4,21 +4,48 @@ package transport
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"sync"
 	"time"
+
+	"github.com/chriskaliX/SDK/clock"
+	"github.com/chriskaliX/SDK/config"
 )
 
-func New() (c *Client) {
+// New connects to the named pipes created by the agent, the names are
+// passed in env since handles are not inherited as fd 3 and 4 on Windows.
+// Without them, tasks are read from stdin and records are written to stdout.
+func New(clock clock.IClock) (c *Client) {
+	// the pipes are closed by Close, as stdin and stdout without them
+	var (
+		rpipe *os.File
+		rx    io.ReadCloser  = os.Stdin
+		tx    io.WriteCloser = os.Stdout
+	)
+	if name, ok := os.LookupEnv(config.TaskPipeEnv); ok {
+		if f, err := os.OpenFile(name, os.O_RDONLY, 0); err == nil {
+			rpipe, rx = f, f
+		}
+	}
+	if name, ok := os.LookupEnv(config.RecordPipeEnv); ok {
+		if f, err := os.OpenFile(name, os.O_WRONLY, 0); err == nil {
+			tx = f
+		}
+	}
 	c = &Client{
-		rx: os.Stdin,
-		tx: os.Stdout,
+		rx: rx,
+		tx: tx,
 		// MAX_SIZE = 1 MB
-		reader: bufio.NewReaderSize(os.Stdin, 1024*1024),
-		writer: bufio.NewWriterSize(os.Stdout, 512*1024),
+		reader: bufio.NewReaderSize(rx, 1024*1024),
+		rpipe:  rpipe,
+		writer: bufio.NewWriterSize(tx, 512*1024),
 		rmu:    &sync.Mutex{},
 		wmu:    &sync.Mutex{},
+		clock:  clock,
 	}
+	c.negotiateFraming()
+	c.negotiateChunking()
 	go func() {
 		ticker := time.NewTicker(time.Millisecond * 200)
 		defer ticker.Stop()
@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// ClockRecord is the reply of TaskClockSync. The time of agent is echoed
+// back, so the agent measures the round trip and the offset of plugin clock.
+func ClockRecord(task *Task, now time.Time) *Record {
+	return &Record{
+		DataType: config.DTPluginClock,
+		Data: &Payload{
+			Fields: map[string]string{
+				"agent_ts":  task.GetData(),
+				"plugin_ts": strconv.FormatInt(now.UnixNano(), 10),
+			},
+		},
+	}
+}
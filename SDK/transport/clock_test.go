@@ -0,0 +1,23 @@
+package transport
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestClockRecord(t *testing.T) {
+	now := time.Unix(100, 5)
+	rec := ClockRecord(&Task{DataType: config.TaskClockSync, Data: "42"}, now)
+	if rec.DataType != config.DTPluginClock {
+		t.Fatalf("unexpected data type: %d", rec.DataType)
+	}
+	if rec.Data.Fields["agent_ts"] != "42" {
+		t.Fatalf("agent time is not echoed: %v", rec.Data.Fields)
+	}
+	if rec.Data.Fields["plugin_ts"] != strconv.FormatInt(now.UnixNano(), 10) {
+		t.Fatalf("unexpected plugin time: %v", rec.Data.Fields)
+	}
+}
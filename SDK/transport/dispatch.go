@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// TaskHandler handles the task within the context, which is cancelled once
+// the timeout of the handler is exceeded. The output and the error are
+// reported to the agent as the task result.
+type TaskHandler func(ctx context.Context, task *Task) (output string, err error)
+
+// DefaultTaskTimeout bounds the handlers registered without a timeout
+const DefaultTaskTimeout = time.Minute
+
+var (
+	ErrTaskTimeout   = errors.New("task timed out")
+	ErrTaskCancelled = errors.New("task cancelled")
+	// the task to cancel is done or never received
+	ErrTaskNotRunning = errors.New("task is not running")
+)
+
+type taskHandler struct {
+	handle  TaskHandler
+	timeout time.Duration
+}
+
+// runningTask is a task with a token in the handler, which is cancelled by
+// TaskCancel
+type runningTask struct {
+	cancel    context.CancelFunc
+	cancelled int32
+}
+
+// dispatcher holds the handlers by the data type of tasks
+type dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[int32]taskHandler
+	// by the token, guarded by mu
+	running map[string]*runningTask
+	wg      sync.WaitGroup
+}
+
+func (d *dispatcher) track(token string, r *runningTask) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running == nil {
+		d.running = make(map[string]*runningTask)
+	}
+	d.running[token] = r
+}
+
+// untrack leaves the task of the same token dispatched later
+func (d *dispatcher) untrack(token string, r *runningTask) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running[token] == r {
+		delete(d.running, token)
+	}
+}
+
+// OnTask registers the handler of tasks in the data type, which replaces the
+// one registered before. It's bounded by DefaultTaskTimeout.
+func (c *Client) OnTask(dataType int32, handler TaskHandler) {
+	c.OnTaskTimeout(dataType, DefaultTaskTimeout, handler)
+}
+
+// OnTaskTimeout registers the handler bounded by the timeout, a zero timeout
+// leaves it unbounded
+func (c *Client) OnTaskTimeout(dataType int32, timeout time.Duration, handler TaskHandler) {
+	c.tasks.mu.Lock()
+	defer c.tasks.mu.Unlock()
+	if c.tasks.handlers == nil {
+		c.tasks.handlers = make(map[int32]taskHandler)
+	}
+	c.tasks.handlers[dataType] = taskHandler{handle: handler, timeout: timeout}
+}
+
+// Dispatch runs the handler of the task in background, and reports whether
+// there is one. The result is sent once the handler returns, panics, times
+// out or is cancelled by CancelTask.
+func (c *Client) Dispatch(ctx context.Context, task *Task) bool {
+	c.tasks.mu.RLock()
+	h, ok := c.tasks.handlers[task.GetDataType()]
+	c.tasks.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &runningTask{cancel: cancel}
+	token := task.GetToken()
+	if token != "" {
+		c.tasks.track(token, r)
+	}
+	c.tasks.wg.Add(1)
+	go func() {
+		defer c.tasks.wg.Done()
+		defer cancel()
+		output, err := h.run(ctx, task)
+		if token != "" {
+			c.tasks.untrack(token, r)
+		}
+		// the handler done in time anyway is not cancelled
+		if err != nil && atomic.LoadInt32(&r.cancelled) == 1 {
+			err = ErrTaskCancelled
+		}
+		c.SendTaskResult(task, output, err)
+	}()
+	return true
+}
+
+// CancelTask cancels the context of the handler running the task of the
+// token, and reports whether there is one. The task is reported cancelled
+// unless the handler returns without an error.
+func (c *Client) CancelTask(token string) bool {
+	c.tasks.mu.RLock()
+	r, ok := c.tasks.running[token]
+	c.tasks.mu.RUnlock()
+	if !ok || token == "" {
+		return false
+	}
+	atomic.StoreInt32(&r.cancelled, 1)
+	r.cancel()
+	return true
+}
+
+// run waits for the handler until the timeout. A handler which ignores the
+// context is left behind, its result is dropped.
+func (h taskHandler) run(ctx context.Context, task *Task) (output string, err error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			if p := recover(); p != nil {
+				r.err = fmt.Errorf("task %d panicked: %v\n%s", task.GetDataType(), p, debug.Stack())
+			}
+			done <- r
+		}()
+		r.output, r.err = h.handle(ctx, task)
+	}()
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", ErrTaskTimeout
+		}
+		return "", ctx.Err()
+	}
+}
+
+// RunTasks reads the tasks and dispatches them until the context is done or
+// the read fails. TaskClockSync is replied directly, TaskCancel cancels the
+// task of the token in its data, and the tasks without a handler are
+// reported as failed. The handlers running are waited for
+// before it returns.
+func (c *Client) RunTasks(ctx context.Context) (err error) {
+	defer c.tasks.wg.Wait()
+	for ctx.Err() == nil {
+		var task *Task
+		task, err = c.ReceiveTask()
+		// read timeout, check the context and read again
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if task.DataType == config.TaskClockSync {
+			c.SendRecord(ClockRecord(task, c.clock.Now()))
+			continue
+		}
+		if task.DataType == config.TaskCancel {
+			var err error
+			if !c.CancelTask(task.Data) {
+				err = ErrTaskNotRunning
+			}
+			c.SendTaskResult(task, "", err)
+			continue
+		}
+		if !c.Dispatch(ctx, task) {
+			c.SendTaskResult(task, "", fmt.Errorf("task %d is not supported", task.DataType))
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestRunTasks(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent = make(map[string]*Record)
+	)
+	c, _, _ := newTestClient(io.Discard)
+	c.SetSendHook(func(rec *Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[rec.Data.Fields["token"]] = rec
+		return nil
+	})
+	c.OnTask(1000, func(ctx context.Context, task *Task) (string, error) {
+		return "echo " + task.Data, nil
+	})
+	c.OnTask(1001, func(ctx context.Context, task *Task) (string, error) {
+		panic("boom")
+	})
+	c.OnTaskTimeout(1002, 10*time.Millisecond, func(ctx context.Context, task *Task) (string, error) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return "late", nil
+	})
+	var buf bytes.Buffer
+	for _, task := range []*Task{
+		{DataType: 1000, Data: "hello", Token: "ok"},
+		{DataType: 1001, Token: "panic"},
+		{DataType: 1002, Token: "timeout"},
+		{DataType: 1003, Token: "unsupported"},
+		{DataType: config.TaskClockSync, Data: "1"},
+	} {
+		frame, err := EncodeTask(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(frame)
+	}
+	c.reader = bufio.NewReader(&buf)
+	// the tasks are drained, and the read ends with EOF
+	if err := c.RunTasks(context.Background()); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fields := func(token string) map[string]string {
+		rec, ok := sent[token]
+		if !ok {
+			t.Fatalf("result of %s is not sent", token)
+		}
+		return rec.Data.Fields
+	}
+	if f := fields("ok"); f["status"] != config.TaskStatusSucceeded || f["output"] != "echo hello" {
+		t.Errorf("unexpected result: %v", f)
+	}
+	if f := fields("panic"); f["status"] != config.TaskStatusFailed || !strings.Contains(f["error"], "boom") {
+		t.Errorf("unexpected result: %v", f)
+	}
+	if f := fields("timeout"); f["status"] != config.TaskStatusFailed || f["error"] != ErrTaskTimeout.Error() {
+		t.Errorf("unexpected result: %v", f)
+	}
+	if f := fields("unsupported"); f["status"] != config.TaskStatusFailed {
+		t.Errorf("unexpected result: %v", f)
+	}
+	if rec, ok := sent[""]; !ok || rec.DataType != config.DTPluginClock {
+		t.Error("clock is not replied")
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent = make(map[string]*Record)
+	)
+	c, _, _ := newTestClient(io.Discard)
+	c.SetSendHook(func(rec *Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[rec.Data.Fields["token"]] = rec
+		return nil
+	})
+	started := make(chan struct{})
+	c.OnTaskTimeout(1000, 0, func(ctx context.Context, task *Task) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	if !c.Dispatch(context.Background(), &Task{DataType: 1000, Token: "scan"}) {
+		t.Fatal("task is not dispatched")
+	}
+	<-started
+	// the cancel task is replied as well
+	var buf bytes.Buffer
+	for _, task := range []*Task{
+		{DataType: config.TaskCancel, Data: "scan", Token: "cancel-scan"},
+		{DataType: config.TaskCancel, Data: "missing", Token: "cancel-missing"},
+	} {
+		frame, err := EncodeTask(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(frame)
+	}
+	c.reader = bufio.NewReader(&buf)
+	if err := c.RunTasks(context.Background()); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for token, status := range map[string]string{
+		"scan":           config.TaskStatusCancelled,
+		"cancel-scan":    config.TaskStatusSucceeded,
+		"cancel-missing": config.TaskStatusFailed,
+	} {
+		rec, ok := sent[token]
+		if !ok || rec.Data.Fields["status"] != status {
+			t.Errorf("unexpected result of %s: %v", token, rec)
+		}
+	}
+	if c.CancelTask("scan") {
+		t.Error("task done is still tracked")
+	}
+}
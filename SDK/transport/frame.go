@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// ByteOrder of the length prefix, shared by agent and plugins
+var ByteOrder = framing.ByteOrder
+
+// PrefixSize is the size of the length prefix in every frame
+const PrefixSize = framing.PrefixSize
+
+// maxTaskSize bounds the task frame, which used to be limited by the size
+// of the read buffer
+const maxTaskSize = 1024 * 1024
+
+var ErrFrameTooLarge = framing.ErrFrameTooLarge
+
+// Marshaler is implemented by the gogo generated messages, both in SDK
+// and the agent
+type Marshaler = framing.Marshaler
+
+// Encode returns the complete frame of the message, which is a uint32
+// length prefix followed by the marshaled bytes.
+func Encode(m Marshaler) ([]byte, error) { return framing.Encode(m, nil) }
+
+func EncodeTask(t *Task) ([]byte, error) { return Encode(t) }
+
+func EncodeRecord(rec *Record) ([]byte, error) { return Encode(rec) }
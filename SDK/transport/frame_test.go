@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeEmptyTask(t *testing.T) {
+	buf, err := EncodeTask(&Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte{0, 0, 0, 0}) {
+		t.Fatalf("unexpected frame of empty task: %v", buf)
+	}
+}
+
+func TestEncodeTask(t *testing.T) {
+	// around the boundaries of varint length of the data field
+	for _, size := range []int{0, 1, 127, 128, 16383, 16384, 1 << 20} {
+		task := &Task{DataType: 1, ObjectName: "test", Data: strings.Repeat("a", size)}
+		buf, err := EncodeTask(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) != PrefixSize+task.Size() {
+			t.Fatalf("size %d: frame length %d, expect %d", size, len(buf), PrefixSize+task.Size())
+		}
+		if l := ByteOrder.Uint32(buf[:PrefixSize]); int(l) != task.Size() {
+			t.Fatalf("size %d: length prefix %d, expect %d", size, l, task.Size())
+		}
+		decoded := &Task{}
+		if err = decoded.Unmarshal(buf[PrefixSize:]); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Data != task.Data || decoded.ObjectName != task.ObjectName || decoded.DataType != task.DataType {
+			t.Fatalf("size %d: task mismatch after decoding", size)
+		}
+	}
+}
+
+func TestEncodeRecord(t *testing.T) {
+	rec := &Record{DataType: 1000, Timestamp: 1, Data: &Payload{Fields: map[string]string{"k": "v"}}}
+	buf, err := EncodeRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled, _ := rec.Marshal()
+	if !bytes.Equal(buf[PrefixSize:], marshaled) || int(ByteOrder.Uint32(buf)) != len(marshaled) {
+		t.Fatal("record frame mismatch")
+	}
+}
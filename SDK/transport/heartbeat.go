@@ -0,0 +1,12 @@
+package transport
+
+import (
+	"github.com/chriskaliX/SDK/config"
+)
+
+// HeartbeatRecord tells the agent the plugin is alive. It must be sent
+// within the heartbeat_timeout of the plugin, or the plugin is killed and
+// restarted even if the process is still running.
+func HeartbeatRecord() *Record {
+	return &Record{DataType: config.DTPluginHeartbeat}
+}
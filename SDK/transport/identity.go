@@ -0,0 +1,27 @@
+package transport
+
+import (
+	"os"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// AgentID returns the id of the agent which starts the plugin, passed by
+// config.AgentIDEnv, or config.ElkeidAgentIDEnv by the agent of Elkeid. It's
+// empty if the plugin is started by hand.
+func AgentID() string {
+	if id, ok := os.LookupEnv(config.AgentIDEnv); ok {
+		return id
+	}
+	return os.Getenv(config.ElkeidAgentIDEnv)
+}
+
+// underElkeid reports whether the plugin is started by the agent of Elkeid.
+// The env of Hades wins over the one of Elkeid, which may be inherited.
+func underElkeid() bool {
+	if _, ok := os.LookupEnv(config.AgentIDEnv); ok {
+		return false
+	}
+	_, ok := os.LookupEnv(config.ElkeidAgentIDEnv)
+	return ok
+}
@@ -0,0 +1,19 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestAgentID(t *testing.T) {
+	t.Setenv(config.ElkeidAgentIDEnv, "elkeid")
+	if AgentID() != "elkeid" || !underElkeid() {
+		t.Fatalf("unexpected id of elkeid: %s", AgentID())
+	}
+	// the env of hades wins over the inherited one
+	t.Setenv(config.AgentIDEnv, "hades")
+	if AgentID() != "hades" || underElkeid() {
+		t.Fatalf("unexpected id of hades: %s", AgentID())
+	}
+}
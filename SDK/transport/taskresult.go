@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"errors"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// TaskResultRecord reports the outcome of the task, err is nil on success,
+// and ErrTaskCancelled once it's cancelled. The agent forwards it to the
+// server, correlated by the token of the task.
+func TaskResultRecord(task *Task, output string, err error) *Record {
+	fields := map[string]string{
+		"token":  task.GetToken(),
+		"status": config.TaskStatusSucceeded,
+		"output": output,
+	}
+	if err != nil {
+		fields["status"] = config.TaskStatusFailed
+		fields["error"] = err.Error()
+	}
+	if errors.Is(err, ErrTaskCancelled) {
+		fields["status"] = config.TaskStatusCancelled
+	}
+	return &Record{
+		DataType: config.DTPluginTaskResult,
+		Data:     &Payload{Fields: fields},
+	}
+}
+
+// SendTaskResult reports the outcome of the task received by ReceiveTask.
+// Tasks without a token are not tracked by the server, nothing is sent.
+func (c *Client) SendTaskResult(task *Task, output string, err error) error {
+	if task.GetToken() == "" {
+		return nil
+	}
+	return c.SendRecord(TaskResultRecord(task, output, err))
+}
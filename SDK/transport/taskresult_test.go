@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestTaskResult(t *testing.T) {
+	task := &Task{DataType: 1000, Token: "t1"}
+	rec := TaskResultRecord(task, "done", nil)
+	if rec.DataType != config.DTPluginTaskResult {
+		t.Fatalf("unexpected data type: %d", rec.DataType)
+	}
+	fields := rec.Data.Fields
+	if fields["token"] != "t1" || fields["status"] != config.TaskStatusSucceeded || fields["output"] != "done" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+	if _, ok := fields["error"]; ok {
+		t.Fatal("error is set on success")
+	}
+	fields = TaskResultRecord(task, "", errors.New("no such file")).Data.Fields
+	if fields["status"] != config.TaskStatusFailed || fields["error"] != "no such file" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
+
+func TestSendTaskResult(t *testing.T) {
+	var sent []*Record
+	c, _, _ := newTestClient(io.Discard)
+	c.SetSendHook(func(rec *Record) error {
+		sent = append(sent, rec)
+		return nil
+	})
+	// untracked task, nothing is sent
+	if err := c.SendTaskResult(&Task{DataType: 1000}, "done", nil); err != nil || len(sent) != 0 {
+		t.Fatalf("unexpected send: %v, %v", sent, err)
+	}
+	if err := c.SendTaskResult(&Task{DataType: 1000, Token: "t1"}, "done", nil); err != nil || len(sent) != 1 {
+		t.Fatalf("unexpected send: %v, %v", sent, err)
+	}
+}
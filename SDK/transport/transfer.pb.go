@@ -26,6 +26,8 @@ type Record struct {
 	DataType  int32    `protobuf:"varint,1,opt,name=data_type,json=dataType,proto3" json:"data_type,omitempty"`
 	Timestamp int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	Data      *Payload `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// version of the schema of the data type, 0 if it's unversioned
+	SchemaVersion int32 `protobuf:"varint,8,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
 }
 
 func (m *Record) Reset()         { *m = Record{} }
@@ -82,6 +84,13 @@ func (m *Record) GetData() *Payload {
 	return nil
 }
 
+func (m *Record) GetSchemaVersion() int32 {
+	if m != nil {
+		return m.SchemaVersion
+	}
+	return 0
+}
+
 type Payload struct {
 	Fields map[string]string `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
@@ -204,26 +213,27 @@ func init() {
 func init() { proto.RegisterFile("transfer.proto", fileDescriptor_96c3e6bcafb460d3) }
 
 var fileDescriptor_96c3e6bcafb460d3 = []byte{
-	// 298 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x91, 0x4f, 0x4b, 0xf3, 0x40,
-	0x10, 0xc6, 0xbb, 0x4d, 0x9b, 0xf7, 0xdd, 0x09, 0x88, 0x2c, 0x1e, 0x82, 0xca, 0x1a, 0x22, 0x48,
-	0x4e, 0x39, 0x54, 0x10, 0xf5, 0x28, 0xe8, 0x51, 0x64, 0xe9, 0xc9, 0x4b, 0xd9, 0x36, 0x53, 0xa8,
-	0xf9, 0xb3, 0x61, 0xb3, 0x0a, 0x01, 0x3f, 0x84, 0x1f, 0xcb, 0x63, 0x8f, 0x1e, 0x25, 0xf9, 0x22,
-	0x92, 0x4d, 0xb5, 0x05, 0xc1, 0xdb, 0x3e, 0xbf, 0x7d, 0x76, 0x66, 0x9e, 0x1d, 0xd8, 0x33, 0x5a,
-	0x16, 0xd5, 0x12, 0x75, 0x5c, 0x6a, 0x65, 0x14, 0xa3, 0x56, 0x97, 0x4a, 0x9b, 0x30, 0x05, 0x57,
-	0xe0, 0x42, 0xe9, 0x84, 0x1d, 0x01, 0x4d, 0xa4, 0x91, 0x33, 0x53, 0x97, 0xe8, 0x93, 0x80, 0x44,
-	0x63, 0xf1, 0xbf, 0x03, 0xd3, 0xba, 0x44, 0x76, 0x0c, 0xd4, 0xac, 0x72, 0xac, 0x8c, 0xcc, 0x4b,
-	0x7f, 0x18, 0x90, 0xc8, 0x11, 0x5b, 0xc0, 0xce, 0x60, 0xd4, 0x39, 0x7d, 0x27, 0x20, 0x91, 0x37,
-	0x61, 0xf1, 0x4f, 0xf9, 0xf8, 0x41, 0xd6, 0x99, 0x92, 0x89, 0xb0, 0xf7, 0xe1, 0x2b, 0xfc, 0xdb,
-	0x00, 0x76, 0x01, 0xee, 0x72, 0x85, 0x59, 0x52, 0xf9, 0x24, 0x70, 0x22, 0x6f, 0xc2, 0x7f, 0x3f,
-	0x8a, 0xef, 0xac, 0xe1, 0xb6, 0x30, 0xba, 0x16, 0x1b, 0xf7, 0xe1, 0x15, 0x78, 0x3b, 0x98, 0xed,
-	0x83, 0x93, 0x62, 0x6d, 0xc7, 0xa5, 0xa2, 0x3b, 0xb2, 0x03, 0x18, 0xbf, 0xc8, 0xec, 0x19, 0xed,
-	0x94, 0x54, 0xf4, 0xe2, 0x7a, 0x78, 0x49, 0xc2, 0x02, 0x46, 0x53, 0x59, 0xa5, 0x7f, 0x07, 0x3d,
-	0x01, 0x4f, 0xcd, 0x9f, 0x70, 0x61, 0x66, 0x85, 0xcc, 0xbf, 0x8b, 0x40, 0x8f, 0xee, 0x65, 0x8e,
-	0x8c, 0xed, 0x64, 0xa5, 0x7d, 0xae, 0xae, 0xa7, 0x51, 0x29, 0x16, 0xfe, 0xa8, 0xef, 0x69, 0xc5,
-	0xcd, 0xe9, 0x7b, 0xc3, 0xc9, 0xba, 0xe1, 0xe4, 0xb3, 0xe1, 0xe4, 0xad, 0xe5, 0x83, 0x75, 0xcb,
-	0x07, 0x1f, 0x2d, 0x1f, 0x3c, 0x6e, 0xff, 0x7f, 0xee, 0xda, 0x8d, 0x9c, 0x7f, 0x05, 0x00, 0x00,
-	0xff, 0xff, 0x58, 0x90, 0x4b, 0x61, 0xa3, 0x01, 0x00, 0x00,
+	// 319 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x91, 0x41, 0x4b, 0xc3, 0x40,
+	0x10, 0x85, 0xbb, 0x4d, 0x5b, 0x9b, 0x09, 0x16, 0x59, 0x7a, 0x08, 0x2a, 0x6b, 0xa8, 0x28, 0x39,
+	0xe5, 0x50, 0x41, 0xd4, 0xa3, 0xa0, 0x47, 0x91, 0xa5, 0x78, 0xf0, 0x52, 0xb6, 0xcd, 0x14, 0x6b,
+	0x9b, 0xdd, 0xb0, 0xbb, 0x16, 0x02, 0xfe, 0x08, 0xf1, 0x57, 0x79, 0xec, 0xd1, 0xa3, 0xb4, 0x7f,
+	0x44, 0xba, 0xa9, 0xb6, 0x20, 0x78, 0xcb, 0xfb, 0xf2, 0xf6, 0x0d, 0x6f, 0x06, 0x5a, 0x56, 0x0b,
+	0x69, 0x46, 0xa8, 0x93, 0x5c, 0x2b, 0xab, 0xa8, 0xef, 0x74, 0xae, 0xb4, 0xed, 0xbc, 0x13, 0x68,
+	0x70, 0x1c, 0x2a, 0x9d, 0xd2, 0x03, 0xf0, 0x53, 0x61, 0x45, 0xdf, 0x16, 0x39, 0x86, 0x24, 0x22,
+	0x71, 0x9d, 0x37, 0x57, 0xa0, 0x57, 0xe4, 0x48, 0x0f, 0xc1, 0xb7, 0xe3, 0x0c, 0x8d, 0x15, 0x59,
+	0x1e, 0x56, 0x23, 0x12, 0x7b, 0x7c, 0x03, 0xe8, 0x29, 0xd4, 0x56, 0xce, 0xd0, 0x8b, 0x48, 0x1c,
+	0x74, 0x69, 0xf2, 0x9b, 0x9f, 0xdc, 0x8b, 0x62, 0xaa, 0x44, 0xca, 0xdd, 0x7f, 0x7a, 0x02, 0x2d,
+	0x33, 0x7c, 0xc2, 0x4c, 0xf4, 0x67, 0xa8, 0xcd, 0x58, 0xc9, 0xb0, 0xe9, 0xe6, 0xec, 0x96, 0xf4,
+	0xa1, 0x84, 0x9d, 0x57, 0xd8, 0x59, 0xbf, 0xa3, 0xe7, 0xd0, 0x18, 0x8d, 0x71, 0x9a, 0x9a, 0x90,
+	0x44, 0x5e, 0x1c, 0x74, 0xd9, 0xdf, 0xec, 0xe4, 0xd6, 0x19, 0x6e, 0xa4, 0xd5, 0x05, 0x5f, 0xbb,
+	0xf7, 0x2f, 0x21, 0xd8, 0xc2, 0x74, 0x0f, 0xbc, 0x09, 0x16, 0xae, 0x95, 0xcf, 0x57, 0x9f, 0xb4,
+	0x0d, 0xf5, 0x99, 0x98, 0xbe, 0xa0, 0x2b, 0xe3, 0xf3, 0x52, 0x5c, 0x55, 0x2f, 0x48, 0x47, 0x42,
+	0xad, 0x27, 0xcc, 0xe4, 0xff, 0x7d, 0x1c, 0x41, 0xa0, 0x06, 0xcf, 0x38, 0xb4, 0x7d, 0x29, 0xb2,
+	0x9f, 0x10, 0x28, 0xd1, 0x9d, 0xc8, 0x90, 0xd2, 0xad, 0x95, 0xf8, 0xeb, 0xfa, 0x6d, 0xa8, 0x5b,
+	0x35, 0x41, 0x19, 0xd6, 0xca, 0x99, 0x4e, 0x5c, 0x1f, 0x7f, 0x2c, 0x18, 0x99, 0x2f, 0x18, 0xf9,
+	0x5a, 0x30, 0xf2, 0xb6, 0x64, 0x95, 0xf9, 0x92, 0x55, 0x3e, 0x97, 0xac, 0xf2, 0xb8, 0xb9, 0xd3,
+	0xa0, 0xe1, 0x2e, 0x77, 0xf6, 0x3d, 0x00, 0x8d, 0xad, 0xfe, 0xc0, 0xcb, 0x01, 0x00, 0x00,
 }
 
 func (m *Record) Marshal() (dAtA []byte, err error) {
@@ -246,6 +256,11 @@ func (m *Record) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SchemaVersion != 0 {
+		i = encodeVarintTransfer(dAtA, i, uint64(m.SchemaVersion))
+		i--
+		dAtA[i] = 0x40
+	}
 	if m.Data != nil {
 		{
 			size, err := m.Data.MarshalToSizedBuffer(dAtA[:i])
@@ -389,6 +404,9 @@ func (m *Record) Size() (n int) {
 		l = m.Data.Size()
 		n += 1 + l + sovTransfer(uint64(l))
 	}
+	if m.SchemaVersion != 0 {
+		n += 1 + sovTransfer(uint64(m.SchemaVersion))
+	}
 	return n
 }
 
@@ -542,6 +560,25 @@ func (m *Record) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SchemaVersion", wireType)
+			}
+			m.SchemaVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SchemaVersion |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTransfer(dAtA[iNdEx:])
@@ -3,12 +3,10 @@ package hash
 import (
 	"crypto/md5"
 	"encoding/hex"
-	"fmt"
 	"hash"
 	"io"
 	"os"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/chriskaliX/SDK/clock"
@@ -44,6 +42,13 @@ type fileHash struct {
 	hash  string
 }
 
+// fileStat is what tells the file is changed, by statFile of the platform
+type fileStat struct {
+	inode uint64
+	mtime int64
+	size  int64
+}
+
 func NewWithClock(c clock.IClock) *HashCache {
 	return &HashCache{
 		cache: lru.New(hashCacheSize),
@@ -87,39 +92,23 @@ func (h *HashCache) getHash(path string, f *fileHash) string {
 		return config.FieldOverrate
 	}
 
-	var (
-		stat *syscall.Stat_t
-		err  error
-	)
-	if stat, err = h.getStat(path); err != nil {
+	stat, err := statFile(path)
+	if err != nil {
 		f.hash = config.FieldInvalid
 		return f.hash
 	}
-	if stat.Size > maxFileSize {
+	if stat.size > maxFileSize {
 		f.hash = config.FieldOversize
 		return f.hash
 	}
 	if f.check(stat) {
-		f.hash = h.genHash(path, stat.Size)
+		f.hash = h.genHash(path, stat.size)
 		f.update(stat)
 		return f.hash
 	}
 	return f.hash
 }
 
-func (h *HashCache) getStat(path string) (*syscall.Stat_t, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, err
-	}
-	stat, ok := info.Sys().(*syscall.Stat_t)
-	if !ok {
-		err = fmt.Errorf("%s not Stat_t", path)
-		return nil, err
-	}
-	return stat, nil
-}
-
 func (h *HashCache) genHash(path string, size int64) (result string) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -139,12 +128,12 @@ func (h *HashCache) genHash(path string, size int64) (result string) {
 	return
 }
 
-func (f *fileHash) check(stat *syscall.Stat_t) bool {
-	return f.inode != stat.Ino || f.mtime != stat.Mtim.Sec || f.size != stat.Size
+func (f *fileHash) check(stat fileStat) bool {
+	return f.inode != stat.inode || f.mtime != stat.mtime || f.size != stat.size
 }
 
-func (f *fileHash) update(stat *syscall.Stat_t) {
-	f.inode = stat.Ino
-	f.mtime = stat.Mtim.Sec
-	f.size = stat.Size
+func (f *fileHash) update(stat fileStat) {
+	f.inode = stat.inode
+	f.mtime = stat.mtime
+	f.size = stat.size
 }
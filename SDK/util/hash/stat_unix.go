@@ -0,0 +1,21 @@
+//go:build !windows
+
+package hash
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func statFile(path string) (fileStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, fmt.Errorf("%s not Stat_t", path)
+	}
+	return fileStat{inode: uint64(stat.Ino), mtime: info.ModTime().Unix(), size: info.Size()}, nil
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package hash
+
+import "os"
+
+// statFile tells the change by mtime and size only, there is no inode
+func statFile(path string) (fileStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{mtime: info.ModTime().Unix(), size: info.Size()}, nil
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// DefaultIDFile keeps the ID once it's resolved, relative to the workdir. The
+// ID is read from it from then on, so it's stable even if the sources change,
+// as the machine-id of a cloned image being regenerated.
+const DefaultIDFile = "agent_id"
+
+// Where the ID comes from, by priority
+const (
+	IDSourceEnv         = "env"
+	IDSourceFile        = "file"
+	IDSourceLegacy      = "legacy"
+	IDSourceMachineID   = "machine-id"
+	IDSourceProductUUID = "product-uuid"
+	IDSourceRandom      = "random"
+)
+
+// legacySources are hashed into the ID of the agents before the id file,
+// the ID of an upgraded agent is derived from them as before
+var legacySources = []string{
+	// instance-id of cloud-init, which may be "nocloud"
+	"/var/lib/cloud/data/instance-id",
+	"/sys/class/dmi/id/product_uuid",
+	"/sys/class/net/eth0/address",
+}
+
+// idSources are tried in order, once the env and the id file are not set
+var idSources = []struct {
+	source string
+	file   string
+}{
+	{IDSourceMachineID, "/etc/machine-id"},
+	{IDSourceMachineID, "/var/lib/dbus/machine-id"},
+	// @Reference here:
+	// https://stackoverflow.com/questions/35883313/dmidecode-product-uuid-and-product-serial-what-is-the-difference/35886893
+	{IDSourceProductUUID, "/sys/class/dmi/id/product_uuid"},
+}
+
+// resolveID returns the ID and where it comes from. The env overrides all,
+// the id file is the next, then the legacy one, so the ID is kept once the
+// agent is upgraded, and then the machine-id, the product uuid of dmi, or a
+// random one as the last resort.
+func resolveID(env, file string) (id, source string) {
+	if id, ok := os.LookupEnv(env); ok && id != "" {
+		return id, IDSourceEnv
+	}
+	if u, err := fromUUIDFile(file); err == nil {
+		return u.String(), IDSourceFile
+	}
+	if id, ok := legacyID(); ok {
+		return id, IDSourceLegacy
+	}
+	for _, s := range idSources {
+		if u, err := fromUUIDFile(s.file); err == nil {
+			return u.String(), s.source
+		}
+	}
+	return uuid.New().String(), IDSourceRandom
+}
+
+// legacyID is the SHA1 uuid of the legacy sources, as generateID of the
+// agents before the id file. It's not derived from less than 9 bytes, since
+// the instance-id may be "nocloud".
+func legacyID() (string, bool) {
+	var source []byte
+	for _, file := range legacySources {
+		if content, err := os.ReadFile(file); err == nil && len(content) >= 6 {
+			source = append(source, bytes.TrimSpace(content)...)
+		}
+	}
+	if len(source) <= 8 {
+		return "", false
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, source).String(), true
+}
+
+// fromUUIDFile accepts the uuid with or without dashes, as the machine-id,
+// and rejects the all zero one
+func fromUUIDFile(file string) (id uuid.UUID, err error) {
+	var content []byte
+	if content, err = os.ReadFile(file); err != nil {
+		return
+	}
+	if id, err = uuid.ParseBytes(bytes.TrimSpace(content)); err == nil && id == uuid.Nil {
+		err = errors.New("nil uuid")
+	}
+	return
+}
+
+// SetupID resolves the ID again with the id file, which is relative to the
+// workdir if it's not absolute, and keeps the one resolved in it. It's
+// called once the workdir is set.
+func (a *Agent) SetupID(file string) error {
+	if file == "" {
+		file = DefaultIDFile
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(a.Workdir, file)
+	}
+	a.ID, a.IDSource = resolveID(a.Env, file)
+	if a.IDSource == IDSourceEnv || a.IDSource == IDSourceFile {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(a.ID+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestResolveID(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, DefaultIDFile)
+	const env = "HADES_TEST_AGENT_ID"
+	// the id file is the first one without the env
+	if err := os.WriteFile(file, []byte("6ba7b810-9dad-11d1-80b4-00c04fd430c8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if id, source := resolveID(env, file); id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" || source != IDSourceFile {
+		t.Fatalf("unexpected id: %s from %s", id, source)
+	}
+	os.Setenv(env, "specified")
+	defer os.Unsetenv(env)
+	if id, source := resolveID(env, file); id != "specified" || source != IDSourceEnv {
+		t.Fatalf("unexpected id: %s from %s", id, source)
+	}
+	// the all zero one is invalid
+	if err := os.WriteFile(file, []byte("00000000000000000000000000000000"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fromUUIDFile(file); err == nil {
+		t.Fatal("nil uuid is accepted")
+	}
+}
+
+func TestLegacyID(t *testing.T) {
+	dir := t.TempDir()
+	sources := legacySources
+	t.Cleanup(func() { legacySources = sources })
+	legacySources = nil
+	// as generateID, in the order of the instance-id, product_uuid and mac
+	for i, content := range []string{"i-0123456789abcdef0\n", "ec2a1b2c-3d4e-5f60-7182-93a4b5c6d7e8\n", "02:42:ac:11:00:02\n"} {
+		file := filepath.Join(dir, strconv.Itoa(i))
+		os.WriteFile(file, []byte(content), 0o644)
+		legacySources = append(legacySources, file)
+	}
+	expect := uuid.NewSHA1(uuid.NameSpaceOID, []byte("i-0123456789abcdef0ec2a1b2c-3d4e-5f60-7182-93a4b5c6d7e802:42:ac:11:00:02")).String()
+	if id, source := resolveID("HADES_TEST_AGENT_ID", filepath.Join(dir, DefaultIDFile)); id != expect || source != IDSourceLegacy {
+		t.Fatalf("unexpected id: %s from %s", id, source)
+	}
+	// not derived from nocloud alone
+	os.WriteFile(legacySources[0], []byte("nocloud"), 0o644)
+	legacySources = legacySources[:1]
+	if _, ok := legacyID(); ok {
+		t.Fatal("id is derived from nocloud")
+	}
+}
+
+func TestSetupID(t *testing.T) {
+	a := &Agent{Workdir: t.TempDir(), Env: "HADES_TEST_AGENT_ID"}
+	if err := a.SetupID(""); err != nil {
+		t.Fatal(err)
+	}
+	if a.IDSource == IDSourceEnv || a.IDSource == IDSourceFile {
+		t.Fatalf("unexpected source: %s", a.IDSource)
+	}
+	content, err := os.ReadFile(filepath.Join(a.Workdir, DefaultIDFile))
+	if err != nil || strings.TrimSpace(string(content)) != a.ID {
+		t.Fatalf("id is not kept: %q, %v", content, err)
+	}
+	// the kept one is stable from then on
+	b := &Agent{Workdir: a.Workdir, Env: a.Env}
+	if err = b.SetupID(""); err != nil || b.ID != a.ID || b.IDSource != IDSourceFile {
+		t.Fatalf("unexpected id: %s from %s, %v", b.ID, b.IDSource, err)
+	}
+}
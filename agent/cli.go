@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"agent/control"
+	"agent/proto"
+)
+
+// commands of the agent binary, as hades-agent <command> [args]. The ones
+// but run talk to the running agent through the control socket.
+var commands = map[string]func(args []string) int{
+	"run":    runCommand,
+	"status": statusCommand,
+	"plugin": pluginCommand,
+	"task":   taskCommand,
+}
+
+const usageText = `Usage:
+  hades-agent [run] [flags]         run the agent
+  hades-agent status [flags]        show the status of the running agent
+  hades-agent plugin ls [flags]     list the plugins
+  hades-agent plugin restart NAME   restart the plugin
+  hades-agent task send -plugin NAME [-data-type N] [-token TOKEN] DATA
+                                    send the task to the plugin, DATA is read from stdin if it's -
+
+The commands but run accept -socket, -timeout and -json, see hades-agent <command> -h.
+
+Flags of run:
+`
+
+func usage() {
+	fmt.Fprint(flag.CommandLine.Output(), usageText)
+	flag.PrintDefaults()
+}
+
+func runCommand(args []string) int {
+	run(args)
+	return 0
+}
+
+// clientOptions are the flags shared by the commands talking to the agent
+type clientOptions struct {
+	socket  string
+	timeout time.Duration
+	json    bool
+}
+
+func newClientFlags(name, args string) (*flag.FlagSet, *clientOptions) {
+	opts := &clientOptions{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.socket, "socket", control.DefaultSocket, "control socket of the agent")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of the request")
+	fs.BoolVar(&opts.json, "json", false, "print the response in json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace("Usage: hades-agent "+name+" [flags] "+args))
+		fs.PrintDefaults()
+	}
+	return fs, opts
+}
+
+// client returns the client and the context of the request
+func (o *clientOptions) client() (*control.Client, context.Context, context.CancelFunc, error) {
+	if o.socket == "" {
+		return nil, nil, nil, errors.New("control socket is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	return control.NewClient(o.socket), ctx, cancel, nil
+}
+
+// print prints v in json with -json, or by text otherwise
+func (o *clientOptions) print(v interface{}, text func(w io.Writer)) {
+	if o.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	text(w)
+	w.Flush()
+}
+
+// parse returns the exit code once the command should exit, -h is not an
+// error
+func parse(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, true
+		}
+		return 2, true
+	}
+	return 0, false
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "hades-agent:", err)
+	return 1
+}
+
+func statusCommand(args []string) int {
+	fs, opts := newClientFlags("status", "")
+	if code, exit := parse(fs, args); exit {
+		return code
+	}
+	client, ctx, cancel, err := opts.client()
+	if err != nil {
+		return fail(err)
+	}
+	defer cancel()
+	status, err := client.Status(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	opts.print(status, func(w io.Writer) {
+		fmt.Fprintf(w, "id:\t%s\n", status.ID)
+		fmt.Fprintf(w, "version:\t%s\n", status.Version)
+		fmt.Fprintf(w, "pid:\t%d\n", status.Pid)
+		fmt.Fprintf(w, "uptime:\t%s\n", time.Since(status.StartedAt).Truncate(time.Second))
+		fmt.Fprintf(w, "workdir:\t%s\n", status.Workdir)
+		fmt.Fprintf(w, "healthy:\t%t\n", status.Healthy)
+		fmt.Fprintf(w, "plugins:\t%s\n", pluginCounts(status.Plugins))
+	})
+	return 0
+}
+
+// pluginCounts formats the counts in the order of the status
+func pluginCounts(counts map[string]int) string {
+	var parts []string
+	for _, status := range []string{control.StatusRunning, control.StatusPaused, control.StatusExited, control.StatusQuarantined} {
+		if counts[status] != 0 {
+			parts = append(parts, strconv.Itoa(counts[status])+" "+status)
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pluginCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hades-agent plugin ls|restart [flags]")
+		return 2
+	}
+	switch args[0] {
+	case "ls", "list":
+		return pluginList(args[1:])
+	case "restart":
+		return pluginRestart(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "hades-agent: unknown plugin command", args[0])
+		return 2
+	}
+}
+
+func pluginList(args []string) int {
+	fs, opts := newClientFlags("plugin ls", "")
+	if code, exit := parse(fs, args); exit {
+		return code
+	}
+	client, ctx, cancel, err := opts.client()
+	if err != nil {
+		return fail(err)
+	}
+	defer cancel()
+	plgs, err := client.Plugins(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	opts.print(plgs, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tVERSION\tSTATUS\tPID\tRESTARTS\tUPTIME")
+		for _, plg := range plgs {
+			uptime := "-"
+			if plg.Status == control.StatusRunning || plg.Status == control.StatusPaused {
+				uptime = time.Since(plg.StartedAt).Truncate(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", plg.Name, plg.Version, plg.Status, plg.Pid, plg.Restarts, uptime)
+		}
+	})
+	return 0
+}
+
+func pluginRestart(args []string) int {
+	fs, opts := newClientFlags("plugin restart", "NAME")
+	if code, exit := parse(fs, args); exit {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	client, ctx, cancel, err := opts.client()
+	if err != nil {
+		return fail(err)
+	}
+	defer cancel()
+	plg, err := client.Restart(ctx, fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	opts.print(plg, func(w io.Writer) {
+		fmt.Fprintf(w, "plugin %s is %s, pid %d\n", plg.Name, plg.Status, plg.Pid)
+	})
+	return 0
+}
+
+func taskCommand(args []string) int {
+	if len(args) == 0 || args[0] != "send" {
+		fmt.Fprintln(os.Stderr, "Usage: hades-agent task send [flags] DATA")
+		return 2
+	}
+	fs, opts := newClientFlags("task send", "DATA")
+	task := &proto.Task{}
+	fs.StringVar(&task.ObjectName, "plugin", "", "name of the plugin")
+	dataType := fs.Int("data-type", 0, "data type of the task")
+	fs.StringVar(&task.Token, "token", "", "token of the task, which the result carries")
+	if code, exit := parse(fs, args[1:]); exit {
+		return code
+	}
+	if task.ObjectName == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	task.DataType = int32(*dataType)
+	if data := fs.Arg(0); data == "-" {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fail(err)
+		}
+		task.Data = string(content)
+	} else {
+		task.Data = data
+	}
+	client, ctx, cancel, err := opts.client()
+	if err != nil {
+		return fail(err)
+	}
+	defer cancel()
+	if err = client.SendTask(ctx, task); err != nil {
+		return fail(err)
+	}
+	opts.print(task, func(w io.Writer) {
+		fmt.Fprintf(w, "task %d is sent to %s\n", task.DataType, task.ObjectName)
+	})
+	return 0
+}
@@ -0,0 +1,170 @@
+// Package conf is the local config file of the agent. It overrides the
+// flags at startup, and the configs of plugins pushed by the server.
+package conf
+
+import (
+	"agent/proto"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+)
+
+// File is the local config in yaml, like:
+//
+//	server:
+//	  addr: 10.0.0.1
+//	  port: "8888"
+//	workdir: /var/run/hades
+//	log_level: info
+//	plugins:
+//	  allowlist: [collector, ebpfdriver]
+//	  max_restarts: 5
+//	  overrides:
+//	    collector:
+//	      cpu_limit: 50
+//	      field_denylist: [cmdline]
+//	response:
+//	  fetch:
+//	    paths: [/var/log, /tmp]
+//	    max_size: 16777216
+//	  run:
+//	    enabled: true
+//	    commands:
+//	      - {name: netstat, path: /usr/bin/ss, args: [-antp]}
+//	      - {name: ps, path: /usr/bin/ps, allow_args: true}
+//
+// Overrides are fields of proto.Config by the json names, they replace the
+// ones pushed by the server. The fields of the identity and the binary of a
+// plugin can't be overridden. Workdir and max_restarts take effect at startup
+// only.
+type File struct {
+	Server struct {
+		Addr string `yaml:"addr"`
+		Port string `yaml:"port"`
+	} `yaml:"server"`
+	Workdir  string `yaml:"workdir"`
+	LogLevel string `yaml:"log_level"`
+	// Labels are attached to every record of the agent, as env: prod, on
+	// top of the ones pushed by the server
+	Labels  map[string]string `yaml:"labels"`
+	Plugins struct {
+		// plugins allowed to run, all of them if it's empty
+		Allowlist []string `yaml:"allowlist"`
+		// MaxRestarts overrides -max-restarts if it's set, 0 for unlimited
+		MaxRestarts *int                              `yaml:"max_restarts"`
+		Overrides   map[string]map[string]interface{} `yaml:"overrides"`
+	} `yaml:"plugins"`
+	// Response bounds the response actions of the server
+	Response Response `yaml:"response"`
+	// json of the overrides, validated once it's loaded
+	overrides map[string][]byte
+}
+
+// fields of proto.Config that can't be overridden
+var immutableFields = []string{"name", "version", "sha256", "signature", "download_urls"}
+
+var current atomic.Value
+
+// Current returns the config in use, an empty one if no file is loaded
+func Current() *File {
+	if f, ok := current.Load().(*File); ok {
+		return f
+	}
+	return &File{}
+}
+
+// Set replaces the config in use
+func Set(f *File) { current.Store(f) }
+
+// Load reads and validates the file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err = yaml.UnmarshalStrict(data, f); err != nil {
+		return nil, err
+	}
+	if _, err = f.Level(); err != nil {
+		return nil, err
+	}
+	if err = ValidateLabels(f.Labels); err != nil {
+		return nil, err
+	}
+	if n := f.Plugins.MaxRestarts; n != nil && *n < 0 {
+		return nil, fmt.Errorf("invalid max_restarts: %d", *n)
+	}
+	if err = f.Response.validate(); err != nil {
+		return nil, err
+	}
+	f.overrides = make(map[string][]byte, len(f.Plugins.Overrides))
+	for name, fields := range f.Plugins.Overrides {
+		for _, field := range immutableFields {
+			if _, ok := fields[field]; ok {
+				return nil, fmt.Errorf("override of %s: %s can't be overridden", name, field)
+			}
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("override of %s: %w", name, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&proto.Config{}); err != nil {
+			return nil, fmt.Errorf("override of %s: %w", name, err)
+		}
+		f.overrides[name] = data
+	}
+	return f, nil
+}
+
+// Level is the level of the log file, info if it's not set
+func (f *File) Level() (zapcore.Level, error) {
+	level := zapcore.InfoLevel
+	if f.LogLevel == "" {
+		return level, nil
+	}
+	err := level.UnmarshalText([]byte(f.LogLevel))
+	return level, err
+}
+
+// Allowed reports whether the plugin is in the allowlist
+func (f *File) Allowed(name string) bool {
+	if len(f.Plugins.Allowlist) == 0 {
+		return true
+	}
+	for _, allowed := range f.Plugins.Allowlist {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the configs pushed by the server with the local overrides,
+// the plugins out of the allowlist are removed. The configs passed in are
+// not modified.
+func (f *File) Merge(cfgs map[string]*proto.Config) map[string]*proto.Config {
+	merged := make(map[string]*proto.Config, len(cfgs))
+	for name, cfg := range cfgs {
+		if !f.Allowed(name) {
+			continue
+		}
+		override, ok := f.overrides[name]
+		if !ok {
+			merged[name] = cfg
+			continue
+		}
+		copied := *cfg
+		// validated in Load
+		json.Unmarshal(override, &copied)
+		merged[name] = &copied
+	}
+	return merged
+}
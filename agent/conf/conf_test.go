@@ -0,0 +1,122 @@
+package conf
+
+import (
+	"agent/proto"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const testConfig = `
+server:
+  addr: 10.0.0.1
+  port: "8888"
+log_level: debug
+labels:
+  env: prod
+  team: payments
+plugins:
+  allowlist: [collector, driver]
+  max_restarts: 0
+  overrides:
+    collector:
+      cpu_limit: 50
+      field_denylist: [cmdline]
+`
+
+func writeConfig(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, testConfig)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level, _ := f.Level(); level != zapcore.DebugLevel || f.Server.Addr != "10.0.0.1" || f.Server.Port != "8888" ||
+		f.Labels["env"] != "prod" || f.Labels["team"] != "payments" || f.Plugins.MaxRestarts == nil || *f.Plugins.MaxRestarts != 0 {
+		t.Fatalf("unexpected config: %+v", f)
+	}
+	for name, content := range map[string]string{
+		"unknown key":      "servers: {}",
+		"log level":        "log_level: verbose",
+		"unknown override": "plugins: {overrides: {collector: {cpu: 50}}}",
+		"override type":    "plugins: {overrides: {collector: {cpu_limit: high}}}",
+		"immutable":        "plugins: {overrides: {collector: {sha256: abc}}}",
+		"max restarts":     "plugins: {max_restarts: -1}",
+		"label key":        "labels: {-env: prod}",
+		"fetch path":       "response: {fetch: {paths: [var/log]}}",
+		"fetch size":       "response: {fetch: {max_size: -1}}",
+		"run path":         "response: {run: {commands: [{name: ps, path: ps}]}}",
+		"run duplicated":   "response: {run: {commands: [{name: ps, path: /bin/ps}, {name: ps, path: /bin/ps}]}}",
+		"run timeout":      "response: {run: {timeout: 3600}}",
+	} {
+		writeConfig(t, path, content)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, testConfig)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed := map[string]*proto.Config{
+		"collector": {Name: "collector", Version: "1.0.0", CpuLimit: 20, MemoryLimit: 1 << 20},
+		"driver":    {Name: "driver", Version: "1.0.0"},
+		"scanner":   {Name: "scanner", Version: "1.0.0"},
+	}
+	merged := f.Merge(pushed)
+	if _, ok := merged["scanner"]; ok || len(merged) != 2 {
+		t.Fatalf("plugin out of the allowlist is merged: %v", merged)
+	}
+	collector := merged["collector"]
+	if collector.CpuLimit != 50 || collector.MemoryLimit != 1<<20 || len(collector.FieldDenylist) != 1 || collector.Version != "1.0.0" {
+		t.Fatalf("unexpected override: %v", collector)
+	}
+	if pushed["collector"].CpuLimit != 20 || merged["driver"] != pushed["driver"] {
+		t.Fatal("pushed configs are modified")
+	}
+	if merged = (&File{}).Merge(pushed); len(merged) != 3 {
+		t.Fatalf("all plugins are allowed without the allowlist: %v", merged)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeConfig(t, path, testConfig)
+	reloaded := make(chan *File, 1)
+	w := &Watcher{Path: path, Interval: 10 * time.Millisecond, OnReload: func(f *File) { reloaded <- f }}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+	// an invalid file is not applied
+	writeConfig(t, path, "log_level: verbose")
+	select {
+	case f := <-reloaded:
+		t.Fatalf("invalid config is reloaded: %+v", f)
+	case <-time.After(100 * time.Millisecond):
+	}
+	writeConfig(t, path, "log_level: warn\n")
+	select {
+	case f := <-reloaded:
+		if level, _ := f.Level(); level != zapcore.WarnLevel || Current() != f {
+			t.Fatalf("unexpected config: %+v", f)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded")
+	}
+}
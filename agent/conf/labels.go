@@ -0,0 +1,32 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// bounds of the labels, which are sent with every record
+const (
+	MaxLabels          = 32
+	MaxLabelValueBytes = 256
+)
+
+// labelKey is the one of kubernetes without the prefix, an alphanumeric
+// start and end, with -, _ and . in between
+var labelKey = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateLabels checks the labels set locally or pushed by the server
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("%d labels, more than %d", len(labels), MaxLabels)
+	}
+	for key, value := range labels {
+		if !labelKey.MatchString(key) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+		if len(value) > MaxLabelValueBytes {
+			return fmt.Errorf("value of label %s is longer than %d bytes", key, MaxLabelValueBytes)
+		}
+	}
+	return nil
+}
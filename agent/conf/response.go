@@ -0,0 +1,118 @@
+package conf
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// bounds of the file fetched by the server
+const (
+	DefaultFetchSize = 16 << 20
+	MaxFetchSize     = 256 << 20
+)
+
+// bounds of the command run by the server, the timeout is in seconds
+const (
+	DefaultRunTimeout = 30
+	MaxRunTimeout     = 600
+	DefaultRunOutput  = 64 << 10
+	MaxRunOutput      = 1 << 20
+)
+
+// Command is the one the server can run by the name, with the args of it
+// first. The server can add args only if allow_args is set.
+type Command struct {
+	Name      string   `yaml:"name"`
+	Path      string   `yaml:"path"`
+	Args      []string `yaml:"args"`
+	AllowArgs bool     `yaml:"allow_args"`
+}
+
+// Response is the local control of the response actions, the server can't
+// loosen it
+type Response struct {
+	Fetch struct {
+		// Paths are the files, or the directories of them, the server can
+		// fetch. Nothing is fetched if it's empty.
+		Paths []string `yaml:"paths"`
+		// MaxSize bounds the file fetched, DefaultFetchSize if it's not set
+		MaxSize int64 `yaml:"max_size"`
+	} `yaml:"fetch"`
+	Run struct {
+		// Enabled allows the commands signed by the trusted keys, it's
+		// disabled by default
+		Enabled  bool      `yaml:"enabled"`
+		Commands []Command `yaml:"commands"`
+		// Timeout bounds the one of the task, DefaultRunTimeout if it's
+		// not set
+		Timeout int `yaml:"timeout"`
+		// MaxOutput bounds stdout and stderr each, the rest is dropped,
+		// DefaultRunOutput if it's not set
+		MaxOutput int `yaml:"max_output"`
+	} `yaml:"run"`
+}
+
+func (r *Response) validate() error {
+	for _, path := range r.Fetch.Paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("fetch path %q is not absolute", path)
+		}
+	}
+	if r.Fetch.MaxSize < 0 || r.Fetch.MaxSize > MaxFetchSize {
+		return fmt.Errorf("fetch max_size %d is out of [0, %d]", r.Fetch.MaxSize, MaxFetchSize)
+	}
+	if r.Run.Timeout < 0 || r.Run.Timeout > MaxRunTimeout {
+		return fmt.Errorf("run timeout %d is out of [0, %d]", r.Run.Timeout, MaxRunTimeout)
+	}
+	if r.Run.MaxOutput < 0 || r.Run.MaxOutput > MaxRunOutput {
+		return fmt.Errorf("run max_output %d is out of [0, %d]", r.Run.MaxOutput, MaxRunOutput)
+	}
+	names := make(map[string]bool, len(r.Run.Commands))
+	for _, cmd := range r.Run.Commands {
+		if cmd.Name == "" || names[cmd.Name] {
+			return fmt.Errorf("run command %q is empty or duplicated", cmd.Name)
+		}
+		names[cmd.Name] = true
+		if !filepath.IsAbs(cmd.Path) {
+			return fmt.Errorf("path of run command %s is not absolute", cmd.Name)
+		}
+	}
+	return nil
+}
+
+// RunCommand returns the command of the name, if running is enabled
+func (r *Response) RunCommand(name string) (Command, bool) {
+	if r.Run.Enabled {
+		for _, cmd := range r.Run.Commands {
+			if cmd.Name == name {
+				return cmd, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// RunTimeout is the longest a command runs
+func (r *Response) RunTimeout() time.Duration {
+	if r.Run.Timeout == 0 {
+		return DefaultRunTimeout * time.Second
+	}
+	return time.Duration(r.Run.Timeout) * time.Second
+}
+
+// RunOutput is the most of stdout and stderr kept each
+func (r *Response) RunOutput() int {
+	if r.Run.MaxOutput == 0 {
+		return DefaultRunOutput
+	}
+	return r.Run.MaxOutput
+}
+
+// FetchSize is the largest file fetched
+func (r *Response) FetchSize() int64 {
+	if r.Fetch.MaxSize == 0 {
+		return DefaultFetchSize
+	}
+	return r.Fetch.MaxSize
+}
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWatchInterval is how often the file is checked for modification
+const DefaultWatchInterval = 5 * time.Second
+
+// Watcher reloads the file on SIGHUP, or once the modification time or the
+// size of it changes. An invalid file is logged and the config in use is
+// kept.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	// OnReload is called with the new config once it's set
+	OnReload func(*File)
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	last, _ := os.Stat(w.Path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+			zap.S().Info("SIGHUP received, reload ", w.Path)
+			last, _ = os.Stat(w.Path)
+			w.reload()
+		case <-ticker.C:
+			info, err := os.Stat(w.Path)
+			if err != nil || (last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+				continue
+			}
+			last = info
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	f, err := Load(w.Path)
+	if err != nil {
+		zap.S().Error("config is not reloaded: ", err)
+		return
+	}
+	Set(f)
+	zap.S().Info("config is reloaded from ", w.Path)
+	if w.OnReload != nil {
+		w.OnReload(f)
+	}
+}
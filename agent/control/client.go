@@ -0,0 +1,96 @@
+package control
+
+import (
+	"agent/proto"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Client talks to the agent through the control socket
+type Client struct {
+	http *http.Client
+}
+
+// NewClient connects to the socket at path on each request
+func NewClient(path string) *Client {
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}}
+}
+
+// Status returns the status of the agent
+func (c *Client) Status(ctx context.Context) (status *Status, err error) {
+	status = &Status{}
+	err = c.do(ctx, http.MethodGet, "/status", nil, status)
+	return
+}
+
+// Plugins returns the plugins sorted by name
+func (c *Client) Plugins(ctx context.Context) (plgs []Plugin, err error) {
+	err = c.do(ctx, http.MethodGet, "/plugins", nil, &plgs)
+	return
+}
+
+// Plugin returns the plugin in detail
+func (c *Client) Plugin(ctx context.Context, name string) (detail *Detail, err error) {
+	detail = &Detail{}
+	err = c.do(ctx, http.MethodGet, "/plugins/"+name, nil, detail)
+	return
+}
+
+// Stats returns the stats of the plugins
+func (c *Client) Stats(ctx context.Context) (stats []Stats, err error) {
+	err = c.do(ctx, http.MethodGet, "/stats", nil, &stats)
+	return
+}
+
+// Restart restarts the plugin, and returns the new one
+func (c *Client) Restart(ctx context.Context, name string) (plg *Plugin, err error) {
+	plg = &Plugin{}
+	err = c.do(ctx, http.MethodPost, "/plugins/"+name+"/restart", nil, plg)
+	return
+}
+
+// SendTask sends the task to the plugin of object_name
+func (c *Client) SendTask(ctx context.Context, task *proto.Task) error {
+	return c.do(ctx, http.MethodPost, "/tasks", task, &proto.Task{})
+}
+
+// do sends the body in json, and decodes the response to v. The error of
+// the agent is returned as is.
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	// the host is ignored by the dialer
+	req, err := http.NewRequestWithContext(ctx, method, "http://hades-agent"+path, r)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := Error{}
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Error == "" {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return errors.New(e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
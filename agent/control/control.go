@@ -0,0 +1,373 @@
+// Package control serves the local control socket of the agent, so the
+// plugins of the host are managed without the server. It's HTTP over a unix
+// socket, and all the responses are in json:
+//
+//	GET  /plugins                 the plugins
+//	GET  /plugins/<name>          the plugin in detail, with the stats
+//	POST /plugins/<name>/restart  restart the plugin
+//	GET  /stats                   the stats of all the plugins
+//	POST /tasks                   send the task in the body to the plugin
+//	GET  /status                  the agent
+//
+// The socket is only accessible by the user of the agent.
+package control
+
+import (
+	"agent/agent"
+	"agent/plugin"
+	"agent/proto"
+	"agent/transport"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Status of a plugin
+const (
+	StatusRunning     = "running"
+	StatusPaused      = "paused"
+	StatusExited      = "exited"
+	StatusQuarantined = "quarantined"
+)
+
+// Plugin is the summary of a plugin in the list
+type Plugin struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Pid       int       `json:"pid"`
+	Status    string    `json:"status"`
+	Ready     bool      `json:"ready"`
+	Restarts  uint64    `json:"restarts"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Stats of a plugin, the rates are of the last heartbeat
+type Stats struct {
+	Name           string  `json:"name"`
+	RxTPS          float64 `json:"rx_tps"`
+	TxTPS          float64 `json:"tx_tps"`
+	RxSpeed        float64 `json:"rx_speed"`
+	TxSpeed        float64 `json:"tx_speed"`
+	TaskLatencyAvg float64 `json:"task_latency_avg"`
+	TaskLatencyMax float64 `json:"task_latency_max"`
+	SlowConsumer   bool    `json:"slow_consumer"`
+	QueuedTasks    int     `json:"queued_tasks"`
+	Throttled      float64 `json:"throttled"`
+	TransmitPanics uint64  `json:"transmit_panics"`
+	UnknownRecords uint64  `json:"unknown_records"`
+	RateLimited    uint64  `json:"rate_limited"`
+	Corrupted      uint64  `json:"corrupted_frames"`
+	Chunked        uint64  `json:"chunked_records"`
+	DroppedChunks  uint64  `json:"dropped_chunks"`
+}
+
+// Detail is a plugin in detail
+type Detail struct {
+	Plugin
+	Workdir       string    `json:"workdir"`
+	ExecPath      string    `json:"exec_path"`
+	ExitCode      int       `json:"exit_code"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	RingAttached  bool      `json:"ring_attached"`
+	FramingV2     bool      `json:"framing_v2"`
+	DiskQuota     int64     `json:"disk_quota"`
+	Stats         Stats     `json:"stats"`
+	// nil if the plugin never advertises them
+	Capabilities *plugin.Capabilities `json:"capabilities,omitempty"`
+}
+
+// Status of the agent, plugins are counted by the status
+type Status struct {
+	ID        string         `json:"id"`
+	Version   string         `json:"version"`
+	Pid       int            `json:"pid"`
+	StartedAt time.Time      `json:"started_at"`
+	Workdir   string         `json:"workdir"`
+	Healthy   bool           `json:"healthy"`
+	Plugins   map[string]int `json:"plugins"`
+}
+
+// maxTaskSize bounds the body of a task
+const maxTaskSize = 1 << 20
+
+// Error is the response of a failed request
+type Error struct {
+	Error string `json:"error"`
+}
+
+var (
+	errNotFound = errors.New("plugin not found")
+	// the task is refused by the plugin with the task queue full
+	errTaskBusy = errors.New("plugin is busy with tasks")
+)
+
+// taskTimeout bounds the retries of a task refused by the full task queue
+var taskTimeout = 5 * time.Second
+
+var startedAt = time.Now()
+
+// Startup serves the socket at path until ctx is done, nothing is served if
+// path is empty
+func Startup(ctx context.Context, wg *sync.WaitGroup, path string) {
+	defer wg.Done()
+	if path == "" {
+		return
+	}
+	l, err := Listen(path)
+	if err != nil {
+		zap.S().Error("control socket disabled: ", err)
+		return
+	}
+	server := &http.Server{Handler: NewHandler(ctx, plugin.DefaultManager, transport.DTransfer), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	zap.S().Info("control socket listen on ", path)
+	if err = server.Serve(l); err != nil && err != http.ErrServerClosed {
+		zap.S().Error("control socket: ", err)
+	}
+}
+
+// Listen listens on the unix socket at path, the one left by the last run is
+// removed. It's accessible by the owner only.
+func Listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+type handler struct {
+	// the context of the plugins restarted
+	ctx      context.Context
+	manager  *plugin.Manager
+	transfer *transport.Transfer
+}
+
+// NewHandler serves the requests on the manager, ctx is the one of the
+// plugins restarted by it
+func NewHandler(ctx context.Context, m *plugin.Manager, t *transport.Transfer) http.Handler {
+	h := &handler{ctx: ctx, manager: m, transfer: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plugins", h.list)
+	mux.HandleFunc("/plugins/", h.plugin)
+	mux.HandleFunc("/stats", h.stats)
+	mux.HandleFunc("/tasks", h.task)
+	mux.HandleFunc("/status", h.status)
+	return mux
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	status := Status{
+		ID:        agent.Instance.ID,
+		Version:   agent.Version,
+		Pid:       os.Getpid(),
+		StartedAt: startedAt,
+		Workdir:   h.manager.Workdir,
+		Healthy:   h.transfer.IsHealthy(),
+		Plugins:   map[string]int{},
+	}
+	for _, plg := range h.plugins() {
+		status.Plugins[h.summary(plg).Status]++
+	}
+	reply(w, http.StatusOK, status)
+}
+
+// task sends the task to the plugin of object_name, it's retried until
+// taskTimeout if the task queue of the plugin is full.
+func (h *handler) task(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	task := proto.Task{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxTaskSize)).Decode(&task); err != nil {
+		reply(w, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+	plg, ok := h.manager.Get(task.ObjectName)
+	if !ok {
+		reply(w, http.StatusNotFound, Error{Error: errNotFound.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), taskTimeout)
+	defer cancel()
+	for plg.SendTask(task) != nil {
+		select {
+		case <-ctx.Done():
+			reply(w, http.StatusServiceUnavailable, Error{Error: errTaskBusy.Error()})
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	zap.S().Infof("task %d is sent to %s from the control socket", task.DataType, task.ObjectName)
+	reply(w, http.StatusAccepted, task)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	plgs := []Plugin{}
+	for _, plg := range h.plugins() {
+		plgs = append(plgs, h.summary(plg))
+	}
+	reply(w, http.StatusOK, plgs)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	stats := []Stats{}
+	for _, plg := range h.plugins() {
+		stats = append(stats, statsOf(plg))
+	}
+	reply(w, http.StatusOK, stats)
+}
+
+// plugin serves /plugins/<name> and /plugins/<name>/restart
+func (h *handler) plugin(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/plugins/")
+	action := ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, action = name[:i], name[i+1:]
+	}
+	plg, ok := h.manager.Get(name)
+	if !ok {
+		reply(w, http.StatusNotFound, Error{Error: errNotFound.Error()})
+		return
+	}
+	switch action {
+	case "":
+		if allow(w, r, http.MethodGet) {
+			reply(w, http.StatusOK, h.detail(plg))
+		}
+	case "restart":
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		if err := h.manager.Restart(h.ctx, name); err != nil {
+			reply(w, http.StatusInternalServerError, Error{Error: err.Error()})
+			return
+		}
+		if plg, ok = h.manager.Get(name); !ok {
+			reply(w, http.StatusNotFound, Error{Error: errNotFound.Error()})
+			return
+		}
+		reply(w, http.StatusOK, h.summary(plg))
+	default:
+		reply(w, http.StatusNotFound, Error{Error: "unknown action " + action})
+	}
+}
+
+// plugins are sorted by name
+func (h *handler) plugins() []*plugin.Plugin {
+	plgs := h.manager.GetAll()
+	sort.Slice(plgs, func(i, j int) bool { return plgs[i].Name() < plgs[j].Name() })
+	return plgs
+}
+
+func (h *handler) summary(plg *plugin.Plugin) Plugin {
+	status := StatusRunning
+	switch {
+	case h.manager.IsQuarantined(plg.Name()):
+		status = StatusQuarantined
+	case plg.IsExited():
+		status = StatusExited
+	case plg.IsPaused():
+		status = StatusPaused
+	}
+	return Plugin{
+		Name:      plg.Name(),
+		Version:   plg.Version(),
+		Pid:       plg.Pid(),
+		Status:    status,
+		Ready:     plg.IsReady(),
+		Restarts:  plg.Restarts(),
+		StartedAt: plg.StartedAt(),
+	}
+}
+
+func (h *handler) detail(plg *plugin.Plugin) Detail {
+	d := Detail{
+		Plugin:        h.summary(plg),
+		Workdir:       plg.GetWorkingDirectory(),
+		ExecPath:      plg.ExecPath(),
+		LastHeartbeat: plg.LastHeartbeat(),
+		RingAttached:  plg.RingAttached(),
+		FramingV2:     plg.FramingV2(),
+		DiskQuota:     plg.DiskQuota(),
+		Stats:         statsOf(plg),
+	}
+	if plg.IsExited() {
+		d.ExitCode = plg.ExitCode()
+	}
+	if caps, ok := plg.Capabilities(); ok {
+		d.Capabilities = caps
+	}
+	return d
+}
+
+func statsOf(plg *plugin.Plugin) Stats {
+	rxSpeed, txSpeed, rxTPS, txTPS := plg.LastState()
+	avg, max, slow := plg.GetTaskState()
+	corrupted, _ := plg.CorruptedFrames()
+	chunked, dropped := plg.ChunkStats()
+	return Stats{
+		Name:           plg.Name(),
+		RxTPS:          rxTPS,
+		TxTPS:          txTPS,
+		RxSpeed:        rxSpeed,
+		TxSpeed:        txSpeed,
+		TaskLatencyAvg: avg.Seconds(),
+		TaskLatencyMax: max.Seconds(),
+		SlowConsumer:   slow,
+		QueuedTasks:    plg.QueuedTasks(),
+		Throttled:      plg.ThrottledTime().Seconds(),
+		TransmitPanics: plg.TransmitPanics(),
+		UnknownRecords: plg.UnknownRecords(),
+		RateLimited:    plg.RateLimitedRecords(),
+		Corrupted:      corrupted,
+		Chunked:        chunked,
+		DroppedChunks:  dropped,
+	}
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	reply(w, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+	return false
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.S().Error("control reply: ", err)
+	}
+}
@@ -0,0 +1,183 @@
+//go:build !windows
+
+package control
+
+import (
+	"agent/plugin"
+	"agent/proto"
+	"agent/transport"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestPlugin(t *testing.T, workdir, name, script string) proto.Config {
+	dir := filepath.Join(workdir, "plugin", name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("#!/bin/sh\n" + script + "\n")
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	return proto.Config{Name: name, Version: "1.0.0", Sha256: hex.EncodeToString(sum[:])}
+}
+
+// serve the handler on a socket in a temp dir, and returns the path of it
+func serve(t *testing.T, ctx context.Context, m *plugin.Manager) string {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected mode of the socket: %v", info.Mode())
+	}
+	server := &http.Server{Handler: NewHandler(ctx, m, transport.NewTransfer())}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return path
+}
+
+func call(t *testing.T, client *http.Client, method, path string, code int, v interface{}) {
+	req, _ := http.NewRequest(method, "http://unix"+path, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != code {
+		t.Fatalf("%s %s: unexpected status %d", method, path, resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControl(t *testing.T) {
+	workdir := t.TempDir()
+	m := plugin.NewManager(workdir, "hades-agent", transport.NewTransfer())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	if err := m.Load(ctx, writeTestPlugin(t, workdir, "reader", "exec cat <&3 >/dev/null")); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(serve(t, ctx, m)).http
+
+	var plgs []Plugin
+	call(t, client, http.MethodGet, "/plugins", http.StatusOK, &plgs)
+	if len(plgs) != 1 || plgs[0].Name != "reader" || plgs[0].Status != StatusRunning || plgs[0].Pid == 0 {
+		t.Fatalf("unexpected plugins: %+v", plgs)
+	}
+	var detail Detail
+	call(t, client, http.MethodGet, "/plugins/reader", http.StatusOK, &detail)
+	if detail.Pid != plgs[0].Pid || detail.Workdir == "" || detail.Stats.Name != "reader" {
+		t.Fatalf("unexpected detail: %+v", detail)
+	}
+	var stats []Stats
+	call(t, client, http.MethodGet, "/stats", http.StatusOK, &stats)
+	if len(stats) != 1 || stats[0].Name != "reader" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	var restarted Plugin
+	call(t, client, http.MethodPost, "/plugins/reader/restart", http.StatusOK, &restarted)
+	if restarted.Status != StatusRunning || restarted.Pid == plgs[0].Pid || !restarted.StartedAt.After(plgs[0].StartedAt) {
+		t.Fatalf("plugin is not restarted: %+v", restarted)
+	}
+
+	var e Error
+	call(t, client, http.MethodGet, "/plugins/missing", http.StatusNotFound, &e)
+	call(t, client, http.MethodPost, "/plugins/missing/restart", http.StatusNotFound, &e)
+	call(t, client, http.MethodGet, "/plugins/reader/restart", http.StatusMethodNotAllowed, &e)
+	call(t, client, http.MethodPost, "/plugins", http.StatusMethodNotAllowed, &e)
+	call(t, client, http.MethodGet, "/plugins/reader/unknown", http.StatusNotFound, &e)
+	if e.Error == "" {
+		t.Fatal("error is missing")
+	}
+}
+
+func TestClient(t *testing.T) {
+	workdir := t.TempDir()
+	m := plugin.NewManager(workdir, "hades-agent", transport.NewTransfer())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	tasks := filepath.Join(t.TempDir(), "tasks")
+	if err := m.Load(ctx, writeTestPlugin(t, workdir, "reader", "exec cat <&3 >"+tasks)); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(serve(t, ctx, m))
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Pid != os.Getpid() || status.Workdir != workdir || status.Plugins[StatusRunning] != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	plgs, err := client.Plugins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plgs) != 1 || plgs[0].Name != "reader" {
+		t.Fatalf("unexpected plugins: %+v", plgs)
+	}
+	if err = client.SendTask(ctx, &proto.Task{ObjectName: "reader", DataType: 1000, Data: "scan /tmp"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, _ := os.ReadFile(tasks)
+		if strings.Contains(string(content), "scan /tmp") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("task is not received by the plugin")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = client.SendTask(ctx, &proto.Task{ObjectName: "missing"}); err == nil || err.Error() != errNotFound.Error() {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = client.Restart(ctx, "missing"); err == nil {
+		t.Fatal("missing plugin is restarted")
+	}
+}
+
+func TestListenStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the socket file is left behind, as a crashed agent does
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = Listen(path); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	// a regular file is never removed
+	if err = os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = Listen(path); err == nil {
+		l.Close()
+		t.Fatal("regular file is replaced")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package control
+
+// DefaultSocket is the path of the control socket
+const DefaultSocket = "/var/run/hades-agent.sock"
@@ -0,0 +1,7 @@
+//go:build windows
+
+package control
+
+// DefaultSocket is empty, the control socket is disabled by default on
+// windows
+const DefaultSocket = ""
@@ -3,9 +3,12 @@ package heartbeat
 import (
 	"agent/agent"
 	"agent/host"
+	"agent/plugin"
 	"agent/proto"
 	"agent/resource"
 	"agent/transport"
+	"agent/transport/compressor"
+	"encoding/json"
 	"os"
 	"runtime"
 	"strconv"
@@ -14,6 +17,7 @@ import (
 	"github.com/chriskaliX/SDK/config"
 	"github.com/coreos/go-systemd/daemon"
 	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
@@ -28,6 +32,9 @@ func getAgentStat(now time.Time) {
 		},
 	}
 	// system infomation
+	if hostname, ok := host.Hostname.Load().(string); ok {
+		rec.Data.Fields["hostname"] = hostname
+	}
 	rec.Data.Fields["kernel_version"] = host.KernelVersion
 	rec.Data.Fields["arch"] = host.Arch
 	rec.Data.Fields["platform"] = host.Platform
@@ -36,6 +43,9 @@ func getAgentStat(now time.Time) {
 	// add cpu information
 	rec.Data.Fields["cpu_num"] = host.CpuNum
 	rec.Data.Fields["cpu_mhz"] = host.CpuMhz
+	// identity, and whether the server acknowledges the registration
+	rec.Data.Fields["id_source"] = agent.Instance.IDSource
+	rec.Data.Fields["registered"] = strconv.FormatBool(transport.DTransfer.Registered())
 	// idc/region/net_mode/rx(tx)_speed not added
 	cpuPercent, rss, readSpeed, writeSpeed, fds, startAt, err := resource.GetProcResouce(os.Getpid())
 	if err != nil {
@@ -48,11 +58,42 @@ func getAgentStat(now time.Time) {
 		rec.Data.Fields["pid"] = strconv.Itoa(os.Getpid())
 		rec.Data.Fields["fd_cnt"] = strconv.FormatInt(int64(fds), 10)
 		rec.Data.Fields["started_at"] = strconv.FormatInt(startAt, 10)
+		rec.Data.Fields["uptime"] = strconv.FormatInt(now.Unix()-startAt, 10)
 	}
 	// transfer service not addes
 	txTPS, rxTPX := transport.DTransfer.GetState(now)
 	rec.Data.Fields["tx_tps"] = strconv.FormatFloat(txTPS, 'f', 8, 64)
 	rec.Data.Fields["rx_tps"] = strconv.FormatFloat(rxTPX, 'f', 8, 64)
+	rec.Data.Fields["compression"] = transport.Compression.Current()
+	rec.Data.Fields["compression_ratio"] = strconv.FormatFloat(compressor.Ratio(compressor.WireStats()), 'f', 3, 64)
+	// records lost by the sinks of the route policy
+	if dropped, failed := transport.SinkStats(); len(dropped) != 0 {
+		var droppedCnt, failedCnt uint64
+		for name := range dropped {
+			droppedCnt += dropped[name]
+			failedCnt += failed[name]
+		}
+		rec.Data.Fields["sink_dropped"] = strconv.FormatUint(droppedCnt, 10)
+		rec.Data.Fields["sink_failed"] = strconv.FormatUint(failedCnt, 10)
+	}
+	// records suppressed by the sample policy
+	deduped, sampled, rules := transport.SampleStats()
+	rec.Data.Fields["dedup_suppressed"] = strconv.FormatUint(deduped, 10)
+	rec.Data.Fields["sample_suppressed"] = strconv.FormatUint(sampled, 10)
+	if len(rules) != 0 {
+		if data, err := json.Marshal(rules); err == nil {
+			rec.Data.Fields["suppressed_by_rule"] = string(data)
+		}
+	}
+	// recurring tasks scheduled by cron
+	scheduled, fired := transport.ScheduleStats()
+	rec.Data.Fields["schedules"] = strconv.Itoa(scheduled)
+	rec.Data.Fields["scheduled_tasks"] = strconv.FormatUint(fired, 10)
+	rec.Data.Fields["redacted_fields"] = strconv.FormatUint(transport.RedactedFields(), 10)
+	// records upgraded to the latest schemas, and the invalid ones
+	upgraded, invalid := transport.SchemaStats()
+	rec.Data.Fields["schema_upgraded"] = strconv.FormatUint(upgraded, 10)
+	rec.Data.Fields["schema_invalid"] = strconv.FormatUint(invalid, 10)
 	// change load to gopsutil
 	rec.Data.Fields["du"] = strconv.FormatUint(resource.GetDirSize(agent.Instance.Workdir, "plugin"), 10)
 	rec.Data.Fields["grs"] = strconv.Itoa(runtime.NumGoroutine())
@@ -69,15 +110,54 @@ func getAgentStat(now time.Time) {
 		}
 	}
 	rec.Data.Fields["boot_at"] = strconv.FormatUint(resource.GetBootTime(), 10)
-	if cpuPercents, err := cpu.Percent(0, false); err != nil {
+	if cpuPercents, err := cpu.Percent(0, false); err == nil && len(cpuPercents) != 0 {
 		rec.Data.Fields["sys_cpu"] = strconv.FormatFloat(cpuPercents[0], 'f', 8, 64)
 	}
-	if mem, err := mem.VirtualMemory(); err != nil {
+	if mem, err := mem.VirtualMemory(); err == nil {
 		rec.Data.Fields["sys_mem"] = strconv.FormatFloat(mem.UsedPercent, 'f', 8, 64)
+		rec.Data.Fields["mem_total"] = strconv.FormatUint(mem.Total, 10)
+	}
+	// the disk the agent works on
+	if usage, err := disk.Usage(agent.Instance.Workdir); err == nil {
+		rec.Data.Fields["sys_disk"] = strconv.FormatFloat(usage.UsedPercent, 'f', 8, 64)
+		rec.Data.Fields["disk_total"] = strconv.FormatUint(usage.Total, 10)
+	}
+	// plugins inventory
+	plgs := pluginList()
+	rec.Data.Fields["plugin_cnt"] = strconv.Itoa(len(plgs))
+	if data, err := json.Marshal(plgs); err == nil {
+		rec.Data.Fields["plugins"] = string(data)
 	}
 
 	// 看门狗程序, 配合 .service 下做服务探活
 	daemon.SdNotify(false, "WATCHDOG=1")
 
-	transport.DTransfer.Transmission(rec, false)
+	transport.DTransfer.TransmitAgent(rec, false)
+}
+
+type pluginStat struct {
+	Name    string  `json:"name"`
+	Version string  `json:"pversion"`
+	Pid     int     `json:"pid,omitempty"`
+	Exited  bool    `json:"exited"`
+	RxTPS   float64 `json:"rx_tps"`
+	TxTPS   float64 `json:"tx_tps"`
+	RxSpeed float64 `json:"rx_speed"`
+	TxSpeed float64 `json:"tx_speed"`
+}
+
+// pluginList is the plugins with the rates of the last plugin heartbeat,
+// the window is owned by getPlgStat
+func pluginList() []pluginStat {
+	plgs := plugin.DefaultManager.GetAll()
+	stats := make([]pluginStat, 0, len(plgs))
+	for _, plg := range plgs {
+		stat := pluginStat{Name: plg.Name(), Version: plg.Version(), Exited: plg.IsExited()}
+		if !stat.Exited {
+			stat.Pid = plg.Pid()
+		}
+		stat.RxSpeed, stat.TxSpeed, stat.RxTPS, stat.TxTPS = plg.LastState()
+		stats = append(stats, stat)
+	}
+	return stats
 }
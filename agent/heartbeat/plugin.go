@@ -7,6 +7,7 @@ import (
 	"agent/transport"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chriskaliX/SDK/config"
@@ -37,12 +38,46 @@ func getPlgStat(now time.Time) {
 				rec.Data.Fields["started_at"] = strconv.FormatInt(startAt, 10)
 			}
 			rec.Data.Fields["du"] = strconv.FormatUint(resource.GetDirSize(plg.GetWorkingDirectory(), ""), 10)
+			if quota := plg.DiskQuota(); quota > 0 {
+				rec.Data.Fields["disk_quota"] = strconv.FormatInt(quota, 10)
+			}
 			RxSpeed, TxSpeed, RxTPS, TxTPS := plg.GetState()
 			rec.Data.Fields["rx_tps"] = strconv.FormatFloat(RxTPS, 'f', 8, 64)
 			rec.Data.Fields["tx_tps"] = strconv.FormatFloat(TxTPS, 'f', 8, 64)
 			rec.Data.Fields["rx_speed"] = strconv.FormatFloat(RxSpeed, 'f', 8, 64)
 			rec.Data.Fields["tx_speed"] = strconv.FormatFloat(TxSpeed, 'f', 8, 64)
-			transport.DTransfer.Transmission(rec, false)
+			taskAvg, taskMax, slow := plg.GetTaskState()
+			rec.Data.Fields["task_latency_avg"] = strconv.FormatFloat(taskAvg.Seconds(), 'f', 8, 64)
+			rec.Data.Fields["task_latency_max"] = strconv.FormatFloat(taskMax.Seconds(), 'f', 8, 64)
+			rec.Data.Fields["slow_consumer"] = strconv.FormatBool(slow)
+			rec.Data.Fields["queued_tasks"] = strconv.Itoa(plg.QueuedTasks())
+			rec.Data.Fields["paused"] = strconv.FormatBool(plg.IsPaused())
+			rec.Data.Fields["ready"] = strconv.FormatBool(plg.IsReady())
+			rec.Data.Fields["restarts"] = strconv.FormatUint(plg.Restarts(), 10)
+			rec.Data.Fields["last_heartbeat"] = strconv.FormatInt(plg.LastHeartbeat().Unix(), 10)
+			rec.Data.Fields["transmit_panics"] = strconv.FormatUint(plg.TransmitPanics(), 10)
+			rec.Data.Fields["unknown_records"] = strconv.FormatUint(plg.UnknownRecords(), 10)
+			rec.Data.Fields["rate_limited"] = strconv.FormatUint(plg.RateLimitedRecords(), 10)
+			rec.Data.Fields["ring_attached"] = strconv.FormatBool(plg.RingAttached())
+			rec.Data.Fields["framing_v2"] = strconv.FormatBool(plg.FramingV2())
+			if caps, ok := plg.Capabilities(); ok {
+				rec.Data.Fields["features"] = strings.Join(caps.Features, ",")
+			}
+			corrupted, discarded := plg.CorruptedFrames()
+			rec.Data.Fields["corrupted_frames"] = strconv.FormatUint(corrupted, 10)
+			rec.Data.Fields["discarded_bytes"] = strconv.FormatUint(discarded, 10)
+			chunked, dropped := plg.ChunkStats()
+			rec.Data.Fields["chunked_records"] = strconv.FormatUint(chunked, 10)
+			rec.Data.Fields["dropped_chunks"] = strconv.FormatUint(dropped, 10)
+			rec.Data.Fields["throttled"] = strconv.FormatFloat(plg.ThrottledTime().Seconds(), 'f', 3, 64)
+			if offset, ok := plg.ClockOffset(); ok {
+				rec.Data.Fields["clock_offset"] = strconv.FormatFloat(offset.Seconds(), 'f', 3, 64)
+			}
+			// measure for the next heartbeat
+			if err := plg.SyncClock(); err != nil {
+				zap.S().Debug("clock sync: ", err)
+			}
+			transport.DTransfer.TransmitAgent(rec, false)
 		}
 	}
 }
@@ -41,11 +41,6 @@ func (w *GrpcWriter) Write(p []byte) (n int, err error) {
 			rec.Data.Fields[k] = strconv.Itoa(v)
 		}
 	}
-	// err = core.Transmission(rec, false)
-	// if err != nil {
-	// 	return
-	// }
-	// n = len(p)
 	return
 }
 
@@ -0,0 +1,174 @@
+// Package metrics exposes the health of the agent and the plugins in the
+// text format of Prometheus. It's opt-in, and served on loopback only.
+package metrics
+
+import (
+	"agent/plugin"
+	"agent/transport"
+	"agent/transport/compressor"
+	"agent/utils"
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errNotLoopback = errors.New("metrics must listen on a loopback address")
+
+// Collector renders the metrics of the manager and the transfer
+type Collector struct {
+	Manager  *plugin.Manager
+	Transfer *transport.Transfer
+}
+
+// Startup serves /metrics on addr until ctx is done, nothing is served if
+// addr is empty
+func Startup(ctx context.Context, wg *sync.WaitGroup, addr string) {
+	defer wg.Done()
+	if addr == "" {
+		return
+	}
+	l, err := Listen(addr)
+	if err != nil {
+		zap.S().Error("metrics disabled: ", err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &Collector{Manager: plugin.DefaultManager, Transfer: transport.DTransfer})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	zap.S().Info("metrics listen on ", l.Addr())
+	if err = server.Serve(l); err != nil && err != http.ErrServerClosed {
+		zap.S().Error("metrics: ", err)
+	}
+}
+
+// Listen listens on addr if the host of it is loopback, "localhost" is
+// resolved to 127.0.0.1
+func Listen(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return nil, errNotLoopback
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, port))
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	c.write(bw)
+	bw.Flush()
+}
+
+// metric is a family of samples by plugin
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func(plg *plugin.Plugin) float64
+}
+
+// the rates are of the last heartbeat window, the scrape doesn't reset them
+var pluginMetrics = []metric{
+	{"hades_plugin_up", "Whether the plugin process is running.", "gauge", func(plg *plugin.Plugin) float64 {
+		return boolValue(!plg.IsExited())
+	}},
+	{"hades_plugin_rx_bytes_per_second", "Bytes received from the plugin per second.", "gauge", func(plg *plugin.Plugin) float64 {
+		rx, _, _, _ := plg.LastState()
+		return rx
+	}},
+	{"hades_plugin_tx_bytes_per_second", "Bytes sent to the plugin per second.", "gauge", func(plg *plugin.Plugin) float64 {
+		_, tx, _, _ := plg.LastState()
+		return tx
+	}},
+	{"hades_plugin_rx_records_per_second", "Records received from the plugin per second.", "gauge", func(plg *plugin.Plugin) float64 {
+		_, _, rx, _ := plg.LastState()
+		return rx
+	}},
+	{"hades_plugin_tx_records_per_second", "Tasks sent to the plugin per second.", "gauge", func(plg *plugin.Plugin) float64 {
+		_, _, _, tx := plg.LastState()
+		return tx
+	}},
+	{"hades_plugin_throttled_seconds_total", "Time the receive from the plugin is blocked by backpressure.", "counter", func(plg *plugin.Plugin) float64 {
+		return plg.ThrottledTime().Seconds()
+	}},
+	{"hades_plugin_restarts_total", "Restarts of the plugin after crashes.", "counter", func(plg *plugin.Plugin) float64 {
+		return float64(plg.Restarts())
+	}},
+}
+
+func (c *Collector) write(w *bufio.Writer) {
+	plgs := c.Manager.GetAll()
+	sort.Slice(plgs, func(i, j int) bool { return plgs[i].Name() < plgs[j].Name() })
+	for _, m := range pluginMetrics {
+		writeHeader(w, m.name, m.help, m.typ)
+		for _, plg := range plgs {
+			writeSample(w, m.name, `plugin="`+escapeLabel(plg.Name())+`"`, m.value(plg))
+		}
+	}
+	writeHeader(w, "hades_transport_queue_depth", "Records buffered or being sent to the server.", "gauge")
+	writeSample(w, "hades_transport_queue_depth", "", float64(c.Transfer.Pending()))
+	writeHeader(w, "hades_transport_healthy", "Whether the stream to the server is up.", "gauge")
+	writeSample(w, "hades_transport_healthy", "", boolValue(c.Transfer.IsHealthy()))
+	if c.Transfer.Spool != nil {
+		total, dropped := c.Transfer.Spool.Size()
+		writeHeader(w, "hades_transport_spool_bytes", "Bytes of the records spooled on disk.", "gauge")
+		writeSample(w, "hades_transport_spool_bytes", "", float64(total))
+		writeHeader(w, "hades_transport_spool_dropped_total", "Segments of the spool dropped by the size cap.", "counter")
+		writeSample(w, "hades_transport_spool_dropped_total", "", float64(dropped))
+	}
+	wireRaw, wireCompressed := compressor.WireStats()
+	recordRaw, recordCompressed := compressor.RecordStats()
+	writeHeader(w, "hades_transport_compression_raw_bytes_total", "Bytes sent to the server before compressed.", "counter")
+	writeSample(w, "hades_transport_compression_raw_bytes_total", `level="stream"`, float64(wireRaw))
+	writeSample(w, "hades_transport_compression_raw_bytes_total", `level="record"`, float64(recordRaw))
+	writeHeader(w, "hades_transport_compression_compressed_bytes_total", "Bytes sent to the server after compressed.", "counter")
+	writeSample(w, "hades_transport_compression_compressed_bytes_total", `level="stream"`, float64(wireCompressed))
+	writeSample(w, "hades_transport_compression_compressed_bytes_total", `level="record"`, float64(recordCompressed))
+	writeHeader(w, "hades_transport_compression_ratio", "Compressed bytes to raw bytes sent to the server.", "gauge")
+	writeSample(w, "hades_transport_compression_ratio", `level="stream"`, compressor.Ratio(wireRaw, wireCompressed))
+	writeSample(w, "hades_transport_compression_ratio", `level="record"`, compressor.Ratio(recordRaw, recordCompressed))
+	writeHeader(w, "hades_download_failures_total", "Plugin downloads failed on all the urls.", "counter")
+	writeSample(w, "hades_download_failures_total", "", float64(utils.DownloadFailures()))
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string { return labelReplacer.Replace(value) }
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
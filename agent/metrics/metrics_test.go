@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"agent/plugin"
+	"agent/proto"
+	"agent/transport"
+	"agent/utils"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", ":0", "192.0.2.1:0", "example.com:0"} {
+		if l, err := Listen(addr); err == nil {
+			l.Close()
+			t.Fatalf("%s is not loopback", addr)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:0", "localhost:0"} {
+		l, err := Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+}
+
+func TestCollector(t *testing.T) {
+	transfer := transport.NewTransfer()
+	for i := 0; i < 3; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	// the checksum is invalid, the download fails
+	failures := utils.DownloadFailures()
+	utils.Download(context.Background(), t.TempDir()+"/plugin", "invalid", nil, "")
+	server := httptest.NewServer(&Collector{Manager: plugin.NewManager(t.TempDir(), "test", transfer), Transfer: transfer})
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		"# TYPE hades_plugin_restarts_total counter",
+		"hades_transport_queue_depth 3",
+		"hades_transport_healthy 0",
+		"hades_download_failures_total " + strconv.FormatUint(failures+1, 10),
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("%q is missing in:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Fatalf("unexpected escape: %s", got)
+	}
+}
@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// IBackpressure is implemented by the transmitter which can be saturated.
+// Throttle returns a channel closed once it takes records again, nil if it's
+// not saturated.
+type IBackpressure interface {
+	Throttle() <-chan struct{}
+}
+
+// throttle blocks the receive while the transmitter is saturated, and the
+// plugin blocks on the full pipe in turn. Heartbeats can't be read in the
+// meantime, so the window restarts once it's released.
+func (p *Plugin) throttle() {
+	p.tmu.RLock()
+	bp, ok := p.transmitter.(IBackpressure)
+	p.tmu.RUnlock()
+	if !ok {
+		return
+	}
+	released := bp.Throttle()
+	if released == nil {
+		return
+	}
+	atomic.StoreInt32(&p.throttled, 1)
+	start := time.Now()
+	select {
+	case <-released:
+	case <-p.done:
+	}
+	now := time.Now()
+	atomic.AddInt64(&p.throttledTime, int64(now.Sub(start)))
+	atomic.StoreInt64(&p.lastHeartbeat, now.UnixNano())
+	atomic.StoreInt32(&p.throttled, 0)
+}
+
+// IsThrottled reports whether the receive is blocked by backpressure
+func (p *Plugin) IsThrottled() bool { return atomic.LoadInt32(&p.throttled) == 1 }
+
+// ThrottledTime returns how long the receive has been blocked by
+// backpressure in total
+func (p *Plugin) ThrottledTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.throttledTime))
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bufio"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// throttleTransmitter is saturated until release is called
+type throttleTransmitter struct {
+	*recordTransmitter
+	mu       sync.Mutex
+	released chan struct{}
+}
+
+func (t *throttleTransmitter) Throttle() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.released
+}
+
+func (t *throttleTransmitter) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	close(t.released)
+	t.released = nil
+}
+
+func TestBackpressure(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	transmitter := &throttleTransmitter{recordTransmitter: newRecordTransmitter(), released: make(chan struct{})}
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.rx = r
+	p.reader = bufio.NewReader(r)
+	p.transmitter = transmitter
+	p.wg.Add(1)
+	go p.Receive()
+	buf, err := framing.Encode(&proto.Record{DataType: 1000}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(buf)
+	waitFor(t, "receive is not throttled", p.IsThrottled)
+	select {
+	case <-transmitter.plugin:
+		t.Fatal("record is received while throttled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	transmitter.release()
+	select {
+	case <-transmitter.plugin:
+	case <-time.After(time.Second):
+		t.Fatal("record is not received once released")
+	}
+	if p.IsThrottled() || p.ThrottledTime() < 50*time.Millisecond {
+		t.Fatalf("unexpected throttle state: %v, %s", p.IsThrottled(), p.ThrottledTime())
+	}
+	w.Close()
+	p.wg.Wait()
+}
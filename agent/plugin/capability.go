@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"agent/proto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// Capabilities is the last DTPluginCapabilities advertised by the plugin
+type Capabilities struct {
+	DataTypes    []int32   `json:"data_types"`
+	TaskTypes    []int32   `json:"task_types"`
+	Features     []string  `json:"features"`
+	ConfigSchema string    `json:"config_schema,omitempty"`
+	AdvertisedAt time.Time `json:"advertised_at"`
+}
+
+// Supports reports whether the feature is advertised
+func (c *Capabilities) Supports(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCapabilities keeps the capabilities advertised, and forwards them
+// for the server to validate the tasks and the configs of the plugin. The
+// data types out of known_types are listed in unknown_types, if it's set.
+func (p *Plugin) handleCapabilities(rec *proto.Record, now time.Time) bool {
+	if rec.GetDataType() != config.DTPluginCapabilities {
+		return false
+	}
+	fields := rec.GetData().GetFields()
+	caps := &Capabilities{
+		DataTypes:    parseTypes(fields["data_types"]),
+		TaskTypes:    parseTypes(fields["task_types"]),
+		ConfigSchema: fields["config_schema"],
+		AdvertisedAt: now,
+	}
+	if features := fields["features"]; features != "" {
+		caps.Features = strings.Split(features, ",")
+	}
+	p.capabilities.Store(caps)
+	p.logger.Infof("capabilities advertised, data types %v, task types %v, features %v",
+		caps.DataTypes, caps.TaskTypes, caps.Features)
+	if p.types != nil {
+		var unknown []string
+		for _, dt := range caps.DataTypes {
+			if _, ok := p.types.known[dt]; !ok {
+				unknown = append(unknown, strconv.Itoa(int(dt)))
+			}
+		}
+		if len(unknown) != 0 {
+			p.logger.Warnf("data types %v are out of known_types", unknown)
+			fields["unknown_types"] = strings.Join(unknown, ",")
+		}
+	}
+	p.correctClock(rec)
+	p.tagInstance(rec)
+	rec.Plugin = p.Name()
+	p.transmitter.Transmission(rec, true)
+	return true
+}
+
+// Capabilities returns the ones advertised, ok is false if the plugin never
+// does, as the one built with an older SDK
+func (p *Plugin) Capabilities() (caps *Capabilities, ok bool) {
+	caps, ok = p.capabilities.Load().(*Capabilities)
+	return
+}
+
+// parseTypes parses the data types joined by commas, the invalid ones are
+// skipped
+func parseTypes(s string) (types []int32) {
+	for _, field := range strings.Split(s, ",") {
+		if dt, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32); err == nil {
+			types = append(types, int32(dt))
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return
+}
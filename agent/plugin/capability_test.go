@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"agent/proto"
+	"reflect"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestCapabilities(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "collector", KnownTypes: []int32{3000}})
+	p.transmitter = transmitter
+	p.types = newTypePolicy(&p.config)
+	if _, ok := p.Capabilities(); ok {
+		t.Fatal("capabilities before any is advertised")
+	}
+	p.transmitRecord(nil, &proto.Record{
+		DataType: config.DTPluginCapabilities,
+		Data: &proto.Payload{Fields: map[string]string{
+			"data_types":    "3001,3000,x",
+			"task_types":    "",
+			"features":      "framing_v2,task_cancel",
+			"config_schema": `{"type":"object"}`,
+		}},
+	})
+	caps, ok := p.Capabilities()
+	if !ok {
+		t.Fatal("capabilities are not kept")
+	}
+	if !reflect.DeepEqual(caps.DataTypes, []int32{3000, 3001}) || len(caps.TaskTypes) != 0 ||
+		caps.ConfigSchema != `{"type":"object"}` || !caps.Supports(config.FeatureTaskCancel) || caps.Supports(config.FeatureRing) {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	select {
+	case rec := <-transmitter.plugin:
+		if rec.Plugin != "collector" || rec.Data.Fields["unknown_types"] != "3001" {
+			t.Fatalf("unexpected record forwarded: %v", rec)
+		}
+	default:
+		t.Fatal("capabilities are not forwarded")
+	}
+}
@@ -0,0 +1,155 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// it's replaced in tests
+var cgroupFs = "/sys/fs/cgroup"
+
+// plugins are placed in <cgroupFs>/hades-plugin/<name> with cgroup v2, and in
+// <cgroupFs>/<controller>/hades-plugin/<name> with cgroup v1. It's out of the
+// cgroup of agent, so the limits of agent and plugins are independent.
+const cgroupParent = "hades-plugin"
+
+// period of the cpu quota, in microseconds
+const cpuPeriod = 100000
+
+// pluginCgroup is the dedicated cgroup of a plugin, one directory for each
+// controller with cgroup v1
+type pluginCgroup struct {
+	dirs []string
+}
+
+// needCgroup reports whether any resource limit is set by config
+func needCgroup(config *proto.Config) bool {
+	return config.GetCpuLimit() > 0 || config.GetMemoryLimit() > 0
+}
+
+func isCgroupV2() bool {
+	_, err := os.Stat(filepath.Join(cgroupFs, "cgroup.controllers"))
+	return err == nil
+}
+
+// newCgroup creates the cgroup of the plugin with the limits. The plugin is
+// moved in by add once it's started.
+func newCgroup(name string, config *proto.Config) (cg *pluginCgroup, err error) {
+	cg = &pluginCgroup{}
+	if isCgroupV2() {
+		err = cg.setupV2(name, config)
+	} else {
+		err = cg.setupV1(name, config)
+	}
+	if err != nil {
+		cg.remove()
+		cg = nil
+	}
+	return
+}
+
+func (cg *pluginCgroup) setupV2(name string, config *proto.Config) (err error) {
+	parent := filepath.Join(cgroupFs, cgroupParent)
+	if err = os.MkdirAll(parent, 0o755); err != nil {
+		return
+	}
+	var controllers []string
+	if config.GetCpuLimit() > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if config.GetMemoryLimit() > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if err = writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+		return
+	}
+	dir := filepath.Join(parent, name)
+	if err = cg.mkdir(dir); err != nil {
+		return
+	}
+	if limit := config.GetCpuLimit(); limit > 0 {
+		if err = writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", cpuQuota(limit), cpuPeriod)); err != nil {
+			return
+		}
+	}
+	if limit := config.GetMemoryLimit(); limit > 0 {
+		if err = writeCgroupFile(dir, "memory.max", strconv.FormatInt(limit, 10)); err != nil {
+			return
+		}
+		oomGroup := "0"
+		if config.GetKillOnOom() {
+			oomGroup = "1"
+		}
+		err = writeCgroupFile(dir, "memory.oom.group", oomGroup)
+	}
+	return
+}
+
+// setupV1 has no group kill, the kernel OOM killer picks a single process
+// in the cgroup whether kill_on_oom is set or not
+func (cg *pluginCgroup) setupV1(name string, config *proto.Config) (err error) {
+	if limit := config.GetCpuLimit(); limit > 0 {
+		dir := filepath.Join(cgroupFs, "cpu", cgroupParent, name)
+		if err = cg.mkdir(dir); err != nil {
+			return
+		}
+		if err = writeCgroupFile(dir, "cpu.cfs_period_us", strconv.Itoa(cpuPeriod)); err != nil {
+			return
+		}
+		if err = writeCgroupFile(dir, "cpu.cfs_quota_us", strconv.FormatInt(cpuQuota(limit), 10)); err != nil {
+			return
+		}
+	}
+	if limit := config.GetMemoryLimit(); limit > 0 {
+		dir := filepath.Join(cgroupFs, "memory", cgroupParent, name)
+		if err = cg.mkdir(dir); err != nil {
+			return
+		}
+		err = writeCgroupFile(dir, "memory.limit_in_bytes", strconv.FormatInt(limit, 10))
+	}
+	return
+}
+
+func cpuQuota(percent int32) int64 {
+	return int64(percent) * cpuPeriod / 100
+}
+
+// mkdir creates the cgroup, one left by the last run is reused
+func (cg *pluginCgroup) mkdir(dir string) (err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	cg.dirs = append(cg.dirs, dir)
+	return
+}
+
+// add moves the process into the cgroup
+func (cg *pluginCgroup) add(pid int) (err error) {
+	for _, dir := range cg.dirs {
+		if err = writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// remove deletes the cgroup, it fails if any process is still in it
+func (cg *pluginCgroup) remove() (err error) {
+	for _, dir := range cg.dirs {
+		if rerr := os.Remove(dir); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			err = rerr
+		}
+	}
+	return
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	return os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644)
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"agent/proto"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeCgroupFs replaces the cgroup mount by a temp dir, the layout of v2 if
+// v2 is set
+func fakeCgroupFs(t *testing.T, v2 bool) {
+	old := cgroupFs
+	cgroupFs = t.TempDir()
+	t.Cleanup(func() { cgroupFs = old })
+	if v2 {
+		if err := os.WriteFile(filepath.Join(cgroupFs, "cgroup.controllers"), []byte("cpu memory"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectCgroupFile(t *testing.T, expected string, elem ...string) {
+	content, err := os.ReadFile(filepath.Join(append([]string{cgroupFs}, elem...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("%v: %q, expect %q", elem, content, expected)
+	}
+}
+
+func TestCgroupV2(t *testing.T) {
+	fakeCgroupFs(t, true)
+	cg, err := newCgroup("test", &proto.Config{CpuLimit: 10, MemoryLimit: 104857600, KillOnOom: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cg.add(42); err != nil {
+		t.Fatal(err)
+	}
+	expectCgroupFile(t, "+cpu +memory", cgroupParent, "cgroup.subtree_control")
+	expectCgroupFile(t, "10000 100000", cgroupParent, "test", "cpu.max")
+	expectCgroupFile(t, "104857600", cgroupParent, "test", "memory.max")
+	expectCgroupFile(t, "1", cgroupParent, "test", "memory.oom.group")
+	expectCgroupFile(t, "42", cgroupParent, "test", "cgroup.procs")
+}
+
+func TestCgroupV1(t *testing.T) {
+	fakeCgroupFs(t, false)
+	cg, err := newCgroup("test", &proto.Config{CpuLimit: 150, MemoryLimit: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cg.add(42); err != nil {
+		t.Fatal(err)
+	}
+	expectCgroupFile(t, "100000", "cpu", cgroupParent, "test", "cpu.cfs_period_us")
+	expectCgroupFile(t, "150000", "cpu", cgroupParent, "test", "cpu.cfs_quota_us")
+	expectCgroupFile(t, "42", "cpu", cgroupParent, "test", "cgroup.procs")
+	expectCgroupFile(t, "1024", "memory", cgroupParent, "test", "memory.limit_in_bytes")
+	expectCgroupFile(t, "42", "memory", cgroupParent, "test", "cgroup.procs")
+}
+
+func TestCgroupMemoryOnly(t *testing.T) {
+	fakeCgroupFs(t, false)
+	if needCgroup(&proto.Config{KillOnOom: true}) {
+		t.Fatal("cgroup without limits")
+	}
+	cg, err := newCgroup("test", &proto.Config{MemoryLimit: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cg.dirs) != 1 {
+		t.Fatalf("unexpected cgroups: %v", cg.dirs)
+	}
+	if _, err := os.Stat(filepath.Join(cgroupFs, "cpu", cgroupParent, "test")); !os.IsNotExist(err) {
+		t.Fatalf("cpu cgroup is created: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build windows
+
+package plugin
+
+import (
+	"agent/proto"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// flags and the layout of JOBOBJECT_CPU_RATE_CONTROL_INFORMATION, which are
+// not in x/sys yet
+const (
+	jobCpuRateControlEnable  = 0x1
+	jobCpuRateControlHardCap = 0x4
+)
+
+type jobCpuRateControl struct {
+	controlFlags uint32
+	cpuRate      uint32
+}
+
+// pluginCgroup is the job object of a plugin on Windows. All the processes
+// of the plugin are in it, so they're killed together, and the limits apply
+// to them as a whole. The memory limit fails the allocations above it, the
+// plugin is not killed whether kill_on_oom is set or not.
+type pluginCgroup struct {
+	job windows.Handle
+}
+
+// needCgroup is always true on Windows, since there is no process group and
+// the job object is the only way to kill the children of the plugin
+func needCgroup(config *proto.Config) bool { return true }
+
+// newCgroup creates the job object of the plugin with the limits. The plugin
+// is assigned by add once it's started, the children it creates later are
+// in the job as well.
+func newCgroup(name string, config *proto.Config) (cg *pluginCgroup, err error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return
+	}
+	cg = &pluginCgroup{job: job}
+	defer func() {
+		if err != nil {
+			cg.remove()
+			cg = nil
+		}
+	}()
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	// the processes left are killed once the handle is closed by remove
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if limit := config.GetMemoryLimit(); limit > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limit)
+	}
+	if _, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		return
+	}
+	if limit := config.GetCpuLimit(); limit > 0 {
+		rate := jobCpuRateControl{
+			controlFlags: jobCpuRateControlEnable | jobCpuRateControlHardCap,
+			cpuRate:      cpuRate(limit),
+		}
+		_, err = windows.SetInformationJobObject(job, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&rate)), uint32(unsafe.Sizeof(rate)))
+	}
+	return
+}
+
+// cpuRate converts the percent of a single cpu to the rate of the job, in
+// 1/100 percent of all the cpus
+func cpuRate(percent int32) uint32 {
+	rate := int(percent) * 100 / runtime.NumCPU()
+	if rate < 1 {
+		rate = 1
+	}
+	if rate > 10000 {
+		rate = 10000
+	}
+	return uint32(rate)
+}
+
+// add assigns the process to the job
+func (cg *pluginCgroup) add(pid int) (err error) {
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(process)
+	return windows.AssignProcessToJobObject(cg.job, process)
+}
+
+// kill terminates all the processes in the job
+func (cg *pluginCgroup) kill() error { return windows.TerminateJobObject(cg.job, 1) }
+
+// remove closes the job, the processes left in it are killed
+func (cg *pluginCgroup) remove() (err error) {
+	return windows.CloseHandle(cg.job)
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"os"
+	"path"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// checkpointPath is where the last offset of the plugin is kept. It's
+// removed along with the working directory when the plugin is removed.
+func (p *Plugin) checkpointPath() string {
+	return path.Join(p.workdir, p.Name()+".checkpoint")
+}
+
+// handleCheckpoint persists the offset checkpointed by the plugin, it's not
+// forwarded
+func (p *Plugin) handleCheckpoint(rec *proto.Record) bool {
+	if rec.GetDataType() != config.DTPluginCheckpoint {
+		return false
+	}
+	if err := p.saveCheckpoint(rec.GetData().GetFields()["offset"]); err != nil {
+		p.logger.Warn("save checkpoint failed: ", err)
+	}
+	return true
+}
+
+// saveCheckpoint replaces the file by rename, so a crash in the middle never
+// leaves a partial offset
+func (p *Plugin) saveCheckpoint(offset string) (err error) {
+	tmp := p.checkpointPath() + ".tmp"
+	if err = os.WriteFile(tmp, []byte(offset), 0o600); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, p.checkpointPath()); err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
+// restoreCheckpoint writes the last offset as the first task of the plugin,
+// nothing is sent if the plugin never checkpoints
+func (p *Plugin) restoreCheckpoint() (err error) {
+	var offset []byte
+	if offset, err = os.ReadFile(p.checkpointPath()); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	task := proto.Task{
+		DataType:   config.TaskCheckpointRestore,
+		ObjectName: p.Name(),
+		Data:       string(offset),
+	}
+	var dst []byte
+	if dst, err = p.encodeTask(&task); err != nil {
+		return
+	}
+	var n int
+	if n, err = p.writeTask(dst); err != nil {
+		return
+	}
+	atomic.AddUint64(&p.txCnt, 1)
+	atomic.AddUint64(&p.txBytes, uint64(n))
+	return
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chriskaliX/SDK/framing"
+	"github.com/chriskaliX/SDK/transport"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// the first run checkpoints and crashes, the restarted one saves the
+	// tasks it receives
+	config := writeTestPluginAt(t, m.Workdir, "offset", `if [ -f restarted ]; then exec cat <&3 >tasks; fi
+touch restarted
+cat checkpoint >&4
+exit 1`)
+	dir := filepath.Join(m.Workdir, "plugin", "offset")
+	offset := []byte("inode=42,pos=\x00\x80")
+	buf, err := framing.Encode(transport.CheckpointRecord(offset), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "checkpoint"), buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	var tasks []byte
+	waitFor(t, "checkpoint is not restored", func() bool {
+		tasks, _ = os.ReadFile(filepath.Join(dir, "tasks"))
+		return len(tasks) > 0
+	})
+	payload, err := framing.ReadFrame(bytes.NewReader(tasks), maxRecordSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &transport.Task{}
+	if err := task.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := transport.CheckpointOffset(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, offset) {
+		t.Fatalf("offset %q is restored as %q", offset, restored)
+	}
+	select {
+	case rec := <-transmitter.plugin:
+		t.Fatalf("checkpoint is forwarded: %v", rec)
+	default:
+	}
+}
+
+func TestNoCheckpoint(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.workdir = t.TempDir()
+	if err := p.restoreCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+}
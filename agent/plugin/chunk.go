@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"agent/proto"
+	"agent/transport/pool"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// maxChunkedSize bounds a record reassembled from chunks, the chunks of a
+// larger one are dropped. The record is sent in a single message, which is
+// refused by the 4MB receive limit of the grpc server beyond it, and is
+// below the largest record of the spool as well. The headroom is for the
+// fields and the rest of the message.
+var maxChunkedSize = 4*1024*1024 - 64*1024
+
+// chunkedRecord is the record in reassembly. The chunks of a record are
+// written in a single write by the SDK, so they come in order and never
+// interleave with others.
+type chunkedRecord struct {
+	mu    sync.Mutex
+	id    string
+	next  int
+	total int
+	data  []byte
+}
+
+// offerChunking offers the chunk size to the plugin, which is the largest
+// record read in place by the reader of the size
+func offerChunking(cmd *exec.Cmd, readBufferSize int) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	size := readBufferSize - framing.HeaderSize(framing.V2)
+	cmd.Env = append(cmd.Env, config.ChunkSizeEnv+"="+strconv.Itoa(size))
+}
+
+// ChunkStats returns the records reassembled from chunks, and the chunks
+// dropped for the ones missing, out of order or too large
+func (p *Plugin) ChunkStats() (assembled, dropped uint64) {
+	return atomic.LoadUint64(&p.chunkedRecords), atomic.LoadUint64(&p.droppedChunks)
+}
+
+// handleChunk returns the record as it is unless it's a chunk. A chunk is
+// collected, and the record is returned once all of its chunks are
+// collected, nil before that or if it's dropped.
+func (p *Plugin) handleChunk(rec *proto.Record) *proto.Record {
+	if rec.GetDataType() != config.DTPluginChunk {
+		return rec
+	}
+	fields := rec.GetData().GetFields()
+	seq, err := strconv.Atoi(fields["seq"])
+	if err != nil {
+		atomic.AddUint64(&p.droppedChunks, 1)
+		return nil
+	}
+	total, err := strconv.Atoi(fields["total"])
+	if err != nil || total <= 0 {
+		atomic.AddUint64(&p.droppedChunks, 1)
+		return nil
+	}
+	c := &p.chunked
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seq == 0 {
+		// the one in reassembly misses the rest
+		p.dropChunked(c.next)
+		c.id, c.next, c.total, c.data = fields["id"], 0, total, c.data[:0]
+	}
+	if c.id != fields["id"] || c.next != seq || c.total != total {
+		atomic.AddUint64(&p.droppedChunks, 1)
+		return nil
+	}
+	data := fields["data"]
+	if len(c.data)+len(data) > maxChunkedSize {
+		p.dropChunked(c.next + 1)
+		return nil
+	}
+	c.data = append(c.data, data...)
+	if c.next++; c.next < c.total {
+		return nil
+	}
+	assembled := pool.Get()
+	err = assembled.Unmarshal(c.data)
+	p.resetChunked()
+	if err != nil {
+		pool.Put(assembled)
+		atomic.AddUint64(&p.droppedChunks, uint64(total))
+		p.logger.Error("unmarshal the chunked record: ", err)
+		return nil
+	}
+	atomic.AddUint64(&p.chunkedRecords, 1)
+	return assembled
+}
+
+// dropChunked drops the record in reassembly with the chunks of it
+// collected, mu must be held
+func (p *Plugin) dropChunked(chunks int) {
+	if chunks != 0 {
+		atomic.AddUint64(&p.droppedChunks, uint64(chunks))
+	}
+	p.resetChunked()
+}
+
+// resetChunked releases the data in reassembly, a large one is not kept for
+// the next record
+func (p *Plugin) resetChunked() {
+	c := &p.chunked
+	c.id, c.next, c.total = "", 0, 0
+	if cap(c.data) > defaultReadBufferSize {
+		c.data = nil
+	} else {
+		c.data = c.data[:0]
+	}
+}
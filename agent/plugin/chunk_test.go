@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"agent/proto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// chunks splits the record as the SDK does
+func chunks(t *testing.T, id string, rec *proto.Record, size int) (recs []*proto.Record) {
+	data, err := rec.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := (len(data) + size - 1) / size
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		recs = append(recs, &proto.Record{DataType: config.DTPluginChunk, Data: &proto.Payload{Fields: map[string]string{
+			"id": id, "seq": strconv.Itoa(seq), "total": strconv.Itoa(total), "data": string(data[seq*size : end]),
+		}}})
+	}
+	return
+}
+
+func TestChunk(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.transmitter = transmitter
+	large := &proto.Record{DataType: 1000, Data: &proto.Payload{Fields: map[string]string{"content": strings.Repeat("x", 5000)}}}
+	first := chunks(t, "1", large, 1024)
+	second := chunks(t, "2", large, 1024)
+	third := chunks(t, "3", large, 1024)
+	// the first misses the last chunk, the second is complete, and the
+	// third misses the one in the middle
+	for _, rec := range append(append(first[:len(first)-1], second...), append(third[:2], third[3:]...)...) {
+		p.transmitRecord(nil, rec)
+	}
+	if len(transmitter.plugin) != 1 {
+		t.Fatalf("unexpected records: %d", len(transmitter.plugin))
+	}
+	rec := <-transmitter.plugin
+	if rec.DataType != 1000 || rec.Data.Fields["content"] != large.Data.Fields["content"] || rec.Plugin != "test" {
+		t.Fatalf("unexpected record: %d of %s", rec.DataType, rec.Plugin)
+	}
+	// the collected ones of the first, and the ones after the missing one
+	// of the third
+	if assembled, dropped := p.ChunkStats(); assembled != 1 || dropped != uint64(len(first)-1+len(third)-3) {
+		t.Fatalf("unexpected chunk stats: %d, %d", assembled, dropped)
+	}
+}
+
+func TestChunkTooLarge(t *testing.T) {
+	defer func(size int) { maxChunkedSize = size }(maxChunkedSize)
+	maxChunkedSize = 2048
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.transmitter = transmitter
+	large := &proto.Record{DataType: 1000, Data: &proto.Payload{Fields: map[string]string{"content": strings.Repeat("x", 5000)}}}
+	for _, rec := range chunks(t, "1", large, 1024) {
+		p.transmitRecord(nil, rec)
+	}
+	if _, dropped := p.ChunkStats(); len(transmitter.plugin) != 0 || dropped != 5 {
+		t.Fatalf("too large record is not dropped: %d", dropped)
+	}
+}
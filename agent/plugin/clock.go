@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// samples with longer round trip are dropped, since the offset is only
+// accurate within half of the round trip
+const maxClockRTT = time.Second
+
+var errClockRTT = errors.New("clock sync round trip is too long")
+
+// SyncClock sends the clock of agent to the plugin, the offset is measured
+// once the reply is received
+func (p *Plugin) SyncClock() error {
+	return p.SendTask(proto.Task{
+		DataType:   config.TaskClockSync,
+		ObjectName: p.Name(),
+		Data:       strconv.FormatInt(time.Now().UnixNano(), 10),
+	})
+}
+
+// ClockOffset returns how far the plugin clock is ahead of the agent, ok is
+// false if it's never measured
+func (p *Plugin) ClockOffset() (offset time.Duration, ok bool) {
+	if atomic.LoadInt32(&p.clockSynced) == 0 {
+		return 0, false
+	}
+	return time.Duration(atomic.LoadInt64(&p.clockOffset)), true
+}
+
+// handleClock consumes the reply of SyncClock, it's not forwarded
+func (p *Plugin) handleClock(rec *proto.Record, now time.Time) bool {
+	if rec.GetDataType() != config.DTPluginClock {
+		return false
+	}
+	if err := p.measureClock(rec.GetData().GetFields(), now); err != nil {
+		p.logger.Warn("clock sync failed: ", err)
+	}
+	return true
+}
+
+func (p *Plugin) measureClock(fields map[string]string, now time.Time) (err error) {
+	var sent, remote int64
+	if sent, err = strconv.ParseInt(fields["agent_ts"], 10, 64); err != nil {
+		return
+	}
+	if remote, err = strconv.ParseInt(fields["plugin_ts"], 10, 64); err != nil {
+		return
+	}
+	received := now.UnixNano()
+	if rtt := received - sent; rtt < 0 || rtt > int64(maxClockRTT) {
+		return errClockRTT
+	}
+	// the plugin reads its clock at the middle of the round trip
+	atomic.StoreInt64(&p.clockOffset, remote-(sent+(received-sent)/2))
+	atomic.StoreInt32(&p.clockSynced, 1)
+	return
+}
+
+// correctClock shifts the timestamp by the offset if correction is enabled,
+// timestamps are in seconds so a smaller offset is ignored
+func (p *Plugin) correctClock(rec *proto.Record) {
+	if !p.config.GetClockCorrection() {
+		return
+	}
+	if offset, ok := p.ClockOffset(); ok {
+		rec.Timestamp -= int64(offset.Round(time.Second) / time.Second)
+	}
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"agent/proto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// fakePluginClock replies the clock sync task with a clock ahead by offset
+func fakePluginClock(t *testing.T, p *Plugin, offset time.Duration) *proto.Record {
+	if err := p.SyncClock(); err != nil {
+		t.Fatal(err)
+	}
+	entry, _, _ := p.tasks.pop(time.Now())
+	if entry == nil || entry.Task.DataType != config.TaskClockSync {
+		t.Fatalf("unexpected task: %v", entry)
+	}
+	p.tasks.done(entry)
+	return &proto.Record{
+		DataType: config.DTPluginClock,
+		Data: &proto.Payload{Fields: map[string]string{
+			"agent_ts":  entry.Task.Data,
+			"plugin_ts": strconv.FormatInt(time.Now().Add(offset).UnixNano(), 10),
+		}},
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	target := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "test", ClockCorrection: true})
+	p.transmitter = target
+	if _, ok := p.ClockOffset(); ok {
+		t.Fatal("offset is valid before sync")
+	}
+	reply := fakePluginClock(t, p, 10*time.Second)
+	now := time.Now().Unix()
+	p.transmit([]*proto.Record{reply, {DataType: 1000, Timestamp: now + 10}})
+	offset, ok := p.ClockOffset()
+	if !ok || offset < 10*time.Second-100*time.Millisecond || offset > 10*time.Second+100*time.Millisecond {
+		t.Fatalf("unexpected offset: %s, %v", offset, ok)
+	}
+	// the reply is consumed, and the next record is corrected
+	select {
+	case rec := <-target.plugin:
+		if rec.DataType != 1000 || rec.Timestamp != now {
+			t.Fatalf("unexpected record: %v", rec)
+		}
+	default:
+		t.Fatal("record is not transmitted")
+	}
+	if len(target.plugin) != 0 {
+		t.Fatal("clock reply is forwarded")
+	}
+}
+
+func TestClockCorrectionDisabled(t *testing.T) {
+	target := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.transmitter = target
+	if err := p.measureClock(map[string]string{
+		"agent_ts":  strconv.FormatInt(time.Now().UnixNano(), 10),
+		"plugin_ts": strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano(), 10),
+	}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _ := p.ClockOffset(); offset > -time.Hour+time.Second || offset < -time.Hour-time.Second {
+		t.Fatalf("unexpected offset: %s", offset)
+	}
+	p.transmit([]*proto.Record{{DataType: 1000, Timestamp: 1}})
+	if rec := <-target.plugin; rec.Timestamp != 1 {
+		t.Fatalf("timestamp is corrected without opt-in: %v", rec)
+	}
+	// stale reply is dropped
+	if err := p.measureClock(map[string]string{
+		"agent_ts":  strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano(), 10),
+		"plugin_ts": "0",
+	}, time.Now()); err != errClockRTT {
+		t.Fatalf("expect round trip error, got %v", err)
+	}
+}
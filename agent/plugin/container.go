@@ -0,0 +1,225 @@
+package plugin
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Processes are resolved to the container by the cgroup, which is cached
+// for pidCacheTTL since pids are reused. The metadata of a container is
+// cached for containerCacheTTL. At most maxCachedPids and maxCachedContainers
+// are cached, the records of the others are enriched without the cache.
+const (
+	pidCacheTTL         = 30 * time.Second
+	containerCacheTTL   = 10 * time.Minute
+	maxCachedPids       = 8192
+	maxCachedContainers = 1024
+)
+
+// Directories of the container configs of the runtimes, replaced in tests.
+// The OCI config of containerd and cri-o has the kubernetes annotations, and
+// the docker one has the image and the labels.
+var (
+	dockerRoot     = "/var/lib/docker/containers"
+	containerdRoot = "/run/containerd/io.containerd.runtime.v2.task"
+	crioRoot       = "/run/containers/storage/overlay-containers"
+)
+
+var (
+	containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+	// pod<uid> of cgroupfs, or pod<uid with _> of the systemd driver
+	podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// containerInfo is the workload a process runs in, empty for the host
+type containerInfo struct {
+	ID        string
+	Image     string
+	PodName   string
+	Namespace string
+	PodUID    string
+}
+
+type cachedContainer struct {
+	info     *containerInfo
+	expireAt time.Time
+}
+
+// containerResolver is shared by all the plugins, the records of a process
+// are usually sent by more than one
+type containerResolver struct {
+	mu         sync.Mutex
+	pids       map[string]cachedContainer
+	containers map[string]cachedContainer
+}
+
+var containers = &containerResolver{
+	pids:       make(map[string]cachedContainer),
+	containers: make(map[string]cachedContainer),
+}
+
+// put drops the expired ones if the cache is full, and skips the new one if
+// it's still full. It's called with the lock held.
+func put(cache map[string]cachedContainer, limit int, key string, info *containerInfo, now time.Time, ttl time.Duration) {
+	if len(cache) >= limit {
+		for k, cached := range cache {
+			if now.After(cached.expireAt) {
+				delete(cache, k)
+			}
+		}
+		if len(cache) >= limit {
+			return
+		}
+	}
+	cache[key] = cachedContainer{info: info, expireAt: now.Add(ttl)}
+}
+
+// resolve returns the container of the process, nil if it runs on the host
+// or it's gone
+func (r *containerResolver) resolve(pid int, now time.Time) *containerInfo {
+	key := strconv.Itoa(pid)
+	r.mu.Lock()
+	if cached, ok := r.pids[key]; ok && now.Before(cached.expireAt) {
+		r.mu.Unlock()
+		return cached.info
+	}
+	r.mu.Unlock()
+	paths, err := readCgroups(pid)
+	if err != nil {
+		return nil
+	}
+	var id, podUID string
+	for _, path := range paths {
+		if matches := containerIDPattern.FindAllString(path, -1); len(matches) != 0 {
+			id = matches[len(matches)-1]
+		}
+		if match := podUIDPattern.FindStringSubmatch(path); match != nil {
+			podUID = strings.ReplaceAll(match[1], "_", "-")
+		}
+		if id != "" {
+			break
+		}
+	}
+	var info *containerInfo
+	if id != "" {
+		info = r.container(id, now)
+		if info.PodUID == "" && podUID != "" {
+			copied := *info
+			copied.PodUID = podUID
+			info = &copied
+		}
+	}
+	r.mu.Lock()
+	put(r.pids, maxCachedPids, key, info, now, pidCacheTTL)
+	r.mu.Unlock()
+	return info
+}
+
+// container returns the metadata of the container, only the id is known if
+// it's not found in any runtime
+func (r *containerResolver) container(id string, now time.Time) *containerInfo {
+	r.mu.Lock()
+	if cached, ok := r.containers[id]; ok && now.Before(cached.expireAt) {
+		r.mu.Unlock()
+		return cached.info
+	}
+	r.mu.Unlock()
+	info := &containerInfo{ID: id}
+	if !readDockerConfig(info) {
+		readOCIConfig(info)
+	}
+	r.mu.Lock()
+	put(r.containers, maxCachedContainers, id, info, now, containerCacheTTL)
+	r.mu.Unlock()
+	return info
+}
+
+func readDockerConfig(info *containerInfo) bool {
+	data, err := os.ReadFile(filepath.Join(dockerRoot, info.ID, "config.v2.json"))
+	if err != nil {
+		return false
+	}
+	config := struct {
+		Config struct {
+			Image  string
+			Labels map[string]string
+		}
+	}{}
+	if json.Unmarshal(data, &config) != nil {
+		return false
+	}
+	labels := config.Config.Labels
+	info.Image = config.Config.Image
+	info.PodName = labels["io.kubernetes.pod.name"]
+	info.Namespace = labels["io.kubernetes.pod.namespace"]
+	info.PodUID = labels["io.kubernetes.pod.uid"]
+	return true
+}
+
+func readOCIConfig(info *containerInfo) bool {
+	paths, _ := filepath.Glob(filepath.Join(containerdRoot, "*", info.ID, "config.json"))
+	paths = append(paths, filepath.Join(crioRoot, info.ID, "userdata", "config.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		config := struct {
+			Annotations map[string]string `json:"annotations"`
+		}{}
+		if json.Unmarshal(data, &config) != nil {
+			continue
+		}
+		annotations := config.Annotations
+		info.Image = firstOf(annotations, "io.kubernetes.cri.image-name", "io.kubernetes.cri-o.ImageName")
+		info.PodName = firstOf(annotations, "io.kubernetes.cri.sandbox-name", "io.kubernetes.pod.name")
+		info.Namespace = firstOf(annotations, "io.kubernetes.cri.sandbox-namespace", "io.kubernetes.pod.namespace")
+		info.PodUID = firstOf(annotations, "io.kubernetes.cri.sandbox-uid", "io.kubernetes.pod.uid")
+		return true
+	}
+	return false
+}
+
+func firstOf(m map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := m[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// enrichContainer attaches the workload of the process in the pid field to
+// the record. Fields already set by the plugin are kept.
+func (p *Plugin) enrichContainer(rec *proto.Record) {
+	if !p.config.GetEnrichContainer() {
+		return
+	}
+	fields := rec.GetData().GetFields()
+	pid, err := strconv.Atoi(fields["pid"])
+	if err != nil || pid <= 0 {
+		return
+	}
+	info := containers.resolve(pid, time.Now())
+	if info == nil {
+		return
+	}
+	for key, value := range map[string]string{
+		"container_id":    info.ID,
+		"container_image": info.Image,
+		"pod_name":        info.PodName,
+		"pod_namespace":   info.Namespace,
+		"pod_uid":         info.PodUID,
+	} {
+		if _, ok := fields[key]; !ok && value != "" {
+			fields[key] = value
+		}
+	}
+}
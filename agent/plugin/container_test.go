@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"agent/proto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnrichContainer(t *testing.T) {
+	dockerRoot, containerdRoot, crioRoot = t.TempDir(), t.TempDir(), t.TempDir()
+	t.Cleanup(func() {
+		dockerRoot = "/var/lib/docker/containers"
+		containerdRoot = "/run/containerd/io.containerd.runtime.v2.task"
+		crioRoot = "/run/containers/storage/overlay-containers"
+	})
+	containers = &containerResolver{pids: make(map[string]cachedContainer), containers: make(map[string]cachedContainer)}
+	id := strings.Repeat("ab", 32)
+	dir := filepath.Join(containerdRoot, "k8s.io", id)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"annotations": {
+		"io.kubernetes.cri.image-name": "nginx:1.23",
+		"io.kubernetes.cri.sandbox-name": "web-0",
+		"io.kubernetes.cri.sandbox-namespace": "prod"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fakeProc(t, 42, "0::/kubepods.slice/kubepods-pod1234abcd_5678_90ab_cdef_1234567890ab.slice/cri-containerd-"+id+".scope\n", nil)
+	os.MkdirAll(filepath.Join(procRoot, "43"), 0o700)
+	os.WriteFile(filepath.Join(procRoot, "43", "cgroup"), []byte("0::/user.slice/session-1.scope\n"), 0o600)
+
+	p := newTestPlugin(proto.Config{Name: "driver", EnrichContainer: true})
+	rec := &proto.Record{Data: &proto.Payload{Fields: map[string]string{"pid": "42", "pod_name": "set by plugin"}}}
+	p.enrichContainer(rec)
+	fields := rec.Data.Fields
+	if fields["container_id"] != id || fields["container_image"] != "nginx:1.23" || fields["pod_namespace"] != "prod" ||
+		fields["pod_uid"] != "1234abcd-5678-90ab-cdef-1234567890ab" {
+		t.Fatalf("record is not enriched: %v", fields)
+	}
+	if fields["pod_name"] != "set by plugin" {
+		t.Fatalf("field of the plugin is overwritten: %v", fields)
+	}
+	// host processes, missing and invalid pids are left alone
+	for _, pid := range []string{"43", "44", "-1", ""} {
+		rec = &proto.Record{Data: &proto.Payload{Fields: map[string]string{"pid": pid}}}
+		p.enrichContainer(rec)
+		if len(rec.Data.Fields) != 1 {
+			t.Fatalf("record of pid %q is enriched: %v", pid, rec.Data.Fields)
+		}
+	}
+	// the process is cached until the ttl
+	os.WriteFile(filepath.Join(procRoot, "42", "cgroup"), []byte("0::/user.slice\n"), 0o600)
+	if info := containers.resolve(42, time.Now()); info == nil || info.ID != id {
+		t.Fatalf("process is not cached: %v", info)
+	}
+	if info := containers.resolve(42, time.Now().Add(pidCacheTTL+time.Second)); info != nil {
+		t.Fatalf("process is cached after the ttl: %v", info)
+	}
+	// docker config
+	id = strings.Repeat("cd", 32)
+	os.MkdirAll(filepath.Join(dockerRoot, id), 0o700)
+	os.WriteFile(filepath.Join(dockerRoot, id, "config.v2.json"), []byte(`{"Config": {"Image": "redis",
+		"Labels": {"io.kubernetes.pod.name": "cache-0", "io.kubernetes.pod.namespace": "default"}}}`), 0o600)
+	if info := containers.container(id, time.Now()); info.Image != "redis" || info.PodName != "cache-0" || info.Namespace != "default" {
+		t.Fatalf("unexpected docker container: %v", info)
+	}
+	// not enabled
+	p = newTestPlugin(proto.Config{Name: "driver"})
+	rec = &proto.Record{Data: &proto.Payload{Fields: map[string]string{"pid": "42"}}}
+	p.enrichContainer(rec)
+	if len(rec.Data.Fields) != 1 {
+		t.Fatalf("record is enriched: %v", rec.Data.Fields)
+	}
+}
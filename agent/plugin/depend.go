@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errDependencyCycle = errors.New("plugin is in a dependency cycle")
+
+// how long the sync waits for the dependencies without dependency_timeout
+var defaultDependencyTimeout = 30 * time.Second
+
+// startWaves groups the configs by depends_on, each wave only depends on the
+// waves before it, and the order of configs is kept in a wave. Dependencies
+// out of the configs are left to waitDependencies, and the configs in a
+// dependency cycle, or depending on one, are returned in cyclic.
+func startWaves(cfgs []*proto.Config) (waves [][]*proto.Config, cyclic []*proto.Config) {
+	pending := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		pending[cfg.Name] = true
+	}
+	for len(cfgs) > 0 {
+		var wave, rest []*proto.Config
+		for _, cfg := range cfgs {
+			ready := true
+			for _, name := range cfg.GetDependsOn() {
+				if pending[name] && name != cfg.Name {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, cfg)
+			} else {
+				rest = append(rest, cfg)
+			}
+		}
+		if len(wave) == 0 {
+			return waves, rest
+		}
+		// removed after the wave is decided, so a wave never depends on
+		// itself
+		for _, cfg := range wave {
+			delete(pending, cfg.Name)
+		}
+		waves = append(waves, wave)
+		cfgs = rest
+	}
+	return
+}
+
+// waitDependencies blocks until all the dependencies of the config are
+// running and ready. A dependency failed in the same sync fails it at once.
+func (m *Manager) waitDependencies(ctx context.Context, cfg *proto.Config, failed map[string]error) error {
+	// a running plugin of the same version is not restarted anyway
+	if plg, ok := m.Get(cfg.Name); ok && plg.Version() == cfg.GetVersion() && !plg.IsExited() {
+		return nil
+	}
+	timeout := defaultDependencyTimeout
+	if t := cfg.GetDependencyTimeout(); t > 0 {
+		timeout = time.Duration(t) * time.Millisecond
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, name := range cfg.GetDependsOn() {
+		if name == cfg.Name {
+			continue
+		}
+		if err := failed[name]; err != nil {
+			return fmt.Errorf("dependency %s failed: %w", name, err)
+		}
+		plg, ok := m.Get(name)
+		if !ok || plg.IsExited() {
+			return fmt.Errorf("dependency %s is not running", name)
+		}
+		select {
+		case <-plg.readyCh:
+		case <-plg.done:
+			return fmt.Errorf("dependency %s exited", name)
+		case <-timer.C:
+			return fmt.Errorf("dependency %s is not ready in %s", name, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
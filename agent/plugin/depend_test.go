@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartWaves(t *testing.T) {
+	cfg := func(name string, deps ...string) *proto.Config {
+		return &proto.Config{Name: name, DependsOn: deps}
+	}
+	names := func(cfgs []*proto.Config) (s []string) {
+		for _, cfg := range cfgs {
+			s = append(s, cfg.Name)
+		}
+		return
+	}
+	waves, cyclic := startWaves([]*proto.Config{
+		cfg("ui", "app"),
+		cfg("app", "base", "running"),
+		cfg("base", "base"),
+		cfg("standalone"),
+		cfg("a", "b"),
+		cfg("b", "a"),
+		cfg("c", "a"),
+	})
+	expected := [][]string{{"base", "standalone"}, {"app"}, {"ui"}}
+	if len(waves) != len(expected) {
+		t.Fatalf("%d waves, expect %d", len(waves), len(expected))
+	}
+	for i, wave := range waves {
+		if got := names(wave); strings.Join(got, ",") != strings.Join(expected[i], ",") {
+			t.Fatalf("wave %d is %v, expect %v", i, got, expected[i])
+		}
+	}
+	if got := names(cyclic); strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("cyclic configs are %v", got)
+	}
+}
+
+func TestSyncDependencies(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// ready once the first record is sent
+	base := writeTestPluginAt(t, m.Workdir, "base", `sleep 0.3
+printf '\003\000\000\000\010\350\007' >&4
+exec cat <&3 >/dev/null`)
+	app := writeTestPluginAt(t, m.Workdir, "app", "exec cat <&3 >/dev/null")
+	app.DependsOn = []string{"base"}
+	// higher priority, it would be started first without depends_on
+	app.Priority = 1
+	// never ready
+	silent := writeTestPluginAt(t, m.Workdir, "silent", "exec cat <&3 >/dev/null")
+	late := writeTestPluginAt(t, m.Workdir, "late", "exec cat <&3 >/dev/null")
+	late.DependsOn = []string{"silent"}
+	late.DependencyTimeout = 100
+	orphan := writeTestPluginAt(t, m.Workdir, "orphan", "exec cat <&3 >/dev/null")
+	orphan.DependsOn = []string{"missing"}
+	result := m.syncPlugins(ctx, map[string]*proto.Config{
+		"base": &base, "app": &app, "silent": &silent, "late": &late, "orphan": &orphan,
+	})
+	if len(result.Loaded) != 3 || len(result.Failed) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.Failed["late"] == nil || result.Failed["orphan"] == nil {
+		t.Fatalf("plugins with dependencies not ready are loaded: %+v", result.Failed)
+	}
+	basePlg, _ := m.Get("base")
+	appPlg, _ := m.Get("app")
+	if !basePlg.IsReady() || appPlg.startAt.Sub(basePlg.startAt) < 300*time.Millisecond {
+		t.Fatal("app is started before base is ready")
+	}
+}
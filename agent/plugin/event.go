@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"agent/proto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// Plugin lifecycle events, reported with DTPluginEvent
+const (
+	EventSkipped = "skipped"
+	EventSynced  = "synced"
+	// the plugin is not in the expected cgroup or namespace
+	EventMisplaced = "misplaced"
+	// the plugin exits unexpectedly, with the tail of stderr if
+	// crash_log_lines is set
+	EventCrashed = "crashed"
+	// the plugin crashes too many times and is not restarted anymore
+	EventQuarantined = "quarantined"
+	// the plugin passes the startup probe
+	EventReady = "ready"
+	// the plugin doesn't pass the startup probe within startup_timeout
+	EventStartupTimeout = "startup_timeout"
+	// the plugin misses the heartbeat_timeout and is killed
+	EventUnresponsive = "unresponsive"
+	// the plugin is replaced by another version, see Manager.Upgrade
+	EventUpgraded = "upgraded"
+	// the workdir exceeds disk_quota after the cleanup, the plugin is shut
+	// down and quarantined
+	EventQuotaExceeded = "quota_exceeded"
+)
+
+func newEventRecord(event string, fields map[string]string) *proto.Record {
+	fields["event"] = event
+	return &proto.Record{
+		DataType:  config.DTPluginEvent,
+		Timestamp: time.Now().Unix(),
+		Data: &proto.Payload{
+			Fields: fields,
+		},
+	}
+}
+
+func (m *Manager) emitEvent(event string, fields map[string]string) {
+	m.Transmitter.TransmitAgent(newEventRecord(event, fields), false)
+}
+
+// emitSyncEvent reports the sync result, so the server knows whether the
+// pushed configs have taken effect
+func (m *Manager) emitSyncEvent(result *SyncResult) {
+	failed := make([]string, 0, len(result.Failed))
+	for name, err := range result.Failed {
+		failed = append(failed, name+":"+err.Error())
+	}
+	sort.Strings(failed)
+	m.emitEvent(EventSynced, map[string]string{
+		"loaded":  strings.Join(result.Loaded, ","),
+		"running": strings.Join(result.Running, ","),
+		"skipped": strings.Join(result.Skipped, ","),
+		"removed": strings.Join(result.Removed, ","),
+		"failed":  strings.Join(failed, ","),
+	})
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"agent/proto"
+)
+
+// fieldFilter strips fields of records before they leave the host. Only one
+// mode works at a time, allowlist takes precedence over denylist.
+type fieldFilter struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// newFieldFilter returns nil if no policy is configured, so that the
+// receive path skips it without any lookup
+func newFieldFilter(config *proto.Config) *fieldFilter {
+	if len(config.GetFieldAllowlist()) > 0 {
+		return &fieldFilter{allow: toSet(config.GetFieldAllowlist())}
+	}
+	if len(config.GetFieldDenylist()) > 0 {
+		return &fieldFilter{deny: toSet(config.GetFieldDenylist())}
+	}
+	return nil
+}
+
+func toSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+	return set
+}
+
+// Apply removes the fields in place. The record is still unmarshaled at this
+// point, so no extra marshal is needed.
+func (f *fieldFilter) Apply(rec *proto.Record) {
+	if f == nil || rec.GetData() == nil {
+		return
+	}
+	fields := rec.Data.Fields
+	if f.allow != nil {
+		for key := range fields {
+			if _, ok := f.allow[key]; !ok {
+				delete(fields, key)
+			}
+		}
+		return
+	}
+	for key := range f.deny {
+		delete(fields, key)
+	}
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"agent/proto"
+	"reflect"
+	"testing"
+)
+
+func newFilterRecord() *proto.Record {
+	return &proto.Record{
+		DataType: 1000,
+		Data: &proto.Payload{Fields: map[string]string{
+			"exe":  "/bin/bash",
+			"argv": "bash -c secret",
+			"env":  "TOKEN=secret",
+		}},
+	}
+}
+
+func TestFieldAllowlist(t *testing.T) {
+	f := newFieldFilter(&proto.Config{
+		FieldAllowlist: []string{"exe", "pid"},
+		FieldDenylist:  []string{"exe"},
+	})
+	rec := newFilterRecord()
+	f.Apply(rec)
+	if want := map[string]string{"exe": "/bin/bash"}; !reflect.DeepEqual(rec.Data.Fields, want) {
+		t.Fatalf("fields: %v, want: %v", rec.Data.Fields, want)
+	}
+}
+
+func TestFieldDenylist(t *testing.T) {
+	f := newFieldFilter(&proto.Config{FieldDenylist: []string{"argv", "env"}})
+	rec := newFilterRecord()
+	f.Apply(rec)
+	if want := map[string]string{"exe": "/bin/bash"}; !reflect.DeepEqual(rec.Data.Fields, want) {
+		t.Fatalf("fields: %v, want: %v", rec.Data.Fields, want)
+	}
+}
+
+func TestFieldFilterReload(t *testing.T) {
+	p := &Plugin{}
+	p.SetFieldFilter(&proto.Config{FieldDenylist: []string{"env"}})
+	rec := newFilterRecord()
+	p.filter.Load().(*fieldFilter).Apply(rec)
+	if len(rec.Data.Fields) != 2 {
+		t.Fatalf("fields: %v", rec.Data.Fields)
+	}
+	// no policy, all fields pass
+	p.SetFieldFilter(&proto.Config{})
+	rec = newFilterRecord()
+	p.filter.Load().(*fieldFilter).Apply(rec)
+	if len(rec.Data.Fields) != 3 {
+		t.Fatalf("fields: %v", rec.Data.Fields)
+	}
+	// nil payload is skipped
+	p.filter.Load().(*fieldFilter).Apply(&proto.Record{})
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// offerFraming offers framing.V2 to the plugin, the plugin of an older SDK
+// ignores it and keeps the plain frames
+func offerFraming(cmd *exec.Cmd) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, config.FramingEnv+"=2")
+}
+
+// FramingV2 reports whether the plugin switched to framing.V2
+func (p *Plugin) FramingV2() bool { return atomic.LoadInt32(&p.framingV2) == 1 }
+
+// CorruptedFrames returns the frames skipped for corruption, and the bytes
+// discarded to resync
+func (p *Plugin) CorruptedFrames() (frames, discarded uint64) {
+	return atomic.LoadUint64(&p.corruptedFrames), atomic.LoadUint64(&p.discardedBytes)
+}
+
+// recordFraming returns the framing of records, nil for the plain one
+func (p *Plugin) recordFraming() *framing.Options {
+	if p.FramingV2() {
+		return framing.V2
+	}
+	return nil
+}
+
+// encodeTask encodes the task in V2 once the plugin is known to read it
+func (p *Plugin) encodeTask(t *proto.Task) ([]byte, error) {
+	return framing.Encode(t, p.recordFraming())
+}
+
+// nextRecordFrame returns the payload of next record. The plugin switches to
+// V2 by the first frame, which is empty and skipped. In V2, a corrupted
+// frame is skipped and the stream is resynced to the next magic, rather
+// than feeding the garbage to Unmarshal.
+func (p *Plugin) nextRecordFrame(r *bufio.Reader, buf *[]byte) ([]byte, error) {
+	for {
+		if !p.FramingV2() {
+			prefix, err := r.Peek(framing.PrefixSize)
+			if err != nil {
+				return nil, truncated(r, err)
+			}
+			if !framing.IsV2(prefix) {
+				return nextFrame(r, buf, maxRecordSize, nil)
+			}
+			if atomic.CompareAndSwapInt32(&p.framingV2, 0, 1) {
+				p.logger.Info("records are received in framing v2")
+			}
+		}
+		payload, err := nextFrame(r, buf, maxRecordSize, framing.V2)
+		switch {
+		case err == nil && len(payload) == 0:
+			continue
+		case errors.Is(err, framing.ErrBadMagic) || errors.Is(err, framing.ErrBadVersion) ||
+			errors.Is(err, framing.ErrFrameTooLarge):
+			// the header is not consumed, skip the magic in it
+			r.Discard(1)
+			atomic.AddUint64(&p.discardedBytes, 1)
+		case errors.Is(err, framing.ErrChecksum):
+		default:
+			return payload, err
+		}
+		atomic.AddUint64(&p.corruptedFrames, 1)
+		n, err := framing.Sync(r, framing.MagicV2)
+		atomic.AddUint64(&p.discardedBytes, uint64(n))
+		if err != nil {
+			return nil, truncated(r, err)
+		}
+	}
+}
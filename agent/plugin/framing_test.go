@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/chriskaliX/SDK/framing"
+)
+
+func TestFramingV2(t *testing.T) {
+	record := func(dt int32, opts *framing.Options) []byte {
+		frame, _ := framing.Encode(&proto.Record{DataType: dt, Timestamp: 1}, opts)
+		return frame
+	}
+	corrupted := record(3, framing.V2)
+	corrupted[len(corrupted)-1] ^= 0xff
+	tooLarge := record(4, framing.V2)
+	framing.ByteOrder.PutUint32(tooLarge[len(framing.MagicV2)+1:], uint32(maxRecordSize+1))
+	var hello bytes.Buffer
+	framing.WriteFrame(&hello, nil, framing.V2)
+	var stream []byte
+	for _, frame := range [][]byte{
+		record(1, nil),
+		hello.Bytes(),
+		record(2, framing.V2),
+		[]byte("garbage"),
+		corrupted,
+		tooLarge,
+		record(5, framing.V2),
+	} {
+		stream = append(stream, frame...)
+	}
+	p := newTestPlugin(proto.Config{Name: "test"})
+	task, _ := p.encodeTask(&proto.Task{})
+	if framing.IsV2(task) {
+		t.Fatal("task is encoded in v2 before the plugin switches")
+	}
+	r := bufio.NewReader(bytes.NewReader(stream))
+	var buf []byte
+	for _, dt := range []int32{1, 2, 5} {
+		rec, err := p.readFrameFrom(r, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.DataType != dt {
+			t.Fatalf("unexpected record %d, expect %d", rec.DataType, dt)
+		}
+	}
+	if _, err := p.readFrameFrom(r, &buf); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+	if frames, _ := p.CorruptedFrames(); frames != 3 || !p.FramingV2() {
+		t.Fatalf("unexpected corrupted frames: %d", frames)
+	}
+	if task, _ = p.encodeTask(&proto.Task{}); !framing.IsV2(task) {
+		t.Fatal("task is not encoded in v2 after the plugin switches")
+	}
+}
@@ -0,0 +1,18 @@
+package plugin
+
+import (
+	"agent/agent"
+	"os"
+	"os/exec"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// passAgentID tells the plugin the id of the agent, see transport.AgentID of
+// the SDK
+func passAgentID(cmd *exec.Cmd) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, config.AgentIDEnv+"="+agent.Instance.ID)
+}
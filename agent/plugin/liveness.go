@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"agent/proto"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// handleHeartbeat consumes the heartbeat of the plugin, it's not forwarded
+func (p *Plugin) handleHeartbeat(rec *proto.Record, now time.Time) bool {
+	if rec.GetDataType() != config.DTPluginHeartbeat {
+		return false
+	}
+	atomic.StoreInt64(&p.lastHeartbeat, now.UnixNano())
+	return true
+}
+
+// LastHeartbeat returns the time of the last heartbeat, or the start of the
+// process if none has arrived yet
+func (p *Plugin) LastHeartbeat() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&p.lastHeartbeat))
+}
+
+// isSilent reports whether the plugin misses the heartbeat_timeout. A paused
+// or throttled plugin can't send anything, the window restarts once it's
+// resumed.
+func (p *Plugin) isSilent(now time.Time) bool {
+	timeout := time.Duration(p.config.GetHeartbeatTimeout()) * time.Millisecond
+	if timeout <= 0 || p.IsExited() || p.IsPaused() || p.IsThrottled() || atomic.LoadInt32(&p.stopped) == 1 {
+		return false
+	}
+	return now.Sub(p.LastHeartbeat()) > timeout
+}
+
+// checkLiveness kills the process group of the silent plugins. They exit as
+// crashed, so supervise restarts them and the quarantine applies.
+func (m *Manager) checkLiveness(now time.Time) {
+	for _, plg := range m.GetAll() {
+		if !plg.isSilent(now) {
+			continue
+		}
+		silence := now.Sub(plg.LastHeartbeat())
+		plg.logger.Errorf("no heartbeat for %s, kill the plugin", silence.Round(time.Millisecond))
+		m.emitEvent(EventUnresponsive, map[string]string{
+			"name":     plg.Name(),
+			"pversion": plg.Version(),
+			"pid":      plg.pidTag,
+			"silence":  strconv.FormatFloat(silence.Seconds(), 'f', 3, 64),
+		})
+		if err := plg.killGroup(); err != nil {
+			plg.logger.Error("kill the silent plugin: ", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/framing"
+	"github.com/chriskaliX/SDK/transport"
+)
+
+func TestSilentPluginRestarted(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "silent", "exec cat <&3 >/dev/null")
+	config.HeartbeatTimeout = 50
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("silent")
+	m.checkLiveness(time.Now())
+	if plg.IsExited() {
+		t.Fatal("plugin is killed within the heartbeat timeout")
+	}
+	time.Sleep(100 * time.Millisecond)
+	m.checkLiveness(time.Now())
+	select {
+	case rec := <-transmitter.agent:
+		if rec.Data.Fields["event"] != EventUnresponsive || rec.Data.Fields["name"] != "silent" {
+			t.Fatalf("unexpected event: %v", rec)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no unresponsive event")
+	}
+	waitFor(t, "silent plugin is not restarted", func() bool {
+		loaded, ok := m.Get("silent")
+		return ok && loaded != plg && !loaded.IsExited()
+	})
+	if loaded, _ := m.Get("silent"); loaded.Restarts() != 1 {
+		t.Fatalf("restarts of the silent plugin: %d", loaded.Restarts())
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "alive", `(while true; do cat heartbeat >&4; sleep 0.02; done) &
+cat <&3 >/dev/null
+kill $!`)
+	config.HeartbeatTimeout = 200
+	buf, err := framing.Encode(transport.HeartbeatRecord(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(m.Workdir, "plugin", "alive", "heartbeat"), buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("alive")
+	start := plg.LastHeartbeat()
+	time.Sleep(300 * time.Millisecond)
+	m.checkLiveness(time.Now())
+	if plg.IsExited() {
+		t.Fatal("plugin is killed while sending heartbeats")
+	}
+	if !plg.LastHeartbeat().After(start) {
+		t.Fatal("heartbeat is not tracked")
+	}
+	select {
+	case rec := <-transmitter.plugin:
+		t.Fatalf("heartbeat is forwarded: %v", rec)
+	default:
+	}
+}
+
+func TestPausedNotSilent(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test", HeartbeatTimeout: 10})
+	p.paused = 1
+	if p.isSilent(time.Now()) {
+		t.Fatal("paused plugin is silent")
+	}
+	p.paused = 0
+	if !p.isSilent(time.Now()) {
+		t.Fatal("plugin without heartbeat is not silent")
+	}
+	p.config.HeartbeatTimeout = 0
+	if p.isSilent(time.Now()) {
+		t.Fatal("liveness is checked without heartbeat_timeout")
+	}
+}
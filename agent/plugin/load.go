@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"agent/proto"
+	"agent/watchdog"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errDupPlugin = errors.New("duplicate plugin load")
+)
+
+// delay before an exited plugin is restarted, it's doubled on each crash in
+// a row up to maxRestartDelay
+var (
+	restartDelay    = 5 * time.Second
+	maxRestartDelay = 5 * time.Minute
+)
+
+// restartBackoff returns the delay before the restart after crashes in a
+// row, doubled from base up to max
+func restartBackoff(base, max time.Duration, crashes int) time.Duration {
+	delay := base
+	for i := 1; i < crashes && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Load starts the plugin with the default manager
+func Load(ctx context.Context, config proto.Config) (err error) {
+	return DefaultManager.Load(ctx, config)
+}
+
+func (m *Manager) Load(ctx context.Context, config proto.Config) (err error) {
+	return m.load(ctx, config, 0)
+}
+
+// load starts the plugin, restarts is the count carried over from the
+// crashed process it replaces
+func (m *Manager) load(ctx context.Context, config proto.Config, restarts uint64) (err error) {
+	if m.IsDraining() {
+		return errDraining
+	}
+	loadedPlg, ok := m.Get(config.GetName())
+	// logical problem
+	if ok {
+		if loadedPlg.Version() == config.GetVersion() && !loadedPlg.IsExited() {
+			// hot reload the policy which needs no restart
+			loadedPlg.SetFieldFilter(&config)
+			loadedPlg.SetRateLimit(&config)
+			return errDupPlugin
+		}
+		// the new version takes over without a gap
+		if loadedPlg.Version() != config.GetVersion() && !loadedPlg.IsExited() {
+			return m.Upgrade(ctx, config)
+		}
+	}
+	if err = m.checkQuarantine(&config); err != nil {
+		return
+	}
+	if config.GetSignature() == "" {
+		config.Signature = config.GetSha256()
+	}
+	sctx, cancel := startupContext(ctx, &config)
+	defer cancel()
+	plg, err := m.NewPlugin(sctx, config)
+	if err != nil {
+		if errors.Is(sctx.Err(), context.DeadlineExceeded) {
+			err = errStartupTimeout
+		}
+		return
+	}
+	plg.restarts = restarts
+	plg.wg.Add(3)
+	go plg.Wait()
+	go plg.Receive()
+	go plg.Task()
+	m.Register(plg.Name(), plg)
+	go m.supervise(ctx, plg)
+	if err = m.verifyPlacement(plg); err != nil {
+		return
+	}
+	return m.waitStartup(sctx, plg)
+}
+
+func (m *Manager) syncPlugins(ctx context.Context, cfgs map[string]*proto.Config) *SyncResult {
+	load, evict, skipped := m.schedule(cfgs)
+	result := &SyncResult{Skipped: skipped, Failed: map[string]error{}}
+	// 为高优先级插件腾出位置
+	for _, plg := range evict {
+		plg.logger.Warn("plugin is preempted by higher priority plugins")
+		plg.Shutdown()
+		m.UnRegister(plg.Name())
+	}
+	if len(skipped) > 0 {
+		zap.S().Warnf("plugin count exceeds %d, skip: %v", m.MaxPlugins, skipped)
+		m.emitEvent(EventSkipped, map[string]string{
+			"skipped":     strings.Join(skipped, ","),
+			"max_plugins": strconv.Itoa(m.MaxPlugins),
+		})
+	}
+	// 加载插件, a plugin is started after its dependencies are ready
+	waves, cyclic := startWaves(load)
+	for _, cfg := range cyclic {
+		zap.S().Errorf("plugin %s: %v", cfg.Name, errDependencyCycle)
+		result.Failed[cfg.Name] = errDependencyCycle
+	}
+	for _, wave := range waves {
+		for _, cfg := range wave {
+			err := m.waitDependencies(ctx, cfg, result.Failed)
+			if err == nil {
+				err = m.Load(ctx, *cfg)
+			}
+			// 相同版本的同名插件正在运行，无需操作
+			if err == errDupPlugin {
+				result.Running = append(result.Running, cfg.Name)
+				continue
+			}
+			if err != nil {
+				zap.S().Errorf("plugin %s: %v", cfg.Name, err)
+				result.Failed[cfg.Name] = err
+			} else {
+				zap.S().Info("plugin has been loaded")
+				result.Loaded = append(result.Loaded, cfg.Name)
+			}
+			m.progress.Beat()
+		}
+	}
+	// 移除插件, the dependents before their dependencies
+	var removed []*Plugin
+	for _, plg := range m.GetAll() {
+		if _, ok := cfgs[plg.Name()]; !ok {
+			removed = append(removed, plg)
+		}
+	}
+	for _, wave := range shutdownWaves(removed) {
+		for _, plg := range wave {
+			plg.Shutdown()
+			m.UnRegister(plg.Name())
+			m.dropTaskQueue(plg.Name())
+			result.Removed = append(result.Removed, plg.Name())
+			if err := os.RemoveAll(plg.GetWorkingDirectory()); err != nil {
+				zap.S().Error(err)
+			}
+		}
+	}
+	return result
+}
+
+// supervise waits for the plugin to exit and restarts it if needed
+func (m *Manager) supervise(ctx context.Context, plg *Plugin) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-plg.done:
+	}
+	plg.wg.Wait()
+	if !plg.NeedRestart() {
+		plg.logger.Infof("plugin exited with code %d, no restart", plg.ExitCode())
+		return
+	}
+	crashes, quarantined := m.recordCrash(ctx, plg)
+	crashed := map[string]string{
+		"name":      plg.Name(),
+		"pversion":  plg.Version(),
+		"crashes":   strconv.Itoa(crashes),
+		"exit_code": strconv.Itoa(plg.ExitCode()),
+	}
+	if tail := plg.StderrTail(); tail != "" {
+		crashed["stderr"] = tail
+	}
+	m.emitEvent(EventCrashed, crashed)
+	if quarantined {
+		plg.logger.Errorf("plugin crashed %d times in a row, quarantined", crashes)
+		m.emitEvent(EventQuarantined, map[string]string{
+			"name":      plg.Name(),
+			"pversion":  plg.Version(),
+			"crashes":   strconv.Itoa(crashes),
+			"exit_code": strconv.Itoa(plg.ExitCode()),
+		})
+		return
+	}
+	delay := restartBackoff(restartDelay, maxRestartDelay, crashes)
+	plg.logger.Warnf("plugin exited unexpectedly with code %d, restart after %s", plg.ExitCode(), delay)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+	// the plugin may be removed or replaced during the delay
+	if loaded, ok := m.Get(plg.Name()); !ok || loaded != plg || atomic.LoadInt32(&plg.stopped) == 1 {
+		return
+	}
+	if err := m.load(ctx, plg.config, plg.Restarts()+1); err != nil {
+		plg.logger.Error("restart failed: ", err)
+		return
+	}
+	plg.logger.Info("plugin has been restarted")
+}
+
+// Startup runs the default manager
+func Startup(ctx context.Context, wg *sync.WaitGroup) {
+	DefaultManager.Startup(ctx, wg)
+}
+
+func (m *Manager) Startup(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	// the manager stuck is restarted by the watchdog, a sync beats once a
+	// plugin is loaded
+	m.progress = watchdog.Register("plugin manager")
+	defer m.progress.Done()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	health := time.NewTicker(healthInterval)
+	defer health.Stop()
+	// the configs of the latest sync deferred, and the callers waiting for
+	// the result of any sync deferred
+	var (
+		deferred bool
+		pending  map[string]*proto.Config
+		waiters  []chan *SyncResult
+	)
+	for {
+		m.progress.Beat()
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+			m.ShutdownAll(shutdownCtx)
+			cancel()
+			return
+		case req := <-m.syncCh:
+			if req.result != nil {
+				waiters = append(waiters, req.result)
+			}
+			if !m.transportReady() {
+				// only the latest configs are synced, the result goes to all
+				if !deferred {
+					zap.S().Warn("transport is down, plugin sync is deferred")
+				}
+				deferred, pending = true, req.cfgs
+				continue
+			}
+			m.doSync(ctx, req.cfgs, waiters)
+			deferred, pending, waiters = false, nil, nil
+		case <-ticker.C:
+			m.checkQuota(ctx)
+		case <-health.C:
+			ready := m.transportReady()
+			if ready && deferred {
+				m.doSync(ctx, pending, waiters)
+				deferred, pending, waiters = false, nil, nil
+			}
+			m.applyPolicy(ready)
+			m.checkLiveness(time.Now())
+		}
+	}
+}
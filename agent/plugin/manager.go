@@ -1,20 +1,114 @@
 package plugin
 
 import (
+	"agent/agent"
 	"agent/proto"
+	"agent/transport"
+	"agent/watchdog"
+	"context"
 	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
-var DefaultManager = &Manager{
-	plugins: &sync.Map{},
-	syncCh:  make(chan map[string]*proto.Config, 1),
+// DefaultManager is the manager of the agent, agent.Instance is read in
+// init, so the workdir is already resolved here
+var DefaultManager = NewManager(agent.Instance.Workdir, agent.Product, transport.DTransfer)
+
+const defaultShutdownParallelism = 8
+
+// plugins are killed this long before the deadline of ShutdownAll, to leave
+// time for them to be reaped
+var killMargin = 500 * time.Millisecond
+
+// ITransmitter is where the records go, records of plugins are sent by
+// Transmission, and the records of the agent itself by TransmitAgent
+type ITransmitter interface {
+	Transmission(rec *proto.Record, important bool) error
+	TransmitAgent(rec *proto.Record, important bool) error
+}
+
+// SyncResult is the outcome of a config sync, by plugin name
+type SyncResult struct {
+	// Loaded are plugins started or replaced by a new version
+	Loaded []string
+	// Running are plugins already running with the same version
+	Running []string
+	// Skipped are plugins beyond the max plugin count
+	Skipped []string
+	// Removed are plugins shutdown since they are not in the configs
+	Removed []string
+	Failed  map[string]error
+}
+
+type syncRequest struct {
+	cfgs   map[string]*proto.Config
+	result chan *SyncResult
+}
+
+// IHealth is implemented by the transmitter if it knows whether the uplink
+// is available, a transmitter without it is always considered healthy
+type IHealth interface {
+	IsHealthy() bool
 }
 
 // move to struct, dependency injection
 type Manager struct {
 	plugins *sync.Map
-	syncCh  chan map[string]*proto.Config
+	syncCh  chan syncRequest
+	// Workdir is the base directory, plugins run in Workdir/plugin/<name>
+	Workdir string
+	// Product is the name of the agent, configs of it are not plugins
+	Product     string
+	Transmitter ITransmitter
+	// Tracer traces the plugin lifecycle by OpenTelemetry, it's a no-op by
+	// default
+	Tracer trace.Tracer
+	// ShutdownParallelism bounds the plugins shutting down at the same time
+	// in ShutdownAll, defaultShutdownParallelism if it's not set
+	ShutdownParallelism int
+	// crash states by plugin name, guarded by cmu
+	crashes map[string]*crashState
+	cmu     sync.Mutex
+	// task queues by plugin name, guarded by qmu
+	queues map[string]*taskQueue
+	qmu    sync.Mutex
+	// MaxRestarts is the ceiling of restarts in a row after crashes, for the
+	// plugins without quarantine_threshold. The plugin is quarantined once
+	// it's exceeded, 0 for unlimited.
+	MaxRestarts int
+	// MaxPlugins caps the number of running plugins, 0 for unlimited. When
+	// Preempt is set, a running plugin is shut down to make room for a
+	// plugin with higher priority.
+	MaxPlugins int
+	Preempt    bool
+	// FailClosed defers loading plugins until the transport is healthy, and
+	// pauses running plugins while it's down. By default plugins run anyway
+	// (fail-open), and records are buffered or dropped by the transfer.
+	FailClosed bool
+	// set once Drain is called, no plugin is loaded after
+	draining int32
+	// beats of the Startup loop, for the watchdog
+	progress *watchdog.Progress
+}
+
+var errDraining = errors.New("plugin manager is shutting down")
+
+func NewManager(workdir, product string, transmitter ITransmitter) *Manager {
+	return &Manager{
+		plugins:     &sync.Map{},
+		syncCh:      make(chan syncRequest, 1),
+		Workdir:     workdir,
+		Product:     product,
+		Transmitter: transmitter,
+		Tracer:      noopTracer,
+		crashes:     map[string]*crashState{},
+		queues:      map[string]*taskQueue{},
+	}
 }
 
 func (m *Manager) Get(name string) (*Plugin, bool) {
@@ -34,15 +128,36 @@ func (m *Manager) GetAll() (plgs []*Plugin) {
 	return
 }
 
+// Sync syncs the plugins with the configs in background, the result is not
+// reported, see SyncWithResult
 func (m *Manager) Sync(cfgs map[string]*proto.Config) (err error) {
+	if m.IsDraining() {
+		return errDraining
+	}
 	select {
-	case m.syncCh <- cfgs:
+	case m.syncCh <- syncRequest{cfgs: cfgs}:
 	default:
 		err = errors.New("plugins are syncing or context has been cancled")
 	}
 	return
 }
 
+// SyncWithResult is the same as Sync, the returned channel receives the
+// result once the sync is done. It's buffered, so the manager never blocks
+// on it if no one is listening.
+func (m *Manager) SyncWithResult(cfgs map[string]*proto.Config) (<-chan *SyncResult, error) {
+	if m.IsDraining() {
+		return nil, errDraining
+	}
+	result := make(chan *SyncResult, 1)
+	select {
+	case m.syncCh <- syncRequest{cfgs: cfgs, result: result}:
+	default:
+		return nil, errors.New("plugins are syncing or context has been cancled")
+	}
+	return result, nil
+}
+
 func (m *Manager) Register(name string, plg *Plugin) {
 	m.plugins.Store(name, plg)
 }
@@ -51,6 +166,113 @@ func (m *Manager) UnRegister(name string) {
 	m.plugins.Delete(name)
 }
 
+// Restart shuts down the plugin and loads it again with the same config,
+// the quarantined plugin is unquarantined. The context is the one of the
+// new process, as the one of Load.
+func (m *Manager) Restart(ctx context.Context, name string) error {
+	if m.IsQuarantined(name) {
+		return m.Unquarantine(name)
+	}
+	plg, ok := m.Get(name)
+	if !ok {
+		return errPluginNotFound
+	}
+	plg.Shutdown()
+	plg.wg.Wait()
+	plg.logger.Info("plugin is restarted on request")
+	return m.Load(ctx, plg.config)
+}
+
+// Drain stops loading plugins, config syncs are refused and crashed plugins
+// are not restarted anymore. It's called before the final ShutdownAll.
+func (m *Manager) Drain() { atomic.StoreInt32(&m.draining, 1) }
+
+func (m *Manager) IsDraining() bool { return atomic.LoadInt32(&m.draining) == 1 }
+
+// ShutdownAll shuts down and unregisters all the plugins in the order of
+// depends_on, a plugin is shut down only after all the plugins depending on
+// it. Plugins in the same wave are shut down concurrently, at most
+// ShutdownParallelism at a time. If the context has a deadline, the plugins
+// not drained are killed shortly before it, so that it returns in time.
+func (m *Manager) ShutdownAll(ctx context.Context) {
+	parallelism := m.ShutdownParallelism
+	if parallelism <= 0 {
+		parallelism = defaultShutdownParallelism
+	}
+	killCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		killCtx, cancel = context.WithDeadline(ctx, deadline.Add(-killMargin))
+		defer cancel()
+	}
+	sem := make(chan struct{}, parallelism)
+	for _, wave := range shutdownWaves(m.GetAll()) {
+		subWg := &sync.WaitGroup{}
+		for _, plg := range wave {
+			subWg.Add(1)
+			go func(plg *Plugin) {
+				defer subWg.Done()
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-killCtx.Done():
+					// no slot in time, it's killed right away
+				}
+				plg.ShutdownContext(killCtx)
+				plg.wg.Wait()
+				m.plugins.Delete(plg.Name())
+			}(plg)
+		}
+		subWg.Wait()
+	}
+}
+
+// shutdownWaves groups the plugins by depends_on, each wave only depends on
+// the waves after it. Dependencies which are not running are ignored, and
+// plugins in a dependency cycle go together in the last wave.
+func shutdownWaves(plgs []*Plugin) (waves [][]*Plugin) {
+	running := make(map[string]bool, len(plgs))
+	for _, plg := range plgs {
+		running[plg.Name()] = true
+	}
+	deps := func(plg *Plugin) (names []string) {
+		for _, name := range plg.config.GetDependsOn() {
+			if running[name] && name != plg.Name() {
+				names = append(names, name)
+			}
+		}
+		return
+	}
+	// the running plugins depending on each plugin
+	dependents := make(map[string]int, len(plgs))
+	for _, plg := range plgs {
+		for _, name := range deps(plg) {
+			dependents[name]++
+		}
+	}
+	for len(plgs) > 0 {
+		var wave, rest []*Plugin
+		for _, plg := range plgs {
+			if dependents[plg.Name()] == 0 {
+				wave = append(wave, plg)
+			} else {
+				rest = append(rest, plg)
+			}
+		}
+		if len(wave) == 0 {
+			return append(waves, rest)
+		}
+		for _, plg := range wave {
+			for _, name := range deps(plg) {
+				dependents[name]--
+			}
+		}
+		waves = append(waves, wave)
+		plgs = rest
+	}
+	return
+}
+
 func (m *Manager) UnregisterAll() {
 	subWg := &sync.WaitGroup{}
 	m.plugins.Range(func(_, value interface{}) bool {
@@ -66,3 +288,67 @@ func (m *Manager) UnregisterAll() {
 	})
 	subWg.Wait()
 }
+
+// schedule decides which configs to load when the plugin count is capped.
+// Configs are ordered by priority, and a running plugin keeps its slot
+// unless preempted by a plugin with higher priority.
+func (m *Manager) schedule(cfgs map[string]*proto.Config) (load []*proto.Config, evict []*Plugin, skipped []string) {
+	for _, cfg := range cfgs {
+		if cfg.Name != m.Product {
+			load = append(load, cfg)
+		}
+	}
+	sort.Slice(load, func(i, j int) bool {
+		if load[i].Priority != load[j].Priority {
+			return load[i].Priority > load[j].Priority
+		}
+		return load[i].Name < load[j].Name
+	})
+	if m.MaxPlugins <= 0 || len(load) <= m.MaxPlugins {
+		return
+	}
+	running := func(name string) (*Plugin, bool) {
+		plg, ok := m.Get(name)
+		if ok && !plg.IsExited() {
+			return plg, true
+		}
+		return nil, false
+	}
+	candidates := load
+	load = nil
+	if m.Preempt {
+		for i, cfg := range candidates {
+			if i < m.MaxPlugins {
+				load = append(load, cfg)
+				continue
+			}
+			if plg, ok := running(cfg.Name); ok {
+				evict = append(evict, plg)
+			}
+			skipped = append(skipped, cfg.Name)
+		}
+		return
+	}
+	// running plugins keep their slots, the rest are filled by priority
+	slots := m.MaxPlugins
+	for _, cfg := range candidates {
+		if _, ok := running(cfg.Name); ok {
+			slots--
+		}
+	}
+	// the cap is lowered below the running ones, which are kept anyway
+	if slots < 0 {
+		slots = 0
+	}
+	for _, cfg := range candidates {
+		if _, ok := running(cfg.Name); ok {
+			load = append(load, cfg)
+		} else if slots > 0 {
+			load = append(load, cfg)
+			slots--
+		} else {
+			skipped = append(skipped, cfg.Name)
+		}
+	}
+	return
+}
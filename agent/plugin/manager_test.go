@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordTransmitter keeps the records instead of sending to the server
+type recordTransmitter struct {
+	plugin chan *proto.Record
+	agent  chan *proto.Record
+}
+
+func newRecordTransmitter() *recordTransmitter {
+	return &recordTransmitter{
+		plugin: make(chan *proto.Record, 16),
+		agent:  make(chan *proto.Record, 16),
+	}
+}
+
+func (r *recordTransmitter) Transmission(rec *proto.Record, important bool) error {
+	r.plugin <- rec
+	return nil
+}
+
+func (r *recordTransmitter) TransmitAgent(rec *proto.Record, important bool) error {
+	r.agent <- rec
+	return nil
+}
+
+func TestManagerStandalone(t *testing.T) {
+	workdir := t.TempDir()
+	transmitter := newRecordTransmitter()
+	m := NewManager(workdir, "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// a record frame with data_type 1, then wait for tx to be closed
+	config := writeTestPluginAt(t, workdir, "trivial", `printf '\002\000\000\000\010\001' >&4
+exec cat <&3 >/dev/null`)
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	defer m.UnregisterAll()
+	plg, ok := m.Get("trivial")
+	if !ok {
+		t.Fatal("plugin is not registered")
+	}
+	if _, ok := DefaultManager.Get("trivial"); ok {
+		t.Fatal("plugin is registered to the default manager")
+	}
+	if dir := plg.GetWorkingDirectory(); !strings.HasPrefix(dir, filepath.Join(workdir, "plugin")) {
+		t.Fatalf("working directory %s is not under %s", dir, workdir)
+	}
+	select {
+	case rec := <-transmitter.plugin:
+		if rec.DataType != 1 {
+			t.Fatalf("unexpected record: %v", rec)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record is transmitted")
+	}
+}
+
+func TestTagInstance(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// a record frame with data_type 1000, then exit to be restarted
+	config := writeTestPluginAt(t, m.Workdir, "tagged", `printf '\003\000\000\000\010\350\007' >&4
+exit 1`)
+	config.TagInstance = true
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	defer m.UnregisterAll()
+	var recs []*proto.Record
+	for len(recs) < 2 {
+		select {
+		case rec := <-transmitter.plugin:
+			recs = append(recs, rec)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no record is transmitted")
+		}
+	}
+	first, second := recs[0].Data.Fields, recs[1].Data.Fields
+	if first["plugin_pid"] == "" || first["plugin_start"] == "" {
+		t.Fatalf("instance is not tagged: %v", first)
+	}
+	if first["plugin_pid"] == second["plugin_pid"] || first["plugin_start"] == second["plugin_start"] {
+		t.Fatalf("instance tags do not change across restart: %v, %v", first, second)
+	}
+}
+
+func TestShutdownAll(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	m.ShutdownParallelism = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var plgs []*Plugin
+	for i, script := range []string{
+		"exec cat <&3 >/dev/null", "exec cat <&3 >/dev/null", "exec cat <&3 >/dev/null",
+		// slow to drain, never reads the task pipe
+		"exec sleep 100", "exec sleep 100", "exec sleep 100",
+	} {
+		name := "p" + strconv.Itoa(i)
+		if err := m.Load(ctx, writeTestPluginAt(t, m.Workdir, name, script)); err != nil {
+			t.Fatal(err)
+		}
+		plg, _ := m.Get(name)
+		plgs = append(plgs, plg)
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	start := time.Now()
+	m.ShutdownAll(shutdownCtx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown takes %s beyond the deadline", elapsed)
+	}
+	if len(m.GetAll()) != 0 {
+		t.Fatal("plugins are not unregistered")
+	}
+	for _, plg := range plgs {
+		if !plg.IsExited() {
+			t.Fatalf("plugin %s is not exited", plg.Name())
+		}
+		if isAlive(plg.Pid()) {
+			t.Fatalf("process of %s is still alive", plg.Name())
+		}
+	}
+}
+
+func TestShutdownWaves(t *testing.T) {
+	plg := func(name string, deps ...string) *Plugin {
+		return newTestPlugin(proto.Config{Name: name, DependsOn: deps})
+	}
+	names := func(wave []*Plugin) (s []string) {
+		for _, plg := range wave {
+			s = append(s, plg.Name())
+		}
+		sort.Strings(s)
+		return
+	}
+	waves := shutdownWaves([]*Plugin{
+		plg("base"),
+		plg("app", "base", "missing"),
+		plg("ui", "app"),
+		plg("standalone"),
+		plg("a", "b"),
+		plg("b", "a"),
+	})
+	expected := [][]string{{"standalone", "ui"}, {"app"}, {"base"}, {"a", "b"}}
+	if len(waves) != len(expected) {
+		t.Fatalf("%d waves, expect %d", len(waves), len(expected))
+	}
+	for i, wave := range waves {
+		if got := names(wave); strings.Join(got, ",") != strings.Join(expected[i], ",") {
+			t.Fatalf("wave %d is %v, expect %v", i, got, expected[i])
+		}
+	}
+}
+
+func TestShutdownOrder(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base := writeTestPluginAt(t, m.Workdir, "base", "exec cat <&3 >/dev/null")
+	// slow to exit after the pipe is closed
+	app := writeTestPluginAt(t, m.Workdir, "app", "cat <&3 >/dev/null; sleep 0.2")
+	app.DependsOn = []string{"base"}
+	exited := make(chan string, 2)
+	for _, config := range []proto.Config{base, app} {
+		if err := m.Load(ctx, config); err != nil {
+			t.Fatal(err)
+		}
+		plg, _ := m.Get(config.Name)
+		go func() {
+			<-plg.done
+			exited <- plg.Name()
+		}()
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	m.ShutdownAll(shutdownCtx)
+	if first := <-exited; first != "app" {
+		t.Fatalf("%s exits before the plugin depending on it", first)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	m.Drain()
+	config := writeTestPluginAt(t, m.Workdir, "late", "exec cat <&3 >/dev/null")
+	if err := m.Load(context.Background(), config); err != errDraining {
+		t.Fatalf("expect draining, got %v", err)
+	}
+	if err := m.Sync(map[string]*proto.Config{"late": &config}); err != errDraining {
+		t.Fatalf("expect draining, got %v", err)
+	}
+	if _, ok := m.Get("late"); ok {
+		t.Fatal("plugin is loaded while draining")
+	}
+}
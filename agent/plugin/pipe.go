@@ -0,0 +1,26 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+)
+
+// defaultReadBufferSize is the size of the reader of records without
+// read_buffer_size
+const defaultReadBufferSize = 128 * 1024
+
+var errPipeSizeUnsupported = errors.New("pipe buffer size is not supported on this platform")
+
+// readBufferSize returns the size of the reader of records. A frame larger
+// than it is read into a buffer of its own, so it never exceeds the largest
+// frame allowed.
+func readBufferSize(config *proto.Config) int {
+	size := int(config.GetReadBufferSize())
+	if size <= 0 {
+		return defaultReadBufferSize
+	}
+	if max := maxRecordSize + 64; size > max {
+		return max
+	}
+	return size
+}
@@ -0,0 +1,13 @@
+package plugin
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setPipeSize resizes the pipe by F_SETPIPE_SZ, and returns the size in
+// effect, which is rounded up to a power of two pages by the kernel
+func setPipeSize(f *os.File, size int) (int, error) {
+	return unix.FcntlInt(f.Fd(), unix.F_SETPIPE_SZ, size)
+}
@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPipeResize(t *testing.T) {
+	rx, tx, child, err := newPipes("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	defer tx.Close()
+	defer child.close()
+	actual, err := child.resize(256 * 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual < 256*1024 {
+		t.Fatalf("pipe size %d is smaller than requested", actual)
+	}
+	for _, f := range []*os.File{child.task, child.record} {
+		if size, err := unix.FcntlInt(f.Fd(), unix.F_GETPIPE_SZ, 0); err != nil || size != actual {
+			t.Fatalf("unexpected pipe size: %d, %v", size, err)
+		}
+	}
+}
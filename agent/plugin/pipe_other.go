@@ -0,0 +1,7 @@
+//go:build !linux
+
+package plugin
+
+import "os"
+
+func setPipeSize(f *os.File, size int) (int, error) { return 0, errPipeSizeUnsupported }
@@ -0,0 +1,22 @@
+package plugin
+
+import (
+	"agent/proto"
+	"testing"
+)
+
+func TestReadBufferSize(t *testing.T) {
+	for _, c := range []struct {
+		size   int32
+		expect int
+	}{
+		{0, defaultReadBufferSize},
+		{-1, defaultReadBufferSize},
+		{1024 * 1024, 1024 * 1024},
+		{1 << 30, maxRecordSize + 64},
+	} {
+		if size := readBufferSize(&proto.Config{ReadBufferSize: c.size}); size != c.expect {
+			t.Errorf("read buffer size of %d is %d, expect %d", c.size, size, c.expect)
+		}
+	}
+}
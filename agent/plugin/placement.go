@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// it's replaced in tests
+var procRoot = "/proc"
+
+var errMisplaced = errors.New("plugin is not in the expected cgroup or namespace")
+
+// needPlacementCheck reports whether any placement is expected by config
+func needPlacementCheck(config *proto.Config) bool {
+	return config.GetExpectedCgroup() != "" || len(config.GetExpectedNamespaces()) != 0
+}
+
+// readCgroups returns the cgroup paths of the process, for cgroup v1 there is
+// one for each hierarchy, and only one for cgroup v2
+func readCgroups(pid int) (paths []string, err error) {
+	var f *os.File
+	if f, err = os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "cgroup")); err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) == 3 {
+			paths = append(paths, fields[2])
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// checkPlacement returns what's expected and actually found if the process
+// is misplaced, both are empty if it matches
+func checkPlacement(pid int, config *proto.Config) (expected, actual string, err error) {
+	if cgroup := config.GetExpectedCgroup(); cgroup != "" {
+		var paths []string
+		if paths, err = readCgroups(pid); err != nil {
+			return
+		}
+		matched := false
+		for _, path := range paths {
+			if path == cgroup {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "cgroup:" + cgroup, "cgroup:" + strings.Join(paths, ","), nil
+		}
+	}
+	for _, ns := range config.GetExpectedNamespaces() {
+		i := strings.IndexByte(ns, ':')
+		if i <= 0 {
+			err = errors.New("invalid namespace: " + ns)
+			return
+		}
+		var link string
+		if link, err = os.Readlink(filepath.Join(procRoot, strconv.Itoa(pid), "ns", ns[:i])); err != nil {
+			return
+		}
+		if link != ns {
+			return ns, link, nil
+		}
+	}
+	return
+}
+
+// verifyPlacement checks the plugin after launch, reports the mismatch and
+// shuts it down if it's configured
+func (m *Manager) verifyPlacement(plg *Plugin) (err error) {
+	if !needPlacementCheck(&plg.config) {
+		return
+	}
+	expected, actual, err := checkPlacement(plg.Pid(), &plg.config)
+	if err != nil {
+		plg.logger.Error("placement check failed: ", err)
+		return nil
+	}
+	if expected == "" {
+		return
+	}
+	plg.logger.Errorf("plugin is misplaced, expected %s, actual %s", expected, actual)
+	m.emitEvent(EventMisplaced, map[string]string{
+		"name":     plg.Name(),
+		"pid":      strconv.Itoa(plg.Pid()),
+		"expected": expected,
+		"actual":   actual,
+	})
+	if plg.config.GetKillOnMisplacement() {
+		plg.Shutdown()
+		return errMisplaced
+	}
+	return
+}
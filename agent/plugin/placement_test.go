@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// fakeProc writes the cgroup and namespace links of pid under a temp proc root
+func fakeProc(t *testing.T, pid int, cgroup string, ns map[string]string) {
+	old := procRoot
+	procRoot = t.TempDir()
+	t.Cleanup(func() { procRoot = old })
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "ns"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, link := range ns {
+		if err := os.Symlink(link, filepath.Join(dir, "ns", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckPlacement(t *testing.T) {
+	fakeProc(t, 42, "12:cpu,cpuacct:/hades/plugin\n11:memory:/hades/plugin\n", map[string]string{
+		"net": "net:[4026531992]",
+		"mnt": "mnt:[4026531841]",
+	})
+	cases := []struct {
+		config   proto.Config
+		expected string
+		actual   string
+	}{
+		{proto.Config{ExpectedCgroup: "/hades/plugin", ExpectedNamespaces: []string{"net:[4026531992]"}}, "", ""},
+		{proto.Config{ExpectedCgroup: "/hades/other"}, "cgroup:/hades/other", "cgroup:/hades/plugin,/hades/plugin"},
+		{proto.Config{ExpectedNamespaces: []string{"mnt:[4026531840]"}}, "mnt:[4026531840]", "mnt:[4026531841]"},
+	}
+	for _, c := range cases {
+		expected, actual, err := checkPlacement(42, &c.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != c.expected || actual != c.actual {
+			t.Fatalf("config %v: got %q, %q, want %q, %q", c.config, expected, actual, c.expected, c.actual)
+		}
+	}
+	if _, _, err := checkPlacement(42, &proto.Config{ExpectedNamespaces: []string{"invalid"}}); err == nil {
+		t.Fatal("invalid namespace is accepted")
+	}
+}
+
+func TestMisplacedPlugin(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	cfg := writeTestPluginAt(t, m.Workdir, "misplaced", "exec cat <&3 >/dev/null")
+	cfg.ExpectedCgroup = "/hades/plugin"
+	cfg.KillOnMisplacement = true
+	plg, err := m.NewPlugin(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plg.wg.Add(3)
+	go plg.Wait()
+	go plg.Receive()
+	go plg.Task()
+	fakeProc(t, plg.Pid(), "0::/user.slice\n", nil)
+	if err = m.verifyPlacement(plg); err != errMisplaced {
+		t.Fatalf("expect misplaced, got %v", err)
+	}
+	waitExited(t, plg)
+	select {
+	case rec := <-transmitter.agent:
+		fields := rec.Data.Fields
+		if rec.DataType != config.DTPluginEvent || fields["event"] != EventMisplaced || fields["actual"] != "cgroup:/user.slice" {
+			t.Fatalf("unexpected event: %v", rec)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event is emitted")
+	}
+}
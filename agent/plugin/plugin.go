@@ -1,24 +1,29 @@
 package plugin
 
 import (
-	"agent/agent"
+	"agent/conf"
 	"agent/proto"
 	"agent/transport"
+	"agent/transport/pool"
 	"agent/utils"
 	"bufio"
 	"context"
-	"encoding/binary"
 	"errors"
 	"io"
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
+	"github.com/chriskaliX/SDK/framing"
+	"github.com/chriskaliX/SDK/ring"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
 type Plugin struct {
@@ -32,95 +37,399 @@ type Plugin struct {
 	tx      io.WriteCloser
 	txBytes uint64
 	txCnt   uint64
+	// optional buffered writer of tx, guarded by wmu
+	writer *bufio.Writer
+	wmu    sync.Mutex
+	// the shared memory ring of records if ring_buffer_size is set, and
+	// ringAttached is set once records come from it. ringOnce unmaps it once,
+	// the pointer is kept since Stop is still valid after that.
+	ring         *ring.Ring
+	ringAttached int32
+	ringOnce     sync.Once
+	// set once the plugin switches to framing v2, and the frames skipped
+	// for corruption in it
+	framingV2       int32
+	corruptedFrames uint64
+	discardedBytes  uint64
+	// the record in reassembly from chunks, the records reassembled and
+	// the chunks dropped
+	chunked        chunkedRecord
+	chunkedRecords uint64
+	droppedChunks  uint64
+
+	// task write latency, from SendTask to fully written, in nanoseconds
+	taskLatency    uint64
+	taskLatencyCnt uint64
+	taskLatencyMax uint64
+	slowConsumer   int32
+	// set if the plugin is shutdown on purpose
+	stopped int32
+	// set if the plugin is stopped by SIGSTOP, guarded by mu
+	paused int32
+	// plugin clock minus agent clock in nanoseconds, valid if clockSynced
+	clockOffset int64
+	clockSynced int32
+	// set once the plugin passes the startup probe, and readyCh is closed
+	ready   int32
+	readyCh chan struct{}
+	// *fieldFilter, swapped on config sync
+	filter atomic.Value
+	// records are sent by the transmitter of the manager, guarded by tmu
+	transmitter    ITransmitter
+	tmu            sync.RWMutex
+	transmitPanics uint64
+	tracer         trace.Tracer
+	// restarts by supervise, carried over since the first load
+	restarts uint64
+	// unix nano of the last heartbeat, the start of the process before the
+	// first one
+	lastHeartbeat int64
+	// policy of unknown record types, nil if all types are known
+	types          *typePolicy
+	unknownRecords uint64
+	// recordLimiter of record_rate_limit, and the records dropped by it.
+	// limited is set while the records are dropped.
+	limiter            atomic.Value
+	limited            int32
+	rateLimitedRecords uint64
+	// tasks delivered and waiting for the result, by token
+	pending pendingTasks
+	// *Plugin of the new version once it's upgraded
+	successor atomic.Value
+	// *Capabilities advertised by the plugin
+	capabilities atomic.Value
+	// set while the receive is blocked by backpressure, and the total time
+	// of it in nanoseconds
+	throttled     int32
+	throttledTime int64
 
 	updateTime time.Time
-	reader     *bufio.Reader
-	taskCh     chan proto.Task
-	done       chan struct{} // same with the context done
-	wg         *sync.WaitGroup
-	workdir    string
+	// [4]float64 of the last GetState, for the readers not owning the window
+	lastState atomic.Value
+	reader    *bufio.Reader
+	// grows to the largest frame which does not fit in reader
+	frameBuf []byte
+	// shared by the instances of the same name
+	tasks *taskQueue
+	// Task writes the task in hand and returns on the request, and closes
+	// taskStopped once it returns
+	stopTaskCh  chan chan struct{}
+	taskStopped chan struct{}
+	done        chan struct{} // same with the context done
+	received    chan struct{} // closed once Receive returns
+	doneOnce    sync.Once
+	wg          *sync.WaitGroup
+	workdir     string
+	startAt     time.Time
+	// pid and start time of the process, for tag_instance
+	pidTag   string
+	startTag string
+	// the path of the running binary, a verified copy if immutable is set
+	execPath string
+	// the dedicated cgroup if resource limits are set
+	cgroup *pluginCgroup
+	// rotated files of stderr and stdout
+	stderr *lumberjack.Logger
+	stdout *lumberjack.Logger
 	// SugaredLogger/Logger
 	logger *zap.SugaredLogger
 }
 
+// SetFieldFilter replaces the field allowlist/denylist of records, it takes
+// effect from the next record
+func (p *Plugin) SetFieldFilter(config *proto.Config) {
+	p.filter.Store(newFieldFilter(config))
+}
+
+// SetTransmissionTarget replaces the transmitter of records. The record in
+// flight is sent to the old one before it returns, and all the records after
+// go to the new one.
+func (p *Plugin) SetTransmissionTarget(t ITransmitter) {
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
+	p.transmitter = t
+}
+
+// the default threshold for slow task consumer if it's not set in config
+const defaultSlowTaskThreshold = time.Second
+
+// interval of flushing the batched tasks, and the max time waiting for the
+// plugin to consume the buffered tasks when shutdown
+const (
+	taskFlushInterval = 200 * time.Millisecond
+	taskFlushTimeout  = 5 * time.Second
+)
+
+var errStopTaskTimeout = errors.New("task in hand is not written in time")
+
+// how long Wait leaves Receive to drain the records written before the exit,
+// a child holding the pipe may keep it open forever
+var receiveDrainTimeout = time.Second
+
+// how long Wait copies stdout and stderr to the files once the plugin exits,
+// a child holding them may keep them open forever
+var stdWaitDelay = time.Second
+
+// the grace period of Shutdown before the plugin is killed
+var shutdownGrace = 30 * time.Second
+
+// NewPlugin creates the plugin by the default manager
 func NewPlugin(ctx context.Context, config proto.Config) (p *Plugin, err error) {
-	var (
-		rx_r, rx_w, tx_r, tx_w *os.File
-		errFile                *os.File
-	)
+	return DefaultManager.NewPlugin(ctx, config)
+}
+
+func (m *Manager) NewPlugin(ctx context.Context, config proto.Config) (p *Plugin, err error) {
+	var child *childPipes
 	p = &Plugin{
-		config:     config,
-		updateTime: time.Now(),
-		done:       make(chan struct{}),
-		taskCh:     make(chan proto.Task),
-		wg:         &sync.WaitGroup{},
-		logger:     zap.S().With("plugin", config.Name, "pver", config.Version, "psign", config.Signature),
-	}
-	p.workdir = path.Join(agent.Instance.Workdir, "plugin", p.Name())
+		config:      config,
+		updateTime:  time.Now(),
+		done:        make(chan struct{}),
+		received:    make(chan struct{}),
+		readyCh:     make(chan struct{}),
+		tasks:       m.taskQueue(config.Name),
+		stopTaskCh:  make(chan chan struct{}),
+		taskStopped: make(chan struct{}),
+		wg:          &sync.WaitGroup{},
+		logger:      zap.S().With("plugin", config.Name, "pver", config.Version, "psign", config.Signature),
+	}
+	p.workdir = path.Join(m.Workdir, "plugin", p.Name())
+	p.transmitter = m.Transmitter
+	if p.tracer = m.Tracer; p.tracer == nil {
+		p.tracer = noopTracer
+	}
+	p.SetFieldFilter(&config)
+	p.SetRateLimit(&config)
+	p.types = newTypePolicy(&config)
+	// the pipes of agent side are released if the launch fails
+	defer func() {
+		if err != nil {
+			p.closePipes()
+			p.closeStdLogs()
+			p.closeRing()
+		}
+	}()
 	// pipe init
 	// In Elkeid, a note: 'for compatibility' is here. Since some systems only allow
 	// half-duplex pipe.
-	rx_r, rx_w, err = os.Pipe()
-	if err != nil {
-		p.logger.Error("rx pipe init")
+	if p.rx, p.tx, child, err = newPipes(p.Name()); err != nil {
+		p.logger.Error("pipe init:", err)
 		return
 	}
-	p.rx = rx_r
-	defer rx_w.Close()
-	tx_r, tx_w, err = os.Pipe()
-	if err != nil {
-		p.logger.Error("tx pipe init")
-		return
+	defer child.close()
+	if size := config.GetPipeBufferSize(); size > 0 {
+		if actual, rerr := child.resize(int(size)); rerr != nil {
+			p.logger.Error("pipe resize, keep the default size: ", rerr)
+		} else {
+			p.logger.Infof("pipe size is set to %d", actual)
+		}
+	}
+	if size := config.GetTaskBufferSize(); size > 0 {
+		p.writer = bufio.NewWriterSize(p.tx, int(size))
 	}
-	p.tx = tx_w
-	defer tx_r.Close()
 	// reader init
-	p.reader = bufio.NewReaderSize(rx_r, 1024*128)
-	// purge the files
-	os.Remove(path.Join(p.workdir, p.Name()+".stderr"))
-	os.Remove(path.Join(p.workdir, p.Name()+".stdout"))
+	p.reader = bufio.NewReaderSize(p.rx, readBufferSize(&config))
 	// cmdline
 	execPath := path.Join(p.workdir, p.Name())
+	_, span := p.startSpan(ctx, SpanVerify)
 	err = utils.CheckSignature(execPath, config.Signature)
+	span.SetAttributes(attribute.Bool("verify.matched", err == nil))
+	span.End()
 	if err != nil {
 		p.logger.Warn("check signature failed")
 		p.logger.Info("start download")
-		err = utils.Download(ctx, execPath, config.Sha256, config.DownloadUrls, config.Type)
+		dctx, span := p.startSpan(ctx, SpanDownload)
+		span.SetAttributes(attribute.Int("download.urls", len(config.DownloadUrls)))
+		err = utils.DownloadWithLimit(dctx, execPath, config.Sha256, config.DownloadUrls, config.Type, int(config.DownloadLimit))
+		endSpan(span, err)
 		if err != nil {
 			p.logger.Error("download failed:", err)
 			return
 		}
 		p.logger.Info("download success")
+		// the download is checked by sha256 only, the signature may be a
+		// stronger one
+		sign := config.GetSignature()
+		if sign == "" {
+			sign = config.GetSha256()
+		}
+		if err = utils.CheckSignature(execPath, sign); err != nil {
+			p.logger.Error("check signature of the download failed:", err)
+			return
+		}
+	}
+	// run from a read-only copy, so replacing the binary on disk does not
+	// affect the running plugin
+	p.execPath = execPath
+	if config.GetImmutable() {
+		_, span := p.startSpan(ctx, SpanVerify)
+		span.SetAttributes(attribute.Bool("verify.copy", true))
+		p.execPath, err = utils.CopyVerified(execPath, p.workdir, "."+p.Name()+"-", config.Signature)
+		endSpan(span, err)
+		if err != nil {
+			p.logger.Error("verified copy failed:", err)
+			return
+		}
+	}
+	cmd := exec.Command(p.execPath)
+	child.attach(cmd)
+	passAgentID(cmd)
+	offerFraming(cmd)
+	offerChunking(cmd, readBufferSize(&config))
+	// the plugin falls back to the pipe without the ring
+	if size := config.GetRingBufferSize(); size > 0 {
+		if f, rerr := p.openRing(int(size)); rerr != nil {
+			p.logger.Error("ring setup, receive from the pipe: ", rerr)
+		} else {
+			defer f.Close()
+			attachRing(cmd, f)
+		}
 	}
-	cmd := exec.Command(execPath)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	cmd.ExtraFiles = append(cmd.ExtraFiles, tx_r, rx_w)
 	cmd.Dir = p.workdir
-	if errFile, err = os.OpenFile(execPath+".stderr", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o0600); err != nil {
-		p.logger.Error("open stderr:", errFile)
+	if p.stderr, err = p.openStdLog(".stderr"); err != nil {
+		p.logger.Error("open stderr:", err)
+		return
+	}
+	if p.stdout, err = p.openStdLog(".stdout"); err != nil {
+		p.logger.Error("open stdout:", err)
 		return
 	}
-	defer errFile.Close()
-	cmd.Stderr = errFile
+	cmd.Stderr, cmd.Stdout = p.stderr, p.stdout
+	cmd.WaitDelay = stdWaitDelay
 	// details. if it is needed
 	if config.Detail != "" {
 		cmd.Env = append(cmd.Env, "DETAIL="+config.Detail)
 	}
+	var runAs *pluginUser
+	if name := config.GetUser(); name != "" {
+		if runAs, err = p.setupUser(name, config.GetGroup()); errors.Is(err, errUserUnsupported) {
+			p.logger.Error("run as the agent user: ", err)
+			err = nil
+		} else if err != nil {
+			p.logger.Error("user setup:", err)
+			p.removeCopy()
+			return
+		}
+	}
+	sandboxed := false
+	// the plugin is never run with more privileges than configured, it fails
+	// to start where the sandbox is not supported
+	if needSandbox(&config) {
+		if err = sandboxCommand(cmd, &config, runAs); err != nil {
+			p.logger.Error("sandbox setup:", err)
+			p.removeCopy()
+			return
+		}
+		sandboxed = true
+	}
+	// the sandbox switches to the user by itself
+	if runAs != nil && !sandboxed {
+		setCredential(cmd, runAs)
+	}
+	if runAs != nil {
+		cmd.Dir = p.dataDir()
+	}
+	// the startup deadline may be exceeded by download or verification
+	if err = ctx.Err(); err != nil {
+		p.logger.Error("cmd start canceled:", err)
+		p.removeCopy()
+		return
+	}
+	// a plugin without limits is better than none, it's not fatal
+	if needCgroup(&config) {
+		if p.cgroup, err = newCgroup(p.Name(), &config); err != nil {
+			p.logger.Error("cgroup setup failed, run without limits:", err)
+			err = nil
+		}
+	}
 	p.logger.Info("cmd start")
+	_, span = p.startSpan(ctx, SpanStart)
 	err = cmd.Start()
 	if err != nil {
 		p.logger.Error("cmd start:", err)
+		p.removeCopy()
+		p.removeCgroup()
+	} else {
+		span.SetAttributes(attribute.Int("process.pid", cmd.Process.Pid))
+		if p.cgroup != nil {
+			if cerr := p.cgroup.add(cmd.Process.Pid); cerr != nil {
+				p.logger.Error("cgroup add failed, run without limits:", cerr)
+			}
+		}
+		// formatted once, since they are stamped on every record
+		p.startAt = time.Now()
+		p.lastHeartbeat = p.startAt.UnixNano()
+		p.pidTag = strconv.Itoa(cmd.Process.Pid)
+		p.startTag = strconv.FormatInt(p.startAt.UnixNano(), 10)
 	}
+	endSpan(span, err)
 	p.cmd = cmd
 	return
 }
 
+// StartedAt returns when the process is started
+func (p *Plugin) StartedAt() time.Time { return p.startAt }
+
+// ExecPath returns the path of the binary the plugin runs from, integrity
+// checks should compare against it
+func (p *Plugin) ExecPath() string { return p.execPath }
+
+// closeRing unmaps the ring, which must not be read anymore
+func (p *Plugin) closeRing() {
+	if p.ring == nil {
+		return
+	}
+	p.ringOnce.Do(func() {
+		if err := p.ring.Unmap(); err != nil {
+			p.logger.Warn("unmap ring failed: ", err)
+		}
+	})
+}
+
+func (p *Plugin) closePipes() {
+	if p.rx != nil {
+		p.rx.Close()
+	}
+	if p.tx != nil {
+		p.tx.Close()
+	}
+}
+
+// removeCopy removes the verified copy of the binary if it's used
+func (p *Plugin) removeCopy() {
+	if p.execPath != "" && p.execPath != path.Join(p.workdir, p.Name()) {
+		os.Remove(p.execPath)
+	}
+}
+
+// removeCgroup removes the dedicated cgroup if it's created
+func (p *Plugin) removeCgroup() {
+	if p.cgroup == nil {
+		return
+	}
+	if err := p.cgroup.remove(); err != nil {
+		p.logger.Warn("remove cgroup failed: ", err)
+	}
+}
+
 func (p *Plugin) Wait() (err error) {
 	defer p.wg.Done()
 	err = p.cmd.Wait()
+	p.closeStdLogs()
+	// nothing is written to the ring anymore, it's read till empty
+	if p.ring != nil {
+		p.ring.Stop()
+	}
+	// records may be still in the pipe, they are read before it's closed.
+	// the ring is unmapped by Receive once it returns, even after the timeout
+	select {
+	case <-p.received:
+	case <-time.After(receiveDrainTimeout):
+	}
 	p.rx.Close()
 	p.tx.Close()
-	close(p.done)
+	p.removeCopy()
+	p.removeCgroup()
+	p.doneOnce.Do(func() { close(p.done) })
 	return
 }
 
@@ -134,31 +443,143 @@ func (p *Plugin) GetState() (RxSpeed, TxSpeed, RxTPS, TxTPS float64) {
 		TxTPS = float64(atomic.SwapUint64(&p.txCnt, 0)) / float64(instant)
 	}
 	p.updateTime = now
+	p.lastState.Store([4]float64{RxSpeed, TxSpeed, RxTPS, TxTPS})
 	return
 }
 
+// LastState returns the rates of the last GetState without starting a new
+// window, zeros before the first one
+func (p *Plugin) LastState() (RxSpeed, TxSpeed, RxTPS, TxTPS float64) {
+	if state, ok := p.lastState.Load().([4]float64); ok {
+		RxSpeed, TxSpeed, RxTPS, TxTPS = state[0], state[1], state[2], state[3]
+	}
+	return
+}
+
+// GetTaskState returns the average and max task write latency since last
+// call, and whether the plugin has been a slow task consumer in this window
+func (p *Plugin) GetTaskState() (avg, max time.Duration, slow bool) {
+	if cnt := atomic.SwapUint64(&p.taskLatencyCnt, 0); cnt != 0 {
+		avg = time.Duration(atomic.SwapUint64(&p.taskLatency, 0) / cnt)
+	}
+	max = time.Duration(atomic.SwapUint64(&p.taskLatencyMax, 0))
+	slow = atomic.SwapInt32(&p.slowConsumer, 0) == 1
+	return
+}
+
+// IsSlowConsumer reports whether any task write in current stat window
+// exceeds the slow task threshold
+func (p *Plugin) IsSlowConsumer() bool { return atomic.LoadInt32(&p.slowConsumer) == 1 }
+
+func (p *Plugin) slowTaskThreshold() time.Duration {
+	if t := p.config.GetSlowTaskThreshold(); t > 0 {
+		return time.Duration(t) * time.Millisecond
+	}
+	return defaultSlowTaskThreshold
+}
+
+func (p *Plugin) recordTaskLatency(d time.Duration) {
+	atomic.AddUint64(&p.taskLatency, uint64(d))
+	atomic.AddUint64(&p.taskLatencyCnt, 1)
+	for {
+		max := atomic.LoadUint64(&p.taskLatencyMax)
+		if uint64(d) <= max || atomic.CompareAndSwapUint64(&p.taskLatencyMax, max, uint64(d)) {
+			break
+		}
+	}
+	if d > p.slowTaskThreshold() {
+		if atomic.SwapInt32(&p.slowConsumer, 1) == 0 {
+			p.logger.Warnf("slow task consumer, task write latency %s", d)
+		}
+	}
+}
+
+// NeedRestart decides whether an exited plugin should be restarted. A plugin
+// shutdown on purpose is never restarted, a one-shot plugin is restarted only
+// if it exits abnormally and a long-running plugin is restarted on any exit.
+func (p *Plugin) NeedRestart() bool {
+	if !p.IsExited() || atomic.LoadInt32(&p.stopped) == 1 {
+		return false
+	}
+	if p.config.GetOneshot() {
+		return p.ExitCode() != 0
+	}
+	return true
+}
+
+// ExitCode returns the exit code of the exited plugin, -1 if it's still
+// running or terminated by a signal
+func (p *Plugin) ExitCode() int {
+	if !p.IsExited() {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
 func (p *Plugin) Name() string { return p.config.Name }
 
 func (p *Plugin) Version() string { return p.config.Version }
 
 func (p *Plugin) Pid() int { return p.cmd.Process.Pid }
 
-// get the state by fork status
-func (p *Plugin) IsExited() bool { return p.cmd.ProcessState != nil }
+// get the state by the done channel, which is closed once the process is
+// reaped. Reading cmd.ProcessState directly races with cmd.Wait.
+func (p *Plugin) IsExited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
 
+// Shutdown is safe to be called multiple times and concurrently with Wait.
+// Concurrent callers are serialized, and all return after the plugin exits.
 func (p *Plugin) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	p.ShutdownContext(ctx)
+}
+
+// ShutdownContext closes the pipes and waits for the plugin to drain, the
+// process group is killed once the context is done
+func (p *Plugin) ShutdownContext(ctx context.Context) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	atomic.StoreInt32(&p.stopped, 1)
 	if p.IsExited() {
 		return
 	}
 	p.logger.Info("shutdown called")
+	// a stopped process never reads the EOF
+	if err := p.resume(); err != nil {
+		p.logger.Warn("resume before shutdown failed: ", err)
+	}
+	_, span := p.startSpan(ctx, SpanDrain)
+	defer span.End()
+	timeout := taskFlushTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		timeout = time.Millisecond
+	}
+	// the task in hand is written before the pipe is closed
+	if err := p.stopTask(timeout); err != nil {
+		p.logger.Warn("stop tasks failed: ", err)
+		span.RecordError(err)
+	}
+	if err := p.flushTask(timeout); err != nil {
+		p.logger.Warn("flush tasks failed: ", err)
+		span.RecordError(err)
+	}
 	p.tx.Close()
 	p.rx.Close()
 	select {
-	case <-time.After(time.Second * 30):
+	case <-ctx.Done():
 		p.logger.Warn("close by killing start")
-		syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+		span.SetAttributes(attribute.Bool("drain.killed", true))
+		p.killGroup()
 		<-p.done
 		p.logger.Info("close by killing done")
 	case <-p.done:
@@ -166,18 +587,84 @@ func (p *Plugin) Shutdown() {
 	}
 }
 
+// Pause stops the process group of the plugin until Resume is called, by
+// SIGSTOP, or by suspending the process on Windows. Records and tasks stay
+// in the pipes in the meantime.
+func (p *Plugin) Pause() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.IsExited() || atomic.LoadInt32(&p.paused) == 1 {
+		return
+	}
+	if err = p.stopGroup(); err != nil {
+		return
+	}
+	atomic.StoreInt32(&p.paused, 1)
+	p.logger.Info("plugin paused")
+	return
+}
+
+func (p *Plugin) Resume() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resume()
+}
+
+func (p *Plugin) resume() (err error) {
+	if p.IsExited() || atomic.LoadInt32(&p.paused) == 0 {
+		return
+	}
+	if err = p.continueGroup(); err != nil {
+		return
+	}
+	atomic.StoreInt64(&p.lastHeartbeat, time.Now().UnixNano())
+	atomic.StoreInt32(&p.paused, 0)
+	p.logger.Info("plugin resumed")
+	return
+}
+
+func (p *Plugin) IsPaused() bool { return atomic.LoadInt32(&p.paused) == 1 }
+
 func (p *Plugin) Receive() {
 	var (
-		rec *proto.Record
-		err error
+		recs = make([]*proto.Record, 0, 64)
+		err  error
 	)
 	defer p.wg.Done()
+	defer func() {
+		p.closeRing()
+		close(p.received)
+	}()
+	if p.ring != nil {
+		ringDone := make(chan struct{})
+		go func() {
+			defer close(ringDone)
+			p.receiveRing()
+		}()
+		defer func() { <-ringDone }()
+	}
 	for {
-		if rec, err = p.receiveDataWithSize(); err != nil {
+		p.throttle()
+		recs, err = p.receiveAvailable(recs[:0])
+		// records before the error are sent anyway
+		p.transmit(recs)
+		if err != nil {
 			if errors.Is(err, bufio.ErrBufferFull) {
 				// problem of multi
 				p.logger.Warn("buffer full, skip")
 				continue
+			} else if errors.Is(err, framing.ErrFrameTooLarge) {
+				// the payload is left in the pipe, no way to resync
+				p.logger.Error("exit the receive task, frame is too large")
+				break
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				// no frame within the read timeout, check and read again
+				select {
+				case <-p.done:
+					return
+				default:
+					continue
+				}
 				// any error about close or EOF, it's done
 			} else if !(errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed)) {
 				p.logger.Error("receive err:", err)
@@ -187,82 +674,402 @@ func (p *Plugin) Receive() {
 				break
 			}
 		}
+	}
+}
+
+// transmit sends the batch of records, the transmitter is not swapped
+// in the middle of a batch
+func (p *Plugin) transmit(recs []*proto.Record) {
+	if len(recs) == 0 {
+		return
+	}
+	filter, _ := p.filter.Load().(*fieldFilter)
+	p.tmu.RLock()
+	defer p.tmu.RUnlock()
+	p.probeReady(time.Now())
+	for _, rec := range recs {
 		// fmt.Println(rec)
-		transport.DTransfer.Transmission(rec, false)
+		p.transmitRecord(filter, rec)
 	}
 }
 
+// transmitRecord drops the record if the transmission panics, so one
+// malformed record never stops the receive loop
+func (p *Plugin) transmitRecord(filter *fieldFilter, rec *proto.Record) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&p.transmitPanics, 1)
+			p.logger.Errorf("transmission panic, record of data_type %d is dropped: %v", rec.GetDataType(), r)
+		}
+	}()
+	if rec = p.handleChunk(rec); rec == nil {
+		return
+	}
+	if p.handleClock(rec, time.Now()) || p.handleHeartbeat(rec, time.Now()) ||
+		p.handleCheckpoint(rec) || p.handleTaskResult(rec, time.Now()) ||
+		p.handleCapabilities(rec, time.Now()) {
+		return
+	}
+	if p.rateLimited(time.Now()) {
+		return
+	}
+	flag, drop := p.checkType(rec)
+	if drop {
+		return
+	}
+	p.correctClock(rec)
+	filter.Apply(rec)
+	if flag {
+		flagUnknown(rec)
+	}
+	p.tagInstance(rec)
+	p.enrichContainer(rec)
+	rec.Plugin = p.Name()
+	p.transmitter.Transmission(rec, false)
+}
+
+// tagInstance stamps the record with the process instance, so records are
+// distinguishable across restarts. It's applied after the field filter.
+func (p *Plugin) tagInstance(rec *proto.Record) {
+	if !p.config.GetTagInstance() {
+		return
+	}
+	if rec.Data == nil {
+		rec.Data = &proto.Payload{}
+	}
+	if rec.Data.Fields == nil {
+		rec.Data.Fields = make(map[string]string, 2)
+	}
+	rec.Data.Fields["plugin_pid"] = p.pidTag
+	rec.Data.Fields["plugin_start"] = p.startTag
+}
+
+// Restarts returns how many times the plugin has been restarted after crashes
+func (p *Plugin) Restarts() uint64 { return atomic.LoadUint64(&p.restarts) }
+
+// TransmitPanics returns the count of records dropped by panics
+func (p *Plugin) TransmitPanics() uint64 { return atomic.LoadUint64(&p.transmitPanics) }
+
 func (p *Plugin) Task() {
 	var err error
 	defer p.wg.Done()
+	defer close(p.taskStopped)
+	var flush <-chan time.Time
+	if p.writer != nil && p.config.GetTaskBatch() {
+		ticker := time.NewTicker(taskFlushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	if err = p.restoreCheckpoint(); err != nil {
+		p.logger.Warn("restore checkpoint failed: ", err)
+	}
+	retry := time.NewTimer(0)
+	defer retry.Stop()
 	for {
 		select {
 		case <-p.done:
 			return
-		case task := <-p.taskCh:
-			s := task.Size()
-			var dst = make([]byte, 4+s)
-			_, err = task.MarshalToSizedBuffer(dst[4:])
-			if err != nil {
-				p.logger.Errorf("task: %+v, err: %v", task, err)
-				continue
-			}
-			binary.LittleEndian.PutUint32(dst[:4], uint32(s))
-			var n int
-			n, err = p.tx.Write(dst)
-			if err != nil {
+		case stopped := <-p.stopTaskCh:
+			close(stopped)
+			return
+		case <-flush:
+			if err = p.flushTask(0); err != nil {
 				if !errors.Is(err, os.ErrClosed) {
-					p.logger.Error("when sending task, an error occurred: ", err)
+					p.logger.Error("when flushing task, an error occurred: ", err)
 				}
 				return
 			}
-			atomic.AddUint64(&p.txCnt, 1)
-			atomic.AddUint64(&p.txBytes, uint64(n))
+			continue
+		case <-p.tasks.ready:
+		case <-retry.C:
+		}
+		entry, expired, wait := p.tasks.pop(time.Now())
+		for _, e := range expired {
+			p.taskRejected(&e.Task, errTaskExpired)
+		}
+		if entry == nil {
+			if wait > 0 {
+				retry.Reset(wait)
+			}
+			continue
+		}
+		task := entry.Task
+		var dst []byte
+		if dst, err = p.encodeTask(&task); err != nil {
+			p.logger.Errorf("task: %+v, err: %v", task, err)
+			p.tasks.done(entry)
+			p.taskRejected(&task, err)
+			p.tasks.notify()
+			continue
+		}
+		var n int
+		n, err = p.writeTask(dst)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				p.logger.Error("when sending task, an error occurred: ", err)
+			}
+			// retried by the next instance once the plugin is restarted
+			if !p.tasks.retry(entry, time.Now()) {
+				p.taskRejected(&task, errTaskUndelivered)
+			}
+			return
+		}
+		p.tasks.done(entry)
+		atomic.AddUint64(&p.txCnt, 1)
+		atomic.AddUint64(&p.txBytes, uint64(n))
+		p.recordTaskLatency(time.Since(entry.QueuedAt))
+		p.taskDelivered(&task)
+		// the next one, if any
+		p.tasks.notify()
+	}
+}
+
+// writeTask writes the frame to the plugin. With a buffered writer, it's
+// flushed immediately unless tasks are batched.
+func (p *Plugin) writeTask(dst []byte) (n int, err error) {
+	if p.writer == nil {
+		return p.tx.Write(dst)
+	}
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if n, err = p.writer.Write(dst); err != nil {
+		return
+	}
+	if !p.config.GetTaskBatch() {
+		err = p.writer.Flush()
+	}
+	return
+}
+
+// stopTask waits until Task writes the task in hand and returns, no more
+// tasks are accepted then. It times out if the plugin doesn't read.
+func (p *Plugin) stopTask(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	stopped := make(chan struct{})
+	select {
+	case p.stopTaskCh <- stopped:
+	case <-p.taskStopped:
+		return nil
+	case <-timer.C:
+		return errStopTaskTimeout
+	}
+	select {
+	case <-stopped:
+		return nil
+	case <-timer.C:
+		return errStopTaskTimeout
+	}
+}
+
+// flushTask flushes the buffered tasks, bounded by timeout if it's set and
+// the fd supports write deadline
+func (p *Plugin) flushTask(timeout time.Duration) (err error) {
+	if p.writer == nil {
+		return
+	}
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if p.writer.Buffered() == 0 {
+		return
+	}
+	if f, ok := p.tx.(interface{ SetWriteDeadline(time.Time) error }); ok && timeout > 0 {
+		if f.SetWriteDeadline(time.Now().Add(timeout)) == nil {
+			defer f.SetWriteDeadline(time.Time{})
 		}
 	}
+	return p.writer.Flush()
 }
 
 // In Elkeid, receiveData get the data by decoding the data by self-code
 // which performs better. For now, we work in an native way.
 func (p *Plugin) receiveDataWithSize() (rec *proto.Record, err error) {
-	var l uint32
-	err = binary.Read(p.reader, binary.LittleEndian, &l)
-	if err != nil {
+	if err = p.waitFrame(); err != nil {
 		return
 	}
-	// TODO: sync.Pool
-	rec = &proto.Record{}
-	// TODO: sync.Pool, discard by cap
-	// issues: https://github.com/golang/go/issues/23199
-	// solutions: https://github.com/golang/go/blob/7e394a2/src/net/http/h2_bundle.go#L998-L1043
-	message := make([]byte, int(l))
-	if _, err = io.ReadFull(p.reader, message); err != nil {
+	return p.readFrame()
+}
+
+// receiveAvailable receives a record, blocks if needed, and then drains all
+// the complete frames in the buffer without going back to the kernel. A
+// partial trailing frame is kept buffered for the next call.
+func (p *Plugin) receiveAvailable(recs []*proto.Record) ([]*proto.Record, error) {
+	rec, err := p.receiveDataWithSize()
+	if err != nil {
+		return recs, err
+	}
+	return p.drainFrames(p.reader, &p.frameBuf, append(recs, rec))
+}
+
+// drainFrames reads the complete frames in the buffer of r
+func (p *Plugin) drainFrames(r *bufio.Reader, buf *[]byte, recs []*proto.Record) ([]*proto.Record, error) {
+	for frameBuffered(r, p.recordFraming()) {
+		rec, err := p.readFrameFrom(r, buf)
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// frameBuffered reports whether a complete frame is in the buffer. A
+// corrupted header is left to the next read.
+func frameBuffered(r *bufio.Reader, opts *framing.Options) bool {
+	n, size := r.Buffered(), framing.HeaderSize(opts)
+	if n < size {
+		return false
+	}
+	header, err := r.Peek(size)
+	if err != nil {
+		return false
+	}
+	h, err := framing.ParseHeader(header, opts)
+	return err == nil && uint64(n-size) >= h.Size
+}
+
+// maxRecordSize bounds the frame from plugins. A larger frame is never
+// allocated, and the stream is considered corrupted.
+var maxRecordSize = 32 * 1024 * 1024
+
+// readFrame reads a record from the pool. The record goes back to the pool
+// after it's sent by the transport.
+func (p *Plugin) readFrame() (rec *proto.Record, err error) {
+	return p.readFrameFrom(p.reader, &p.frameBuf)
+}
+
+// readFrameFrom decodes the message borrowed by nextFrame, which is fine
+// since Unmarshal copies all the strings and bytes
+func (p *Plugin) readFrameFrom(r *bufio.Reader, buf *[]byte) (rec *proto.Record, err error) {
+	var message []byte
+	if message, err = p.nextRecordFrame(r, buf); err != nil {
 		return
 	}
+	rec = pool.Get()
 	if err = rec.Unmarshal(message); err != nil {
+		pool.Put(rec)
+		rec = nil
 		return
 	}
 	// Incr for plugin status
 	atomic.AddUint64(&p.txCnt, 1)
-	atomic.AddUint64(&p.txBytes, uint64(l))
+	atomic.AddUint64(&p.txBytes, uint64(len(message)))
 	return
 }
 
+// nextFrame returns the payload of the next frame without a copy if the frame
+// fits in the buffer of r. A larger one is read into buf, which grows to the
+// largest frame and is reused. The payload is valid until the next read. The
+// header is not consumed if it's bad or too large, and a frame of a
+// mismatched checksum is consumed.
+func nextFrame(r *bufio.Reader, buf *[]byte, maxSize int, opts *framing.Options) ([]byte, error) {
+	headerSize := framing.HeaderSize(opts)
+	header, err := r.Peek(headerSize)
+	if err != nil {
+		return nil, truncated(r, err)
+	}
+	h, err := framing.ParseHeader(header, opts)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && h.Size > uint64(maxSize) {
+		return nil, framing.ErrFrameTooLarge
+	}
+	size := int(h.Size)
+	if headerSize+size <= r.Size() {
+		// nothing is consumed until the whole frame is there, so a read
+		// deadline in the middle loses nothing
+		frame, err := r.Peek(headerSize + size)
+		if err != nil {
+			return nil, truncated(r, err)
+		}
+		r.Discard(len(frame))
+		return frame[headerSize:], h.Verify(frame[headerSize:], opts)
+	}
+	r.Discard(headerSize)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	payload := (*buf)[:size]
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, h.Verify(payload, opts)
+}
+
+// truncated drops the partial frame left at EOF, so the next read gets EOF
+func truncated(r *bufio.Reader, err error) error {
+	if err == io.EOF && r.Buffered() != 0 {
+		r.Discard(r.Buffered())
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// waitFrame blocks until the length prefix of the next frame is buffered. If
+// read timeout is configured, it returns os.ErrDeadlineExceeded when nothing
+// arrives in time. Peek never consumes, so a partial prefix stays buffered.
+func (p *Plugin) waitFrame() (err error) {
+	timeout := time.Duration(p.config.GetReadTimeout()) * time.Millisecond
+	f, ok := p.rx.(interface{ SetReadDeadline(time.Time) error })
+	if timeout <= 0 || !ok {
+		return
+	}
+	// deadline is not supported by the fd, just block on the read
+	if f.SetReadDeadline(time.Now().Add(timeout)) != nil {
+		return
+	}
+	defer f.SetReadDeadline(time.Time{})
+	_, err = p.reader.Peek(framing.PrefixSize)
+	return
+}
+
+// SendTask queues the task for the plugin, it fails only if the queue is
+// full. The task is delivered even if the plugin is restarting. TaskCancel
+// of a task still queued is done by the agent, the plugin never sees either.
 func (p *Plugin) SendTask(task proto.Task) (err error) {
-	select {
-	case p.taskCh <- task:
-	default:
-		err = errors.New("plugin is processing task or context has been canceled")
+	// the plugin is upgraded, the task goes to the new version
+	if next, ok := p.successor.Load().(*Plugin); ok {
+		return next.SendTask(task)
+	}
+	if p.cancelQueued(&task) {
+		return nil
+	}
+	expired, err := p.tasks.push(task, time.Now())
+	for _, e := range expired {
+		p.taskRejected(&e.Task, errTaskExpired)
 	}
 	return
 }
 
+// QueuedTasks returns the tasks not written to the plugin yet
+func (p *Plugin) QueuedTasks() int { return p.tasks.Len() }
+
+// GetWorkingDirectory returns the workdir of the plugin, the one run as
+// another user runs in DataDir of it
 func (p *Plugin) GetWorkingDirectory() string {
-	return p.cmd.Dir
+	return p.workdir
+}
+
+// resyncCh requests a sync of the last configs pushed by the server, once
+// the local config changes
+var resyncCh = make(chan struct{}, 1)
+
+// Resync syncs the plugins again with the last configs pushed by the server,
+// merged with the local config in use. Nothing is done before the first push.
+func Resync() {
+	select {
+	case resyncCh <- struct{}{}:
+	default:
+	}
 }
 
 func init() {
 	go func() {
+		var last map[string]*proto.Config
 		for {
 			select {
 			case task := <-transport.PluginTaskChan:
@@ -270,15 +1077,39 @@ func init() {
 				if plg, ok := DefaultManager.Get(task.GetObjectName()); ok {
 					if err := plg.SendTask(*task); err != nil {
 						zap.S().Error("send task to plugin: ", err)
+						DefaultManager.taskRejected(task, err)
 					}
 				} else {
 					zap.S().Error("can't find plugin: ", task.GetObjectName())
+					DefaultManager.taskRejected(task, errPluginNotFound)
 				}
 			case cfgs := <-transport.PluginConfigChan:
-				if err := DefaultManager.Sync(cfgs); err != nil {
-					zap.S().Error("config sync failed: ", err)
+				last = cfgs
+				syncConfigs(conf.Current().Merge(cfgs))
+			case <-resyncCh:
+				if last == nil {
+					continue
 				}
+				syncConfigs(conf.Current().Merge(last))
 			}
 		}
 	}()
 }
+
+// syncConfigs syncs the plugins with the configs, and transmits the result
+// of each plugin once it's done, so the server knows whether the configs
+// pushed have taken effect
+func syncConfigs(cfgs map[string]*proto.Config) {
+	result, err := DefaultManager.SyncWithResult(cfgs)
+	if err != nil {
+		zap.S().Error("config sync failed: ", err)
+		return
+	}
+	go func() {
+		r := <-result
+		for name, err := range r.Failed {
+			zap.S().Errorf("plugin %s is not synced: %s", name, err)
+		}
+		DefaultManager.emitSyncEvent(r)
+	}()
+}
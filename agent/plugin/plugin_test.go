@@ -0,0 +1,822 @@
+package plugin
+
+import (
+	"agent/proto"
+	"agent/transport"
+	"agent/transport/pool"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/framing"
+	"go.uber.org/zap"
+)
+
+type slowWriter struct{ delay time.Duration }
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return len(b), nil
+}
+
+func (w *slowWriter) Close() error { return nil }
+
+// restartDelay is set once for all tests, plugins restarted by one test may
+// still be supervised when the next one starts
+func TestMain(m *testing.M) {
+	// the test binary drops the privileges of sandboxed plugins
+	if _, ok := os.LookupEnv(SandboxEnv); ok {
+		ExecSandboxed()
+	}
+	restartDelay = 10 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+func newTestPlugin(config proto.Config) *Plugin {
+	return &Plugin{
+		config:      config,
+		updateTime:  time.Now(),
+		done:        make(chan struct{}),
+		received:    make(chan struct{}),
+		readyCh:     make(chan struct{}),
+		tasks:       newTaskQueue(""),
+		stopTaskCh:  make(chan chan struct{}),
+		taskStopped: make(chan struct{}),
+		wg:          &sync.WaitGroup{},
+		logger:      zap.S(),
+	}
+}
+
+// sendTask retries since SendTask never blocks on the full task queue
+func sendTask(t *testing.T, p *Plugin, task proto.Task) {
+	deadline := time.Now().Add(time.Second)
+	for p.SendTask(task) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("send task timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitTasksWritten(t *testing.T, p *Plugin, n uint64) {
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint64(&p.txCnt) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tasks written, expect %d", atomic.LoadUint64(&p.txCnt), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test", SlowTaskThreshold: 10})
+	p.tx = &slowWriter{delay: 50 * time.Millisecond}
+	p.wg.Add(1)
+	go p.Task()
+	defer func() {
+		close(p.done)
+		p.wg.Wait()
+	}()
+	sendTask(t, p, proto.Task{DataType: 1, ObjectName: "test"})
+	sendTask(t, p, proto.Task{DataType: 2, ObjectName: "test"})
+	// the second one waits in the queue for the first write
+	waitTasksWritten(t, p, 2)
+	if !p.IsSlowConsumer() {
+		t.Fatal("slow consumer flag is not set")
+	}
+	avg, max, slow := p.GetTaskState()
+	if !slow || max < 50*time.Millisecond || avg == 0 {
+		t.Fatalf("unexpected task state: avg %s, max %s, slow %v", avg, max, slow)
+	}
+	if p.IsSlowConsumer() {
+		t.Fatal("slow consumer flag should be reset by GetTaskState")
+	}
+}
+
+func TestLastState(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test"})
+	if rx, _, _, _ := p.LastState(); rx != 0 {
+		t.Fatalf("unexpected state before GetState: %f", rx)
+	}
+	p.updateTime = time.Now().Add(-time.Second)
+	atomic.AddUint64(&p.rxCnt, 100)
+	_, _, rxTPS, _ := p.GetState()
+	// the window is not reset by LastState
+	for i := 0; i < 2; i++ {
+		if _, _, last, _ := p.LastState(); last != rxTPS || last == 0 {
+			t.Fatalf("last rx tps %f, expect %f", last, rxTPS)
+		}
+	}
+}
+
+// writeTestPlugin writes a shell script as the plugin binary under the
+// workdir of the default manager and returns the matching config
+func writeTestPlugin(t *testing.T, name, script string) proto.Config {
+	return writeTestPluginAt(t, DefaultManager.Workdir, name, script)
+}
+
+func writeTestPluginAt(t *testing.T, workdir, name, script string) proto.Config {
+	dir := filepath.Join(workdir, "plugin", name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("#!/bin/sh\n" + script + "\n")
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	return proto.Config{Name: name, Version: "1.0.0", Sha256: hex.EncodeToString(sum[:])}
+}
+
+func waitExited(t *testing.T, p *Plugin) {
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin does not exit")
+	}
+	p.wg.Wait()
+}
+
+func TestOneshotNoRestart(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer DefaultManager.UnregisterAll()
+	config := writeTestPlugin(t, "oneshot", "exit 0")
+	config.Oneshot = true
+	if err := Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := DefaultManager.Get("oneshot")
+	waitExited(t, plg)
+	if plg.NeedRestart() {
+		t.Fatal("one-shot plugin exits cleanly should not be restarted")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if loaded, _ := DefaultManager.Get("oneshot"); loaded != plg {
+		t.Fatal("one-shot plugin has been restarted")
+	}
+}
+
+func TestStdWaitDelay(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer DefaultManager.UnregisterAll()
+	// the child holds stderr after the plugin exits
+	config := writeTestPlugin(t, "detached", "sleep 10 >&2 &\nexit 0")
+	config.Oneshot = true
+	if err := Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := DefaultManager.Get("detached")
+	defer plg.killGroup()
+	waitExited(t, plg)
+}
+
+func TestLongRunningRestart(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer DefaultManager.UnregisterAll()
+	defer cancel()
+	config := writeTestPlugin(t, "longrun", "exit 1")
+	if err := Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := DefaultManager.Get("longrun")
+	waitExited(t, plg)
+	if !plg.NeedRestart() {
+		t.Fatal("long-running plugin exits unexpectedly should be restarted")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if loaded, ok := DefaultManager.Get("longrun"); ok && loaded != plg {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("long-running plugin is not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	for crashes, expected := range map[int]time.Duration{
+		0:  time.Second,
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		7:  time.Minute,
+		64: time.Minute,
+	} {
+		if delay := restartBackoff(time.Second, time.Minute, crashes); delay != expected {
+			t.Fatalf("%d crashes: delay %s, expect %s", crashes, delay, expected)
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	p := newTestPlugin(proto.Config{Name: "test", ReadTimeout: 50})
+	p.rx = r
+	p.reader = bufio.NewReader(r)
+	start := time.Now()
+	if _, err = p.receiveDataWithSize(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("read does not unblock at the deadline: %s", elapsed)
+	}
+	rec := &proto.Record{DataType: 1000, Timestamp: 1}
+	buf, _ := rec.Marshal()
+	frame := make([]byte, 4+len(buf))
+	binary.LittleEndian.PutUint32(frame, uint32(len(buf)))
+	copy(frame[4:], buf)
+	// a partial prefix times out as well, and is kept for the next read
+	w.Write(frame[:2])
+	if _, err = p.receiveDataWithSize(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	w.Write(frame[2:])
+	got, err := p.receiveDataWithSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DataType != rec.DataType {
+		t.Fatalf("unexpected record: %v", got)
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test"})
+	frame := make([]byte, 4)
+	binary.LittleEndian.PutUint32(frame, uint32(maxRecordSize+1))
+	p.reader = bufio.NewReader(bytes.NewReader(frame))
+	if _, err := p.receiveDataWithSize(); !errors.Is(err, framing.ErrFrameTooLarge) {
+		t.Fatalf("expect frame too large, got %v", err)
+	}
+}
+
+func runningNames() (names []string) {
+	for _, plg := range DefaultManager.GetAll() {
+		if !plg.IsExited() {
+			names = append(names, plg.Name())
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func TestMaxPlugins(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer DefaultManager.UnregisterAll()
+	defer func() { DefaultManager.MaxPlugins, DefaultManager.Preempt = 0, false }()
+	cfgs := map[string]*proto.Config{}
+	for i, name := range []string{"p0", "p1", "p2", "p3"} {
+		// the plugin blocks until the agent closes the task pipe
+		config := writeTestPlugin(t, name, "exec cat <&3 >/dev/null")
+		config.Priority = int32(i)
+		cfgs[name] = &config
+	}
+	DefaultManager.MaxPlugins = 2
+	DefaultManager.syncPlugins(ctx, map[string]*proto.Config{"p0": cfgs["p0"], "p1": cfgs["p1"]})
+	if names := runningNames(); len(names) != 2 || names[0] != "p0" || names[1] != "p1" {
+		t.Fatalf("unexpected running plugins: %v", names)
+	}
+	// running plugins keep their slots without preemption
+	DefaultManager.syncPlugins(ctx, cfgs)
+	if names := runningNames(); len(names) != 2 || names[0] != "p0" || names[1] != "p1" {
+		t.Fatalf("unexpected running plugins: %v", names)
+	}
+	DefaultManager.Preempt = true
+	DefaultManager.syncPlugins(ctx, cfgs)
+	if names := runningNames(); len(names) != 2 || names[0] != "p2" || names[1] != "p3" {
+		t.Fatalf("unexpected running plugins: %v", names)
+	}
+}
+
+func TestMaxPluginsLowered(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	cfgs := map[string]*proto.Config{}
+	for i, name := range []string{"p0", "p1", "p2", "p3"} {
+		cfgs[name] = &proto.Config{Name: name, Priority: int32(i)}
+	}
+	// more running than the cap lowered to
+	m.Register("p0", newTestPlugin(*cfgs["p0"]))
+	m.Register("p1", newTestPlugin(*cfgs["p1"]))
+	m.MaxPlugins = 1
+	load, evict, skipped := m.schedule(cfgs)
+	if len(load) != 2 || load[0].Name != "p1" || load[1].Name != "p0" || len(evict) != 0 {
+		t.Fatalf("running plugins are not kept: %v, %v", load, evict)
+	}
+	if len(skipped) != 2 || skipped[0] != "p3" || skipped[1] != "p2" {
+		t.Fatalf("unexpected skipped plugins: %v", skipped)
+	}
+}
+
+func TestSyncWithResult(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go Startup(ctx, wg)
+	defer wg.Wait()
+	defer cancel()
+	good := writeTestPlugin(t, "good", "exec cat <&3 >/dev/null")
+	// no binary and no download url, the load fails
+	bad := proto.Config{Name: "bad", Version: "1.0.0", Sha256: good.Sha256}
+	result, err := DefaultManager.SyncWithResult(map[string]*proto.Config{"good": &good, "bad": &bad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-result:
+		if len(r.Loaded) != 1 || r.Loaded[0] != "good" {
+			t.Fatalf("unexpected loaded plugins: %v", r.Loaded)
+		}
+		if len(r.Failed) != 1 || r.Failed["bad"] == nil {
+			t.Fatalf("unexpected failed plugins: %v", r.Failed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync result timeout")
+	}
+}
+
+func TestSyncConfigs(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	transmitter := newRecordTransmitter()
+	DefaultManager.Transmitter = transmitter
+	defer func() { DefaultManager.Transmitter = transport.DTransfer }()
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go Startup(ctx, wg)
+	defer wg.Wait()
+	defer cancel()
+	good := writeTestPlugin(t, "good", "exec cat <&3 >/dev/null")
+	bad := proto.Config{Name: "bad", Version: "1.0.0", Sha256: good.Sha256}
+	transport.PluginConfigChan <- map[string]*proto.Config{"good": &good, "bad": &bad}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case rec := <-transmitter.agent:
+			fields := rec.GetData().GetFields()
+			if fields["event"] != EventSynced {
+				continue
+			}
+			if fields["loaded"] != "good" || !strings.HasPrefix(fields["failed"], "bad:") {
+				t.Fatalf("unexpected sync result: %v", fields)
+			}
+			return
+		case <-timeout:
+			t.Fatal("sync result is not transmitted")
+		}
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer DefaultManager.UnregisterAll()
+	config := writeTestPlugin(t, "immutable", "exec cat <&3 >/dev/null")
+	config.Immutable = true
+	if err := Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := DefaultManager.Get("immutable")
+	original := filepath.Join(plg.workdir, plg.Name())
+	if plg.ExecPath() == original {
+		t.Fatal("plugin is not running from a copy")
+	}
+	if info, err := os.Stat(plg.ExecPath()); err != nil || info.Mode().Perm()&0o222 != 0 {
+		t.Fatalf("copy is not read-only: %v", err)
+	}
+	// replace the original binary with one exits immediately
+	if err := os.WriteFile(original, []byte("#!/bin/sh\nexit 1\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if plg.IsExited() {
+		t.Fatal("running plugin is affected by replacing the binary")
+	}
+	plg.Shutdown()
+	plg.wg.Wait()
+	if _, err := os.Stat(plg.ExecPath()); !os.IsNotExist(err) {
+		t.Fatal("copy is not removed after exit")
+	}
+}
+
+func benchmarkTaskWrite(b *testing.B, config proto.Config) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	go io.Copy(io.Discard, r)
+	p := newTestPlugin(config)
+	p.tx = w
+	if size := config.GetTaskBufferSize(); size > 0 {
+		p.writer = bufio.NewWriterSize(w, int(size))
+	}
+	task := &proto.Task{DataType: 1, ObjectName: "test", Data: "data"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst, _ := proto.EncodeTask(task)
+		if _, err = p.writeTask(dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err = p.flushTask(0); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	w.Close()
+}
+
+func BenchmarkTaskWrite(b *testing.B) {
+	b.Run("unbuffered", func(b *testing.B) {
+		benchmarkTaskWrite(b, proto.Config{})
+	})
+	b.Run("buffered", func(b *testing.B) {
+		benchmarkTaskWrite(b, proto.Config{TaskBufferSize: 64 * 1024})
+	})
+	b.Run("batched", func(b *testing.B) {
+		benchmarkTaskWrite(b, proto.Config{TaskBufferSize: 64 * 1024, TaskBatch: true})
+	})
+}
+
+func TestConcurrentShutdown(t *testing.T) {
+	DefaultManager.Workdir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := writeTestPlugin(t, "shutdown", "exit 0")
+	config.Oneshot = true
+	for i := 0; i < 20; i++ {
+		plg, err := NewPlugin(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plg.wg.Add(3)
+		go plg.Wait()
+		go plg.Receive()
+		go plg.Task()
+		wg := &sync.WaitGroup{}
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				plg.Shutdown()
+			}()
+		}
+		wg.Wait()
+		if !plg.IsExited() {
+			t.Fatal("plugin is not exited after shutdown")
+		}
+		plg.wg.Wait()
+		plg.Shutdown()
+	}
+}
+
+func TestSetTransmissionTarget(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	old, target := newRecordTransmitter(), newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.rx = r
+	p.reader = bufio.NewReader(r)
+	p.transmitter = old
+	p.wg.Add(1)
+	go p.Receive()
+	send := func(dataType int32) {
+		frame, _ := proto.EncodeRecord(&proto.Record{DataType: dataType})
+		if _, err := w.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(ch chan *proto.Record, dataType int32) {
+		select {
+		case rec := <-ch:
+			if rec.DataType != dataType {
+				t.Fatalf("unexpected record: %v", rec)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("record %d is not transmitted", dataType)
+		}
+	}
+	for i := int32(1000); i < 1010; i++ {
+		send(i)
+	}
+	for i := int32(1000); i < 1010; i++ {
+		expect(old.plugin, i)
+	}
+	p.SetTransmissionTarget(target)
+	for i := int32(1010); i < 1020; i++ {
+		send(i)
+	}
+	for i := int32(1010); i < 1020; i++ {
+		expect(target.plugin, i)
+	}
+	if len(old.plugin) != 0 {
+		t.Fatal("record is sent to the old target after the swap")
+	}
+	r.Close()
+	p.wg.Wait()
+}
+
+func TestReceiveAvailable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.rx = r
+	p.reader = bufio.NewReader(r)
+	var burst []byte
+	for i := int32(0); i < 3; i++ {
+		frame, _ := proto.EncodeRecord(&proto.Record{DataType: i})
+		burst = append(burst, frame...)
+	}
+	last, _ := proto.EncodeRecord(&proto.Record{DataType: 3, Timestamp: 1})
+	// three complete frames and a partial one in a single write
+	w.Write(append(burst, last[:len(last)-1]...))
+	recs, err := p.receiveAvailable(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("unexpected records: %v", recs)
+	}
+	for i, rec := range recs {
+		if rec.DataType != int32(i) {
+			t.Fatalf("unexpected record: %v", rec)
+		}
+	}
+	// the partial frame is kept and completed by the next read
+	w.Write(last[len(last)-1:])
+	if recs, err = p.receiveAvailable(recs[:0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].DataType != 3 || recs[0].Timestamp != 1 {
+		t.Fatalf("unexpected records: %v", recs)
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	small, _ := proto.EncodeRecord(&proto.Record{DataType: 1})
+	large, _ := proto.EncodeRecord(&proto.Record{DataType: 2, Data: &proto.Payload{
+		Fields: map[string]string{"large": strings.Repeat("x", 64)},
+	}})
+	stream := append(append(append([]byte{}, small...), large...), small[:3]...)
+	r := bufio.NewReaderSize(bytes.NewReader(stream), 16)
+	var buf []byte
+	// the small frame is borrowed from the buffer of the reader
+	payload, err := nextFrame(r, &buf, maxRecordSize, nil)
+	if err != nil || !bytes.Equal(payload, small[framing.PrefixSize:]) || buf != nil {
+		t.Fatalf("unexpected small frame %v, %v", payload, err)
+	}
+	// the large one does not fit, it's read into buf
+	if payload, err = nextFrame(r, &buf, maxRecordSize, nil); err != nil || !bytes.Equal(payload, large[framing.PrefixSize:]) {
+		t.Fatalf("unexpected large frame %v, %v", payload, err)
+	}
+	if cap(buf) != len(payload) {
+		t.Fatalf("buffer is not reused, cap %d", cap(buf))
+	}
+	// the partial frame is dropped at EOF
+	if _, err = nextFrame(r, &buf, maxRecordSize, nil); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error of partial frame: %v", err)
+	}
+	if _, err = nextFrame(r, &buf, maxRecordSize, nil); err != io.EOF {
+		t.Fatalf("unexpected error after partial frame: %v", err)
+	}
+	r = bufio.NewReader(bytes.NewReader(large))
+	if _, err = nextFrame(r, &buf, 8, nil); err != framing.ErrFrameTooLarge {
+		t.Fatalf("frame over the limit is read: %v", err)
+	}
+}
+
+// readCounter counts the reads which go to the kernel
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *readCounter) Read(b []byte) (int, error) {
+	c.reads++
+	return c.r.Read(b)
+}
+
+// writeCounter counts the writes of the plugin to the pipe
+type writeCounter struct {
+	w      io.Writer
+	writes int64
+}
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.w.Write(b)
+}
+
+// benchmarkReceive reports the syscalls of both ends of the pipe per record.
+// The plugin writes a record at a time, the reads fewer than the writes are
+// the frames of several writes taken by one read.
+func benchmarkReceive(b *testing.B, drain bool) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	const burst = 32
+	var frames [][]byte
+	for i := 0; i < burst; i++ {
+		frame, _ := proto.EncodeRecord(&proto.Record{DataType: 1000, Timestamp: 1, Data: &proto.Payload{
+			Fields: map[string]string{"exe": "/usr/bin/bash", "argv": "bash -c id"},
+		}})
+		frames = append(frames, frame)
+	}
+	p := newTestPlugin(proto.Config{Name: "test", ReadTimeout: 1000})
+	reads := &readCounter{r: r}
+	writes := &writeCounter{w: w}
+	p.rx = r
+	p.reader = bufio.NewReaderSize(reads, 1024*128)
+	n := (b.N + burst - 1) / burst
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		defer w.Close()
+		for i := 0; i < n; i++ {
+			for _, frame := range frames {
+				writes.Write(frame)
+			}
+		}
+	}()
+	var recs []*proto.Record
+	b.ReportAllocs()
+	b.ResetTimer()
+	for received := 0; received < n*burst; {
+		if drain {
+			recs, err = p.receiveAvailable(recs[:0])
+			received += len(recs)
+		} else {
+			_, err = p.receiveDataWithSize()
+			received++
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	<-written
+	b.ReportMetric(float64(reads.reads)/float64(n*burst), "reads/record")
+	b.ReportMetric(float64(atomic.LoadInt64(&writes.writes))/float64(n*burst), "writes/record")
+}
+
+func BenchmarkReceive(b *testing.B) {
+	b.Run("one-frame", func(b *testing.B) {
+		benchmarkReceive(b, false)
+	})
+	b.Run("available", func(b *testing.B) {
+		benchmarkReceive(b, true)
+	})
+}
+
+// BenchmarkReadFrame compares the frame borrowed by readFrame with the
+// pooled buffer and the plain allocation. The record is put back as the
+// transport does after sending.
+func BenchmarkReadFrame(b *testing.B) {
+	fields := make(map[string]string, 20)
+	for i := 0; i < 20; i++ {
+		fields["field_"+strconv.Itoa(i)] = strings.Repeat("x", 64)
+	}
+	frame, _ := proto.EncodeRecord(&proto.Record{DataType: 1000, Timestamp: 1, Data: &proto.Payload{Fields: fields}})
+	run := func(b *testing.B, read func(r *bufio.Reader) error) {
+		r := bufio.NewReader(&loopReader{frame: frame})
+		b.SetBytes(int64(len(frame)))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := read(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("alloc", func(b *testing.B) {
+		run(b, func(r *bufio.Reader) error {
+			message, err := framing.ReadFrame(r, maxRecordSize, nil)
+			if err != nil {
+				return err
+			}
+			return (&proto.Record{}).Unmarshal(message)
+		})
+	})
+	b.Run("pool", func(b *testing.B) {
+		run(b, func(r *bufio.Reader) error {
+			message, err := framing.ReadFrame(r, maxRecordSize, nil)
+			if err != nil {
+				return err
+			}
+			rec := pool.Get()
+			err = rec.Unmarshal(message)
+			pool.Put(rec)
+			return err
+		})
+	})
+	b.Run("borrow", func(b *testing.B) {
+		p := newTestPlugin(proto.Config{Name: "test"})
+		run(b, func(r *bufio.Reader) error {
+			p.reader = r
+			rec, err := p.readFrame()
+			pool.Put(rec)
+			return err
+		})
+	})
+}
+
+// loopReader reads the frame over and over
+type loopReader struct {
+	frame []byte
+	off   int
+}
+
+func (l *loopReader) Read(b []byte) (n int, err error) {
+	for n < len(b) {
+		c := copy(b[n:], l.frame[l.off:])
+		n += c
+		l.off = (l.off + c) % len(l.frame)
+	}
+	return
+}
+
+// panicTransmitter panics on the record of the given data type
+type panicTransmitter struct {
+	*recordTransmitter
+	dataType int32
+}
+
+func (p *panicTransmitter) Transmission(rec *proto.Record, important bool) error {
+	if rec.DataType == p.dataType {
+		var fields map[string]string
+		fields["boom"] = "boom"
+	}
+	return p.recordTransmitter.Transmission(rec, important)
+}
+
+func TestTransmissionPanic(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &panicTransmitter{recordTransmitter: newRecordTransmitter(), dataType: 13}
+	p := newTestPlugin(proto.Config{Name: "test"})
+	p.rx = r
+	p.reader = bufio.NewReader(r)
+	p.transmitter = target
+	p.wg.Add(1)
+	go p.Receive()
+	for _, dataType := range []int32{12, 13, 14, 13, 15} {
+		frame, _ := proto.EncodeRecord(&proto.Record{DataType: dataType})
+		w.Write(frame)
+	}
+	for _, dataType := range []int32{12, 14, 15} {
+		select {
+		case rec := <-target.plugin:
+			if rec.DataType != dataType {
+				t.Fatalf("unexpected record: %v", rec)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("record %d is not transmitted", dataType)
+		}
+	}
+	if n := p.TransmitPanics(); n != 2 {
+		t.Fatalf("unexpected panic count: %d", n)
+	}
+	w.Close()
+	p.wg.Wait()
+}
@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"time"
+)
+
+// how often the health of transport is checked for the fail-closed policy
+var healthInterval = 5 * time.Second
+
+// transportReady reports whether plugins are allowed to run by the policy
+func (m *Manager) transportReady() bool {
+	if !m.FailClosed {
+		return true
+	}
+	if h, ok := m.Transmitter.(IHealth); ok {
+		return h.IsHealthy()
+	}
+	return true
+}
+
+// applyPolicy pauses or resumes all the plugins by the transport health
+func (m *Manager) applyPolicy(ready bool) {
+	if !m.FailClosed {
+		return
+	}
+	for _, plg := range m.GetAll() {
+		var err error
+		if ready {
+			err = plg.Resume()
+		} else {
+			err = plg.Pause()
+		}
+		if err != nil {
+			plg.logger.Error("apply transport policy: ", err)
+		}
+	}
+}
+
+// doSync syncs the plugins with the configs, and sends the result to all
+// the callers waiting, which share it
+func (m *Manager) doSync(ctx context.Context, cfgs map[string]*proto.Config, waiters []chan *SyncResult) {
+	result := m.syncPlugins(ctx, cfgs)
+	for _, w := range waiters {
+		w <- result
+	}
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type healthTransmitter struct {
+	*recordTransmitter
+	healthy int32
+}
+
+func (h *healthTransmitter) IsHealthy() bool { return atomic.LoadInt32(&h.healthy) == 1 }
+
+func (h *healthTransmitter) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&h.healthy, 1)
+	} else {
+		atomic.StoreInt32(&h.healthy, 0)
+	}
+}
+
+// processStopped reads the state of the process, T for stopped
+func processStopped(t *testing.T, plg *Plugin) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(plg.cmd.Process.Pid) + "/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return fields[0] == "T"
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startPolicyManager(t *testing.T, failClosed bool) (*Manager, *healthTransmitter, *proto.Config) {
+	healthInterval = 10 * time.Millisecond
+	transmitter := &healthTransmitter{recordTransmitter: newRecordTransmitter()}
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	m.FailClosed = failClosed
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go m.Startup(ctx, wg)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	config := writeTestPluginAt(t, m.Workdir, "policy", "exec cat <&3 >/dev/null")
+	return m, transmitter, &config
+}
+
+func TestFailClosed(t *testing.T) {
+	m, transmitter, config := startPolicyManager(t, true)
+	result, err := m.SyncWithResult(map[string]*proto.Config{"policy": config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-result:
+		t.Fatal("plugins are synced while transport is down")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, ok := m.Get("policy"); ok {
+		t.Fatal("plugin is started while transport is down")
+	}
+	transmitter.setHealthy(true)
+	select {
+	case r := <-result:
+		if len(r.Loaded) != 1 {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deferred sync is not done after transport recovers")
+	}
+	plg, _ := m.Get("policy")
+	transmitter.setHealthy(false)
+	waitFor(t, "plugin is not paused", func() bool { return plg.IsPaused() && processStopped(t, plg) })
+	transmitter.setHealthy(true)
+	waitFor(t, "plugin is not resumed", func() bool { return !plg.IsPaused() && !processStopped(t, plg) })
+	// a paused plugin shuts down without being killed
+	transmitter.setHealthy(false)
+	waitFor(t, "plugin is not paused", plg.IsPaused)
+	start := time.Now()
+	plg.Shutdown()
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("paused plugin is killed on shutdown")
+	}
+}
+
+func TestFailClosedWaiters(t *testing.T) {
+	m, transmitter, config := startPolicyManager(t, true)
+	first, err := m.SyncWithResult(map[string]*proto.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first is taken by the manager, and deferred
+	var second <-chan *SyncResult
+	waitFor(t, "sync is not accepted", func() bool {
+		second, err = m.SyncWithResult(map[string]*proto.Config{"policy": config})
+		return err == nil
+	})
+	// a health check before the second is taken would sync the first alone
+	waitFor(t, "sync is not taken", func() bool { return len(m.syncCh) == 0 })
+	transmitter.setHealthy(true)
+	// the latest configs are synced, the result goes to both
+	for _, result := range []<-chan *SyncResult{first, second} {
+		select {
+		case r := <-result:
+			if len(r.Loaded) != 1 || r.Loaded[0] != "policy" {
+				t.Fatalf("unexpected result: %+v", r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("caller of the deferred sync is not answered")
+		}
+	}
+}
+
+func TestFailOpen(t *testing.T) {
+	m, _, config := startPolicyManager(t, false)
+	result, err := m.SyncWithResult(map[string]*proto.Config{"policy": config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-result:
+		if len(r.Loaded) != 1 {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugins are not synced while transport is down")
+	}
+	plg, _ := m.Get("policy")
+	time.Sleep(100 * time.Millisecond)
+	if plg.IsPaused() || processStopped(t, plg) {
+		t.Fatal("plugin is paused with fail-open policy")
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// childPipes are the ends of the plugin side, tasks are read from fd 3 and
+// records are written to fd 4
+type childPipes struct {
+	task   *os.File
+	record *os.File
+}
+
+// newPipes creates the pipes of the plugin, the agent reads records from rx
+// and writes tasks to tx
+func newPipes(name string) (rx io.ReadCloser, tx io.WriteCloser, child *childPipes, err error) {
+	rx_r, rx_w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	tx_r, tx_w, err := os.Pipe()
+	if err != nil {
+		rx_r.Close()
+		rx_w.Close()
+		return
+	}
+	return rx_r, tx_w, &childPipes{task: tx_r, record: rx_w}, nil
+}
+
+// attach passes the pipes to the plugin, which runs in a process group of
+// its own
+func (c *childPipes) attach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, c.task, c.record)
+}
+
+// resize sets the size of both pipes, and returns the one in effect
+func (c *childPipes) resize(size int) (actual int, err error) {
+	for _, f := range []*os.File{c.task, c.record} {
+		if actual, err = setPipeSize(f, size); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// close releases the ends of the plugin side once it's started, or fails to
+func (c *childPipes) close() {
+	if c.task != nil {
+		c.task.Close()
+	}
+	if c.record != nil {
+		c.record.Close()
+	}
+}
+
+func (p *Plugin) killGroup() error { return syscall.Kill(-p.Pid(), syscall.SIGKILL) }
+
+func (p *Plugin) stopGroup() error { return syscall.Kill(-p.Pid(), syscall.SIGSTOP) }
+
+func (p *Plugin) continueGroup() error { return syscall.Kill(-p.Pid(), syscall.SIGCONT) }
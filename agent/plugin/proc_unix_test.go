@@ -0,0 +1,48 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// isAlive reports whether the process exists, zombies are not counted since
+// orphans may never be reaped in a container
+func isAlive(pid int) bool {
+	if stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat")); err == nil {
+		if i := strings.LastIndexByte(string(stat), ')'); i > 0 && strings.HasPrefix(string(stat[i+1:]), " Z") {
+			return false
+		}
+	}
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+func TestKillGroup(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "group", "sleep 60 & echo $! >child; exec cat <&3 >/dev/null")
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("group")
+	var child int
+	waitFor(t, "child is not started", func() bool {
+		content, err := os.ReadFile(filepath.Join(m.Workdir, "plugin", "group", "child"))
+		child, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+		return err == nil && child > 0
+	})
+	// the children are killed with the plugin
+	if err := plg.killGroup(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "plugin is not killed", plg.IsExited)
+	waitFor(t, "child of the plugin is not killed", func() bool { return !isAlive(child) })
+}
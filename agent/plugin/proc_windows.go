@@ -0,0 +1,193 @@
+//go:build windows
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/chriskaliX/SDK/config"
+	"golang.org/x/sys/windows"
+)
+
+// pipe buffers, the same as the ones of the SDK
+const (
+	taskPipeBuffer   = 512 * 1024
+	recordPipeBuffer = 1024 * 1024
+)
+
+// only the owner, the agent and the plugins it runs, and SYSTEM are allowed
+const pipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;OW)"
+
+var errPipeClosed = errors.New("pipe is closed")
+
+// suffix of the pipe names, so a restart never reuses the one of the last
+// run
+var pipeSeq uint64
+
+var (
+	ntdll            = windows.NewLazySystemDLL("ntdll.dll")
+	ntSuspendProcess = ntdll.NewProc("NtSuspendProcess")
+	ntResumeProcess  = ntdll.NewProc("NtResumeProcess")
+)
+
+// namedPipe is the server end of a named pipe, in byte mode and for one
+// client only. It's connected in the background, reads and writes wait for
+// the plugin to open it.
+type namedPipe struct {
+	name      string
+	handle    windows.Handle
+	connected chan struct{}
+	// error of the connection, set before connected is closed
+	err       error
+	closeOnce sync.Once
+}
+
+func listenPipe(name string, access uint32, outSize, inSize uint32) (p *namedPipe, err error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	handle, err := windows.CreateNamedPipe(windows.StringToUTF16Ptr(name),
+		access|windows.FILE_FLAG_FIRST_PIPE_INSTANCE,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		1, outSize, inSize, 0, sa)
+	if err != nil {
+		return
+	}
+	p = &namedPipe{name: name, handle: handle, connected: make(chan struct{})}
+	go func() {
+		err := windows.ConnectNamedPipe(handle, nil)
+		if err == windows.ERROR_PIPE_CONNECTED {
+			err = nil
+		}
+		p.err = err
+		close(p.connected)
+	}()
+	return
+}
+
+func (p *namedPipe) wait() error {
+	<-p.connected
+	return p.err
+}
+
+func (p *namedPipe) Read(b []byte) (n int, err error) {
+	if err = p.wait(); err != nil {
+		return
+	}
+	var done uint32
+	err = windows.ReadFile(p.handle, b, &done, nil)
+	if err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_OPERATION_ABORTED {
+		err = io.EOF
+	}
+	return int(done), err
+}
+
+func (p *namedPipe) Write(b []byte) (n int, err error) {
+	if err = p.wait(); err != nil {
+		return
+	}
+	for n < len(b) {
+		var done uint32
+		if err = windows.WriteFile(p.handle, b[n:], &done, nil); err != nil {
+			if err == windows.ERROR_NO_DATA || err == windows.ERROR_BROKEN_PIPE {
+				err = errPipeClosed
+			}
+			return
+		}
+		n += int(done)
+	}
+	return
+}
+
+// Close unblocks the pending connection and I/O, and closes the handle
+func (p *namedPipe) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		select {
+		case <-p.connected:
+		default:
+			// the plugin never opens it, connect to unblock ConnectNamedPipe
+			if f, err := os.OpenFile(p.name, os.O_RDWR, 0); err == nil {
+				f.Close()
+			}
+		}
+		windows.CancelIoEx(p.handle, nil)
+		err = windows.CloseHandle(p.handle)
+	})
+	return err
+}
+
+// childPipes are the names of the pipes passed to the plugin in env, since
+// handles are not inherited as fd 3 and 4 on Windows
+type childPipes struct {
+	task   string
+	record string
+}
+
+// newPipes creates the named pipes of the plugin, the agent reads records
+// from rx and writes tasks to tx
+func newPipes(name string) (rx io.ReadCloser, tx io.WriteCloser, child *childPipes, err error) {
+	prefix := fmt.Sprintf(`\\.\pipe\hades-%s-%d-%d`, name, os.Getpid(), atomic.AddUint64(&pipeSeq, 1))
+	child = &childPipes{task: prefix + "-task", record: prefix + "-record"}
+	record, err := listenPipe(child.record, windows.PIPE_ACCESS_INBOUND, 0, recordPipeBuffer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	task, err := listenPipe(child.task, windows.PIPE_ACCESS_OUTBOUND, taskPipeBuffer, 0)
+	if err != nil {
+		record.Close()
+		return nil, nil, nil, err
+	}
+	return record, task, child, nil
+}
+
+// attach passes the names of the pipes to the plugin
+func (c *childPipes) attach(cmd *exec.Cmd) {
+	cmd.Env = append(cmd.Env, config.TaskPipeEnv+"="+c.task, config.RecordPipeEnv+"="+c.record)
+}
+
+// resize is not supported, the sizes of named pipes are fixed on creation
+func (c *childPipes) resize(size int) (int, error) { return 0, errPipeSizeUnsupported }
+
+// close is a no-op, the plugin opens the pipes by name
+func (c *childPipes) close() {}
+
+// killGroup terminates the job of the plugin, or the process only if it's
+// not in a job
+func (p *Plugin) killGroup() error {
+	if p.cgroup != nil {
+		return p.cgroup.kill()
+	}
+	return p.cmd.Process.Kill()
+}
+
+// stopGroup suspends the threads of the plugin process, the children are
+// not suspended
+func (p *Plugin) stopGroup() error { return callProcess(ntSuspendProcess, p.Pid()) }
+
+func (p *Plugin) continueGroup() error { return callProcess(ntResumeProcess, p.Pid()) }
+
+func callProcess(proc *windows.LazyProc, pid int) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_SUSPEND_RESUME, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(process)
+	if status, _, _ := proc.Call(uintptr(process)); status != 0 {
+		return windows.NTStatus(status)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func isAlive(pid int) bool {
+	process, err := windows.OpenProcess(windows.SYNCHRONIZE, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(process)
+	event, _ := windows.WaitForSingleObject(process, 0)
+	return event == uint32(windows.WAIT_TIMEOUT)
+}
+
+func TestNamedPipes(t *testing.T) {
+	rx, tx, child, err := newPipes("pipes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	defer tx.Close()
+	// the plugin side, as the SDK opens them
+	task, err := os.OpenFile(child.task, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer task.Close()
+	record, err := os.OpenFile(child.record, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Write([]byte("task")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(task, buf); err != nil || !bytes.Equal(buf, []byte("task")) {
+		t.Fatalf("unexpected task: %q %v", buf, err)
+	}
+	record.Write([]byte("record"))
+	record.Close()
+	if got, err := io.ReadAll(rx); err != nil || string(got) != "record" {
+		t.Fatalf("unexpected record: %q %v", got, err)
+	}
+}
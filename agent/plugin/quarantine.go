@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	errQuarantined    = errors.New("plugin is quarantined")
+	errNotQuarantined = errors.New("plugin is not quarantined")
+)
+
+// a run lasts longer than this is not considered a crash loop, and the count
+// of crashes starts over
+var crashResetUptime = time.Minute
+
+// crashState tracks the crashes in a row of a plugin version. Once it's
+// quarantined, the config and context are kept for Unquarantine.
+type crashState struct {
+	count       int
+	version     string
+	quarantined bool
+	config      proto.Config
+	ctx         context.Context
+}
+
+// recordCrash counts the unexpected exit, and quarantines the plugin if the
+// threshold is reached
+func (m *Manager) recordCrash(ctx context.Context, plg *Plugin) (crashes int, quarantined bool) {
+	m.cmu.Lock()
+	defer m.cmu.Unlock()
+	state, ok := m.crashes[plg.Name()]
+	if !ok || state.version != plg.Version() || time.Since(plg.startAt) >= crashResetUptime {
+		state = &crashState{version: plg.Version()}
+		m.crashes[plg.Name()] = state
+	}
+	state.count++
+	threshold := int(plg.config.GetQuarantineThreshold())
+	if threshold <= 0 && m.MaxRestarts > 0 {
+		threshold = m.MaxRestarts + 1
+	}
+	if threshold <= 0 || state.count < threshold {
+		return state.count, false
+	}
+	state.quarantined = true
+	state.config = plg.config
+	state.ctx = ctx
+	return state.count, true
+}
+
+// quarantine stops the plugin from being loaded again, like it crashes too
+// many times
+func (m *Manager) quarantine(ctx context.Context, plg *Plugin) {
+	m.cmu.Lock()
+	defer m.cmu.Unlock()
+	m.crashes[plg.Name()] = &crashState{
+		version:     plg.Version(),
+		quarantined: true,
+		config:      plg.config,
+		ctx:         ctx,
+	}
+}
+
+// checkQuarantine blocks loading a quarantined plugin, a new version of it
+// clears the quarantine
+func (m *Manager) checkQuarantine(config *proto.Config) error {
+	m.cmu.Lock()
+	defer m.cmu.Unlock()
+	state, ok := m.crashes[config.GetName()]
+	if !ok {
+		return nil
+	}
+	if state.version != config.GetVersion() {
+		delete(m.crashes, config.GetName())
+		return nil
+	}
+	if state.quarantined {
+		return errQuarantined
+	}
+	return nil
+}
+
+func (m *Manager) IsQuarantined(name string) bool {
+	m.cmu.Lock()
+	defer m.cmu.Unlock()
+	state, ok := m.crashes[name]
+	return ok && state.quarantined
+}
+
+// Unquarantine clears the quarantine and loads the plugin again
+func (m *Manager) Unquarantine(name string) error {
+	m.cmu.Lock()
+	state, ok := m.crashes[name]
+	if !ok || !state.quarantined {
+		m.cmu.Unlock()
+		return errNotQuarantined
+	}
+	delete(m.crashes, name)
+	m.cmu.Unlock()
+	return m.Load(state.ctx, state.config)
+}
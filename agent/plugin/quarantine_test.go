@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"testing"
+	"time"
+)
+
+func waitQuarantined(t *testing.T, m *Manager, transmitter *recordTransmitter, name string) {
+	waitFor(t, "plugin is not quarantined", func() bool { return m.IsQuarantined(name) })
+	for {
+		select {
+		case rec := <-transmitter.agent:
+			if rec.Data.Fields["event"] != EventQuarantined {
+				continue
+			}
+			if rec.Data.Fields["name"] != name || rec.Data.Fields["crashes"] != "3" {
+				t.Fatalf("unexpected event: %v", rec)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("no quarantine event")
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "broken", "exit 1")
+	config.QuarantineThreshold = 3
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	waitQuarantined(t, m, transmitter, "broken")
+	// no restart anymore
+	plg, _ := m.Get("broken")
+	time.Sleep(100 * time.Millisecond)
+	if loaded, _ := m.Get("broken"); loaded != plg {
+		t.Fatal("quarantined plugin is restarted")
+	}
+	// the same version is still quarantined by config sync
+	result := m.syncPlugins(ctx, map[string]*proto.Config{"broken": &config})
+	if err := result.Failed["broken"]; err != errQuarantined {
+		t.Fatalf("expect quarantined, got %v", err)
+	}
+	// a new version clears it
+	config.Version = "1.0.1"
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := m.Get("broken"); loaded == plg {
+		t.Fatal("new version is not loaded")
+	}
+	waitQuarantined(t, m, transmitter, "broken")
+	// and it's cleared manually
+	plg, _ = m.Get("broken")
+	if err := m.Unquarantine("broken"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := m.Get("broken"); loaded == plg {
+		t.Fatal("plugin is not loaded after unquarantine")
+	}
+	if err := m.Unquarantine("unknown"); err != errNotQuarantined {
+		t.Fatalf("expect not quarantined, got %v", err)
+	}
+}
+
+func TestCrashCountReset(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	plg := newTestPlugin(proto.Config{Name: "test", Version: "1.0.0", QuarantineThreshold: 2})
+	plg.startAt = time.Now()
+	if _, quarantined := m.recordCrash(context.Background(), plg); quarantined {
+		t.Fatal("quarantined at the first crash")
+	}
+	// a long run is not a crash loop
+	plg.startAt = time.Now().Add(-crashResetUptime)
+	if crashes, quarantined := m.recordCrash(context.Background(), plg); quarantined || crashes != 1 {
+		t.Fatalf("crash count is not reset: %d, %v", crashes, quarantined)
+	}
+}
+
+func TestMaxRestarts(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	m.MaxRestarts = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	if err := m.Load(ctx, writeTestPluginAt(t, m.Workdir, "flapping", "exit 1")); err != nil {
+		t.Fatal(err)
+	}
+	waitQuarantined(t, m, transmitter, "flapping")
+	plg, _ := m.Get("flapping")
+	if n := plg.Restarts(); n != 2 {
+		t.Fatalf("restarted %d times, expect 2", n)
+	}
+}
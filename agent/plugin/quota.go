@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"agent/resource"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DiskQuota returns the disk_quota of the workdir in bytes, 0 for no limit
+func (p *Plugin) DiskQuota() int64 { return p.config.GetDiskQuota() }
+
+// removable reports whether the file in the workdir may be removed when the
+// disk quota is exceeded, they are the rotated stderr and stdout files and
+// the temp files
+func (p *Plugin) removable(rel string, info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	if strings.HasPrefix(rel, "tmp"+string(filepath.Separator)) {
+		return true
+	}
+	if filepath.Dir(rel) != "." {
+		return false
+	}
+	if filepath.Ext(rel) == ".tmp" {
+		return true
+	}
+	for _, suffix := range []string{".stderr", ".stdout"} {
+		if matched, _ := filepath.Match(p.Name()+"-*"+suffix, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupWorkdir removes the removable files and returns the bytes freed
+func (p *Plugin) cleanupWorkdir() (freed uint64) {
+	filepath.Walk(p.workdir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(p.workdir, name)
+		if err != nil || !p.removable(rel, info) {
+			return nil
+		}
+		if os.Remove(name) == nil {
+			freed += uint64(info.Size())
+		}
+		return nil
+	})
+	return
+}
+
+// checkQuota measures the workdirs of the running plugins with disk_quota.
+// The removable files go first, and the plugin still exceeding the quota is
+// shut down and quarantined, until a new version or Unquarantine.
+func (m *Manager) checkQuota(ctx context.Context) {
+	for _, plg := range m.GetAll() {
+		quota := uint64(plg.config.GetDiskQuota())
+		if quota == 0 || plg.IsExited() {
+			continue
+		}
+		usage := resource.GetDirSize(plg.workdir, "")
+		if usage <= quota {
+			continue
+		}
+		freed := plg.cleanupWorkdir()
+		plg.logger.Warnf("workdir uses %d bytes over the quota %d, %d bytes are cleaned up", usage, quota, freed)
+		if usage -= freed; usage <= quota {
+			continue
+		}
+		plg.logger.Errorf("workdir uses %d bytes over the quota %d after the cleanup, shut down", usage, quota)
+		m.quarantine(ctx, plg)
+		m.emitEvent(EventQuotaExceeded, map[string]string{
+			"name":       plg.Name(),
+			"pversion":   plg.Version(),
+			"disk_usage": strconv.FormatUint(usage, 10),
+			"disk_quota": strconv.FormatUint(quota, 10),
+		})
+		go plg.Shutdown()
+	}
+}
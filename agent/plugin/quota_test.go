@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckQuota(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// a plugin keeping its data in the workdir
+	config := writeTestPluginAt(t, m.Workdir, "quota", "exec cat <&3 >/dev/null")
+	config.DiskQuota = 64 * 1024
+	workdir := filepath.Join(m.Workdir, "plugin", "quota")
+	write := func(name string, size int) {
+		name = filepath.Join(workdir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("quota")
+	// the rotated logs and temp files are removed, the plugin keeps running
+	write("quota-2022-01-01T00-00-00.000.stderr", 32*1024)
+	write("tmp/cache", 32*1024)
+	write("data.tmp", 32*1024)
+	write("data", 16*1024)
+	m.checkQuota(ctx)
+	for _, name := range []string{"quota-2022-01-01T00-00-00.000.stderr", "tmp/cache", "data.tmp"} {
+		if _, err := os.Stat(filepath.Join(workdir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s is not removed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "data")); err != nil {
+		t.Fatal(err)
+	}
+	if plg.IsExited() || m.IsQuarantined("quota") {
+		t.Fatal("plugin within the quota after the cleanup is stopped")
+	}
+	// nothing to clean up
+	write("data", 128*1024)
+	m.checkQuota(ctx)
+	select {
+	case rec := <-transmitter.agent:
+		if rec.Data.Fields["event"] != EventQuotaExceeded {
+			t.Fatalf("unexpected event: %v", rec.Data.Fields)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event of quota exceeded")
+	}
+	waitExited(t, plg)
+	if !m.IsQuarantined("quota") {
+		t.Fatal("plugin over the quota is not quarantined")
+	}
+	if err := m.Load(ctx, config); err != errQuarantined {
+		t.Fatalf("plugin over the quota is loaded again: %v", err)
+	}
+}
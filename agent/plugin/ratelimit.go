@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"agent/proto"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newRecordLimiter returns nil if record_rate_limit is not configured. The
+// bucket starts full, so the plugin is not limited by the records at startup
+// within the burst.
+func newRecordLimiter(config *proto.Config) *rate.Limiter {
+	limit := config.GetRecordRateLimit()
+	if limit <= 0 {
+		return nil
+	}
+	burst := config.GetRecordBurst()
+	if burst <= 0 {
+		burst = limit
+	}
+	return rate.NewLimiter(rate.Limit(limit), int(burst))
+}
+
+// SetRateLimit replaces the token bucket of records, it takes effect from
+// the next record with a full bucket
+func (p *Plugin) SetRateLimit(config *proto.Config) {
+	p.limiter.Store(recordLimiter{newRecordLimiter(config)})
+}
+
+// recordLimiter wraps the limiter, atomic.Value can't store a nil
+type recordLimiter struct {
+	*rate.Limiter
+}
+
+// rateLimited counts the record over the limit, and reports whether it's
+// dropped. It warns once the plugin starts to be limited.
+func (p *Plugin) rateLimited(now time.Time) bool {
+	l, _ := p.limiter.Load().(recordLimiter)
+	if l.Limiter == nil || l.AllowN(now, 1) {
+		atomic.StoreInt32(&p.limited, 0)
+		return false
+	}
+	atomic.AddUint64(&p.rateLimitedRecords, 1)
+	if atomic.CompareAndSwapInt32(&p.limited, 0, 1) {
+		p.logger.Warnf("records over %v/s are dropped", l.Limit())
+	}
+	return true
+}
+
+// RateLimitedRecords returns the count of records dropped by the rate limit
+func (p *Plugin) RateLimitedRecords() uint64 { return atomic.LoadUint64(&p.rateLimitedRecords) }
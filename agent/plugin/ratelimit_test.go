@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"agent/proto"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestRateLimit(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "flood", RecordRateLimit: 1, RecordBurst: 3})
+	p.transmitter = transmitter
+	p.SetRateLimit(&p.config)
+	var recs []*proto.Record
+	for i := 0; i < 5; i++ {
+		recs = append(recs, &proto.Record{DataType: 1000})
+	}
+	// heartbeats are never limited
+	recs = append(recs, &proto.Record{DataType: config.DTPluginHeartbeat})
+	p.transmit(recs)
+	if len(transmitter.plugin) != 3 || p.RateLimitedRecords() != 2 {
+		t.Fatalf("%d records are forwarded, %d are dropped", len(transmitter.plugin), p.RateLimitedRecords())
+	}
+	if p.LastHeartbeat().UnixNano() == 0 {
+		t.Fatal("heartbeat is dropped")
+	}
+	// the limit is lifted by the hot reload
+	p.SetRateLimit(&proto.Config{})
+	p.transmit(recs[:5])
+	if len(transmitter.plugin) != 8 || p.RateLimitedRecords() != 2 {
+		t.Fatalf("%d records are forwarded, %d are dropped", len(transmitter.plugin), p.RateLimitedRecords())
+	}
+}
+
+func TestRecordLimiter(t *testing.T) {
+	if newRecordLimiter(&proto.Config{}) != nil {
+		t.Fatal("limiter without record_rate_limit")
+	}
+	if l := newRecordLimiter(&proto.Config{RecordRateLimit: 100}); l == nil || l.Burst() != 100 {
+		t.Fatal("burst should be a second of the limit")
+	}
+}
@@ -0,0 +1,29 @@
+package plugin
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// probeReady is the startup probe. Any record, the clock sync reply as well,
+// shows the plugin is up and the pipe works, so EventReady is emitted on the
+// first one. tmu must be held.
+func (p *Plugin) probeReady(now time.Time) {
+	if atomic.LoadInt32(&p.ready) == 1 || !atomic.CompareAndSwapInt32(&p.ready, 0, 1) {
+		return
+	}
+	fields := map[string]string{
+		"name":     p.Name(),
+		"pversion": p.Version(),
+		"pid":      p.pidTag,
+	}
+	if !p.startAt.IsZero() {
+		fields["time_to_ready"] = strconv.FormatFloat(now.Sub(p.startAt).Seconds(), 'f', 3, 64)
+	}
+	p.transmitter.TransmitAgent(newEventRecord(EventReady, fields), false)
+	close(p.readyCh)
+}
+
+// IsReady reports whether the plugin has passed the startup probe
+func (p *Plugin) IsReady() bool { return atomic.LoadInt32(&p.ready) == 1 }
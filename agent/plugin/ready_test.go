@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadyEvent(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// two records of data_type 1000 in separate writes
+	if err := m.Load(ctx, writeTestPluginAt(t, m.Workdir, "ready", `printf '\003\000\000\000\010\350\007' >&4
+sleep 0.1
+printf '\003\000\000\000\010\350\007' >&4
+exec cat <&3 >/dev/null`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(ctx, writeTestPluginAt(t, m.Workdir, "broken", "exit 1")); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("ready")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-transmitter.plugin:
+		case <-time.After(time.Second):
+			t.Fatal("record is not transmitted")
+		}
+	}
+	if !plg.IsReady() {
+		t.Fatal("plugin is not ready after records")
+	}
+	ready := 0
+	for {
+		select {
+		case rec := <-transmitter.agent:
+			if rec.Data.Fields["event"] != EventReady {
+				continue
+			}
+			if rec.Data.Fields["name"] != "ready" {
+				t.Fatalf("ready event of the plugin failing to start: %v", rec)
+			}
+			if rec.Data.Fields["pid"] != strconv.Itoa(plg.Pid()) || rec.Data.Fields["time_to_ready"] == "" {
+				t.Fatalf("unexpected ready event: %v", rec)
+			}
+			ready++
+			continue
+		case <-time.After(200 * time.Millisecond):
+		}
+		break
+	}
+	if ready != 1 {
+		t.Fatalf("ready event is emitted %d times", ready)
+	}
+	if broken, _ := m.Get("broken"); broken.IsReady() {
+		t.Fatal("plugin failing to start is ready")
+	}
+}
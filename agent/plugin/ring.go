@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/config"
+	"github.com/chriskaliX/SDK/framing"
+)
+
+var errRingUnsupported = errors.New("record ring is not supported on this platform")
+
+// attachRing passes the file of the ring to the plugin, the fd is by the
+// order in ExtraFiles
+func attachRing(cmd *exec.Cmd, f *os.File) {
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, config.RecordRingEnv+"="+strconv.Itoa(2+len(cmd.ExtraFiles)))
+}
+
+// RingAttached reports whether the plugin writes records to the ring
+func (p *Plugin) RingAttached() bool { return atomic.LoadInt32(&p.ringAttached) == 1 }
+
+// receiveRing receives the records from the ring along with the pipe, which
+// is not used by a plugin attached to the ring. It returns once the ring is
+// drained after the plugin exits.
+func (p *Plugin) receiveRing() {
+	reader := bufio.NewReaderSize(p.ring, readBufferSize(&p.config))
+	recs := make([]*proto.Record, 0, 64)
+	var buf []byte
+	for {
+		p.throttle()
+		rec, err := p.readFrameFrom(reader, &buf)
+		if err == nil {
+			recs = append(recs[:0], rec)
+			recs, err = p.drainFrames(reader, &buf, recs)
+			if atomic.CompareAndSwapInt32(&p.ringAttached, 0, 1) {
+				p.logger.Info("records are received from the ring")
+			}
+		}
+		p.transmit(recs)
+		recs = recs[:0]
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if errors.Is(err, framing.ErrFrameTooLarge) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// no way to resync, the blocked plugin gets an error
+			p.logger.Error("exit the ring receive task:", err)
+			p.ring.CloseRead()
+			return
+		}
+		p.logger.Error("ring receive err:", err)
+	}
+}
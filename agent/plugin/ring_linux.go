@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"os"
+
+	"github.com/chriskaliX/SDK/ring"
+	"golang.org/x/sys/unix"
+)
+
+// openRing creates the ring in a memfd of the size, which is passed to the
+// plugin. The file is closed once the plugin is started, the mapping stays.
+// The size is sealed, so the plugin can't truncate it under the mapping.
+func (p *Plugin) openRing(size int) (*os.File, error) {
+	fd, err := unix.MemfdCreate("hades-"+p.Name(), unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "ring")
+	if err = f.Truncate(int64(ring.Size(size))); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW); err != nil {
+		f.Close()
+		return nil, err
+	}
+	mem, err := ring.Map(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if p.ring, err = ring.Init(mem); err != nil {
+		unix.Munmap(mem)
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
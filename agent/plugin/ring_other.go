@@ -0,0 +1,7 @@
+//go:build !linux
+
+package plugin
+
+import "os"
+
+func (p *Plugin) openRing(size int) (*os.File, error) { return nil, errRingUnsupported }
@@ -0,0 +1,108 @@
+//go:build linux
+
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRingReceive(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		script string
+		ring   bool
+	}{
+		// writes a record frame of data_type 1000 to the ring by the file,
+		// then moves the head and marks it attached
+		{"ring", `f=/proc/self/fd/$HADES_RECORD_RING
+printf '\003\000\000\000\010\350\007' | dd of=$f bs=1 seek=4096 conv=notrunc 2>/dev/null
+printf '\001' | dd of=$f bs=1 seek=192 conv=notrunc 2>/dev/null
+printf '\007' | dd of=$f bs=1 seek=64 conv=notrunc 2>/dev/null
+exec cat <&3 >/dev/null`, true},
+		// a plugin of the old SDK ignores the ring
+		{"pipe", `printf '\003\000\000\000\010\350\007' >&4
+exec cat <&3 >/dev/null`, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			transmitter := newRecordTransmitter()
+			m := NewManager(t.TempDir(), "hades-agent", transmitter)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			config := writeTestPluginAt(t, m.Workdir, c.name, c.script)
+			config.RingBufferSize = 1
+			if err := m.Load(ctx, config); err != nil {
+				t.Fatal(err)
+			}
+			defer m.UnregisterAll()
+			select {
+			case rec := <-transmitter.plugin:
+				if rec.DataType != 1000 {
+					t.Fatalf("unexpected record: %v", rec)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no record is transmitted")
+			}
+			plg, _ := m.Get(c.name)
+			if plg.RingAttached() != c.ring {
+				t.Fatalf("ring attached %v, expect %v", plg.RingAttached(), c.ring)
+			}
+		})
+	}
+}
+
+func TestRingUnmapAfterDrainTimeout(t *testing.T) {
+	timeout := receiveDrainTimeout
+	receiveDrainTimeout = 100 * time.Millisecond
+	defer func() { receiveDrainTimeout = timeout }()
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	// the child holds the record pipe after the plugin exits, the drain
+	// times out
+	config := writeTestPluginAt(t, m.Workdir, "ring-drain", `sleep 30 >/dev/null 2>&1 &
+exit 0`)
+	config.RingBufferSize = 1
+	if err := m.Load(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	defer m.UnregisterAll()
+	plg, _ := m.Get("ring-drain")
+	select {
+	case <-plg.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin is not exited")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		maps, err := os.ReadFile("/proc/self/maps")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(maps), "memfd:hades-ring-drain") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ring is still mapped")
+		}
+	}
+}
+
+func TestRingSealed(t *testing.T) {
+	p := &Plugin{config: proto.Config{Name: "sealed"}}
+	f, err := p.openRing(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.closeRing()
+	defer f.Close()
+	for _, size := range []int64{0, 1 << 30} {
+		if err = f.Truncate(size); !errors.Is(err, unix.EPERM) {
+			t.Fatalf("truncate to %d: %v, expect sealed", size, err)
+		}
+	}
+}
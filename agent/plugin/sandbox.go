@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SandboxEnv passes the sandbox of the plugin to the agent binary, which is
+// started in place of the plugin. It drops the privileges in the process and
+// then execs the plugin, see ExecSandboxed.
+const SandboxEnv = "HADES_PLUGIN_SANDBOX"
+
+var errSandboxUnsupported = errors.New("sandbox is not supported on this platform")
+
+// capNames are indexed by the number of the capability
+var capNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER",
+	"CAP_FSETID", "CAP_KILL", "CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER",
+	"CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE", "CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD",
+	"CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL", "CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND", "CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// defaultSeccompDenylist is applied to unprivileged plugins without
+// seccomp_denylist, none of them is needed by a collector
+var defaultSeccompDenylist = []string{
+	"acct", "add_key", "bpf", "clock_settime", "delete_module", "finit_module",
+	"init_module", "kexec_file_load", "kexec_load", "keyctl", "mount",
+	"open_by_handle_at", "perf_event_open", "pivot_root", "process_vm_writev",
+	"ptrace", "quotactl", "reboot", "request_key", "setns", "settimeofday",
+	"swapoff", "swapon", "umount2", "unshare", "userfaultfd",
+}
+
+// sandboxSpec is resolved by the agent, so a typo in the config fails the
+// start rather than the exec
+type sandboxSpec struct {
+	Path string `json:"path"`
+	// capabilities are dropped except the kept ones
+	DropCaps bool  `json:"drop_caps"`
+	KeepCaps []int `json:"keep_caps"`
+	// numbers of the syscalls denied with EPERM
+	DenySyscalls []int `json:"deny_syscalls"`
+	// the user switched to once the bounding set is dropped, which needs
+	// root
+	User *pluginUser `json:"user,omitempty"`
+}
+
+func needSandbox(config *proto.Config) bool {
+	return config.GetUnprivileged() || len(config.GetSeccompDenylist()) != 0
+}
+
+func newSandboxSpec(path string, config *proto.Config) (*sandboxSpec, error) {
+	spec := &sandboxSpec{Path: path, DropCaps: config.GetUnprivileged()}
+	if len(config.GetKeepCapabilities()) != 0 && !spec.DropCaps {
+		return nil, errors.New("keep_capabilities is set without unprivileged")
+	}
+	for _, name := range config.GetKeepCapabilities() {
+		n := capNumber(name)
+		if n < 0 {
+			return nil, fmt.Errorf("unknown capability %s", name)
+		}
+		spec.KeepCaps = append(spec.KeepCaps, n)
+	}
+	denylist := config.GetSeccompDenylist()
+	if len(denylist) != 0 && syscallNumbers == nil {
+		return nil, errSandboxUnsupported
+	}
+	// the default one is skipped without the syscall numbers of the arch,
+	// the capabilities are dropped and no_new_privs is set anyway
+	if len(denylist) == 0 && spec.DropCaps && syscallNumbers != nil {
+		denylist = defaultSeccompDenylist
+	}
+	for _, name := range denylist {
+		nr, ok := syscallNumbers[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown syscall %s", name)
+		}
+		spec.DenySyscalls = append(spec.DenySyscalls, nr)
+	}
+	return spec, nil
+}
+
+// capNumber accepts the name with or without the CAP_ prefix
+func capNumber(name string) int {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	for i, n := range capNames {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
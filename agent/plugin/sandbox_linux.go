@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp return actions, see linux/seccomp.h
+const (
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+	// syscalls of the x32 abi have the bit set
+	x32SyscallBit = 0x40000000
+)
+
+// sandboxCommand makes the command start the agent binary, which drops the
+// privileges, switches to the user if it's set and execs the plugin
+func sandboxCommand(cmd *exec.Cmd, config *proto.Config, u *pluginUser) error {
+	spec, err := newSandboxSpec(cmd.Path, config)
+	if err != nil {
+		return err
+	}
+	spec.User = u
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, SandboxEnv+"="+string(data))
+	cmd.Path = self
+	return nil
+}
+
+// ExecSandboxed runs in the agent binary started by sandboxCommand, before
+// anything else in main. It never returns, the process becomes the plugin
+// or exits on failure.
+func ExecSandboxed() {
+	// the privileges are per thread, and the thread calling execve is the
+	// one the plugin inherits
+	runtime.LockOSThread()
+	spec := &sandboxSpec{}
+	if err := json.Unmarshal([]byte(os.Getenv(SandboxEnv)), spec); err != nil {
+		sandboxFailed(err)
+	}
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, SandboxEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	if err := spec.apply(); err != nil {
+		sandboxFailed(err)
+	}
+	sandboxFailed(syscall.Exec(spec.Path, os.Args, env))
+}
+
+func sandboxFailed(err error) {
+	fmt.Fprintln(os.Stderr, "sandbox:", err)
+	os.Exit(126)
+}
+
+func (s *sandboxSpec) apply() error {
+	// required by seccomp once the capabilities are dropped, and it stops
+	// setuid binaries from gaining them back
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	if s.DropCaps {
+		if err := dropBoundingSet(s.KeepCaps); err != nil {
+			return err
+		}
+	}
+	if s.User != nil {
+		if err := switchUser(s.User, len(s.KeepCaps) != 0); err != nil {
+			return err
+		}
+	}
+	if s.DropCaps {
+		if err := setCapabilities(s.KeepCaps, s.User != nil); err != nil {
+			return err
+		}
+	}
+	if len(s.DenySyscalls) != 0 {
+		return installSeccomp(s.DenySyscalls)
+	}
+	return nil
+}
+
+// dropBoundingSet drops the capabilities from the bounding set, which
+// bounds the ones of root after execve
+func dropBoundingSet(keep []int) error {
+	kept := make(map[int]bool, len(keep))
+	for _, n := range keep {
+		kept[n] = true
+	}
+	last := len(capNames) - 1
+	if content, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+			last = n
+		}
+	}
+	for n := 0; n <= last; n++ {
+		if kept[n] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(n), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("drop capability %d: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// switchUser sets the ids of the thread only, which is the one calling
+// execve. The permitted capabilities are kept through it if some of them
+// are to be kept.
+func switchUser(u *pluginUser, keepCaps bool) error {
+	if keepCaps {
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("keep capabilities: %w", err)
+		}
+	}
+	if err := unix.Setgroups(nil); err != nil {
+		return fmt.Errorf("set groups: %w", err)
+	}
+	if err := unix.Setresgid(int(u.Gid), int(u.Gid), int(u.Gid)); err != nil {
+		return fmt.Errorf("set gid: %w", err)
+	}
+	if err := unix.Setresuid(int(u.Uid), int(u.Uid), int(u.Uid)); err != nil {
+		return fmt.Errorf("set uid: %w", err)
+	}
+	return nil
+}
+
+// setCapabilities limits the capabilities of the process to the kept ones.
+// Unlike root, another user loses them on execve unless they are ambient.
+func setCapabilities(keep []int, ambient bool) error {
+	var data [2]unix.CapUserData
+	for _, n := range keep {
+		data[n/32].Effective |= 1 << (uint(n) % 32)
+	}
+	for i := range data {
+		data[i].Permitted = data[i].Effective
+		data[i].Inheritable = data[i].Effective
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("set capabilities: %w", err)
+	}
+	if !ambient {
+		return nil
+	}
+	for _, n := range keep {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(n), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient capability %d: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// installSeccomp denies the syscalls with EPERM, and all the syscalls of
+// other archs and the x32 abi, which have different numbers
+func installSeccomp(deny []int) error {
+	const (
+		offsetNr   = 0
+		offsetArch = 4
+	)
+	errno := uint32(seccompRetErrno | uint32(unix.EPERM))
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offsetArch},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: auditArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: errno},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offsetNr},
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jf: 1, K: x32SyscallBit},
+		{Code: unix.BPF_RET | unix.BPF_K, K: errno},
+	}
+	for _, nr := range deny {
+		filter = append(filter,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 1, K: uint32(nr)},
+			unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: errno},
+		)
+	}
+	filter = append(filter, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow})
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("install seccomp filter: %w", err)
+	}
+	return nil
+}
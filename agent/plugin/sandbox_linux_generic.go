@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package plugin
+
+// seccomp is not supported without the syscall numbers of the arch
+const auditArch = 0
+
+var syscallNumbers map[string]int
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package plugin
+
+import (
+	"agent/proto"
+	"os/exec"
+)
+
+var syscallNumbers map[string]int
+
+func sandboxCommand(cmd *exec.Cmd, config *proto.Config, u *pluginUser) error {
+	return errSandboxUnsupported
+}
+
+// ExecSandboxed is never called since the sandbox is not applied
+func ExecSandboxed() {}
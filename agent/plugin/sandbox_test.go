@@ -0,0 +1,87 @@
+//go:build linux
+
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxSpec(t *testing.T) {
+	spec, err := newSandboxSpec("/bin/true", &proto.Config{Unprivileged: true, KeepCapabilities: []string{"CAP_SYS_PTRACE", "dac_read_search"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.DropCaps || len(spec.KeepCaps) != 2 || spec.KeepCaps[0] != 19 || spec.KeepCaps[1] != 2 {
+		t.Fatalf("unexpected capabilities: %+v", spec)
+	}
+	if len(spec.DenySyscalls) != len(defaultSeccompDenylist) {
+		t.Fatalf("default denylist is not applied: %+v", spec)
+	}
+	for name, config := range map[string]*proto.Config{
+		"unknown capability": {Unprivileged: true, KeepCapabilities: []string{"CAP_ROOT"}},
+		"unknown syscall":    {SeccompDenylist: []string{"open_everything"}},
+		"keep without drop":  {KeepCapabilities: []string{"CAP_KILL"}},
+	} {
+		if _, err := newSandboxSpec("/bin/true", config); err == nil {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestSandboxSpecWithoutSeccomp(t *testing.T) {
+	numbers := syscallNumbers
+	t.Cleanup(func() { syscallNumbers = numbers })
+	syscallNumbers = nil
+	// the default denylist is skipped, not the rest of the sandbox
+	spec, err := newSandboxSpec("/bin/true", &proto.Config{Unprivileged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.DropCaps || len(spec.DenySyscalls) != 0 {
+		t.Fatalf("unexpected sandbox: %+v", spec)
+	}
+	if _, err = newSandboxSpec("/bin/true", &proto.Config{SeccompDenylist: []string{"ptrace"}}); !errors.Is(err, errSandboxUnsupported) {
+		t.Fatal("seccomp_denylist is ignored: ", err)
+	}
+}
+
+func TestSandboxedPlugin(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("capabilities are dropped by root only")
+	}
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "sandboxed",
+		"grep -E '^(CapBnd|NoNewPrivs|Seccomp):' /proc/self/status > status\n"+
+			"unshare -U true 2>/dev/null || echo denied > unshare\n"+
+			"exec cat <&3 >/dev/null")
+	config.Unprivileged = true
+	config.KeepCapabilities = []string{"CAP_DAC_OVERRIDE"}
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(m.Workdir, "plugin", "sandboxed")
+	var status string
+	waitFor(t, "status is not written", func() bool {
+		content, _ := os.ReadFile(filepath.Join(dir, "status"))
+		status = string(content)
+		return strings.Count(status, "\n") == 3
+	})
+	for _, line := range []string{"CapBnd:\t0000000000000002", "NoNewPrivs:\t1", "Seccomp:\t2"} {
+		if !strings.Contains(status, line) {
+			t.Errorf("%q is not in the status: %s", line, status)
+		}
+	}
+	waitFor(t, "unshare is not denied", func() bool {
+		data, _ := os.ReadFile(filepath.Join(dir, "unshare"))
+		return string(data) == "denied\n"
+	})
+}
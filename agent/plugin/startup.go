@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var errStartupTimeout = errors.New("plugin startup timeout")
+
+// startupContext bounds the whole startup by startup_timeout, from download
+// to the startup probe
+func startupContext(ctx context.Context, config *proto.Config) (context.Context, context.CancelFunc) {
+	if timeout := config.GetStartupTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	}
+	return context.WithCancel(ctx)
+}
+
+// waitStartup blocks until the plugin passes the startup probe if
+// startup_timeout is set. A plugin exits before that is left to supervise,
+// and the one not ready in time is killed and never restarted.
+func (m *Manager) waitStartup(ctx context.Context, plg *Plugin) error {
+	if plg.config.GetStartupTimeout() <= 0 {
+		return nil
+	}
+	select {
+	case <-plg.readyCh:
+		return nil
+	case <-plg.done:
+		return nil
+	case <-ctx.Done():
+	}
+	// ready at the same time, it's not aborted. The agent is exiting if it's
+	// canceled, and the plugin is shutdown along with others.
+	if plg.IsReady() {
+		return nil
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	plg.logger.Errorf("plugin is not ready in %dms, abort", plg.config.GetStartupTimeout())
+	m.abortStartup(plg)
+	m.emitEvent(EventStartupTimeout, map[string]string{
+		"name":            plg.Name(),
+		"pversion":        plg.Version(),
+		"startup_timeout": strconv.FormatInt(plg.config.GetStartupTimeout(), 10),
+	})
+	return errStartupTimeout
+}
+
+// abortStartup kills the plugin at once and waits until the process is
+// reaped, the pipes are closed and the verified copy is removed
+func (m *Manager) abortStartup(plg *Plugin) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	plg.ShutdownContext(ctx)
+	plg.wg.Wait()
+	if loaded, ok := m.Get(plg.Name()); ok && loaded == plg {
+		m.UnRegister(plg.Name())
+	}
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupTimeout(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// the plugin starts but never sends a record
+	config := writeTestPluginAt(t, m.Workdir, "hang", `echo $$ >pid
+exec cat <&3 >/dev/null`)
+	config.StartupTimeout = 200
+	config.Immutable = true
+	fds := countFds(t)
+	start := time.Now()
+	err := m.Load(ctx, config)
+	if err != errStartupTimeout {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("startup is aborted after %s", elapsed)
+	}
+	if _, ok := m.Get("hang"); ok {
+		t.Fatal("plugin is still registered")
+	}
+	dir := filepath.Join(m.Workdir, "plugin", "hang")
+	content, err := os.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+	if isAlive(pid) {
+		t.Fatal("plugin is still running")
+	}
+	if n := countFds(t); n != fds {
+		t.Fatalf("%d fds are open, %d before startup", n, fds)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".hang-") {
+			t.Fatalf("verified copy is left: %s", entry.Name())
+		}
+	}
+	select {
+	case rec := <-transmitter.agent:
+		if rec.Data.Fields["event"] != EventStartupTimeout || rec.Data.Fields["name"] != "hang" {
+			t.Fatalf("unexpected event: %v", rec)
+		}
+	default:
+		t.Fatal("no startup timeout event")
+	}
+	// never restarted by supervise
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := m.Get("hang"); ok {
+		t.Fatal("plugin is restarted")
+	}
+}
+
+func countFds(t *testing.T) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestStartupReady(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "ready", `printf '\003\000\000\000\010\350\007' >&4
+exec cat <&3 >/dev/null`)
+	config.StartupTimeout = 5000
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, ok := m.Get("ready")
+	if !ok || !plg.IsReady() {
+		t.Fatal("plugin is not ready when startup returns")
+	}
+}
@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// rotation of the stderr and stdout files, by log_max_size and log_max_age
+// if they are set
+const (
+	defaultLogMaxSize = 10 // megabytes
+	defaultLogMaxAge  = 7  // days
+	logMaxBackups     = 3
+	// crash_log_lines is bounded by the lines and the bytes read from the end
+	maxCrashLogLines = 1000
+	maxCrashLogBytes = 64 * 1024
+)
+
+// openStdLog opens the rotated file of stderr or stdout. The file of the
+// last run is rotated if it's not empty, so it's kept as a backup rather
+// than being appended.
+func (p *Plugin) openStdLog(suffix string) (*lumberjack.Logger, error) {
+	maxSize, maxAge := int(p.config.GetLogMaxSize()), int(p.config.GetLogMaxAge())
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultLogMaxAge
+	}
+	l := &lumberjack.Logger{
+		Filename:   path.Join(p.workdir, p.Name()+suffix),
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: logMaxBackups,
+		LocalTime:  true,
+	}
+	if info, err := os.Stat(l.Filename); err == nil && info.Size() != 0 {
+		if err = l.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// closeStdLogs closes the files once the process is waited, the copy from
+// the pipes is done by then
+func (p *Plugin) closeStdLogs() {
+	for _, l := range []*lumberjack.Logger{p.stderr, p.stdout} {
+		if l != nil {
+			l.Close()
+		}
+	}
+}
+
+// StderrTail returns the last crash_log_lines of stderr in the current file,
+// empty if it's not set
+func (p *Plugin) StderrTail() string {
+	n := int(p.config.GetCrashLogLines())
+	if n <= 0 || p.stderr == nil {
+		return ""
+	}
+	if n > maxCrashLogLines {
+		n = maxCrashLogLines
+	}
+	tail, err := tailLines(p.stderr.Filename, n, maxCrashLogBytes)
+	if err != nil {
+		p.logger.Warn("read stderr: ", err)
+	}
+	return tail
+}
+
+// tailLines returns the last n lines of the file within the last max bytes,
+// the first line may be partial if it's cut by max
+func tailLines(name string, n int, max int64) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - max
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err = f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	start := len(buf)
+	for i := 0; i < n; i++ {
+		if start = bytes.LastIndexByte(buf[:start], '\n'); start < 0 {
+			return string(buf), nil
+		}
+	}
+	return string(buf[start+1:]), nil
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailLines(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "stderr")
+	if err := os.WriteFile(name, []byte("one\ntwo\nthree\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		n    int
+		max  int64
+		tail string
+	}{
+		{1, 1024, "three"},
+		{2, 1024, "two\nthree"},
+		{5, 1024, "one\ntwo\nthree"},
+		{5, 8, "o\nthree"},
+	} {
+		if tail, err := tailLines(name, c.n, c.max); err != nil || tail != c.tail {
+			t.Errorf("tail %d lines within %d bytes: %q, %v", c.n, c.max, tail, err)
+		}
+	}
+}
+
+func TestCrashedEvent(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	config := writeTestPluginAt(t, m.Workdir, "crash", "echo first >&2; echo panic: boom >&2; echo goroutine 1 >&2; exit 2")
+	config.CrashLogLines = 2
+	config.QuarantineThreshold = 1
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case rec := <-transmitter.agent:
+			fields := rec.Data.Fields
+			if fields["event"] != EventCrashed {
+				continue
+			}
+			if fields["name"] != "crash" || fields["exit_code"] != "2" || fields["stderr"] != "panic: boom\ngoroutine 1" {
+				t.Fatalf("unexpected event: %v", fields)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("no crashed event")
+		}
+	}
+}
+
+func TestStdLogRotate(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "rotate"})
+	dir := t.TempDir()
+	p.workdir = dir
+	if err := os.WriteFile(filepath.Join(dir, "rotate.stderr"), []byte("last run\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := p.openStdLog(".stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Write([]byte("this run\n"))
+	l.Close()
+	matches, _ := filepath.Glob(filepath.Join(dir, "rotate-*.stderr"))
+	if len(matches) != 1 {
+		t.Fatalf("last run is not kept as a backup: %v", matches)
+	}
+	if data, _ := os.ReadFile(l.Filename); !strings.HasPrefix(string(data), "this run") {
+		t.Fatalf("unexpected stderr: %q", data)
+	}
+}
@@ -0,0 +1,309 @@
+package plugin
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Tasks of a plugin are queued, at most maxQueuedTasks, and kept in the
+// working directory until they are written to the plugin. The queue is
+// shared by the instances of the same name, so the tasks sent while the
+// plugin is restarting or upgrading, or before the agent restarts, are
+// delivered once it's back. A failed write is retried with backoff, at
+// most maxTaskAttempts times, and a task not delivered in taskQueueTTL
+// expires. Both are reported as rejected.
+const (
+	maxQueuedTasks  = 256
+	maxTaskAttempts = 5
+)
+
+var (
+	taskQueueTTL      = 10 * time.Minute
+	taskRetryDelay    = time.Second
+	maxTaskRetryDelay = time.Minute
+)
+
+var (
+	errTaskQueueFull   = errors.New("task queue of plugin is full")
+	errTaskExpired     = errors.New("task expired in queue")
+	errTaskUndelivered = errors.New("task is not delivered after retries")
+)
+
+type queuedTask struct {
+	Seq      uint64     `json:"seq"`
+	Task     proto.Task `json:"task"`
+	QueuedAt time.Time  `json:"queued_at"`
+	Attempts int        `json:"attempts,omitempty"`
+	// not written again before it after a failed attempt
+	RetryAt time.Time `json:"retry_at,omitempty"`
+	// taken by a Task, it's kept in the file until it's written
+	inflight bool
+}
+
+type taskQueue struct {
+	mu sync.Mutex
+	// nothing is kept on disk if it's empty
+	path  string
+	seq   uint64
+	tasks []*queuedTask
+	// receives once a task is pushed or put back
+	ready chan struct{}
+}
+
+func newTaskQueue(path string) *taskQueue {
+	return &taskQueue{path: path, ready: make(chan struct{}, 1)}
+}
+
+// taskRetryBackoff returns the delay before the next write after failed
+// attempts
+func taskRetryBackoff(attempts int) time.Duration {
+	delay := taskRetryDelay
+	for i := 1; i < attempts && delay < maxTaskRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxTaskRetryDelay {
+		delay = maxTaskRetryDelay
+	}
+	return delay
+}
+
+// load restores the tasks kept in the file, a missing file is fine
+func (q *taskQueue) load() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var tasks []*queuedTask
+	if err = json.Unmarshal(content, &tasks); err != nil {
+		return err
+	}
+	if len(tasks) > maxQueuedTasks {
+		tasks = tasks[len(tasks)-maxQueuedTasks:]
+	}
+	for _, entry := range tasks {
+		if entry.Seq > q.seq {
+			q.seq = entry.Seq
+		}
+	}
+	q.tasks = tasks
+	q.notify()
+	return nil
+}
+
+// save must be called with mu held. The tasks are delivered all the same
+// if it fails, they are only lost if the agent restarts.
+func (q *taskQueue) save() {
+	if err := q.write(); err != nil {
+		zap.S().Warn("save tasks failed: ", err)
+	}
+}
+
+func (q *taskQueue) write() error {
+	if q.path == "" {
+		return nil
+	}
+	if len(q.tasks) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	content, err := json.Marshal(q.tasks)
+	if err != nil {
+		return err
+	}
+	// the plugin may not be downloaded yet
+	if err = os.MkdirAll(path.Dir(q.path), 0o700); err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (q *taskQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push queues the task, it's refused once the queue is full. The expired
+// ones are removed to make room, as nothing pops them if the plugin is gone.
+func (q *taskQueue) push(task proto.Task, now time.Time) (expired []*queuedTask, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) >= maxQueuedTasks {
+		expired = q.expire(now)
+		if len(q.tasks) >= maxQueuedTasks {
+			return expired, errTaskQueueFull
+		}
+	}
+	q.seq++
+	q.tasks = append(q.tasks, &queuedTask{Seq: q.seq, Task: task, QueuedAt: now})
+	q.save()
+	q.notify()
+	return
+}
+
+// expire removes the tasks queued longer than taskQueueTTL, it must be
+// called with mu held
+func (q *taskQueue) expire(now time.Time) (expired []*queuedTask) {
+	kept := q.tasks[:0]
+	for _, t := range q.tasks {
+		if !t.inflight && now.Sub(t.QueuedAt) > taskQueueTTL {
+			expired = append(expired, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	for i := len(kept); i < len(q.tasks); i++ {
+		q.tasks[i] = nil
+	}
+	q.tasks = kept
+	return
+}
+
+// pop takes the first task due, and removes the expired ones. If none is
+// due, wait is the time until the first retry, zero if there's none.
+func (q *taskQueue) pop(now time.Time) (entry *queuedTask, expired []*queuedTask, wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if expired = q.expire(now); len(expired) != 0 {
+		q.save()
+	}
+	for _, t := range q.tasks {
+		if t.inflight {
+			continue
+		}
+		if t.RetryAt.After(now) {
+			if d := t.RetryAt.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+		t.inflight = true
+		return t, expired, 0
+	}
+	return
+}
+
+// done removes the task once it's written, or given up
+func (q *taskQueue) done(entry *queuedTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(entry)
+	q.save()
+}
+
+// remove must be called with mu held
+func (q *taskQueue) remove(entry *queuedTask) {
+	for i, t := range q.tasks {
+		if t == entry {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// retry puts the task back after a failed write, it's removed and false is
+// returned once the attempts are used up
+func (q *taskQueue) retry(entry *queuedTask, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry.inflight = false
+	entry.Attempts++
+	if entry.Attempts >= maxTaskAttempts {
+		q.remove(entry)
+		q.save()
+		return false
+	}
+	entry.RetryAt = now.Add(taskRetryBackoff(entry.Attempts))
+	q.save()
+	q.notify()
+	return true
+}
+
+// cancel removes the task of the token not written yet
+func (q *taskQueue) cancel(token string) *queuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.tasks {
+		if !t.inflight && t.Task.Token == token {
+			q.remove(t)
+			q.save()
+			return t
+		}
+	}
+	return nil
+}
+
+// drain removes all the tasks and the file
+func (q *taskQueue) drain() (tasks []*queuedTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks, q.tasks = q.tasks, nil
+	q.save()
+	return
+}
+
+// Len returns the tasks queued, including the one being written
+func (q *taskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// taskQueue returns the queue of the plugin, the tasks kept by the last run
+// are restored once it's created
+func (m *Manager) taskQueue(name string) *taskQueue {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+	if q, ok := m.queues[name]; ok {
+		return q
+	}
+	q := newTaskQueue(path.Join(m.Workdir, "plugin", name, name+".tasks"))
+	if err := q.load(); err != nil {
+		// a corrupted file is replaced by the next task
+		zap.S().Warnf("restore tasks of %s failed: %v", name, err)
+	}
+	if m.queues == nil {
+		m.queues = map[string]*taskQueue{}
+	}
+	m.queues[name] = q
+	return q
+}
+
+// dropTaskQueue rejects the tasks never delivered to the removed plugin
+func (m *Manager) dropTaskQueue(name string) {
+	m.qmu.Lock()
+	q, ok := m.queues[name]
+	delete(m.queues, name)
+	m.qmu.Unlock()
+	if !ok {
+		return
+	}
+	for _, entry := range q.drain() {
+		m.taskRejected(&entry.Task, errPluginNotFound)
+	}
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"agent/proto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+type closedWriter struct{}
+
+func (closedWriter) Write([]byte) (int, error) { return 0, os.ErrClosed }
+
+func (closedWriter) Close() error { return nil }
+
+func TestTaskQueuePersist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plugin", "scanner", "scanner.tasks")
+	q := newTaskQueue(file)
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		if _, err := q.push(proto.Task{DataType: int32(i), Token: "t"}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, _, _ := q.pop(now)
+	q.done(entry)
+	// the one being written is kept until it's done
+	inflight, _, _ := q.pop(now)
+	restored := newTaskQueue(file)
+	if err := restored.load(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 2 {
+		t.Fatalf("%d tasks restored, expect 2", restored.Len())
+	}
+	for _, expect := range []int32{2, 3} {
+		entry, _, _ := restored.pop(now)
+		if entry == nil || entry.Task.DataType != expect {
+			t.Fatalf("unexpected task: %v, expect %d", entry, expect)
+		}
+		restored.done(entry)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("file of the empty queue is not removed: ", err)
+	}
+	// the seq goes on
+	restored.push(proto.Task{DataType: 4}, now)
+	if entry, _, _ := restored.pop(now); entry.Seq <= inflight.Seq {
+		t.Fatalf("seq %d is reused", entry.Seq)
+	}
+}
+
+func TestTaskQueueRetry(t *testing.T) {
+	q := newTaskQueue("")
+	now := time.Now()
+	q.push(proto.Task{DataType: 1}, now)
+	for attempts := 1; attempts < maxTaskAttempts; attempts++ {
+		entry, _, _ := q.pop(now)
+		if entry == nil {
+			t.Fatalf("task is not due at attempt %d", attempts)
+		}
+		if !q.retry(entry, now) {
+			t.Fatalf("task is dropped at attempt %d", attempts)
+		}
+		backoff := taskRetryBackoff(attempts)
+		if entry, _, wait := q.pop(now); entry != nil || wait != backoff {
+			t.Fatalf("task is due before the backoff: %v, wait %s, expect %s", entry, wait, backoff)
+		}
+		now = now.Add(backoff)
+	}
+	entry, _, _ := q.pop(now)
+	if q.retry(entry, now) || q.Len() != 0 {
+		t.Fatal("task is kept after the attempts are used up")
+	}
+	if taskRetryBackoff(100) != maxTaskRetryDelay {
+		t.Fatal("backoff is not capped")
+	}
+}
+
+func TestTaskQueueExpire(t *testing.T) {
+	q := newTaskQueue("")
+	now := time.Now()
+	q.push(proto.Task{DataType: 1}, now.Add(-taskQueueTTL-time.Second))
+	q.push(proto.Task{DataType: 2}, now)
+	entry, expired, _ := q.pop(now)
+	if len(expired) != 1 || expired[0].Task.DataType != 1 {
+		t.Fatalf("unexpected expired tasks: %v", expired)
+	}
+	if entry == nil || entry.Task.DataType != 2 {
+		t.Fatalf("unexpected task: %v", entry)
+	}
+	q.done(entry)
+	// the full queue makes room by the expired ones
+	for i := 0; i < maxQueuedTasks; i++ {
+		q.push(proto.Task{DataType: 3}, now)
+	}
+	if _, err := q.push(proto.Task{DataType: 4}, now); err != errTaskQueueFull {
+		t.Fatalf("full queue accepts the task: %v", err)
+	}
+	later := now.Add(taskQueueTTL + time.Second)
+	if expired, err := q.push(proto.Task{DataType: 4}, later); err != nil || len(expired) != maxQueuedTasks {
+		t.Fatalf("%d tasks expired, err: %v", len(expired), err)
+	}
+}
+
+// the task sent while the plugin is restarting is delivered by the next
+// instance sharing the queue
+func TestTaskQueueRestart(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	crashed := newTestPlugin(proto.Config{Name: "scanner"})
+	crashed.tasks = m.taskQueue("scanner")
+	crashed.transmitter = transmitter
+	crashed.tx = closedWriter{}
+	crashed.wg.Add(1)
+	go crashed.Task()
+	sendTask(t, crashed, proto.Task{DataType: 1000, ObjectName: "scanner", Token: "t1"})
+	crashed.wg.Wait()
+	if crashed.QueuedTasks() != 1 {
+		t.Fatal("task is not kept after the failed write")
+	}
+	// retried once the backoff, shortened here, is over
+	q := m.taskQueue("scanner")
+	q.mu.Lock()
+	q.tasks[0].RetryAt = time.Now().Add(10 * time.Millisecond)
+	q.mu.Unlock()
+	next := newTestPlugin(proto.Config{Name: "scanner"})
+	next.tasks = q
+	next.transmitter = transmitter
+	next.tx = &slowWriter{}
+	next.wg.Add(1)
+	go next.Task()
+	defer func() {
+		close(next.done)
+		next.wg.Wait()
+	}()
+	select {
+	case rec := <-transmitter.agent:
+		fields := rec.GetData().GetFields()
+		if fields["token"] != "t1" || fields["status"] != config.TaskStatusDelivered {
+			t.Fatalf("unexpected ack: %v", fields)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task is not delivered after the restart")
+	}
+}
+
+func TestDropTaskQueue(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	q := m.taskQueue("scanner")
+	q.push(proto.Task{DataType: 1000, ObjectName: "scanner", Token: "t1"}, time.Now())
+	m.dropTaskQueue("scanner")
+	select {
+	case rec := <-transmitter.agent:
+		fields := rec.GetData().GetFields()
+		if fields["token"] != "t1" || fields["status"] != config.TaskStatusRejected {
+			t.Fatalf("unexpected status: %v", fields)
+		}
+	default:
+		t.Fatal("task of the removed plugin is not rejected")
+	}
+	if m.taskQueue("scanner") == q || q.Len() != 0 {
+		t.Fatal("queue is not dropped")
+	}
+}
+
+func TestCancelQueuedTask(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "scanner"})
+	p.transmitter = transmitter
+	sendTask(t, p, proto.Task{DataType: 1000, ObjectName: "scanner", Token: "t1"})
+	sendTask(t, p, proto.Task{DataType: config.TaskCancel, ObjectName: "scanner", Data: "t1", Token: "c1"})
+	if p.QueuedTasks() != 0 {
+		t.Fatalf("%d tasks queued after the cancel", p.QueuedTasks())
+	}
+	for _, expect := range [][2]string{{"t1", config.TaskStatusCancelled}, {"c1", config.TaskStatusSucceeded}} {
+		rec := <-transmitter.agent
+		if fields := rec.GetData().GetFields(); fields["token"] != expect[0] || fields["status"] != expect[1] {
+			t.Fatalf("unexpected result: %v", fields)
+		}
+	}
+	// the one not queued goes to the plugin
+	sendTask(t, p, proto.Task{DataType: config.TaskCancel, ObjectName: "scanner", Data: "t2"})
+	if p.QueuedTasks() != 1 {
+		t.Fatal("cancel of the task delivered is not queued")
+	}
+}
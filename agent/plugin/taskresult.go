@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// Tasks with a token are tracked until the plugin reports the result. The
+// ones never reported are dropped after pendingTaskTTL, and at most
+// maxPendingTasks are tracked, results of the untracked ones are forwarded
+// without the latency.
+const (
+	maxPendingTasks = 1024
+	pendingTaskTTL  = 10 * time.Minute
+)
+
+var errPluginNotFound = errors.New("plugin not found")
+
+type pendingTask struct {
+	dataType    int32
+	deliveredAt time.Time
+}
+
+// pendingTasks is keyed by the token of the task
+type pendingTasks struct {
+	mu    sync.Mutex
+	tasks map[string]pendingTask
+}
+
+func (t *pendingTasks) add(task *proto.Task, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tasks == nil {
+		t.tasks = make(map[string]pendingTask)
+	}
+	if len(t.tasks) >= maxPendingTasks {
+		for token, pending := range t.tasks {
+			if now.Sub(pending.deliveredAt) > pendingTaskTTL {
+				delete(t.tasks, token)
+			}
+		}
+		if len(t.tasks) >= maxPendingTasks {
+			return
+		}
+	}
+	t.tasks[task.GetToken()] = pendingTask{dataType: task.GetDataType(), deliveredAt: now}
+}
+
+func (t *pendingTasks) remove(token string) (pending pendingTask, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if pending, ok = t.tasks[token]; ok {
+		delete(t.tasks, token)
+	}
+	return
+}
+
+// newTaskResultRecord is the status of the task reported by the agent
+func newTaskResultRecord(plugin string, task *proto.Task, status string, err error) *proto.Record {
+	fields := map[string]string{
+		"token":          task.GetToken(),
+		"plugin":         plugin,
+		"task_data_type": strconv.Itoa(int(task.GetDataType())),
+		"status":         status,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	return &proto.Record{
+		DataType:  config.DTPluginTaskResult,
+		Timestamp: time.Now().Unix(),
+		Data:      &proto.Payload{Fields: fields},
+	}
+}
+
+// taskDelivered acks the task once it's written to the plugin, and tracks
+// it for the result
+func (p *Plugin) taskDelivered(task *proto.Task) {
+	if task.GetToken() == "" {
+		return
+	}
+	p.pending.add(task, time.Now())
+	p.tmu.RLock()
+	defer p.tmu.RUnlock()
+	p.transmitter.TransmitAgent(newTaskResultRecord(p.Name(), task, config.TaskStatusDelivered, nil), true)
+}
+
+// taskRejected reports the task which is never delivered to the plugin
+func (m *Manager) taskRejected(task *proto.Task, err error) {
+	if task.GetToken() == "" {
+		return
+	}
+	m.Transmitter.TransmitAgent(newTaskResultRecord(task.GetObjectName(), task, config.TaskStatusRejected, err), true)
+}
+
+// taskRejected reports the task dropped from the queue of the plugin
+func (p *Plugin) taskRejected(task *proto.Task, err error) {
+	p.logger.Warnf("task %d is rejected: %v", task.GetDataType(), err)
+	if task.GetToken() == "" {
+		return
+	}
+	p.tmu.RLock()
+	defer p.tmu.RUnlock()
+	p.transmitter.TransmitAgent(newTaskResultRecord(p.Name(), task, config.TaskStatusRejected, err), true)
+}
+
+// cancelQueued drops the task of the token in data of TaskCancel if it's
+// not written yet, and reports both
+func (p *Plugin) cancelQueued(cancel *proto.Task) bool {
+	if cancel.GetDataType() != config.TaskCancel || cancel.GetData() == "" {
+		return false
+	}
+	entry := p.tasks.cancel(cancel.GetData())
+	if entry == nil {
+		return false
+	}
+	p.logger.Infof("task %d is cancelled in queue", entry.Task.GetDataType())
+	p.tmu.RLock()
+	defer p.tmu.RUnlock()
+	p.transmitter.TransmitAgent(newTaskResultRecord(p.Name(), &entry.Task, config.TaskStatusCancelled, nil), true)
+	if cancel.GetToken() != "" {
+		p.transmitter.TransmitAgent(newTaskResultRecord(p.Name(), cancel, config.TaskStatusSucceeded, nil), true)
+	}
+	return true
+}
+
+// handleTaskResult correlates the result reported by the plugin with the
+// task, and forwards it. A result without a token can't be correlated and
+// is dropped.
+func (p *Plugin) handleTaskResult(rec *proto.Record, now time.Time) bool {
+	if rec.GetDataType() != config.DTPluginTaskResult {
+		return false
+	}
+	fields := rec.GetData().GetFields()
+	token := fields["token"]
+	if token == "" {
+		p.logger.Warn("task result without token is dropped")
+		return true
+	}
+	switch fields["status"] {
+	case config.TaskStatusSucceeded, config.TaskStatusFailed, config.TaskStatusCancelled:
+	default:
+		fields["status"] = config.TaskStatusFailed
+	}
+	fields["plugin"] = p.Name()
+	if pending, ok := p.pending.remove(token); ok {
+		fields["task_data_type"] = strconv.Itoa(int(pending.dataType))
+		fields["latency"] = strconv.FormatFloat(now.Sub(pending.deliveredAt).Seconds(), 'f', 3, 64)
+	}
+	p.correctClock(rec)
+	rec.Plugin = p.Name()
+	p.transmitter.Transmission(rec, true)
+	return true
+}
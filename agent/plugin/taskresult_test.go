@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"agent/proto"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func TestTaskResult(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	p := newTestPlugin(proto.Config{Name: "scanner"})
+	p.transmitter = transmitter
+	p.tx = &slowWriter{}
+	p.wg.Add(1)
+	go p.Task()
+	defer func() {
+		close(p.done)
+		p.wg.Wait()
+	}()
+	sendTask(t, p, proto.Task{DataType: 1000, ObjectName: "scanner", Token: "t1"})
+	// the agent acks once the task is written
+	select {
+	case rec := <-transmitter.agent:
+		fields := rec.GetData().GetFields()
+		if rec.DataType != config.DTPluginTaskResult || fields["token"] != "t1" ||
+			fields["status"] != config.TaskStatusDelivered || fields["task_data_type"] != "1000" {
+			t.Fatalf("unexpected ack: %v", rec)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task is not acked")
+	}
+	// untracked tasks are not acked
+	sendTask(t, p, proto.Task{DataType: 1000, ObjectName: "scanner"})
+	result := func(fields map[string]string) *proto.Record {
+		return &proto.Record{DataType: config.DTPluginTaskResult, Data: &proto.Payload{Fields: fields}}
+	}
+	p.transmitRecord(nil, result(map[string]string{"token": "t1", "status": config.TaskStatusSucceeded, "output": "ok"}))
+	select {
+	case rec := <-transmitter.plugin:
+		fields := rec.GetData().GetFields()
+		if fields["plugin"] != "scanner" || fields["task_data_type"] != "1000" || fields["latency"] == "" || fields["output"] != "ok" {
+			t.Fatalf("result is not correlated: %v", fields)
+		}
+	default:
+		t.Fatal("result is not forwarded")
+	}
+	// unknown status is a failure, and the token is not tracked anymore
+	p.transmitRecord(nil, result(map[string]string{"token": "t1", "status": "done"}))
+	rec := <-transmitter.plugin
+	if fields := rec.GetData().GetFields(); fields["status"] != config.TaskStatusFailed || fields["latency"] != "" {
+		t.Fatalf("unexpected result: %v", fields)
+	}
+	// no token, no correlation
+	p.transmitRecord(nil, result(map[string]string{"status": config.TaskStatusSucceeded}))
+	select {
+	case rec := <-transmitter.plugin:
+		t.Fatalf("result without token is forwarded: %v", rec)
+	case rec := <-transmitter.agent:
+		t.Fatalf("untracked task is acked: %v", rec)
+	default:
+	}
+}
+
+func TestTaskRejected(t *testing.T) {
+	transmitter := newRecordTransmitter()
+	m := NewManager(t.TempDir(), "hades-agent", transmitter)
+	m.taskRejected(&proto.Task{ObjectName: "missing", Token: "t2"}, errPluginNotFound)
+	rec := <-transmitter.agent
+	if fields := rec.GetData().GetFields(); fields["status"] != config.TaskStatusRejected || fields["plugin"] != "missing" ||
+		fields["error"] != errPluginNotFound.Error() {
+		t.Fatalf("unexpected rejection: %v", fields)
+	}
+	m.taskRejected(&proto.Task{ObjectName: "missing"}, errors.New("busy"))
+	select {
+	case rec := <-transmitter.agent:
+		t.Fatalf("untracked task is rejected: %v", rec)
+	default:
+	}
+}
@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans of the plugin lifecycle
+const (
+	SpanDownload = "plugin.download"
+	SpanVerify   = "plugin.verify"
+	SpanStart    = "plugin.start"
+	SpanDrain    = "plugin.drain"
+)
+
+// TracerName is the instrumentation name of the tracer, like
+// otel.Tracer(TracerName) with the tracer provider set
+const TracerName = "agent/plugin"
+
+// noopTracer is used if no tracer is configured
+var noopTracer = trace.NewNoopTracerProvider().Tracer(TracerName)
+
+func (p *Plugin) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return p.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("plugin.name", p.Name()),
+		attribute.String("plugin.version", p.Version()),
+	))
+}
+
+// endSpan records the error if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
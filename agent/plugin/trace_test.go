@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newMemTracer keeps the spans ended in the in-memory exporter
+func newMemTracer(m *Manager) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	m.Tracer = provider.Tracer(TracerName)
+	return exporter
+}
+
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestLifecycleSpans(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	exporter := newMemTracer(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := writeTestPluginAt(t, m.Workdir, "traced", "exec cat <&3 >/dev/null")
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("traced")
+	plg.Shutdown()
+	plg.wg.Wait()
+	spans := exporter.GetSpans()
+	want := []string{SpanVerify, SpanStart, SpanDrain}
+	if len(spans) != len(want) {
+		t.Fatalf("spans: %v, want: %v", spans, want)
+	}
+	for i, span := range spans {
+		if span.Name != want[i] || span.Status.Code == codes.Error {
+			t.Fatalf("unexpected span %+v", span)
+		}
+		attrs := spanAttrs(span)
+		if attrs["plugin.name"].AsString() != "traced" || attrs["plugin.version"].AsString() != "1.0.0" {
+			t.Fatalf("unexpected attributes %v", attrs)
+		}
+	}
+	if !spanAttrs(spans[0])["verify.matched"].AsBool() || spanAttrs(spans[1])["process.pid"].AsInt64() == 0 {
+		t.Fatalf("unexpected attributes %v, %v", spans[0].Attributes, spans[1].Attributes)
+	}
+}
+
+func TestDownloadSpan(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	exporter := newMemTracer(m)
+	config := writeTestPluginAt(t, m.Workdir, "untrusted", "exit 0")
+	// mismatched checksum and no url to download from
+	config.Sha256 = "00"
+	config.Signature = "00"
+	if _, err := m.NewPlugin(context.Background(), config); err == nil {
+		t.Fatal("plugin should not start")
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != SpanVerify || spans[1].Name != SpanDownload {
+		t.Fatalf("spans: %v", spans)
+	}
+	if attr, ok := spanAttrs(spans[0])["verify.matched"]; !ok || attr.AsBool() {
+		t.Fatalf("unexpected attributes %v", spans[0].Attributes)
+	}
+	if download := spans[1]; download.Status.Code != codes.Error || len(download.Events) == 0 {
+		t.Fatalf("unexpected span %+v", download)
+	}
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"agent/proto"
+	"sync/atomic"
+)
+
+// Policies of the records out of known_types
+const (
+	UnknownForward = "forward"
+	UnknownFlag    = "flag"
+	UnknownDrop    = "drop"
+)
+
+// typePolicy decides what to do with record types the server may not
+// understand yet, during the staged rollout of a newer plugin
+type typePolicy struct {
+	known  map[int32]struct{}
+	policy string
+}
+
+// newTypePolicy returns nil if known_types is not configured, so all the
+// types are known. Any policy other than flag and drop is forward.
+func newTypePolicy(config *proto.Config) *typePolicy {
+	if len(config.GetKnownTypes()) == 0 {
+		return nil
+	}
+	known := make(map[int32]struct{}, len(config.GetKnownTypes()))
+	for _, t := range config.GetKnownTypes() {
+		known[t] = struct{}{}
+	}
+	return &typePolicy{known: known, policy: config.GetUnknownTypePolicy()}
+}
+
+// checkType counts the record of unknown type, and reports whether it's to be
+// flagged or dropped
+func (p *Plugin) checkType(rec *proto.Record) (flag, drop bool) {
+	if p.types == nil {
+		return
+	}
+	if _, ok := p.types.known[rec.GetDataType()]; ok {
+		return
+	}
+	atomic.AddUint64(&p.unknownRecords, 1)
+	return p.types.policy == UnknownFlag, p.types.policy == UnknownDrop
+}
+
+// flagUnknown marks the record, after the field filter so it's never stripped
+func flagUnknown(rec *proto.Record) {
+	if rec.Data == nil {
+		rec.Data = &proto.Payload{}
+	}
+	if rec.Data.Fields == nil {
+		rec.Data.Fields = make(map[string]string, 1)
+	}
+	rec.Data.Fields["unknown_type"] = "true"
+}
+
+// UnknownRecords returns the count of records out of known_types, whatever
+// the policy is
+func (p *Plugin) UnknownRecords() uint64 { return atomic.LoadUint64(&p.unknownRecords) }
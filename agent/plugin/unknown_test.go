@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"agent/proto"
+	"testing"
+)
+
+// transmitTypes sends records of data_type 1000 and 1001 to the plugin with
+// the policy, where only 1000 is known
+func transmitTypes(t *testing.T, policy string) (recs []*proto.Record, p *Plugin) {
+	config := proto.Config{Name: "test", KnownTypes: []int32{1000}, UnknownTypePolicy: policy}
+	target := newRecordTransmitter()
+	p = newTestPlugin(config)
+	p.transmitter = target
+	p.types = newTypePolicy(&config)
+	p.transmit([]*proto.Record{
+		{DataType: 1000, Data: &proto.Payload{Fields: map[string]string{"k": "v"}}},
+		{DataType: 1001},
+		{DataType: 1000},
+		{DataType: 1001, Data: &proto.Payload{Fields: map[string]string{"k": "v"}}},
+	})
+	close(target.plugin)
+	for rec := range target.plugin {
+		recs = append(recs, rec)
+	}
+	if n := p.UnknownRecords(); n != 2 {
+		t.Fatalf("%s: unknown records %d, expect 2", policy, n)
+	}
+	return
+}
+
+func TestUnknownForward(t *testing.T) {
+	for _, policy := range []string{"", UnknownForward} {
+		recs, _ := transmitTypes(t, policy)
+		if len(recs) != 4 {
+			t.Fatalf("%q: %d records are forwarded", policy, len(recs))
+		}
+		for _, rec := range recs {
+			if rec.GetData().GetFields()["unknown_type"] != "" {
+				t.Fatalf("%q: record is flagged: %v", policy, rec)
+			}
+		}
+	}
+}
+
+func TestUnknownFlag(t *testing.T) {
+	recs, _ := transmitTypes(t, UnknownFlag)
+	if len(recs) != 4 {
+		t.Fatalf("%d records are forwarded", len(recs))
+	}
+	for _, rec := range recs {
+		flagged := rec.GetData().GetFields()["unknown_type"] == "true"
+		if flagged != (rec.DataType == 1001) {
+			t.Fatalf("unexpected flag: %v", rec)
+		}
+	}
+	if recs[3].Data.Fields["k"] != "v" {
+		t.Fatalf("fields are lost: %v", recs[3])
+	}
+}
+
+func TestUnknownDrop(t *testing.T) {
+	recs, _ := transmitTypes(t, UnknownDrop)
+	if len(recs) != 2 {
+		t.Fatalf("%d records are forwarded", len(recs))
+	}
+	for _, rec := range recs {
+		if rec.DataType != 1000 {
+			t.Fatalf("unknown record is forwarded: %v", rec)
+		}
+	}
+}
+
+func TestAllTypesKnown(t *testing.T) {
+	p := newTestPlugin(proto.Config{Name: "test", UnknownTypePolicy: UnknownDrop})
+	p.types = newTypePolicy(&p.config)
+	if p.types != nil {
+		t.Fatal("policy without known types")
+	}
+	if flag, drop := p.checkType(&proto.Record{DataType: 1001}); flag || drop || p.UnknownRecords() != 0 {
+		t.Fatal("record is unknown without known types")
+	}
+}
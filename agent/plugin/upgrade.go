@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"agent/proto"
+	"context"
+	"errors"
+)
+
+var errUpgradeExited = errors.New("new version exits during upgrade")
+
+// Upgrade replaces the running plugin with the default manager
+func Upgrade(ctx context.Context, config proto.Config) error {
+	return DefaultManager.Upgrade(ctx, config)
+}
+
+// Upgrade replaces the running plugin by the version of config without a
+// gap. The new version is downloaded, verified and started next to the old
+// one, and takes over the tasks once it passes the startup probe, or once
+// it's started if startup_timeout is not set. Only then the old one is
+// shutdown, with the tasks it has accepted flushed to it. If the new one
+// fails to start, the old one keeps running. A plugin not running is loaded
+// as usual.
+func (m *Manager) Upgrade(ctx context.Context, config proto.Config) (err error) {
+	if m.IsDraining() {
+		return errDraining
+	}
+	old, ok := m.Get(config.GetName())
+	if !ok || old.IsExited() {
+		return m.Load(ctx, config)
+	}
+	if old.Version() == config.GetVersion() {
+		old.SetFieldFilter(&config)
+		old.SetRateLimit(&config)
+		return errDupPlugin
+	}
+	if err = m.checkQuarantine(&config); err != nil {
+		return
+	}
+	if config.GetSignature() == "" {
+		config.Signature = config.GetSha256()
+	}
+	sctx, cancel := startupContext(ctx, &config)
+	defer cancel()
+	// the binary on disk is replaced by rename, the old process runs on
+	plg, err := m.NewPlugin(sctx, config)
+	if err != nil {
+		if errors.Is(sctx.Err(), context.DeadlineExceeded) {
+			err = errStartupTimeout
+		}
+		return
+	}
+	plg.wg.Add(3)
+	go plg.Wait()
+	go plg.Receive()
+	go plg.Task()
+	if err = m.waitStartup(sctx, plg); err == nil {
+		err = m.verifyPlacement(plg)
+	}
+	if err == nil && plg.IsExited() {
+		err = errUpgradeExited
+	}
+	if err != nil {
+		if !plg.IsExited() {
+			m.abortStartup(plg)
+		}
+		plg.logger.Error("upgrade failed, keep running ", old.Version(), ": ", err)
+		return
+	}
+	// new tasks go to the new one from now on, including the ones sent by
+	// the holders of the old one
+	m.Register(plg.Name(), plg)
+	old.successor.Store(plg)
+	go m.supervise(ctx, plg)
+	old.Shutdown()
+	plg.logger.Infof("plugin is upgraded from %s", old.Version())
+	m.emitEvent(EventUpgraded, map[string]string{
+		"name":     plg.Name(),
+		"pversion": plg.Version(),
+		"from":     old.Version(),
+	})
+	return
+}
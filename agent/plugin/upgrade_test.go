@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"agent/proto"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveTestPlugin serves the script as the binary of a new version
+func serveTestPlugin(t *testing.T, name, version, script string) proto.Config {
+	content := []byte("#!/bin/sh\n" + script + "\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	sum := sha256.Sum256(content)
+	return proto.Config{Name: name, Version: version, Sha256: hex.EncodeToString(sum[:]), DownloadUrls: []string{server.URL}}
+}
+
+func TestUpgrade(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	// each version keeps the tasks it receives
+	v1 := writeTestPluginAt(t, m.Workdir, "upgrade", "exec cat <&3 >tasks.1.0.0")
+	if err := m.Load(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := m.Get("upgrade")
+	sendTask(t, old, proto.Task{DataType: 1, ObjectName: "upgrade"})
+	v2 := serveTestPlugin(t, "upgrade", "2.0.0", "exec cat <&3 >tasks.2.0.0")
+	if err := m.Load(ctx, v2); err != nil {
+		t.Fatal(err)
+	}
+	plg, _ := m.Get("upgrade")
+	if plg == old || plg.Version() != "2.0.0" || plg.IsExited() {
+		t.Fatalf("plugin is not upgraded: %s", plg.Version())
+	}
+	if !old.IsExited() {
+		t.Fatal("old version is still running")
+	}
+	// the holders of the old one reach the new one
+	sendTask(t, old, proto.Task{DataType: 2, ObjectName: "upgrade"})
+	plg.Shutdown()
+	dir := filepath.Join(m.Workdir, "plugin", "upgrade")
+	for version, dataType := range map[string]byte{"1.0.0": 1, "2.0.0": 2} {
+		tasks, err := os.ReadFile(filepath.Join(dir, "tasks."+version))
+		if err != nil {
+			t.Fatal(err)
+		}
+		task := &proto.Task{}
+		if len(tasks) < 4 || task.Unmarshal(tasks[4:]) != nil || task.DataType != int32(dataType) {
+			t.Fatalf("unexpected tasks of %s: %v", version, tasks)
+		}
+	}
+}
+
+func TestUpgradeFailed(t *testing.T) {
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.UnregisterAll()
+	v1 := writeTestPluginAt(t, m.Workdir, "upgrade", "exec cat <&3 >/dev/null")
+	if err := m.Load(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := m.Get("upgrade")
+	// the download doesn't match the checksum
+	v2 := serveTestPlugin(t, "upgrade", "2.0.0", "exec cat <&3 >/dev/null")
+	v2.Sha256 = hex.EncodeToString(bytes.Repeat([]byte{1}, sha256.Size))
+	if err := m.Upgrade(ctx, v2); err == nil {
+		t.Fatal("upgrade should fail")
+	}
+	// the new version exits before it's ready
+	v3 := serveTestPlugin(t, "upgrade", "3.0.0", "exit 1")
+	v3.StartupTimeout = 5000
+	if err := m.Upgrade(ctx, v3); err == nil {
+		t.Fatal("upgrade should fail")
+	}
+	if plg, _ := m.Get("upgrade"); plg != old || old.IsExited() {
+		t.Fatal("old version should keep running")
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+var errUserUnsupported = errors.New("running as another user is not supported on this platform")
+
+// DataDir is the only dir in the workdir owned by the user of the plugin,
+// and the one it runs in, so it keeps its own files there
+const DataDir = "data"
+
+// pluginUser is the credential the plugin runs with
+type pluginUser struct {
+	Uid uint32 `json:"uid"`
+	Gid uint32 `json:"gid"`
+}
+
+func (p *Plugin) dataDir() string {
+	return filepath.Join(p.workdir, DataDir)
+}
+
+// lookupUser resolves the user and the group of the plugin. A user by name
+// is created if it doesn't exist, and a uid is taken as is, with the gid of
+// the same number if it's not in the passwd.
+func lookupUser(name, group string) (*pluginUser, error) {
+	var (
+		pw  *user.User
+		err error
+	)
+	if _, err = strconv.ParseUint(name, 10, 32); err == nil {
+		if pw, err = user.LookupId(name); err != nil {
+			pw = &user.User{Uid: name, Gid: name}
+		}
+	} else {
+		pw, err = user.Lookup(name)
+		if _, ok := err.(user.UnknownUserError); ok {
+			if err = createUser(name); err != nil {
+				return nil, fmt.Errorf("create user %s: %w", name, err)
+			}
+			pw, err = user.Lookup(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	gid := pw.Gid
+	if group != "" {
+		gid = group
+		if _, err = strconv.ParseUint(group, 10, 32); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return nil, err
+			}
+			gid = g.Gid
+		}
+	}
+	uidNum, err := strconv.ParseUint(pw.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gidNum, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginUser{Uid: uint32(uidNum), Gid: uint32(gidNum)}, nil
+}
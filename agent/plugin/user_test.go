@@ -0,0 +1,84 @@
+//go:build linux
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLookupUser(t *testing.T) {
+	u, err := lookupUser("root", "")
+	if err != nil || u.Uid != 0 || u.Gid != 0 {
+		t.Fatalf("unexpected root: %+v, %v", u, err)
+	}
+	// a uid without passwd entry
+	if u, err = lookupUser("54321", "12345"); err != nil || u.Uid != 54321 || u.Gid != 12345 {
+		t.Fatalf("unexpected uid: %+v, %v", u, err)
+	}
+	if _, err = lookupUser("root", "no-such-group"); err == nil {
+		t.Fatal("unknown group should fail")
+	}
+}
+
+func runAsNobody(t *testing.T, name, script string, unprivileged bool) (dir string, status string) {
+	if os.Getuid() != 0 {
+		t.Skip("the user is switched by root only")
+	}
+	lockDir = filepath.Join(t.TempDir(), "lock")
+	m := NewManager(t.TempDir(), "hades-agent", newRecordTransmitter())
+	// the temp dirs above the workdir are not searchable by others
+	os.Chmod(filepath.Dir(m.Workdir), 0o711)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	t.Cleanup(m.UnregisterAll)
+	config := writeTestPluginAt(t, m.Workdir, name, script)
+	config.User = "65534"
+	config.Unprivileged = unprivileged
+	if unprivileged {
+		config.KeepCapabilities = []string{"CAP_DAC_OVERRIDE"}
+	}
+	if err := m.Load(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.Join(m.Workdir, "plugin", name)
+	waitFor(t, "status is not written", func() bool {
+		content, _ := os.ReadFile(filepath.Join(dir, DataDir, "status"))
+		status = string(content)
+		return strings.HasSuffix(status, "done\n")
+	})
+	return
+}
+
+func TestRunAsUser(t *testing.T) {
+	dir, status := runAsNobody(t, "nobody", "id -u > status; id -g >> status; echo done >> status\nexec cat <&3 >/dev/null", false)
+	if status != "65534\n65534\ndone\n" {
+		t.Fatalf("unexpected ids: %q", status)
+	}
+	info, err := os.Stat(filepath.Join(dir, "nobody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid != 0 || st.Gid != 65534 || info.Mode().Perm() != 0o550 {
+		t.Fatalf("unexpected binary: %d:%d %s", st.Uid, st.Gid, info.Mode())
+	}
+	if info, err = os.Stat(dir); err != nil || info.Sys().(*syscall.Stat_t).Uid != 0 {
+		t.Fatalf("workdir is handed to the user: %v", err)
+	}
+	if info, err = os.Stat(filepath.Join(dir, DataDir)); err != nil || info.Sys().(*syscall.Stat_t).Uid != 65534 {
+		t.Fatalf("data dir is not owned by the user: %v", err)
+	}
+}
+
+func TestRunAsUserSandboxed(t *testing.T) {
+	_, status := runAsNobody(t, "nobody-sandboxed", "id -u > status; grep -E '^Cap(Bnd|Amb|Eff):' /proc/self/status >> status; echo done >> status\nexec cat <&3 >/dev/null", true)
+	for _, line := range []string{"65534\n", "CapBnd:\t0000000000000002", "CapAmb:\t0000000000000002", "CapEff:\t0000000000000002"} {
+		if !strings.Contains(status, line) {
+			t.Errorf("%q is not in the status: %s", line, status)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// lockDir is where the SDK locks the plugin by name, it's shared by the
+// plugins of all users like /tmp
+var lockDir = "/var/lock/hades"
+
+// createUser adds a system user without home and login, by useradd or the
+// adduser of busybox
+func createUser(name string) error {
+	shell := "/usr/sbin/nologin"
+	if _, err := os.Stat(shell); err != nil {
+		shell = "/sbin/nologin"
+	}
+	var cmd *exec.Cmd
+	if useradd, err := exec.LookPath("useradd"); err == nil {
+		cmd = exec.Command(useradd, "--system", "--user-group", "--no-create-home", "--shell", shell, name)
+	} else if adduser, err := exec.LookPath("adduser"); err == nil {
+		cmd = exec.Command(adduser, "-S", "-D", "-H", "-s", shell, name)
+	} else {
+		return fmt.Errorf("neither useradd nor adduser is found")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setupUser resolves the user and hands DataDir to it, which the plugin
+// runs in. The rest of the workdir stays owned by root, the binaries are
+// executable by the group only, so the plugin is not able to modify them,
+// or anything the agent keeps for it.
+func (p *Plugin) setupUser(name, group string) (*pluginUser, error) {
+	u, err := lookupUser(name, group)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid := int(u.Uid), int(u.Gid)
+	data := p.dataDir()
+	if err = os.MkdirAll(data, 0o700); err != nil {
+		return nil, err
+	}
+	binaries := map[string]bool{path.Join(p.workdir, p.Name()): true, p.execPath: true}
+	// the files handed to the user by the former versions are taken back
+	err = filepath.Walk(p.workdir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case name == data || strings.HasPrefix(name, data+string(filepath.Separator)):
+			return os.Lchown(name, uid, gid)
+		case binaries[name]:
+			if err = os.Chown(name, 0, gid); err != nil {
+				return err
+			}
+			return os.Chmod(name, 0o550)
+		}
+		return os.Lchown(name, 0, 0)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chown workdir: %w", err)
+	}
+	// the workdir, the plugin dir and the agent workdir above it are
+	// searched through
+	for dir, i := p.workdir, 0; i < 3; dir, i = filepath.Dir(dir), i+1 {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().Perm()&0o001 == 0 {
+			if err = os.Chmod(dir, info.Mode().Perm()|0o001); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = os.MkdirAll(lockDir, 0o755); err == nil {
+		err = os.Chmod(lockDir, 0o777|os.ModeSticky)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock dir: %w", err)
+	}
+	// the lock left by the last run as another user
+	lock := path.Join(lockDir, p.Name()+".lockfile")
+	if err = os.Lchown(lock, uid, gid); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return u, nil
+}
+
+func setCredential(cmd *exec.Cmd, u *pluginUser) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: []uint32{}}
+}
@@ -0,0 +1,11 @@
+package plugin
+
+import "os/exec"
+
+func createUser(name string) error { return errUserUnsupported }
+
+func (p *Plugin) setupUser(name, group string) (*pluginUser, error) {
+	return nil, errUserUnsupported
+}
+
+func setCredential(cmd *exec.Cmd, u *pluginUser) {}
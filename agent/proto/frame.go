@@ -0,0 +1,11 @@
+package proto
+
+import "github.com/chriskaliX/SDK/framing"
+
+// EncodeTask returns the length-prefixed frame of the task, the same as
+// the SDK decodes
+func EncodeTask(t *Task) ([]byte, error) { return framing.Encode(t, nil) }
+
+// EncodeRecord returns the length-prefixed frame of the record, the same
+// as the SDK encodes
+func EncodeRecord(rec *Record) ([]byte, error) { return framing.Encode(rec, nil) }
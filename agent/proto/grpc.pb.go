@@ -26,6 +26,32 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
+// Origin tells who produces the record
+type Origin int32
+
+const (
+	Origin_PLUGIN Origin = 0
+	Origin_AGENT  Origin = 1
+)
+
+var Origin_name = map[int32]string{
+	0: "PLUGIN",
+	1: "AGENT",
+}
+
+var Origin_value = map[string]int32{
+	"PLUGIN": 0,
+	"AGENT":  1,
+}
+
+func (x Origin) String() string {
+	return proto.EnumName(Origin_name, int32(x))
+}
+
+func (Origin) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_bedfbfc9b54e5600, []int{0}
+}
+
 type FileUploadResponse_StatusCode int32
 
 const (
@@ -231,6 +257,17 @@ type Record struct {
 	DataType  int32    `protobuf:"varint,1,opt,name=data_type,json=dataType,proto3" json:"data_type,omitempty"`
 	Timestamp int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	Data      *Payload `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Origin    Origin   `protobuf:"varint,4,opt,name=origin,proto3,enum=grpc.Origin" json:"origin,omitempty"`
+	// data encoded by the encoding, data is not set then
+	Compressed []byte `protobuf:"bytes,5,opt,name=compressed,json=compressed,proto3" json:"compressed,omitempty"`
+	// encoding of compressed, as snappy
+	Encoding string `protobuf:"bytes,6,opt,name=encoding,json=encoding,proto3" json:"encoding,omitempty"`
+	// name of the plugin which sends it, empty for the agent
+	Plugin string `protobuf:"bytes,7,opt,name=plugin,json=plugin,proto3" json:"plugin,omitempty"`
+	// version of the schema of the data type, 0 if it's unversioned
+	SchemaVersion int32 `protobuf:"varint,8,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// labels of the agent, attached to every record it sends
+	Labels map[string]string `protobuf:"bytes,9,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *Record) Reset()         { *m = Record{} }
@@ -287,6 +324,48 @@ func (m *Record) GetData() *Payload {
 	return nil
 }
 
+func (m *Record) GetOrigin() Origin {
+	if m != nil {
+		return m.Origin
+	}
+	return Origin_PLUGIN
+}
+
+func (m *Record) GetCompressed() []byte {
+	if m != nil {
+		return m.Compressed
+	}
+	return nil
+}
+
+func (m *Record) GetEncoding() string {
+	if m != nil {
+		return m.Encoding
+	}
+	return ""
+}
+
+func (m *Record) GetPlugin() string {
+	if m != nil {
+		return m.Plugin
+	}
+	return ""
+}
+
+func (m *Record) GetSchemaVersion() int32 {
+	if m != nil {
+		return m.SchemaVersion
+	}
+	return 0
+}
+
+func (m *Record) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
 type Payload struct {
 	Fields map[string]string `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
@@ -452,13 +531,104 @@ func (m *Task) GetToken() string {
 }
 
 type Config struct {
-	Name         string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Type         string   `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
-	Version      string   `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
-	Sha256       string   `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
-	Signature    string   `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
-	DownloadUrls []string `protobuf:"bytes,6,rep,name=download_urls,json=downloadUrls,proto3" json:"download_urls,omitempty"`
-	Detail       string   `protobuf:"bytes,7,opt,name=detail,proto3" json:"detail,omitempty"`
+	Name              string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type              string   `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Version           string   `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	Sha256            string   `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	Signature         string   `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	DownloadUrls      []string `protobuf:"bytes,6,rep,name=download_urls,json=downloadUrls,proto3" json:"download_urls,omitempty"`
+	Detail            string   `protobuf:"bytes,7,opt,name=detail,proto3" json:"detail,omitempty"`
+	SlowTaskThreshold int64    `protobuf:"varint,8,opt,name=slow_task_threshold,json=slowTaskThreshold,proto3" json:"slow_task_threshold,omitempty"`
+	Oneshot           bool     `protobuf:"varint,9,opt,name=oneshot,proto3" json:"oneshot,omitempty"`
+	ReadTimeout       int64    `protobuf:"varint,10,opt,name=read_timeout,json=readTimeout,proto3" json:"read_timeout,omitempty"`
+	Priority          int32    `protobuf:"varint,11,opt,name=priority,proto3" json:"priority,omitempty"`
+	Immutable         bool     `protobuf:"varint,12,opt,name=immutable,proto3" json:"immutable,omitempty"`
+	TaskBufferSize    int32    `protobuf:"varint,13,opt,name=task_buffer_size,json=taskBufferSize,proto3" json:"task_buffer_size,omitempty"`
+	TaskBatch         bool     `protobuf:"varint,14,opt,name=task_batch,json=taskBatch,proto3" json:"task_batch,omitempty"`
+	// fields of records to pass, all other fields are removed
+	FieldAllowlist []string `protobuf:"bytes,15,rep,name=field_allowlist,json=fieldAllowlist,proto3" json:"field_allowlist,omitempty"`
+	// fields of records to remove, ignored if field_allowlist is set
+	FieldDenylist []string `protobuf:"bytes,16,rep,name=field_denylist,json=fieldDenylist,proto3" json:"field_denylist,omitempty"`
+	// correct timestamps of records by the measured clock offset of plugin
+	ClockCorrection bool `protobuf:"varint,17,opt,name=clock_correction,json=clockCorrection,proto3" json:"clock_correction,omitempty"`
+	// tag records with pid and start time of the plugin process
+	TagInstance bool `protobuf:"varint,18,opt,name=tag_instance,json=tagInstance,proto3" json:"tag_instance,omitempty"`
+	// the cgroup path the plugin is expected in, verified after launch
+	ExpectedCgroup string `protobuf:"bytes,19,opt,name=expected_cgroup,json=expectedCgroup,proto3" json:"expected_cgroup,omitempty"`
+	// namespaces the plugin is expected in, in the format of readlink of
+	// /proc/<pid>/ns/*, like net:[4026531992]
+	ExpectedNamespaces []string `protobuf:"bytes,20,rep,name=expected_namespaces,json=expectedNamespaces,proto3" json:"expected_namespaces,omitempty"`
+	// shutdown the plugin if the placement doesn't match
+	KillOnMisplacement bool `protobuf:"varint,21,opt,name=kill_on_misplacement,json=killOnMisplacement,proto3" json:"kill_on_misplacement,omitempty"`
+	// quarantine the plugin after crashes in a row, 0 for never
+	QuarantineThreshold int32 `protobuf:"varint,22,opt,name=quarantine_threshold,json=quarantineThreshold,proto3" json:"quarantine_threshold,omitempty"`
+	// download bandwidth cap in bytes/sec, 0 for the global cap only
+	DownloadLimit int64 `protobuf:"varint,23,opt,name=download_limit,json=downloadLimit,proto3" json:"download_limit,omitempty"`
+	// data types the server understands, all types are known if empty
+	KnownTypes []int32 `protobuf:"varint,24,rep,packed,name=known_types,json=knownTypes,proto3" json:"known_types,omitempty"`
+	// how records out of known_types are handled: "forward" by default,
+	// "flag" to forward with unknown_type set, or "drop"
+	UnknownTypePolicy string `protobuf:"bytes,25,opt,name=unknown_type_policy,json=unknownTypePolicy,proto3" json:"unknown_type_policy,omitempty"`
+	// deadline of the whole startup, from download to the startup probe,
+	// 0 for no deadline
+	StartupTimeout int64 `protobuf:"varint,26,opt,name=startup_timeout,json=startupTimeout,proto3" json:"startup_timeout,omitempty"`
+	// cpu limit in percent of a single cpu, 0 for no limit
+	CpuLimit int32 `protobuf:"varint,27,opt,name=cpu_limit,json=cpuLimit,proto3" json:"cpu_limit,omitempty"`
+	// memory limit in bytes, 0 for no limit
+	MemoryLimit int64 `protobuf:"varint,28,opt,name=memory_limit,json=memoryLimit,proto3" json:"memory_limit,omitempty"`
+	// kill the whole plugin on OOM instead of a single process
+	KillOnOom bool `protobuf:"varint,29,opt,name=kill_on_oom,json=killOnOom,proto3" json:"kill_on_oom,omitempty"`
+	// milliseconds
+	HeartbeatTimeout int64 `protobuf:"varint,30,opt,name=heartbeat_timeout,json=heartbeatTimeout,proto3" json:"heartbeat_timeout,omitempty"`
+	// plugins this one depends on, it's started after they are ready and
+	// shut down before them
+	DependsOn []string `protobuf:"bytes,31,rep,name=depends_on,json=dependsOn,proto3" json:"depends_on,omitempty"`
+	// attach the container and the pod of the process in the pid field to
+	// records, as container_id, container_image, pod_name, pod_namespace
+	// and pod_uid
+	EnrichContainer bool `protobuf:"varint,32,opt,name=enrich_container,json=enrichContainer,proto3" json:"enrich_container,omitempty"`
+	// records per second accepted from the plugin, the ones over it are
+	// dropped, 0 for no limit
+	RecordRateLimit int32 `protobuf:"varint,33,opt,name=record_rate_limit,json=recordRateLimit,proto3" json:"record_rate_limit,omitempty"`
+	// records accepted in a burst over record_rate_limit, a second of it if
+	// it's not set
+	RecordBurst int32 `protobuf:"varint,34,opt,name=record_burst,json=recordBurst,proto3" json:"record_burst,omitempty"`
+	// size in megabytes of the stderr and stdout files before they are rotated
+	LogMaxSize int32 `protobuf:"varint,35,opt,name=log_max_size,json=logMaxSize,proto3" json:"log_max_size,omitempty"`
+	// days the rotated stderr and stdout files are kept
+	LogMaxAge int32 `protobuf:"varint,36,opt,name=log_max_age,json=logMaxAge,proto3" json:"log_max_age,omitempty"`
+	// last lines of stderr attached to the crashed event, 0 for none
+	CrashLogLines int32 `protobuf:"varint,37,opt,name=crash_log_lines,json=crashLogLines,proto3" json:"crash_log_lines,omitempty"`
+	// drop the capabilities other than keep_capabilities, set no_new_privs and
+	// apply the default seccomp filter if seccomp_denylist is not set
+	Unprivileged bool `protobuf:"varint,38,opt,name=unprivileged,json=unprivileged,proto3" json:"unprivileged,omitempty"`
+	// capabilities kept by an unprivileged plugin, as CAP_SYS_PTRACE
+	KeepCapabilities []string `protobuf:"bytes,39,rep,name=keep_capabilities,json=keepCapabilities,proto3" json:"keep_capabilities,omitempty"`
+	// syscalls failed with EPERM by the seccomp filter, as mount
+	SeccompDenylist []string `protobuf:"bytes,40,rep,name=seccomp_denylist,json=seccompDenylist,proto3" json:"seccomp_denylist,omitempty"`
+	// run the plugin as the user, by name or uid, a missing user is created as
+	// a system user. It runs in the data dir of its workdir, the only one
+	// owned by the user.
+	User string `protobuf:"bytes,41,opt,name=user,json=user,proto3" json:"user,omitempty"`
+	// group of the plugin by name or gid, the primary group of user if not set
+	Group string `protobuf:"bytes,42,opt,name=group,json=group,proto3" json:"group,omitempty"`
+	// size of the shared memory ring which carries the records, rounded up to a
+	// power of two. The plugin falls back to the pipe if it does not attach.
+	RingBufferSize int32 `protobuf:"varint,43,opt,name=ring_buffer_size,json=ringBufferSize,proto3" json:"ring_buffer_size,omitempty"`
+	// how long the sync waits for depends_on to be ready before the start,
+	// milliseconds, 30s if not set
+	DependencyTimeout int64 `protobuf:"varint,44,opt,name=dependency_timeout,json=dependencyTimeout,proto3" json:"dependency_timeout,omitempty"`
+	// size limit of the workdir in bytes, including the binary, 0 for no limit.
+	// Rotated logs and temp files are removed once it's exceeded, and the
+	// plugin is shut down and quarantined if it's still exceeded.
+	DiskQuota int64 `protobuf:"varint,45,opt,name=disk_quota,json=diskQuota,proto3" json:"disk_quota,omitempty"`
+	// size of the pipes in bytes by F_SETPIPE_SZ, which is limited by
+	// /proc/sys/fs/pipe-max-size for an unprivileged agent, 0 for the
+	// kernel default
+	PipeBufferSize int32 `protobuf:"varint,46,opt,name=pipe_buffer_size,json=pipeBufferSize,proto3" json:"pipe_buffer_size,omitempty"`
+	// size of the reader of records in bytes, which bounds the records
+	// decoded without a copy, 128KB if not set
+	ReadBufferSize int32 `protobuf:"varint,47,opt,name=read_buffer_size,json=readBufferSize,proto3" json:"read_buffer_size,omitempty"`
 }
 
 func (m *Config) Reset()         { *m = Config{} }
@@ -543,6 +713,286 @@ func (m *Config) GetDetail() string {
 	return ""
 }
 
+func (m *Config) GetSlowTaskThreshold() int64 {
+	if m != nil {
+		return m.SlowTaskThreshold
+	}
+	return 0
+}
+
+func (m *Config) GetOneshot() bool {
+	if m != nil {
+		return m.Oneshot
+	}
+	return false
+}
+
+func (m *Config) GetReadTimeout() int64 {
+	if m != nil {
+		return m.ReadTimeout
+	}
+	return 0
+}
+
+func (m *Config) GetPriority() int32 {
+	if m != nil {
+		return m.Priority
+	}
+	return 0
+}
+
+func (m *Config) GetImmutable() bool {
+	if m != nil {
+		return m.Immutable
+	}
+	return false
+}
+
+func (m *Config) GetTaskBufferSize() int32 {
+	if m != nil {
+		return m.TaskBufferSize
+	}
+	return 0
+}
+
+func (m *Config) GetTaskBatch() bool {
+	if m != nil {
+		return m.TaskBatch
+	}
+	return false
+}
+
+func (m *Config) GetFieldAllowlist() []string {
+	if m != nil {
+		return m.FieldAllowlist
+	}
+	return nil
+}
+
+func (m *Config) GetFieldDenylist() []string {
+	if m != nil {
+		return m.FieldDenylist
+	}
+	return nil
+}
+
+func (m *Config) GetClockCorrection() bool {
+	if m != nil {
+		return m.ClockCorrection
+	}
+	return false
+}
+
+func (m *Config) GetTagInstance() bool {
+	if m != nil {
+		return m.TagInstance
+	}
+	return false
+}
+
+func (m *Config) GetExpectedCgroup() string {
+	if m != nil {
+		return m.ExpectedCgroup
+	}
+	return ""
+}
+
+func (m *Config) GetExpectedNamespaces() []string {
+	if m != nil {
+		return m.ExpectedNamespaces
+	}
+	return nil
+}
+
+func (m *Config) GetKillOnMisplacement() bool {
+	if m != nil {
+		return m.KillOnMisplacement
+	}
+	return false
+}
+
+func (m *Config) GetQuarantineThreshold() int32 {
+	if m != nil {
+		return m.QuarantineThreshold
+	}
+	return 0
+}
+
+func (m *Config) GetDownloadLimit() int64 {
+	if m != nil {
+		return m.DownloadLimit
+	}
+	return 0
+}
+
+func (m *Config) GetKnownTypes() []int32 {
+	if m != nil {
+		return m.KnownTypes
+	}
+	return nil
+}
+
+func (m *Config) GetUnknownTypePolicy() string {
+	if m != nil {
+		return m.UnknownTypePolicy
+	}
+	return ""
+}
+
+func (m *Config) GetStartupTimeout() int64 {
+	if m != nil {
+		return m.StartupTimeout
+	}
+	return 0
+}
+
+func (m *Config) GetCpuLimit() int32 {
+	if m != nil {
+		return m.CpuLimit
+	}
+	return 0
+}
+
+func (m *Config) GetMemoryLimit() int64 {
+	if m != nil {
+		return m.MemoryLimit
+	}
+	return 0
+}
+
+func (m *Config) GetKillOnOom() bool {
+	if m != nil {
+		return m.KillOnOom
+	}
+	return false
+}
+
+func (m *Config) GetHeartbeatTimeout() int64 {
+	if m != nil {
+		return m.HeartbeatTimeout
+	}
+	return 0
+}
+
+func (m *Config) GetDependsOn() []string {
+	if m != nil {
+		return m.DependsOn
+	}
+	return nil
+}
+
+func (m *Config) GetEnrichContainer() bool {
+	if m != nil {
+		return m.EnrichContainer
+	}
+	return false
+}
+
+func (m *Config) GetRecordRateLimit() int32 {
+	if m != nil {
+		return m.RecordRateLimit
+	}
+	return 0
+}
+
+func (m *Config) GetRecordBurst() int32 {
+	if m != nil {
+		return m.RecordBurst
+	}
+	return 0
+}
+
+func (m *Config) GetLogMaxSize() int32 {
+	if m != nil {
+		return m.LogMaxSize
+	}
+	return 0
+}
+
+func (m *Config) GetLogMaxAge() int32 {
+	if m != nil {
+		return m.LogMaxAge
+	}
+	return 0
+}
+
+func (m *Config) GetCrashLogLines() int32 {
+	if m != nil {
+		return m.CrashLogLines
+	}
+	return 0
+}
+
+func (m *Config) GetUnprivileged() bool {
+	if m != nil {
+		return m.Unprivileged
+	}
+	return false
+}
+
+func (m *Config) GetKeepCapabilities() []string {
+	if m != nil {
+		return m.KeepCapabilities
+	}
+	return nil
+}
+
+func (m *Config) GetSeccompDenylist() []string {
+	if m != nil {
+		return m.SeccompDenylist
+	}
+	return nil
+}
+
+func (m *Config) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *Config) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *Config) GetRingBufferSize() int32 {
+	if m != nil {
+		return m.RingBufferSize
+	}
+	return 0
+}
+
+func (m *Config) GetDependencyTimeout() int64 {
+	if m != nil {
+		return m.DependencyTimeout
+	}
+	return 0
+}
+
+func (m *Config) GetDiskQuota() int64 {
+	if m != nil {
+		return m.DiskQuota
+	}
+	return 0
+}
+
+func (m *Config) GetPipeBufferSize() int32 {
+	if m != nil {
+		return m.PipeBufferSize
+	}
+	return 0
+}
+
+func (m *Config) GetReadBufferSize() int32 {
+	if m != nil {
+		return m.ReadBufferSize
+	}
+	return 0
+}
+
 type FileUploadRequest struct {
 	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
 	Data  []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
@@ -640,12 +1090,14 @@ func (m *FileUploadResponse) GetStatus() FileUploadResponse_StatusCode {
 }
 
 func init() {
+	proto.RegisterEnum("grpc.Origin", Origin_name, Origin_value)
 	proto.RegisterEnum("grpc.FileUploadResponse_StatusCode", FileUploadResponse_StatusCode_name, FileUploadResponse_StatusCode_value)
 	proto.RegisterType((*PackagedData)(nil), "grpc.PackagedData")
 	proto.RegisterType((*EncodedRecord)(nil), "grpc.EncodedRecord")
 	proto.RegisterType((*Record)(nil), "grpc.Record")
 	proto.RegisterType((*Payload)(nil), "grpc.Payload")
 	proto.RegisterMapType((map[string]string)(nil), "grpc.Payload.FieldsEntry")
+	proto.RegisterMapType((map[string]string)(nil), "grpc.Record.LabelsEntry")
 	proto.RegisterType((*Command)(nil), "grpc.Command")
 	proto.RegisterType((*Task)(nil), "grpc.Task")
 	proto.RegisterType((*Config)(nil), "grpc.Config")
@@ -656,53 +1108,106 @@ func init() {
 func init() { proto.RegisterFile("grpc.proto", fileDescriptor_bedfbfc9b54e5600) }
 
 var fileDescriptor_bedfbfc9b54e5600 = []byte{
-	// 727 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0x4d, 0x6f, 0x1a, 0x49,
-	0x10, 0x65, 0xf8, 0x98, 0x61, 0x0a, 0x58, 0x79, 0x5b, 0xab, 0xdd, 0x36, 0xbb, 0xc2, 0xec, 0x58,
-	0xbb, 0x62, 0x2f, 0x68, 0x83, 0x1d, 0x94, 0x0f, 0x59, 0x51, 0x82, 0xb1, 0x62, 0x29, 0x8a, 0x9c,
-	0xc1, 0xbe, 0xe4, 0x10, 0xd4, 0x66, 0x1a, 0x3c, 0x01, 0xba, 0x27, 0xd3, 0x0d, 0x36, 0xff, 0x22,
-	0x7f, 0x28, 0xf7, 0x1c, 0x7d, 0xcc, 0xd1, 0xb2, 0xff, 0x48, 0xd4, 0xdd, 0x0c, 0x8c, 0x83, 0x92,
-	0x4b, 0x4e, 0x54, 0xbd, 0x7a, 0xfd, 0xba, 0xaa, 0xfa, 0x31, 0x00, 0xa3, 0x38, 0x1a, 0x34, 0xa3,
-	0x98, 0x4b, 0x8e, 0xf2, 0x2a, 0xf6, 0x6e, 0xb2, 0x50, 0x3e, 0x21, 0x83, 0x31, 0x19, 0xd1, 0xe0,
-	0x90, 0x48, 0x82, 0xfe, 0x05, 0x27, 0xa6, 0x03, 0x1e, 0x07, 0x02, 0x5b, 0xf5, 0x5c, 0xa3, 0xd4,
-	0x2a, 0x37, 0xf5, 0x21, 0x5f, 0x83, 0x7e, 0x52, 0x44, 0xff, 0x41, 0x31, 0x22, 0x8b, 0x09, 0x27,
-	0x81, 0xc0, 0x59, 0x4d, 0xac, 0x18, 0xe2, 0x89, 0x41, 0xfd, 0x55, 0x19, 0x6d, 0x43, 0x91, 0x8c,
-	0x28, 0x93, 0xfd, 0x30, 0xc0, 0xb9, 0xba, 0xd5, 0x70, 0x7d, 0x47, 0xe7, 0xc7, 0x01, 0xda, 0x85,
-	0x4a, 0xc8, 0x64, 0x4c, 0x18, 0x95, 0xfd, 0x30, 0x9a, 0xef, 0xe3, 0x7c, 0x3d, 0xd7, 0x70, 0xfd,
-	0x72, 0x02, 0x1e, 0x47, 0xf3, 0x7d, 0x45, 0xa2, 0x57, 0x69, 0x52, 0xc1, 0x90, 0x12, 0x30, 0x21,
-	0xa5, 0x95, 0xda, 0xd8, 0xde, 0x50, 0x6a, 0x7f, 0xab, 0xd4, 0xc6, 0xce, 0x86, 0x52, 0x1b, 0x55,
-	0xa1, 0x78, 0xc1, 0x85, 0x64, 0x64, 0x4a, 0x71, 0x51, 0xb7, 0xbb, 0xca, 0x11, 0x06, 0x67, 0x4e,
-	0x63, 0x11, 0x72, 0x86, 0x5d, 0x33, 0xc9, 0x32, 0x55, 0x95, 0x28, 0xe6, 0xc1, 0x6c, 0x20, 0x31,
-	0x98, 0xca, 0x32, 0xf5, 0xde, 0x41, 0xa5, 0xcb, 0x06, 0x3c, 0xa0, 0x81, 0xd9, 0x21, 0xfa, 0x13,
-	0xdc, 0x80, 0x48, 0xd2, 0x97, 0x8b, 0x88, 0x62, 0xab, 0x6e, 0x35, 0x0a, 0x7e, 0x51, 0x01, 0xa7,
-	0x8b, 0x88, 0xa2, 0xbf, 0xc0, 0x95, 0xe1, 0x94, 0x0a, 0x49, 0xa6, 0x11, 0xce, 0xd6, 0xad, 0x46,
-	0xce, 0x5f, 0x03, 0x08, 0x41, 0x5e, 0x31, 0xf5, 0x1a, 0xcb, 0xbe, 0x8e, 0xbd, 0x21, 0xd8, 0x3f,
-	0x2f, 0xfc, 0x77, 0x4a, 0x78, 0xe3, 0x29, 0xcd, 0x3d, 0x97, 0xe0, 0x2c, 0x01, 0xf4, 0x00, 0xec,
-	0x61, 0x48, 0x27, 0x2b, 0x8f, 0x6c, 0xdf, 0xe3, 0x37, 0x8f, 0x74, 0xad, 0xcb, 0x64, 0xbc, 0xf0,
-	0x97, 0xc4, 0xea, 0x63, 0x28, 0xa5, 0x60, 0xb4, 0x05, 0xb9, 0x31, 0x5d, 0xe8, 0x26, 0x5d, 0x5f,
-	0x85, 0xe8, 0x37, 0x28, 0xcc, 0xc9, 0x64, 0x46, 0x75, 0x6f, 0xae, 0x6f, 0x92, 0x27, 0xd9, 0x47,
-	0x96, 0xf7, 0x06, 0x9c, 0x0e, 0x9f, 0x4e, 0x09, 0x0b, 0x50, 0x0d, 0xf2, 0x92, 0x88, 0xb1, 0xe6,
-	0x94, 0x5a, 0x60, 0xae, 0x3d, 0x25, 0x62, 0xec, 0x6b, 0x5c, 0xb9, 0x77, 0xc0, 0xd9, 0x30, 0x1c,
-	0x09, 0x9c, 0x4b, 0xbb, 0xb7, 0xa3, 0x41, 0x3f, 0x29, 0x7a, 0x0c, 0xf2, 0xea, 0xd4, 0x8f, 0x37,
-	0xb6, 0x03, 0x25, 0x7e, 0xfe, 0x9e, 0x0e, 0x64, 0x5f, 0x7b, 0xc1, 0xf4, 0x05, 0x06, 0x7a, 0xad,
-	0xdc, 0x90, 0x7e, 0x0d, 0xd7, 0x6c, 0x49, 0x8d, 0x21, 0xf9, 0x98, 0x32, 0x9c, 0x37, 0x63, 0xe8,
-	0xc4, 0xfb, 0x64, 0x81, 0x6d, 0x7a, 0x50, 0x87, 0xb4, 0x9c, 0x19, 0x5d, 0xc7, 0x0a, 0xd3, 0x1d,
-	0x98, 0x2b, 0x74, 0x9c, 0xb6, 0x5a, 0xee, 0xbe, 0xd5, 0x7e, 0x07, 0x5b, 0x5c, 0x90, 0xd6, 0xc3,
-	0xf6, 0xf2, 0x8e, 0x65, 0xa6, 0x5e, 0x58, 0x84, 0x23, 0x46, 0xe4, 0x2c, 0xa6, 0xb8, 0xa0, 0x4b,
-	0x6b, 0x40, 0x79, 0x3f, 0xe0, 0x97, 0x4c, 0x3d, 0x50, 0x7f, 0x16, 0x4f, 0x44, 0xf2, 0x07, 0x49,
-	0xc0, 0xb3, 0x78, 0x22, 0x94, 0x74, 0x40, 0x25, 0x09, 0x27, 0xd8, 0x31, 0xd2, 0x26, 0xf3, 0x0e,
-	0xe0, 0xd7, 0xa3, 0x70, 0x42, 0xcf, 0x22, 0xed, 0x07, 0xfa, 0x61, 0x46, 0x85, 0x5c, 0x8f, 0x6a,
-	0xa5, 0x46, 0x5d, 0x2d, 0x25, 0x9b, 0xb2, 0xe8, 0x15, 0xa0, 0xf4, 0x71, 0x11, 0x71, 0x26, 0x28,
-	0x7a, 0x0a, 0xb6, 0x90, 0x44, 0xce, 0x84, 0x16, 0xf8, 0xa5, 0xb5, 0x6b, 0xde, 0x6a, 0x93, 0xd9,
-	0xec, 0x69, 0x5a, 0x87, 0x07, 0xd4, 0x5f, 0x1e, 0xf1, 0xfe, 0x01, 0x58, 0xa3, 0xa8, 0x04, 0x4e,
-	0xef, 0xac, 0xd3, 0xe9, 0xf6, 0x7a, 0x5b, 0x19, 0x04, 0x60, 0x1f, 0x3d, 0x3f, 0x7e, 0xd5, 0x3d,
-	0xdc, 0xb2, 0x5a, 0xcf, 0xa0, 0x78, 0x1a, 0x13, 0x26, 0x86, 0x34, 0x46, 0x7b, 0xa9, 0x18, 0x25,
-	0x8e, 0x5d, 0x7f, 0xfa, 0xaa, 0x95, 0xc4, 0x2b, 0xda, 0x6b, 0x5e, 0xa6, 0x61, 0xfd, 0x6f, 0xb5,
-	0x5e, 0x82, 0xa3, 0x1a, 0xea, 0x5e, 0x49, 0x74, 0x00, 0xb6, 0xe9, 0x0b, 0xfd, 0xb1, 0xd9, 0xa9,
-	0x5e, 0x49, 0x15, 0x7f, 0x6f, 0x84, 0x86, 0xf5, 0x62, 0xe7, 0xf3, 0x6d, 0xcd, 0xba, 0xbe, 0xad,
-	0x59, 0x37, 0xb7, 0x35, 0xeb, 0xe3, 0x5d, 0x2d, 0x73, 0x7d, 0x57, 0xcb, 0x7c, 0xb9, 0xab, 0x65,
-	0xde, 0x16, 0xf4, 0x17, 0xf9, 0xdc, 0xd6, 0x3f, 0x7b, 0x5f, 0x03, 0x00, 0x00, 0xff, 0xff, 0xc4,
-	0x46, 0xa0, 0x85, 0xa6, 0x05, 0x00, 0x00,
+	// 1582 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x57, 0x5f, 0x73, 0x1b, 0xb7,
+	0x11, 0x17, 0x45, 0x89, 0x14, 0x97, 0x14, 0x45, 0xc1, 0x6a, 0x02, 0xcb, 0x31, 0x4d, 0xd3, 0xb1,
+	0x43, 0x3b, 0x8d, 0xe2, 0x28, 0xa9, 0xa6, 0x7f, 0x26, 0xd3, 0xb1, 0x69, 0x39, 0xd5, 0x8c, 0x62,
+	0x3b, 0x27, 0xb9, 0x0f, 0x7d, 0xe8, 0x0d, 0x74, 0x07, 0x91, 0x28, 0xef, 0x80, 0x33, 0x80, 0x93,
+	0xc4, 0x7c, 0x8a, 0x7e, 0x91, 0x7e, 0x8f, 0x3e, 0xe6, 0xb1, 0x8f, 0x19, 0xfb, 0x2b, 0xf4, 0x03,
+	0x74, 0xb0, 0xb8, 0x23, 0x4f, 0xd5, 0xb4, 0x33, 0x9d, 0x3e, 0x11, 0xf8, 0xed, 0xef, 0x76, 0x17,
+	0x8b, 0xdf, 0xee, 0x1d, 0x01, 0x26, 0x3a, 0x8b, 0xf6, 0x32, 0xad, 0xac, 0x22, 0x6b, 0x6e, 0x3d,
+	0xfc, 0x79, 0x15, 0x3a, 0x6f, 0x58, 0x34, 0x63, 0x13, 0x1e, 0xbf, 0x60, 0x96, 0x91, 0x47, 0xd0,
+	0xd4, 0x3c, 0x52, 0x3a, 0x36, 0xb4, 0x36, 0xa8, 0x8f, 0xda, 0xfb, 0x9d, 0x3d, 0x7c, 0x28, 0x40,
+	0x30, 0x28, 0x8d, 0xe4, 0x31, 0x6c, 0x64, 0x6c, 0x9e, 0x28, 0x16, 0x1b, 0xba, 0x8a, 0xc4, 0x4d,
+	0x4f, 0x7c, 0xe3, 0xd1, 0x60, 0x61, 0x26, 0xb7, 0x61, 0x83, 0x4d, 0xb8, 0xb4, 0xa1, 0x88, 0x69,
+	0x7d, 0x50, 0x1b, 0xb5, 0x82, 0x26, 0xee, 0x8f, 0x62, 0xf2, 0x00, 0x36, 0x85, 0xb4, 0x9a, 0x49,
+	0x6e, 0x43, 0x91, 0x5d, 0x7c, 0x43, 0xd7, 0x06, 0xf5, 0x51, 0x2b, 0xe8, 0x94, 0xe0, 0x51, 0x76,
+	0xf1, 0x8d, 0x23, 0xf1, 0xab, 0x2a, 0x69, 0xdd, 0x93, 0xf8, 0xd5, 0x75, 0x52, 0xd5, 0xd3, 0x01,
+	0x6d, 0xdc, 0xf0, 0x74, 0xf0, 0xef, 0x9e, 0x0e, 0x68, 0xf3, 0x86, 0xa7, 0x03, 0xb2, 0x0b, 0x1b,
+	0x53, 0x65, 0xac, 0x64, 0x29, 0xa7, 0x1b, 0x98, 0xee, 0x62, 0x4f, 0x28, 0x34, 0x2f, 0xb8, 0x36,
+	0x42, 0x49, 0xda, 0xf2, 0x27, 0x29, 0xb6, 0xce, 0x92, 0x69, 0x15, 0xe7, 0x91, 0xa5, 0xe0, 0x2d,
+	0xc5, 0x76, 0xf8, 0x67, 0xd8, 0x3c, 0x94, 0x91, 0x8a, 0x79, 0xec, 0x6b, 0x48, 0xee, 0x40, 0x2b,
+	0x66, 0x96, 0x85, 0x76, 0x9e, 0x71, 0x5a, 0x1b, 0xd4, 0x46, 0xeb, 0xc1, 0x86, 0x03, 0x4e, 0xe7,
+	0x19, 0x27, 0x9f, 0x40, 0xcb, 0x8a, 0x94, 0x1b, 0xcb, 0xd2, 0x8c, 0xae, 0x0e, 0x6a, 0xa3, 0x7a,
+	0xb0, 0x04, 0x08, 0x81, 0x35, 0xc7, 0xc4, 0x32, 0x76, 0x02, 0x5c, 0x0f, 0xff, 0xb9, 0x0a, 0x8d,
+	0xff, 0xdf, 0xf3, 0xfd, 0x8a, 0xe7, 0x1b, 0x77, 0x89, 0x26, 0xf2, 0x29, 0x34, 0x94, 0x16, 0x13,
+	0x21, 0xe9, 0xda, 0xa0, 0x36, 0xea, 0x96, 0xca, 0x78, 0x8d, 0x58, 0x50, 0xd8, 0x48, 0x1f, 0x20,
+	0x52, 0x69, 0xa6, 0xb9, 0x31, 0x3c, 0xa6, 0xeb, 0x98, 0x68, 0x05, 0x71, 0xe5, 0xe5, 0xae, 0x1c,
+	0x42, 0x4e, 0x68, 0xc3, 0x97, 0xb7, 0xdc, 0x93, 0x8f, 0xa0, 0x91, 0x25, 0xb9, 0x8b, 0xd0, 0x44,
+	0x4b, 0xb1, 0x23, 0x0f, 0xa1, 0x6b, 0xa2, 0x29, 0x4f, 0x59, 0x58, 0x56, 0x7f, 0x03, 0x0f, 0xb7,
+	0xe9, 0xd1, 0x3f, 0x16, 0x77, 0xf0, 0x14, 0x1a, 0x09, 0x3b, 0xe3, 0x89, 0xa1, 0x2d, 0x54, 0x24,
+	0xad, 0x4a, 0x77, 0xef, 0x18, 0x4d, 0x87, 0xd2, 0xea, 0x79, 0x50, 0xf0, 0x76, 0x7f, 0x03, 0xed,
+	0x0a, 0x4c, 0x7a, 0x50, 0x9f, 0xf1, 0x39, 0x56, 0xae, 0x15, 0xb8, 0x25, 0xd9, 0x81, 0xf5, 0x0b,
+	0x96, 0xe4, 0x1c, 0x0b, 0xd6, 0x0a, 0xfc, 0xe6, 0xb7, 0xab, 0xbf, 0xae, 0x0d, 0x2f, 0xa1, 0x59,
+	0x94, 0x87, 0x7c, 0x05, 0x8d, 0x73, 0xc1, 0x93, 0x45, 0xcb, 0xdc, 0xbe, 0x56, 0xbd, 0xbd, 0x97,
+	0x68, 0x2b, 0x02, 0x7b, 0xa2, 0x0b, 0x5c, 0x81, 0xff, 0xa7, 0xc0, 0x3f, 0x40, 0x73, 0xac, 0xd2,
+	0x94, 0xc9, 0x98, 0xf4, 0x61, 0xcd, 0x32, 0x33, 0x43, 0x4e, 0x7b, 0x1f, 0x7c, 0xd8, 0x53, 0x66,
+	0x66, 0x01, 0xe2, 0xae, 0x99, 0x23, 0x25, 0xcf, 0xc5, 0xc4, 0xd0, 0x7a, 0xb5, 0x99, 0xc7, 0x08,
+	0x06, 0xa5, 0x71, 0x28, 0x61, 0xcd, 0x3d, 0xf5, 0xdf, 0xf5, 0x73, 0x0f, 0xda, 0xea, 0xec, 0x2f,
+	0x3c, 0xb2, 0x21, 0xb6, 0x86, 0xcf, 0x0b, 0x3c, 0xf4, 0xca, 0x35, 0x47, 0x55, 0x9c, 0xad, 0x42,
+	0x33, 0x3b, 0xb0, 0x6e, 0xd5, 0x8c, 0x7b, 0xc9, 0xb4, 0x02, 0xbf, 0x19, 0xfe, 0x6d, 0x13, 0x1a,
+	0x3e, 0x07, 0xf7, 0x10, 0xba, 0xf3, 0x47, 0xc7, 0xb5, 0xc3, 0x30, 0x03, 0x1f, 0x02, 0xd7, 0xd5,
+	0xce, 0xab, 0x5f, 0xef, 0xbc, 0x8f, 0xa0, 0x61, 0xa6, 0x6c, 0xff, 0x57, 0x07, 0x45, 0x8c, 0x62,
+	0xe7, 0xf4, 0x6e, 0xc4, 0x44, 0x32, 0x9b, 0x6b, 0x8e, 0x3a, 0x6c, 0x05, 0x4b, 0xc0, 0x8d, 0x82,
+	0x58, 0x5d, 0x4a, 0x77, 0x41, 0x61, 0xae, 0x13, 0x53, 0xce, 0x8b, 0x12, 0x7c, 0xab, 0x13, 0xe3,
+	0x5c, 0xc7, 0xdc, 0x32, 0x91, 0x94, 0x7a, 0xf4, 0x3b, 0xb2, 0x07, 0xb7, 0x4c, 0xa2, 0x2e, 0x43,
+	0x57, 0xe4, 0xd0, 0x4e, 0x35, 0x37, 0x53, 0x95, 0xc4, 0x28, 0xca, 0x7a, 0xb0, 0xed, 0x4c, 0xae,
+	0x9c, 0xa7, 0xa5, 0xc1, 0x25, 0xaf, 0xa4, 0x5b, 0x5b, 0x1c, 0x1b, 0x1b, 0x41, 0xb9, 0x25, 0xf7,
+	0xa1, 0xa3, 0x39, 0x8b, 0x43, 0xd7, 0x88, 0x2a, 0xf7, 0xb3, 0xa3, 0x1e, 0xb4, 0x1d, 0x76, 0xea,
+	0x21, 0xd7, 0x30, 0x99, 0x16, 0x4a, 0x0b, 0x3b, 0xa7, 0x6d, 0x7f, 0x27, 0xe5, 0xde, 0x9d, 0x51,
+	0xa4, 0x69, 0x6e, 0xd9, 0x59, 0xc2, 0x69, 0x07, 0x5d, 0x2f, 0x01, 0x32, 0x82, 0x1e, 0x66, 0x78,
+	0x96, 0x9f, 0x9f, 0x73, 0x1d, 0x1a, 0xf1, 0x23, 0xa7, 0x9b, 0xe8, 0xa1, 0xeb, 0xf0, 0xe7, 0x08,
+	0x9f, 0x88, 0x1f, 0x39, 0xb9, 0x0b, 0xe0, 0x99, 0xcc, 0x46, 0x53, 0xda, 0xf5, 0x8e, 0x90, 0xe3,
+	0x00, 0xf2, 0x19, 0x6c, 0xa1, 0x6e, 0x43, 0x96, 0x24, 0xea, 0x32, 0x11, 0xc6, 0xd2, 0x2d, 0x2c,
+	0x57, 0x17, 0xe1, 0x67, 0x25, 0xea, 0x1a, 0xd5, 0x13, 0x63, 0x2e, 0xe7, 0xc8, 0xeb, 0x21, 0x6f,
+	0x13, 0xd1, 0x17, 0x05, 0x48, 0x1e, 0x43, 0x2f, 0x4a, 0x54, 0x34, 0x0b, 0x23, 0xa5, 0x35, 0x8f,
+	0xac, 0xbb, 0xd5, 0x6d, 0x0c, 0xba, 0x85, 0xf8, 0x78, 0x01, 0xbb, 0x02, 0x59, 0x36, 0x09, 0x85,
+	0x34, 0x96, 0xc9, 0x88, 0x53, 0x82, 0xb4, 0xb6, 0x65, 0x93, 0xa3, 0x02, 0x72, 0xd9, 0xf1, 0xab,
+	0x8c, 0x47, 0x96, 0xc7, 0x61, 0x34, 0xd1, 0x2a, 0xcf, 0xe8, 0x2d, 0xbc, 0xae, 0x6e, 0x09, 0x8f,
+	0x11, 0x25, 0x5f, 0xc2, 0xad, 0x05, 0xd1, 0x09, 0xcd, 0x64, 0x2c, 0xe2, 0x86, 0xee, 0x60, 0x8a,
+	0xa4, 0x34, 0xbd, 0x5a, 0x58, 0xc8, 0x53, 0xd8, 0x99, 0x89, 0x24, 0x09, 0x95, 0x0c, 0x53, 0x61,
+	0xb2, 0x84, 0x45, 0x3c, 0xe5, 0xd2, 0xd2, 0x5f, 0x60, 0x12, 0xc4, 0xd9, 0x5e, 0xcb, 0xef, 0x2b,
+	0x16, 0xf2, 0x15, 0xec, 0xbc, 0xcb, 0x99, 0x66, 0xd2, 0x0a, 0xc9, 0x2b, 0xd2, 0xf8, 0x08, 0xcb,
+	0x7e, 0x6b, 0x69, 0x5b, 0x8a, 0xe3, 0x21, 0x74, 0x17, 0x4a, 0x4c, 0x44, 0x2a, 0x2c, 0xfd, 0x18,
+	0x45, 0xb0, 0xd0, 0xe7, 0xb1, 0x03, 0x5d, 0xfb, 0xcd, 0xa4, 0xba, 0x94, 0xd8, 0x9c, 0x86, 0xd2,
+	0x41, 0x7d, 0xb4, 0x1e, 0x00, 0x42, 0xae, 0x3d, 0x8d, 0x13, 0x65, 0x2e, 0x97, 0x94, 0x30, 0x53,
+	0x89, 0x88, 0xe6, 0xf4, 0x36, 0x96, 0x62, 0x3b, 0x97, 0x0b, 0xea, 0x1b, 0x34, 0xb8, 0xb2, 0x19,
+	0xcb, 0xb4, 0xcd, 0xb3, 0x85, 0xfa, 0x76, 0x31, 0x70, 0xb7, 0x80, 0x4b, 0x01, 0xde, 0x81, 0x56,
+	0x94, 0xe5, 0x45, 0x6e, 0x77, 0xbc, 0x02, 0xa3, 0x2c, 0xf7, 0x69, 0xdd, 0x87, 0x4e, 0xca, 0x53,
+	0xa5, 0xe7, 0x85, 0xfd, 0x13, 0x2f, 0x60, 0x8f, 0x79, 0x4a, 0x1f, 0xda, 0x65, 0x15, 0x95, 0x4a,
+	0xe9, 0x5d, 0xaf, 0x2e, 0x5f, 0xbc, 0xd7, 0x2a, 0x25, 0x9f, 0xc3, 0xf6, 0x94, 0x33, 0x6d, 0xcf,
+	0x38, 0xb3, 0x8b, 0x54, 0xfa, 0xe8, 0xa7, 0xb7, 0x30, 0x94, 0xc9, 0xdc, 0x05, 0x88, 0x79, 0xc6,
+	0x65, 0x6c, 0x42, 0x25, 0xe9, 0x3d, 0xbc, 0xba, 0x56, 0x81, 0xbc, 0x96, 0x4e, 0x59, 0x5c, 0x6a,
+	0x11, 0x4d, 0xc3, 0x48, 0x49, 0xcb, 0x84, 0xe4, 0x9a, 0x0e, 0xbc, 0xb2, 0x3c, 0x3e, 0x2e, 0x61,
+	0xf2, 0x04, 0xb6, 0xfd, 0xc7, 0x4c, 0xa8, 0x99, 0xe5, 0x45, 0xfa, 0xf7, 0xf1, 0x78, 0x5b, 0xde,
+	0x10, 0x30, 0xcb, 0x17, 0xa7, 0x2c, 0xb8, 0x67, 0xb9, 0x36, 0x96, 0x0e, 0x91, 0xd6, 0xf6, 0xd8,
+	0x73, 0x07, 0x91, 0x01, 0x74, 0x12, 0x35, 0x09, 0x53, 0x76, 0xe5, 0x1b, 0xed, 0x01, 0x52, 0x20,
+	0x51, 0x93, 0xef, 0xd9, 0x15, 0x36, 0x59, 0x1f, 0xda, 0x25, 0x83, 0x4d, 0x38, 0xfd, 0x14, 0x09,
+	0x2d, 0x4f, 0x78, 0x36, 0xe1, 0xe4, 0x11, 0x6c, 0x45, 0x9a, 0x99, 0x69, 0xe8, 0x58, 0x89, 0x90,
+	0xdc, 0xd0, 0x87, 0xfe, 0x35, 0x87, 0xf0, 0xb1, 0x9a, 0x1c, 0x3b, 0x90, 0x0c, 0xa1, 0x93, 0xcb,
+	0x4c, 0x8b, 0x0b, 0x91, 0xf0, 0x09, 0x8f, 0xe9, 0x23, 0x3c, 0xdf, 0x35, 0xcc, 0xd5, 0x74, 0xc6,
+	0x79, 0x16, 0x46, 0x2c, 0x63, 0x67, 0x22, 0x11, 0x56, 0x70, 0x43, 0x3f, 0xc3, 0x6a, 0xf5, 0x9c,
+	0x61, 0x5c, 0xc1, 0x5d, 0xd1, 0x0c, 0x8f, 0xdc, 0x3b, 0x7a, 0xd9, 0xb7, 0x23, 0xe4, 0x6e, 0x15,
+	0xf8, 0xa2, 0x73, 0x09, 0xac, 0xe5, 0x86, 0x6b, 0xfa, 0xd8, 0x8f, 0x66, 0xb7, 0x76, 0x33, 0xde,
+	0x77, 0xdd, 0x13, 0x3f, 0xe3, 0x71, 0xe3, 0x86, 0x8f, 0x16, 0x72, 0x72, 0x6d, 0xf8, 0x7c, 0xee,
+	0x87, 0x8f, 0xc3, 0x2b, 0xc3, 0xe7, 0x0b, 0x20, 0xfe, 0x02, 0xb9, 0x8c, 0xe6, 0x0b, 0x01, 0xfc,
+	0xd2, 0x0f, 0xd3, 0xa5, 0xa5, 0xaa, 0x00, 0x61, 0x66, 0xe1, 0xbb, 0x5c, 0x59, 0x46, 0xbf, 0x40,
+	0x5a, 0xcb, 0x21, 0x3f, 0x38, 0xc0, 0xc5, 0xcd, 0x44, 0xc6, 0xaf, 0xc5, 0xdd, 0xf3, 0x71, 0x1d,
+	0x5e, 0x89, 0xeb, 0x32, 0x74, 0xb3, 0xb7, 0xca, 0xfc, 0xb2, 0xc8, 0x90, 0xb3, 0x78, 0xc9, 0x1c,
+	0x7e, 0x0b, 0xdb, 0x2f, 0x45, 0xc2, 0xdf, 0x66, 0xf8, 0x35, 0xc4, 0xdf, 0xe5, 0xdc, 0xd8, 0xe5,
+	0xab, 0xad, 0x56, 0x79, 0xb5, 0x2d, 0x5e, 0x82, 0xab, 0x95, 0x2f, 0xb4, 0x2b, 0x20, 0xd5, 0xc7,
+	0x4d, 0xa6, 0xa4, 0xe1, 0xe4, 0x77, 0xd0, 0x30, 0x96, 0xd9, 0xdc, 0xa0, 0x83, 0xee, 0xfe, 0x03,
+	0xff, 0x6e, 0xbe, 0xc9, 0xdc, 0x3b, 0x41, 0xda, 0x58, 0xc5, 0x3c, 0x28, 0x1e, 0x19, 0x3e, 0x04,
+	0x58, 0xa2, 0xa4, 0x0d, 0xcd, 0x93, 0xb7, 0xe3, 0xf1, 0xe1, 0xc9, 0x49, 0x6f, 0x85, 0x00, 0x34,
+	0x5e, 0x3e, 0x3b, 0x3a, 0x3e, 0x7c, 0xd1, 0xab, 0x3d, 0xb9, 0x07, 0x0d, 0xff, 0x79, 0xe6, 0xd0,
+	0x37, 0xc7, 0x6f, 0xbf, 0x3b, 0x7a, 0xd5, 0x5b, 0x21, 0x2d, 0x58, 0x7f, 0xf6, 0xdd, 0xe1, 0xab,
+	0xd3, 0x5e, 0x6d, 0xff, 0xf7, 0xb0, 0x71, 0xaa, 0x99, 0x34, 0xe7, 0x5c, 0x93, 0xaf, 0x2b, 0x6b,
+	0x52, 0x7e, 0xc2, 0x2c, 0xff, 0x1a, 0xec, 0x6e, 0x96, 0x1f, 0x0f, 0xf8, 0xf1, 0x31, 0x5c, 0x19,
+	0xd5, 0x9e, 0xd6, 0xf6, 0xff, 0x00, 0x4d, 0x97, 0xf1, 0xe1, 0x95, 0x25, 0xdf, 0x42, 0xc3, 0x27,
+	0x4e, 0x3e, 0xbe, 0x79, 0x14, 0xac, 0xd9, 0x2e, 0xfd, 0x4f, 0x67, 0x1c, 0xd5, 0x9e, 0xdf, 0xfb,
+	0xfb, 0xfb, 0x7e, 0xed, 0xa7, 0xf7, 0xfd, 0xda, 0xcf, 0xef, 0xfb, 0xb5, 0xbf, 0x7e, 0xe8, 0xaf,
+	0xfc, 0xf4, 0xa1, 0xbf, 0xf2, 0x8f, 0x0f, 0xfd, 0x95, 0x3f, 0xad, 0xe3, 0x3f, 0x96, 0xb3, 0x06,
+	0xfe, 0x7c, 0xfd, 0xaf, 0x01, 0x00, 0x9d, 0xea, 0x89, 0xa9, 0xc6, 0x0c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1098,17 +1603,67 @@ func (m *Record) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.Data != nil {
-		{
-			size, err := m.Data.MarshalToSizedBuffer(dAtA[:i])
-			if err != nil {
-				return 0, err
-			}
-			i -= size
-			i = encodeVarintGrpc(dAtA, i, uint64(size))
+	if len(m.Labels) > 0 {
+		for k := range m.Labels {
+			v := m.Labels[k]
+			baseI := i
+			i -= len(v)
+			copy(dAtA[i:], v)
+			i = encodeVarintGrpc(dAtA, i, uint64(len(v)))
+			i--
+			dAtA[i] = 0x12
+			i -= len(k)
+			copy(dAtA[i:], k)
+			i = encodeVarintGrpc(dAtA, i, uint64(len(k)))
+			i--
+			dAtA[i] = 0xa
+			i = encodeVarintGrpc(dAtA, i, uint64(baseI-i))
+			i--
+			dAtA[i] = 0x4a
 		}
+	}
+	if m.SchemaVersion != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.SchemaVersion))
 		i--
-		dAtA[i] = 0x1a
+		dAtA[i] = 0x40
+	}
+	if len(m.Plugin) > 0 {
+		i -= len(m.Plugin)
+		copy(dAtA[i:], m.Plugin)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.Plugin)))
+		i--
+		dAtA[i] = 0x3a
+	}
+	if len(m.Encoding) > 0 {
+		i -= len(m.Encoding)
+		copy(dAtA[i:], m.Encoding)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.Encoding)))
+		i--
+		dAtA[i] = 0x32
+	}
+	if len(m.Compressed) > 0 {
+		i -= len(m.Compressed)
+		copy(dAtA[i:], m.Compressed)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.Compressed)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if m.Origin != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.Origin))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Data != nil {
+		{
+			size, err := m.Data.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintGrpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
 	}
 	if m.Timestamp != 0 {
 		i = encodeVarintGrpc(dAtA, i, uint64(m.Timestamp))
@@ -1283,6 +1838,361 @@ func (m *Config) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.ReadBufferSize != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.ReadBufferSize))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xf8
+	}
+	if m.PipeBufferSize != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.PipeBufferSize))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xf0
+	}
+	if m.DiskQuota != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.DiskQuota))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xe8
+	}
+	if m.DependencyTimeout != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.DependencyTimeout))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xe0
+	}
+	if m.RingBufferSize != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.RingBufferSize))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xd8
+	}
+	if len(m.Group) > 0 {
+		i -= len(m.Group)
+		copy(dAtA[i:], m.Group)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.Group)))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xd2
+	}
+	if len(m.User) > 0 {
+		i -= len(m.User)
+		copy(dAtA[i:], m.User)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.User)))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xca
+	}
+	if len(m.SeccompDenylist) > 0 {
+		for iNdEx := len(m.SeccompDenylist) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.SeccompDenylist[iNdEx])
+			copy(dAtA[i:], m.SeccompDenylist[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.SeccompDenylist[iNdEx])))
+			i--
+			dAtA[i] = 0x2
+			i--
+			dAtA[i] = 0xc2
+		}
+	}
+	if len(m.KeepCapabilities) > 0 {
+		for iNdEx := len(m.KeepCapabilities) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.KeepCapabilities[iNdEx])
+			copy(dAtA[i:], m.KeepCapabilities[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.KeepCapabilities[iNdEx])))
+			i--
+			dAtA[i] = 0x2
+			i--
+			dAtA[i] = 0xba
+		}
+	}
+	if m.Unprivileged {
+		i--
+		if m.Unprivileged {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xb0
+	}
+	if m.CrashLogLines != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.CrashLogLines))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xa8
+	}
+	if m.LogMaxAge != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.LogMaxAge))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0xa0
+	}
+	if m.LogMaxSize != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.LogMaxSize))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0x98
+	}
+	if m.RecordBurst != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.RecordBurst))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0x90
+	}
+	if m.RecordRateLimit != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.RecordRateLimit))
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0x88
+	}
+	if m.EnrichContainer {
+		i--
+		if m.EnrichContainer {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x2
+		i--
+		dAtA[i] = 0x80
+	}
+	if len(m.DependsOn) > 0 {
+		for iNdEx := len(m.DependsOn) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.DependsOn[iNdEx])
+			copy(dAtA[i:], m.DependsOn[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.DependsOn[iNdEx])))
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0xfa
+		}
+	}
+	if m.HeartbeatTimeout != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.HeartbeatTimeout))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xf0
+	}
+	if m.KillOnOom {
+		i--
+		if m.KillOnOom {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xe8
+	}
+	if m.MemoryLimit != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.MemoryLimit))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xe0
+	}
+	if m.CpuLimit != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.CpuLimit))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xd8
+	}
+	if m.StartupTimeout != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.StartupTimeout))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xd0
+	}
+	if len(m.UnknownTypePolicy) > 0 {
+		i -= len(m.UnknownTypePolicy)
+		copy(dAtA[i:], m.UnknownTypePolicy)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.UnknownTypePolicy)))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xca
+	}
+	if len(m.KnownTypes) > 0 {
+		dAtA4 := make([]byte, len(m.KnownTypes)*10)
+		var j3 int
+		for _, num1 := range m.KnownTypes {
+			num := uint64(num1)
+			for num >= 1<<7 {
+				dAtA4[j3] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j3++
+			}
+			dAtA4[j3] = uint8(num)
+			j3++
+		}
+		i -= j3
+		copy(dAtA[i:], dAtA4[:j3])
+		i = encodeVarintGrpc(dAtA, i, uint64(j3))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xc2
+	}
+	if m.DownloadLimit != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.DownloadLimit))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xb8
+	}
+	if m.QuarantineThreshold != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.QuarantineThreshold))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xb0
+	}
+	if m.KillOnMisplacement {
+		i--
+		if m.KillOnMisplacement {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xa8
+	}
+	if len(m.ExpectedNamespaces) > 0 {
+		for iNdEx := len(m.ExpectedNamespaces) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.ExpectedNamespaces[iNdEx])
+			copy(dAtA[i:], m.ExpectedNamespaces[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.ExpectedNamespaces[iNdEx])))
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0xa2
+		}
+	}
+	if len(m.ExpectedCgroup) > 0 {
+		i -= len(m.ExpectedCgroup)
+		copy(dAtA[i:], m.ExpectedCgroup)
+		i = encodeVarintGrpc(dAtA, i, uint64(len(m.ExpectedCgroup)))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x9a
+	}
+	if m.TagInstance {
+		i--
+		if m.TagInstance {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x90
+	}
+	if m.ClockCorrection {
+		i--
+		if m.ClockCorrection {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x88
+	}
+	if len(m.FieldDenylist) > 0 {
+		for iNdEx := len(m.FieldDenylist) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.FieldDenylist[iNdEx])
+			copy(dAtA[i:], m.FieldDenylist[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.FieldDenylist[iNdEx])))
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0x82
+		}
+	}
+	if len(m.FieldAllowlist) > 0 {
+		for iNdEx := len(m.FieldAllowlist) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.FieldAllowlist[iNdEx])
+			copy(dAtA[i:], m.FieldAllowlist[iNdEx])
+			i = encodeVarintGrpc(dAtA, i, uint64(len(m.FieldAllowlist[iNdEx])))
+			i--
+			dAtA[i] = 0x7a
+		}
+	}
+	if m.TaskBatch {
+		i--
+		if m.TaskBatch {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x70
+	}
+	if m.TaskBufferSize != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.TaskBufferSize))
+		i--
+		dAtA[i] = 0x68
+	}
+	if m.Immutable {
+		i--
+		if m.Immutable {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x60
+	}
+	if m.Priority != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.Priority))
+		i--
+		dAtA[i] = 0x58
+	}
+	if m.ReadTimeout != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.ReadTimeout))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.Oneshot {
+		i--
+		if m.Oneshot {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x48
+	}
+	if m.SlowTaskThreshold != 0 {
+		i = encodeVarintGrpc(dAtA, i, uint64(m.SlowTaskThreshold))
+		i--
+		dAtA[i] = 0x40
+	}
 	if len(m.Detail) > 0 {
 		i -= len(m.Detail)
 		copy(dAtA[i:], m.Detail)
@@ -1509,6 +2419,32 @@ func (m *Record) Size() (n int) {
 		l = m.Data.Size()
 		n += 1 + l + sovGrpc(uint64(l))
 	}
+	if m.Origin != 0 {
+		n += 1 + sovGrpc(uint64(m.Origin))
+	}
+	l = len(m.Compressed)
+	if l > 0 {
+		n += 1 + l + sovGrpc(uint64(l))
+	}
+	l = len(m.Encoding)
+	if l > 0 {
+		n += 1 + l + sovGrpc(uint64(l))
+	}
+	l = len(m.Plugin)
+	if l > 0 {
+		n += 1 + l + sovGrpc(uint64(l))
+	}
+	if m.SchemaVersion != 0 {
+		n += 1 + sovGrpc(uint64(m.SchemaVersion))
+	}
+	if len(m.Labels) > 0 {
+		for k, v := range m.Labels {
+			_ = k
+			_ = v
+			mapEntrySize := 1 + len(k) + sovGrpc(uint64(len(k))) + 1 + len(v) + sovGrpc(uint64(len(v)))
+			n += mapEntrySize + 1 + sovGrpc(uint64(mapEntrySize))
+		}
+	}
 	return n
 }
 
@@ -1608,6 +2544,152 @@ func (m *Config) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovGrpc(uint64(l))
 	}
+	if m.SlowTaskThreshold != 0 {
+		n += 1 + sovGrpc(uint64(m.SlowTaskThreshold))
+	}
+	if m.Oneshot {
+		n += 2
+	}
+	if m.ReadTimeout != 0 {
+		n += 1 + sovGrpc(uint64(m.ReadTimeout))
+	}
+	if m.Priority != 0 {
+		n += 1 + sovGrpc(uint64(m.Priority))
+	}
+	if m.Immutable {
+		n += 2
+	}
+	if m.TaskBufferSize != 0 {
+		n += 1 + sovGrpc(uint64(m.TaskBufferSize))
+	}
+	if m.TaskBatch {
+		n += 2
+	}
+	if len(m.FieldAllowlist) > 0 {
+		for _, s := range m.FieldAllowlist {
+			l = len(s)
+			n += 1 + l + sovGrpc(uint64(l))
+		}
+	}
+	if len(m.FieldDenylist) > 0 {
+		for _, s := range m.FieldDenylist {
+			l = len(s)
+			n += 2 + l + sovGrpc(uint64(l))
+		}
+	}
+	if m.ClockCorrection {
+		n += 3
+	}
+	if m.TagInstance {
+		n += 3
+	}
+	l = len(m.ExpectedCgroup)
+	if l > 0 {
+		n += 2 + l + sovGrpc(uint64(l))
+	}
+	if len(m.ExpectedNamespaces) > 0 {
+		for _, s := range m.ExpectedNamespaces {
+			l = len(s)
+			n += 2 + l + sovGrpc(uint64(l))
+		}
+	}
+	if m.KillOnMisplacement {
+		n += 3
+	}
+	if m.QuarantineThreshold != 0 {
+		n += 2 + sovGrpc(uint64(m.QuarantineThreshold))
+	}
+	if m.DownloadLimit != 0 {
+		n += 2 + sovGrpc(uint64(m.DownloadLimit))
+	}
+	if len(m.KnownTypes) > 0 {
+		l = 0
+		for _, e := range m.KnownTypes {
+			l += sovGrpc(uint64(e))
+		}
+		n += 2 + sovGrpc(uint64(l)) + l
+	}
+	l = len(m.UnknownTypePolicy)
+	if l > 0 {
+		n += 2 + l + sovGrpc(uint64(l))
+	}
+	if m.StartupTimeout != 0 {
+		n += 2 + sovGrpc(uint64(m.StartupTimeout))
+	}
+	if m.CpuLimit != 0 {
+		n += 2 + sovGrpc(uint64(m.CpuLimit))
+	}
+	if m.MemoryLimit != 0 {
+		n += 2 + sovGrpc(uint64(m.MemoryLimit))
+	}
+	if m.KillOnOom {
+		n += 3
+	}
+	if m.HeartbeatTimeout != 0 {
+		n += 2 + sovGrpc(uint64(m.HeartbeatTimeout))
+	}
+	if len(m.DependsOn) > 0 {
+		for _, s := range m.DependsOn {
+			l = len(s)
+			n += 2 + l + sovGrpc(uint64(l))
+		}
+	}
+	if m.EnrichContainer {
+		n += 3
+	}
+	if m.RecordRateLimit != 0 {
+		n += 2 + sovGrpc(uint64(m.RecordRateLimit))
+	}
+	if m.RecordBurst != 0 {
+		n += 2 + sovGrpc(uint64(m.RecordBurst))
+	}
+	if m.LogMaxSize != 0 {
+		n += 2 + sovGrpc(uint64(m.LogMaxSize))
+	}
+	if m.LogMaxAge != 0 {
+		n += 2 + sovGrpc(uint64(m.LogMaxAge))
+	}
+	if m.CrashLogLines != 0 {
+		n += 2 + sovGrpc(uint64(m.CrashLogLines))
+	}
+	if m.Unprivileged {
+		n += 3
+	}
+	if len(m.KeepCapabilities) > 0 {
+		for _, s := range m.KeepCapabilities {
+			l = len(s)
+			n += 2 + l + sovGrpc(uint64(l))
+		}
+	}
+	if len(m.SeccompDenylist) > 0 {
+		for _, s := range m.SeccompDenylist {
+			l = len(s)
+			n += 2 + l + sovGrpc(uint64(l))
+		}
+	}
+	l = len(m.User)
+	if l > 0 {
+		n += 2 + l + sovGrpc(uint64(l))
+	}
+	l = len(m.Group)
+	if l > 0 {
+		n += 2 + l + sovGrpc(uint64(l))
+	}
+	if m.RingBufferSize != 0 {
+		n += 2 + sovGrpc(uint64(m.RingBufferSize))
+	}
+	if m.DependencyTimeout != 0 {
+		n += 2 + sovGrpc(uint64(m.DependencyTimeout))
+	}
+	if m.DiskQuota != 0 {
+		n += 2 + sovGrpc(uint64(m.DiskQuota))
+	}
+	if m.PipeBufferSize != 0 {
+		n += 2 + sovGrpc(uint64(m.PipeBufferSize))
+	}
+	if m.ReadBufferSize != 0 {
+		n += 2 + sovGrpc(uint64(m.ReadBufferSize))
+	}
 	return n
 }
 
@@ -2245,17 +3327,280 @@ func (m *Record) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipGrpc(dAtA[iNdEx:])
-			if err != nil {
-				return err
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Origin", wireType)
 			}
-			if (skippy < 0) || (iNdEx+skippy) < 0 {
-				return ErrInvalidLengthGrpc
+			m.Origin = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Origin |= Origin(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
 			}
-			if (iNdEx + skippy) > l {
-				return io.ErrUnexpectedEOF
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compressed", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Compressed = append(m.Compressed[:0], dAtA[iNdEx:postIndex]...)
+			if m.Compressed == nil {
+				m.Compressed = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Encoding", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Encoding = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Plugin", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Plugin = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SchemaVersion", wireType)
+			}
+			m.SchemaVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SchemaVersion |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Labels == nil {
+				m.Labels = make(map[string]string)
+			}
+			var mapkey string
+			var mapvalue string
+			for iNdEx < postIndex {
+				entryPreIndex := iNdEx
+				var wire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowGrpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					wire |= uint64(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				fieldNum := int32(wire >> 3)
+				if fieldNum == 1 {
+					var stringLenmapkey uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowGrpc
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapkey |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapkey := int(stringLenmapkey)
+					if intStringLenmapkey < 0 {
+						return ErrInvalidLengthGrpc
+					}
+					postStringIndexmapkey := iNdEx + intStringLenmapkey
+					if postStringIndexmapkey < 0 {
+						return ErrInvalidLengthGrpc
+					}
+					if postStringIndexmapkey > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapkey = string(dAtA[iNdEx:postStringIndexmapkey])
+					iNdEx = postStringIndexmapkey
+				} else if fieldNum == 2 {
+					var stringLenmapvalue uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowGrpc
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapvalue |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapvalue := int(stringLenmapvalue)
+					if intStringLenmapvalue < 0 {
+						return ErrInvalidLengthGrpc
+					}
+					postStringIndexmapvalue := iNdEx + intStringLenmapvalue
+					if postStringIndexmapvalue < 0 {
+						return ErrInvalidLengthGrpc
+					}
+					if postStringIndexmapvalue > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapvalue = string(dAtA[iNdEx:postStringIndexmapvalue])
+					iNdEx = postStringIndexmapvalue
+				} else {
+					iNdEx = entryPreIndex
+					skippy, err := skipGrpc(dAtA[iNdEx:])
+					if err != nil {
+						return err
+					}
+					if (skippy < 0) || (iNdEx+skippy) < 0 {
+						return ErrInvalidLengthGrpc
+					}
+					if (iNdEx + skippy) > postIndex {
+						return io.ErrUnexpectedEOF
+					}
+					iNdEx += skippy
+				}
+			}
+			m.Labels[mapkey] = mapvalue
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGrpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
 			}
 			iNdEx += skippy
 		}
@@ -2981,6 +4326,962 @@ func (m *Config) Unmarshal(dAtA []byte) error {
 			}
 			m.Detail = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SlowTaskThreshold", wireType)
+			}
+			m.SlowTaskThreshold = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SlowTaskThreshold |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Oneshot", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Oneshot = bool(v != 0)
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ReadTimeout", wireType)
+			}
+			m.ReadTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ReadTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Priority", wireType)
+			}
+			m.Priority = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Priority |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Immutable", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Immutable = bool(v != 0)
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TaskBufferSize", wireType)
+			}
+			m.TaskBufferSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TaskBufferSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 14:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TaskBatch", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.TaskBatch = bool(v != 0)
+		case 15:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FieldAllowlist", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.FieldAllowlist = append(m.FieldAllowlist, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 16:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FieldDenylist", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.FieldDenylist = append(m.FieldDenylist, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 17:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ClockCorrection", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.ClockCorrection = bool(v != 0)
+		case 18:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TagInstance", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.TagInstance = bool(v != 0)
+		case 19:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ExpectedCgroup", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ExpectedCgroup = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 20:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ExpectedNamespaces", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ExpectedNamespaces = append(m.ExpectedNamespaces, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 21:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KillOnMisplacement", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.KillOnMisplacement = bool(v != 0)
+		case 22:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QuarantineThreshold", wireType)
+			}
+			m.QuarantineThreshold = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.QuarantineThreshold |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 23:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DownloadLimit", wireType)
+			}
+			m.DownloadLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DownloadLimit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 24:
+			if wireType == 0 {
+				var v int32
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowGrpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= int32(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.KnownTypes = append(m.KnownTypes, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowGrpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthGrpc
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthGrpc
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.KnownTypes) == 0 {
+					m.KnownTypes = make([]int32, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v int32
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowGrpc
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= int32(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.KnownTypes = append(m.KnownTypes, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field KnownTypes", wireType)
+			}
+		case 25:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UnknownTypePolicy", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.UnknownTypePolicy = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 26:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartupTimeout", wireType)
+			}
+			m.StartupTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StartupTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 27:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CpuLimit", wireType)
+			}
+			m.CpuLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CpuLimit |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 28:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MemoryLimit", wireType)
+			}
+			m.MemoryLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MemoryLimit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 29:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KillOnOom", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.KillOnOom = bool(v != 0)
+		case 30:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HeartbeatTimeout", wireType)
+			}
+			m.HeartbeatTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.HeartbeatTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 31:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DependsOn", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DependsOn = append(m.DependsOn, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 32:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EnrichContainer", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.EnrichContainer = bool(v != 0)
+		case 33:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RecordRateLimit", wireType)
+			}
+			m.RecordRateLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RecordRateLimit |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 34:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RecordBurst", wireType)
+			}
+			m.RecordBurst = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RecordBurst |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 35:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LogMaxSize", wireType)
+			}
+			m.LogMaxSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LogMaxSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 36:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LogMaxAge", wireType)
+			}
+			m.LogMaxAge = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LogMaxAge |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 37:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CrashLogLines", wireType)
+			}
+			m.CrashLogLines = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CrashLogLines |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 38:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Unprivileged", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Unprivileged = bool(v != 0)
+		case 39:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KeepCapabilities", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KeepCapabilities = append(m.KeepCapabilities, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 40:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeccompDenylist", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SeccompDenylist = append(m.SeccompDenylist, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 41:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field User", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.User = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 42:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Group", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Group = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 43:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RingBufferSize", wireType)
+			}
+			m.RingBufferSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RingBufferSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 44:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DependencyTimeout", wireType)
+			}
+			m.DependencyTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DependencyTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 45:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DiskQuota", wireType)
+			}
+			m.DiskQuota = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DiskQuota |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 46:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PipeBufferSize", wireType)
+			}
+			m.PipeBufferSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PipeBufferSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 47:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ReadBufferSize", wireType)
+			}
+			m.ReadBufferSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ReadBufferSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGrpc(dAtA[iNdEx:])
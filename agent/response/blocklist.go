@@ -0,0 +1,274 @@
+package response
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BlocklistFile keeps the blocked hashes in the workdir
+const BlocklistFile = "blocklist.json"
+
+const (
+	// the processes are checked this often while any hash is blocked, the
+	// ones of a blocked hash are killed once they are seen. The exec is not
+	// blocked, a process may run up to this long before it's killed.
+	blockInterval = time.Second
+	// the binaries larger are never hashed
+	maxBinarySize = 128 << 20
+	// bounds the hashes of the binaries cached
+	maxBinaries = 4096
+	maxBlocked  = 10240
+)
+
+var procRoot = "/proc"
+
+var errInvalidHash = errors.New("invalid hash")
+
+// binaryHashes are both of the binary, the server blocks by the sha256, or
+// by the md5 which is exe_hash of the ebpfdriver
+type binaryHashes struct {
+	md5    string
+	sha256 string
+}
+
+type blocklist struct {
+	mu     sync.Mutex
+	path   string
+	hashes map[string]struct{}
+	// binaryHashes by the key of the binary, see binaryKey
+	binaries map[string]binaryHashes
+	// the key of the binary checked by the pid, the process is checked again
+	// once it execs another one
+	checked map[int]string
+}
+
+type blocklistState struct {
+	Hashes []string `json:"hashes"`
+}
+
+func newBlocklist(path string) *blocklist {
+	return &blocklist{path: path, hashes: map[string]struct{}{}}
+}
+
+// load restores the hashes kept in the file, a missing file is fine
+func (b *blocklist) load() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	content, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := &blocklistState{}
+	if err = json.Unmarshal(content, state); err != nil {
+		return err
+	}
+	for _, h := range state.Hashes {
+		if h, err = normalizeHash(h); err != nil {
+			return err
+		}
+		b.hashes[h] = struct{}{}
+	}
+	return nil
+}
+
+// save must be called with mu held
+func (b *blocklist) save() error {
+	state := &blocklistState{Hashes: make([]string, 0, len(b.hashes))}
+	for h := range b.hashes {
+		state.Hashes = append(state.Hashes, h)
+	}
+	sort.Strings(state.Hashes)
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, b.path); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func normalizeHash(h string) (string, error) {
+	h = strings.ToLower(strings.TrimSpace(h))
+	if _, err := hex.DecodeString(h); err != nil || (len(h) != md5.Size*2 && len(h) != sha256.Size*2) {
+		return "", fmt.Errorf("%w: %q", errInvalidHash, h)
+	}
+	return h, nil
+}
+
+func (b *blocklist) add(hashes []string, audit map[string]string) error {
+	return b.update(hashes, audit, func(h string) { b.hashes[h] = struct{}{} })
+}
+
+func (b *blocklist) remove(hashes []string, audit map[string]string) error {
+	return b.update(hashes, audit, func(h string) { delete(b.hashes, h) })
+}
+
+// update checks all the hashes before any of them is taken, and checks the
+// running processes again with the hashes updated
+func (b *blocklist) update(hashes []string, audit map[string]string, fn func(h string)) error {
+	audit["hashes"] = strings.Join(hashes, ",")
+	if len(hashes) == 0 {
+		return fmt.Errorf("%w: no hash", errInvalidHash)
+	}
+	normalized := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		h, err := normalizeHash(h)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, h)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	previous := make(map[string]struct{}, len(b.hashes))
+	for h := range b.hashes {
+		previous[h] = struct{}{}
+	}
+	for _, h := range normalized {
+		fn(h)
+	}
+	if len(b.hashes) > maxBlocked {
+		n := len(b.hashes)
+		b.hashes = previous
+		return fmt.Errorf("%d hashes, more than %d", n, maxBlocked)
+	}
+	b.checked = nil
+	audit["blocked"] = strconv.Itoa(len(b.hashes))
+	return b.save()
+}
+
+// blockedProcess is a process of a blocked hash
+type blockedProcess struct {
+	pid  int
+	exe  string
+	hash string
+}
+
+// scan returns the processes of the blocked hashes, the ones checked before
+// are skipped unless they exec another binary
+func (b *blocklist) scan() (blocked []blockedProcess) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.hashes) == 0 {
+		b.binaries, b.checked = nil, nil
+		return
+	}
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		zap.S().Debug("processes are not checked: ", err)
+		return
+	}
+	if b.binaries == nil || len(b.binaries) > maxBinaries {
+		b.binaries = make(map[string]binaryHashes)
+	}
+	checked := make(map[int]string, len(entries))
+	self := os.Getpid()
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid <= 1 || pid == self {
+			continue
+		}
+		exe := filepath.Join(procRoot, entry.Name(), "exe")
+		key, path, ok := binaryKey(exe)
+		if !ok {
+			continue
+		}
+		checked[pid] = key
+		if b.checked[pid] == key {
+			continue
+		}
+		hashes, ok := b.binaries[key]
+		if !ok {
+			if hashes, ok = hashBinary(exe); !ok {
+				continue
+			}
+			b.binaries[key] = hashes
+		}
+		for _, h := range []string{hashes.sha256, hashes.md5} {
+			if _, ok := b.hashes[h]; ok {
+				blocked = append(blocked, blockedProcess{pid: pid, exe: path, hash: h})
+				break
+			}
+		}
+	}
+	b.checked = checked
+	return
+}
+
+// binaryKey identifies the binary of the process by the device, the inode,
+// the size and the mtime of it, so a binary replaced or rewritten at the
+// same path is hashed again
+func binaryKey(exe string) (key, path string, ok bool) {
+	path, err := os.Readlink(exe)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(exe)
+	if err != nil || info.Size() > maxBinarySize {
+		return
+	}
+	if key, ok = fileKey(info); !ok {
+		return
+	}
+	return key, path, true
+}
+
+// hashBinary reads the binary by the exe of the process, so the deleted ones
+// are hashed as well
+func hashBinary(exe string) (hashes binaryHashes, ok bool) {
+	f, err := os.Open(exe)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err = io.CopyN(io.MultiWriter(md5Hash, sha256Hash), f, maxBinarySize); err != nil && err != io.EOF {
+		return
+	}
+	return binaryHashes{md5: sum(md5Hash), sha256: sum(sha256Hash)}, true
+}
+
+func sum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// enforce kills the processes of the blocked hashes, every kill is audited
+// without a token
+func (r *Responder) enforce() {
+	for _, p := range r.blocklist.scan() {
+		audit := map[string]string{
+			"action": ActionKill,
+			"reason": "blocked",
+			"exe":    p.exe,
+			"hash":   p.hash,
+		}
+		err := kill(&Action{Pid: p.pid}, audit)
+		r.audit(nil, audit, err)
+		if err != nil {
+			zap.S().Errorf("blocked process %d is not killed: %v", p.pid, err)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package response
+
+import (
+	"agent/transport/connection"
+	"agent/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ContainmentFile keeps the containment in the workdir, so the rules are
+// installed again once the agent restarts, until it's released
+const ContainmentFile = "containment.json"
+
+// the table of nftables and the chains of iptables
+const (
+	nftTable        = "hades_containment"
+	iptablesInput   = "HADES_CONTAIN_IN"
+	iptablesOutput  = "HADES_CONTAIN_OUT"
+	iptablesForward = "HADES_CONTAIN_FWD"
+)
+
+// the rules are installed again this often while contained, for the
+// addresses of the server resolved again
+const containInterval = time.Minute
+
+var (
+	resolvConf = "/etc/resolv.conf"
+	// the upstreams of systemd-resolved, resolv.conf has the stub of it only
+	resolvedConf = "/run/systemd/resolve/resolv.conf"
+	lookupIP     = net.LookupIP
+	lookPath     = exec.LookPath
+)
+
+var (
+	errNoUplink    = errors.New("no uplink to keep")
+	errNoIp6tables = errors.New("ip6tables is not found, ipv6 would be left open")
+)
+
+// runCommand runs the firewall command with stdin, the output is in the
+// error if it fails
+var runCommand = func(stdin string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// endpoint is a tcp one the host connects to
+type endpoint struct {
+	IP   string `json:"ip"`
+	Port uint16 `json:"port"`
+}
+
+// containRules are the traffic allowed while contained, everything else is
+// dropped, in and out, and forwarded
+type containRules struct {
+	// Uplinks are the server, or the proxy of it
+	Uplinks []endpoint `json:"uplinks"`
+	// Resolvers are allowed on port 53 if the server is a hostname
+	Resolvers []string `json:"resolvers,omitempty"`
+	// Networks are allowed on any port, in cidr
+	Networks []string `json:"networks,omitempty"`
+}
+
+type containState struct {
+	Backend     string   `json:"backend"`
+	Allow       []string `json:"allow,omitempty"`
+	Token       string   `json:"token,omitempty"`
+	ContainedAt int64    `json:"contained_at"`
+	// the rules installed
+	Rules containRules `json:"rules"`
+}
+
+// firewall installs the rules, replacing the ones installed before, and
+// removes them
+type firewall interface {
+	install(rules *containRules) error
+	remove() error
+}
+
+func newFirewall(backend string) (firewall, error) {
+	switch backend {
+	case "nftables":
+		return nftables{}, nil
+	case "iptables":
+		return iptables{}, nil
+	}
+	return nil, fmt.Errorf("unknown firewall %q", backend)
+}
+
+// detectFirewall prefers nftables, since iptables may be the wrapper of it
+func detectFirewall() (string, error) {
+	if _, err := lookPath("nft"); err == nil {
+		return "nftables", nil
+	}
+	if _, err := lookPath("iptables"); err == nil {
+		return "iptables", nil
+	}
+	return "", errors.New("neither nft nor iptables is found")
+}
+
+// contain isolates the host except the uplink of the agent and the networks
+// allowed by the action. The containment is replaced if it's contained
+// already.
+func (r *Responder) contain(action *Action, token string, audit map[string]string) error {
+	audit["allow"] = strings.Join(action.Allow, ",")
+	state := &containState{Allow: action.Allow, Token: token, ContainedAt: time.Now().Unix()}
+	if current, err := r.loadContainment(); err != nil {
+		return err
+	} else if current != nil {
+		state.Backend = current.Backend
+	} else if state.Backend, err = detectFirewall(); err != nil {
+		return err
+	}
+	audit["backend"] = state.Backend
+	return r.applyContainment(state, audit)
+}
+
+func (r *Responder) applyContainment(state *containState, audit map[string]string) error {
+	rules, err := newContainRules(state.Allow)
+	if err != nil {
+		return err
+	}
+	fw, err := newFirewall(state.Backend)
+	if err != nil {
+		return err
+	}
+	if err = fw.install(rules); err != nil {
+		return err
+	}
+	state.Rules = *rules
+	uplinks := make([]string, 0, len(rules.Uplinks))
+	for _, u := range rules.Uplinks {
+		uplinks = append(uplinks, net.JoinHostPort(u.IP, strconv.Itoa(int(u.Port))))
+	}
+	audit["uplinks"] = strings.Join(uplinks, ",")
+	return r.saveContainment(state)
+}
+
+// release removes the rules of the containment
+func (r *Responder) release(audit map[string]string) error {
+	state, err := r.loadContainment()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return errors.New("not contained")
+	}
+	audit["backend"] = state.Backend
+	audit["contained_at"] = strconv.FormatInt(state.ContainedAt, 10)
+	fw, err := newFirewall(state.Backend)
+	if err != nil {
+		return err
+	}
+	if err = fw.remove(); err != nil {
+		return err
+	}
+	return os.Remove(r.containPath())
+}
+
+// refreshContainment installs the rules again if the uplink is resolved to
+// other addresses, or the agent restarts. It's audited if it's changed.
+func (r *Responder) refreshContainment(force bool) {
+	state, err := r.loadContainment()
+	if err != nil {
+		zap.S().Error("containment is not loaded: ", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if !force {
+		rules, err := newContainRules(state.Allow)
+		if err != nil || reflect.DeepEqual(*rules, state.Rules) {
+			return
+		}
+	}
+	audit := map[string]string{"action": ActionContain, "reason": "refreshed", "backend": state.Backend}
+	err = r.applyContainment(state, audit)
+	r.audit(nil, audit, err)
+}
+
+func (r *Responder) containPath() string {
+	return filepath.Join(r.Workdir, ContainmentFile)
+}
+
+// loadContainment returns nil if it's not contained
+func (r *Responder) loadContainment() (*containState, error) {
+	content, err := os.ReadFile(r.containPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &containState{}
+	return state, json.Unmarshal(content, state)
+}
+
+func (r *Responder) saveContainment(state *containState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := r.containPath()
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// newContainRules resolves the uplink of the agent in use, through the proxy
+// if it's set, so the agent is still connected to the server
+func newContainRules(allow []string) (*containRules, error) {
+	rules := &containRules{}
+	for _, n := range allow {
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", n)
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+			if ip4 := ip.To4(); ip4 != nil {
+				network = &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+			}
+		}
+		rules.Networks = append(rules.Networks, network.String())
+	}
+	addr, port := connection.Endpoint()
+	if addr == "" || port == "" {
+		return nil, errNoUplink
+	}
+	uplinks, byName, err := resolveUplink(&url.URL{Scheme: "https", Host: net.JoinHostPort(addr, port)})
+	if err != nil {
+		return nil, err
+	}
+	// the enrollment is kept too, so the certificate is renewed while
+	// contained, but the containment doesn't fail without it
+	if connection.EnrollURL != "" {
+		u, err := url.Parse(connection.EnrollURL)
+		if err == nil {
+			var enroll []endpoint
+			var enrollByName bool
+			if enroll, enrollByName, err = resolveUplink(u); err == nil {
+				uplinks = append(uplinks, enroll...)
+				byName = byName || enrollByName
+			}
+		}
+		if err != nil {
+			zap.S().Warnf("enrollment of %s is not kept: %v", connection.EnrollURL, err)
+		}
+	}
+	if byName {
+		// it's resolved again while contained
+		rules.Resolvers = resolvers()
+	}
+	seen := map[endpoint]bool{}
+	for _, u := range uplinks {
+		if !seen[u] {
+			seen[u] = true
+			rules.Uplinks = append(rules.Uplinks, u)
+		}
+	}
+	if len(rules.Uplinks) == 0 {
+		return nil, errNoUplink
+	}
+	sort.Slice(rules.Uplinks, func(i, j int) bool {
+		if rules.Uplinks[i].IP != rules.Uplinks[j].IP {
+			return rules.Uplinks[i].IP < rules.Uplinks[j].IP
+		}
+		return rules.Uplinks[i].Port < rules.Uplinks[j].Port
+	})
+	return rules, nil
+}
+
+// resolveUplink returns the endpoints of the url, or of the proxy of it,
+// byName is set if it's resolved from a hostname
+func resolveUplink(u *url.URL) (uplinks []endpoint, byName bool, err error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultProxyPort(u.Scheme))
+	}
+	if p, err := utils.ProxyFor(u); err != nil {
+		return nil, false, err
+	} else if p != nil {
+		host = p.Host
+		if p.Port() == "" {
+			host = net.JoinHostPort(p.Hostname(), defaultProxyPort(p.Scheme))
+		}
+	}
+	hostname, portStr, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid port of %s: %w", host, err)
+	}
+	ips := []net.IP{net.ParseIP(hostname)}
+	if ips[0] == nil {
+		if ips, err = lookupIP(hostname); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", errNoUplink, err)
+		}
+		byName = true
+	}
+	for _, ip := range ips {
+		uplinks = append(uplinks, endpoint{IP: ip.String(), Port: uint16(n)})
+	}
+	return uplinks, byName, nil
+}
+
+// defaultProxyPort is the port of the scheme, of the proxy or the url
+func defaultProxyPort(scheme string) string {
+	switch scheme {
+	case "https":
+		return "443"
+	case "socks5":
+		return "1080"
+	}
+	return "80"
+}
+
+// resolvers are the nameservers of resolv.conf. The local ones are allowed
+// by lo, the upstreams of systemd-resolved are taken instead if it's the
+// stub of it.
+func resolvers() []string {
+	ips, local := nameservers(resolvConf)
+	if len(ips) == 0 && local {
+		ips, _ = nameservers(resolvedConf)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// nameservers returns the ones of the file not on loopback, local is set if
+// any is on it
+func nameservers(path string) (ips []string, local bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// the zone of a link local one is not in the rules
+		ip := net.ParseIP(strings.SplitN(fields[1], "%", 2)[0])
+		if ip == nil {
+			continue
+		}
+		if ip.IsLoopback() {
+			local = true
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	return
+}
+
+func isIPv4(s string) bool {
+	return strings.Contains(s, ".") && !strings.Contains(s, ":")
+}
+
+type nftables struct{}
+
+// install replaces the table atomically, it's added first, so the delete
+// never fails
+func (nftables) install(rules *containRules) error {
+	return runCommand(nftRuleset(rules), "nft", "-f", "-")
+}
+
+// remove never fails if the table is deleted already
+func (nftables) remove() error {
+	return runCommand(fmt.Sprintf("table inet %s\ndelete table inet %s\n", nftTable, nftTable), "nft", "-f", "-")
+}
+
+func nftRuleset(rules *containRules) string {
+	var in, out []string
+	in = append(in, `iif "lo" accept`,
+		"icmpv6 type { nd-neighbor-solicit, nd-neighbor-advert, nd-router-advert } accept",
+		"udp sport { 67, 547 } udp dport { 68, 546 } accept")
+	out = append(out, `oif "lo" accept`,
+		"icmpv6 type { nd-neighbor-solicit, nd-neighbor-advert, nd-router-solicit } accept",
+		"udp sport { 68, 546 } udp dport { 67, 547 } accept")
+	family := func(addr string) string {
+		if isIPv4(addr) {
+			return "ip"
+		}
+		return "ip6"
+	}
+	for _, u := range rules.Uplinks {
+		f := family(u.IP)
+		in = append(in, fmt.Sprintf("%s saddr %s tcp sport %d accept", f, u.IP, u.Port))
+		out = append(out, fmt.Sprintf("%s daddr %s tcp dport %d accept", f, u.IP, u.Port))
+	}
+	for _, ip := range rules.Resolvers {
+		f := family(ip)
+		in = append(in, fmt.Sprintf("%s saddr %s meta l4proto { tcp, udp } th sport 53 accept", f, ip))
+		out = append(out, fmt.Sprintf("%s daddr %s meta l4proto { tcp, udp } th dport 53 accept", f, ip))
+	}
+	for _, n := range rules.Networks {
+		f := family(n)
+		in = append(in, fmt.Sprintf("%s saddr %s accept", f, n))
+		out = append(out, fmt.Sprintf("%s daddr %s accept", f, n))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\ntable inet %s {\n", nftTable, nftTable, nftTable)
+	for _, chain := range []struct {
+		name  string
+		rules []string
+	}{{"input", in}, {"output", out}, {"forward", nil}} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority -100; policy drop;\n", chain.name, chain.name)
+		for _, rule := range chain.rules {
+			fmt.Fprintf(&b, "\t\t%s\n", rule)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// iptables jumps to the chains of the containment at the top of the built-in
+// ones, for both ipv4 and ipv6. It's not installed if ip6tables is not
+// found, the ipv6 would be left open.
+type iptables struct{}
+
+var iptablesChains = []struct {
+	builtin string
+	chain   string
+}{{"INPUT", iptablesInput}, {"OUTPUT", iptablesOutput}, {"FORWARD", iptablesForward}}
+
+// commands are the ones found, the chains left are removed by them
+func (iptables) commands() []string {
+	commands := []string{"iptables"}
+	if _, err := lookPath("ip6tables"); err == nil {
+		commands = append(commands, "ip6tables")
+	}
+	return commands
+}
+
+func (fw iptables) install(rules *containRules) error {
+	if _, err := lookPath("ip6tables"); err != nil {
+		return errNoIp6tables
+	}
+	for _, cmd := range fw.commands() {
+		v4 := cmd == "iptables"
+		for _, c := range iptablesChains {
+			// it fails if the chain exists
+			runCommand("", cmd, "-N", c.chain)
+			if err := runCommand("", cmd, "-F", c.chain); err != nil {
+				return err
+			}
+			for _, rule := range iptablesRules(rules, c.chain, v4) {
+				if err := runCommand("", cmd, append([]string{"-A", c.chain}, rule...)...); err != nil {
+					return err
+				}
+			}
+			if runCommand("", cmd, "-C", c.builtin, "-j", c.chain) != nil {
+				if err := runCommand("", cmd, "-I", c.builtin, "1", "-j", c.chain); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (fw iptables) remove() error {
+	for _, cmd := range fw.commands() {
+		for _, c := range iptablesChains {
+			for runCommand("", cmd, "-D", c.builtin, "-j", c.chain) == nil {
+			}
+			runCommand("", cmd, "-F", c.chain)
+			runCommand("", cmd, "-X", c.chain)
+		}
+	}
+	return nil
+}
+
+// iptablesRules are the rules of the chain, of the addresses in the family
+func iptablesRules(rules *containRules, chain string, v4 bool) (list [][]string) {
+	if chain == iptablesForward {
+		return [][]string{{"-j", "DROP"}}
+	}
+	in := chain == iptablesInput
+	addr, port, iface := "-d", "--dport", "-o"
+	dhcp := []string{"-p", "udp", "--sport", "68", "--dport", "67"}
+	if !v4 {
+		dhcp = []string{"-p", "udp", "--sport", "546", "--dport", "547"}
+	}
+	if in {
+		addr, port, iface = "-s", "--sport", "-i"
+		dhcp[3], dhcp[5] = dhcp[5], dhcp[3]
+	}
+	list = append(list, []string{iface, "lo", "-j", "ACCEPT"}, append(dhcp, "-j", "ACCEPT"))
+	if !v4 {
+		types := []string{"neighbour-solicitation", "neighbour-advertisement", "router-solicitation"}
+		if in {
+			types[2] = "router-advertisement"
+		}
+		for _, t := range types {
+			list = append(list, []string{"-p", "ipv6-icmp", "--icmpv6-type", t, "-j", "ACCEPT"})
+		}
+	}
+	for _, u := range rules.Uplinks {
+		if isIPv4(u.IP) == v4 {
+			list = append(list, []string{addr, u.IP, "-p", "tcp", port, strconv.Itoa(int(u.Port)), "-j", "ACCEPT"})
+		}
+	}
+	for _, ip := range rules.Resolvers {
+		if isIPv4(ip) == v4 {
+			for _, proto := range []string{"udp", "tcp"} {
+				list = append(list, []string{addr, ip, "-p", proto, port, "53", "-j", "ACCEPT"})
+			}
+		}
+	}
+	for _, n := range rules.Networks {
+		if isIPv4(n) == v4 {
+			list = append(list, []string{addr, n, "-j", "ACCEPT"})
+		}
+	}
+	return append(list, []string{"-j", "DROP"})
+}
@@ -0,0 +1,200 @@
+package response
+
+import (
+	"agent/transport/connection"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type command struct {
+	stdin string
+	args  []string
+}
+
+// fakeFirewall records the commands instead of running them, only the
+// commands found are allowed
+func fakeFirewall(t *testing.T, found ...string) *[]command {
+	var commands []command
+	run, look := runCommand, lookPath
+	t.Cleanup(func() { runCommand, lookPath = run, look })
+	runCommand = func(stdin string, name string, args ...string) error {
+		commands = append(commands, command{stdin: stdin, args: append([]string{name}, args...)})
+		return nil
+	}
+	lookPath = func(file string) (string, error) {
+		for _, f := range found {
+			if f == file {
+				return "/usr/sbin/" + f, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	return &commands
+}
+
+func setEndpoint(t *testing.T, addr, port string) {
+	oldAddr, oldPort := connection.Endpoint()
+	// SetEndpoint keeps the empty ones
+	t.Cleanup(func() { connection.DebugAddr, connection.DebugPort = oldAddr, oldPort })
+	connection.SetEndpoint(addr, port)
+}
+
+func TestContainNftables(t *testing.T) {
+	commands := fakeFirewall(t, "nft", "iptables")
+	setEndpoint(t, "10.1.2.3", "8888")
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	task := newTask(t, "t1", &Action{Action: ActionContain, Allow: []string{"192.168.0.0/16", "fd00::1"}})
+	if err := r.Handle(task); err != nil {
+		t.Fatal(err)
+	}
+	fields := rec.last(t)
+	if fields["backend"] != "nftables" || fields["uplinks"] != "10.1.2.3:8888" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	if len(*commands) != 1 {
+		t.Fatalf("unexpected commands: %v", *commands)
+	}
+	ruleset := (*commands)[0].stdin
+	for _, rule := range []string{
+		"ip daddr 10.1.2.3 tcp dport 8888 accept",
+		"ip saddr 10.1.2.3 tcp sport 8888 accept",
+		"ip saddr 192.168.0.0/16 accept",
+		"ip6 daddr fd00::1/128 accept",
+		"type filter hook forward priority -100; policy drop;",
+	} {
+		if !strings.Contains(ruleset, rule) {
+			t.Fatalf("%q is not in the ruleset:\n%s", rule, ruleset)
+		}
+	}
+	// installed again once the agent restarts, nothing changed otherwise
+	r.refreshContainment(false)
+	if len(*commands) != 1 {
+		t.Fatal("unchanged containment is installed again")
+	}
+	r.refreshContainment(true)
+	if len(*commands) != 2 || rec.last(t)["reason"] != "refreshed" {
+		t.Fatalf("containment is not installed again: %v", *commands)
+	}
+	if err := r.Handle(newTask(t, "t2", &Action{Action: ActionRelease})); err != nil {
+		t.Fatal(err)
+	}
+	if last := (*commands)[2]; !strings.Contains(last.stdin, "delete table inet "+nftTable) {
+		t.Fatalf("unexpected release: %v", last)
+	}
+	if _, err := os.Stat(filepath.Join(r.Workdir, ContainmentFile)); !os.IsNotExist(err) {
+		t.Fatal("containment is kept after release: ", err)
+	}
+	if err := r.Handle(newTask(t, "t3", &Action{Action: ActionRelease})); err == nil {
+		t.Fatal("released twice")
+	}
+}
+
+func TestContainIptables(t *testing.T) {
+	commands := fakeFirewall(t, "iptables", "ip6tables")
+	setEndpoint(t, "hades.example.com", "8888")
+	lookup := lookupIP
+	t.Cleanup(func() { lookupIP = lookup })
+	lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("10.1.2.4")}, nil
+	}
+	// the stub of systemd-resolved, the upstream of it is allowed
+	conf, resolved := resolvConf, resolvedConf
+	t.Cleanup(func() { resolvConf, resolvedConf = conf, resolved })
+	resolvConf = filepath.Join(t.TempDir(), "resolv.conf")
+	os.WriteFile(resolvConf, []byte("search example.com\nnameserver 127.0.0.53\n"), 0o644)
+	resolvedConf = filepath.Join(t.TempDir(), "resolv.conf")
+	os.WriteFile(resolvedConf, []byte("nameserver 10.0.0.53\n"), 0o644)
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionContain})); err != nil {
+		t.Fatal(err)
+	}
+	var appended [][]string
+	ip6 := false
+	for _, c := range *commands {
+		if c.args[0] == "ip6tables" {
+			ip6 = true
+			continue
+		}
+		if c.args[1] == "-A" && c.args[2] == iptablesOutput {
+			appended = append(appended, c.args[3:])
+		}
+	}
+	if !ip6 {
+		t.Fatal("ipv6 is not contained")
+	}
+	expect := [][]string{
+		{"-o", "lo", "-j", "ACCEPT"},
+		{"-p", "udp", "--sport", "68", "--dport", "67", "-j", "ACCEPT"},
+		{"-d", "10.1.2.3", "-p", "tcp", "--dport", "8888", "-j", "ACCEPT"},
+		{"-d", "10.1.2.4", "-p", "tcp", "--dport", "8888", "-j", "ACCEPT"},
+		{"-d", "10.0.0.53", "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
+		{"-d", "10.0.0.53", "-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
+		{"-j", "DROP"},
+	}
+	if !reflect.DeepEqual(appended, expect) {
+		t.Fatalf("unexpected rules: %v", appended)
+	}
+}
+
+func TestContainWithoutIp6tables(t *testing.T) {
+	commands := fakeFirewall(t, "iptables")
+	setEndpoint(t, "10.1.2.3", "8888")
+	r := New(t.TempDir(), &recorder{})
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionContain})); !errors.Is(err, errNoIp6tables) {
+		t.Fatal("contained without ip6tables: ", err)
+	}
+	if len(*commands) != 0 {
+		t.Fatalf("rules are installed without ip6tables: %v", *commands)
+	}
+}
+
+func TestContainEnrollment(t *testing.T) {
+	commands := fakeFirewall(t, "nft")
+	setEndpoint(t, "10.1.2.3", "8888")
+	enroll := connection.EnrollURL
+	t.Cleanup(func() { connection.EnrollURL = enroll })
+	connection.EnrollURL = "https://10.1.2.5/enroll"
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionContain})); err != nil {
+		t.Fatal(err)
+	}
+	if fields := rec.last(t); fields["uplinks"] != "10.1.2.3:8888,10.1.2.5:443" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	if ruleset := (*commands)[0].stdin; !strings.Contains(ruleset, "ip daddr 10.1.2.5 tcp dport 443 accept") {
+		t.Fatalf("enrollment is not in the ruleset:\n%s", ruleset)
+	}
+	// contained anyway if the enrollment can't be resolved
+	lookup := lookupIP
+	t.Cleanup(func() { lookupIP = lookup })
+	lookupIP = func(host string) ([]net.IP, error) { return nil, errors.New("no such host") }
+	connection.EnrollURL = "https://enroll.example.com/enroll"
+	if err := r.Handle(newTask(t, "t2", &Action{Action: ActionContain})); err != nil {
+		t.Fatal(err)
+	}
+	if fields := rec.last(t); fields["uplinks"] != "10.1.2.3:8888" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+}
+
+func TestContainWithoutUplink(t *testing.T) {
+	commands := fakeFirewall(t, "nft")
+	setEndpoint(t, "", "")
+	connection.DebugAddr, connection.DebugPort = "", ""
+	r := New(t.TempDir(), &recorder{})
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionContain})); !errors.Is(err, errNoUplink) {
+		t.Fatal("contained without the uplink: ", err)
+	}
+	if len(*commands) != 0 {
+		t.Fatal("rules are installed without the uplink")
+	}
+}
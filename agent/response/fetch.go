@@ -0,0 +1,149 @@
+package response
+
+import (
+	"agent/conf"
+	"agent/proto"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+const (
+	// the data of a DTAgentFile record before base64, small enough for a
+	// batch of the records in a message
+	fetchChunkSize = 32 << 10
+	// the chunks are flushed every window, so they don't pile up in the
+	// buffer
+	fetchWindow = 32
+	// bounds the flush of a window, the fetch fails if the uplink is slower
+	fetchFlushTimeout = time.Minute
+)
+
+var errNotAllowed = errors.New("not allowed")
+
+// IFlusher is implemented by the transmitter if it can wait for the records
+// buffered before a watermark to be sent, the ones of others buffered after
+// them are not waited for
+type IFlusher interface {
+	Queued() uint64
+	FlushQueued(ctx context.Context, mark uint64) error
+}
+
+// fetch sends the file to the server in DTAgentFile records, with the
+// sha256 and the size of the whole file in every chunk, so the server
+// checks it once the chunks are reassembled by the seq. Only the files
+// under the fetch paths of the local config are fetched, after the symlinks
+// are resolved.
+func (r *Responder) fetch(path, token string, audit map[string]string) error {
+	audit["path"] = path
+	if path == "" || !filepath.IsAbs(path) {
+		return fmt.Errorf("invalid path %q", path)
+	}
+	local := conf.Current().Response
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	if !fetchAllowed(resolved, local.Fetch.Paths) {
+		return fmt.Errorf("%w: %s", errNotAllowed, resolved)
+	}
+	// a fifo would block the open, it's checked before and on the fd
+	lstat, err := os.Lstat(resolved)
+	if err != nil {
+		return err
+	}
+	f, info, err := openRegular(resolved, lstat)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the file may grow, what's read is bounded as well
+	maxSize := local.FetchSize()
+	if info.Size() > maxSize {
+		return fmt.Errorf("%s is larger than %d", resolved, maxSize)
+	}
+	content, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) > maxSize {
+		return fmt.Errorf("%s is larger than %d", resolved, maxSize)
+	}
+	sum := sha256.Sum256(content)
+	fields := map[string]string{
+		"token":  token,
+		"path":   resolved,
+		"sha256": hex.EncodeToString(sum[:]),
+		"size":   strconv.Itoa(len(content)),
+	}
+	for k, v := range fields {
+		audit[k] = v
+	}
+	total := (len(content) + fetchChunkSize - 1) / fetchChunkSize
+	if total == 0 {
+		total = 1
+	}
+	audit["chunks"] = strconv.Itoa(total)
+	fields["total"] = audit["chunks"]
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * fetchChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		chunk := make(map[string]string, len(fields)+2)
+		for k, v := range fields {
+			chunk[k] = v
+		}
+		chunk["seq"] = strconv.Itoa(seq)
+		chunk["data"] = base64.StdEncoding.EncodeToString(content[seq*fetchChunkSize : end])
+		if err = r.Transmitter.TransmitAgent(&proto.Record{
+			DataType:  config.DTAgentFile,
+			Timestamp: time.Now().Unix(),
+			Data:      &proto.Payload{Fields: chunk},
+		}, true); err != nil {
+			return fmt.Errorf("chunk %d: %w", seq, err)
+		}
+		if (seq+1)%fetchWindow == 0 {
+			if err = r.flush(); err != nil {
+				return fmt.Errorf("chunk %d: %w", seq, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Responder) flush() error {
+	flusher, ok := r.Transmitter.(IFlusher)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchFlushTimeout)
+	defer cancel()
+	return flusher.FlushQueued(ctx, flusher.Queued())
+}
+
+// fetchAllowed reports whether the path is one of the paths, or under one
+// of them, the symlinks of the paths are resolved as well
+func fetchAllowed(path string, paths []string) bool {
+	for _, allowed := range paths {
+		if resolved, err := filepath.EvalSymlinks(allowed); err == nil {
+			allowed = resolved
+		}
+		allowed = filepath.Clean(allowed)
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package response
+
+import (
+	"agent/conf"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+func setFetch(t *testing.T, maxSize int64, paths ...string) {
+	old := conf.Current()
+	t.Cleanup(func() { conf.Set(old) })
+	f := &conf.File{}
+	f.Response.Fetch.Paths = paths
+	f.Response.Fetch.MaxSize = maxSize
+	conf.Set(f)
+}
+
+func TestFetch(t *testing.T) {
+	dir := t.TempDir()
+	setFetch(t, 1<<20, dir)
+	content := make([]byte, 3*fetchChunkSize+100)
+	rand.Read(content)
+	path := filepath.Join(dir, "sample")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionFetch, Path: path})); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	var assembled []byte
+	for i, record := range rec.recs {
+		fields := record.GetData().GetFields()
+		if record.GetDataType() != config.DTAgentFile {
+			if i != len(rec.recs)-1 {
+				t.Fatal("audit record before the chunks")
+			}
+			continue
+		}
+		if fields["seq"] != strconv.Itoa(i) || fields["total"] != "4" || fields["token"] != "t1" ||
+			fields["sha256"] != hex.EncodeToString(sum[:]) {
+			t.Fatalf("unexpected chunk: %v", fields)
+		}
+		data, err := base64.StdEncoding.DecodeString(fields["data"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assembled = append(assembled, data...)
+	}
+	if !bytes.Equal(assembled, content) {
+		t.Fatal("unexpected content fetched")
+	}
+	if fields := rec.last(t); fields["chunks"] != "4" || fields["status"] != "succeeded" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+}
+
+func TestFetchNotAllowed(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	setFetch(t, 16, dir)
+	secret := filepath.Join(outside, "secret")
+	os.WriteFile(secret, []byte("secret"), 0o600)
+	r := New(t.TempDir(), &recorder{})
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionFetch, Path: secret})); !errors.Is(err, errNotAllowed) {
+		t.Fatal("file out of the paths is fetched: ", err)
+	}
+	// the symlinks are resolved
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(secret, link); err != nil {
+		t.Skip("symlink: ", err)
+	}
+	if err := r.Handle(newTask(t, "t2", &Action{Action: ActionFetch, Path: link})); !errors.Is(err, errNotAllowed) {
+		t.Fatal("file out of the paths is fetched by symlink: ", err)
+	}
+	large := filepath.Join(dir, "large")
+	os.WriteFile(large, make([]byte, 17), 0o600)
+	if err := r.Handle(newTask(t, "t3", &Action{Action: ActionFetch, Path: large})); err == nil {
+		t.Fatal("file larger than max_size is fetched")
+	}
+	// nothing is fetched by default
+	setFetch(t, 0)
+	if err := r.Handle(newTask(t, "t4", &Action{Action: ActionFetch, Path: large})); !errors.Is(err, errNotAllowed) {
+		t.Fatal("file is fetched without the paths: ", err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package response
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFetchFifo(t *testing.T) {
+	dir := t.TempDir()
+	setFetch(t, 1<<20, dir)
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skip("mkfifo: ", err)
+	}
+	r := New(t.TempDir(), &recorder{})
+	task := newTask(t, "t1", &Action{Action: ActionFetch, Path: fifo})
+	done := make(chan error, 1)
+	go func() { done <- r.Handle(task) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errNotRegular) {
+			t.Fatal("fifo is fetched: ", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fetch blocks on a fifo")
+	}
+}
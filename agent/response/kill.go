@@ -0,0 +1,31 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+var errProtectedProcess = errors.New("protected process")
+
+// kill signals the process, or the process group. The init and the agent
+// itself are never killed.
+func kill(action *Action, audit map[string]string) error {
+	audit["pid"] = strconv.Itoa(action.Pid)
+	audit["group"] = strconv.FormatBool(action.Group)
+	if action.Signal == 0 {
+		action.Signal = signalKill
+	}
+	audit["signal"] = strconv.Itoa(action.Signal)
+	if action.Pid <= 1 || action.Pid == os.Getpid() {
+		return fmt.Errorf("%w: %d", errProtectedProcess, action.Pid)
+	}
+	if action.Signal < 0 || action.Signal > maxSignal {
+		return fmt.Errorf("invalid signal %d", action.Signal)
+	}
+	if action.Group {
+		return killGroup(action.Pid, action.Signal)
+	}
+	return killProcess(action.Pid, action.Signal)
+}
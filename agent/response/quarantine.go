@@ -0,0 +1,183 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuarantineDir keeps the quarantined files in the workdir, every file is
+// named by <sha256>-<unix nano>, with the metadata in <name>.json
+const QuarantineDir = "quarantine"
+
+var (
+	errNotRegular = errors.New("not a regular file")
+	errReplaced   = errors.New("file is replaced")
+)
+
+// Metadata is where the quarantined file is from, so it can be restored
+type Metadata struct {
+	Path          string `json:"path"`
+	Sha256        string `json:"sha256"`
+	Size          int64  `json:"size"`
+	Mode          string `json:"mode"`
+	Uid           string `json:"uid,omitempty"`
+	Gid           string `json:"gid,omitempty"`
+	ModTime       int64  `json:"mtime"`
+	QuarantinedAt int64  `json:"quarantined_at"`
+	Token         string `json:"token,omitempty"`
+}
+
+// quarantine moves the file into QuarantineDir, it's copied and removed if
+// it's on another filesystem. Only the regular files are quarantined, the
+// symlinks are not followed.
+func (r *Responder) quarantine(path, token string, audit map[string]string) error {
+	audit["path"] = path
+	if path == "" || !filepath.IsAbs(path) {
+		return fmt.Errorf("invalid path %q", path)
+	}
+	path = filepath.Clean(path)
+	dir := filepath.Join(r.Workdir, QuarantineDir)
+	if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return fmt.Errorf("%s is quarantined already", path)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s", errNotRegular, path)
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	tmp := filepath.Join(dir, "."+strconv.FormatInt(now.UnixNano(), 10))
+	if err = move(path, tmp, info); err != nil {
+		return err
+	}
+	// the path may be swapped between the lstat and the rename, what's
+	// renamed is left in tmp then, it's not put back over the path
+	moved, err := os.Lstat(tmp)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, moved) {
+		audit["quarantine"] = tmp
+		return fmt.Errorf("%w: %s", errReplaced, path)
+	}
+	f, _, err := openRegular(tmp, moved)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum, err := fileSha256(f)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = readOnly(f); err != nil {
+		return err
+	}
+	audit["sha256"] = sum
+	meta := &Metadata{
+		Path:          path,
+		Sha256:        sum,
+		Size:          info.Size(),
+		Mode:          info.Mode().String(),
+		ModTime:       info.ModTime().Unix(),
+		QuarantinedAt: now.Unix(),
+		Token:         token,
+	}
+	fileOwner(info, meta)
+	name := filepath.Join(dir, sum+"-"+strconv.FormatInt(now.UnixNano(), 10))
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(name+".json", content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return err
+	}
+	audit["quarantine"] = name
+	return nil
+}
+
+// move renames the file lstat'ed by info, or copies it if the rename is
+// across filesystems. The copy fails if the file is replaced since it's
+// lstat'ed.
+func move(src, dst string, info os.FileInfo) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !isCrossDevice(linkErr.Err) {
+		return err
+	}
+	in, _, err := openRegular(src, info)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o400)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if current, lerr := os.Lstat(src); lerr != nil || !os.SameFile(info, current) {
+			err = fmt.Errorf("%w: %s", errReplaced, src)
+		}
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// openRegular opens the file lstat'ed by info through a fd without following
+// symlinks, and checks it's still the same regular file on the fd
+func openRegular(path string, info os.FileInfo) (*os.File, os.FileInfo, error) {
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%w: %s", errNotRegular, path)
+	}
+	f, err := openNoFollow(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !opened.Mode().IsRegular() || !os.SameFile(info, opened) {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s", errReplaced, path)
+	}
+	return f, opened, nil
+}
+
+func fileSha256(f io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,221 @@
+// Package response takes the response actions pushed by the server, which
+// are handled by the agent itself instead of the plugins, and reports an
+// audit record for every action taken.
+package response
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"agent/transport"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+	"go.uber.org/zap"
+)
+
+// Actions of TaskAgentResponse
+const (
+	ActionKill       = "kill"
+	ActionQuarantine = "quarantine"
+	ActionBlock      = "block"
+	ActionUnblock    = "unblock"
+	ActionContain    = "contain"
+	ActionRelease    = "release"
+	ActionFetch      = "fetch"
+	ActionRun        = "run"
+)
+
+// Action is pushed by the server in the task of TaskAgentResponse, one of:
+//
+//	{"action": "kill", "pid": 1234, "group": false, "signal": 9}
+//	{"action": "quarantine", "path": "/tmp/.x/miner"}
+//	{"action": "block", "hashes": ["<sha256 or md5>"]}
+//	{"action": "unblock", "hashes": ["<sha256 or md5>"]}
+//	{"action": "contain", "allow": ["10.0.0.0/8"]}
+//	{"action": "release"}
+//	{"action": "fetch", "path": "/var/log/secure"}
+//	{"action": "run", "payload": "<json of the command>", "signature": "ed25519:<base64>"}
+//
+// The pid is the process group id if group is set, the signal is SIGKILL if
+// it's not set. The quarantined file is moved into the workdir with the
+// metadata of it. The processes of a blocked hash are killed once they are
+// seen by the poll of /proc, the exec itself is not blocked, and the hashes
+// are kept in the workdir, so they survive restarts.
+//
+// The contained host is isolated by nftables, or iptables if nft is not
+// found, except the uplink of the agent, through the proxy if it's set, and
+// the networks allowed. The containment is kept in the workdir as well,
+// until it's released.
+//
+// The file fetched is sent in DTAgentFile records, if it's allowed by the
+// fetch paths of the local config.
+//
+// The command is run only if it's enabled and allowed by the local config,
+// and the payload is signed by a trusted key, like:
+//
+//	{"command": "netstat", "args": [], "timeout": 10, "token": "<token of the task>", "expire": 1700000000}
+//
+// The output is in the audit record once it exits.
+type Action struct {
+	Action string   `json:"action"`
+	Pid    int      `json:"pid,omitempty"`
+	Group  bool     `json:"group,omitempty"`
+	Signal int      `json:"signal,omitempty"`
+	Path   string   `json:"path,omitempty"`
+	Hashes []string `json:"hashes,omitempty"`
+	Allow  []string `json:"allow,omitempty"`
+	// Payload is signed by Signature, see runPayload
+	Payload   string `json:"payload,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+var ErrUnknownAction = errors.New("unknown action")
+
+// ITransmitter is where the audit records go
+type ITransmitter interface {
+	TransmitAgent(rec *proto.Record, important bool) error
+}
+
+// Responder takes the actions one by one, in the order they are pushed
+type Responder struct {
+	// Workdir keeps the quarantined files, the blocklist, the containment
+	// and the tokens run
+	Workdir     string
+	Transmitter ITransmitter
+	blocklist   *blocklist
+	tokens      runTokens
+}
+
+func New(workdir string, transmitter ITransmitter) *Responder {
+	return &Responder{
+		Workdir:     workdir,
+		Transmitter: transmitter,
+		blocklist:   newBlocklist(filepath.Join(workdir, BlocklistFile)),
+		tokens:      runTokens{path: filepath.Join(workdir, RunTokensFile)},
+	}
+}
+
+// Handle takes the action of the task, the audit record is reported whether
+// it succeeds or not
+func (r *Responder) Handle(task *proto.Task) error {
+	audit := map[string]string{}
+	err := r.handle(task, audit)
+	r.audit(task, audit, err)
+	if err != nil {
+		zap.S().Errorf("response action of task %s failed: %v", task.GetToken(), err)
+	}
+	return err
+}
+
+func (r *Responder) handle(task *proto.Task, audit map[string]string) error {
+	action := &Action{}
+	if err := json.Unmarshal([]byte(task.GetData()), action); err != nil {
+		return err
+	}
+	audit["action"] = action.Action
+	switch action.Action {
+	case ActionKill:
+		return kill(action, audit)
+	case ActionQuarantine:
+		return r.quarantine(action.Path, task.GetToken(), audit)
+	case ActionBlock:
+		return r.blocklist.add(action.Hashes, audit)
+	case ActionUnblock:
+		return r.blocklist.remove(action.Hashes, audit)
+	case ActionContain:
+		return r.contain(action, task.GetToken(), audit)
+	case ActionRelease:
+		return r.release(audit)
+	case ActionFetch:
+		return r.fetch(action.Path, task.GetToken(), audit)
+	case ActionRun:
+		return r.run(task, action, audit)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAction, action.Action)
+	}
+}
+
+// audit reports the action taken, with the token of the task, the ones
+// taken by the agent itself are without a token
+func (r *Responder) audit(task *proto.Task, fields map[string]string, err error) {
+	status := config.TaskStatusSucceeded
+	if err != nil {
+		status = config.TaskStatusFailed
+		fields["error"] = err.Error()
+	}
+	r.auditStatus(task, fields, status)
+}
+
+// auditStatus reports the action with the status, the one in progress is
+// reported as delivered
+func (r *Responder) auditStatus(task *proto.Task, fields map[string]string, status string) {
+	fields["token"] = task.GetToken()
+	fields["status"] = status
+	r.Transmitter.TransmitAgent(&proto.Record{
+		DataType:  config.DTAgentResponse,
+		Timestamp: time.Now().Unix(),
+		Data:      &proto.Payload{Fields: fields},
+	}, true)
+}
+
+// maxLongActions bounds the fetch and run actions taken at the same time
+const maxLongActions = 4
+
+// long reports whether the action of the task may take long, they are taken
+// off the loop of Startup
+func long(task *proto.Task) bool {
+	action := &Action{}
+	if err := json.Unmarshal([]byte(task.GetData()), action); err != nil {
+		return false
+	}
+	return action.Action == ActionFetch || action.Action == ActionRun
+}
+
+// Startup restores the blocklist and the containment, and takes the actions
+// until ctx is done. The fetch and run actions are taken aside, it returns
+// once the ones in progress are done.
+func Startup(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	// the workdir may be moved by the local config, it's read only once the
+	// agent starts
+	r := New(agent.Instance.Workdir, transport.DTransfer)
+	var running sync.WaitGroup
+	defer running.Wait()
+	slots := make(chan struct{}, maxLongActions)
+	if err := r.blocklist.load(); err != nil {
+		zap.S().Error("blocklist is not restored: ", err)
+	}
+	r.refreshContainment(true)
+	ticker := time.NewTicker(blockInterval)
+	defer ticker.Stop()
+	containTicker := time.NewTicker(containInterval)
+	defer containTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-transport.ResponseTaskChan:
+			if !long(task) {
+				r.Handle(task)
+				continue
+			}
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				r.Handle(task)
+			}()
+		case <-ticker.C:
+			r.enforce()
+		case <-containTicker.C:
+			r.refreshContainment(false)
+		}
+	}
+}
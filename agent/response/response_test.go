@@ -0,0 +1,234 @@
+package response
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	recs []*proto.Record
+}
+
+func (r *recorder) TransmitAgent(rec *proto.Record, important bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs = append(r.recs, rec)
+	return nil
+}
+
+func (r *recorder) last(t *testing.T) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.recs) == 0 {
+		t.Fatal("no audit record")
+	}
+	return r.recs[len(r.recs)-1].GetData().GetFields()
+}
+
+func newTask(t *testing.T, token string, action *Action) *proto.Task {
+	data, err := json.Marshal(action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &proto.Task{Token: token, Data: string(data)}
+}
+
+func TestKill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep on windows")
+	}
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionKill, Pid: cmd.Process.Pid})); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Fatal("process is not killed")
+	}
+	fields := rec.last(t)
+	if fields["token"] != "t1" || fields["status"] != "succeeded" || fields["signal"] != "9" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	// never the agent itself
+	err := r.Handle(newTask(t, "t2", &Action{Action: ActionKill, Pid: os.Getpid()}))
+	if !errors.Is(err, errProtectedProcess) {
+		t.Fatal("the agent is killed: ", err)
+	}
+	if fields = rec.last(t); fields["status"] != "failed" || fields["error"] == "" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	if err = r.Handle(newTask(t, "t3", &Action{Action: "reboot"})); !errors.Is(err, ErrUnknownAction) {
+		t.Fatal("unknown action is taken: ", err)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	rec := &recorder{}
+	workdir := t.TempDir()
+	r := New(workdir, rec)
+	path := filepath.Join(t.TempDir(), "miner")
+	if err := os.WriteFile(path, []byte("payload"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle(newTask(t, "t1", &Action{Action: ActionQuarantine, Path: path})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("file is not moved: ", err)
+	}
+	fields := rec.last(t)
+	// sha256 of payload
+	sum := "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+	if fields["sha256"] != sum || fields["status"] != "succeeded" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	content, err := os.ReadFile(fields["quarantine"])
+	if err != nil || string(content) != "payload" {
+		t.Fatalf("unexpected quarantined file: %q, err: %v", content, err)
+	}
+	content, err = os.ReadFile(fields["quarantine"] + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &Metadata{}
+	if err = json.Unmarshal(content, meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Path != path || meta.Sha256 != sum || meta.Size != 7 || meta.Token != "t1" {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	// the symlinks are not followed
+	link := filepath.Join(t.TempDir(), "link")
+	if err = os.Symlink(fields["quarantine"], link); err != nil {
+		t.Skip("symlink: ", err)
+	}
+	if err = r.Handle(newTask(t, "t2", &Action{Action: ActionQuarantine, Path: link})); !errors.Is(err, errNotRegular) {
+		t.Fatal("symlink is quarantined: ", err)
+	}
+}
+
+func hashOf(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return fileSha256(f)
+}
+
+func TestOpenRegular(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	os.WriteFile(path, []byte("first"), 0o600)
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := openRegular(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	// swapped after the lstat
+	swap := filepath.Join(dir, "swap")
+	os.WriteFile(swap, []byte("second"), 0o600)
+	if err = os.Rename(swap, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = openRegular(path, info); !errors.Is(err, errReplaced) {
+		t.Fatal("replaced file is opened: ", err)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("processes are checked in /proc")
+	}
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip(err)
+	}
+	// a copy of sleep, so the hash blocked is not the one of anything else
+	bin := filepath.Join(t.TempDir(), "sleep")
+	copyFile(t, sleep, bin)
+	f, err := os.OpenFile(bin, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(strconv.FormatInt(time.Now().UnixNano(), 10))
+	f.Close()
+	sum, err := hashOf(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	workdir := t.TempDir()
+	r := New(workdir, rec)
+	if err = r.Handle(newTask(t, "t1", &Action{Action: ActionBlock, Hashes: []string{"not-a-hash"}})); !errors.Is(err, errInvalidHash) {
+		t.Fatal("invalid hash is blocked: ", err)
+	}
+	if err = r.Handle(newTask(t, "t2", &Action{Action: ActionBlock, Hashes: []string{sum}})); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "30")
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	// it's killed once it execs the binary
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.enforce()
+		select {
+		case <-done:
+			fields := rec.last(t)
+			if fields["reason"] != "blocked" || fields["hash"] != sum || fields["token"] != "" {
+				t.Fatalf("unexpected audit: %v", fields)
+			}
+			// restored from the workdir
+			b := newBlocklist(filepath.Join(workdir, BlocklistFile))
+			if err = b.load(); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := b.hashes[sum]; !ok {
+				t.Fatal("blocklist is not kept")
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("blocked process is not killed")
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+
+package response
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+const (
+	signalKill = int(syscall.SIGKILL)
+	maxSignal  = 64
+)
+
+func killProcess(pid, signal int) error {
+	return syscall.Kill(pid, syscall.Signal(signal))
+}
+
+// killGroup refuses the group of the agent, which may be the one of the
+// supervisor too
+func killGroup(pgid, signal int) error {
+	if pgid == syscall.Getpgrp() {
+		return fmt.Errorf("%w: group %d", errProtectedProcess, pgid)
+	}
+	return syscall.Kill(-pgid, syscall.Signal(signal))
+}
+
+// fileOwner adds the owner of the file to the metadata
+func fileOwner(info os.FileInfo, meta *Metadata) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		meta.Uid = strconv.FormatUint(uint64(stat.Uid), 10)
+		meta.Gid = strconv.FormatUint(uint64(stat.Gid), 10)
+	}
+}
+
+// fileKey identifies the file by the device and the inode, with the size
+// and the mtime of it
+func fileKey(info os.FileInfo) (string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", uint64(stat.Dev), uint64(stat.Ino), info.Size(), info.ModTime().UnixNano()), true
+}
+
+// openNoFollow opens the file for reading, it fails on a symlink and
+// doesn't block on a fifo
+func openNoFollow(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+}
+
+// readOnly chmods the file through the fd, not the path
+func readOnly(f *os.File) error {
+	return f.Chmod(0o400)
+}
+
+func isCrossDevice(err error) bool {
+	return err == syscall.EXDEV
+}
+
+// setProcessGroup runs the command in a group of its own, so the children
+// are killed with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,59 @@
+//go:build windows
+
+package response
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/sys/windows"
+)
+
+// the process is always terminated, there's no signal on windows
+const (
+	signalKill = 9
+	maxSignal  = 9
+)
+
+func killProcess(pid, signal int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	return p.Kill()
+}
+
+func killGroup(pgid, signal int) error {
+	return errors.New("process group is not supported")
+}
+
+func fileOwner(info os.FileInfo, meta *Metadata) {}
+
+// fileKey is by the size and the mtime only, there's no inode in the
+// FileInfo on windows. The processes are not checked on windows anyway.
+func fileKey(info os.FileInfo) (string, bool) {
+	return strconv.FormatInt(info.Size(), 10) + ":" + strconv.FormatInt(info.ModTime().UnixNano(), 10), true
+}
+
+func openNoFollow(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// readOnly chmods by the path, the file is opened without the access to
+// the attributes
+func readOnly(f *os.File) error {
+	return os.Chmod(f.Name(), 0o400)
+}
+
+func isCrossDevice(err error) bool {
+	return err == windows.ERROR_NOT_SAME_DEVICE
+}
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
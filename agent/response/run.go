@@ -0,0 +1,219 @@
+package response
+
+import (
+	"agent/conf"
+	"agent/proto"
+	"agent/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// RunTokensFile keeps the tokens run in the workdir until they expire, so a
+// payload is not run again after the agent restarts
+const RunTokensFile = "run_tokens.json"
+
+const (
+	// the signed payload is valid this long at most, the tokens run are
+	// kept until they expire, so a payload is never run twice
+	maxRunValidity = time.Hour
+	// the output is waited for this long once the command exits, the
+	// children detached from the group may keep the pipes open
+	runWaitDelay = time.Second
+)
+
+var (
+	errRunDisabled = errors.New("command is not allowed")
+	errRunExpired  = errors.New("command is expired")
+	errRunReplayed = errors.New("command is run already")
+)
+
+// runPayload is signed by the server, bound to the token of the task
+type runPayload struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Timeout in seconds, bounded by the local one
+	Timeout int    `json:"timeout,omitempty"`
+	Token   string `json:"token"`
+	// Expire is the unix time the payload is refused after
+	Expire int64 `json:"expire"`
+}
+
+// runTokens are the tokens run by the expire of them, kept in path
+type runTokens struct {
+	mu     sync.Mutex
+	path   string
+	tokens map[string]int64
+}
+
+// first reports whether the token is not run, and remembers it if so. The
+// token is refused if it can't be remembered.
+func (t *runTokens) first(token string, expire int64, now time.Time) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens == nil {
+		if err := t.load(); err != nil {
+			return false, err
+		}
+	}
+	for tok, exp := range t.tokens {
+		if exp < now.Unix() {
+			delete(t.tokens, tok)
+		}
+	}
+	if _, ok := t.tokens[token]; ok {
+		return false, nil
+	}
+	t.tokens[token] = expire
+	if err := t.save(); err != nil {
+		delete(t.tokens, token)
+		return false, err
+	}
+	return true, nil
+}
+
+// load must be called with mu held
+func (t *runTokens) load() error {
+	tokens := make(map[string]int64)
+	content, err := os.ReadFile(t.path)
+	if err == nil {
+		err = json.Unmarshal(content, &tokens)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	t.tokens = tokens
+	return nil
+}
+
+// save must be called with mu held
+func (t *runTokens) save() error {
+	content, err := json.Marshal(t.tokens)
+	if err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, t.path); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// run executes the command of the signed payload, if running is enabled by
+// the local config and the command is allowed by it. The command is run
+// without a shell, and killed with the process group of it once it times
+// out. A record is audited before it starts, and the output is in the one
+// after it exits.
+func (r *Responder) run(task *proto.Task, action *Action, audit map[string]string) error {
+	local := conf.Current().Response
+	if !local.Run.Enabled {
+		return fmt.Errorf("%w: running is disabled", errRunDisabled)
+	}
+	if err := utils.VerifySigned([]byte(action.Payload), action.Signature); err != nil {
+		return err
+	}
+	payload := &runPayload{}
+	if err := json.Unmarshal([]byte(action.Payload), payload); err != nil {
+		return err
+	}
+	audit["command"] = payload.Command
+	audit["args"] = strings.Join(payload.Args, " ")
+	now := time.Now()
+	if payload.Token == "" || payload.Token != task.GetToken() {
+		return fmt.Errorf("token %q of the payload doesn't match", payload.Token)
+	}
+	if payload.Expire < now.Unix() || payload.Expire > now.Add(maxRunValidity).Unix() {
+		return fmt.Errorf("%w: %d", errRunExpired, payload.Expire)
+	}
+	cmd, ok := local.RunCommand(payload.Command)
+	if !ok {
+		return fmt.Errorf("%w: %s", errRunDisabled, payload.Command)
+	}
+	if len(payload.Args) > 0 && !cmd.AllowArgs {
+		return fmt.Errorf("%w: args of %s", errRunDisabled, payload.Command)
+	}
+	if first, err := r.tokens.first(payload.Token, payload.Expire, now); err != nil {
+		return err
+	} else if !first {
+		return fmt.Errorf("%w: %s", errRunReplayed, payload.Token)
+	}
+	timeout := local.RunTimeout()
+	if t := time.Duration(payload.Timeout) * time.Second; t > 0 && t < timeout {
+		timeout = t
+	}
+	args := append(append([]string{}, cmd.Args...), payload.Args...)
+	audit["path"] = cmd.Path
+	audit["args"] = strings.Join(args, " ")
+	audit["timeout"] = strconv.Itoa(int(timeout / time.Second))
+
+	c := exec.Command(cmd.Path, args...)
+	c.Dir = "/"
+	c.Env = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "LANG=C"}
+	stdout := &limitedBuffer{limit: local.RunOutput()}
+	stderr := &limitedBuffer{limit: local.RunOutput()}
+	c.Stdout, c.Stderr = stdout, stderr
+	c.WaitDelay = runWaitDelay
+	setProcessGroup(c)
+	started := map[string]string{}
+	for k, v := range audit {
+		started[k] = v
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	audit["pid"] = strconv.Itoa(c.Process.Pid)
+	started["pid"] = audit["pid"]
+	r.auditStatus(task, started, config.TaskStatusDelivered)
+
+	timer := time.AfterFunc(timeout, func() { killProcessGroup(c) })
+	err := c.Wait()
+	timedOut := !timer.Stop()
+	audit["duration"] = strconv.FormatInt(time.Since(now).Milliseconds(), 10)
+	audit["stdout"] = stdout.String()
+	audit["stderr"] = stderr.String()
+	audit["truncated"] = strconv.FormatBool(stdout.truncated || stderr.truncated)
+	if c.ProcessState != nil {
+		audit["exit_code"] = strconv.Itoa(c.ProcessState.ExitCode())
+	}
+	if timedOut {
+		return fmt.Errorf("killed after %s", timeout)
+	}
+	return err
+}
+
+// limitedBuffer keeps the first limit bytes written, the rest is dropped.
+// The buffer is not embedded, or io.Copy would take ReadFrom of it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.buf.Len(); room < n {
+		b.truncated = true
+		if room <= 0 {
+			return n, nil
+		}
+		p = p[:room]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string { return b.buf.String() }
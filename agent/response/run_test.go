@@ -0,0 +1,173 @@
+package response
+
+import (
+	"agent/conf"
+	"agent/utils"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// signer trusts a new key, and signs the payloads of run by it
+func signer(t *testing.T) ed25519.PrivateKey {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keys.pem")
+	if err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = utils.LoadTrustedKeys(file, false); err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func runAction(t *testing.T, priv ed25519.PrivateKey, payload *runPayload) *Action {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+	return &Action{
+		Action:    ActionRun,
+		Payload:   string(data),
+		Signature: utils.SignaturePrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:])),
+	}
+}
+
+func setRun(t *testing.T, enabled bool, commands ...conf.Command) {
+	old := conf.Current()
+	t.Cleanup(func() { conf.Set(old) })
+	f := &conf.File{}
+	f.Response.Run.Enabled = enabled
+	f.Response.Run.Commands = commands
+	f.Response.Run.MaxOutput = 8
+	conf.Set(f)
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no echo on windows")
+	}
+	echo, err := exec.LookPath("echo")
+	if err != nil {
+		t.Skip(err)
+	}
+	priv := signer(t)
+	rec := &recorder{}
+	workdir := t.TempDir()
+	r := New(workdir, rec)
+	expire := time.Now().Add(time.Minute).Unix()
+	action := runAction(t, priv, &runPayload{Command: "echo", Args: []string{"hello"}, Token: "t1", Expire: expire})
+	setRun(t, false, conf.Command{Name: "echo", Path: echo, AllowArgs: true})
+	if err = r.Handle(newTask(t, "t1", action)); !errors.Is(err, errRunDisabled) {
+		t.Fatal("command is run while it's disabled: ", err)
+	}
+	setRun(t, true, conf.Command{Name: "echo", Path: echo, AllowArgs: true}, conf.Command{Name: "hi", Path: echo, Args: []string{"hi"}})
+	if err = r.Handle(newTask(t, "t1", action)); err != nil {
+		t.Fatal(err)
+	}
+	if started := rec.recs[len(rec.recs)-2].GetData().GetFields(); started["status"] != "delivered" || started["pid"] == "" {
+		t.Fatalf("unexpected audit before it starts: %v", started)
+	}
+	fields := rec.last(t)
+	if fields["status"] != "succeeded" || fields["stdout"] != "hello\n" || fields["exit_code"] != "0" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+	if err = r.Handle(newTask(t, "t1", action)); !errors.Is(err, errRunReplayed) {
+		t.Fatal("command is run twice: ", err)
+	}
+	// the tokens are kept across restarts
+	if err = New(workdir, rec).Handle(newTask(t, "t1", action)); !errors.Is(err, errRunReplayed) {
+		t.Fatal("command is run twice after restart: ", err)
+	}
+	// bound to the token of the task
+	if err = r.Handle(newTask(t, "t2", action)); err == nil {
+		t.Fatal("command is run by another token")
+	}
+	long := runAction(t, priv, &runPayload{Command: "echo", Args: []string{"0123456789"}, Token: "t3", Expire: expire})
+	if err = r.Handle(newTask(t, "t3", long)); err != nil {
+		t.Fatal(err)
+	}
+	if fields = rec.last(t); fields["stdout"] != "01234567" || fields["truncated"] != "true" {
+		t.Fatalf("unexpected output: %v", fields)
+	}
+	args := runAction(t, priv, &runPayload{Command: "hi", Args: []string{"there"}, Token: "t4", Expire: expire})
+	if err = r.Handle(newTask(t, "t4", args)); !errors.Is(err, errRunDisabled) {
+		t.Fatal("args are added to the command: ", err)
+	}
+	unknown := runAction(t, priv, &runPayload{Command: "sh", Token: "t5", Expire: expire})
+	if err = r.Handle(newTask(t, "t5", unknown)); !errors.Is(err, errRunDisabled) {
+		t.Fatal("command out of the allowlist is run: ", err)
+	}
+	expired := runAction(t, priv, &runPayload{Command: "hi", Token: "t6", Expire: time.Now().Add(-time.Second).Unix()})
+	if err = r.Handle(newTask(t, "t6", expired)); !errors.Is(err, errRunExpired) {
+		t.Fatal("expired command is run: ", err)
+	}
+	forged := runAction(t, priv, &runPayload{Command: "hi", Token: "t7", Expire: expire})
+	forged.Payload = `{"command": "echo", "args": ["forged"], "token": "t7", "expire": 9999999999}`
+	if err = r.Handle(newTask(t, "t7", forged)); !errors.Is(err, utils.ErrSignatureMismatch) {
+		t.Fatal("forged command is run: ", err)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep on windows")
+	}
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip(err)
+	}
+	priv := signer(t)
+	setRun(t, true, conf.Command{Name: "sleep", Path: sleep, Args: []string{"30"}})
+	rec := &recorder{}
+	r := New(t.TempDir(), rec)
+	action := runAction(t, priv, &runPayload{Command: "sleep", Timeout: 1, Token: "t1", Expire: time.Now().Add(time.Minute).Unix()})
+	start := time.Now()
+	if err = r.Handle(newTask(t, "t1", action)); err == nil {
+		t.Fatal("command is not killed")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("command is killed after %s", elapsed)
+	}
+	if fields := rec.last(t); fields["status"] != "failed" || fields["timeout"] != "1" {
+		t.Fatalf("unexpected audit: %v", fields)
+	}
+}
+
+func TestRunWaitDelay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	priv := signer(t)
+	// the child left keeps the pipes open after sh exits
+	setRun(t, true, conf.Command{Name: "detach", Path: sh, Args: []string{"-c", "sleep 5 &"}})
+	r := New(t.TempDir(), &recorder{})
+	action := runAction(t, priv, &runPayload{Command: "detach", Token: "t1", Expire: time.Now().Add(time.Minute).Unix()})
+	start := time.Now()
+	if err = r.Handle(newTask(t, "t1", action)); !errors.Is(err, exec.ErrWaitDelay) {
+		t.Fatal("pipes are not given up: ", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("output is waited for %s", elapsed)
+	}
+}
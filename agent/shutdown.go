@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"agent/agent"
+	"agent/plugin"
+	"agent/transport"
+
+	"go.uber.org/zap"
+)
+
+// shutdown stops the agent in order, within the timeout:
+//
+//  1. commands from the server and config syncs are refused
+//  2. plugins are shut down by depends_on, in 3/4 of the timeout
+//  3. records left are sent to the server, in 9/10 of the timeout
+//  4. the context is cancelled, records still buffered are spooled
+//
+// The process exits anyway once the timeout is exceeded.
+func shutdown(timeout time.Duration) {
+	start := time.Now()
+	// main returns before it if all goes well
+	time.AfterFunc(timeout, func() {
+		zap.S().Error("shutdown exceeds ", timeout, ", exit now")
+		zap.L().Sync()
+		os.Exit(1)
+	})
+	transport.DTransfer.Drain()
+	plugin.DefaultManager.Drain()
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(timeout*3/4))
+	plugin.DefaultManager.ShutdownAll(ctx)
+	cancel()
+	zap.S().Info("plugins are shut down in ", time.Since(start))
+	ctx, cancel = context.WithDeadline(context.Background(), start.Add(timeout*9/10))
+	if err := transport.DTransfer.Flush(ctx); err != nil {
+		zap.S().Warn("records are not flushed: ", err)
+	}
+	cancel()
+	agent.Instance.Cancel()
+}
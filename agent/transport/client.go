@@ -3,16 +3,35 @@ package transport
 import (
 	"agent/proto"
 	"context"
+	"strings"
 	"sync"
 	"time"
 
-	_ "agent/transport/compressor"
+	"agent/transport/compressor"
 	"agent/transport/connection"
+	"agent/watchdog"
 
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
 )
 
+// Compression negotiates the compressor of the stream, snappy by default
+var Compression, _, _ = compressor.NewNegotiator([]string{compressor.Name})
+
+// SetCompression sets the comma separated preferences of the compressor of
+// the stream, as zstd,snappy,none. The ones not available in this build are
+// skipped.
+func SetCompression(prefs string) error {
+	n, skipped, err := compressor.NewNegotiator(strings.Split(prefs, ","))
+	if err != nil {
+		return err
+	}
+	if len(skipped) > 0 {
+		zap.S().Warnf("compressors %v are not available, skipped", skipped)
+	}
+	Compression = n
+	return nil
+}
+
 // retries here, and some bugs
 func Startup(ctx context.Context, wg *sync.WaitGroup) {
 	var client proto.Transfer_TransferClient
@@ -20,7 +39,14 @@ func Startup(ctx context.Context, wg *sync.WaitGroup) {
 	zap.S().Info("grpc transport starts")
 	// Wait group for this goroutine
 	subWg := &sync.WaitGroup{}
+	// records left are spooled once all the goroutines exit
+	defer DTransfer.Close()
 	defer subWg.Wait()
+	subWg.Add(1)
+	go func() {
+		defer subWg.Done()
+		DTransfer.Replay(ctx)
+	}()
 	// start the loop of connecting
 	for {
 		select {
@@ -35,13 +61,19 @@ func Startup(ctx context.Context, wg *sync.WaitGroup) {
 			// generate sub-context and passes to the transfer client
 			subCtx, cancel := context.WithCancel(ctx)
 			if client, err = proto.NewTransferClient(conn).
-				Transfer(subCtx, grpc.UseCompressor("snappy")); err != nil {
+				Transfer(subCtx, Compression.CallOptions()...); err != nil {
 				zap.S().Error(err)
 				cancel()
 				time.Sleep(5 * time.Second)
 				continue
 			}
+			if err = DTransfer.Register(client); err != nil {
+				cancel()
+				time.Sleep(5 * time.Second)
+				continue
+			}
 			// client start successfully, start the goroutines and wait
+			DTransfer.SetHealthy(true)
 			subWg.Add(2)
 			go handleSend(subCtx, subWg, client)
 			go func() {
@@ -50,6 +82,7 @@ func Startup(ctx context.Context, wg *sync.WaitGroup) {
 			}()
 			// stuck here
 			subWg.Wait()
+			DTransfer.SetHealthy(false)
 			cancel()
 			time.Sleep(5 * time.Second)
 			zap.S().Info("transfer has been canceled, wait next try to transfer for 5 seconds")
@@ -63,7 +96,10 @@ func handleSend(ctx context.Context, wg *sync.WaitGroup, c proto.Transfer_Transf
 	defer zap.S().Info("send handler is exited")
 	defer c.CloseSend()
 	zap.S().Info("send handler is running")
-	ticker := time.NewTicker(time.Millisecond * 100)
+	// the agent stuck in sending is restarted by the watchdog
+	progress := watchdog.Register("send handler")
+	defer progress.Done()
+	ticker := time.NewTicker(DTransfer.flushInterval())
 	defer ticker.Stop()
 	for {
 		select {
@@ -71,7 +107,10 @@ func handleSend(ctx context.Context, wg *sync.WaitGroup, c proto.Transfer_Transf
 			return
 		case <-ticker.C:
 			DTransfer.Send(c)
+		case <-DTransfer.flushCh:
+			DTransfer.Send(c)
 		}
+		progress.Beat()
 	}
 }
 
@@ -85,6 +124,9 @@ func handleReceive(ctx context.Context, wg *sync.WaitGroup, client proto.Transfe
 			return
 		default:
 			if err := DTransfer.Receive(client); err != nil {
+				if Compression.Reject(err) {
+					zap.S().Warnf("compressor is not supported by the server, %s from the next connection", Compression.Current())
+				}
 				return
 			}
 		}
@@ -0,0 +1,108 @@
+package compressor
+
+import (
+	"agent/proto"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	snappylib "github.com/golang/snappy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+func TestNegotiator(t *testing.T) {
+	if _, _, err := NewNegotiator([]string{"br"}); err != errNoCompressor {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, skipped, err := NewNegotiator(strings.Split("br, snappy,none", ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0] != "br" || n.Current() != Name || len(n.CallOptions()) != 1 {
+		t.Fatalf("unexpected preferences: %v %s", skipped, n.Current())
+	}
+	// other failures keep the compressor
+	if n.Reject(status.Error(codes.Unavailable, "connection refused")) ||
+		n.Reject(status.Error(codes.Unimplemented, "unknown service grpc.Transfer")) {
+		t.Fatal("downgraded by an unrelated error")
+	}
+	rejected := status.Error(codes.Unimplemented, `grpc: Decompressor is not installed for grpc-encoding "snappy"`)
+	if !n.Reject(rejected) || n.Current() != None || n.CallOptions() != nil {
+		t.Fatalf("not downgraded: %s", n.Current())
+	}
+	if n.Reject(rejected) || n.Current() != None {
+		t.Fatal("the last preference should be kept")
+	}
+	if n, _, _ = NewNegotiator([]string{"zstd", "snappy"}); n.Current() != ZstdName {
+		t.Fatalf("zstd is not preferred: %s", n.Current())
+	}
+}
+
+func TestWireStats(t *testing.T) {
+	for _, name := range []string{Name, ZstdName} {
+		t.Run(name, func(t *testing.T) { testWireStats(t, name) })
+	}
+}
+
+func testWireStats(t *testing.T, name string) {
+	raw, compressed := WireStats()
+	c := encoding.GetCompressor(name)
+	buf := &bytes.Buffer{}
+	w, err := c.Compress(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("hades"), 1000)
+	w.Write(data)
+	w.Close()
+	r, err := c.Decompress(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected data: %v", err)
+	}
+	raw2, compressed2 := WireStats()
+	if raw2-raw != uint64(len(data)) || compressed2-compressed != uint64(buf.Len()) {
+		t.Fatalf("unexpected stats: %d %d of %d %d", raw2-raw, compressed2-compressed, len(data), buf.Len())
+	}
+	if ratio := Ratio(raw2-raw, compressed2-compressed); ratio >= 1 || ratio <= 0 {
+		t.Fatalf("unexpected ratio: %f", ratio)
+	}
+}
+
+func TestCompressRecord(t *testing.T) {
+	small := &proto.Record{DataType: 1, Data: &proto.Payload{Fields: map[string]string{"k": "v"}}}
+	if CompressRecord(small) != small {
+		t.Fatal("small record is compressed")
+	}
+	fields := map[string]string{"argv": strings.Repeat("/usr/bin/bash ", 100)}
+	rec := &proto.Record{DataType: 1000, Timestamp: 1, Origin: proto.Origin_AGENT, Data: &proto.Payload{Fields: fields}}
+	got := CompressRecord(rec)
+	if got == rec || got.Data != nil || got.Encoding != Name || got.DataType != 1000 || got.Origin != proto.Origin_AGENT {
+		t.Fatalf("record is not compressed: %v", got)
+	}
+	if rec.Data == nil || rec.Encoding != "" {
+		t.Fatal("original record is modified")
+	}
+	// the server restores it through the wire
+	b, err := got.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire := &proto.Record{}
+	if err = wire.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	data, err := snappylib.Decode(nil, wire.Compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := &proto.Payload{}
+	if err = payload.Unmarshal(data); err != nil || payload.Fields["argv"] != fields["argv"] {
+		t.Fatalf("unexpected payload: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package compressor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// None disables the compression of the stream
+const None = "none"
+
+var errNoCompressor = errors.New("no compressor available")
+
+// Negotiator picks the compression of the stream from the preferences, the
+// first one available in this build. A server without the compressor fails
+// the stream with Unimplemented, and the next one is used from the next
+// connection on, down to None at last.
+type Negotiator struct {
+	mu    sync.Mutex
+	prefs []string
+	idx   int
+}
+
+// NewNegotiator keeps the preferences which are registered to grpc, as zstd
+// and snappy. The unknown ones are returned as skipped.
+func NewNegotiator(prefs []string) (n *Negotiator, skipped []string, err error) {
+	n = &Negotiator{}
+	for _, name := range prefs {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+		case name == None || name == "identity":
+			n.prefs = append(n.prefs, None)
+		case encoding.GetCompressor(name) != nil:
+			n.prefs = append(n.prefs, name)
+		default:
+			skipped = append(skipped, name)
+		}
+	}
+	if len(n.prefs) == 0 {
+		err = errNoCompressor
+	}
+	return
+}
+
+// Current returns the compressor of the next connection
+func (n *Negotiator) Current() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.prefs[n.idx]
+}
+
+// CallOptions of the stream with the current compressor
+func (n *Negotiator) CallOptions() []grpc.CallOption {
+	if name := n.Current(); name != None {
+		return []grpc.CallOption{grpc.UseCompressor(name)}
+	}
+	return nil
+}
+
+// Reject downgrades to the next preference if the stream failed since the
+// server doesn't support the current compressor, and reports whether it's
+// downgraded. The last preference is kept anyway.
+func (n *Negotiator) Reject(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.Unimplemented {
+		return false
+	}
+	if msg := strings.ToLower(s.Message()); !strings.Contains(msg, "compress") && !strings.Contains(msg, "encoding") {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.idx+1 >= len(n.prefs) {
+		return false
+	}
+	n.idx++
+	return true
+}
@@ -0,0 +1,40 @@
+package compressor
+
+import (
+	"agent/proto"
+	"sync/atomic"
+
+	snappylib "github.com/golang/snappy"
+)
+
+// MinRecordSize is the size of the data below which a record is not worth
+// compressing on its own
+const MinRecordSize = 512
+
+// CompressRecord returns the copy of the record with the data compressed by
+// snappy, so the server may store it as it is. The record itself is returned
+// if it's too small or the data doesn't shrink.
+func CompressRecord(rec *proto.Record) *proto.Record {
+	if rec.GetData() == nil || rec.GetEncoding() != "" || rec.Data.Size() < MinRecordSize {
+		return rec
+	}
+	data, err := rec.Data.Marshal()
+	if err != nil {
+		return rec
+	}
+	compressed := snappylib.Encode(nil, data)
+	atomic.AddUint64(&recordStats.raw, uint64(len(data)))
+	if len(compressed) >= len(data) {
+		atomic.AddUint64(&recordStats.compressed, uint64(len(data)))
+		return rec
+	}
+	atomic.AddUint64(&recordStats.compressed, uint64(len(compressed)))
+	return &proto.Record{
+		DataType:      rec.DataType,
+		Timestamp:     rec.Timestamp,
+		Origin:        rec.Origin,
+		Compressed:    compressed,
+		Encoding:      Name,
+		SchemaVersion: rec.SchemaVersion,
+	}
+}
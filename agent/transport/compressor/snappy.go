@@ -26,6 +26,7 @@ import (
 	"io"
 	"io/ioutil"
 	"sync"
+	"sync/atomic"
 
 	snappylib "github.com/golang/snappy"
 	"google.golang.org/grpc/encoding"
@@ -41,6 +42,8 @@ type compressor struct {
 type writer struct {
 	*snappylib.Writer
 	pool *sync.Pool
+	// counts the compressed bytes written to the underlying writer
+	counter countingWriter
 }
 
 type reader struct {
@@ -51,15 +54,17 @@ type reader struct {
 func init() {
 	c := &compressor{}
 	c.poolCompressor.New = func() interface{} {
-		w := snappylib.NewWriter(ioutil.Discard)
-		return &writer{Writer: w, pool: &c.poolCompressor}
+		z := &writer{Writer: snappylib.NewWriter(ioutil.Discard), pool: &c.poolCompressor}
+		z.counter.Writer = ioutil.Discard
+		return z
 	}
 	encoding.RegisterCompressor(c)
 }
 
 func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
 	z := c.poolCompressor.Get().(*writer)
-	z.Writer.Reset(w)
+	z.counter.Writer = w
+	z.Writer.Reset(&z.counter)
 	return z, nil
 }
 
@@ -77,8 +82,15 @@ func (c *compressor) Name() string {
 	return Name
 }
 
+func (z *writer) Write(p []byte) (n int, err error) {
+	n, err = z.Writer.Write(p)
+	atomic.AddUint64(&wireStats.raw, uint64(n))
+	return
+}
+
 func (z *writer) Close() error {
 	err := z.Writer.Close()
+	z.counter.Writer = ioutil.Discard
 	z.pool.Put(z)
 	return err
 }
@@ -0,0 +1,44 @@
+package compressor
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+type stats struct {
+	raw        uint64
+	compressed uint64
+}
+
+var wireStats, recordStats stats
+
+// countingWriter counts the compressed bytes of the messages
+type countingWriter struct {
+	io.Writer
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	atomic.AddUint64(&wireStats.compressed, uint64(n))
+	return
+}
+
+// WireStats returns the bytes of the messages before and after compressed
+// by the stream
+func WireStats() (raw, compressed uint64) {
+	return atomic.LoadUint64(&wireStats.raw), atomic.LoadUint64(&wireStats.compressed)
+}
+
+// RecordStats returns the bytes of the data of the records before and after
+// compressed one by one
+func RecordStats() (raw, compressed uint64) {
+	return atomic.LoadUint64(&recordStats.raw), atomic.LoadUint64(&recordStats.compressed)
+}
+
+// Ratio is compressed bytes to raw bytes, 1 if nothing is compressed yet
+func Ratio(raw, compressed uint64) float64 {
+	if raw == 0 {
+		return 1
+	}
+	return float64(compressed) / float64(raw)
+}
@@ -0,0 +1,96 @@
+package compressor
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// ZstdName is the zstd compressor of the stream, it takes less bandwidth
+// than snappy with a bit more cpu
+const ZstdName = "zstd"
+
+// a message decoded is bounded by it, the one claiming more is refused
+const zstdMaxMemory = 64 << 20
+
+type zstdCompressor struct {
+	poolCompressor   sync.Pool
+	poolDecompressor sync.Pool
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+	// counts the compressed bytes written to the underlying writer
+	counter countingWriter
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+func init() {
+	c := &zstdCompressor{}
+	c.poolCompressor.New = func() interface{} {
+		z := &zstdWriter{pool: &c.poolCompressor}
+		z.counter.Writer = ioutil.Discard
+		// the options are valid, it never fails
+		z.Encoder, _ = zstd.NewWriter(&z.counter, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return z
+	}
+	encoding.RegisterCompressor(c)
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	z := c.poolCompressor.Get().(*zstdWriter)
+	z.counter.Writer = w
+	z.Encoder.Reset(&z.counter)
+	return z, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	z, inPool := c.poolDecompressor.Get().(*zstdReader)
+	if !inPool {
+		// decoded in the caller, no goroutine is left behind
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(zstdMaxMemory))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{Decoder: d, pool: &c.poolDecompressor}, nil
+	}
+	if err := z.Reset(r); err != nil {
+		c.poolDecompressor.Put(z)
+		return nil, err
+	}
+	return z, nil
+}
+
+func (c *zstdCompressor) Name() string {
+	return ZstdName
+}
+
+func (z *zstdWriter) Write(p []byte) (n int, err error) {
+	n, err = z.Encoder.Write(p)
+	atomic.AddUint64(&wireStats.raw, uint64(n))
+	return
+}
+
+func (z *zstdWriter) Close() error {
+	err := z.Encoder.Close()
+	z.counter.Writer = ioutil.Discard
+	z.pool.Put(z)
+	return err
+}
+
+func (z *zstdReader) Read(p []byte) (n int, err error) {
+	n, err = z.Decoder.Read(p)
+	if err == io.EOF {
+		z.pool.Put(z)
+	}
+	return n, err
+}
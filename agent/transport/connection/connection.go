@@ -1,11 +1,15 @@
 package connection
 
 import (
+	"agent/utils"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/chriskaliX/SDK/util/connection"
@@ -18,6 +22,40 @@ var DebugAddr string
 var DebugPort string
 var EnableCA bool
 
+// endpointMu guards DebugAddr and DebugPort once the agent runs
+var endpointMu sync.RWMutex
+
+// SetEndpoint replaces the address of the server, it takes effect from the
+// next connection. The empty ones are kept.
+func SetEndpoint(addr, port string) {
+	endpointMu.Lock()
+	defer endpointMu.Unlock()
+	if addr != "" {
+		DebugAddr = addr
+	}
+	if port != "" {
+		DebugPort = port
+	}
+}
+
+// Endpoint returns the address of the server in use
+func Endpoint() (addr, port string) {
+	endpointMu.RLock()
+	defer endpointMu.RUnlock()
+	return DebugAddr, DebugPort
+}
+
+// Files of the mutual TLS, the embedded ones are used if they are not set.
+// ServerName is verified against the certificate of the server.
+var (
+	CaFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName = "hades.com"
+)
+
+var errInvalidCA = errors.New("no valid certificate in ca")
+
 var _ connection.INetRetry = (*Grpc)(nil)
 
 // Grpc instance for establish connection with server
@@ -34,6 +72,10 @@ func New(ctx context.Context) (*grpc.ClientConn, error) {
 	if err != nil {
 		return nil, err
 	}
+	// IRetry gives up silently once the context is done
+	if grpcInstance.Conn == nil {
+		return nil, ctx.Err()
+	}
 	return grpcInstance.Conn, nil
 }
 
@@ -65,30 +107,73 @@ func (g *Grpc) Connect() (err error) {
 	return
 }
 
-func (g *Grpc) EnableCA(ca, privkey, cert []byte, svrName string) {
+// EnableCA sets the mutual TLS, the server is verified by ca and the agent
+// presents the cert to it
+func (g *Grpc) EnableCA(ca, privkey, cert []byte, svrName string) error {
 	certPool := x509.NewCertPool()
-	certPool.AppendCertsFromPEM(ca)
-	keyPair, _ := tls.X509KeyPair(cert, privkey)
+	if !certPool.AppendCertsFromPEM(ca) {
+		return errInvalidCA
+	}
+	keyPair, err := tls.X509KeyPair(cert, privkey)
+	if err != nil {
+		return err
+	}
 	g.Options = append(g.Options, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 		Certificates: []tls.Certificate{keyPair},
 		ServerName:   svrName,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
 		RootCAs:      certPool,
+		MinVersion:   tls.VersionTLS12,
 	})), grpc.WithBlock(), grpc.WithTimeout(time.Second*3))
+	return nil
 }
 
 func (g *Grpc) DisableCA() {
 	g.Options = append(g.Options, grpc.WithInsecure())
 }
 
+// init is called on every connect, so the options start over
 func (g *Grpc) init() error {
-	if EnableCA {
-		g.EnableCA(CaCert, ClientKey, ClientCert, "hades.com")
+	g.Options = nil
+	certMu.RLock()
+	enabled := EnableCA
+	certMu.RUnlock()
+	if enabled {
+		ca, key, cert, err := loadCA()
+		if err != nil {
+			return err
+		}
+		if err = g.EnableCA(ca, key, cert, ServerName); err != nil {
+			return err
+		}
 	} else {
 		g.DisableCA()
 	}
-	// Disable retry, let IRetry do the work
-	g.Options = append(g.Options, grpc.WithDisableRetry())
+	// Disable retry, let IRetry do the work. The proxy of utils is used
+	// instead of the one of grpc, which knows the environment only.
+	g.Options = append(g.Options, grpc.WithDisableRetry(), grpc.WithContextDialer(utils.DialContext))
+	endpointMu.RLock()
 	g.Addr = fmt.Sprintf("%s:%s", DebugAddr, DebugPort)
+	endpointMu.RUnlock()
 	return nil
 }
+
+// loadCA reads the files of mutual TLS, or the embedded ones if not set
+func loadCA() (ca, key, cert []byte, err error) {
+	certMu.RLock()
+	defer certMu.RUnlock()
+	if ca, err = readOr(CaFile, CaCert); err != nil {
+		return
+	}
+	if key, err = readOr(KeyFile, ClientKey); err != nil {
+		return
+	}
+	cert, err = readOr(CertFile, ClientCert)
+	return
+}
+
+func readOr(file string, embedded []byte) ([]byte, error) {
+	if file == "" {
+		return embedded, nil
+	}
+	return os.ReadFile(file)
+}
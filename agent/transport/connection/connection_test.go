@@ -0,0 +1,201 @@
+package connection
+
+import (
+	"agent/proto"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues a certificate by parent, or a self-signed ca if parent
+// is nil
+func newTestCert(t *testing.T, serial int64, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// echoServer replies each upload with a task carrying the record count
+type echoServer struct {
+	proto.UnimplementedTransferServer
+}
+
+func (echoServer) Transfer(stream proto.Transfer_TransferServer) error {
+	for {
+		data, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		if err = stream.Send(&proto.Command{Task: &proto.Task{
+			ObjectName: data.GetAgentId(),
+			DataType:   int32(len(data.GetRecords())),
+		}}); err != nil {
+			return err
+		}
+	}
+}
+
+// startTLSServer serves the transfer with mutual TLS, clients must present
+// a certificate issued by ca
+func startTLSServer(t *testing.T, ca *testCert) string {
+	server := newTestCert(t, 2, "hades.com", ca)
+	keyPair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})))
+	proto.RegisterTransferServer(s, echoServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return l.Addr().String()
+}
+
+// useCA points the package to the server and the files of the client
+func useCA(t *testing.T, addr string, ca, client *testCert) {
+	dir := t.TempDir()
+	files := map[*string][]byte{&CaFile: ca.certPEM, &CertFile: client.certPEM, &KeyFile: client.keyPEM}
+	old := []string{DebugAddr, DebugPort, CaFile, CertFile, KeyFile}
+	oldCA := EnableCA
+	t.Cleanup(func() {
+		DebugAddr, DebugPort, CaFile, CertFile, KeyFile = old[0], old[1], old[2], old[3], old[4]
+		EnableCA = oldCA
+	})
+	for ptr, content := range files {
+		f, err := os.CreateTemp(dir, "tls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+		f.Close()
+		*ptr = f.Name()
+	}
+	var err error
+	if DebugAddr, DebugPort, err = net.SplitHostPort(addr); err != nil {
+		t.Fatal(err)
+	}
+	EnableCA = true
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCert(t, 1, "ca", nil)
+	useCA(t, startTLSServer(t, ca), ca, newTestCert(t, 3, "agent", ca))
+	g := &Grpc{}
+	if err := g.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Conn.Close()
+	stream, err := proto.NewTransferClient(g.Conn).Transfer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records go up and tasks come down on the same stream
+	for i := 1; i <= 2; i++ {
+		recs := make([]*proto.Record, i)
+		for j := range recs {
+			recs[j] = &proto.Record{DataType: 1000}
+		}
+		if err = stream.Send(&proto.PackagedData{AgentId: "agent", Records: recs}); err != nil {
+			t.Fatal(err)
+		}
+		cmd, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.GetTask().GetObjectName() != "agent" || cmd.GetTask().GetDataType() != int32(i) {
+			t.Fatalf("unexpected command: %v", cmd)
+		}
+	}
+	// options start over on reconnect
+	if err = g.init(); err != nil || len(g.Options) != 5 {
+		t.Fatalf("options are not reset: %d, %v", len(g.Options), err)
+	}
+}
+
+func TestMutualTLSRejected(t *testing.T) {
+	ca := newTestCert(t, 1, "ca", nil)
+	// issued by another ca, the server rejects it
+	useCA(t, startTLSServer(t, ca), ca, newTestCert(t, 3, "agent", newTestCert(t, 4, "other", nil)))
+	g := &Grpc{}
+	if err := g.Connect(); err == nil {
+		g.Conn.Close()
+		t.Fatal("connected without a trusted client certificate")
+	}
+}
+
+func TestInvalidCA(t *testing.T) {
+	ca := newTestCert(t, 1, "ca", nil)
+	useCA(t, "127.0.0.1:0", ca, newTestCert(t, 3, "agent", ca))
+	if err := os.WriteFile(CaFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Grpc{}).Connect(); err != errInvalidCA {
+		t.Fatalf("expect invalid ca, got %v", err)
+	}
+	CaFile = filepath.Join(t.TempDir(), "missing")
+	if err := (&Grpc{}).Connect(); !os.IsNotExist(err) {
+		t.Fatalf("expect missing file, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package connection
+
+import (
+	"agent/utils"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certMu guards CertFile and KeyFile, which are replaced by the enrollment
+// once the agent runs
+var certMu sync.RWMutex
+
+// the retries of a failed enrollment, doubled from minEnrollRetry up to
+// maxEnrollRetry
+var (
+	minEnrollRetry = 10 * time.Second
+	maxEnrollRetry = 10 * time.Minute
+)
+
+// EnrolledFile keeps the key and the certificate enrolled, in the dir of the
+// enroller
+const EnrolledFile = "agent.pem"
+
+var (
+	errNoCertificate = errors.New("no certificate in the enrollment response")
+	errInsecureURL   = errors.New("enrollment url must be https")
+)
+
+// EnrollURL is the URL of the Enroller of the agent, empty if it's not
+// enrolled. It's set before the agent starts, and kept reachable while the
+// host is contained.
+var EnrollURL string
+
+// Enroller obtains the client certificate of mutual TLS from the server, and
+// renews it before it expires. The agent posts
+//
+//	{"agent_id": "...", "hostname": "...", "csr": "<pem>"}
+//
+// to URL, with "Authorization: Bearer <token>" for the first enrollment, and
+// with the current certificate as the client one of TLS for the renewals.
+// The server replies {"certificate": "<pem>"}, which may be followed by the
+// intermediates. The key is generated on the host and never leaves it, it's
+// kept along with the certificate in EnrolledFile, readable by the owner
+// only. The server is verified as the one of grpc, by CaFile and ServerName.
+type Enroller struct {
+	URL      string
+	Token    string
+	Dir      string
+	AgentID  string
+	Hostname string
+}
+
+type enrollRequest struct {
+	AgentID  string `json:"agent_id"`
+	Hostname string `json:"hostname"`
+	CSR      string `json:"csr"`
+}
+
+type enrollResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+// Validate checks the URL, the token is posted to it, so only https is
+// allowed
+func (e *Enroller) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: %s", errInsecureURL, e.URL)
+	}
+	return nil
+}
+
+// Path returns the file of the key and the certificate
+func (e *Enroller) Path() string { return filepath.Join(e.Dir, EnrolledFile) }
+
+// Run uses the certificate enrolled before, enrolls the agent if there's
+// none, and renews the certificate once a third of its lifetime is left,
+// until ctx is done
+func (e *Enroller) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	current, err := e.Load()
+	if err != nil && !os.IsNotExist(err) {
+		zap.S().Warnf("enrolled certificate is ignored: %s", err)
+	}
+	if current != nil {
+		useCertificate(e.Path())
+	}
+	retry := minEnrollRetry
+	var wait time.Duration
+	for {
+		if current != nil {
+			if wait == 0 {
+				wait = time.Until(renewAt(current))
+			}
+			zap.S().Infof("certificate expires at %s, renewal in %s", current.NotAfter.Format(time.RFC3339), wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		next, err := e.Enroll(ctx, current)
+		if err != nil {
+			zap.S().Errorf("enrollment failed, retry in %s: %s", retry, err)
+			wait = retry
+			if retry *= 2; retry > maxEnrollRetry {
+				retry = maxEnrollRetry
+			}
+			continue
+		}
+		current, retry, wait = next, minEnrollRetry, 0
+		useCertificate(e.Path())
+		zap.S().Infof("certificate is enrolled, serial %s", next.SerialNumber)
+	}
+}
+
+// renewAt is the time a third of the lifetime is left
+func renewAt(cert *x509.Certificate) time.Time {
+	return cert.NotAfter.Add(-cert.NotAfter.Sub(cert.NotBefore) / 3)
+}
+
+// useCertificate points the mutual TLS to the file enrolled, from the next
+// connection
+func useCertificate(path string) {
+	certMu.Lock()
+	defer certMu.Unlock()
+	CertFile, KeyFile = path, path
+	EnableCA = true
+}
+
+// Load returns the certificate enrolled before
+func (e *Enroller) Load() (*x509.Certificate, error) {
+	content, err := os.ReadFile(e.Path())
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair(content, content)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// Enroll obtains a certificate for a new key and stores both of them. It's
+// a renewal by the current certificate if it's not expired yet, or a new
+// enrollment by the token.
+func (e *Enroller) Enroll(ctx context.Context, current *x509.Certificate) (*x509.Certificate, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: e.AgentID},
+		DNSNames: []string{e.Hostname},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(&enrollRequest{
+		AgentID:  e.AgentID,
+		Hostname: e.Hostname,
+		CSR:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	if err != nil {
+		return nil, err
+	}
+	renewal := current != nil && time.Now().Before(current.NotAfter)
+	client, err := e.client(renewal)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if !renewal {
+		if e.Token == "" {
+			return nil, errors.New("enrollment token is not set")
+		}
+		req.Header.Set("Authorization", "Bearer "+e.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrollment is rejected: %s %s", resp.Status, bytes.TrimSpace(content))
+	}
+	reply := &enrollResponse{}
+	if err = json.Unmarshal(content, reply); err != nil {
+		return nil, err
+	}
+	if reply.Certificate == "" {
+		return nil, errNoCertificate
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pemData := append([]byte(reply.Certificate), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	// the certificate must be the one of the key
+	pair, err := tls.X509KeyPair(pemData, pemData)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return cert, e.store(pemData)
+}
+
+// client verifies the server as grpc does, and presents the current
+// certificate for a renewal
+func (e *Enroller) client(renewal bool) (*http.Client, error) {
+	ca, key, cert, err := loadCA()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: ServerName, RootCAs: x509.NewCertPool(), MinVersion: tls.VersionTLS12}
+	if !config.RootCAs.AppendCertsFromPEM(ca) {
+		return nil, errInvalidCA
+	}
+	if renewal {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	client := utils.NewHTTPClient()
+	client.Transport.(*http.Transport).TLSClientConfig = config
+	client.Timeout = time.Minute
+	return client, nil
+}
+
+// store replaces the file at once, the connections never read half of it
+func (e *Enroller) store(content []byte) error {
+	if err := os.MkdirAll(e.Dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(e.Dir, EnrolledFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = f.Chmod(0o600); err == nil {
+		if _, err = f.Write(content); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), e.Path())
+}
+
+// ClientCertificate returns the client certificate of mutual TLS in use, the
+// enrolled one once the agent is enrolled. It's read on every handshake, so
+// the renewals take effect without a restart.
+func ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, key, cert, err := loadCA()
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
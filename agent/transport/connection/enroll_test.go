@@ -0,0 +1,207 @@
+package connection
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// enrollServer signs the csr by ca, for the token or a client certificate
+// issued by ca
+type enrollServer struct {
+	ca       *testCert
+	token    string
+	lifetime time.Duration
+	serial   int64
+	// renewals are the enrollments by the client certificate
+	renewals int64
+}
+
+func (s *enrollServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(r.TLS.PeerCertificates) != 0 {
+		atomic.AddInt64(&s.renewals, 1)
+	} else if r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return
+	}
+	req := &enrollRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		http.Error(w, "no csr", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil || csr.Subject.CommonName != req.AgentID {
+		http.Error(w, "bad csr", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(atomic.AddInt64(&s.serial, 1)),
+		Subject:      csr.Subject,
+		NotBefore:    now,
+		NotAfter:     now.Add(s.lifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, s.ca.cert, csr.PublicKey, s.ca.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(&enrollResponse{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	})
+}
+
+// startEnrollServer points the package to the ca, and returns the enroller
+// of the server
+func startEnrollServer(t *testing.T, s *enrollServer) *Enroller {
+	server := newTestCert(t, 100, "example.com", s.ca)
+	keyPair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca.cert)
+	ts := httptest.NewUnstartedServer(s)
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	useCA(t, "127.0.0.1:0", s.ca, newTestCert(t, 3, "agent", s.ca))
+	CertFile, KeyFile = "", ""
+	oldName := ServerName
+	ServerName = "example.com"
+	t.Cleanup(func() { ServerName = oldName })
+	return &Enroller{URL: ts.URL, Token: "token", Dir: t.TempDir(), AgentID: "agent-id", Hostname: "host"}
+}
+
+func TestEnroll(t *testing.T) {
+	s := &enrollServer{ca: newTestCert(t, 1, "ca", nil), token: "token", lifetime: time.Hour}
+	e := startEnrollServer(t, s)
+	if _, err := e.Load(); !os.IsNotExist(err) {
+		t.Fatalf("expect no certificate, got %v", err)
+	}
+	first, err := e.Enroll(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Subject.CommonName != "agent-id" || atomic.LoadInt64(&s.renewals) != 0 {
+		t.Fatalf("unexpected enrollment: %s, %d renewals", first.Subject, s.renewals)
+	}
+	if info, err := os.Stat(e.Path()); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected file: %v, %v", info, err)
+	}
+	loaded, err := e.Load()
+	if err != nil || !loaded.Equal(first) {
+		t.Fatalf("enrolled certificate is not loaded: %v", err)
+	}
+	useCertificate(e.Path())
+	// the renewal presents the enrolled certificate, without the token
+	e.Token = ""
+	second, err := e.Enroll(context.Background(), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SerialNumber.Cmp(first.SerialNumber) == 0 || atomic.LoadInt64(&s.renewals) != 1 {
+		t.Fatalf("certificate is not renewed: %s, %d renewals", second.SerialNumber, s.renewals)
+	}
+	pair, err := ClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := x509.ParseCertificate(pair.Certificate[0]); !leaf.Equal(second) {
+		t.Fatal("renewed certificate is not in use")
+	}
+}
+
+func TestEnrollRejected(t *testing.T) {
+	s := &enrollServer{ca: newTestCert(t, 1, "ca", nil), token: "token", lifetime: time.Hour}
+	e := startEnrollServer(t, s)
+	e.Token = "wrong"
+	if _, err := e.Enroll(context.Background(), nil); err == nil {
+		t.Fatal("enrolled by a wrong token")
+	}
+	if _, err := os.Stat(e.Path()); !os.IsNotExist(err) {
+		t.Fatalf("certificate is stored on failure: %v", err)
+	}
+	// an expired certificate falls back to the token
+	expired := &x509.Certificate{NotBefore: time.Now().Add(-2 * time.Hour), NotAfter: time.Now().Add(-time.Hour)}
+	e.Token = ""
+	if _, err := e.Enroll(context.Background(), expired); err == nil {
+		t.Fatal("enrolled without the token")
+	}
+}
+
+func TestEnrollInsecureURL(t *testing.T) {
+	var posted int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&posted, 1)
+	}))
+	defer ts.Close()
+	e := &Enroller{URL: ts.URL, Token: "token", Dir: t.TempDir(), AgentID: "agent-id", Hostname: "host"}
+	for _, u := range []string{ts.URL, "https://", "https//host/enroll"} {
+		e.URL = u
+		if err := e.Validate(); !errors.Is(err, errInsecureURL) {
+			t.Fatalf("%s: expect insecure url, got %v", u, err)
+		}
+	}
+	e.URL = ts.URL
+	if _, err := e.Enroll(context.Background(), nil); !errors.Is(err, errInsecureURL) {
+		t.Fatalf("expect insecure url, got %v", err)
+	}
+	if atomic.LoadInt32(&posted) != 0 {
+		t.Fatal("token is posted over http")
+	}
+}
+
+func TestEnrollRun(t *testing.T) {
+	s := &enrollServer{ca: newTestCert(t, 1, "ca", nil), token: "token", lifetime: 1500 * time.Millisecond}
+	e := startEnrollServer(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go e.Run(ctx, wg)
+	// renewed once a third of the lifetime is left, every second
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt64(&s.renewals) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+	if atomic.LoadInt64(&s.renewals) < 2 {
+		t.Fatalf("certificate is not renewed: %d renewals", s.renewals)
+	}
+	certMu.RLock()
+	defer certMu.RUnlock()
+	if !EnableCA || CertFile != e.Path() || KeyFile != e.Path() {
+		t.Fatalf("enrolled certificate is not in use: %v %s %s", EnableCA, CertFile, KeyFile)
+	}
+}
+
+func TestRenewAt(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(90 * 24 * time.Hour)}
+	if got := renewAt(cert); !got.Equal(now.Add(60 * 24 * time.Hour)) {
+		t.Fatalf("unexpected renewal: %s", got)
+	}
+}
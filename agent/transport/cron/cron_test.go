@@ -0,0 +1,42 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2024, 2, 28, 22, 30, 15, 0, time.UTC)
+	for spec, expect := range map[string]time.Time{
+		"* * * * *":        time.Date(2024, 2, 28, 22, 31, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2024, 2, 28, 22, 45, 0, 0, time.UTC),
+		"0 3 * * *":        time.Date(2024, 2, 29, 3, 0, 0, 0, time.UTC),
+		"@hourly":          time.Date(2024, 2, 28, 23, 0, 0, 0, time.UTC),
+		"@monthly":         time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"0 9 * * 1-5":      time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":        time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"5,50 1-5/2 * * *": time.Date(2024, 2, 29, 1, 5, 0, 0, time.UTC),
+		// never
+		"0 0 30 2 *": {},
+		// either of the days once both are restricted
+		"0 0 13 * 5": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Errorf("%s: %s", spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(expect) {
+			t.Errorf("%s: expect %s, got %s", spec, expect, got)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q should be invalid", spec)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package transport
+
+import (
+	"agent/proto"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formatter serializes the records for the sinks, in place of json
+type Formatter interface {
+	Format(rec *proto.Record) ([]byte, error)
+}
+
+// FormatterFactory creates the formatter by the options of the sink
+type FormatterFactory func(options map[string]string) (Formatter, error)
+
+var (
+	formatMu       sync.RWMutex
+	formatterTypes = map[string]FormatterFactory{
+		"cef":  newCEFFormatter,
+		"leef": newLEEFFormatter,
+	}
+)
+
+// RegisterFormatter adds the formatter, which the option formatter of the
+// sinks refers to
+func RegisterFormatter(name string, factory FormatterFactory) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	formatterTypes[name] = factory
+}
+
+// recordFormat is the format of the records in a sink, options: formatter,
+// json if not set, or cef and leef with the mapping file in mapping
+type recordFormat struct {
+	formatter Formatter
+}
+
+func newRecordFormat(options map[string]string) (f recordFormat, err error) {
+	name := options["formatter"]
+	if name == "" || name == "json" {
+		return
+	}
+	formatMu.RLock()
+	factory, ok := formatterTypes[name]
+	formatMu.RUnlock()
+	if !ok {
+		return f, fmt.Errorf("formatter %s is not supported", name)
+	}
+	f.formatter, err = factory(options)
+	return
+}
+
+func (f recordFormat) isJSON() bool { return f.formatter == nil }
+
+// format returns the record in json as is, or decodes it if rec is nil and
+// formats it
+func (f recordFormat) format(rec *proto.Record, data []byte) ([]byte, error) {
+	if f.formatter == nil {
+		return data, nil
+	}
+	if rec == nil {
+		rec = &proto.Record{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, err
+		}
+	}
+	return f.formatter.Format(rec)
+}
+
+// FormatMapping is the mapping file of the cef and leef formatters, like:
+//
+//	vendor: Hades
+//	product: hades-agent
+//	version: "1.0"
+//	types:
+//	  700:
+//	    event_id: process-exec
+//	    name: Process executed
+//	    severity: 3
+//	    fields:
+//	      exe: filePath
+//	      argv: cs1
+//	      pid: spid
+//	    static:
+//	      cs1Label: argv
+//	  6001:
+//	    severity_field: level
+//	    unmapped: true
+//
+// The fields of a record are mapped by the one of its data type, they are
+// renamed to the keys of the format by fields, and the ones not mapped are
+// dropped unless unmapped is set. Static keys are added to each record. The
+// event id is the data type, and the name is "data_type <N>" if not set.
+// Records of the data types not in it keep all their fields.
+type FormatMapping struct {
+	Vendor  string                 `yaml:"vendor"`
+	Product string                 `yaml:"product"`
+	Version string                 `yaml:"version"`
+	Types   map[int32]*TypeMapping `yaml:"types"`
+}
+
+// TypeMapping maps the records of a data type. The severity is 0-10, the
+// one in severity_field is used if it's valid, and it's 5 if neither is set.
+type TypeMapping struct {
+	EventID       string            `yaml:"event_id"`
+	Name          string            `yaml:"name"`
+	Severity      *int              `yaml:"severity"`
+	SeverityField string            `yaml:"severity_field"`
+	Fields        map[string]string `yaml:"fields"`
+	Static        map[string]string `yaml:"static"`
+	Unmapped      bool              `yaml:"unmapped"`
+}
+
+const defaultFormatSeverity = 5
+
+// loadFormatMapping reads the mapping file, the default one is used if path
+// is empty
+func loadFormatMapping(path string) (*FormatMapping, error) {
+	m := &FormatMapping{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(data, m); err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", path, err)
+		}
+	}
+	if m.Vendor == "" {
+		m.Vendor = "Hades"
+	}
+	if m.Product == "" {
+		m.Product = "hades-agent"
+	}
+	if m.Version == "" {
+		m.Version = "1.0"
+	}
+	for dt, t := range m.Types {
+		if t == nil {
+			return nil, fmt.Errorf("mapping of data type %d is empty", dt)
+		}
+		if t.Severity != nil && (*t.Severity < 0 || *t.Severity > 10) {
+			return nil, fmt.Errorf("severity of data type %d is out of 0-10", dt)
+		}
+	}
+	return m, nil
+}
+
+// mappedRecord is the record mapped for a format
+type mappedRecord struct {
+	eventID  string
+	name     string
+	severity int
+	// key value pairs sorted by the keys
+	pairs [][2]string
+}
+
+// mapRecord maps the record, the fields not mapped keep the letters and
+// digits of their names as the keys
+func (m *FormatMapping) mapRecord(rec *proto.Record) *mappedRecord {
+	t := m.Types[rec.GetDataType()]
+	if t == nil {
+		t = &TypeMapping{Unmapped: true}
+	}
+	r := &mappedRecord{eventID: t.EventID, name: t.Name, severity: defaultFormatSeverity}
+	if r.eventID == "" {
+		r.eventID = strconv.Itoa(int(rec.GetDataType()))
+	}
+	if r.name == "" {
+		r.name = "data_type " + strconv.Itoa(int(rec.GetDataType()))
+	}
+	if t.Severity != nil {
+		r.severity = *t.Severity
+	}
+	fields := rec.GetData().GetFields()
+	if t.SeverityField != "" {
+		if n, err := strconv.Atoi(fields[t.SeverityField]); err == nil && n >= 0 && n <= 10 {
+			r.severity = n
+		}
+	}
+	for name, value := range fields {
+		if k, ok := t.Fields[name]; ok {
+			r.pairs = append(r.pairs, [2]string{k, value})
+		} else if t.Unmapped {
+			r.pairs = append(r.pairs, [2]string{alnumKey(name), value})
+		}
+	}
+	for k, value := range t.Static {
+		r.pairs = append(r.pairs, [2]string{k, value})
+	}
+	sort.Slice(r.pairs, func(i, j int) bool { return r.pairs[i][0] < r.pairs[j][0] })
+	return r
+}
+
+// alnumKey keeps the chars of the keys of cef and leef
+func alnumKey(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		}
+	}
+	if b.Len() == 0 {
+		return "field"
+	}
+	return b.String()
+}
+
+// escapeHeader escapes the pipes and backslashes of the header fields of
+// cef and leef, which are in a line
+var escapeHeader = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+
+// cefFormatter formats the records in ArcSight CEF, as
+//
+//	CEF:0|Vendor|Product|Version|EventID|Name|Severity|rt=<ms> cat=<plugin> key=value ...
+//
+// options: mapping, the path of FormatMapping
+type cefFormatter struct {
+	mapping *FormatMapping
+}
+
+var escapeCEFValue = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+func newCEFFormatter(options map[string]string) (Formatter, error) {
+	m, err := loadFormatMapping(options["mapping"])
+	if err != nil {
+		return nil, err
+	}
+	return &cefFormatter{mapping: m}, nil
+}
+
+func (f *cefFormatter) Format(rec *proto.Record) ([]byte, error) {
+	r := f.mapping.mapRecord(rec)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CEF:0|%s|%s|%s|%s|%s|%d|rt=%d", escapeHeader.Replace(f.mapping.Vendor),
+		escapeHeader.Replace(f.mapping.Product), escapeHeader.Replace(f.mapping.Version),
+		escapeHeader.Replace(r.eventID), escapeHeader.Replace(r.name), r.severity, rec.GetTimestamp()*1000)
+	if rec.GetPlugin() != "" {
+		buf.WriteString(" cat=")
+		buf.WriteString(escapeCEFValue.Replace(rec.GetPlugin()))
+	}
+	for _, pair := range r.pairs {
+		buf.WriteByte(' ')
+		buf.WriteString(pair[0])
+		buf.WriteByte('=')
+		buf.WriteString(escapeCEFValue.Replace(pair[1]))
+	}
+	return buf.Bytes(), nil
+}
+
+// leefFormatter formats the records in QRadar LEEF 2.0, the attributes are
+// delimited by tabs, as
+//
+//	LEEF:2.0|Vendor|Product|Version|EventID|x09|devTime=<ms>	cat=<plugin>	sev=<severity>	key=value ...
+//
+// options: mapping, the path of FormatMapping. LEEF has no escape of the
+// delimiter, the tabs and newlines in the values are replaced by spaces.
+type leefFormatter struct {
+	mapping *FormatMapping
+}
+
+var escapeLEEFValue = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func newLEEFFormatter(options map[string]string) (Formatter, error) {
+	m, err := loadFormatMapping(options["mapping"])
+	if err != nil {
+		return nil, err
+	}
+	return &leefFormatter{mapping: m}, nil
+}
+
+func (f *leefFormatter) Format(rec *proto.Record) ([]byte, error) {
+	r := f.mapping.mapRecord(rec)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "LEEF:2.0|%s|%s|%s|%s|x09|devTime=%d", escapeHeader.Replace(f.mapping.Vendor),
+		escapeHeader.Replace(f.mapping.Product), escapeHeader.Replace(f.mapping.Version),
+		escapeHeader.Replace(r.eventID), rec.GetTimestamp()*1000)
+	if rec.GetPlugin() != "" {
+		buf.WriteString("\tcat=")
+		buf.WriteString(escapeLEEFValue.Replace(rec.GetPlugin()))
+	}
+	// the severity of leef is 1-10
+	sev := r.severity
+	if sev == 0 {
+		sev = 1
+	}
+	fmt.Fprintf(&buf, "\tsev=%d", sev)
+	if r.name != "" {
+		buf.WriteString("\tname=")
+		buf.WriteString(escapeLEEFValue.Replace(r.name))
+	}
+	for _, pair := range r.pairs {
+		buf.WriteByte('\t')
+		buf.WriteString(pair[0])
+		buf.WriteByte('=')
+		buf.WriteString(escapeLEEFValue.Replace(pair[1]))
+	}
+	return buf.Bytes(), nil
+}
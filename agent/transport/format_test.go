@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMapping = `
+vendor: Acme
+types:
+  700:
+    event_id: process-exec
+    name: Process|executed
+    severity: 3
+    severity_field: level
+    fields:
+      exe: filePath
+      argv: cs1
+    static:
+      cs1Label: argv
+`
+
+func writeMapping(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mapping.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func formatRecord(dataType int32, fields map[string]string) *proto.Record {
+	return &proto.Record{DataType: dataType, Timestamp: 1700000000, Plugin: "collector", Data: &proto.Payload{Fields: fields}}
+}
+
+func TestCEF(t *testing.T) {
+	f, err := newCEFFormatter(map[string]string{"mapping": writeMapping(t, testMapping)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		rec  *proto.Record
+		want string
+	}{
+		{
+			formatRecord(700, map[string]string{"exe": "/bin/sh", "argv": "sh -c a=b\\c\nd", "pid": "42", "level": "8"}),
+			`CEF:0|Acme|hades-agent|1.0|process-exec|Process\|executed|8|rt=1700000000000 cat=collector cs1=sh -c a\=b\\c\nd cs1Label=argv filePath=/bin/sh`,
+		},
+		{
+			// all the fields are kept without the mapping of the data type
+			formatRecord(1001, map[string]string{"file.path": "/etc/passwd", "op": "write"}),
+			`CEF:0|Acme|hades-agent|1.0|1001|data_type 1001|5|rt=1700000000000 cat=collector filepath=/etc/passwd op=write`,
+		},
+	} {
+		got, err := f.Format(c.rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("unexpected cef:\n%s\n%s", got, c.want)
+		}
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	f, err := newLEEFFormatter(map[string]string{"mapping": writeMapping(t, testMapping)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Format(formatRecord(700, map[string]string{"exe": "/bin/sh", "argv": "sh\t-c\nid", "level": "0"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "LEEF:2.0|Acme|hades-agent|1.0|process-exec|x09|devTime=1700000000000\tcat=collector\tsev=1\tname=Process|executed\tcs1=sh -c id\tcs1Label=argv\tfilePath=/bin/sh"
+	if string(got) != want {
+		t.Errorf("unexpected leef:\n%q\n%q", got, want)
+	}
+}
+
+func TestFormatMapping(t *testing.T) {
+	for _, content := range []string{
+		"types:\n  700:\n    severity: 11\n",
+		"types:\n  700:\n    fieldz: {}\n",
+		"types:\n  700:\n",
+		"vendor: [",
+	} {
+		if _, err := newCEFFormatter(map[string]string{"mapping": writeMapping(t, content)}); err == nil {
+			t.Errorf("mapping should be invalid: %q", content)
+		}
+	}
+	if _, err := newCEFFormatter(map[string]string{"mapping": filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("missing mapping file is loaded")
+	}
+	if _, err := newRecordFormat(map[string]string{"formatter": "xml"}); err == nil {
+		t.Error("unknown formatter is accepted")
+	}
+	if _, err := newHTTPSink(map[string]string{"url": "http://127.0.0.1", "format": "kafka", "formatter": "cef"}); err == nil {
+		t.Error("kafka takes cef")
+	}
+}
+
+func TestFileSinkFormatter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.cef")
+	sink, err := newFileSink(map[string]string{"path": path, "formatter": "cef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(formatRecord(700, map[string]string{"exe": "/bin/sh"}))
+	if err = sink.Write([][]byte{data, data}); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := "CEF:0|Hades|hades-agent|1.0|700|data_type 700|5|rt=1700000000000 cat=collector exe=/bin/sh\n"
+	if string(content) != strings.Repeat(line, 2) {
+		t.Fatalf("unexpected content:\n%s", content)
+	}
+}
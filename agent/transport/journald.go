@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"agent/proto"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldSink sends the records to journald by the native protocol,
+// options:
+//
+//   - socket: /run/systemd/journal/socket if not set
+//   - identifier: SYSLOG_IDENTIFIER, hades-agent if not set
+//   - prefix: the prefix of the fields mapped, HADES_ if not set
+//
+// and the ones of fieldMapping. The names of the fields are upper cased, and
+// the chars other than letters, digits and underscores are replaced. The
+// data type and the plugin are in HADES_DATA_TYPE and HADES_PLUGIN. A record
+// larger than a datagram fails.
+type journaldSink struct {
+	conn       *net.UnixConn
+	identifier string
+	prefix     string
+	mapping    fieldMapping
+}
+
+func newJournaldSink(options map[string]string) (Sink, error) {
+	s := &journaldSink{identifier: options["identifier"], prefix: "HADES_"}
+	if s.identifier == "" {
+		s.identifier = "hades-agent"
+	}
+	if prefix, ok := options["prefix"]; ok {
+		s.prefix = journalName(prefix, "")
+	}
+	var err error
+	if s.mapping, err = newFieldMapping(options); err != nil {
+		return nil, err
+	}
+	path := options["socket"]
+	if path == "" {
+		path = journalSocket
+	}
+	if s.conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *journaldSink) Write(batch [][]byte) error {
+	var buf bytes.Buffer
+	for _, data := range batch {
+		rec := &proto.Record{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := s.format(&buf, rec, data); err != nil {
+			return err
+		}
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *journaldSink) format(buf *bytes.Buffer, rec *proto.Record, data []byte) error {
+	msg, err := s.mapping.message(rec, data)
+	if err != nil {
+		return err
+	}
+	writeJournalField(buf, "MESSAGE", msg)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(s.mapping.severityOf(rec)))
+	writeJournalField(buf, "SYSLOG_IDENTIFIER", s.identifier)
+	writeJournalField(buf, "HADES_DATA_TYPE", strconv.Itoa(int(rec.GetDataType())))
+	if rec.GetPlugin() != "" {
+		writeJournalField(buf, "HADES_PLUGIN", rec.GetPlugin())
+	}
+	s.mapping.each(rec, func(name, value string) {
+		writeJournalField(buf, journalName(name, s.prefix), value)
+	})
+	return nil
+}
+
+// journalName makes the name of a field, which is upper case letters,
+// digits and underscores up to 64 chars, and starts with a letter
+func journalName(name, prefix string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			c = '_'
+		}
+		if b.Len() == 0 && (c < 'A' || c > 'Z') {
+			b.WriteString("F_")
+		}
+		b.WriteByte(c)
+	}
+	s := b.String()
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
+
+// writeJournalField writes NAME=value, or the binary form if the value has
+// a newline
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (s *journaldSink) Close() error { return s.conn.Close() }
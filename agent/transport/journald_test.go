@@ -0,0 +1,96 @@
+//go:build !windows
+
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parseJournal decodes the datagram of the native protocol
+func parseJournal(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) != 0 {
+		line := bytes.IndexByte(data, '\n')
+		if line < 0 {
+			t.Fatalf("unterminated field: %q", data)
+		}
+		if eq := bytes.IndexByte(data[:line], '='); eq >= 0 {
+			fields[string(data[:eq])] = string(data[eq+1 : line])
+			data = data[line+1:]
+			continue
+		}
+		name := string(data[:line])
+		data = data[line+1:]
+		size := binary.LittleEndian.Uint64(data)
+		fields[name] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := newJournaldSink(map[string]string{
+		"socket": path, "fields": "exe,argv,pid:process.id", "severity_field": "level", "message_field": "argv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	rec, data := syslogRecord(t)
+	rec.Data.Fields["argv"] = "sh -c 'echo\nhi'"
+	if data, err = json.Marshal(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write([][]byte{data}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournal(t, buf[:n])
+	for name, value := range map[string]string{
+		"MESSAGE":           "sh -c 'echo\nhi'",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "hades-agent",
+		"HADES_DATA_TYPE":   "700",
+		"HADES_PLUGIN":      "collector",
+		"HADES_EXE":         "/bin/sh",
+		"HADES_ARGV":        "sh -c 'echo\nhi'",
+		"HADES_PROCESS_ID":  "42",
+	} {
+		if fields[name] != value {
+			t.Errorf("%s is %q, not %q", name, fields[name], value)
+		}
+	}
+	if len(fields) != 8 {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+}
+
+func TestJournalName(t *testing.T) {
+	for _, c := range [][3]string{
+		{"exe", "HADES_", "HADES_EXE"},
+		{"process.id", "", "PROCESS_ID"},
+		{"1st", "", "F_1ST"},
+		{"_id", "", "F__ID"},
+	} {
+		if got := journalName(c[0], c[1]); got != c[2] {
+			t.Errorf("name of %s is %s, not %s", c[0], got, c[2])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"agent/conf"
+	"agent/proto"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// LabelPolicy is pushed by the server in the task of TaskAgentLabels, like:
+//
+//	{"labels": {"tenant": "payments", "env": "prod"}}
+//
+// The labels replace the ones pushed before, and are merged with the local
+// ones of the config file, the server wins on the same key. All of them are
+// attached to every record of the agent, so the server scopes the policies
+// by them. An empty policy removes the ones of the server.
+type LabelPolicy struct {
+	Labels map[string]string `json:"labels"`
+}
+
+var (
+	// labelMu guards serverLabels and the merge
+	labelMu      sync.Mutex
+	serverLabels map[string]string
+	// map[string]string in use, shared by the records, so it's never
+	// modified once it's stored
+	labels atomic.Value
+)
+
+// SetServerLabels parses the policy in json and replaces the labels pushed
+// by the server
+func SetServerLabels(data string) error {
+	policy := &LabelPolicy{}
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return err
+	}
+	if err := conf.ValidateLabels(policy.Labels); err != nil {
+		return err
+	}
+	labelMu.Lock()
+	defer labelMu.Unlock()
+	serverLabels = policy.Labels
+	mergeLabels()
+	return nil
+}
+
+// ReloadLabels takes the local labels of the config in use, it's called
+// once the config is set
+func ReloadLabels() {
+	labelMu.Lock()
+	defer labelMu.Unlock()
+	mergeLabels()
+}
+
+// mergeLabels must be called with labelMu held
+func mergeLabels() {
+	local := conf.Current().Labels
+	merged := make(map[string]string, len(local)+len(serverLabels))
+	for k, v := range local {
+		merged[k] = v
+	}
+	for k, v := range serverLabels {
+		merged[k] = v
+	}
+	// bounded again, the union may be over it
+	if len(merged) > conf.MaxLabels {
+		zap.S().Warnf("%d labels are more than %d, the local ones are ignored", len(merged), conf.MaxLabels)
+		merged = serverLabels
+	}
+	labels.Store(merged)
+	zap.S().Infof("labels are set: %v", merged)
+}
+
+// Labels returns the labels in use, which must not be modified
+func Labels() map[string]string {
+	l, _ := labels.Load().(map[string]string)
+	return l
+}
+
+// stampLabels overwrites the labels of the record, so a plugin can't forge
+// them. The record gets its own copy, since the pooled ones are decoded into
+// the map again.
+func stampLabels(rec *proto.Record) {
+	l := Labels()
+	if len(l) == 0 {
+		rec.Labels = nil
+		return
+	}
+	if rec.Labels == nil {
+		rec.Labels = make(map[string]string, len(l))
+	}
+	for k := range rec.Labels {
+		delete(rec.Labels, k)
+	}
+	for k, v := range l {
+		rec.Labels[k] = v
+	}
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"agent/conf"
+	"agent/proto"
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	defer func() {
+		conf.Set(&conf.File{})
+		SetServerLabels(`{}`)
+	}()
+	conf.Set(&conf.File{Labels: map[string]string{"env": "staging", "team": "payments"}})
+	ReloadLabels()
+	if err := SetServerLabels(`{"labels": {"env": "prod", "tenant": "acme"}}`); err != nil {
+		t.Fatal(err)
+	}
+	transfer := NewTransfer()
+	// the ones forged by the plugin are overwritten
+	transfer.Transmission(&proto.Record{DataType: 1000, Labels: map[string]string{"tenant": "other"}}, false)
+	transfer.TransmitAgent(&proto.Record{DataType: 1}, false)
+	for _, rec := range transfer.buf[:transfer.offset] {
+		// the server wins on the same key
+		if len(rec.Labels) != 3 || rec.Labels["env"] != "prod" || rec.Labels["team"] != "payments" || rec.Labels["tenant"] != "acme" {
+			t.Fatalf("unexpected labels: %v", rec.Labels)
+		}
+		// each record has its own copy
+		rec.Labels["forged"] = "x"
+	}
+	if _, ok := Labels()["forged"]; ok {
+		t.Fatalf("labels in use are modified by a record: %v", Labels())
+	}
+	// invalid ones keep the labels in use
+	for _, data := range []string{`{"labels": {"": "x"}}`, `{"labels": {"env": "` + strings.Repeat("x", conf.MaxLabelValueBytes+1) + `"}}`, `[]`} {
+		if err := SetServerLabels(data); err == nil {
+			t.Errorf("%s should be invalid", data)
+		}
+	}
+	if Labels()["tenant"] != "acme" {
+		t.Fatalf("labels are replaced by invalid ones: %v", Labels())
+	}
+	// removed by an empty policy
+	if err := SetServerLabels(`{}`); err != nil {
+		t.Fatal(err)
+	}
+	if l := Labels(); len(l) != 2 || l["env"] != "staging" {
+		t.Fatalf("unexpected labels: %v", l)
+	}
+}
@@ -0,0 +1,332 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+// otlpExport is the method of the logs service of OTLP/gRPC
+const otlpExport = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+const otlpTimeout = 10 * time.Second
+
+// the severity numbers of OpenTelemetry, by the severities of syslog
+var otlpSeverities = []uint64{21, 19, 18, 17, 13, 10, 9, 5}
+
+// otlpSink exports the records as the log records of OpenTelemetry by
+// OTLP/gRPC, options:
+//
+//   - endpoint: host:port of the collector
+//   - insecure: "true" for plaintext, tls is verified by ca_file and
+//     server_name otherwise
+//   - headers: comma separated key=value, sent with each export, as the
+//     token of the backend
+//   - compression: gzip or none by default
+//   - service_name: service.name of the resource, hades-agent if not set
+//
+// and the ones of fieldMapping, the message is the body. The records are
+// grouped by the plugin, the resource is of the host, the agent and the
+// plugin. The fields mapped are the attributes, with hades.data_type.
+type otlpSink struct {
+	conn     *grpc.ClientConn
+	headers  metadata.MD
+	gzip     bool
+	service  string
+	hostname string
+	mapping  fieldMapping
+}
+
+func newOTLPSink(options map[string]string) (Sink, error) {
+	endpoint := options["endpoint"]
+	if endpoint == "" {
+		return nil, errors.New("endpoint of otlp sink is not set")
+	}
+	s := &otlpSink{headers: metadata.MD{}, service: options["service_name"]}
+	if s.service == "" {
+		s.service = agent.Product
+	}
+	s.hostname, _ = os.Hostname()
+	var err error
+	if s.mapping, err = newFieldMapping(options); err != nil {
+		return nil, err
+	}
+	for _, header := range strings.Split(options["headers"], ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		i := strings.IndexByte(header, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %s", header)
+		}
+		s.headers.Append(strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:]))
+	}
+	switch options["compression"] {
+	case "", "none":
+	case "gzip":
+		s.gzip = true
+	default:
+		return nil, fmt.Errorf("compression %s of otlp sink is not supported", options["compression"])
+	}
+	opts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{}))}
+	if options["insecure"] == "true" {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		config, err := sinkTLSConfig(endpoint, options)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	}
+	// it connects in the background, the exports fail until it's connected
+	if s.conn, err = grpc.Dial(endpoint, opts...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *otlpSink) Write(batch [][]byte) error {
+	req, err := s.request(batch, time.Now())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	if len(s.headers) != 0 {
+		ctx = metadata.NewOutgoingContext(ctx, s.headers)
+	}
+	var callOpts []grpc.CallOption
+	if s.gzip {
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+	var resp []byte
+	if err = s.conn.Invoke(ctx, otlpExport, &req, &resp, callOpts...); err != nil {
+		return err
+	}
+	if rejected, msg := partialSuccess(resp); rejected != 0 {
+		zap.S().Warnf("otlp sink: %d records are rejected: %s", rejected, msg)
+	}
+	return nil
+}
+
+// request encodes the ExportLogsServiceRequest of the batch
+func (s *otlpSink) request(batch [][]byte, now time.Time) ([]byte, error) {
+	// log records by the plugin
+	byPlugin := map[string][]byte{}
+	for _, data := range batch {
+		rec := &proto.Record{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, err
+		}
+		logRecord, err := s.logRecord(rec, data, now)
+		if err != nil {
+			return nil, err
+		}
+		byPlugin[rec.GetPlugin()] = appendBytesField(byPlugin[rec.GetPlugin()], 2, logRecord)
+	}
+	plugins := make([]string, 0, len(byPlugin))
+	for plugin := range byPlugin {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	var req []byte
+	for _, plugin := range plugins {
+		var resource []byte
+		resource = appendBytesField(resource, 1, stringAttribute("host.name", s.hostname))
+		resource = appendBytesField(resource, 1, stringAttribute("host.id", agent.Instance.ID))
+		resource = appendBytesField(resource, 1, stringAttribute("service.name", s.service))
+		resource = appendBytesField(resource, 1, stringAttribute("service.version", agent.Version))
+		if plugin != "" {
+			resource = appendBytesField(resource, 1, stringAttribute("hades.plugin", plugin))
+		}
+		var scope []byte
+		scope = appendStringField(scope, 1, agent.Product)
+		scope = appendStringField(scope, 2, agent.Version)
+		scopeLogs := appendBytesField(nil, 1, scope)
+		scopeLogs = append(scopeLogs, byPlugin[plugin]...)
+		var resourceLogs []byte
+		resourceLogs = appendBytesField(resourceLogs, 1, resource)
+		resourceLogs = appendBytesField(resourceLogs, 2, scopeLogs)
+		req = appendBytesField(req, 1, resourceLogs)
+	}
+	return req, nil
+}
+
+// logRecord encodes the LogRecord of the record
+func (s *otlpSink) logRecord(rec *proto.Record, data []byte, now time.Time) ([]byte, error) {
+	body, err := s.mapping.message(rec, data)
+	if err != nil {
+		return nil, err
+	}
+	severity := s.mapping.severityOf(rec)
+	var b []byte
+	if rec.GetTimestamp() != 0 {
+		b = appendFixed64Field(b, 1, uint64(rec.GetTimestamp())*uint64(time.Second))
+	}
+	b = appendVarintField(b, 2, otlpSeverities[severity])
+	b = appendStringField(b, 3, severities[severity])
+	b = appendBytesField(b, 5, appendStringField(nil, 1, body))
+	b = appendBytesField(b, 6, intAttribute("hades.data_type", int64(rec.GetDataType())))
+	s.mapping.each(rec, func(name, value string) {
+		b = appendBytesField(b, 6, stringAttribute(name, value))
+	})
+	// labels of the agent, in order
+	keys := make([]string, 0, len(rec.GetLabels()))
+	for k := range rec.GetLabels() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = appendBytesField(b, 6, stringAttribute("hades.label."+k, rec.Labels[k]))
+	}
+	b = appendFixed64Field(b, 11, uint64(now.UnixNano()))
+	return b, nil
+}
+
+func (s *otlpSink) Close() error { return s.conn.Close() }
+
+// partialSuccess decodes the rejected records and the message of the
+// ExportLogsServiceResponse, they are zero if it's malformed
+func partialSuccess(resp []byte) (rejected int64, msg string) {
+	partial := lastBytesField(resp, 1)
+	for len(partial) != 0 {
+		key, n := binary.Uvarint(partial)
+		if n <= 0 {
+			return
+		}
+		partial = partial[n:]
+		switch key {
+		case 1<<3 | 0:
+			v, n := binary.Uvarint(partial)
+			if n <= 0 {
+				return
+			}
+			rejected, partial = int64(v), partial[n:]
+		case 2<<3 | 2:
+			size, n := binary.Uvarint(partial)
+			if n <= 0 || uint64(len(partial)-n) < size {
+				return
+			}
+			msg, partial = string(partial[n:n+int(size)]), partial[n+int(size):]
+		default:
+			return
+		}
+	}
+	return
+}
+
+// lastBytesField returns the last field num of the message in wire type 2,
+// the others are skipped
+func lastBytesField(b []byte, num uint64) (field []byte) {
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil
+		}
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil
+			}
+			b = b[size:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil
+			}
+			if key>>3 == num {
+				field = b[n : n+int(size)]
+			}
+			b = b[n+int(size):]
+		default:
+			return nil
+		}
+	}
+	return
+}
+
+// the protobuf wire encoding of the messages of OTLP, which are not
+// generated to keep the dependency on OpenTelemetry out
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarintField(b []byte, num, v uint64) []byte {
+	return appendVarint(appendVarint(b, num<<3|0), v)
+}
+
+func appendFixed64Field(b []byte, num, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(appendVarint(b, num<<3|1), buf[:]...)
+}
+
+func appendBytesField(b []byte, num uint64, v []byte) []byte {
+	return append(appendVarint(appendVarint(b, num<<3|2), uint64(len(v))), v...)
+}
+
+func appendStringField(b []byte, num uint64, v string) []byte {
+	return append(appendVarint(appendVarint(b, num<<3|2), uint64(len(v))), v...)
+}
+
+// stringAttribute encodes the KeyValue with the string value
+func stringAttribute(key, value string) []byte {
+	return appendBytesField(appendStringField(nil, 1, key), 2, appendStringField(nil, 1, value))
+}
+
+// intAttribute encodes the KeyValue with the int value
+func intAttribute(key string, value int64) []byte {
+	return appendBytesField(appendStringField(nil, 1, key), 2, appendVarintField(nil, 3, uint64(value)))
+}
+
+// rawCodec passes the messages encoded already, the name is proto for the
+// content type of the collectors
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec: unexpected message %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec: unexpected message %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
+
+var _ encoding.Codec = rawCodec{}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type wireField struct {
+	num   uint64
+	value uint64
+	bytes []byte
+}
+
+// wireFields decodes the fields of the message, the varints and fixed64 are
+// in value
+func wireFields(t *testing.T, b []byte) (fields []wireField) {
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		f := wireField{num: key >> 3}
+		switch key & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type of %d", key)
+		}
+		fields = append(fields, f)
+	}
+	return
+}
+
+func fieldsOf(t *testing.T, b []byte, num uint64) (found []wireField) {
+	for _, f := range wireFields(t, b) {
+		if f.num == num {
+			found = append(found, f)
+		}
+	}
+	return
+}
+
+// attributes decodes the KeyValues of the string and int values
+func attributes(t *testing.T, kvs []wireField) map[string]interface{} {
+	attrs := map[string]interface{}{}
+	for _, kv := range kvs {
+		key := string(fieldsOf(t, kv.bytes, 1)[0].bytes)
+		value := wireFields(t, fieldsOf(t, kv.bytes, 2)[0].bytes)[0]
+		if value.num == 1 {
+			attrs[key] = string(value.bytes)
+		} else {
+			attrs[key] = int64(value.value)
+		}
+	}
+	return attrs
+}
+
+type exportCall struct {
+	method string
+	md     metadata.MD
+	req    []byte
+}
+
+// serveOTLP serves the export, which replies a partial success
+func serveOTLP(t *testing.T) (string, chan exportCall) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := make(chan exportCall, 4)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		call := exportCall{}
+		call.method, _ = grpc.MethodFromServerStream(stream)
+		call.md, _ = metadata.FromIncomingContext(stream.Context())
+		if err := stream.RecvMsg(&call.req); err != nil {
+			return err
+		}
+		calls <- call
+		resp := appendBytesField(nil, 1, appendStringField(appendVarintField(nil, 1, 1), 2, "too large"))
+		return stream.SendMsg(&resp)
+	}))
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return l.Addr().String(), calls
+}
+
+func TestOTLP(t *testing.T) {
+	endpoint, calls := serveOTLP(t)
+	sink, err := newOTLPSink(map[string]string{
+		"endpoint": endpoint, "insecure": "true", "headers": "x-api-key=secret", "compression": "gzip",
+		"fields": "exe,pid:process.pid", "severity_field": "level",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	var batch [][]byte
+	for _, rec := range []*proto.Record{
+		{DataType: 700, Timestamp: 1700000000, Plugin: "fim", Data: &proto.Payload{Fields: map[string]string{"exe": "/bin/sh"}}},
+		{DataType: 700, Timestamp: 1700000000, Plugin: "collector", Data: &proto.Payload{Fields: map[string]string{"exe": "/bin/sh", "pid": "42", "level": "warning"}}},
+	} {
+		data, _ := json.Marshal(rec)
+		batch = append(batch, data)
+	}
+	if err = sink.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	var call exportCall
+	select {
+	case call = <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing is exported")
+	}
+	if call.method != otlpExport || len(call.md.Get("x-api-key")) != 1 || call.md.Get("x-api-key")[0] != "secret" {
+		t.Fatalf("unexpected call of %s with %v", call.method, call.md)
+	}
+	resourceLogs := fieldsOf(t, call.req, 1)
+	if len(resourceLogs) != 2 {
+		t.Fatalf("records should be grouped by 2 plugins: %d", len(resourceLogs))
+	}
+	// collector is the first one
+	resource := fieldsOf(t, resourceLogs[0].bytes, 1)[0].bytes
+	attrs := attributes(t, fieldsOf(t, resource, 1))
+	if attrs["hades.plugin"] != "collector" || attrs["service.name"] != "hades-agent" || attrs["service.version"] != agent.Version {
+		t.Fatalf("unexpected resource: %v", attrs)
+	}
+	scopeLogs := fieldsOf(t, resourceLogs[0].bytes, 2)[0].bytes
+	logRecords := fieldsOf(t, scopeLogs, 2)
+	if len(logRecords) != 1 {
+		t.Fatalf("unexpected log records: %d", len(logRecords))
+	}
+	logRecord := logRecords[0].bytes
+	if ts := fieldsOf(t, logRecord, 1)[0].value; ts != 1700000000*uint64(time.Second) {
+		t.Errorf("unexpected time: %d", ts)
+	}
+	if severity := fieldsOf(t, logRecord, 2)[0].value; severity != 13 {
+		t.Errorf("unexpected severity: %d", severity)
+	}
+	body := string(fieldsOf(t, fieldsOf(t, logRecord, 5)[0].bytes, 1)[0].bytes)
+	if body != string(batch[1]) {
+		t.Errorf("unexpected body: %s", body)
+	}
+	attrs = attributes(t, fieldsOf(t, logRecord, 6))
+	if attrs["hades.data_type"] != int64(700) || attrs["exe"] != "/bin/sh" || attrs["process.pid"] != "42" || len(attrs) != 3 {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+}
+
+func TestOTLPOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{},
+		{"endpoint": "127.0.0.1:4317", "compression": "zstd"},
+		{"endpoint": "127.0.0.1:4317", "headers": "token"},
+		{"endpoint": "127.0.0.1"},
+	} {
+		if _, err := newOTLPSink(options); err == nil {
+			t.Errorf("options should be invalid: %v", options)
+		}
+	}
+	if rejected, msg := partialSuccess(appendBytesField(nil, 1, appendStringField(appendVarintField(nil, 1, 3), 2, "bad"))); rejected != 3 || msg != "bad" {
+		t.Fatalf("unexpected partial success: %d %s", rejected, msg)
+	}
+}
@@ -21,10 +21,18 @@ func Get() *proto.Record {
 	return recordPool.Get().(*proto.Record)
 }
 
+// Put resets the record and puts it back. The map of the fields is kept, so
+// it's not allocated again in the next Unmarshal.
 func Put(rec *proto.Record) {
+	if rec == nil {
+		return
+	}
 	defer recordPool.Put(rec)
-	// clear map. Is this needed?
-	if rec != nil && rec.Data != nil {
+	rec.DataType, rec.Timestamp, rec.Origin, rec.SchemaVersion = 0, 0, 0, 0
+	rec.Compressed, rec.Encoding, rec.Plugin = nil, "", ""
+	// Unmarshal merges into the map, it may be the one of another owner
+	rec.Labels = nil
+	if rec.Data != nil {
 		// https://github.com/golang/go/issues/45328
 		// already compile time optimistic
 		for k := range rec.Data.Fields {
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"agent/proto"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	versioned, err := (&proto.Record{
+		DataType:      1000,
+		SchemaVersion: 7,
+		Data:          &proto.Payload{Fields: map[string]string{"pid": "1"}},
+		Labels:        map[string]string{"env": "prod"},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := (&proto.Record{
+		DataType: 1001,
+		Data:     &proto.Payload{Fields: map[string]string{"exe": "/bin/sh"}},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := Get()
+	if err = rec.Unmarshal(versioned); err != nil {
+		t.Fatal(err)
+	}
+	labels := rec.Labels
+	Put(rec)
+	// decoded again as the next Get would return it, unset fields are kept
+	// by Unmarshal
+	if err = rec.Unmarshal(plain); err != nil {
+		t.Fatal(err)
+	}
+	if rec.DataType != 1001 || rec.SchemaVersion != 0 || rec.Labels != nil {
+		t.Fatalf("fields are left from the last record: %v", rec)
+	}
+	if len(rec.Data.Fields) != 1 || rec.Data.Fields["exe"] != "/bin/sh" {
+		t.Fatalf("unexpected fields: %v", rec.Data.Fields)
+	}
+	if len(labels) != 1 {
+		t.Fatalf("labels of the last record are modified: %v", labels)
+	}
+}
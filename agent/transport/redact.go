@@ -0,0 +1,237 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Actions of a redaction rule
+const (
+	RedactMask = "mask"
+	RedactDrop = "drop"
+)
+
+// defaultMask replaces the matches of a mask rule without replacement
+const defaultMask = "******"
+
+// RedactFile keeps the redact policy in use, in the workdir
+const RedactFile = "redaction.json"
+
+// RedactPolicy is pushed by the server in the task of TaskAgentRedaction,
+// like:
+//
+//	{"rules": [{"data_types": [700], "fields": ["argv"], "patterns": ["(?i)((?:password|token|secret)=)\\S+"], "replacement": "${1}***"},
+//	           {"fields": ["env"], "action": "drop"}]}
+//
+// All the rules matched are applied to the record in order, before it's
+// routed and leaves the host. A mask rule replaces the matches of patterns
+// in the fields, or the whole value without patterns. The replacement may
+// refer to the groups of the pattern, and it's "******" if not set. A drop
+// rule removes the fields, only the ones matching any pattern if set. The
+// policy is kept in the workdir, so the records are redacted from the start
+// after restarts.
+type RedactPolicy struct {
+	Rules []RedactRule `json:"rules"`
+}
+
+// RedactRule matches the record by data_types and plugins as RouteRule
+// does, and redacts the fields. The action is mask if not set.
+type RedactRule struct {
+	DataTypes   []int32  `json:"data_types"`
+	Plugins     []string `json:"plugins"`
+	Fields      []string `json:"fields"`
+	Patterns    []string `json:"patterns"`
+	Action      string   `json:"action"`
+	Replacement string   `json:"replacement"`
+}
+
+type redactRule struct {
+	recordMatcher
+	fields      []string
+	patterns    []*regexp.Regexp
+	drop        bool
+	replacement string
+}
+
+type redactor struct {
+	rules []redactRule
+}
+
+var (
+	// *redactor in use, nil if no policy is set
+	redactions atomic.Value
+	// fields masked or dropped since the agent starts
+	redactedFields uint64
+	// guards the policy file, nothing is kept before it's restored
+	redactMu   sync.Mutex
+	redactPath string
+)
+
+// SetRedactPolicy parses the policy in json and replaces the one in use. An
+// empty policy redacts nothing.
+func SetRedactPolicy(data string) error {
+	r, err := parseRedactPolicy([]byte(data))
+	if err != nil {
+		return err
+	}
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactions.Store(r)
+	zap.S().Infof("redact policy is set with %d rules", len(r.rules))
+	if err = saveRedactPolicy([]byte(data)); err != nil {
+		zap.S().Error("redact policy is not kept: ", err)
+	}
+	return nil
+}
+
+// RestoreRedactPolicy restores the policy kept in the workdir, it's called
+// before the transport starts, so the one pushed later wins
+func RestoreRedactPolicy() {
+	if err := loadRedactPolicy(filepath.Join(agent.Instance.Workdir, RedactFile)); err != nil {
+		zap.S().Error("redact policy is not restored: ", err)
+	}
+}
+
+// loadRedactPolicy sets the policy kept in the file, a missing file is fine
+func loadRedactPolicy(path string) error {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactPath = path
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r, err := parseRedactPolicy(content)
+	if err != nil {
+		return err
+	}
+	redactions.Store(r)
+	return nil
+}
+
+// saveRedactPolicy must be called with redactMu held
+func saveRedactPolicy(content []byte) error {
+	if redactPath == "" {
+		return nil
+	}
+	tmp := redactPath + ".tmp"
+	err := os.WriteFile(tmp, content, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, redactPath); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func parseRedactPolicy(data []byte) (*redactor, error) {
+	policy := &RedactPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	return newRedactor(policy)
+}
+
+func newRedactor(policy *RedactPolicy) (*redactor, error) {
+	r := &redactor{}
+	for i, rule := range policy.Rules {
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("redact rule %d: no fields", i)
+		}
+		compiled := redactRule{
+			recordMatcher: newRecordMatcher(rule.DataTypes, rule.Plugins, nil),
+			fields:        rule.Fields,
+			replacement:   rule.Replacement,
+		}
+		switch rule.Action {
+		case "", RedactMask:
+			if compiled.replacement == "" {
+				compiled.replacement = defaultMask
+			}
+		case RedactDrop:
+			compiled.drop = true
+		default:
+			return nil, fmt.Errorf("redact rule %d: unknown action %s", i, rule.Action)
+		}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redact rule %d: %w", i, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// redact applies all the rules matched to the record in place
+func (r *redactor) redact(rec *proto.Record) {
+	fields := rec.GetData().GetFields()
+	if len(fields) == 0 {
+		return
+	}
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.match(rec) {
+			continue
+		}
+		for _, name := range rule.fields {
+			value, ok := fields[name]
+			if !ok {
+				continue
+			}
+			if redacted, changed := rule.apply(value); changed {
+				if rule.drop {
+					delete(fields, name)
+				} else {
+					fields[name] = redacted
+				}
+				atomic.AddUint64(&redactedFields, 1)
+			}
+		}
+	}
+}
+
+// apply returns the masked value, and whether the field is redacted
+func (r *redactRule) apply(value string) (string, bool) {
+	if len(r.patterns) == 0 {
+		return r.replacement, true
+	}
+	changed := false
+	for _, re := range r.patterns {
+		if !re.MatchString(value) {
+			continue
+		}
+		changed = true
+		if r.drop {
+			break
+		}
+		value = re.ReplaceAllString(value, r.replacement)
+	}
+	return value, changed
+}
+
+// redact is a no-op until a policy is set
+func redact(rec *proto.Record) {
+	if r, ok := redactions.Load().(*redactor); ok && r != nil {
+		r.redact(rec)
+	}
+}
+
+// RedactedFields returns the fields masked or dropped since the agent starts
+func RedactedFields() uint64 { return atomic.LoadUint64(&redactedFields) }
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"agent/proto"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r, err := newRedactor(&RedactPolicy{Rules: []RedactRule{
+		{DataTypes: []int32{700}, Fields: []string{"argv"}, Patterns: []string{`(?i)((?:password|token)=)\S+`}, Replacement: "${1}***"},
+		{Fields: []string{"env"}, Action: RedactDrop},
+		{Plugins: []string{"fim"}, Fields: []string{"content"}},
+		{Fields: []string{"cmdline"}, Patterns: []string{`--secret`}, Action: RedactDrop},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		rec    *proto.Record
+		expect map[string]string
+	}{
+		{
+			&proto.Record{DataType: 700, Data: &proto.Payload{Fields: map[string]string{"argv": "curl -d PASSWORD=abc token=x1 -v", "env": "A=1"}}},
+			map[string]string{"argv": "curl -d PASSWORD=*** token=*** -v"},
+		},
+		// the argv rule is of another data type
+		{
+			&proto.Record{DataType: 701, Data: &proto.Payload{Fields: map[string]string{"argv": "password=abc"}}},
+			map[string]string{"argv": "password=abc"},
+		},
+		{
+			&proto.Record{DataType: 1, Plugin: "fim", Data: &proto.Payload{Fields: map[string]string{"content": "key"}}},
+			map[string]string{"content": defaultMask},
+		},
+		{
+			&proto.Record{DataType: 1, Data: &proto.Payload{Fields: map[string]string{"cmdline": "app --secret x"}}},
+			map[string]string{},
+		},
+		{
+			&proto.Record{DataType: 1, Data: &proto.Payload{Fields: map[string]string{"cmdline": "app"}}},
+			map[string]string{"cmdline": "app"},
+		},
+	} {
+		r.redact(c.rec)
+		fields := c.rec.Data.Fields
+		if len(fields) != len(c.expect) {
+			t.Fatalf("unexpected fields %v, expect %v", fields, c.expect)
+		}
+		for k, v := range c.expect {
+			if fields[k] != v {
+				t.Fatalf("unexpected fields %v, expect %v", fields, c.expect)
+			}
+		}
+	}
+}
+
+func TestRedactPolicyInvalid(t *testing.T) {
+	for _, policy := range []string{
+		`{"rules": [{"data_types": [1]}]}`,
+		`{"rules": [{"fields": ["a"], "action": "hash"}]}`,
+		`{"rules": [{"fields": ["a"], "patterns": ["("]}]}`,
+		`{"rules": [`,
+	} {
+		if err := SetRedactPolicy(policy); err == nil {
+			t.Fatalf("invalid policy is set: %s", policy)
+		}
+	}
+}
+
+func TestRedactPolicyRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), RedactFile)
+	defer func() {
+		redactPath = ""
+		redactions.Store((*redactor)(nil))
+	}()
+	if err := loadRedactPolicy(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRedactPolicy(`{"rules": [{"fields": ["env"], "action": "drop"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	// the agent restarts
+	redactions.Store((*redactor)(nil))
+	if err := loadRedactPolicy(path); err != nil {
+		t.Fatal(err)
+	}
+	rec := &proto.Record{DataType: 1, Data: &proto.Payload{Fields: map[string]string{"env": "A=1"}}}
+	redact(rec)
+	if _, ok := rec.Data.Fields["env"]; ok {
+		t.Fatal("redact policy is not restored")
+	}
+}
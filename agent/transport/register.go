@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/host"
+	"agent/proto"
+	"agent/resource"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskaliX/SDK/config"
+	"go.uber.org/zap"
+)
+
+// Register sends the registration of the agent as the first message of the
+// stream, a DTAgentRegister record with the metadata of the host, so the
+// server knows the agent before any other record. The server acknowledges
+// it by TaskAgentRegistered. An older server never does, and the records
+// are sent all the same.
+func (t *Transfer) Register(client proto.Transfer_TransferClient) error {
+	atomic.StoreInt32(&t.registered, 0)
+	return t.send(client, []*proto.Record{registration(time.Now())})
+}
+
+// registration carries the metadata not in every message
+func registration(now time.Time) *proto.Record {
+	fields := map[string]string{
+		"agent_id":         agent.Instance.ID,
+		"id_source":        agent.Instance.IDSource,
+		"version":          agent.Version,
+		"product":          agent.Product,
+		"platform":         host.Platform,
+		"platform_family":  host.PlatformFamily,
+		"platform_version": host.PlatformVersion,
+		"kernel_version":   host.KernelVersion,
+		"arch":             host.Arch,
+		"os":               runtime.GOOS,
+		"cpu_num":          host.CpuNum,
+		"cpu_mhz":          host.CpuMhz,
+		"pid":              strconv.Itoa(os.Getpid()),
+		"boot_at":          strconv.FormatUint(resource.GetBootTime(), 10),
+	}
+	if hostname, ok := host.Hostname.Load().(string); ok {
+		fields["hostname"] = hostname
+	}
+	return &proto.Record{
+		DataType:  config.DTAgentRegister,
+		Timestamp: now.Unix(),
+		Origin:    proto.Origin_AGENT,
+		Data:      &proto.Payload{Fields: fields},
+	}
+}
+
+// Registered reports whether the server acknowledges the registration of
+// the current stream
+func (t *Transfer) Registered() bool { return atomic.LoadInt32(&t.registered) == 1 }
+
+func (t *Transfer) setRegistered() {
+	if atomic.SwapInt32(&t.registered, 1) == 0 {
+		zap.S().Info("agent is registered")
+	}
+}
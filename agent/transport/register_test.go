@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"testing"
+
+	"github.com/chriskaliX/SDK/config"
+)
+
+// registerClient keeps the messages sent, and receives the command
+type registerClient struct {
+	commandClient
+	sent []*proto.PackagedData
+}
+
+func (c *registerClient) Send(data *proto.PackagedData) error {
+	c.sent = append(c.sent, data)
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	transfer := NewTransfer()
+	client := &registerClient{commandClient: commandClient{cmd: &proto.Command{Task: &proto.Task{
+		ObjectName: agent.Product,
+		DataType:   config.TaskAgentRegistered,
+	}}}}
+	if err := transfer.Register(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 1 || len(client.sent[0].Records) != 1 {
+		t.Fatalf("unexpected registration: %v", client.sent)
+	}
+	msg := client.sent[0]
+	rec := msg.Records[0]
+	if rec.DataType != config.DTAgentRegister || rec.Origin != proto.Origin_AGENT ||
+		msg.AgentId != agent.Instance.ID || rec.Data.Fields["agent_id"] != agent.Instance.ID ||
+		rec.Data.Fields["id_source"] != agent.Instance.IDSource || rec.Data.Fields["kernel_version"] == "" {
+		t.Fatalf("unexpected registration: %v", rec)
+	}
+	if transfer.Registered() {
+		t.Fatal("registered before the acknowledgement")
+	}
+	if err := transfer.Receive(client); err != nil {
+		t.Fatal(err)
+	}
+	if !transfer.Registered() {
+		t.Fatal("acknowledgement is not taken")
+	}
+	// registered again on the next stream
+	transfer.SetHealthy(false)
+	if transfer.Registered() {
+		t.Fatal("still registered once the stream is down")
+	}
+}
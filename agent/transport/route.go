@@ -0,0 +1,229 @@
+package transport
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Sinks reserved by the routing policy, the stream to the server and none
+const (
+	SinkServer = "grpc"
+	SinkDrop   = "drop"
+)
+
+// RoutePolicy is pushed by the server in the task of TaskAgentRouting, like:
+//
+//	{"sinks": [{"name": "fim", "type": "http", "options": {"url": "http://rest-proxy/topics/fim", "format": "kafka"}}],
+//	 "rules": [{"data_types": [6001], "sink": "fim"},
+//	           {"plugins": ["collector"], "fields": {"action": "delete"}, "sink": "fim", "continue": true}]}
+//
+// Rules are matched in order, and the first one matched decides the sink. A
+// record matching a rule with continue goes on to the next rules, so it's
+// sent to more than one sink. Records not decided by a rule without
+// continue go to the server. The types of sinks are file, http, syslog,
+// journald and otlp, see the sinks for the options of each. The records are in json,
+// or in cef and leef by the option formatter, see recordFormat.
+type RoutePolicy struct {
+	Sinks []SinkConfig `json:"sinks"`
+	Rules []RouteRule  `json:"rules"`
+}
+
+type SinkConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options"`
+}
+
+// RouteRule matches the record by all the conditions set, data_types and
+// plugins match any of them, and fields match all of them exactly
+type RouteRule struct {
+	DataTypes []int32           `json:"data_types"`
+	Plugins   []string          `json:"plugins"`
+	Fields    map[string]string `json:"fields"`
+	Sink      string            `json:"sink"`
+	Continue  bool              `json:"continue"`
+}
+
+// recordMatcher is the conditions of a rule, the unset ones match all
+type recordMatcher struct {
+	dataTypes map[int32]struct{}
+	plugins   map[string]struct{}
+	fields    map[string]string
+}
+
+func newRecordMatcher(dataTypes []int32, plugins []string, fields map[string]string) recordMatcher {
+	m := recordMatcher{fields: fields}
+	if len(dataTypes) != 0 {
+		m.dataTypes = make(map[int32]struct{}, len(dataTypes))
+		for _, dt := range dataTypes {
+			m.dataTypes[dt] = struct{}{}
+		}
+	}
+	if len(plugins) != 0 {
+		m.plugins = make(map[string]struct{}, len(plugins))
+		for _, name := range plugins {
+			m.plugins[name] = struct{}{}
+		}
+	}
+	return m
+}
+
+type compiledRule struct {
+	recordMatcher
+	sink string
+	next bool
+}
+
+func (r *recordMatcher) match(rec *proto.Record) bool {
+	if r.dataTypes != nil {
+		if _, ok := r.dataTypes[rec.GetDataType()]; !ok {
+			return false
+		}
+	}
+	if r.plugins != nil {
+		if _, ok := r.plugins[rec.GetPlugin()]; !ok {
+			return false
+		}
+	}
+	fields := rec.GetData().GetFields()
+	for key, value := range r.fields {
+		if v, ok := fields[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+type router struct {
+	rules []compiledRule
+	sinks map[string]*asyncSink
+}
+
+var (
+	routeMu sync.Mutex
+	// *router in use, nil if no policy is set
+	routes atomic.Value
+)
+
+// SetRoutePolicy parses the policy in json and replaces the one in use. The
+// sinks of the old one are flushed and closed in the background. An empty
+// policy routes everything to the server.
+func SetRoutePolicy(data string) error {
+	policy := &RoutePolicy{}
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return err
+	}
+	r, err := newRouter(policy)
+	if err != nil {
+		return err
+	}
+	routeMu.Lock()
+	old, _ := routes.Load().(*router)
+	routes.Store(r)
+	routeMu.Unlock()
+	if old != nil {
+		go old.close()
+	}
+	zap.S().Infof("route policy is set with %d rules and %d sinks", len(policy.Rules), len(policy.Sinks))
+	return nil
+}
+
+func newRouter(policy *RoutePolicy) (r *router, err error) {
+	r = &router{sinks: make(map[string]*asyncSink, len(policy.Sinks))}
+	defer func() {
+		if err != nil {
+			r.close()
+		}
+	}()
+	for _, config := range policy.Sinks {
+		if config.Name == SinkServer || config.Name == SinkDrop {
+			return r, fmt.Errorf("sink name %s is reserved", config.Name)
+		}
+		if _, ok := r.sinks[config.Name]; ok {
+			return r, fmt.Errorf("sink %s is duplicated", config.Name)
+		}
+		sink, err := newSink(config.Type, config.Options)
+		if err != nil {
+			return r, fmt.Errorf("sink %s: %w", config.Name, err)
+		}
+		r.sinks[config.Name] = newAsyncSink(config.Name, sink)
+	}
+	for i, rule := range policy.Rules {
+		if _, ok := r.sinks[rule.Sink]; !ok && rule.Sink != SinkServer && rule.Sink != SinkDrop {
+			return r, fmt.Errorf("sink %s of rule %d is not defined", rule.Sink, i)
+		}
+		r.rules = append(r.rules, compiledRule{
+			recordMatcher: newRecordMatcher(rule.DataTypes, rule.Plugins, rule.Fields),
+			sink:          rule.Sink,
+			next:          rule.Continue,
+		})
+	}
+	return r, nil
+}
+
+func (r *router) close() {
+	for _, sink := range r.sinks {
+		sink.close()
+	}
+}
+
+// route hands the record to the sinks of the rules it matches, and reports
+// whether it goes to the server as well
+func (r *router) route(rec *proto.Record) (server bool) {
+	var data []byte
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.match(rec) {
+			continue
+		}
+		switch rule.sink {
+		case SinkServer:
+			server = true
+		case SinkDrop:
+		default:
+			// the record may be modified once it's buffered for the server
+			if data == nil {
+				var err error
+				if data, err = json.Marshal(rec); err != nil {
+					zap.S().Error("route record: ", err)
+					break
+				}
+			}
+			r.sinks[rule.sink].put(data)
+		}
+		if !rule.next {
+			return
+		}
+	}
+	// nothing but the rules with continue matches
+	return true
+}
+
+// route is a no-op until a policy is set
+func route(rec *proto.Record) bool {
+	r, ok := routes.Load().(*router)
+	if !ok || r == nil {
+		return true
+	}
+	return r.route(rec)
+}
+
+// SinkStats returns the records dropped by the full queue, and the ones
+// failed to be written by the sinks in use
+func SinkStats() (dropped, failed map[string]uint64) {
+	dropped, failed = make(map[string]uint64), make(map[string]uint64)
+	r, ok := routes.Load().(*router)
+	if !ok || r == nil {
+		return
+	}
+	for name, sink := range r.sinks {
+		dropped[name] = atomic.LoadUint64(&sink.dropped)
+		failed[name] = atomic.LoadUint64(&sink.failed)
+	}
+	return
+}
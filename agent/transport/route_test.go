@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"agent/proto"
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fim.json")
+	policy := &RoutePolicy{
+		Sinks: []SinkConfig{{Name: "fim", Type: "file", Options: map[string]string{"path": path}}},
+		Rules: []RouteRule{
+			{DataTypes: []int32{6001}, Sink: "fim"},
+			{Plugins: []string{"collector"}, Fields: map[string]string{"action": "delete"}, Sink: "fim", Continue: true},
+			{Plugins: []string{"noisy"}, Sink: SinkDrop},
+		},
+	}
+	r, err := newRouter(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(dataType int32, plugin string, fields map[string]string) *proto.Record {
+		return &proto.Record{DataType: dataType, Plugin: plugin, Data: &proto.Payload{Fields: fields}}
+	}
+	for _, c := range []struct {
+		rec    *proto.Record
+		server bool
+	}{
+		{record(6001, "fim", nil), false},
+		{record(1001, "collector", map[string]string{"action": "delete"}), true},
+		{record(1001, "collector", map[string]string{"action": "create"}), true},
+		{record(1001, "noisy", nil), false},
+		{record(1001, "", nil), true},
+	} {
+		if server := r.route(c.rec); server != c.server {
+			t.Errorf("record of %d by %q should go to the server: %v", c.rec.DataType, c.rec.Plugin, c.server)
+		}
+	}
+	r.close()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var routed []proto.Record
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		rec := proto.Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		routed = append(routed, rec)
+	}
+	if len(routed) != 2 || routed[0].DataType != 6001 || routed[1].Plugin != "collector" {
+		t.Fatalf("unexpected records in the sink: %v", routed)
+	}
+}
+
+func TestRoutePolicy(t *testing.T) {
+	for _, data := range []string{
+		`{"rules": [{"sink": "kafka"}]}`,
+		`{"sinks": [{"name": "grpc", "type": "file", "options": {"path": "/dev/null"}}]}`,
+		`{"sinks": [{"name": "a", "type": "kafka"}]}`,
+		`{"sinks": [{"name": "a", "type": "http", "options": {"url": "http://127.0.0.1", "format": "xml"}}]}`,
+		`{"sinks": [`,
+	} {
+		if err := SetRoutePolicy(data); err == nil {
+			t.Errorf("policy should be invalid: %s", data)
+		}
+	}
+	// everything goes to the server without rules
+	if err := SetRoutePolicy(`{}`); err != nil {
+		t.Fatal(err)
+	}
+	defer routes.Store((*router)(nil))
+	if !route(&proto.Record{DataType: 1}) {
+		t.Fatal("record is not sent to the server")
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		bufio.NewReader(r.Body).WriteTo(&body)
+		bodies <- r.Header.Get("Content-Type") + " " + body.String()
+	}))
+	defer server.Close()
+	sink, err := newHTTPSink(map[string]string{"url": server.URL, "format": "kafka"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err = sink.Write([][]byte{[]byte(`{"data_type":1}`), []byte(`{"data_type":2}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-bodies; body != `application/vnd.kafka.json.v2+json {"records":[{"value":{"data_type":1}},{"value":{"data_type":2}}]}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
@@ -0,0 +1,218 @@
+package transport
+
+import (
+	"agent/proto"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SamplePolicy is pushed by the server in the task of TaskAgentSampling, like:
+//
+//	{"rules": [{"name": "exec", "data_types": [700], "dedup_fields": ["exe", "argv"], "dedup_window": 10},
+//	           {"name": "dns", "data_types": [1025], "sample_rate": 10}]}
+//
+// The records from plugins are checked by the first rule matched. With
+// dedup_window, a record is suppressed if one with the same dedup_fields is
+// passed within the window in seconds, all the fields are compared if
+// dedup_fields is not set. With sample_rate N, one of N records is passed.
+// Important records are never suppressed.
+type SamplePolicy struct {
+	Rules []SampleRule `json:"rules"`
+}
+
+// SampleRule matches the record as RouteRule does. The suppressed records
+// are counted by the name, the index of the rule if it's not set.
+type SampleRule struct {
+	Name        string            `json:"name"`
+	DataTypes   []int32           `json:"data_types"`
+	Plugins     []string          `json:"plugins"`
+	Fields      map[string]string `json:"fields"`
+	DedupFields []string          `json:"dedup_fields"`
+	DedupWindow int               `json:"dedup_window"`
+	SampleRate  int               `json:"sample_rate"`
+}
+
+// maxDedupKeys bounds the records remembered by a rule, the expired ones are
+// swept once it's reached, and all of them are forgotten if none is expired
+var maxDedupKeys = 65536
+
+type sampleRule struct {
+	// first in the struct for the 64-bit alignment on 32-bit platforms.
+	// seen is the records matched, for the sampling, and the others count
+	// the suppressed records.
+	seen    uint64
+	deduped uint64
+	sampled uint64
+	recordMatcher
+	name   string
+	fields []string
+	window time.Duration
+	rate   uint64
+	// unix nano when the key is passed, guarded by mu
+	mu     sync.Mutex
+	passed map[uint64]int64
+}
+
+type sampler struct {
+	rules []*sampleRule
+}
+
+var (
+	// *sampler in use, nil if no policy is set
+	samples atomic.Value
+	// suppressed records since the agent starts, across the policies
+	dedupSuppressed  uint64
+	sampleSuppressed uint64
+)
+
+// SetSamplePolicy parses the policy in json and replaces the one in use, the
+// records remembered for dedup are forgotten. An empty policy passes all.
+func SetSamplePolicy(data string) error {
+	policy := &SamplePolicy{}
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return err
+	}
+	s, err := newSampler(policy)
+	if err != nil {
+		return err
+	}
+	samples.Store(s)
+	zap.S().Infof("sample policy is set with %d rules", len(policy.Rules))
+	return nil
+}
+
+func newSampler(policy *SamplePolicy) (*sampler, error) {
+	s := &sampler{}
+	names := make(map[string]bool, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			rule.Name = strconv.Itoa(i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("sample rule %s is duplicated", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.DedupWindow < 0 || rule.SampleRate < 0 {
+			return nil, fmt.Errorf("sample rule %s: negative window or rate", rule.Name)
+		}
+		if rule.DedupWindow == 0 && rule.SampleRate <= 1 {
+			return nil, fmt.Errorf("sample rule %s: neither dedup_window nor sample_rate is set", rule.Name)
+		}
+		compiled := &sampleRule{
+			recordMatcher: newRecordMatcher(rule.DataTypes, rule.Plugins, rule.Fields),
+			name:          rule.Name,
+			fields:        rule.DedupFields,
+			window:        time.Duration(rule.DedupWindow) * time.Second,
+			rate:          uint64(rule.SampleRate),
+		}
+		if compiled.window > 0 {
+			compiled.passed = make(map[uint64]int64)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	return s, nil
+}
+
+// pass reports whether the record is passed by the first rule it matches
+func (s *sampler) pass(rec *proto.Record, now time.Time) bool {
+	for _, rule := range s.rules {
+		if rule.match(rec) {
+			return rule.pass(rec, now)
+		}
+	}
+	return true
+}
+
+// pass dedups and then samples, the sampling counts the deduped records
+// out
+func (r *sampleRule) pass(rec *proto.Record, now time.Time) bool {
+	if r.window > 0 && !r.first(r.key(rec), now.UnixNano()) {
+		atomic.AddUint64(&r.deduped, 1)
+		atomic.AddUint64(&dedupSuppressed, 1)
+		return false
+	}
+	if r.rate > 1 && (atomic.AddUint64(&r.seen, 1)-1)%r.rate != 0 {
+		atomic.AddUint64(&r.sampled, 1)
+		atomic.AddUint64(&sampleSuppressed, 1)
+		return false
+	}
+	return true
+}
+
+// first reports whether the key is not passed within the window, and
+// remembers it if so
+func (r *sampleRule) first(key uint64, now int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at, ok := r.passed[key]; ok && now-at < int64(r.window) {
+		return false
+	}
+	if len(r.passed) >= maxDedupKeys {
+		for k, at := range r.passed {
+			if now-at >= int64(r.window) {
+				delete(r.passed, k)
+			}
+		}
+		if len(r.passed) >= maxDedupKeys {
+			r.passed = make(map[uint64]int64)
+		}
+	}
+	r.passed[key] = now
+	return true
+}
+
+// key hashes the data type, the plugin and the dedup fields of the record
+func (r *sampleRule) key(rec *proto.Record) uint64 {
+	h := fnv.New64a()
+	var sep = []byte{0}
+	h.Write([]byte(strconv.Itoa(int(rec.GetDataType()))))
+	h.Write(sep)
+	h.Write([]byte(rec.GetPlugin()))
+	fields := rec.GetData().GetFields()
+	names := r.fields
+	if len(names) == 0 {
+		names = make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		h.Write(sep)
+		h.Write([]byte(name))
+		h.Write(sep)
+		h.Write([]byte(fields[name]))
+	}
+	return h.Sum64()
+}
+
+// sample is a no-op until a policy is set
+func sample(rec *proto.Record) bool {
+	s, ok := samples.Load().(*sampler)
+	if !ok || s == nil {
+		return true
+	}
+	return s.pass(rec, time.Now())
+}
+
+// SampleStats returns the records suppressed by dedup and sampling since the
+// agent starts, and the ones of each rule in use
+func SampleStats() (deduped, sampled uint64, rules map[string]uint64) {
+	deduped = atomic.LoadUint64(&dedupSuppressed)
+	sampled = atomic.LoadUint64(&sampleSuppressed)
+	rules = make(map[string]uint64)
+	if s, ok := samples.Load().(*sampler); ok && s != nil {
+		for _, rule := range s.rules {
+			rules[rule.name] = atomic.LoadUint64(&rule.deduped) + atomic.LoadUint64(&rule.sampled)
+		}
+	}
+	return
+}
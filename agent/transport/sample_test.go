@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"agent/proto"
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	s, err := newSampler(&SamplePolicy{Rules: []SampleRule{
+		{Name: "exec", DataTypes: []int32{700}, DedupFields: []string{"exe", "argv"}, DedupWindow: 10},
+		{Name: "dns", DataTypes: []int32{1025}, SampleRate: 10},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(argv, pid string) *proto.Record {
+		return &proto.Record{DataType: 700, Data: &proto.Payload{Fields: map[string]string{"exe": "/bin/ls", "argv": argv, "pid": pid}}}
+	}
+	now := time.Now()
+	for _, c := range []struct {
+		rec  *proto.Record
+		at   time.Duration
+		pass bool
+	}{
+		{exec("ls", "1"), 0, true},
+		// the pid is not one of the dedup fields
+		{exec("ls", "2"), time.Second, false},
+		{exec("ls -l", "3"), time.Second, true},
+		{exec("ls", "4"), 10 * time.Second, true},
+		{exec("ls", "5"), 15 * time.Second, false},
+		// no rule matches
+		{&proto.Record{DataType: 1}, 0, true},
+	} {
+		if pass := s.pass(c.rec, now.Add(c.at)); pass != c.pass {
+			t.Fatalf("record %v at %s passed %v, expect %v", c.rec.Data.GetFields(), c.at, pass, c.pass)
+		}
+	}
+	passed := 0
+	for i := 0; i < 100; i++ {
+		if s.pass(&proto.Record{DataType: 1025}, now) {
+			passed++
+		}
+	}
+	if passed != 10 {
+		t.Fatalf("%d of 100 dns records are passed, expect 10", passed)
+	}
+	if s.rules[0].deduped != 2 || s.rules[1].sampled != 90 {
+		t.Fatalf("unexpected counters, deduped %d, sampled %d", s.rules[0].deduped, s.rules[1].sampled)
+	}
+}
+
+func TestSampleDedupKeys(t *testing.T) {
+	defer func(n int) { maxDedupKeys = n }(maxDedupKeys)
+	maxDedupKeys = 2
+	s, err := newSampler(&SamplePolicy{Rules: []SampleRule{{DedupWindow: 10}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(v string) *proto.Record {
+		return &proto.Record{DataType: 1, Data: &proto.Payload{Fields: map[string]string{"v": v}}}
+	}
+	now := time.Now()
+	s.pass(record("a"), now)
+	s.pass(record("b"), now.Add(5*time.Second))
+	// a is swept once the keys are full
+	s.pass(record("c"), now.Add(12*time.Second))
+	if n := len(s.rules[0].passed); n != 2 {
+		t.Fatalf("%d keys are remembered, expect 2", n)
+	}
+	if s.pass(record("b"), now.Add(12*time.Second)) {
+		t.Fatal("record in the window is passed after the sweep")
+	}
+}
+
+func TestSamplePolicyInvalid(t *testing.T) {
+	for _, policy := range []string{
+		`{"rules": [{"data_types": [1]}]}`,
+		`{"rules": [{"name": "a", "sample_rate": 2}, {"name": "a", "sample_rate": 2}]}`,
+		`{"rules": [{"dedup_window": -1}]}`,
+		`{"rules": [`,
+	} {
+		if err := SetSamplePolicy(policy); err == nil {
+			t.Fatalf("invalid policy is set: %s", policy)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"agent/transport/cron"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SchedulePolicy is pushed by the server in the task of TaskAgentSchedule,
+// like:
+//
+//	{"schedules": [{"id": "daily-scan", "cron": "0 3 * * *", "timezone": "Asia/Shanghai", "catch_up": true,
+//	                "task": {"object_name": "collector", "data_type": 3001, "data": "{}"}}]}
+//
+// The schedules replace the ones pushed before. The task is delivered to the
+// plugin at every time matched by cron, in the timezone, the local one of
+// the host if it's not set, with the token "<id>:<unix time>", so the
+// results are correlated. The schedules and their last runs are kept in the
+// workdir, so they survive restarts, and the run missed while the agent is
+// down is delivered once it starts if catch_up is set.
+type SchedulePolicy struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+type Schedule struct {
+	ID       string     `json:"id"`
+	Cron     string     `json:"cron"`
+	Timezone string     `json:"timezone,omitempty"`
+	CatchUp  bool       `json:"catch_up,omitempty"`
+	Task     proto.Task `json:"task"`
+}
+
+// ScheduleFile keeps the schedules and the last runs, in the workdir
+const ScheduleFile = "schedules.json"
+
+// maxSchedules bounds the schedules pushed
+const maxSchedules = 256
+
+type scheduleState struct {
+	Schedules []Schedule `json:"schedules"`
+	// unix time of the last run by the id
+	LastRuns map[string]int64 `json:"last_runs"`
+}
+
+type scheduledTask struct {
+	Schedule
+	spec *cron.Schedule
+	loc  *time.Location
+	// zero if it never runs again
+	next time.Time
+}
+
+type scheduler struct {
+	// first in the struct for the 64-bit alignment on 32-bit platforms,
+	// the tasks delivered since the agent starts
+	fired uint64
+	// guards the others
+	mu       sync.Mutex
+	path     string
+	tasks    []*scheduledTask
+	lastRuns map[string]int64
+	// receives once the schedules are replaced
+	changed chan struct{}
+}
+
+var schedules = &scheduler{lastRuns: map[string]int64{}, changed: make(chan struct{}, 1)}
+
+// SetSchedulePolicy parses the policy in json and replaces the schedules. An
+// empty policy removes all of them.
+func SetSchedulePolicy(data string) error {
+	policy := &SchedulePolicy{}
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return err
+	}
+	tasks, err := compileSchedules(policy.Schedules)
+	if err != nil {
+		return err
+	}
+	if err = schedules.replace(tasks, time.Now()); err != nil {
+		return err
+	}
+	zap.S().Infof("schedule policy is set with %d schedules", len(tasks))
+	return nil
+}
+
+func compileSchedules(list []Schedule) ([]*scheduledTask, error) {
+	if len(list) > maxSchedules {
+		return nil, fmt.Errorf("%d schedules, more than %d", len(list), maxSchedules)
+	}
+	ids := make(map[string]bool, len(list))
+	tasks := make([]*scheduledTask, 0, len(list))
+	for _, s := range list {
+		if s.ID == "" {
+			return nil, errors.New("schedule without id")
+		}
+		if ids[s.ID] {
+			return nil, fmt.Errorf("schedule %s is duplicated", s.ID)
+		}
+		ids[s.ID] = true
+		if s.Task.ObjectName == "" || s.Task.ObjectName == agent.Product {
+			return nil, fmt.Errorf("schedule %s: task of plugins only", s.ID)
+		}
+		spec, err := cron.Parse(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", s.ID, err)
+		}
+		loc := time.Local
+		if s.Timezone != "" {
+			if loc, err = time.LoadLocation(s.Timezone); err != nil {
+				return nil, fmt.Errorf("schedule %s: %w", s.ID, err)
+			}
+		}
+		tasks = append(tasks, &scheduledTask{Schedule: s, spec: spec, loc: loc})
+	}
+	return tasks, nil
+}
+
+// load restores the schedules kept in the file, a missing file is fine
+func (s *scheduler) load(path string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := &scheduleState{}
+	if err = json.Unmarshal(content, state); err != nil {
+		return err
+	}
+	tasks, err := compileSchedules(state.Schedules)
+	if err != nil {
+		return err
+	}
+	if state.LastRuns != nil {
+		s.lastRuns = state.LastRuns
+	}
+	for _, t := range tasks {
+		t.next = t.spec.Next(now.In(t.loc))
+		last, ok := s.lastRuns[t.ID]
+		// missed once or more, delivered once
+		if ok && t.CatchUp {
+			if missed := t.spec.Next(time.Unix(last, 0).In(t.loc)); !missed.IsZero() && missed.Before(now) {
+				t.next = now
+			}
+		}
+	}
+	s.tasks = tasks
+	return nil
+}
+
+// replace takes the new schedules from now on, the last runs of the ids
+// kept are kept
+func (s *scheduler) replace(tasks []*scheduledTask, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastRuns := make(map[string]int64, len(tasks))
+	for _, t := range tasks {
+		t.next = t.spec.Next(now.In(t.loc))
+		if last, ok := s.lastRuns[t.ID]; ok {
+			lastRuns[t.ID] = last
+		}
+	}
+	s.tasks, s.lastRuns = tasks, lastRuns
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return s.save()
+}
+
+// save must be called with mu held, nothing is kept before load
+func (s *scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	state := &scheduleState{LastRuns: s.lastRuns, Schedules: make([]Schedule, 0, len(s.tasks))}
+	for _, t := range s.tasks {
+		state.Schedules = append(state.Schedules, t.Schedule)
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// due returns the tasks to deliver at now, and the time of the next one,
+// zero if there's none
+func (s *scheduler) due(now time.Time) (tasks []*proto.Task, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if !t.next.IsZero() && !t.next.After(now) {
+			task := t.Task
+			task.Token = fmt.Sprintf("%s:%d", t.ID, now.Unix())
+			tasks = append(tasks, &task)
+			s.lastRuns[t.ID] = now.Unix()
+			t.next = t.spec.Next(now.In(t.loc))
+		}
+		if !t.next.IsZero() && (next.IsZero() || t.next.Before(next)) {
+			next = t.next
+		}
+	}
+	if len(tasks) != 0 {
+		if err := s.save(); err != nil {
+			zap.S().Error("save schedules failed: ", err)
+		}
+	}
+	return
+}
+
+// run delivers the tasks on time until ctx is done
+func (s *scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+		case <-timer.C:
+		}
+		tasks, next := s.due(time.Now())
+		for _, task := range tasks {
+			select {
+			case PluginTaskChan <- task:
+				atomic.AddUint64(&s.fired, 1)
+			case <-ctx.Done():
+				return
+			}
+		}
+		// woken by changed otherwise
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// RestoreSchedules restores the schedules kept in the workdir, it's called
+// before the transport starts, so the ones pushed later win
+func RestoreSchedules() {
+	if err := schedules.load(filepath.Join(agent.Instance.Workdir, ScheduleFile), time.Now()); err != nil {
+		zap.S().Error("schedules are not restored: ", err)
+	}
+}
+
+// RunSchedules delivers the scheduled tasks until ctx is done
+func RunSchedules(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	schedules.run(ctx)
+}
+
+// ScheduleStats returns the schedules in use, and the tasks delivered by
+// them since the agent starts
+func ScheduleStats() (count int, fired uint64) {
+	schedules.mu.Lock()
+	count = len(schedules.tasks)
+	schedules.mu.Unlock()
+	return count, atomic.LoadUint64(&schedules.fired)
+}
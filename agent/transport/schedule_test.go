@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"agent/agent"
+	"agent/proto"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(t *testing.T) *scheduler {
+	s := &scheduler{lastRuns: map[string]int64{}, changed: make(chan struct{}, 1)}
+	if err := s.load(filepath.Join(t.TempDir(), ScheduleFile), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchedulePolicy(t *testing.T) {
+	for name, data := range map[string]string{
+		"no id":     `{"schedules": [{"cron": "* * * * *", "task": {"object_name": "collector"}}]}`,
+		"duplicate": `{"schedules": [{"id": "a", "cron": "* * * * *", "task": {"object_name": "collector"}}, {"id": "a", "cron": "@daily", "task": {"object_name": "collector"}}]}`,
+		"cron":      `{"schedules": [{"id": "a", "cron": "* * *", "task": {"object_name": "collector"}}]}`,
+		"timezone":  `{"schedules": [{"id": "a", "cron": "@daily", "timezone": "Mars/Olympus", "task": {"object_name": "collector"}}]}`,
+		"agent":     `{"schedules": [{"id": "a", "cron": "@daily", "task": {"object_name": "` + agent.Product + `"}}]}`,
+	} {
+		if err := SetSchedulePolicy(data); err == nil {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	s := newTestScheduler(t)
+	tasks, err := compileSchedules([]Schedule{{ID: "scan", Cron: "*/5 * * * *", Timezone: "UTC", Task: proto.Task{ObjectName: "collector", DataType: 3001}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC)
+	if err = s.replace(tasks, now); err != nil {
+		t.Fatal(err)
+	}
+	due, next := s.due(now)
+	if len(due) != 0 || !next.Equal(time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected due: %v, next %s", due, next)
+	}
+	if due, next = s.due(next); len(due) != 1 || next != time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC) {
+		t.Fatalf("unexpected due: %v, next %s", due, next)
+	}
+	if due[0].ObjectName != "collector" || due[0].DataType != 3001 || due[0].Token != "scan:1704103500" {
+		t.Fatalf("unexpected task: %v", due[0])
+	}
+	// kept with the last run
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &scheduleState{}
+	if err = json.Unmarshal(content, state); err != nil || len(state.Schedules) != 1 || state.LastRuns["scan"] != 1704103500 {
+		t.Fatalf("unexpected state: %s, %v", content, err)
+	}
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	now := time.Now()
+	for _, catchUp := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), ScheduleFile)
+		content, _ := json.Marshal(&scheduleState{
+			Schedules: []Schedule{{ID: "hourly", Cron: "@hourly", CatchUp: catchUp, Task: proto.Task{ObjectName: "collector"}}},
+			LastRuns:  map[string]int64{"hourly": now.Add(-2 * time.Hour).Unix()},
+		})
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s := &scheduler{lastRuns: map[string]int64{}, changed: make(chan struct{}, 1)}
+		if err := s.load(path, now); err != nil {
+			t.Fatal(err)
+		}
+		// the runs missed are delivered once
+		if due, _ := s.due(now); (len(due) == 1) != catchUp {
+			t.Fatalf("catch up %v: %d delivered", catchUp, len(due))
+		}
+		if due, _ := s.due(now); len(due) != 0 {
+			t.Fatalf("delivered twice: %v", due)
+		}
+	}
+}
+
+func TestScheduleRun(t *testing.T) {
+	s := newTestScheduler(t)
+	tasks, err := compileSchedules([]Schedule{{ID: "scan", Cron: "@yearly", Task: proto.Task{ObjectName: "collector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.replace(tasks, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// due right now
+	s.mu.Lock()
+	tasks[0].next = time.Now()
+	s.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+	select {
+	case task := <-PluginTaskChan:
+		if task.ObjectName != "collector" {
+			t.Fatalf("unexpected task: %v", task)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled task is not delivered")
+	}
+}
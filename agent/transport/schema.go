@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"agent/proto"
+	"sync/atomic"
+
+	"github.com/chriskaliX/SDK/schema"
+	"go.uber.org/zap"
+)
+
+var (
+	// records upgraded to the latest schemas, and the ones invalid, since
+	// the agent starts
+	schemaUpgraded uint64
+	schemaInvalid  uint64
+)
+
+// checkSchema upgrades the record of an older schema version to the latest
+// one known by the agent, and reports whether it's valid against it. The
+// records unversioned, of unknown data types, or of newer versions than
+// the agent knows are passed as they are.
+func checkSchema(rec *proto.Record) bool {
+	version := rec.GetSchemaVersion()
+	if version == 0 {
+		return true
+	}
+	latest := schema.Default.Latest(rec.GetDataType())
+	if latest == 0 || version > latest {
+		return true
+	}
+	if rec.Data == nil {
+		rec.Data = &proto.Payload{}
+	}
+	if rec.Data.Fields == nil {
+		rec.Data.Fields = make(map[string]string)
+	}
+	if version < latest {
+		if _, err := schema.Default.Upgrade(rec.DataType, version, rec.Data.Fields); err != nil {
+			return true
+		}
+		rec.SchemaVersion = latest
+		atomic.AddUint64(&schemaUpgraded, 1)
+	}
+	if err := schema.Default.Validate(rec.DataType, latest, rec.Data.Fields); err != nil {
+		atomic.AddUint64(&schemaInvalid, 1)
+		zap.S().Debugf("record %d of %s is invalid: %s", rec.DataType, rec.Plugin, err.Error())
+		return false
+	}
+	return true
+}
+
+// SchemaStats returns the records upgraded to the latest schemas, and the
+// ones invalid against them since the agent starts
+func SchemaStats() (upgraded, invalid uint64) {
+	return atomic.LoadUint64(&schemaUpgraded), atomic.LoadUint64(&schemaInvalid)
+}
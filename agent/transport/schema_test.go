@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"agent/proto"
+	"testing"
+
+	"github.com/chriskaliX/SDK/schema"
+)
+
+func init() {
+	schema.Default.MustRegister(
+		&schema.Schema{DataType: 90001, Version: 1, Fields: []schema.Field{
+			{Name: "exe", Type: schema.String, Required: true},
+		}},
+		&schema.Schema{DataType: 90001, Version: 2, Fields: []schema.Field{
+			{Name: "path", Type: schema.String, Required: true},
+			{Name: "pid", Type: schema.Int, Required: true},
+		}, Renamed: map[string]string{"exe": "path"}, Defaults: map[string]string{"pid": "0"}},
+	)
+}
+
+func TestCheckSchema(t *testing.T) {
+	upgraded, invalid := SchemaStats()
+	rec := &proto.Record{DataType: 90001, SchemaVersion: 1, Data: &proto.Payload{Fields: map[string]string{"exe": "/bin/sh"}}}
+	if !checkSchema(rec) {
+		t.Fatal("upgraded record is invalid")
+	}
+	if rec.SchemaVersion != 2 || rec.Data.Fields["path"] != "/bin/sh" || rec.Data.Fields["pid"] != "0" {
+		t.Fatalf("unexpected upgraded record: %d, %v", rec.SchemaVersion, rec.Data.Fields)
+	}
+	// unversioned, unknown and newer ones are passed as they are
+	for _, rec := range []*proto.Record{
+		{DataType: 90001},
+		{DataType: 90002, SchemaVersion: 1},
+		{DataType: 90001, SchemaVersion: 3},
+	} {
+		if !checkSchema(rec) {
+			t.Fatalf("record %d of version %d is invalid", rec.DataType, rec.SchemaVersion)
+		}
+	}
+	if checkSchema(&proto.Record{DataType: 90001, SchemaVersion: 2, Data: &proto.Payload{Fields: map[string]string{"path": "/bin/sh", "pid": "x"}}}) {
+		t.Fatal("record with invalid pid is valid")
+	}
+	if u, i := SchemaStats(); u-upgraded != 1 || i-invalid != 1 {
+		t.Fatalf("unexpected stats: %d upgraded, %d invalid", u-upgraded, i-invalid)
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.StrictSchema = true
+	invalid := func() *proto.Record {
+		return &proto.Record{DataType: 90001, SchemaVersion: 2, Data: &proto.Payload{Fields: map[string]string{"pid": "1"}}}
+	}
+	transfer.Transmission(invalid(), false)
+	transfer.Transmission(invalid(), true)
+	transfer.StrictSchema = false
+	transfer.Transmission(invalid(), false)
+	if transfer.offset != 2 {
+		t.Fatalf("unexpected buffered records: %d", transfer.offset)
+	}
+}
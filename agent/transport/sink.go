@@ -0,0 +1,326 @@
+package transport
+
+import (
+	"agent/transport/connection"
+	"agent/utils"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Sink takes the records routed to it other than the server. Write is called
+// by one goroutine at a time, with the batch of records in json.
+type Sink interface {
+	Write(batch [][]byte) error
+	Close() error
+}
+
+// SinkFactory creates the sink by the options in the routing policy
+type SinkFactory func(options map[string]string) (Sink, error)
+
+// Batching of the sinks, records are dropped once the queue is full
+const (
+	sinkQueueSize     = 4096
+	sinkBatchSize     = 256
+	sinkFlushInterval = time.Second
+	sinkCloseTimeout  = 5 * time.Second
+)
+
+var (
+	sinkMu    sync.RWMutex
+	sinkTypes = map[string]SinkFactory{
+		"file":     newFileSink,
+		"http":     newHTTPSink,
+		"syslog":   newSyslogSink,
+		"journald": newJournaldSink,
+		"otlp":     newOTLPSink,
+	}
+)
+
+// RegisterSink adds the type of sinks, which the routing policy refers to
+func RegisterSink(typ string, factory SinkFactory) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	sinkTypes[typ] = factory
+}
+
+// sinkTLSConfig verifies the server at the address by the options ca_file
+// and server_name, the system roots and the host of the address if not set.
+// With client_cert "agent", the client certificate of the agent is presented
+// for the mutual TLS, which is the enrolled one if it's enrolled.
+func sinkTLSConfig(address string, options map[string]string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if name := options["server_name"]; name != "" {
+		config.ServerName = name
+	}
+	if path := options["ca_file"]; path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", path)
+		}
+	}
+	switch options["client_cert"] {
+	case "":
+	case "agent":
+		config.GetClientCertificate = connection.ClientCertificate
+	default:
+		return nil, fmt.Errorf("client_cert %s is not supported", options["client_cert"])
+	}
+	return config, nil
+}
+
+func newSink(typ string, options map[string]string) (Sink, error) {
+	sinkMu.RLock()
+	factory, ok := sinkTypes[typ]
+	sinkMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("sink type %s is not supported", typ)
+	}
+	return factory(options)
+}
+
+// asyncSink batches the records, so the receive of plugins never blocks on
+// the sink
+type asyncSink struct {
+	name    string
+	sink    Sink
+	queue   chan []byte
+	stop    chan struct{}
+	done    chan struct{}
+	dropped uint64
+	failed  uint64
+}
+
+func newAsyncSink(name string, sink Sink) *asyncSink {
+	s := &asyncSink{
+		name:  name,
+		sink:  sink,
+		queue: make(chan []byte, sinkQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *asyncSink) put(data []byte) {
+	select {
+	case <-s.stop:
+		atomic.AddUint64(&s.dropped, 1)
+	case s.queue <- data:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *asyncSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(sinkFlushInterval)
+	defer ticker.Stop()
+	batch := make([][]byte, 0, sinkBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.sink.Write(batch); err != nil {
+			atomic.AddUint64(&s.failed, uint64(len(batch)))
+			zap.S().Errorf("sink %s: %d records are dropped: %s", s.name, len(batch), err.Error())
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case data := <-s.queue:
+			if batch = append(batch, data); len(batch) >= sinkBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			// the records queued already are written before it's closed
+			for {
+				select {
+				case data := <-s.queue:
+					batch = append(batch, data)
+					if len(batch) >= sinkBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// close flushes the queue and closes the sink, it gives up after
+// sinkCloseTimeout if the sink hangs
+func (s *asyncSink) close() {
+	close(s.stop)
+	select {
+	case <-s.done:
+	case <-time.After(sinkCloseTimeout):
+		zap.S().Warnf("sink %s is not flushed in time", s.name)
+	}
+	if err := s.sink.Close(); err != nil {
+		zap.S().Errorf("close sink %s: %s", s.name, err.Error())
+	}
+}
+
+// fileSink appends the records to the file in lines, options: path, and
+// the ones of recordFormat
+type fileSink struct {
+	f      *os.File
+	format recordFormat
+}
+
+func newFileSink(options map[string]string) (Sink, error) {
+	path := options["path"]
+	if path == "" {
+		return nil, errors.New("path of file sink is not set")
+	}
+	format, err := newRecordFormat(options)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f, format: format}, nil
+}
+
+func (s *fileSink) Write(batch [][]byte) error {
+	var buf bytes.Buffer
+	for _, data := range batch {
+		line, err := s.format.format(nil, data)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	_, err := s.f.Write(buf.Bytes())
+	return err
+}
+
+func (s *fileSink) Close() error { return s.f.Close() }
+
+// httpSink posts the batch to the url through the proxy of the agent,
+// options: url, and format which is "lines" for json lines by default, or
+// "kafka" for the body of the kafka rest proxy, as
+// {"records": [{"value": <record>}]}, so the url is the one of the topic.
+// The lines are formatted by the options of recordFormat, kafka takes json
+// only. The server of https is verified by the options of sinkTLSConfig.
+type httpSink struct {
+	url    string
+	kafka  bool
+	format recordFormat
+	client *http.Client
+}
+
+func newHTTPSink(options map[string]string) (Sink, error) {
+	s := &httpSink{url: options["url"], client: utils.NewHTTPClient()}
+	if s.url == "" {
+		return nil, errors.New("url of http sink is not set")
+	}
+	switch options["format"] {
+	case "", "lines":
+	case "kafka":
+		s.kafka = true
+	default:
+		return nil, fmt.Errorf("format %s of http sink is not supported", options["format"])
+	}
+	var err error
+	if s.format, err = newRecordFormat(options); err != nil {
+		return nil, err
+	}
+	if s.kafka && !s.format.isJSON() {
+		return nil, errors.New("kafka format of http sink takes json only")
+	}
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		// the port is not verified, only the host is
+		config, err := sinkTLSConfig(net.JoinHostPort(u.Hostname(), "443"), options)
+		if err != nil {
+			return nil, err
+		}
+		s.client.Transport.(*http.Transport).TLSClientConfig = config
+	}
+	return s, nil
+}
+
+func (s *httpSink) Write(batch [][]byte) error {
+	var buf bytes.Buffer
+	contentType := "application/x-ndjson"
+	if s.kafka {
+		contentType = "application/vnd.kafka.json.v2+json"
+		buf.WriteString(`{"records":[`)
+		for i, data := range batch {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(`{"value":`)
+			buf.Write(data)
+			buf.WriteByte('}')
+		}
+		buf.WriteString(`]}`)
+	} else {
+		if !s.format.isJSON() {
+			contentType = "text/plain"
+		}
+		for _, data := range batch {
+			line, err := s.format.format(nil, data)
+			if err != nil {
+				return err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http sink: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
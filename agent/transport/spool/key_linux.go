@@ -0,0 +1,29 @@
+package spool
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// keyDescription names the key in the user keyring of the kernel
+var keyDescription = "hades-agent:spool"
+
+// BootKey returns the key kept in the user keyring of the kernel, which is
+// created on the first call after the boot. It survives the restarts of the
+// agent and is gone with a reboot, the records spooled before it are not
+// replayed then.
+func BootKey() ([]byte, error) {
+	if id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyDescription, 0); err == nil {
+		key := make([]byte, KeySize)
+		if n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, key, 0); err == nil && n == KeySize {
+			return key, nil
+		}
+	}
+	key, err := RandomKey()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = unix.AddKey("user", keyDescription, key, unix.KEY_SPEC_USER_KEYRING); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
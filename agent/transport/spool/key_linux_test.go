@@ -0,0 +1,28 @@
+package spool
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBootKey(t *testing.T) {
+	keyDescription = "hades-agent:spool-test"
+	defer func() {
+		if id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyDescription, 0); err == nil {
+			unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+		}
+	}()
+	key, err := BootKey()
+	if err != nil {
+		t.Skip("keyring is not available: ", err)
+	}
+	again, err := BootKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != KeySize || !bytes.Equal(key, again) {
+		t.Fatal("key is not kept in the keyring")
+	}
+}
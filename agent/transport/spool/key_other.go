@@ -0,0 +1,11 @@
+//go:build !linux
+
+package spool
+
+import "errors"
+
+// BootKey is not supported without the kernel keyring, RandomKey is the
+// fallback
+func BootKey() ([]byte, error) {
+	return nil, errors.New("kernel keyring is not supported on this platform")
+}
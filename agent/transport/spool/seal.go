@@ -0,0 +1,106 @@
+package spool
+
+import (
+	"agent/proto"
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/chriskaliX/SDK/framing"
+)
+
+// KeySize is the size of the AES-256 key of the segments
+const KeySize = 32
+
+var ErrDecrypt = errors.New("spooled records can't be decrypted")
+
+// sealedFraming is the frame of an encrypted record, which is a nonce
+// followed by the record sealed by AES-GCM. Read as a plain length prefix,
+// the magic is far larger than any record, so both kinds of frames are told
+// apart in a segment.
+var sealedFraming = &framing.Options{Magic: []byte{'H', 'D', 'E', 0xff}}
+
+// sealed is the payload of a sealed frame, for framing.Encode
+type sealed []byte
+
+func (s sealed) Size() int { return len(s) }
+
+func (s sealed) MarshalToSizedBuffer(dAtA []byte) (int, error) { return copy(dAtA, s), nil }
+
+// SetKey encrypts the records written after it by AES-256-GCM with the key,
+// nil writes them in plaintext. The records encrypted by another key, and
+// the plaintext ones, are dropped on replay, so a key of the boot is kept
+// across the restarts of the agent, see BootKey.
+func (s *Spool) SetKey(key []byte) (err error) {
+	var aead cipher.AEAD
+	if key != nil {
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err != nil {
+			return
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aead = aead
+	return
+}
+
+// RandomKey returns a key kept in memory only, the records encrypted by it
+// are not replayed once the agent restarts
+func RandomKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	return key, err
+}
+
+// encode returns the frame of the record, which is sealed if a key is set.
+// mu must be held.
+func (s *Spool) encode(rec *proto.Record) ([]byte, error) {
+	if s.aead == nil {
+		return proto.EncodeRecord(rec)
+	}
+	data, err := rec.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return framing.Encode(sealed(s.aead.Seal(nonce, nonce, data, nil)), sealedFraming)
+}
+
+// readRecord reads the payload of next record in the segment, a sealed one
+// is opened by aead. ErrDecrypt is returned for the one which can't be
+// opened, and the frames after it are still read. Once a key is set, a
+// plaintext one is rejected the same way, anyone who can write the spool
+// could forge it.
+func readRecord(r *bufio.Reader, aead cipher.AEAD) ([]byte, error) {
+	if prefix, err := r.Peek(len(sealedFraming.Magic)); err != nil || !bytes.Equal(prefix, sealedFraming.Magic) {
+		payload, err := framing.ReadFrame(r, maxRecordSize, nil)
+		if err == nil && aead != nil {
+			return nil, ErrDecrypt
+		}
+		return payload, err
+	}
+	// the nonce and the tag of GCM are far less than it
+	payload, err := framing.ReadFrame(r, maxRecordSize+64, sealedFraming)
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil || len(payload) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	n := aead.NonceSize()
+	if payload, err = aead.Open(payload[n:n], payload[:n], payload[n:], nil); err != nil {
+		return nil, ErrDecrypt
+	}
+	return payload, nil
+}
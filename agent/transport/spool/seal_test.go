@@ -0,0 +1,91 @@
+package spool
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSealed(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := RandomKey()
+	if err = s.SetKey(key); err != nil {
+		t.Fatal(err)
+	}
+	path := s.path(s.activeID)
+	s.Write(newRecords(0, 3))
+	s.Close()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, []byte("seq")) || bytes.Count(content, sealedFraming.Magic) != 3 {
+		t.Fatalf("records are not sealed: %q", content)
+	}
+	if s, err = New(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.SetKey(key)
+	expectSeqs(t, drain(t, s), 0, 3)
+}
+
+func TestUnsealedRejected(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := RandomKey()
+	s.SetKey(key)
+	s.Write(newRecords(0, 1))
+	// written as by anyone who can write the spool, the ones after it are
+	// still read
+	s.SetKey(nil)
+	s.Write(newRecords(1, 1))
+	s.SetKey(key)
+	s.Write(newRecords(2, 1))
+	s.Close()
+	if s, err = New(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.SetKey(key)
+	_, recs, err := s.Peek()
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expect decrypt error, got %v", err)
+	}
+	if len(recs) != 2 || recs[0].Data.Fields["seq"] != "0" || recs[1].Data.Fields["seq"] != "2" {
+		t.Fatalf("unexpected records: %v", recs)
+	}
+}
+
+func TestSealedByAnotherKey(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := RandomKey()
+	s.SetKey(old)
+	s.Write(newRecords(0, 2))
+	// the old key is gone with a reboot
+	key, _ := RandomKey()
+	s.SetKey(key)
+	s.Write(newRecords(2, 1))
+	s.Close()
+	if s, err = New(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.SetKey(key)
+	_, recs, err := s.Peek()
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expect decrypt error, got %v", err)
+	}
+	if len(recs) != 1 || recs[0].Data.Fields["seq"] != "2" {
+		t.Fatalf("unexpected records: %v", recs)
+	}
+}
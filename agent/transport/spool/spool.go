@@ -0,0 +1,276 @@
+// Package spool persists records on disk while the uplink is down. Records
+// are appended to segment files, which are rotated by size and age, and read
+// back oldest first once the uplink is restored. The records are encrypted
+// at rest if a key is set.
+package spool
+
+import (
+	"agent/proto"
+	"bufio"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const segmentExt = ".seg"
+
+// defaults if the options are not set
+const (
+	defaultSegmentSize = 4 * 1024 * 1024
+	defaultSegmentAge  = time.Minute
+	defaultMaxSize     = 256 * 1024 * 1024
+)
+
+// a frame larger than this is considered corrupted
+const maxRecordSize = 32 * 1024 * 1024
+
+var ErrEmpty = errors.New("no segment to replay")
+
+// Spool is safe for concurrent use. Segments are named by a sequence number,
+// so they are replayed in the order written, across restarts as well.
+type Spool struct {
+	dir string
+	// SegmentSize and SegmentAge rotate the active segment, MaxSize caps the
+	// total size and the oldest segments are dropped beyond it
+	SegmentSize int64
+	SegmentAge  time.Duration
+	MaxSize     int64
+
+	mu       sync.Mutex
+	segments []uint64 // closed segments, oldest first
+	sizes    map[uint64]int64
+	active   *os.File
+	activeID uint64
+	size     int64 // of the active segment
+	openedAt time.Time
+	total    int64
+	dropped  uint64
+	// the records are sealed by it if a key is set
+	aead cipher.AEAD
+}
+
+// New opens the spool in dir, segments left by the last run are kept for
+// replay
+func New(dir string) (s *Spool, err error) {
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return
+	}
+	s = &Spool{dir: dir, sizes: map[uint64]int64{}}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := parseSegment(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+		s.sizes[id] = info.Size()
+		s.total += info.Size()
+		if id >= s.activeID {
+			s.activeID = id + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+	return
+}
+
+func parseSegment(name string) (id uint64, ok bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return id, err == nil
+}
+
+func (s *Spool) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (s *Spool) segmentSize() int64 {
+	if s.SegmentSize > 0 {
+		return s.SegmentSize
+	}
+	return defaultSegmentSize
+}
+
+func (s *Spool) segmentAge() time.Duration {
+	if s.SegmentAge > 0 {
+		return s.SegmentAge
+	}
+	return defaultSegmentAge
+}
+
+func (s *Spool) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return defaultMaxSize
+}
+
+// Write appends the records to the active segment. Records which fail to
+// encode are skipped.
+func (s *Spool) Write(recs []*proto.Record) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range recs {
+		var buf []byte
+		if buf, err = s.encode(rec); err != nil {
+			continue
+		}
+		if s.active == nil {
+			if err = s.open(); err != nil {
+				return
+			}
+		}
+		var n int
+		n, err = s.active.Write(buf)
+		s.size += int64(n)
+		s.total += int64(n)
+		if err != nil {
+			return
+		}
+		if s.size >= s.segmentSize() || time.Since(s.openedAt) >= s.segmentAge() {
+			if err = s.rotate(); err != nil {
+				return
+			}
+		}
+	}
+	s.trim()
+	return
+}
+
+func (s *Spool) open() (err error) {
+	if s.active, err = os.OpenFile(s.path(s.activeID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return
+	}
+	s.size = 0
+	s.openedAt = time.Now()
+	return
+}
+
+// rotate closes the active segment, so it's available for replay. mu must
+// be held.
+func (s *Spool) rotate() (err error) {
+	if s.active == nil {
+		return
+	}
+	err = s.active.Close()
+	s.active = nil
+	s.segments = append(s.segments, s.activeID)
+	s.sizes[s.activeID] = s.size
+	s.activeID++
+	s.size = 0
+	return
+}
+
+// trim drops the oldest segments beyond MaxSize, mu must be held
+func (s *Spool) trim() {
+	for s.total > s.maxSize() && len(s.segments) > 0 {
+		id := s.segments[0]
+		s.segments = s.segments[1:]
+		s.total -= s.sizes[id]
+		delete(s.sizes, id)
+		os.Remove(s.path(id))
+		s.dropped++
+	}
+}
+
+// Rotate closes the active segment if it's not empty, so all the records
+// written are available for replay
+func (s *Spool) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+// Peek reads the records of the oldest closed segment. A partial frame at
+// the end, from a crash in the middle of a write, is ignored. For a
+// corrupted segment, the records before the corruption are returned along
+// with the error. The sealed records which can't be decrypted, and the
+// plaintext ones once a key is set, are skipped, and ErrDecrypt is returned
+// along with the others.
+func (s *Spool) Peek() (id uint64, recs []*proto.Record, err error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return 0, nil, ErrEmpty
+	}
+	id = s.segments[0]
+	aead := s.aead
+	s.mu.Unlock()
+	var f *os.File
+	if f, err = os.Open(s.path(id)); err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	undecrypted := 0
+	for {
+		var payload []byte
+		if payload, err = readRecord(r, aead); err == ErrDecrypt {
+			undecrypted++
+			continue
+		} else if err != nil {
+			break
+		}
+		rec := &proto.Record{}
+		if rec.Unmarshal(payload) == nil {
+			recs = append(recs, rec)
+		}
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	if err == nil && undecrypted != 0 {
+		err = fmt.Errorf("%w: %d records of segment %d", ErrDecrypt, undecrypted, id)
+	}
+	return
+}
+
+// Remove deletes the segment once it's replayed
+func (s *Spool) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, seg := range s.segments {
+		if seg == id {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.total -= s.sizes[id]
+			delete(s.sizes, id)
+			break
+		}
+	}
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return err
+}
+
+// Size returns the bytes on disk, and the count of segments dropped by
+// MaxSize
+func (s *Spool) Size() (total int64, dropped uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total, s.dropped
+}
+
+// Close closes the active segment, it's replayed after the next New
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
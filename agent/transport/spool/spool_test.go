@@ -0,0 +1,143 @@
+package spool
+
+import (
+	"agent/proto"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newRecords(from, n int) (recs []*proto.Record) {
+	for i := from; i < from+n; i++ {
+		recs = append(recs, &proto.Record{DataType: 1000, Data: &proto.Payload{
+			Fields: map[string]string{"seq": strconv.Itoa(i)},
+		}})
+	}
+	return
+}
+
+// drain peeks and removes all the segments, returns the seq of the records
+func drain(t *testing.T, s *Spool) (seqs []string) {
+	for {
+		id, recs, err := s.Peek()
+		if err == ErrEmpty {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range recs {
+			seqs = append(seqs, rec.Data.Fields["seq"])
+		}
+		if err = s.Remove(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectSeqs(t *testing.T, seqs []string, from, n int) {
+	if len(seqs) != n {
+		t.Fatalf("%d records are replayed, expect %d", len(seqs), n)
+	}
+	for i, seq := range seqs {
+		if seq != strconv.Itoa(from+i) {
+			t.Fatalf("record %d is %s, out of order", i, seq)
+		}
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SegmentSize = 64
+	if err = s.Write(newRecords(0, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.segments) < 2 {
+		t.Fatalf("segments are not rotated: %v", s.segments)
+	}
+	// the active segment is replayed after rotation
+	if err = s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	expectSeqs(t, drain(t, s), 0, 10)
+	if total, _ := s.Size(); total != 0 {
+		t.Fatalf("%d bytes left after replay", total)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SegmentAge = 10 * time.Millisecond
+	s.Write(newRecords(0, 1))
+	if len(s.segments) != 0 {
+		t.Fatal("segment is rotated before it's aged")
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.Write(newRecords(1, 1))
+	if len(s.segments) != 1 {
+		t.Fatalf("aged segment is not rotated: %v", s.segments)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(newRecords(0, 3))
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// segments of the last run come first
+	if s, err = New(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.Write(newRecords(3, 2))
+	s.Rotate()
+	expectSeqs(t, drain(t, s), 0, 5)
+}
+
+func TestMaxSize(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SegmentSize = 1
+	s.MaxSize = 100
+	s.Write(newRecords(0, 20))
+	total, dropped := s.Size()
+	if total > 100 || dropped == 0 {
+		t.Fatalf("spool is not trimmed: %d bytes, %d dropped", total, dropped)
+	}
+	// the newest ones are kept
+	seqs := drain(t, s)
+	if len(seqs) == 0 || seqs[len(seqs)-1] != "19" {
+		t.Fatalf("unexpected records kept: %v", seqs)
+	}
+}
+
+func TestPartialFrame(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(newRecords(0, 2))
+	path := s.path(s.activeID)
+	s.Rotate()
+	// a crash in the middle of the third write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{100, 0, 0, 0, 1, 2})
+	f.Close()
+	expectSeqs(t, drain(t, s), 0, 2)
+}
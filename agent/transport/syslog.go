@@ -0,0 +1,350 @@
+package transport
+
+import (
+	"agent/proto"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the severities of syslog, which are the priorities of journald as well
+var severities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// sdID is the id of the structured data of the records, 32473 is the
+// enterprise number reserved for examples by RFC 5612
+const sdID = "hades@32473"
+
+// syslog writes time out, and the connection is dialed again on the next
+// batch
+const syslogTimeout = 10 * time.Second
+
+// fieldMapping picks the fields of the record carried by the syslog and
+// journald sinks, options:
+//
+//   - fields: comma separated fields, as "exe,argv,pid:process_id" which
+//     renames pid, all the fields by their names if not set
+//   - message_field: the field as the message, the record formatted by the
+//     options of recordFormat if not set
+//   - severity: the severity of the records, info if not set
+//   - severity_field: the field of the severity, by the name or the number,
+//     the severity option is the fallback
+type fieldMapping struct {
+	// pairs of the field and the name, nil for all
+	fields        [][2]string
+	messageField  string
+	format        recordFormat
+	severity      int
+	severityField string
+}
+
+func newFieldMapping(options map[string]string) (m fieldMapping, err error) {
+	for _, field := range strings.Split(options["fields"], ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		name := field
+		if i := strings.IndexByte(field, ':'); i >= 0 {
+			field, name = field[:i], field[i+1:]
+		}
+		if field == "" || name == "" {
+			return m, fmt.Errorf("invalid field mapping %s", options["fields"])
+		}
+		m.fields = append(m.fields, [2]string{field, name})
+	}
+	m.messageField = options["message_field"]
+	if m.format, err = newRecordFormat(options); err != nil {
+		return
+	}
+	m.severityField = options["severity_field"]
+	m.severity = 6
+	if s, ok := options["severity"]; ok {
+		if m.severity = parseSeverity(s); m.severity < 0 {
+			return m, fmt.Errorf("unknown severity %s", s)
+		}
+	}
+	return
+}
+
+// parseSeverity accepts the name or the number, -1 if it's neither
+func parseSeverity(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= len(severities) {
+			return -1
+		}
+		return n
+	}
+	s = strings.ToLower(s)
+	for i, name := range severities {
+		if name == s {
+			return i
+		}
+	}
+	switch s {
+	case "emergency":
+		return 0
+	case "critical":
+		return 2
+	case "error":
+		return 3
+	case "warn":
+		return 4
+	case "informational":
+		return 6
+	}
+	return -1
+}
+
+// each calls fn with the fields mapped, in the order of the option, or by
+// the names if all the fields are mapped
+func (m *fieldMapping) each(rec *proto.Record, fn func(name, value string)) {
+	fields := rec.GetData().GetFields()
+	if m.fields == nil {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fn(name, fields[name])
+		}
+		return
+	}
+	for _, pair := range m.fields {
+		if value, ok := fields[pair[0]]; ok {
+			fn(pair[1], value)
+		}
+	}
+}
+
+func (m *fieldMapping) message(rec *proto.Record, data []byte) (string, error) {
+	if m.messageField != "" {
+		return rec.GetData().GetFields()[m.messageField], nil
+	}
+	msg, err := m.format.format(rec, data)
+	return string(msg), err
+}
+
+func (m *fieldMapping) severityOf(rec *proto.Record) int {
+	if m.severityField != "" {
+		if value, ok := rec.GetData().GetFields()[m.severityField]; ok {
+			if n := parseSeverity(value); n >= 0 {
+				return n
+			}
+		}
+	}
+	return m.severity
+}
+
+// syslogSink sends the records as RFC 5424 messages, options:
+//
+//   - address: host:port of the syslog server
+//   - network: udp by default, or tcp and tls, which are framed by octet
+//     counting of RFC 6587
+//   - ca_file and server_name: verify the certificate of tls, by the system
+//     roots and the host of the address if not set
+//   - facility: local0 if not set
+//   - app_name and hostname: hades-agent and the hostname if not set
+//
+// and the ones of fieldMapping. The msgid is the data type, and the fields
+// mapped are the params of the structured data hades@32473, with the data
+// type and the plugin.
+type syslogSink struct {
+	network  string
+	address  string
+	tls      *tls.Config
+	facility int
+	appName  string
+	hostname string
+	mapping  fieldMapping
+	conn     net.Conn
+}
+
+func newSyslogSink(options map[string]string) (Sink, error) {
+	s := &syslogSink{
+		network:  options["network"],
+		address:  options["address"],
+		facility: facilities["local0"],
+		appName:  headerValue(options["app_name"], 48),
+		hostname: headerValue(options["hostname"], 255),
+	}
+	if s.address == "" {
+		return nil, errors.New("address of syslog sink is not set")
+	}
+	switch s.network {
+	case "":
+		s.network = "udp"
+	case "udp", "tcp":
+	case "tls":
+		var err error
+		if s.tls, err = sinkTLSConfig(s.address, options); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("network %s of syslog sink is not supported", s.network)
+	}
+	if facility, ok := options["facility"]; ok {
+		if s.facility, ok = facilities[strings.ToLower(facility)]; !ok {
+			return nil, fmt.Errorf("unknown facility %s", facility)
+		}
+	}
+	if s.appName == "-" {
+		s.appName = "hades-agent"
+	}
+	if s.hostname == "-" {
+		if hostname, err := os.Hostname(); err == nil {
+			s.hostname = headerValue(hostname, 255)
+		}
+	}
+	var err error
+	s.mapping, err = newFieldMapping(options)
+	return s, err
+}
+
+func (s *syslogSink) dial() (err error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if s.tls != nil {
+		s.conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tls)
+	} else {
+		s.conn, err = dialer.Dial(s.network, s.address)
+	}
+	return
+}
+
+// Write sends the messages of the batch, it's retried once on a new
+// connection, since the server may close the idle one
+func (s *syslogSink) Write(batch [][]byte) error {
+	msgs := make([][]byte, 0, len(batch))
+	for _, data := range batch {
+		rec := &proto.Record{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return err
+		}
+		msg, err := s.format(rec, data, time.Now())
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	reused := s.conn != nil
+	err := s.send(msgs)
+	if err != nil && reused {
+		err = s.send(msgs)
+	}
+	return err
+}
+
+func (s *syslogSink) send(msgs [][]byte) (err error) {
+	if s.conn == nil {
+		if err = s.dial(); err != nil {
+			return
+		}
+	}
+	defer func() {
+		if err != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+	}()
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	// a message per datagram
+	if s.network == "udp" {
+		for _, msg := range msgs {
+			if _, err = s.conn.Write(msg); err != nil {
+				return
+			}
+		}
+		return
+	}
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.Write(msg)
+	}
+	_, err = s.conn.Write(buf.Bytes())
+	return
+}
+
+// format formats the record as
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME - MSGID [hades@32473 ...] MSG
+func (s *syslogSink) format(rec *proto.Record, data []byte, now time.Time) ([]byte, error) {
+	msg, err := s.mapping.message(rec, data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	ts := now
+	if rec.GetTimestamp() != 0 {
+		ts = time.Unix(rec.GetTimestamp(), 0)
+	}
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s - %d [%s", s.facility*8+s.mapping.severityOf(rec),
+		ts.UTC().Format(time.RFC3339), s.hostname, s.appName, rec.GetDataType(), sdID)
+	writeParam(&buf, "data_type", strconv.Itoa(int(rec.GetDataType())))
+	if rec.GetPlugin() != "" {
+		writeParam(&buf, "plugin", rec.GetPlugin())
+	}
+	s.mapping.each(rec, func(name, value string) { writeParam(&buf, name, value) })
+	buf.WriteString("] ")
+	buf.WriteString(msg)
+	return buf.Bytes(), nil
+}
+
+// writeParam writes the param of the structured data, the invalid chars of
+// the name are replaced, and the value is escaped
+func writeParam(buf *bytes.Buffer, name, value string) {
+	buf.WriteByte(' ')
+	for i := 0; i < len(name) && i < 32; i++ {
+		c := name[i]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteString(`="`)
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('"')
+}
+
+// headerValue makes the value of a header field, printable ascii up to the
+// size, and "-" if it's empty
+func headerValue(s string, size int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < size; i++ {
+		if c := s[i]; c > ' ' && c <= '~' {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"agent/proto"
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func syslogRecord(t *testing.T) (*proto.Record, []byte) {
+	rec := &proto.Record{DataType: 700, Timestamp: 1700000000, Plugin: "collector", Data: &proto.Payload{Fields: map[string]string{
+		"exe": "/bin/sh", "argv": `sh -c "echo ]"`, "pid": "42", "level": "warning",
+	}}}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec, data
+}
+
+func TestSyslogFormat(t *testing.T) {
+	sink, err := newSyslogSink(map[string]string{
+		"address": "127.0.0.1:514", "facility": "auth", "hostname": "host 1", "app_name": "hades",
+		"fields": "exe,argv,pid:process_id", "message_field": "exe", "severity_field": "level",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, data := syslogRecord(t)
+	msg, err := sink.(*syslogSink).format(rec, data, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(msg)
+	want := `<36>1 2023-11-14T22:13:20Z host1 hades - 700 [hades@32473 data_type="700" plugin="collector" exe="/bin/sh" argv="sh -c \"echo \]\"" process_id="42"] /bin/sh`
+	if got != want {
+		t.Fatalf("unexpected message:\n%s\n%s", got, want)
+	}
+	// all the fields by the names, the record in json as the message
+	sink, _ = newSyslogSink(map[string]string{"address": "127.0.0.1:514"})
+	msg, _ = sink.(*syslogSink).format(rec, data, time.Now())
+	got = string(msg)
+	if !strings.HasPrefix(got, "<134>1 ") || !strings.Contains(got, ` argv="sh -c \"echo \]\"" exe="/bin/sh" level="warning" pid="42"] {`) || !strings.HasSuffix(got, string(data)) {
+		t.Fatalf("unexpected message: %s", got)
+	}
+}
+
+func TestSyslogOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{},
+		{"address": "127.0.0.1:514", "network": "sctp"},
+		{"address": "127.0.0.1:514", "facility": "local9"},
+		{"address": "127.0.0.1:514", "severity": "loud"},
+		{"address": "127.0.0.1:514", "fields": "exe,:name"},
+		{"address": "127.0.0.1", "network": "tls"},
+	} {
+		if _, err := newSyslogSink(options); err == nil {
+			t.Errorf("options should be invalid: %v", options)
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := newSyslogSink(map[string]string{"address": conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	_, data := syslogRecord(t)
+	if err = sink.Write([][]byte{data, data}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65536)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(buf[:n]), "<134>1 ") || !strings.HasSuffix(string(buf[:n]), string(data)) {
+			t.Fatalf("unexpected datagram: %s", buf[:n])
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	msgs := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				size, err := r.ReadString(' ')
+				if err != nil {
+					break
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				msg := make([]byte, n)
+				if _, err = io.ReadFull(r, msg); err != nil {
+					break
+				}
+				msgs <- string(msg)
+			}
+			conn.Close()
+		}
+	}()
+	sink, err := newSyslogSink(map[string]string{"address": l.Addr().String(), "network": "tcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	_, data := syslogRecord(t)
+	for i := 0; i < 2; i++ {
+		if err = sink.Write([][]byte{data}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-msgs:
+			if !strings.HasSuffix(msg, string(data)) {
+				t.Fatalf("unexpected message: %s", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("message is not received")
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"agent/agent"
 	"agent/host"
 	"agent/proto"
+	"agent/transport/compressor"
 	"agent/transport/pool"
+	"agent/transport/spool"
+	"context"
 	"errors"
 	"sync"
 	"sync/atomic"
@@ -17,15 +20,31 @@ import (
 var (
 	ErrBufferOverflow = errors.New("buffer overflow")
 	ErrAgentDataType  = errors.New("agent datatype is not support")
+	ErrUnhealthy      = errors.New("stream to the server is down")
 )
 
 var (
 	PluginTaskChan   = make(chan *proto.Task)
 	PluginConfigChan = make(chan map[string]*proto.Config)
+	// the response actions are taken by the agent itself, see package
+	// response. They are queued, so a slow action doesn't hold the stream.
+	ResponseTaskChan = make(chan *proto.Task, responseQueueSize)
 )
 
 const size = 8186 // remain 6 space for importance, always available
 
+// response actions queued, the receive waits for room once it's full
+const responseQueueSize = 64
+
+// defaults of the batching, if they are not set
+const (
+	defaultBatchSize     = 2048
+	defaultFlushInterval = 100 * time.Millisecond
+)
+
+// interval of checking the spool for replay
+var replayInterval = time.Second
+
 var DTransfer = NewTransfer()
 
 type Transfer struct {
@@ -35,19 +54,108 @@ type Transfer struct {
 	txCnt      uint64
 	rxCnt      uint64
 	updateTime time.Time
+	// set while the stream to the server is up
+	healthy int32
+	// set once the server acknowledges the registration of the stream
+	registered int32
+	// set once the agent is shutting down, commands are dropped
+	draining int32
+	// records taken from buf and not sent yet, guarded by mu
+	inflight int
+	// queued counts the records ever buffered, the ones before sent are
+	// sent or spooled already, both guarded by mu
+	queued uint64
+	sent   uint64
+	// BatchSize caps the records in a message, and a flush is triggered as
+	// soon as as many are buffered. FlushInterval is the max latency of a
+	// record in the buffer. Both are set before the transport starts.
+	BatchSize     int
+	FlushInterval time.Duration
+	// receives once a full batch is buffered
+	flushCh chan struct{}
+	// Spool persists the records which can't be buffered or sent, they are
+	// dropped if it's nil
+	Spool *spool.Spool
+	// HighWatermark is the buffered records above which plugins are
+	// throttled while the uplink is up, until half of it is left. 3/4 of the
+	// buffer if not set.
+	HighWatermark int
+	// closed once the throttle is released, nil if not throttled, guarded
+	// by mu
+	throttle chan struct{}
+	// CompressRecords compresses the data of large records one by one, on
+	// top of the compression of the stream, so the server may store them
+	// as they are
+	CompressRecords bool
+	// StrictSchema drops the records from plugins invalid against the
+	// schemas of their data types, they are counted only if it's not set
+	StrictSchema bool
 }
 
 func NewTransfer() *Transfer {
 	return &Transfer{
 		buf:        [8192]*proto.Record{},
 		updateTime: time.Now(),
+		flushCh:    make(chan struct{}, 1),
 	}
 }
 
-// Save the record to the buffer, control the buffer
+func (t *Transfer) batchSize() int {
+	if t.BatchSize > 0 {
+		return t.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (t *Transfer) highWatermark() int {
+	if t.HighWatermark > 0 && t.HighWatermark <= size {
+		return t.HighWatermark
+	}
+	return size / 4 * 3
+}
+
+func (t *Transfer) flushInterval() time.Duration {
+	if t.FlushInterval > 0 {
+		return t.FlushInterval
+	}
+	return defaultFlushInterval
+}
+
+// Transmission saves the record from plugins to the buffer. The origin is
+// always overwritten, so a plugin can't pretend to be the agent. The record
+// suppressed by the sample policy is dropped silently.
 func (t *Transfer) Transmission(rec *proto.Record, important bool) (err error) {
+	rec.Origin = proto.Origin_PLUGIN
+	if !checkSchema(rec) && t.StrictSchema && !important {
+		return
+	}
+	if !important && !sample(rec) {
+		return
+	}
+	return t.transmit(rec, important)
+}
+
+// TransmitAgent saves the record synthesized by the agent to the buffer,
+// such as status, lifecycle events and logs
+func (t *Transfer) TransmitAgent(rec *proto.Record, important bool) (err error) {
+	rec.Origin = proto.Origin_AGENT
+	return t.transmit(rec, important)
+}
+
+// Save the record to the buffer, control the buffer. The record is labeled
+// and redacted before anything else, and the one routed to other sinks only
+// is not buffered.
+func (t *Transfer) transmit(rec *proto.Record, important bool) (err error) {
+	stampLabels(rec)
+	redact(rec)
+	if !route(rec) {
+		return
+	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.offset >= size && t.Spool != nil {
+		t.spill()
+	}
 	if t.offset >= size {
 		if important && t.offset < len(t.buf) {
 			t.buf[t.offset] = rec
@@ -57,10 +165,57 @@ func (t *Transfer) Transmission(rec *proto.Record, important bool) (err error) {
 	}
 	t.buf[t.offset] = rec
 	t.offset++
+	t.queued++
+	// the uplink is saturated. It's not throttled while the uplink is down,
+	// records are spooled or dropped then.
+	if t.throttle == nil && t.offset >= t.highWatermark() && t.IsHealthy() {
+		t.throttle = make(chan struct{})
+	}
+	if t.offset%t.batchSize() == 0 {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
 	return
 }
 
-// Send the record from buffer
+// SetHealthy is called by the transport once the stream is up or down
+func (t *Transfer) SetHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&t.healthy, v)
+	if !healthy {
+		atomic.StoreInt32(&t.registered, 0)
+	}
+	t.mu.Lock()
+	t.release()
+	t.mu.Unlock()
+}
+
+// Throttle returns a channel closed once the transfer takes records again,
+// nil if it's not saturated. Plugins stop reading their pipes until then.
+func (t *Transfer) Throttle() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.throttle
+}
+
+// release lifts the throttle once half of HighWatermark is left or the
+// uplink is down, mu must be held
+func (t *Transfer) release() {
+	if t.throttle != nil && (t.offset < t.highWatermark()/2 || !t.IsHealthy()) {
+		close(t.throttle)
+		t.throttle = nil
+	}
+}
+
+func (t *Transfer) IsHealthy() bool { return atomic.LoadInt32(&t.healthy) == 1 }
+
+// Send the record from buffer, in messages of BatchSize records at most.
+// Records are spooled if the stream fails in the middle.
 func (t *Transfer) Send(client proto.Transfer_TransferClient) (err error) {
 	// use lock carefully, unlock the field if we need
 	t.mu.Lock()
@@ -71,10 +226,44 @@ func (t *Transfer) Send(client proto.Transfer_TransferClient) (err error) {
 	recs := make([]*proto.Record, t.offset)
 	copy(recs, t.buf[:t.offset]) // copy, for reference
 	t.offset = 0
+	t.release()
+	t.inflight += len(recs)
 	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.inflight -= len(recs)
+		t.advance()
+		t.mu.Unlock()
+	}()
 	// Send the copy
+	for batch := recs; len(batch) > 0; {
+		n := t.batchSize()
+		if n > len(batch) {
+			n = len(batch)
+		}
+		if err = t.send(client, batch[:n]); err != nil {
+			t.spool(batch)
+			break
+		}
+		batch = batch[n:]
+	}
+	for _, rec := range recs {
+		pool.Put(rec)
+	}
+	return
+}
+
+func (t *Transfer) send(client proto.Transfer_TransferClient, recs []*proto.Record) (err error) {
+	msg := recs
+	if t.CompressRecords {
+		// the records are kept as they are, for the spool if it fails
+		msg = make([]*proto.Record, len(recs))
+		for i, rec := range recs {
+			msg[i] = compressor.CompressRecord(rec)
+		}
+	}
 	err = client.Send(&proto.PackagedData{
-		Records:      recs,
+		Records:      msg,
 		AgentId:      agent.Instance.ID,
 		IntranetIpv4: host.PrivateIPv4.Load().([]string),
 		IntranetIpv6: host.PrivateIPv6.Load().([]string),
@@ -89,12 +278,190 @@ func (t *Transfer) Send(client proto.Transfer_TransferClient) (err error) {
 	} else {
 		atomic.AddUint64(&t.txCnt, uint64(len(recs)))
 	}
-	for _, rec := range recs {
+	return
+}
+
+// Flush triggers a send and waits until all the buffered records are sent,
+// or the context is done. ErrUnhealthy is returned if the stream is down,
+// the records left are spooled by Close then.
+func (t *Transfer) Flush(ctx context.Context) error {
+	return t.flush(ctx, func() bool { return t.Pending() == 0 })
+}
+
+// Queued returns the watermark of the records buffered so far, see
+// FlushQueued
+func (t *Transfer) Queued() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.queued
+}
+
+// FlushQueued is Flush of the records buffered before the watermark only,
+// the ones buffered after them are not waited for. They are sent or
+// spooled once it returns nil.
+func (t *Transfer) FlushQueued(ctx context.Context, mark uint64) error {
+	return t.flush(ctx, func() bool {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.sent >= mark
+	})
+}
+
+func (t *Transfer) flush(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if done() {
+			return nil
+		}
+		if !t.IsHealthy() {
+			return ErrUnhealthy
+		}
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// advance moves the sent watermark to the head of buf, once nothing taken
+// before is in flight. mu must be held.
+func (t *Transfer) advance() {
+	if t.inflight == 0 {
+		t.sent = t.queued - uint64(t.offset)
+	}
+}
+
+// Pending returns the records buffered or being sent, the depth of the queue
+// to the server
+func (t *Transfer) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offset + t.inflight
+}
+
+// Drain stops accepting commands from the server, they are dropped from now
+// on. Records are still sent.
+func (t *Transfer) Drain() { atomic.StoreInt32(&t.draining, 1) }
+
+func (t *Transfer) IsDraining() bool { return atomic.LoadInt32(&t.draining) == 1 }
+
+// spill moves the buffered records to the spool, mu must be held
+func (t *Transfer) spill() {
+	if err := t.Spool.Write(t.buf[:t.offset]); err != nil {
+		zap.S().Error("spool failed: ", err)
+		return
+	}
+	for _, rec := range t.buf[:t.offset] {
 		pool.Put(rec)
 	}
+	t.offset = 0
+	t.advance()
+	t.release()
+}
+
+func (t *Transfer) spool(recs []*proto.Record) {
+	if t.Spool == nil {
+		return
+	}
+	if err := t.Spool.Write(recs); err != nil {
+		zap.S().Error("spool failed: ", err)
+	}
+}
+
+// Replay requeues the spooled records while the uplink is healthy, oldest
+// first. Half of the buffer is left for the records coming in. A segment is
+// removed once all of it is requeued, so it may be replayed twice if the
+// uplink goes down in the middle.
+func (t *Transfer) Replay(ctx context.Context) {
+	if t.Spool == nil {
+		return
+	}
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !t.IsHealthy() {
+			continue
+		}
+		if err := t.Spool.Rotate(); err != nil {
+			zap.S().Error("spool rotate failed: ", err)
+		}
+		t.replay(ctx)
+	}
+}
+
+func (t *Transfer) replay(ctx context.Context) {
+	for {
+		id, recs, err := t.Spool.Peek()
+		if err == spool.ErrEmpty {
+			return
+		}
+		if err != nil {
+			zap.S().Error("spool segment is corrupted: ", err)
+		}
+		for recs = recs[t.requeue(recs):]; len(recs) > 0; recs = recs[t.requeue(recs):] {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(t.flushInterval()):
+			}
+			if !t.IsHealthy() {
+				return
+			}
+		}
+		if err = t.Spool.Remove(id); err != nil {
+			zap.S().Error("spool remove failed: ", err)
+			return
+		}
+	}
+}
+
+// requeue buffers the records up to half of the buffer, and returns how
+// many are buffered
+func (t *Transfer) requeue(recs []*proto.Record) (n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if room := size/2 - t.offset; room > 0 {
+		if n = len(recs); n > room {
+			n = room
+		}
+		copy(t.buf[t.offset:], recs[:n])
+		t.offset += n
+		t.queued += uint64(n)
+	}
+	if n > 0 && t.offset >= t.batchSize() {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
 	return
 }
 
+// Close moves the buffered records to the spool and closes it, they are
+// replayed on the next start
+func (t *Transfer) Close() {
+	if t.Spool == nil {
+		return
+	}
+	t.mu.Lock()
+	t.spill()
+	t.mu.Unlock()
+	if err := t.Spool.Close(); err != nil {
+		zap.S().Error("spool close failed: ", err)
+	}
+}
+
 func (t *Transfer) Receive(client proto.Transfer_TransferClient) (err error) {
 	cmd, err := client.Recv()
 	if err != nil {
@@ -102,6 +469,10 @@ func (t *Transfer) Receive(client proto.Transfer_TransferClient) (err error) {
 	}
 	zap.S().Info("command received")
 	atomic.AddUint64(&t.rxCnt, 1)
+	if t.IsDraining() {
+		zap.S().Warn("agent is shutting down, command is dropped")
+		return
+	}
 	// resolve task & config
 	t.resolveTask(cmd)
 	t.resolveConfig(cmd)
@@ -122,6 +493,41 @@ func (t *Transfer) resolveTask(cmd *proto.Command) (err error) {
 			return
 		case config.TaskAgentRestart:
 		case config.TaskAgentSetenv:
+		case config.TaskAgentLabels:
+			if err = SetServerLabels(cmd.Task.Data); err != nil {
+				zap.S().Error("labels are not set: ", err)
+			}
+			return
+		case config.TaskAgentSchedule:
+			if err = SetSchedulePolicy(cmd.Task.Data); err != nil {
+				zap.S().Error("schedule policy is not set: ", err)
+			}
+			return
+		case config.TaskAgentRegistered:
+			t.setRegistered()
+			return
+		case config.TaskAgentResponse:
+			select {
+			case ResponseTaskChan <- cmd.Task:
+			case <-agent.Instance.Context.Done():
+				zap.S().Warn("agent is stopped, response action is dropped")
+			}
+			return
+		case config.TaskAgentRouting:
+			if err = SetRoutePolicy(cmd.Task.Data); err != nil {
+				zap.S().Error("route policy is not set: ", err)
+			}
+			return
+		case config.TaskAgentSampling:
+			if err = SetSamplePolicy(cmd.Task.Data); err != nil {
+				zap.S().Error("sample policy is not set: ", err)
+			}
+			return
+		case config.TaskAgentRedaction:
+			if err = SetRedactPolicy(cmd.Task.Data); err != nil {
+				zap.S().Error("redact policy is not set: ", err)
+			}
+			return
 		default:
 			zap.S().Error("resolveTask Agent DataType not supported: ", cmd.Task.DataType)
 			return ErrAgentDataType
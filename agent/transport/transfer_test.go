@@ -0,0 +1,317 @@
+package transport
+
+import (
+	"agent/proto"
+	"agent/transport/compressor"
+	"agent/transport/spool"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrigin(t *testing.T) {
+	transfer := NewTransfer()
+	// plugin records are always stamped as plugin, even if it's forged
+	transfer.Transmission(&proto.Record{DataType: 1000, Origin: proto.Origin_AGENT}, false)
+	transfer.TransmitAgent(&proto.Record{DataType: 1}, false)
+	if transfer.offset != 2 {
+		t.Fatalf("unexpected buffered records: %d", transfer.offset)
+	}
+	if transfer.buf[0].Origin != proto.Origin_PLUGIN {
+		t.Fatalf("plugin record stamped as %s", transfer.buf[0].Origin)
+	}
+	if transfer.buf[1].Origin != proto.Origin_AGENT {
+		t.Fatalf("agent record stamped as %s", transfer.buf[1].Origin)
+	}
+}
+
+// sendRecorder keeps the record count of each message
+type sendRecorder struct {
+	proto.Transfer_TransferClient
+	sizes []int
+}
+
+func (s *sendRecorder) Send(data *proto.PackagedData) error {
+	s.sizes = append(s.sizes, len(data.Records))
+	return nil
+}
+
+func TestBatch(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.BatchSize = 3
+	for i := 0; i < 2; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	select {
+	case <-transfer.flushCh:
+		t.Fatal("flush before a full batch")
+	default:
+	}
+	for i := 0; i < 5; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	select {
+	case <-transfer.flushCh:
+	default:
+		t.Fatal("no flush after a full batch")
+	}
+	client := &sendRecorder{}
+	if err := transfer.Send(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sizes) != 3 || client.sizes[0] != 3 || client.sizes[1] != 3 || client.sizes[2] != 1 {
+		t.Fatalf("unexpected batches: %v", client.sizes)
+	}
+	if transfer.offset != 0 {
+		t.Fatalf("%d records left in buffer", transfer.offset)
+	}
+}
+
+// failSender fails all the sends, as the stream is broken
+type failSender struct {
+	proto.Transfer_TransferClient
+}
+
+func (failSender) Send(*proto.PackagedData) error { return errors.New("stream broken") }
+
+func TestSpool(t *testing.T) {
+	s, err := spool.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := NewTransfer()
+	transfer.BatchSize = 10
+	transfer.FlushInterval = time.Millisecond
+	transfer.Spool = s
+	// overflow of the buffer goes to the spool
+	for i := 0; i < size+5; i++ {
+		if err := transfer.Transmission(&proto.Record{DataType: 1000}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if transfer.offset != 5 {
+		t.Fatalf("%d records buffered after spill", transfer.offset)
+	}
+	// so do the records failed to send
+	if err = transfer.Send(failSender{}); err == nil {
+		t.Fatal("send should fail")
+	}
+	if total, _ := s.Size(); total == 0 {
+		t.Fatal("nothing spooled")
+	}
+	replayInterval = time.Millisecond
+	defer func() { replayInterval = time.Second }()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		transfer.Replay(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	// nothing is replayed until the uplink is up
+	time.Sleep(10 * time.Millisecond)
+	transfer.mu.Lock()
+	offset := transfer.offset
+	transfer.mu.Unlock()
+	if offset != 0 {
+		t.Fatalf("%d records replayed while unhealthy", offset)
+	}
+	transfer.SetHealthy(true)
+	client := &sendRecorder{}
+	deadline := time.Now().Add(5 * time.Second)
+	for sent := 0; sent < size+5; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d records replayed, expect %d", sent, size+5)
+		}
+		// as handleSend, flush on a full batch or the interval
+		select {
+		case <-transfer.flushCh:
+		case <-time.After(transfer.FlushInterval):
+		}
+		client.sizes = client.sizes[:0]
+		if err := transfer.Send(client); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range client.sizes {
+			sent += n
+		}
+	}
+}
+
+// commandClient receives the command, and records the sent records
+type commandClient struct {
+	sendRecorder
+	cmd *proto.Command
+}
+
+func (c *commandClient) Recv() (*proto.Command, error) { return c.cmd, nil }
+
+func TestDrain(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.Drain()
+	client := &commandClient{cmd: &proto.Command{Task: &proto.Task{ObjectName: "collector", Data: "scan"}}}
+	done := make(chan error, 1)
+	go func() { done <- transfer.Receive(client) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-PluginTaskChan:
+		t.Fatal("task is dispatched while draining")
+	case <-time.After(time.Second):
+		t.Fatal("receive blocks while draining")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	transfer := NewTransfer()
+	for i := 0; i < 5; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := transfer.Flush(ctx); err != ErrUnhealthy {
+		t.Fatalf("expect unhealthy, got %v", err)
+	}
+	transfer.SetHealthy(true)
+	client := &sendRecorder{}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		// as handleSend
+		<-transfer.flushCh
+		transfer.Send(client)
+	}()
+	if err := transfer.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+	if len(client.sizes) != 1 || client.sizes[0] != 5 {
+		t.Fatalf("unexpected batches: %v", client.sizes)
+	}
+}
+
+func TestFlushQueued(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.SetHealthy(true)
+	for i := 0; i < 3; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	mark := transfer.Queued()
+	client := &sendRecorder{}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		<-transfer.flushCh
+		transfer.Send(client)
+		// buffered after the mark, it's not waited for
+		for i := 0; i < 2; i++ {
+			transfer.Transmission(&proto.Record{DataType: 1000}, false)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := transfer.FlushQueued(ctx, mark); err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+	if transfer.Pending() != 2 {
+		t.Fatalf("unexpected pending records: %d", transfer.Pending())
+	}
+	// a Flush would wait for the records buffered later as well
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := transfer.Flush(short); err != context.DeadlineExceeded {
+		t.Fatalf("expect the flush to time out, got %v", err)
+	}
+	if err := transfer.FlushQueued(short, mark); err != nil {
+		t.Fatal(err)
+	}
+	// the spooled records are passed by the watermark as well
+	s, err := spool.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	transfer.Spool = s
+	transfer.mu.Lock()
+	transfer.spill()
+	transfer.mu.Unlock()
+	if err := transfer.FlushQueued(short, transfer.Queued()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.HighWatermark = 10
+	// not throttled while the uplink is down
+	for i := 0; i < 10; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	if transfer.Throttle() != nil {
+		t.Fatal("throttled while unhealthy")
+	}
+	transfer.SetHealthy(true)
+	transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	released := transfer.Throttle()
+	if released == nil {
+		t.Fatal("not throttled above the high watermark")
+	}
+	if err := transfer.Send(&sendRecorder{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Fatal("throttle is not released once sent")
+	}
+	if transfer.Throttle() != nil {
+		t.Fatal("still throttled")
+	}
+	// the uplink goes down, records are not held back anymore
+	for i := 0; i < 10; i++ {
+		transfer.Transmission(&proto.Record{DataType: 1000}, false)
+	}
+	released = transfer.Throttle()
+	transfer.SetHealthy(false)
+	select {
+	case <-released:
+	default:
+		t.Fatal("throttle is not released once unhealthy")
+	}
+}
+
+// encodingRecorder keeps the encoding of each record
+type encodingRecorder struct {
+	proto.Transfer_TransferClient
+	encodings []string
+}
+
+func (s *encodingRecorder) Send(data *proto.PackagedData) error {
+	for _, rec := range data.Records {
+		s.encodings = append(s.encodings, rec.Encoding)
+	}
+	return nil
+}
+
+func TestCompressRecords(t *testing.T) {
+	transfer := NewTransfer()
+	transfer.CompressRecords = true
+	large := map[string]string{"argv": strings.Repeat("/usr/bin/bash ", 100)}
+	transfer.Transmission(&proto.Record{DataType: 1000, Data: &proto.Payload{Fields: large}}, false)
+	transfer.Transmission(&proto.Record{DataType: 1000, Data: &proto.Payload{Fields: map[string]string{"k": "v"}}}, false)
+	client := &encodingRecorder{}
+	if err := transfer.Send(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.encodings) != 2 || client.encodings[0] != compressor.Name || client.encodings[1] != "" {
+		t.Fatalf("unexpected encodings: %v", client.encodings)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+)
+
+// CopyVerified copies src to a new file with the pattern in dir, checking
+// the copied content by the signature as CheckSignature. The copy is
+// read-only and executable.
+// Since the content is hashed while copying, replacing src during the copy
+// can't bypass the check.
+func CopyVerified(src, dir, pattern, sign string) (dst string, err error) {
+	var in, out *os.File
+	if in, err = os.Open(src); err != nil {
+		return
+	}
+	defer in.Close()
+	if out, err = os.CreateTemp(dir, pattern); err != nil {
+		return
+	}
+	dst = out.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+			dst = ""
+		}
+	}()
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hasher), in)
+	// close before exec, or it fails with ETXTBSY
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	if err = verifyDigest(hasher.Sum(nil), sign); err != nil {
+		return
+	}
+	err = os.Chmod(dst, 0o0500)
+	return
+}
@@ -2,96 +2,191 @@ package utils
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/time/rate"
 )
 
+// CheckSignature verifies dst by the signature, either the hex of sha256 or
+// an Ed25519 one with SignaturePrefix, and makes it executable
 func CheckSignature(dst string, sign string) (err error) {
-	var (
-		f         *os.File
-		signBytes []byte
-	)
-	if f, err = os.Open(dst); err != nil {
-		return
-	}
-	defer f.Close()
-
-	if signBytes, err = hex.DecodeString(sign); err != nil {
+	var digest []byte
+	if digest, err = fileDigest(dst); err != nil {
 		return
 	}
-	hasher := sha256.New()
-	// @Reference: https://pandaychen.github.io/2020/01/01/MAGIC-GO-IO-PACKAGE/
-	if _, err = io.Copy(hasher, f); err != nil {
-		return
-	}
-	if !bytes.Equal(hasher.Sum(nil), signBytes) {
-		err = errors.New("signature doesn't match")
+	if err = verifyDigest(digest, sign); err != nil {
 		return
 	}
 	// make it executable
-	f.Chmod(0o0700)
+	os.Chmod(dst, 0o0700)
 	return
 }
 
-// TODO: io.Copy to file to use minium memory
+var (
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	errChecksum               = errors.New("checksum doesn't match")
+)
+
+// downloads failed on all the urls, including the cancelled ones
+var downloadFailures uint64
+
+// DownloadFailures returns the count of failed downloads since the start
+func DownloadFailures() uint64 { return atomic.LoadUint64(&downloadFailures) }
+
+// Download fetches the file from the urls in order until one succeeds. The
+// content is streamed to a temp file next to dst, so the size of it is not
+// limited by memory. If the urls support range requests, a large file is
+// downloaded by chunks from all of them, and resumed if interrupted.
+//
+// Content-Encoding is removed first, then sha256sum is checked by the suffix:
+//   - "gz": against the decompressed binary, the same as CheckSignature of dst
+//   - "tar.gz": against the archive, since it may contain more than one file
+//   - others: against the file as it is
 func Download(ctx context.Context, dst string, sha256sum string, urls []string, suffix string) (err error) {
+	return DownloadWithLimit(ctx, dst, sha256sum, urls, suffix, 0)
+}
+
+// DownloadWithLimit is Download with a bandwidth cap in bytes/sec, on top of
+// the global one of SetDownloadLimit. Zero for the global cap only.
+func DownloadWithLimit(ctx context.Context, dst string, sha256sum string, urls []string, suffix string, bytesPerSec int) (err error) {
 	var (
 		checksum []byte
+		digest   []byte
 	)
+	defer func() {
+		if err != nil {
+			atomic.AddUint64(&downloadFailures, 1)
+		}
+	}()
 	// check wheater this already exist
 	if checksum, err = hex.DecodeString(sha256sum); err != nil {
 		return
 	}
-	hasher := sha256.New()
 	// extra work, but to simplify
-	if err = CheckSignature(dst, sha256sum); err == nil {
+	if digest, err = fileDigest(dst); err == nil {
+		if bytes.Equal(digest, checksum) {
+			return
+		}
+		err = errChecksum
+	}
+	// shared by all the urls, failover doesn't reset the cap
+	limiters := []*rate.Limiter{newLimiter(bytesPerSec), globalLimiter()}
+	// by ranges across the mirrors first, the part left by a cancel is
+	// resumed next time
+	if err = downloadChunked(ctx, dst, checksum, urls, suffix, limiters); err == nil || ctx.Err() != nil {
 		return
 	}
-	// in elkeid, `defer` in loop... emmm, not a best practice I think, but nothing wrong
 	for _, rawurl := range urls {
-		var req *http.Request
-		var resp *http.Response
-		subctx, cancel := context.WithTimeout(ctx, time.Minute*3)
-		defer cancel()
-		if req, err = http.NewRequestWithContext(subctx, "GET", rawurl, nil); err != nil {
-			continue
+		if err = download(ctx, dst, checksum, rawurl, suffix, limiters); err == nil {
+			break
 		}
-		if resp, err = http.DefaultClient.Do(req); err != nil {
-			continue
-		}
-		if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-			err = errors.New("http error: " + resp.Status)
-			continue
-		}
-		defer resp.Body.Close()
-		var buf []byte
-		// @Notes: ReadAll may not be a best practice, but a dump to mem/file is needed
-		// So, the filesize is limited! Another option is to download and io.Copy to file
-		// @Reference: https://stackoverflow.com/questions/11692860/how-can-i-efficiently-download-a-large-file-using-go
-		if buf, err = ioutil.ReadAll(resp.Body); err != nil {
-			continue
-		}
-		hasher.Reset()
-		hasher.Write(buf)
-		if !bytes.Equal(hasher.Sum(nil), checksum) {
-			err = errors.New("checksum doesn't match")
-			continue
+	}
+	return
+}
+
+func download(ctx context.Context, dst string, checksum []byte, rawurl string, suffix string, limiters []*rate.Limiter) (err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+	)
+	subctx, cancel := context.WithTimeout(ctx, time.Minute*3)
+	defer cancel()
+	if req, err = http.NewRequestWithContext(subctx, "GET", rawurl, nil); err != nil {
+		return
+	}
+	if resp, err = httpClient.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		err = errors.New("http error: " + resp.Status)
+		return
+	}
+	// the cap is on the bytes over the wire, before decompression
+	var r io.Reader = newRateReader(subctx, resp.Body, limiters...)
+	if r, err = decompressReader(resp.Header.Get("Content-Encoding"), r); err != nil {
+		return
+	}
+	if r, err = decompressSuffix(suffix, r); err != nil {
+		return
+	}
+	return save(dst, r, checksum, suffix)
+}
+
+// decompressSuffix wraps r if the suffix of config is a compression of the
+// binary, the checksum is of the decompressed one then
+func decompressSuffix(suffix string, r io.Reader) (io.Reader, error) {
+	if suffix == "gz" || suffix == "zst" || suffix == "zstd" {
+		return decompressReader(suffix, r)
+	}
+	return r, nil
+}
+
+// save streams r to a temp file next to dst and checks the checksum, dst is
+// replaced only if it matches
+func save(dst string, r io.Reader, checksum []byte, suffix string) (err error) {
+	var tmp *os.File
+	root := filepath.Dir(dst)
+	if err = os.MkdirAll(root, 0o0700); err != nil {
+		return
+	}
+	if tmp, err = os.CreateTemp(root, "."+filepath.Base(dst)+"-download-"); err != nil {
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	hasher := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		return
+	}
+	if !bytes.Equal(hasher.Sum(nil), checksum) {
+		err = errChecksum
+		return
+	}
+	if suffix == "tar.gz" {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return
 		}
-		br := bytes.NewBuffer(buf)
-		switch suffix {
-		case "tar.gz":
-			err = DecompressTarGz(dst, br)
-		default:
-			err = DecompressDefault(dst, br)
+		return DecompressTarGz(dst, tmp)
+	}
+	if err = tmp.Chmod(0o0700); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// decompressReader wraps r by the encoding, both Content-Encoding and the
+// suffix of config are accepted
+func decompressReader(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "", "identity":
+		return r, nil
+	case "gzip", "gz":
+		return gzip.NewReader(r)
+	case "zstd", "zst":
+		// decoded in the caller, no goroutine is left to close
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
 		}
-		break
+		return d.IOReadCloser(), nil
+	default:
+		return nil, ErrUnsupportedCompression
 	}
-	return
 }
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var testBinary = []byte("#!/bin/sh\necho plugin\n")
+
+func sum(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func serve(t *testing.T, body []byte, encoding string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func expectBinary(t *testing.T, dst string, want []byte) {
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("unexpected content: %q", got)
+	}
+	// no temp file is left
+	if files, _ := os.ReadDir(filepath.Dir(dst)); len(files) != 1 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+}
+
+func TestDownloadGzip(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	url := serve(t, gzipBytes(t, testBinary), "")
+	// the checksum is of the decompressed binary
+	if err := Download(context.Background(), dst, sum(testBinary), []string{url}, "gz"); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, testBinary)
+	if err := CheckSignature(dst, sum(testBinary)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadContentEncoding(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	url := serve(t, gzipBytes(t, testBinary), "gzip")
+	if err := Download(context.Background(), dst, sum(testBinary), []string{url}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, testBinary)
+}
+
+func TestDownloadTarGz(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "test", Mode: 0o700, Size: int64(len(testBinary)), Typeflag: tar.TypeReg})
+	tw.Write(testBinary)
+	tw.Close()
+	archive := gzipBytes(t, buf.Bytes())
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	// the checksum is of the archive
+	if err := Download(context.Background(), dst, sum(archive), []string{serve(t, archive, "")}, "tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, testBinary)
+}
+
+func TestDownloadMismatch(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	bad := serve(t, gzipBytes(t, []byte("tampered")), "")
+	good := serve(t, gzipBytes(t, testBinary), "")
+	// the first url fails the checksum, and the next is tried
+	if err := Download(context.Background(), dst, sum(testBinary), []string{bad, good}, "gz"); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, testBinary)
+	os.Remove(dst)
+	if err := Download(context.Background(), dst, sum(testBinary), []string{bad}, "gz"); err == nil {
+		t.Fatal("checksum mismatch is not detected")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("mismatched file is kept")
+	}
+}
+
+func zstdBytes(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	w, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(b)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadZstd(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	for _, suffix := range []string{"zst", "zstd"} {
+		if err := Download(context.Background(), dst, sum(testBinary), []string{serve(t, zstdBytes(t, testBinary), "")}, suffix); err != nil {
+			t.Fatal(err)
+		}
+		expectBinary(t, dst, testBinary)
+		os.Remove(dst)
+	}
+	// Content-Encoding of the server
+	if err := Download(context.Background(), dst, sum(testBinary), []string{serve(t, zstdBytes(t, testBinary), "zstd")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, testBinary)
+	os.Remove(dst)
+	if err := Download(context.Background(), dst, sum(testBinary), []string{serve(t, testBinary, "br")}, ""); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Fatalf("expect unsupported compression, got %v", err)
+	}
+}
+
+func TestDownloadLimit(t *testing.T) {
+	const limit = 10000
+	content := bytes.Repeat([]byte{'a'}, limit)
+	// the corrupted mirror is downloaded in full before the checksum fails,
+	// and the failover doesn't get a fresh bucket
+	urls := []string{serve(t, bytes.Repeat([]byte{'b'}, limit), ""), serve(t, content, "")}
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	start := time.Now()
+	if err := DownloadWithLimit(context.Background(), dst, sum(content), urls, "", limit); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 1800*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("download of %d bytes at %d bytes/sec takes %s", 2*limit, limit, elapsed)
+	}
+	expectBinary(t, dst, content)
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	limitMu       sync.RWMutex
+	downloadLimit *rate.Limiter
+)
+
+// SetDownloadLimit caps the bandwidth shared by all downloads in bytes/sec,
+// zero or negative for no limit
+func SetDownloadLimit(bytesPerSec int) {
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	downloadLimit = newLimiter(bytesPerSec)
+}
+
+func globalLimiter() *rate.Limiter {
+	limitMu.RLock()
+	defer limitMu.RUnlock()
+	return downloadLimit
+}
+
+// newLimiter allows a second of traffic at most in a burst. The bucket starts
+// empty, so the cap holds from the first byte.
+func newLimiter(bytesPerSec int) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	l := rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+	l.AllowN(time.Now(), bytesPerSec)
+	return l
+}
+
+// rateReader blocks the reads by all the limiters. The limiters outlive the
+// reader, so the cap is kept across the retries of the urls.
+type rateReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rate.Limiter
+}
+
+func newRateReader(ctx context.Context, r io.Reader, limiters ...*rate.Limiter) io.Reader {
+	rr := &rateReader{ctx: ctx, r: r}
+	for _, l := range limiters {
+		if l != nil {
+			rr.limiters = append(rr.limiters, l)
+		}
+	}
+	if len(rr.limiters) == 0 {
+		return r
+	}
+	return rr
+}
+
+func (r *rateReader) Read(b []byte) (n int, err error) {
+	// WaitN fails on n larger than the burst
+	for _, l := range r.limiters {
+		if burst := l.Burst(); len(b) > burst {
+			b = b[:burst]
+		}
+	}
+	n, err = r.r.Read(b)
+	if n <= 0 {
+		return
+	}
+	for _, l := range r.limiters {
+		if werr := l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return
+}
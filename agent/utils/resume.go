@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Downloads larger than chunkSize are fetched by range requests in chunks,
+// at most chunkParallelism at a time, from all the mirrors supporting them.
+// Completed chunks are recorded next to the partial file, so an interrupted
+// download resumes from them.
+var (
+	chunkSize        int64 = 1 << 20
+	chunkParallelism       = 4
+	probeTimeout           = 10 * time.Second
+	chunkTimeout           = time.Minute
+)
+
+var errNoRange = errors.New("no mirror supports range requests")
+
+// partState is persisted as <dst>.part.json along with <dst>.part. It's
+// dropped if the checksum, size or chunk size changes.
+type partState struct {
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	// sha256 of the completed chunks, empty for the others. They are
+	// checked again on resume, since the file may be written partially.
+	Chunks []string `json:"chunks"`
+}
+
+func (s *partState) chunkRange(i int) (start, end int64) {
+	start = int64(i) * s.ChunkSize
+	end = start + s.ChunkSize
+	if end > s.Size {
+		end = s.Size
+	}
+	return
+}
+
+// mirror is a url which serves the file by ranges
+type mirror struct {
+	url     string
+	latency time.Duration
+}
+
+// downloadChunked downloads dst by ranges from the mirrors, errNoRange is
+// returned if it's not applicable, and the caller falls back to a plain
+// download
+func downloadChunked(ctx context.Context, dst string, checksum []byte, urls []string, suffix string, limiters []*rate.Limiter) (err error) {
+	mirrors, size := probeMirrors(ctx, urls)
+	if len(mirrors) == 0 || size <= chunkSize {
+		return errNoRange
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0o0700); err != nil {
+		return
+	}
+	part := dst + ".part"
+	state := loadPartState(part, checksum, size)
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if err = f.Truncate(size); err != nil {
+		return
+	}
+	verifyChunks(f, state)
+	if err = fetchChunks(ctx, f, part, state, mirrors, limiters); err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	var r io.Reader
+	if r, err = decompressSuffix(suffix, f); err == nil {
+		err = save(dst, r, checksum, suffix)
+	}
+	// a mismatch means some mirror serves a different file, the plain
+	// download tries them one by one
+	os.Remove(part)
+	os.Remove(part + ".json")
+	return
+}
+
+// probeMirrors requests the first byte from all the urls at once. The
+// mirrors which answer by a range of the same size are returned, the fastest
+// first.
+func probeMirrors(ctx context.Context, urls []string) (mirrors []mirror, size int64) {
+	type result struct {
+		mirror
+		size int64
+	}
+	results := make(chan result, len(urls))
+	for _, rawurl := range urls {
+		go func(rawurl string) {
+			start := time.Now()
+			size, err := probeRange(ctx, rawurl)
+			if err != nil {
+				size = -1
+			}
+			results <- result{mirror{rawurl, time.Since(start)}, size}
+		}(rawurl)
+	}
+	sizes := map[int64][]mirror{}
+	for range urls {
+		if r := <-results; r.size > 0 {
+			sizes[r.size] = append(sizes[r.size], r.mirror)
+		}
+	}
+	// mirrors may disagree, the size served by most of them wins
+	for s, m := range sizes {
+		if len(m) > len(mirrors) || (len(m) == len(mirrors) && s > size) {
+			mirrors, size = m, s
+		}
+	}
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].latency < mirrors[j].latency })
+	return
+}
+
+// probeRange returns the size of the file if the url supports ranges
+func probeRange(ctx context.Context, rawurl string) (size int64, err error) {
+	subctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	resp, err := getRange(subctx, rawurl, 0, 1)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	_, size, err = contentRange(resp)
+	return
+}
+
+func getRange(ctx context.Context, rawurl string, start, end int64) (resp *http.Response, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, "GET", rawurl, nil); err != nil {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	// ranges of an encoded body are not ranges of the file
+	req.Header.Set("Accept-Encoding", "identity")
+	if resp, err = httpClient.Do(req); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errors.New("range is not supported: " + resp.Status)
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		resp.Body.Close()
+		return nil, errors.New("range of encoded content: " + encoding)
+	}
+	return
+}
+
+// contentRange parses "bytes start-end/size" of the response
+func contentRange(resp *http.Response) (start, size int64, err error) {
+	value := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	slash := strings.IndexByte(value, '/')
+	dash := strings.IndexByte(value, '-')
+	if slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, errors.New("invalid content range: " + value)
+	}
+	if start, err = strconv.ParseInt(value[:dash], 10, 64); err != nil {
+		return
+	}
+	size, err = strconv.ParseInt(value[slash+1:], 10, 64)
+	return
+}
+
+func loadPartState(part string, checksum []byte, size int64) *partState {
+	expected := &partState{
+		Checksum:  hex.EncodeToString(checksum),
+		Size:      size,
+		ChunkSize: chunkSize,
+		Chunks:    make([]string, (size+chunkSize-1)/chunkSize),
+	}
+	data, err := os.ReadFile(part + ".json")
+	if err != nil {
+		return expected
+	}
+	state := &partState{}
+	if json.Unmarshal(data, state) != nil || state.Checksum != expected.Checksum ||
+		state.Size != size || state.ChunkSize != chunkSize || len(state.Chunks) != len(expected.Chunks) {
+		return expected
+	}
+	return state
+}
+
+// verifyChunks clears the completed chunks which don't match their sha256
+func verifyChunks(f *os.File, state *partState) {
+	for i, sum := range state.Chunks {
+		if sum == "" {
+			continue
+		}
+		start, end := state.chunkRange(i)
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, io.NewSectionReader(f, start, end-start)); err != nil || hex.EncodeToString(hasher.Sum(nil)) != sum {
+			state.Chunks[i] = ""
+		}
+	}
+}
+
+// fetchChunks downloads the chunks left. Chunks are spread over the mirrors
+// round-robin, and a failed one is retried on the next mirror. It fails once
+// a chunk fails on all the mirrors, the completed ones are kept.
+func fetchChunks(ctx context.Context, f *os.File, part string, state *partState, mirrors []mirror, limiters []*rate.Limiter) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+	save := func(i int, sum string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		state.Chunks[i] = sum
+		data, _ := json.Marshal(state)
+		return os.WriteFile(part+".json", data, 0o0600)
+	}
+	fail := func(ferr error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			err = ferr
+			cancel()
+		}
+	}
+	for w := 0; w < chunkParallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var cerr error
+				for attempt := 0; attempt < len(mirrors); attempt++ {
+					m := mirrors[(i+attempt)%len(mirrors)]
+					var sum string
+					if sum, cerr = fetchChunk(ctx, f, m.url, state, i, limiters); cerr == nil {
+						cerr = save(i, sum)
+						break
+					}
+					if ctx.Err() != nil {
+						break
+					}
+				}
+				if cerr != nil {
+					fail(cerr)
+				}
+			}
+		}()
+	}
+	for i, sum := range state.Chunks {
+		if sum != "" {
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return
+}
+
+// fetchChunk downloads the chunk into the file, and returns its sha256
+func fetchChunk(ctx context.Context, f *os.File, rawurl string, state *partState, i int, limiters []*rate.Limiter) (sum string, err error) {
+	subctx, cancel := context.WithTimeout(ctx, chunkTimeout)
+	defer cancel()
+	start, end := state.chunkRange(i)
+	resp, err := getRange(subctx, rawurl, start, end)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var from, size int64
+	if from, size, err = contentRange(resp); err != nil {
+		return
+	}
+	if from != start || size != state.Size {
+		return "", errors.New("unexpected content range: " + resp.Header.Get("Content-Range"))
+	}
+	buf := &bytes.Buffer{}
+	hasher := sha256.New()
+	r := io.LimitReader(newRateReader(subctx, resp.Body, limiters...), end-start)
+	if _, err = io.Copy(io.MultiWriter(buf, hasher), r); err != nil {
+		return
+	}
+	if int64(buf.Len()) != end-start {
+		return "", io.ErrUnexpectedEOF
+	}
+	if _, err = f.WriteAt(buf.Bytes(), start); err != nil {
+		return
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
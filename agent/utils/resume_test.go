@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves body by ranges, and counts the chunk requests, which
+// are the ones not of the first byte only. Chunk requests fail if broken.
+type rangeServer struct {
+	URL    string
+	chunks int32
+	broken bool
+}
+
+func serveRanges(t *testing.T, body []byte, broken bool) *rangeServer {
+	s := &rangeServer{broken: broken}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" {
+			atomic.AddInt32(&s.chunks, 1)
+			if s.broken {
+				http.Error(w, "broken", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.ServeContent(w, r, "plugin", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func withChunkSize(t *testing.T, size int64) {
+	chunkSize = size
+	t.Cleanup(func() { chunkSize = 1 << 20 })
+}
+
+func TestDownloadChunked(t *testing.T) {
+	withChunkSize(t, 1024)
+	content := randomBytes(t, 10*1024+100)
+	a, b := serveRanges(t, content, false), serveRanges(t, content, false)
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	if err := Download(context.Background(), dst, sum(content), []string{a.URL, b.URL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, content)
+	// 11 chunks round-robin over the mirrors
+	if a.chunks+b.chunks != 11 || a.chunks == 0 || b.chunks == 0 {
+		t.Fatalf("unexpected chunk requests: %d, %d", a.chunks, b.chunks)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	withChunkSize(t, 1024)
+	content := randomBytes(t, 8*1024)
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// half of it is done before the interrupt, and one of the done chunks
+	// is corrupted afterwards
+	state := &partState{Checksum: sum(content), Size: int64(len(content)), ChunkSize: 1024, Chunks: make([]string, 8)}
+	part := make([]byte, len(content))
+	for i := 0; i < 4; i++ {
+		chunk := content[i*1024 : (i+1)*1024]
+		copy(part[i*1024:], chunk)
+		s := sha256.Sum256(chunk)
+		state.Chunks[i] = hex.EncodeToString(s[:])
+	}
+	part[1024] ^= 0xff
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(dst+".part.json", data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst+".part", part, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := serveRanges(t, content, false)
+	if err := Download(context.Background(), dst, sum(content), []string{s.URL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, content)
+	if s.chunks != 5 {
+		t.Fatalf("%d chunks downloaded on resume, expect 5", s.chunks)
+	}
+}
+
+func TestDownloadBrokenMirror(t *testing.T) {
+	withChunkSize(t, 1024)
+	content := randomBytes(t, 6*1024)
+	broken, good := serveRanges(t, content, true), serveRanges(t, content, false)
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	if err := Download(context.Background(), dst, sum(content), []string{broken.URL, good.URL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, content)
+	// the chunks failed on the broken one are retried on the good one
+	if good.chunks != 6 {
+		t.Fatalf("%d chunks from the good mirror, expect 6", good.chunks)
+	}
+}
+
+func TestDownloadInterrupted(t *testing.T) {
+	withChunkSize(t, 1024)
+	content := randomBytes(t, 4*1024)
+	dst := filepath.Join(t.TempDir(), "plugin", "test")
+	ctx, cancel := context.WithCancel(context.Background())
+	// the first chunk is done, and the download is cancelled then
+	var done int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" && r.Header.Get("Range") != "bytes=0-1023" {
+			if atomic.AddInt32(&done, 1) == 1 {
+				cancel()
+			}
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "plugin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	chunkParallelism = 1
+	defer func() { chunkParallelism = 4 }()
+	if err := Download(ctx, dst, sum(content), []string{server.URL}, ""); err == nil {
+		t.Fatal("cancelled download should fail")
+	}
+	// the part is kept for resume
+	data, err := os.ReadFile(dst + ".part.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &partState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Chunks[0] == "" {
+		t.Fatal("the done chunk is not recorded")
+	}
+	s := serveRanges(t, content, false)
+	if err = Download(context.Background(), dst, sum(content), []string{s.URL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, dst, content)
+	if s.chunks != 3 {
+		t.Fatalf("%d chunks downloaded on resume, expect 3", s.chunks)
+	}
+}
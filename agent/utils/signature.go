@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SignaturePrefix marks an Ed25519 signature in the signature of a plugin
+// config, it's followed by the base64 of the signature over the sha256
+// digest of the binary. Any other signature is the hex of the sha256.
+const SignaturePrefix = "ed25519:"
+
+var (
+	ErrSignatureMismatch = errors.New("signature doesn't match")
+	ErrUnsigned          = errors.New("plugin is not signed by a trusted key")
+	ErrNotSigned         = errors.New("not signed by a trusted key")
+	errNoPublicKey       = errors.New("no ed25519 public key found")
+)
+
+//go:embed trusted_keys.pem
+var embeddedKeys []byte
+
+// trusted keys and whether a signature by them is required, guarded by kmu
+var (
+	kmu              sync.RWMutex
+	trustedKeys      []ed25519.PublicKey
+	requireSignature bool
+)
+
+func init() {
+	// the embedded file may have no key at all
+	trustedKeys, _ = ParsePublicKeys(embeddedKeys)
+}
+
+// ParsePublicKeys parses the Ed25519 keys in PEM "PUBLIC KEY" blocks, text
+// out of the blocks is ignored
+func ParsePublicKeys(data []byte) (keys []ed25519.PublicKey, err error) {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		var pub interface{}
+		if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+		if key, ok := pub.(ed25519.PublicKey); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		err = errNoPublicKey
+	}
+	return
+}
+
+// LoadTrustedKeys trusts the keys in the file on top of the embedded ones.
+// If require is set, plugins must be signed by one of them, and a plugin
+// with only the sha256 is refused, so a compromised mirror or a config with
+// a forged sha256 can't get a binary started.
+func LoadTrustedKeys(file string, require bool) (err error) {
+	var keys []ed25519.PublicKey
+	if file != "" {
+		var data []byte
+		if data, err = os.ReadFile(file); err != nil {
+			return
+		}
+		if keys, err = ParsePublicKeys(data); err != nil {
+			return
+		}
+	}
+	kmu.Lock()
+	defer kmu.Unlock()
+	trustedKeys = append(trustedKeys, keys...)
+	if require && len(trustedKeys) == 0 {
+		return errNoPublicKey
+	}
+	requireSignature = require
+	return
+}
+
+// VerifySigned checks the Ed25519 signature over the sha256 digest of data,
+// by the trusted keys. Unlike the plugins, the sha256 alone is never enough,
+// whether a signature is required or not.
+func VerifySigned(data []byte, sign string) error {
+	if !strings.HasPrefix(sign, SignaturePrefix) {
+		return ErrNotSigned
+	}
+	digest := sha256.Sum256(data)
+	return verifyDigest(digest[:], sign)
+}
+
+// verifyDigest checks the sha256 digest of the binary by the signature
+func verifyDigest(digest []byte, sign string) error {
+	kmu.RLock()
+	defer kmu.RUnlock()
+	if strings.HasPrefix(sign, SignaturePrefix) {
+		sig, err := base64.StdEncoding.DecodeString(sign[len(SignaturePrefix):])
+		if err != nil {
+			return err
+		}
+		if len(sig) != ed25519.SignatureSize {
+			return ErrSignatureMismatch
+		}
+		for _, key := range trustedKeys {
+			if ed25519.Verify(key, digest, sig) {
+				return nil
+			}
+		}
+		return ErrSignatureMismatch
+	}
+	if requireSignature {
+		return ErrUnsigned
+	}
+	expected, err := hex.DecodeString(sign)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, expected) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func fileDigest(file string) (digest []byte, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	// @Reference: https://pandaychen.github.io/2020/01/01/MAGIC-GO-IO-PACKAGE/
+	if _, err = io.Copy(hasher, f); err != nil {
+		return
+	}
+	return hasher.Sum(nil), nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// trustKey writes the public key as a pem file and loads it, the trusted
+// keys are restored after the test
+func trustKey(t *testing.T, pub ed25519.PublicKey, require bool) {
+	keys, required := trustedKeys, requireSignature
+	t.Cleanup(func() {
+		trustedKeys, requireSignature = keys, required
+	})
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keys.pem")
+	data := append([]byte("# plugin signing key\n"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTrustedKeys(file, require); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sign(priv ed25519.PrivateKey, b []byte) string {
+	digest := sha256.Sum256(b)
+	return SignaturePrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:]))
+}
+
+func writeBinary(t *testing.T) string {
+	dst := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(dst, testBinary, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestEd25519Signature(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	trustKey(t, pub, false)
+	dst := writeBinary(t)
+	if err := CheckSignature(dst, sign(priv, testBinary)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSignature(dst, sign(other, testBinary)); err != ErrSignatureMismatch {
+		t.Fatalf("signature of an untrusted key: %v", err)
+	}
+	if err := CheckSignature(dst, sign(priv, []byte("tampered"))); err != ErrSignatureMismatch {
+		t.Fatalf("signature of another binary: %v", err)
+	}
+	// the sha256 still works unless a signature is required
+	if err := CheckSignature(dst, sum(testBinary)); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := CopyVerified(dst, t.TempDir(), "copy-", sign(priv, testBinary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBinary(t, copied, testBinary)
+}
+
+func TestRequireSignature(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	trustKey(t, pub, true)
+	dst := writeBinary(t)
+	if err := CheckSignature(dst, sum(testBinary)); err != ErrUnsigned {
+		t.Fatalf("expect unsigned, got %v", err)
+	}
+	if _, err := CopyVerified(dst, t.TempDir(), "copy-", sum(testBinary)); err != ErrUnsigned {
+		t.Fatalf("expect unsigned, got %v", err)
+	}
+	if err := CheckSignature(dst, sign(priv, testBinary)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySigned(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	trustKey(t, pub, false)
+	data := []byte(`{"command": "ps"}`)
+	if err := VerifySigned(data, sign(priv, data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySigned([]byte(`{"command": "sh"}`), sign(priv, data)); err != ErrSignatureMismatch {
+		t.Fatalf("signature of other data: %v", err)
+	}
+	if err := VerifySigned(data, sum(data)); err != ErrNotSigned {
+		t.Fatalf("expect not signed, got %v", err)
+	}
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	if _, err := ParsePublicKeys([]byte("# no key\n")); err != errNoPublicKey {
+		t.Fatalf("expect no key, got %v", err)
+	}
+	if _, err := ParsePublicKeys([]byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n")); err == nil {
+		t.Fatal("invalid key is parsed")
+	}
+}
@@ -0,0 +1,61 @@
+package watchdog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// a loop silent for this many heartbeat intervals is considered stalled
+const stallIntervals = 2
+
+var (
+	progressMu sync.Mutex
+	progresses = map[*Progress]struct{}{}
+)
+
+// Progress is the beats of a loop of the agent. The heartbeat to the
+// supervisor is held once a loop registered stops beating, so the agent
+// hung in a loop is restarted though the process is alive.
+type Progress struct {
+	name string
+	last int64
+}
+
+// Register starts to watch the loop, it's expected to Beat more often than
+// the heartbeat interval until Done
+func Register(name string) *Progress {
+	p := &Progress{name: name}
+	p.Beat()
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progresses[p] = struct{}{}
+	return p
+}
+
+// Beat marks the loop makes progress
+func (p *Progress) Beat() {
+	if p != nil {
+		atomic.StoreInt64(&p.last, time.Now().UnixNano())
+	}
+}
+
+// Done stops watching the loop, the one returned is not waited anymore
+func (p *Progress) Done() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	delete(progresses, p)
+}
+
+// stalled returns the name of a loop not beating since the time, it's empty
+// if all are beating
+func stalled(since time.Time) string {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	for p := range progresses {
+		if atomic.LoadInt64(&p.last) < since.UnixNano() {
+			return p.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+//go:build !windows
+
+package watchdog
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// delay before the child is restarted, it's doubled on each restart in
+	// a row and starts over once the child runs longer than maxRestartDelay
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// the hung child is aborted first for the dump of goroutines in
+	// stderr, and killed if it's still there after killGrace
+	killGrace = 5 * time.Second
+)
+
+// Run starts the child and restarts it on exit, until the context is done or
+// the child exits after SIGTERM/SIGINT, which are forwarded to it as SIGHUP
+// is. It returns the exit code of the last child.
+func (s *Supervisor) Run(ctx context.Context) int {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	delay := minRestartDelay
+	for {
+		start := time.Now()
+		code, stopped := s.runChild(ctx, sigs, timeout)
+		if stopped {
+			return code
+		}
+		if time.Since(start) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+		zap.S().Warnf("agent exited with code %d, restart after %s", code, delay)
+		if !waitRestart(ctx, sigs, delay) {
+			return code
+		}
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// waitRestart waits for the delay, and reports false if it's stopped in the
+// middle
+func waitRestart(ctx context.Context, sigs <-chan os.Signal, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case sig := <-sigs:
+			// nothing to reload without the child
+			if sig != syscall.SIGHUP {
+				return false
+			}
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// runChild runs the child until it exits, and reports whether it's stopped
+// on purpose
+func (s *Supervisor) runChild(ctx context.Context, sigs <-chan os.Signal, timeout time.Duration) (code int, stopped bool) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		zap.S().Error("create heartbeat pipe: ", err)
+		return 1, false
+	}
+	defer r.Close()
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), ChildEnv+"="+(timeout/4).String())
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		zap.S().Error("start agent: ", err)
+		return 1, false
+	}
+	zap.S().Infof("agent is started with pid %d", cmd.Process.Pid)
+	beats := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+			select {
+			case beats <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	check := time.NewTicker(timeout / 4)
+	defer check.Stop()
+	var notify <-chan time.Time
+	if interval := systemdWatchdog(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		notify = ticker.C
+	}
+	var (
+		lastBeat = time.Now()
+		killAt   time.Time
+		done     = ctx.Done()
+	)
+	for {
+		select {
+		case <-exited:
+			if code = cmd.ProcessState.ExitCode(); code < 0 {
+				code = 1
+			}
+			return
+		case <-beats:
+			lastBeat = time.Now()
+			if !s.ready {
+				s.ready = true
+				Notify("READY=1")
+			}
+		case <-notify:
+			// systemd takes over if the child hangs and the supervisor
+			// fails to kill it
+			if time.Since(lastBeat) < timeout {
+				Notify("WATCHDOG=1")
+			}
+		case sig := <-sigs:
+			cmd.Process.Signal(sig)
+			if sig != syscall.SIGHUP {
+				stopped = true
+				Notify("STOPPING=1")
+			}
+		case <-done:
+			done, stopped = nil, true
+			cmd.Process.Kill()
+		case now := <-check.C:
+			switch {
+			case !killAt.IsZero():
+				if now.After(killAt) {
+					zap.S().Error("agent is not aborted in time, kill it")
+					cmd.Process.Kill()
+				}
+			// the graceful shutdown stops the heartbeats
+			case !stopped && now.Sub(lastBeat) > timeout:
+				zap.S().Errorf("no heartbeat from agent for %s, abort it", timeout)
+				cmd.Process.Signal(syscall.SIGABRT)
+				killAt = now.Add(killGrace)
+			}
+		}
+	}
+}
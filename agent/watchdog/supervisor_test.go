@@ -0,0 +1,117 @@
+//go:build !windows
+
+package watchdog
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs the test binary as the child if the mode is set, the child
+// appends a line to the file on each start
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("WATCHDOG_TEST_MODE"); mode != "" {
+		f, _ := os.OpenFile(os.Getenv("WATCHDOG_TEST_FILE"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		f.WriteString(mode + "\n")
+		f.Close()
+		switch mode {
+		case "hang":
+			// a beat and then silence
+			pipe := os.NewFile(heartbeatFd, "watchdog")
+			pipe.Write([]byte{0})
+			select {}
+		case "alive":
+			Keepalive(context.Background())
+		case "stalled":
+			// alive, but a loop never beats
+			Register("stalled loop")
+			Keepalive(context.Background())
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func starts(t *testing.T, path string) int {
+	data, _ := os.ReadFile(path)
+	return strings.Count(string(data), "\n")
+}
+
+func runSupervisor(t *testing.T, mode string) (string, context.CancelFunc, chan int) {
+	minRestartDelay, killGrace = 10*time.Millisecond, 100*time.Millisecond
+	path := filepath.Join(t.TempDir(), "starts")
+	os.Setenv("WATCHDOG_TEST_MODE", mode)
+	os.Setenv("WATCHDOG_TEST_FILE", path)
+	// quiet the dump of the aborted child
+	os.Setenv("GOTRACEBACK", "none")
+	t.Cleanup(func() {
+		os.Unsetenv("GOTRACEBACK")
+		os.Unsetenv("WATCHDOG_TEST_MODE")
+		os.Unsetenv("WATCHDOG_TEST_FILE")
+	})
+	s := &Supervisor{Path: os.Args[0], Timeout: 200 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	code := make(chan int, 1)
+	go func() { code <- s.Run(ctx) }()
+	return path, cancel, code
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	for _, mode := range []string{"hang", "exit", "stalled"} {
+		t.Run(mode, func(t *testing.T) {
+			path, cancel, code := runSupervisor(t, mode)
+			waitFor(t, "agent is not restarted", func() bool { return starts(t, path) >= 3 })
+			cancel()
+			select {
+			case <-code:
+			case <-time.After(5 * time.Second):
+				t.Fatal("supervisor is not stopped")
+			}
+		})
+	}
+}
+
+func TestSupervisorAlive(t *testing.T) {
+	path, cancel, code := runSupervisor(t, "alive")
+	time.Sleep(time.Second)
+	cancel()
+	<-code
+	if n := starts(t, path); n != 1 {
+		t.Fatalf("alive agent is restarted: %d", n)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	if err = Notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Fatalf("unexpected state: %q, %v", buf[:n], err)
+	}
+}
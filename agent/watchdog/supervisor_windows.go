@@ -0,0 +1,14 @@
+package watchdog
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Run is not supported since the heartbeat pipe is passed as fd 3, the
+// agent is kept alive by the recovery of the windows service instead
+func (s *Supervisor) Run(ctx context.Context) int {
+	zap.S().Error("watchdog is not supported on windows")
+	return 1
+}
@@ -0,0 +1,76 @@
+// Package watchdog keeps the agent alive. With -watchdog, the agent runs as
+// a supervisor which starts the agent again as its child, and restarts it
+// once it crashes or hangs. The child writes to a heartbeat pipe while its
+// loops make progress, a child not heard from within the timeout is
+// considered hung and killed.
+//
+// The supervisor also talks to systemd by sd_notify if it runs as a notify
+// service, and sends WATCHDOG=1 only while the child is alive.
+package watchdog
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// ChildEnv is set to the heartbeat interval for the child
+	ChildEnv = "HADES_WATCHDOG_CHILD"
+	// the write end of the heartbeat pipe in the child
+	heartbeatFd = 3
+	// DefaultTimeout is how long the child may keep silent before it's
+	// killed
+	DefaultTimeout = time.Minute
+)
+
+// Supervisor runs the agent at Path with Args as its child
+type Supervisor struct {
+	Path string
+	Args []string
+	// Timeout of heartbeats, DefaultTimeout if it's not set. The child
+	// writes one every quarter of it.
+	Timeout time.Duration
+	// READY=1 is sent to systemd once, by the first heartbeat
+	ready bool
+}
+
+// IsChild reports whether the agent runs under the supervisor
+func IsChild() bool {
+	_, ok := os.LookupEnv(ChildEnv)
+	return ok
+}
+
+// Keepalive writes a heartbeat to the supervisor every interval until the
+// context is done, unless a loop registered is stalled. It returns at once
+// without the supervisor.
+func Keepalive(ctx context.Context) {
+	value, ok := os.LookupEnv(ChildEnv)
+	if !ok {
+		return
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		zap.S().Error("invalid heartbeat interval of watchdog: ", value)
+		return
+	}
+	pipe := os.NewFile(heartbeatFd, "watchdog")
+	defer pipe.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if name := stalled(time.Now().Add(-stallIntervals * interval)); name != "" {
+			zap.S().Warnf("%s makes no progress, heartbeat to watchdog is held", name)
+		} else if _, err = pipe.Write([]byte{0}); err != nil {
+			zap.S().Error("write heartbeat to watchdog: ", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/chriskaliX/SDK/config"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// sha256 of the binaries, on top of the md5 of the sandbox. It's calculated
+// once for a binary, until the inode, mtime or size of it changes.
+const (
+	MaxBinaryHashCache = 4096
+	MaxBinarySize      = 10485760
+)
+
+var BinaryHashCache, _ = lru.New(MaxBinaryHashCache)
+
+type binaryHash struct {
+	inode  uint64
+	mtime  int64
+	size   int64
+	sha256 string
+}
+
+// GetSha256 returns the sha256 of the binary the process runs. It's read
+// from /proc/<pid>/exe, so a binary replaced or deleted on disk, or in
+// another mount namespace, is still the one hashed.
+func GetSha256(pid int, exe string) string {
+	return hashFile(exe, "/proc/"+strconv.Itoa(pid)+"/exe")
+}
+
+// GetFileSha256 returns the sha256 of the file on disk, as the binaries and
+// the libraries referenced by the configs
+func GetFileSha256(path string) string {
+	return hashFile(path, path)
+}
+
+// GetRootFileSha256 returns the sha256 of the file as the process sees it,
+// through /proc/<pid>/root, so the one in the mount namespace of a container
+// is hashed rather than the one of the host
+func GetRootFileSha256(pid int, path string) string {
+	return hashFile(path, "/proc/"+strconv.Itoa(pid)+"/root"+filepath.Join("/", path))
+}
+
+// hashFile hashes the file at path, cached by the key
+func hashFile(key, path string) string {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil || stat.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		return config.FieldInvalid
+	}
+	if value, ok := BinaryHashCache.Get(key); ok {
+		hash := value.(*binaryHash)
+		if hash.inode == stat.Ino && hash.mtime == stat.Mtim.Sec && hash.size == stat.Size {
+			return hash.sha256
+		}
+	}
+	if stat.Size > MaxBinarySize {
+		return config.FieldOversize
+	}
+	// a fifo swapped in after the stat never blocks the open
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return config.FieldInvalid
+	}
+	defer file.Close()
+	h := sha256.New()
+	// use CopyN for potential TOUTOC problem
+	if _, err = io.CopyN(h, file, stat.Size); err != nil {
+		return config.FieldInvalid
+	}
+	hash := &binaryHash{
+		inode:  stat.Ino,
+		mtime:  stat.Mtim.Sec,
+		size:   stat.Size,
+		sha256: hex.EncodeToString(h.Sum(nil)),
+	}
+	BinaryHashCache.Add(key, hash)
+	return hash.sha256
+}
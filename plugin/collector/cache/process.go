@@ -49,6 +49,7 @@ type Process struct {
 	Cmdline    string `json:"cmdline"`
 	Exe        string `json:"exe"`
 	Hash       string `json:"hash"`
+	Sha256     string `json:"sha256,omitempty"`
 	UID        uint32 `json:"uid"`
 	Username   string `json:"username"`
 	EUID       uint32 `json:"euid"`
@@ -0,0 +1,414 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/hashstructure/v2"
+	"go.uber.org/zap"
+)
+
+// The accounts of the host, audited on a schedule and once the files change.
+// The key is the kind and the name with the hash of the entry, so a changed
+// entry is reported again in Differential mode.
+const (
+	ACCOUNT_DATATYPE     = 3006
+	ACCOUNT_HOMELIMIT    = 1000
+	ACCOUNT_RECORDLIMIT  = 5000
+	accountDebounce      = 2 * time.Second
+	accountFileSizeLimit = 1024 * 1024
+)
+
+var (
+	passwdFile  = "/etc/passwd"
+	shadowFile  = "/etc/shadow"
+	groupFile   = "/etc/group"
+	sudoersFile = "/etc/sudoers"
+	sudoersDir  = "/etc/sudoers.d"
+	// relative to the home directory
+	authorizedKeysFiles = []string{".ssh/authorized_keys", ".ssh/authorized_keys2"}
+)
+
+// Kinds of the account entries
+const (
+	AccountUser          = "user"
+	AccountGroup         = "group"
+	AccountSudoers       = "sudoers"
+	AccountAuthorizedKey = "authorized_key"
+)
+
+var _ Event = (*Account)(nil)
+
+type Account struct {
+	BasicEvent
+}
+
+// AccountEntry is one of the kinds, the fields of the others are empty
+type AccountEntry struct {
+	Kind string `json:"kind"`
+	// user or group
+	Name    string   `json:"name,omitempty"`
+	UID     string   `json:"uid,omitempty"`
+	GID     string   `json:"gid,omitempty"`
+	Home    string   `json:"home,omitempty"`
+	Shell   string   `json:"shell,omitempty"`
+	Members []string `json:"members,omitempty"`
+	// metadata of /etc/shadow, the hash itself is never read out. The days
+	// are since the epoch, as they are in the file.
+	PasswordStatus    string `json:"password_status,omitempty"`
+	PasswordAlgorithm string `json:"password_algorithm,omitempty"`
+	LastChange        string `json:"last_change,omitempty"`
+	MinDays           string `json:"min_days,omitempty"`
+	MaxDays           string `json:"max_days,omitempty"`
+	WarnDays          string `json:"warn_days,omitempty"`
+	InactiveDays      string `json:"inactive_days,omitempty"`
+	Expire            string `json:"expire,omitempty"`
+	// sudoers and authorized_key
+	Path string `json:"path,omitempty"`
+	Line int    `json:"line,omitempty"`
+	Rule string `json:"rule,omitempty"`
+	// authorized_key of the user in Name
+	KeyType     string `json:"key_type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	Options     string `json:"options,omitempty"`
+}
+
+func (Account) DataType() int {
+	return ACCOUNT_DATATYPE
+}
+
+func (Account) String() string {
+	return "account"
+}
+
+// Run audits the users with the metadata of the shadow, the groups, the
+// sudoers rules and the authorized keys of the users. The keys of the
+// entries gone are dropped, so they're reported again once they're back.
+func (a *Account) Run() (result map[string]interface{}, err error) {
+	result = make(map[string]interface{})
+	var users []AccountEntry
+	if users, err = readPasswd(passwdFile); err != nil {
+		return
+	}
+	shadows := readShadow(shadowFile)
+	entries := make([]AccountEntry, 0, len(users)*2)
+	for _, user := range users {
+		if shadow, ok := shadows[user.Name]; ok {
+			shadow.Kind, shadow.Name, shadow.UID, shadow.GID = user.Kind, user.Name, user.UID, user.GID
+			shadow.Home, shadow.Shell = user.Home, user.Shell
+			user = shadow
+		}
+		entries = append(entries, user)
+	}
+	entries = append(entries, readGroup(groupFile)...)
+	entries = append(entries, readSudoers(sudoersFiles())...)
+	entries = append(entries, readAuthorizedKeys(users)...)
+	for _, entry := range entries {
+		if len(result) >= ACCOUNT_RECORDLIMIT {
+			zap.S().Warnf("account entries are more than %d, the others are skipped", ACCOUNT_RECORDLIMIT)
+			break
+		}
+		hash, err := hashstructure.Hash(entry, hashstructure.FormatV2, nil)
+		if err != nil {
+			continue
+		}
+		key := entry.Kind + "-" + entry.Name + "-" + entry.Path + "-" + strconv.FormatUint(hash, 10)
+		result[key] = entry
+	}
+	a.Prune(result)
+	return result, nil
+}
+
+// RunSync runs on the interval, and once the files of the accounts change.
+// The changes in a row are debounced, as useradd writes several files.
+func (a *Account) RunSync(ctx context.Context) (err error) {
+	eventTask(a)
+	ticker := time.NewTicker(time.Second * time.Duration(a.Interval()))
+	defer ticker.Stop()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		zap.S().Error(err)
+		return
+	}
+	defer watcher.Close()
+	// the files are replaced by rename, so the directories are watched
+	watched := map[string]bool{}
+	watch := func(dir string) {
+		if watched[dir] {
+			return
+		}
+		if err := watcher.Add(dir); err == nil {
+			watched[dir] = true
+		}
+	}
+	watch(filepath.Dir(passwdFile))
+	watch(sudoersDir)
+	if users, err := readPasswd(passwdFile); err == nil {
+		for _, user := range users {
+			watch(filepath.Join(user.Home, ".ssh"))
+		}
+	}
+	debounce := time.NewTimer(accountDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			eventTask(a)
+		case event := <-watcher.Events:
+			if a.watches(event.Name) {
+				debounce.Reset(accountDebounce)
+			}
+		case err := <-watcher.Errors:
+			zap.S().Error(err)
+		case <-debounce.C:
+			eventTask(a)
+		}
+	}
+}
+
+// watches reports whether the file is one of the accounts
+func (Account) watches(name string) bool {
+	switch name {
+	case passwdFile, shadowFile, groupFile, sudoersFile:
+		return true
+	}
+	if filepath.Dir(name) == sudoersDir {
+		return true
+	}
+	for _, file := range authorizedKeysFiles {
+		if filepath.Base(name) == filepath.Base(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// readLines reads the lines of the file without the comments and the empty
+// ones, with the line numbers
+func readLines(path string, fn func(n int, line string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(io.LimitReader(f, accountFileSizeLimit))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fn(n, line)
+	}
+	return s.Err()
+}
+
+func readPasswd(path string) (users []AccountEntry, err error) {
+	err = readLines(path, func(_ int, line string) {
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 {
+			return
+		}
+		users = append(users, AccountEntry{
+			Kind:  AccountUser,
+			Name:  fields[0],
+			UID:   fields[2],
+			GID:   fields[3],
+			Home:  fields[5],
+			Shell: fields[6],
+		})
+	})
+	return
+}
+
+// readShadow returns the metadata of the passwords by the user, nothing if
+// the shadow is not readable
+func readShadow(path string) map[string]AccountEntry {
+	shadows := make(map[string]AccountEntry)
+	readLines(path, func(_ int, line string) {
+		fields := strings.Split(line, ":")
+		if len(fields) < 8 {
+			return
+		}
+		status, algorithm := passwordStatus(fields[1])
+		shadows[fields[0]] = AccountEntry{
+			PasswordStatus:    status,
+			PasswordAlgorithm: algorithm,
+			LastChange:        fields[2],
+			MinDays:           fields[3],
+			MaxDays:           fields[4],
+			WarnDays:          fields[5],
+			InactiveDays:      fields[6],
+			Expire:            fields[7],
+		}
+	})
+	return shadows
+}
+
+// passwordStatus tells the state of the password and the algorithm of the
+// hash by the prefix of it, see crypt(5)
+func passwordStatus(hash string) (status, algorithm string) {
+	switch {
+	case hash == "":
+		return "empty", ""
+	case hash[0] == '!' || hash[0] == '*':
+		status = "locked"
+		hash = strings.TrimLeft(hash, "!*")
+	default:
+		status = "set"
+	}
+	if hash == "" {
+		return
+	}
+	if !strings.HasPrefix(hash, "$") {
+		return status, "des"
+	}
+	switch strings.SplitN(hash[1:], "$", 2)[0] {
+	case "1":
+		algorithm = "md5"
+	case "2a", "2b", "2y":
+		algorithm = "bcrypt"
+	case "5":
+		algorithm = "sha256"
+	case "6":
+		algorithm = "sha512"
+	case "7":
+		algorithm = "scrypt"
+	case "y":
+		algorithm = "yescrypt"
+	case "gy":
+		algorithm = "gost-yescrypt"
+	default:
+		algorithm = "unknown"
+	}
+	return
+}
+
+func readGroup(path string) (groups []AccountEntry) {
+	readLines(path, func(_ int, line string) {
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			return
+		}
+		group := AccountEntry{Kind: AccountGroup, Name: fields[0], GID: fields[2]}
+		if fields[3] != "" {
+			group.Members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, group)
+	})
+	return
+}
+
+// sudoersFiles returns the sudoers and the files in sudoers.d, which sudo
+// reads unless the name ends with ~ or contains a dot
+func sudoersFiles() []string {
+	files := []string{sudoersFile}
+	names, _ := filepath.Glob(filepath.Join(sudoersDir, "*"))
+	for _, name := range names {
+		base := filepath.Base(name)
+		if strings.HasSuffix(base, "~") || strings.Contains(base, ".") {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
+// readSudoers returns the rules and the defaults, the lines continued by
+// the backslash are joined
+func readSudoers(files []string) (rules []AccountEntry) {
+	for _, path := range files {
+		var (
+			pending string
+			start   int
+		)
+		readLines(path, func(n int, line string) {
+			if pending == "" {
+				start = n
+			}
+			if strings.HasSuffix(line, "\\") {
+				pending += strings.TrimSuffix(line, "\\") + " "
+				return
+			}
+			line, pending = pending+line, ""
+			// @include and @includedir, the files of sudoers.d are read anyway
+			if strings.HasPrefix(line, "@include") {
+				return
+			}
+			rules = append(rules, AccountEntry{Kind: AccountSudoers, Path: path, Line: start, Rule: line})
+		})
+	}
+	return
+}
+
+// readAuthorizedKeys returns the keys of the users in the authorized_keys of
+// their homes, each home is read once
+func readAuthorizedKeys(users []AccountEntry) (keys []AccountEntry) {
+	homes := make(map[string]bool)
+	for _, user := range users {
+		if user.Home == "" || homes[user.Home] {
+			continue
+		}
+		if len(homes) >= ACCOUNT_HOMELIMIT {
+			break
+		}
+		homes[user.Home] = true
+		for _, file := range authorizedKeysFiles {
+			path := filepath.Join(user.Home, file)
+			readLines(path, func(n int, line string) {
+				key, ok := parseAuthorizedKey(line)
+				if !ok {
+					return
+				}
+				key.Name, key.UID, key.Path, key.Line = user.Name, user.UID, path, n
+				keys = append(keys, key)
+			})
+		}
+	}
+	return
+}
+
+// parseAuthorizedKey parses the line of sshd(8) AUTHORIZED_KEYS FILE FORMAT,
+// the options come before the key type if there's any
+func parseAuthorizedKey(line string) (key AccountEntry, ok bool) {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if !isKeyType(fields[i]) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(blob)
+		return AccountEntry{
+			Kind:        AccountAuthorizedKey,
+			KeyType:     fields[i],
+			Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+			Options:     strings.Join(fields[:i], " "),
+			Comment:     strings.Join(fields[i+2:], " "),
+		}, true
+	}
+	return
+}
+
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-sha2-") ||
+		strings.HasPrefix(s, "sk-ssh-") || strings.HasPrefix(s, "sk-ecdsa-sha2-")
+}
+
+func init() {
+	RegistEvent(&Account{})
+}
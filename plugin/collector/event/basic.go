@@ -87,6 +87,20 @@ func (b *BasicEvent) Diff(key string) (loaded bool) {
 	return loaded
 }
 
+// Prune drops the keys not in the result, so the entries gone are reported
+// again in Differential mode once they're back
+func (b *BasicEvent) Prune(result map[string]interface{}) {
+	if b._cache == nil {
+		return
+	}
+	b._cache.Range(func(key, _ interface{}) bool {
+		if _, ok := result[key.(string)]; !ok {
+			b._cache.Delete(key)
+		}
+		return true
+	})
+}
+
 // TODO: finish this.
 func (b *BasicEvent) Filter() (flag bool) {
 	return
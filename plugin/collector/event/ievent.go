@@ -4,6 +4,7 @@ import (
 	"collector/share"
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -21,6 +22,20 @@ func RegistEvent(event Event) {
 	eventMap.LoadOrStore(event.String(), event)
 }
 
+// DataTypes returns the data types of the events registered, in order
+func DataTypes() (types []int32) {
+	seen := make(map[int32]bool)
+	eventMap.Range(func(_, value interface{}) bool {
+		if dt := int32(value.(Event).DataType()); !seen[dt] {
+			seen[dt] = true
+			types = append(types, dt)
+		}
+		return true
+	})
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return
+}
+
 func GetEvent(name string) (Event, bool) {
 	var event Event
 	_event, ok := eventMap.Load(name)
@@ -92,16 +107,19 @@ func RunEvent(event Event, immediately bool, ctx context.Context) {
 	}
 }
 
+// Batched is implemented by the events with too many records to be sent in
+// one, the data is split into the size given, with a pause between them
+type Batched interface {
+	Batch() (size int, pause time.Duration)
+}
+
 // run the real task
 func eventTask(event Event) (err error) {
-	var rawdata string
-
 	_data := make(map[string]interface{})
 	// run the event
 	if _data, err = event.Run(); err != nil {
 		return err
 	}
-	data := make(map[string]string, 1)
 	datalist := make([]interface{}, 0, 20)
 
 	if !event.Status() {
@@ -121,11 +139,31 @@ func eventTask(event Event) (err error) {
 			datalist = append(datalist, value)
 		}
 	}
-	rawdata, err = sonic.MarshalString(datalist)
+	batched, ok := event.(Batched)
+	if !ok {
+		return sendData(event, datalist)
+	}
+	size, pause := batched.Batch()
+	for len(datalist) > size {
+		if err = sendData(event, datalist[:size]); err != nil {
+			return err
+		}
+		datalist = datalist[size:]
+		time.Sleep(pause)
+	}
+	if len(datalist) == 0 {
+		return nil
+	}
+	return sendData(event, datalist)
+}
+
+func sendData(event Event, datalist []interface{}) error {
+	rawdata, err := sonic.MarshalString(datalist)
 	if err != nil {
 		return err
 	}
 	// debug code here
+	data := make(map[string]string, 1)
 	data["data"] = rawdata
 	rec := &plugin.Record{
 		DataType:  int32(event.DataType()),
@@ -0,0 +1,271 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"collector/cache"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/hashstructure/v2"
+)
+
+// The kernel modules loaded, with the hashes and the signature status of the
+// files, and the taint flags of the kernel. A module loaded or unloaded
+// between the scans is reported with the action, the first scan reports all
+// of them as loaded.
+const (
+	KMOD_DATATYPE = 3008
+	KMOD_LIMIT    = 2000
+)
+
+const (
+	KmodModule = "module"
+	KmodKernel = "kernel"
+
+	KmodLoaded   = "loaded"
+	KmodUnloaded = "unloaded"
+
+	KmodSigned   = "signed"
+	KmodUnsigned = "unsigned"
+	KmodUnknown  = "unknown"
+)
+
+var (
+	procModules   = "/proc/modules"
+	procTainted   = "/proc/sys/kernel/tainted"
+	procOsrelease = "/proc/sys/kernel/osrelease"
+	sysModule     = "/sys/module"
+	libModules    = "/lib/modules"
+)
+
+// the marker of the signature appended to the module, see
+// scripts/sign-file.c of the kernel
+var moduleSigMagic = []byte("~Module signature appended~\n")
+
+// taint flags of the kernel by the bits, see
+// Documentation/admin-guide/tainted-kernels.rst
+var taintFlags = []byte("PFSRMBUDAWCIOELKXTN")
+
+var _ Event = (*Kmod)(nil)
+
+type Kmod struct {
+	BasicEvent
+	mu sync.Mutex
+	// the modules of the last scan, nil before the first one
+	loaded map[string]KmodEntry
+}
+
+type KmodEntry struct {
+	Kind   string `json:"kind"`
+	Action string `json:"action,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Size   string `json:"size,omitempty"`
+	// the count of the references, and the modules using it. They change
+	// with the use, so they are not in the key.
+	RefCount string `json:"refcount,omitempty" hash:"ignore"`
+	UsedBy   string `json:"used_by,omitempty" hash:"ignore"`
+	State    string `json:"state,omitempty" hash:"ignore"`
+	// the file in modules.dep of the running kernel, empty if the module is
+	// not in it, as the ones loaded from elsewhere
+	Path      string `json:"path,omitempty"`
+	Sha256    string `json:"sha256,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// taint flags of the module, or the kernel with the raw value
+	Taint   string `json:"taint,omitempty"`
+	Tainted string `json:"tainted,omitempty"`
+}
+
+func (*Kmod) DataType() int {
+	return KMOD_DATATYPE
+}
+
+func (*Kmod) String() string {
+	return "kmod"
+}
+
+func (k *Kmod) Run() (result map[string]interface{}, err error) {
+	modules, err := readModules()
+	if err != nil {
+		return
+	}
+	paths := modulePaths()
+	loaded := make(map[string]KmodEntry, len(modules))
+	entries := make([]KmodEntry, 0, len(modules)+1)
+	for _, module := range modules {
+		module.Action = KmodLoaded
+		module.Path = paths[module.Name]
+		module.Taint = readModuleTaint(module.Name)
+		if module.Path != "" {
+			module.Sha256 = cache.GetFileSha256(module.Path)
+		}
+		module.Signature = moduleSignature(module.Path, module.Taint)
+		loaded[module.Name] = module
+		entries = append(entries, module)
+	}
+	k.mu.Lock()
+	for name, module := range k.loaded {
+		if _, ok := loaded[name]; !ok {
+			module.Action = KmodUnloaded
+			entries = append(entries, module)
+		}
+	}
+	k.loaded = loaded
+	k.mu.Unlock()
+	if kernel, err := readKernelTaint(); err == nil {
+		entries = append(entries, kernel)
+	}
+
+	result = make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		hash, err := hashstructure.Hash(entry, hashstructure.FormatV2, nil)
+		if err != nil {
+			continue
+		}
+		result[entry.Kind+"-"+entry.Name+"-"+strconv.FormatUint(hash, 10)] = entry
+	}
+	// the unloaded ones are reported once, and loaded again later
+	k.Prune(result)
+	return
+}
+
+// readModules parses /proc/modules, the lines are as
+// "name size refcount used_by, state address"
+func readModules() (modules []KmodEntry, err error) {
+	f, err := os.Open(procModules)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	s := bufio.NewScanner(io.LimitReader(f, 1024*1024))
+	for s.Scan() && len(modules) < KMOD_LIMIT {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		module := KmodEntry{
+			Kind:     KmodModule,
+			Name:     fields[0],
+			Size:     fields[1],
+			RefCount: fields[2],
+			State:    fields[4],
+		}
+		if usedBy := strings.Trim(fields[3], ","); usedBy != "-" {
+			module.UsedBy = usedBy
+		}
+		modules = append(modules, module)
+	}
+	return modules, s.Err()
+}
+
+// modulePaths returns the files of the modules by the names in modules.dep
+// of the running kernel
+func modulePaths() map[string]string {
+	paths := make(map[string]string)
+	release, err := os.ReadFile(procOsrelease)
+	if err != nil {
+		return paths
+	}
+	dir := filepath.Join(libModules, strings.TrimSpace(string(release)))
+	f, err := os.Open(filepath.Join(dir, "modules.dep"))
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+	s := bufio.NewScanner(io.LimitReader(f, 16*1024*1024))
+	for s.Scan() {
+		line := s.Text()
+		index := strings.IndexByte(line, ':')
+		if index <= 0 {
+			continue
+		}
+		path := line[:index]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		paths[moduleName(path)] = path
+	}
+	return paths
+}
+
+// moduleName returns the name of the module file, with dashes replaced as
+// the kernel does
+func moduleName(path string) string {
+	name := filepath.Base(path)
+	if index := strings.Index(name, ".ko"); index > 0 {
+		name = name[:index]
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func readModuleTaint(name string) string {
+	taint, err := os.ReadFile(filepath.Join(sysModule, name, "taint"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(taint))
+}
+
+// moduleSignature checks the marker at the end of the file. It's unknown
+// for the compressed ones, unless the kernel taints the module as unsigned.
+func moduleSignature(path, taint string) string {
+	if strings.ContainsRune(taint, 'E') {
+		return KmodUnsigned
+	}
+	if path == "" || !strings.HasSuffix(path, ".ko") {
+		return KmodUnknown
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return KmodUnknown
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() < int64(len(moduleSigMagic)) {
+		return KmodUnknown
+	}
+	tail := make([]byte, len(moduleSigMagic))
+	if _, err = f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil {
+		return KmodUnknown
+	}
+	if bytes.Equal(tail, moduleSigMagic) {
+		return KmodSigned
+	}
+	return KmodUnsigned
+}
+
+// readKernelTaint returns the taint flags of the kernel, both are empty if
+// it's not tainted
+func readKernelTaint() (entry KmodEntry, err error) {
+	content, err := os.ReadFile(procTainted)
+	if err != nil {
+		return
+	}
+	tainted, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return
+	}
+	entry = KmodEntry{Kind: KmodKernel, Taint: taintString(tainted)}
+	if tainted != 0 {
+		entry.Tainted = strconv.FormatUint(tainted, 10)
+	}
+	return
+}
+
+func taintString(tainted uint64) string {
+	var flags []byte
+	for bit, flag := range taintFlags {
+		if tainted&(1<<uint(bit)) != 0 {
+			flags = append(flags, flag)
+		}
+	}
+	return string(flags)
+}
+
+func init() {
+	RegistEvent(&Kmod{})
+}
@@ -0,0 +1,245 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/hashstructure/v2"
+	"go.uber.org/zap"
+)
+
+// The packages installed by rpm, dpkg and apk, for the vulnerabilities to be
+// matched on the server. The databases are only read again once they change,
+// and the records are sent in batches with a pause between them, as there
+// are thousands of packages on a host.
+const (
+	PACKAGE_DATATYPE    = 3009
+	PACKAGE_RECORDLIMIT = 20000
+	PACKAGE_BATCH       = 500
+	packageBatchPause   = time.Second
+	packageRpmTimeout   = 2 * time.Minute
+	packageDBSizeLimit  = 64 * 1024 * 1024
+)
+
+var (
+	dpkgStatus   = "/var/lib/dpkg/status"
+	apkInstalled = "/lib/apk/db/installed"
+	// the database of rpm is Berkeley DB, sqlite or ndb on different
+	// versions, it's queried by rpm itself
+	rpmDatabases = []string{
+		"/var/lib/rpm/Packages",
+		"/var/lib/rpm/Packages.db",
+		"/var/lib/rpm/rpmdb.sqlite",
+		"/usr/lib/sysimage/rpm/Packages.db",
+		"/usr/lib/sysimage/rpm/rpmdb.sqlite",
+	}
+	rpmQueryFormat = "%{NAME}\t%|EPOCH?{%{EPOCH}}|\t%{VERSION}-%{RELEASE}\t%{ARCH}\t%{SOURCERPM}\n"
+)
+
+// Types of the packages
+const (
+	PackageRpm = "rpm"
+	PackageDeb = "deb"
+	PackageApk = "apk"
+)
+
+var _ Event = (*Package)(nil)
+
+type Package struct {
+	BasicEvent
+	mu sync.Mutex
+	// the size and the mtime of the databases of the last scan
+	stamp  string
+	result map[string]interface{}
+}
+
+type PackageEntry struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// the version as the package manager compares, with the epoch of rpm and
+	// deb if it's set, as "1:2.3-4"
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+	// the source package, or the origin of apk
+	Source string `json:"source,omitempty"`
+}
+
+func (*Package) DataType() int {
+	return PACKAGE_DATATYPE
+}
+
+func (*Package) String() string {
+	return "package"
+}
+
+func (*Package) Batch() (int, time.Duration) {
+	return PACKAGE_BATCH, packageBatchPause
+}
+
+// Run returns the result of the last scan if none of the databases changes
+func (p *Package) Run() (result map[string]interface{}, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stamp := packageStamp()
+	if p.result != nil && stamp == p.stamp {
+		return p.result, nil
+	}
+	var entries []PackageEntry
+	entries = append(entries, readRpm()...)
+	entries = append(entries, readDpkg(dpkgStatus)...)
+	entries = append(entries, readApk(apkInstalled)...)
+	result = make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		if len(result) >= PACKAGE_RECORDLIMIT {
+			zap.S().Warnf("packages are more than %d, the others are skipped", PACKAGE_RECORDLIMIT)
+			break
+		}
+		hash, err := hashstructure.Hash(entry, hashstructure.FormatV2, nil)
+		if err != nil {
+			continue
+		}
+		result[entry.Type+"-"+entry.Name+"-"+strconv.FormatUint(hash, 10)] = entry
+	}
+	p.Prune(result)
+	p.stamp, p.result = stamp, result
+	return
+}
+
+// packageStamp returns the sizes and the mtimes of the databases
+func packageStamp() string {
+	var b strings.Builder
+	for _, path := range append([]string{dpkgStatus, apkInstalled}, rpmDatabases...) {
+		if info, err := os.Stat(path); err == nil {
+			b.WriteString(path + ":" + strconv.FormatInt(info.Size(), 10) + ":" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + ";")
+		}
+	}
+	return b.String()
+}
+
+// readRpm queries the packages by rpm, if any of the databases exists
+func readRpm() (entries []PackageEntry) {
+	found := false
+	for _, path := range rpmDatabases {
+		if _, err := os.Stat(path); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), packageRpmTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "rpm", "-qa", "--qf", rpmQueryFormat).Output()
+	if err != nil {
+		zap.S().Warn("query rpm packages failed: ", err)
+		return
+	}
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 5 || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		entry := PackageEntry{
+			Type:    PackageRpm,
+			Name:    fields[0],
+			Version: fields[2],
+			Arch:    fields[3],
+		}
+		if fields[1] != "" {
+			entry.Version = fields[1] + ":" + entry.Version
+		}
+		if fields[4] != "(none)" {
+			entry.Source = fields[4]
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// readDpkg parses the status of dpkg, only the packages installed are
+// returned
+func readDpkg(path string) (entries []PackageEntry) {
+	readStanzas(path, ": ", func(fields map[string]string) {
+		// "install ok installed", the ones removed keep the configs as
+		// "deinstall ok config-files"
+		if !strings.HasSuffix(fields["Status"], " installed") || fields["Package"] == "" {
+			return
+		}
+		entry := PackageEntry{
+			Type:    PackageDeb,
+			Name:    fields["Package"],
+			Version: fields["Version"],
+			Arch:    fields["Architecture"],
+		}
+		// the version of the source is in brackets if it differs
+		if source := strings.Fields(fields["Source"]); len(source) != 0 {
+			entry.Source = source[0]
+		}
+		entries = append(entries, entry)
+	})
+	return
+}
+
+// readApk parses the installed database of apk, the fields are keyed by a
+// letter as "P:name"
+func readApk(path string) (entries []PackageEntry) {
+	readStanzas(path, ":", func(fields map[string]string) {
+		if fields["P"] == "" {
+			return
+		}
+		entries = append(entries, PackageEntry{
+			Type:    PackageApk,
+			Name:    fields["P"],
+			Version: fields["V"],
+			Arch:    fields["A"],
+			Source:  fields["o"],
+		})
+	})
+	return
+}
+
+// readStanzas calls fn with the fields of the stanzas separated by empty
+// lines, the continuation lines are skipped
+func readStanzas(path, sep string, fn func(map[string]string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	s := bufio.NewScanner(io.LimitReader(f, packageDBSizeLimit))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	fields := make(map[string]string)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			if len(fields) != 0 {
+				fn(fields)
+				fields = make(map[string]string)
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if kv := strings.SplitN(line, sep, 2); len(kv) == 2 {
+			fields[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	if len(fields) != 0 {
+		fn(fields)
+	}
+}
+
+func init() {
+	RegistEvent(&Package{})
+}
@@ -0,0 +1,347 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"collector/cache"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/hashstructure/v2"
+	"go.uber.org/zap"
+)
+
+// The persistence mechanisms of the host, with the binaries they run
+// hashed. The key is the kind and the path with the hash of the entry, so a
+// changed one is reported again in Differential mode.
+const (
+	PERSISTENCE_DATATYPE    = 3007
+	PERSISTENCE_FILELIMIT   = 2000
+	PERSISTENCE_RECORDLIMIT = 5000
+)
+
+var (
+	systemdUnitDirs = []string{
+		"/etc/systemd/system",
+		"/run/systemd/system",
+		"/usr/lib/systemd/system",
+		"/lib/systemd/system",
+		"/etc/systemd/user",
+		"/usr/lib/systemd/user",
+	}
+	rcFiles    = []string{"/etc/rc.local", "/etc/rc.d/rc.local"}
+	initDirs   = []string{"/etc/init.d", "/etc/rc.d/init.d"}
+	preloadCfg = "/etc/ld.so.preload"
+	// the directories the binary of a command in relative path is looked up
+	binaryDirs = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+)
+
+// Kinds of the persistence entries
+const (
+	PersistenceCron      = "cron"
+	PersistenceSystemd   = "systemd"
+	PersistenceRc        = "rc"
+	PersistencePreload   = "ld_so_preload"
+	PersistenceLdPreload = "ld_preload"
+)
+
+// the directives of the units which run commands, and the ones of timers
+var (
+	execDirectives  = []string{"ExecStart", "ExecStartPre", "ExecStartPost", "ExecReload", "ExecStop", "ExecStopPost"}
+	timerDirectives = []string{"OnCalendar", "OnBootSec", "OnStartupSec", "OnActiveSec", "OnUnitActiveSec", "OnUnitInactiveSec"}
+)
+
+var _ Event = (*Persistence)(nil)
+
+type Persistence struct {
+	BasicEvent
+}
+
+type PersistenceEntry struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	// name of the unit, or the directive of it
+	Name      string `json:"name,omitempty"`
+	Directive string `json:"directive,omitempty"`
+	User      string `json:"user,omitempty"`
+	Command   string `json:"command,omitempty"`
+	// the cron spec, or the directives of the timer
+	Schedule string `json:"schedule,omitempty"`
+	// the binary run by the command, or the library preloaded
+	Binary string `json:"binary,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	// the process with LD_PRELOAD in the environment
+	Exe string `json:"exe,omitempty"`
+}
+
+func (Persistence) DataType() int {
+	return PERSISTENCE_DATATYPE
+}
+
+func (Persistence) String() string {
+	return "persistence"
+}
+
+// Run enumerates the crontabs, the systemd units and timers, the rc
+// scripts, /etc/ld.so.preload and LD_PRELOAD of the processes. The keys of
+// the entries gone are dropped, so they're reported again once they're back.
+func (p *Persistence) Run() (result map[string]interface{}, err error) {
+	result = make(map[string]interface{})
+	var entries []PersistenceEntry
+	entries = append(entries, cronEntries()...)
+	entries = append(entries, systemdEntries()...)
+	entries = append(entries, rcEntries()...)
+	entries = append(entries, preloadEntries()...)
+	for _, entry := range entries {
+		if len(result) >= PERSISTENCE_RECORDLIMIT {
+			zap.S().Warnf("persistence entries are more than %d, the others are skipped", PERSISTENCE_RECORDLIMIT)
+			break
+		}
+		hash, err := hashstructure.Hash(entry, hashstructure.FormatV2, nil)
+		if err != nil {
+			continue
+		}
+		result[entry.Kind+"-"+entry.Path+"-"+strconv.FormatUint(hash, 10)] = entry
+	}
+	p.Prune(result)
+	return result, nil
+}
+
+func cronEntries() (entries []PersistenceEntry) {
+	crons, _ := GetCron()
+	for _, cron := range crons {
+		entry := PersistenceEntry{
+			Kind:     PersistenceCron,
+			Path:     cron.Path,
+			User:     cron.User,
+			Command:  cron.Command,
+			Schedule: strings.Join([]string{cron.Minute, cron.Hour, cron.DayOfMonth, cron.Month, cron.DayOfWeek}, " "),
+		}
+		entry.Binary, entry.Sha256 = commandBinary(cron.Command)
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// systemdEntries returns the commands of the services, and the schedules of
+// the timers. A unit overridden in a directory before is skipped, as
+// systemd does.
+func systemdEntries() (entries []PersistenceEntry) {
+	seen := make(map[string]bool)
+	files := 0
+	for _, dir := range systemdUnitDirs {
+		names, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, path := range names {
+			name := filepath.Base(path)
+			ext := filepath.Ext(name)
+			if (ext != ".service" && ext != ".timer") || seen[name] {
+				continue
+			}
+			// the units masked or linked are the ones elsewhere
+			if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if files++; files > PERSISTENCE_FILELIMIT {
+				return
+			}
+			seen[name] = true
+			directives := readUnit(path)
+			if ext == ".timer" {
+				var schedule []string
+				for _, d := range timerDirectives {
+					for _, v := range directives[d] {
+						schedule = append(schedule, d+"="+v)
+					}
+				}
+				unit := strings.TrimSuffix(name, ext) + ".service"
+				if units := directives["Unit"]; len(units) != 0 {
+					unit = units[len(units)-1]
+				}
+				entries = append(entries, PersistenceEntry{
+					Kind:     PersistenceSystemd,
+					Path:     path,
+					Name:     name,
+					Command:  unit,
+					Schedule: strings.Join(schedule, ";"),
+				})
+				continue
+			}
+			user := ""
+			if users := directives["User"]; len(users) != 0 {
+				user = users[len(users)-1]
+			}
+			for _, d := range execDirectives {
+				for _, command := range directives[d] {
+					entry := PersistenceEntry{
+						Kind:      PersistenceSystemd,
+						Path:      path,
+						Name:      name,
+						Directive: d,
+						User:      user,
+						Command:   command,
+					}
+					// the prefixes of the special executable, see systemd.service(5)
+					entry.Binary, entry.Sha256 = commandBinary(strings.TrimLeft(command, "-@:+!"))
+					entries = append(entries, entry)
+				}
+			}
+		}
+	}
+	return
+}
+
+// readUnit returns the values of the directives in the unit file, an empty
+// value resets the ones before, as systemd does
+func readUnit(path string) map[string][]string {
+	directives := make(map[string][]string)
+	readLines(path, func(_ int, line string) {
+		if line[0] == ';' || line[0] == '[' {
+			return
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if value == "" {
+			delete(directives, key)
+			return
+		}
+		directives[key] = append(directives[key], value)
+	})
+	return directives
+}
+
+// rcEntries returns the rc.local and the init scripts, hashed themselves
+func rcEntries() (entries []PersistenceEntry) {
+	files := append([]string{}, rcFiles...)
+	for _, dir := range initDirs {
+		names, _ := filepath.Glob(filepath.Join(dir, "*"))
+		files = append(files, names...)
+	}
+	seen := make(map[string]bool)
+	for _, path := range files {
+		if len(entries) >= PERSISTENCE_FILELIMIT {
+			break
+		}
+		// rc.local is linked to the one in rc.d on some distributions
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil || seen[real] {
+			continue
+		}
+		if info, err := os.Stat(real); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		seen[real] = true
+		entries = append(entries, PersistenceEntry{
+			Kind:   PersistenceRc,
+			Path:   path,
+			Binary: real,
+			Sha256: cache.GetFileSha256(real),
+		})
+	}
+	return
+}
+
+// preloadEntries returns the libraries in /etc/ld.so.preload, and the ones
+// in LD_PRELOAD of the processes, once for a binary
+func preloadEntries() (entries []PersistenceEntry) {
+	readLines(preloadCfg, func(_ int, line string) {
+		for _, lib := range strings.Fields(line) {
+			entries = append(entries, PersistenceEntry{
+				Kind:   PersistencePreload,
+				Path:   preloadCfg,
+				Binary: lib,
+				Sha256: cache.GetFileSha256(lib),
+			})
+		}
+	})
+	pids, err := cache.GetPids(MaxProcess)
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, pid := range pids {
+		environ, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/environ")
+		if err != nil {
+			continue
+		}
+		value := ldPreload(environ)
+		if value == "" {
+			continue
+		}
+		exe, _ := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+		if seen[exe+"\x00"+value] {
+			continue
+		}
+		seen[exe+"\x00"+value] = true
+		// separated by spaces or colons, see ld.so(8)
+		for _, lib := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ':' }) {
+			entries = append(entries, PersistenceEntry{
+				Kind:   PersistenceLdPreload,
+				Path:   "/proc/" + strconv.Itoa(pid) + "/environ",
+				Exe:    exe,
+				Binary: lib,
+				Sha256: cache.GetRootFileSha256(pid, lib),
+			})
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return
+}
+
+func ldPreload(environ []byte) string {
+	r := bufio.NewReader(io.LimitReader(bytes.NewReader(environ), 128*1024))
+	for {
+		kv, err := r.ReadString(0)
+		if strings.HasPrefix(kv, "LD_PRELOAD=") {
+			return strings.TrimRight(strings.TrimPrefix(kv, "LD_PRELOAD="), "\x00")
+		}
+		if err != nil {
+			return ""
+		}
+	}
+}
+
+// commandBinary returns the binary run by the command with the hash, which
+// is looked up in binaryDirs if it's not in absolute path. Nothing is
+// returned for the builtins of the shell.
+func commandBinary(command string) (binary, sha256 string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return
+	}
+	binary = fields[0]
+	if !filepath.IsAbs(binary) {
+		binary = ""
+		for _, dir := range binaryDirs {
+			if path := filepath.Join(dir, fields[0]); isExecutable(path) {
+				binary = path
+				break
+			}
+		}
+		if binary == "" {
+			if path, err := exec.LookPath(fields[0]); err == nil && filepath.IsAbs(path) {
+				binary = path
+			}
+		}
+		if binary == "" {
+			return
+		}
+	}
+	return binary, cache.GetFileSha256(binary)
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0
+}
+
+func init() {
+	RegistEvent(&Persistence{})
+}
@@ -29,7 +29,9 @@ func (Process) String() string {
 	return "process"
 }
 
-// TODO: Log process
+// Run snapshots the running processes. The key is the pid with the start
+// time of the process, so a reused pid is reported as a new one in
+// Differential mode, and the keys of the exited ones are dropped.
 func (p Process) Run() (result map[string]interface{}, err error) {
 	result = make(map[string]interface{})
 	var processes []*cache.Process
@@ -43,10 +45,15 @@ func (p Process) Run() (result map[string]interface{}, err error) {
 		cache.ProcessCmdlineCache.Add(uint32(process.PID), process.Exe)
 	}
 	for _, process := range processes {
-		result[strconv.Itoa(process.PID)] = process
-		if err != nil {
-			continue
-		}
+		result[strconv.Itoa(process.PID)+"-"+strconv.FormatUint(process.StartTime, 10)] = process
+	}
+	if p._cache != nil {
+		p._cache.Range(func(key, _ interface{}) bool {
+			if _, ok := result[key.(string)]; !ok {
+				p._cache.Delete(key)
+			}
+			return true
+		})
 	}
 	return
 }
@@ -62,6 +69,7 @@ func (Process) getProcess() (procs []*cache.Process, err error) {
 		if err != nil {
 			continue
 		}
+		proc.Sha256 = cache.GetSha256(pid, proc.Exe)
 		procs = append(procs, proc)
 		time.Sleep(time.Duration(ProcessIntervalMillSec) * time.Millisecond)
 	}
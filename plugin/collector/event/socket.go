@@ -3,6 +3,7 @@ package event
 import (
 	"collector/cache"
 	"collector/socket"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -10,7 +11,7 @@ import (
 	"go.uber.org/zap"
 )
 
-// use inode key as primary key
+// the key is the inode with the owner and the addresses, see socketKey
 const SOCKET_DATATYPE = 5001
 
 var _ Event = (*Socket)(nil)
@@ -27,23 +28,26 @@ func (Socket) String() string {
 	return "socket"
 }
 
+// Run collects the listening and established sockets, correlated to the
+// processes owning them by the inodes in /proc/<pid>/fd. The ones owned by
+// no process we can see, like the ones of other namespaces, are reported
+// with pid 0. The keys of the closed ones are dropped, so they're reported
+// again in Differential mode once they're back.
 func (s Socket) Run() (result map[string]interface{}, err error) {
 	result = make(map[string]interface{})
 	var (
 		sockets []socket.Socket
 		pids    []int
-		inode   uint64
-		index   int
-		ok      bool
 	)
-
 	sockets, err = socket.FromNetlink()
 	if err != nil {
 		zap.S().Warn("get socket from netlink failed:", err)
 		zap.S().Info("try getting socket from proc...")
-		sockets, _ = socket.FromProc()
+		if sockets, err = socket.FromProc(); err != nil {
+			return
+		}
 	}
-	inodeMap := make(map[uint32]int)
+	inodeMap := make(map[uint32]int, len(sockets))
 	for index, socket := range sockets {
 		if socket.Inode != 0 {
 			inodeMap[socket.Inode] = index
@@ -54,40 +58,63 @@ func (s Socket) Run() (result map[string]interface{}, err error) {
 		return
 	}
 	for _, pid := range pids {
-		var fds []string
-		if fds, err = cache.GetFds(pid); err != nil {
-			goto Next
+		if len(inodeMap) == 0 {
+			break
+		}
+		fds, err := cache.GetFds(pid)
+		if err != nil {
+			continue
 		}
+		var proc *cache.Process
 		// get all file description here
 		for _, fd := range fds {
 			// skip field that is not socket:[
 			if !strings.HasPrefix(fd, "socket:[") {
 				continue
 			}
-			inode, err = strconv.ParseUint(strings.TrimRight(fd[8:], "]"), 10, 32)
+			inode, err := strconv.ParseUint(strings.TrimRight(fd[8:], "]"), 10, 32)
 			if err != nil {
 				continue
 			}
-			index, ok = inodeMap[uint32(inode)]
+			index, ok := inodeMap[uint32(inode)]
 			if !ok {
 				continue
 			}
-			sockets[index].PID = pid
-			proc := cache.DefaultProcessPool.Get()
-			proc.PID = pid
-			if err = proc.GetStat(false); err == nil {
-				sockets[index].Comm = proc.Name
-			}
-			if err = proc.GetCmdline(); err == nil {
-				sockets[index].Cmdline = proc.Cmdline
+			// a socket shared by the children is owned by the first one
+			delete(inodeMap, uint32(inode))
+			if proc == nil {
+				proc = &cache.Process{PID: pid}
+				proc.GetStat(true)
+				proc.GetCmdline()
+				proc.GetExe()
 			}
+			sockets[index].PID = pid
+			sockets[index].Comm = proc.Name
+			sockets[index].Cmdline = proc.Cmdline
+			sockets[index].Exe = proc.Exe
 		}
-	Next:
-		socket := sockets[index]
-		result[strconv.Itoa(int(socket.Inode))] = socket
 		time.Sleep(100 * time.Millisecond)
 	}
-	return
+	for _, socket := range sockets {
+		result[socketKey(&socket)] = socket
+	}
+	if s._cache != nil {
+		s._cache.Range(func(key, _ interface{}) bool {
+			if _, ok := result[key.(string)]; !ok {
+				s._cache.Delete(key)
+			}
+			return true
+		})
+	}
+	return result, nil
+}
+
+// socketKey is the inode with the owner, since the inode of a socket is
+// reused once it's closed
+func socketKey(sock *socket.Socket) string {
+	return strconv.FormatUint(uint64(sock.Inode), 10) + "-" + strconv.Itoa(sock.PID) + "-" +
+		net.JoinHostPort(sock.SIP.String(), strconv.Itoa(int(sock.SPort))) + "-" +
+		net.JoinHostPort(sock.DIP.String(), strconv.Itoa(int(sock.DPort)))
 }
 
 func init() {
@@ -8,12 +8,27 @@ import (
 
 	"github.com/chriskaliX/SDK"
 	"github.com/chriskaliX/SDK/logger"
+	"github.com/chriskaliX/SDK/transport"
 	"go.uber.org/zap/zapcore"
 )
 
 func init() {
 	runtime.GOMAXPROCS(4)
 }
+
+// process, socket, kernel module and package inventory, account auditing
+// and persistence scan, flags of the plugin
+var (
+	processInterval     int
+	processSnapshot     bool
+	socketInterval      int
+	socketSnapshot      bool
+	accountInterval     int
+	persistenceInterval int
+	kmodInterval        int
+	packageInterval     int
+)
+
 func collector(sandbox SDK.ISandbox) error {
 	// user
 	user, _ := event.GetEvent("user")
@@ -24,7 +39,10 @@ func collector(sandbox SDK.ISandbox) error {
 	// processes
 	process, _ := event.GetEvent("process")
 	process.SetMode(event.Differential)
-	process.SetInterval(3600)
+	if processSnapshot {
+		process.SetMode(event.Snapshot)
+	}
+	process.SetInterval(processInterval)
 	go event.RunEvent(process, false, sandbox.Context())
 
 	// yum
@@ -63,21 +81,77 @@ func collector(sandbox SDK.ISandbox) error {
 
 	socket, _ := event.GetEvent("socket")
 	socket.SetMode(event.Differential)
-	socket.SetInterval(300)
+	if socketSnapshot {
+		socket.SetMode(event.Snapshot)
+	}
+	socket.SetInterval(socketInterval)
 	go event.RunEvent(socket, false, sandbox.Context())
 
+	// accounts, on the interval and once the files change
+	account, _ := event.GetEvent("account")
+	account.SetMode(event.Differential)
+	account.SetType(event.Realtime)
+	account.SetInterval(accountInterval)
+	go event.RunEvent(account, false, sandbox.Context())
+
+	// crontabs, systemd units, rc scripts and preloads
+	persistence, _ := event.GetEvent("persistence")
+	persistence.SetMode(event.Differential)
+	persistence.SetInterval(persistenceInterval)
+	go event.RunEvent(persistence, false, sandbox.Context())
+
+	// kernel modules, and the ones loaded or unloaded between the scans
+	kmod, _ := event.GetEvent("kmod")
+	kmod.SetMode(event.Differential)
+	kmod.SetInterval(kmodInterval)
+	go event.RunEvent(kmod, true, sandbox.Context())
+
+	// packages of rpm, dpkg and apk, scanned once the databases change
+	pkg, _ := event.GetEvent("package")
+	pkg.SetMode(event.Differential)
+	pkg.SetInterval(packageInterval)
+	go event.RunEvent(pkg, true, sandbox.Context())
+
 	return nil
 }
 
 func main() {
 	var debug bool
 	flag.BoolVar(&debug, "debug", false, "set to run in debug mode")
+	flag.IntVar(&processInterval, "process-interval", 3600, "seconds between the snapshots of processes")
+	flag.BoolVar(&processSnapshot, "process-snapshot", false, "report all the processes in every snapshot, instead of the new ones only")
+	flag.IntVar(&socketInterval, "socket-interval", 300, "seconds between the snapshots of sockets")
+	flag.BoolVar(&socketSnapshot, "socket-snapshot", false, "report all the sockets in every snapshot, instead of the new ones only")
+	flag.IntVar(&accountInterval, "account-interval", 3600, "seconds between the audits of accounts, they're audited once changed as well")
+	flag.IntVar(&persistenceInterval, "persistence-interval", 3600, "seconds between the scans of persistence mechanisms")
+	flag.IntVar(&kmodInterval, "kmod-interval", 600, "seconds between the scans of kernel modules")
+	flag.IntVar(&packageInterval, "package-interval", 3600, "seconds between the checks of package databases, packages are read again once they change")
 	flag.Parse()
+	if processInterval <= 0 {
+		processInterval = 3600
+	}
+	if socketInterval <= 0 {
+		socketInterval = 300
+	}
+	if accountInterval <= 0 {
+		accountInterval = 3600
+	}
+	if persistenceInterval <= 0 {
+		persistenceInterval = 3600
+	}
+	if kmodInterval <= 0 {
+		kmodInterval = 600
+	}
+	if packageInterval <= 0 {
+		packageInterval = 3600
+	}
 	// start the sandbox
 	sconfig := &SDK.SandboxConfig{
 		Debug: debug,
 		Hash:  true,
 		Name:  "collector",
+		// no task is handled
+		Capabilities: transport.Capabilities{DataTypes: event.DataTypes()},
 		LogConfig: &logger.Config{
 			Path:        "collector.log",
 			MaxSize:     10,
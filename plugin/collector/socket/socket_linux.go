@@ -70,6 +70,7 @@ type Socket struct {
 	Username  string `json:"username"`
 	Inode     uint32 `json:"inode"`
 	PID       int    `json:"pid"`
+	Exe       string `json:"exe"`
 	Cmdline   string `json:"cmdline"`
 	Comm      string `json:"comm"`
 	Type      uint8  `json:"type"`
@@ -354,48 +355,33 @@ func FromProc() (sockets []Socket, err error) {
 	if err == nil {
 		sockets = append(sockets, udp6Socks...)
 	}
-	inodeMap := make(map[uint32]int)
-	for index, socket := range sockets {
-		if socket.Inode != 0 {
-			inodeMap[socket.Inode] = index
-		}
-	}
-	return
+	return sockets, nil
 }
 
+// FromNetlink gets the listening and established TCP sockets, and the
+// unconnected UDP ones, which are the ones listening, of both families
 func FromNetlink() (sockets []Socket, err error) {
-	var udpSockets, udp6Sockets, tcpSockets, tcp6Sockets []Socket
-	udpSockets, err = parseNetlink(unix.AF_INET, unix.IPPROTO_UDP, 7)
-	if err != nil {
-		return
-	}
-	sockets = append(sockets, udpSockets...)
-	udp6Sockets, err = parseNetlink(unix.AF_INET6, unix.IPPROTO_UDP, 7)
-	if err != nil {
-		return
-	}
-	// TCP - sockets for both established & listen, any better for state? dig out this
-	sockets = append(sockets, udp6Sockets...)
-	tcpSockets, err = parseNetlink(unix.AF_INET, unix.IPPROTO_TCP, 1)
-	if err != nil {
-		return
-	}
-	sockets = append(sockets, udp6Sockets...)
-	tcpSockets, err = parseNetlink(unix.AF_INET, unix.IPPROTO_TCP, 10)
-	if err != nil {
-		return
-	}
-	sockets = append(sockets, tcpSockets...)
-	tcp6Sockets, err = parseNetlink(unix.AF_INET6, unix.IPPROTO_TCP, 1)
-	if err == nil {
-		return
+	queries := []struct {
+		family   uint8
+		protocol uint8
+		state    uint32
+	}{
+		{unix.AF_INET, unix.IPPROTO_UDP, 7},
+		{unix.AF_INET6, unix.IPPROTO_UDP, 7},
+		{unix.AF_INET, unix.IPPROTO_TCP, 1},
+		{unix.AF_INET, unix.IPPROTO_TCP, 10},
+		{unix.AF_INET6, unix.IPPROTO_TCP, 1},
+		{unix.AF_INET6, unix.IPPROTO_TCP, 10},
 	}
-	sockets = append(sockets, tcp6Sockets...)
-	tcp6Sockets, err = parseNetlink(unix.AF_INET6, unix.IPPROTO_TCP, 10)
-	if err == nil {
-		return
+	for _, query := range queries {
+		var socks []Socket
+		// any failure falls back to /proc for all of them, so the result
+		// is never partial
+		if socks, err = parseNetlink(query.family, query.protocol, query.state); err != nil {
+			return nil, err
+		}
+		sockets = append(sockets, socks...)
 	}
-	sockets = append(sockets, tcp6Sockets...)
 	return
 }
 
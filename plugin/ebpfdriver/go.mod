@@ -11,6 +11,7 @@ require (
 	github.com/ehids/ebpfmanager v0.3.0
 	github.com/mitchellh/hashstructure/v2 v2.0.2
 	go.uber.org/zap v1.23.0
+	golang.org/x/net v0.0.0-20220802222814-0bcc04d9c69b
 	golang.org/x/time v0.0.0-20220722155302-e5dcc9cfc0b9
 	k8s.io/apimachinery v0.24.3
 	k8s.io/utils v0.0.0-20220823124924-e9cbc92d1a73
@@ -32,7 +33,6 @@ require (
 	github.com/vishvananda/netlink v1.1.0 // indirect
 	github.com/vishvananda/netns v0.0.0-20211101163701-50045581ed74 // indirect
 	golang.org/x/arch v0.0.0-20220722155209-00200b7164a7 // indirect
-	golang.org/x/net v0.0.0-20220802222814-0bcc04d9c69b // indirect
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
 )
 
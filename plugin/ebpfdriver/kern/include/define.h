@@ -41,6 +41,7 @@
 #define MAX_STR_ARR_ELEM    32
 #define MAX_PATH_COMPONENTS 16
 #define MAX_NODENAME        64
+#define MAX_BYTES_ARR_SIZE  1024
 
 #define MAX_BUFFERS    3
 #define TMP_BUF_IDX    1
@@ -76,6 +77,11 @@ enum hades_ebpf_config { CONFIG_HADES_PID, CONFIG_FILTERS };
     BPF_MAP(_name, BPF_MAP_TYPE_PERF_EVENT_ARRAY, int, __u32, _max_entries)
 #define BPF_PERCPU_HASH(_name, _max_entries)                                   \
     BPF_MAP(_name, BPF_MAP_TYPE_PERCPU_HASH, int, int, _max_entries)
+#define BPF_RINGBUF_OUTPUT(_name, _size)                                       \
+    struct {                                                                   \
+        __uint(type, BPF_MAP_TYPE_RINGBUF);                                    \
+        __uint(max_entries, _size);                                            \
+    } _name SEC(".maps");
 typedef struct simple_buf {
     __u8 buf[MAX_PERCPU_BUFSIZE];
 } buf_t;
@@ -150,12 +156,45 @@ typedef struct network_connection_v6 {
 } net_conn_v6_t;
 
 /* filters */
-BPF_ARRAY(path_filter, string_t, 3);
+/*
+ * The filter policy is pushed by the server and compiled into the maps by
+ * the driver. The value of pid_filter, cgroup_id_filter, path_filter and
+ * event_filter is the action. The bits of CONFIG_FILTERS are set if there
+ * are allow rules of the kind, and the events not allowed are dropped then.
+ * FILTER_EXE_ON is set if there are any rules of the path.
+ */
+#define FILTER_DENY  0
+#define FILTER_ALLOW 1
+
+#define FILTER_PID_ALLOW    (1 << 0)
+#define FILTER_CGROUP_ALLOW (1 << 1)
+#define FILTER_EXE_ALLOW    (1 << 2)
+#define FILTER_EVENT_ALLOW  (1 << 3)
+#define FILTER_EXE_ON       (1 << 4)
+
+/* the path prefix, matched by the lpm trie */
+typedef struct path_key {
+    __u32 prefixlen;
+    char data[MAX_STR_FILTER_SIZE];
+} path_key_t;
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, 512);
+    __type(key, path_key_t);
+    __type(value, __u32);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+} path_filter SEC(".maps");
+
+BPF_PERCPU_ARRAY(path_keys, path_key_t, 1);
 BPF_ARRAY(config_map, __u32, 4);
 BPF_HASH(pid_filter, __u32, __u32, 512);
 BPF_HASH(uid_filter, __u32, __u32, 512);
 BPF_HASH(cgroup_id_filter, __u64, __u32, 512);
 BPF_HASH(pns_filter, __u32, __u32, 512);
+BPF_HASH(event_filter, __u32, __u32, 512);
+/* the action of the exe of the process (tgid), updated in exec */
+BPF_LRU_HASH(exe_filter, __u32, __u32, 10240);
 /*internal maps (caches) */
 
 /*
@@ -166,6 +205,10 @@ BPF_HASH(pns_filter, __u32, __u32, 512);
 BPF_PERF_OUTPUT(exec_events, 1024);
 BPF_PERF_OUTPUT(file_events, 1024);
 BPF_PERF_OUTPUT(net_events, 1024);
+#ifdef RINGBUF
+/* shared by all cpus, needs kernel 5.8+, size in bytes */
+BPF_RINGBUF_OUTPUT(exec_ringbuf, 1 << 24);
+#endif
 BPF_PERCPU_ARRAY(bufs, buf_t, 3);
 BPF_PERCPU_ARRAY(bufs_off, __u32, MAX_BUFFERS);
 
@@ -280,6 +323,9 @@ static __always_inline int get_config(__u32 key)
 #define SECURITY_SB_MOUNT         1029
 #define CALL_USERMODEHELPER       1030
 #define ANTI_ROOTKIT              1031
+#define SCHED_PROCESS_EXIT        1032
+#define UDP_SENDMSG               1033
+#define NET_CONNECT               1034
 // uprobe
 #define BASH_READLINE 2000
 // rootkit field
@@ -94,9 +94,6 @@ int sys_exit_execve(void *ctx)
     event_data_t data = {};
     if (!init_event_data(&data, ctx))
         goto delete;
-    if (context_filter(&data.context))
-        goto delete;
-    data.context.type = SYS_ENTER_EXECVE;
     /* filename
    * The filename contains dot slash thing. It's not abs path,
    * but the args[0] of execve(at)
@@ -105,6 +102,11 @@ int sys_exit_execve(void *ctx)
    * and it's safe to access path in it's own context
    */
     void *exe = get_exe_from_task(data.task);
+    // the exe is matched before the filter, so the exec is filtered as well
+    exe_filter_update(exe, data.context.tid);
+    if (context_filter(&data.context))
+        goto delete;
+    data.context.type = SYS_ENTER_EXECVE;
     save_str_to_buf(&data, exe, 0);
     // cwd
     struct fs_struct *file = get_task_fs(data.task);
@@ -167,9 +169,6 @@ int sys_exit_execveat(void *ctx)
     event_data_t data = {};
     if (!init_event_data(&data, ctx))
         goto delete;
-    if (context_filter(&data.context))
-        goto delete;
-    data.context.type = SYS_ENTER_EXECVEAT;
     /* filename
    * The filename contains dot slash thing. It's not abs path,
    * but the args[0] of execve(at)
@@ -178,6 +177,11 @@ int sys_exit_execveat(void *ctx)
    * and it's safe to access path in it's own context
    */
     void *exe = get_exe_from_task(data.task);
+    // the exe is matched before the filter, so the exec is filtered as well
+    exe_filter_update(exe, data.context.tid);
+    if (context_filter(&data.context))
+        goto delete;
+    data.context.type = SYS_ENTER_EXECVEAT;
     save_str_to_buf(&data, exe, 0);
     // cwd
     struct fs_struct *file = get_task_fs(data.task);
@@ -213,6 +217,34 @@ int sys_exit_execveat(void *ctx)
     return 0;
 }
 
+/*
+ * The exit of the process, the threads exiting before the last one are
+ * skipped by signal->live. The mm is released before the tracepoint, so the
+ * exe is not read here, it's from the exec cached in user space.
+ */
+SEC("tracepoint/sched/sched_process_exit")
+int sched_process_exit(void *ctx)
+{
+    event_data_t data = {};
+    if (!init_event_data(&data, ctx))
+        return 0;
+    struct signal_struct *signal = READ_KERN(data.task->signal);
+    if (READ_KERN(signal->live.counter) > 0)
+        return 0;
+    // the action of the exe is dropped after the filter, the pid may be
+    // reused
+    int filtered = context_filter(&data.context);
+    bpf_map_delete_elem(&exe_filter, &data.context.tid);
+    if (filtered)
+        return 0;
+    data.context.type = SCHED_PROCESS_EXIT;
+    // the status as wait(2), exit code in the high byte and the signal in
+    // the low 7 bits
+    int exit_code = READ_KERN(data.task->exit_code);
+    save_to_submit_buf(&data, &exit_code, sizeof(int), 0);
+    return events_perf_submit(&data);
+}
+
 struct _sys_enter_prctl {
     unsigned long long unused;
     long syscall_nr;
@@ -88,170 +88,326 @@ int BPF_KPROBE(kprobe_security_socket_bind)
     return events_perf_submit(&data);
 }
 
+/* For outbound connections */
+// The connection is reported with the local and the remote address, the
+// owner is the current task, so the pid and the container are in the
+// context. tcp_connect is called after the local port is picked up, in
+// both tcp_v4_connect and tcp_v6_connect.
+// save the local or the remote address of the socket as the sockaddr
+static __always_inline int save_sock_addr(event_data_t *data, struct sock *sk,
+                                          u16 family, int remote, u8 index)
+{
+    if (family == AF_INET) {
+        net_conn_v4_t net_details = {};
+        struct sockaddr_in addr = {};
+        get_network_details_from_sock_v4(sk, &net_details, 0);
+        if (remote)
+            get_remote_sockaddr_in_from_network_details(&addr, &net_details, family);
+        else
+            get_local_sockaddr_in_from_network_details(&addr, &net_details, family);
+        save_to_submit_buf(data, &addr, sizeof(struct sockaddr_in), index);
+        return 1;
+    } else if (family == AF_INET6) {
+        net_conn_v6_t net_details = {};
+        struct sockaddr_in6 addr = {};
+        get_network_details_from_sock_v6(sk, &net_details, 0);
+        if (remote) {
+            get_remote_sockaddr_in6_from_network_details(&addr, &net_details, family);
+        } else {
+            addr.sin6_family = family;
+            addr.sin6_port = net_details.local_port;
+            addr.sin6_addr = net_details.local_address;
+        }
+        save_to_submit_buf(data, &addr, sizeof(struct sockaddr_in6), index);
+        return 1;
+    }
+    return 0;
+}
+
+SEC("kprobe/tcp_connect")
+int BPF_KPROBE(kprobe_tcp_connect)
+{
+    event_data_t data = {};
+    if (!init_event_data(&data, ctx))
+        return 0;
+    if (context_filter(&data.context))
+        return 0;
+    data.context.type = NET_CONNECT;
+
+    struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+    if (sk == NULL)
+        return 0;
+    u16 family = READ_KERN(sk->sk_family);
+    if (!save_sock_addr(&data, sk, family, 0, 0))
+        return 0;
+    save_sock_addr(&data, sk, family, 1, 1);
+    __u16 protocol = IPPROTO_TCP;
+    save_to_submit_buf(&data, (void *)&protocol, sizeof(protocol), 2);
+    void *exe = get_exe_from_task(data.task);
+    save_str_to_buf(&data, exe, 3);
+    return events_perf_submit(&data);
+}
+
+// UDP has no connection, every datagram goes through udp(v6)_sendmsg. To
+// keep the volume low, the same flow of a process is reported once in
+// UDP_FLOW_INTERVAL, which is kept in the lru map below.
+#define UDP_FLOW_INTERVAL 60000000000ULL
+
+typedef struct udp_flow {
+    __u32 tgid;
+    __u16 family;
+    __u16 port;
+    __u8 addr[16];
+} udp_flow_t;
+
+BPF_LRU_HASH(udp_flows, udp_flow_t, u64, 10240);
+
+static __always_inline int udp_flow_seen(udp_flow_t *flow)
+{
+    u64 now = bpf_ktime_get_ns();
+    u64 *last = bpf_map_lookup_elem(&udp_flows, flow);
+    if (last != NULL && now - *last < UDP_FLOW_INTERVAL)
+        return 1;
+    bpf_map_update_elem(&udp_flows, flow, &now, BPF_ANY);
+    return 0;
+}
+
+// The remote is from msg_name of sendto, or the socket connected. The local
+// port is 0 for the first datagram of the socket not bound, since it's
+// picked up in udp_sendmsg.
+static __always_inline int trace_udp_send(struct pt_regs *ctx)
+{
+    struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+    struct msghdr *msg = (struct msghdr *)PT_REGS_PARM2(ctx);
+    if (sk == NULL || msg == NULL)
+        return 0;
+    udp_flow_t flow = {};
+    flow.tgid = bpf_get_current_pid_tgid() >> 32;
+    struct sockaddr_in6 remote = {};
+    struct sockaddr *name = (struct sockaddr *)READ_KERN(msg->msg_name);
+    if (name != NULL) {
+        flow.family = READ_KERN(name->sa_family);
+        if (flow.family == AF_INET)
+            bpf_probe_read(&remote, sizeof(struct sockaddr_in), name);
+        else if (flow.family == AF_INET6)
+            bpf_probe_read(&remote, sizeof(struct sockaddr_in6), name);
+        else
+            return 0;
+    } else {
+        flow.family = READ_KERN(sk->sk_family);
+        if (flow.family == AF_INET) {
+            net_conn_v4_t net_details = {};
+            get_network_details_from_sock_v4(sk, &net_details, 0);
+            get_remote_sockaddr_in_from_network_details(
+                    (struct sockaddr_in *)&remote, &net_details, flow.family);
+        } else if (flow.family == AF_INET6) {
+            net_conn_v6_t net_details = {};
+            get_network_details_from_sock_v6(sk, &net_details, 0);
+            get_remote_sockaddr_in6_from_network_details(&remote, &net_details,
+                                                         flow.family);
+        } else {
+            return 0;
+        }
+    }
+    // sin_port and sin6_port are at the same offset
+    flow.port = remote.sin6_port;
+    if (flow.port == 0)
+        return 0;
+    if (flow.family == AF_INET)
+        __builtin_memcpy(flow.addr,
+                         &((struct sockaddr_in *)&remote)->sin_addr, 4);
+    else
+        __builtin_memcpy(flow.addr, &remote.sin6_addr, 16);
+    if (udp_flow_seen(&flow))
+        return 0;
+
+    event_data_t data = {};
+    if (!init_event_data(&data, ctx))
+        return 0;
+    if (context_filter(&data.context))
+        return 0;
+    data.context.type = NET_CONNECT;
+    if (!save_sock_addr(&data, sk, READ_KERN(sk->sk_family), 0, 0))
+        return 0;
+    if (flow.family == AF_INET)
+        save_to_submit_buf(&data, &remote, sizeof(struct sockaddr_in), 1);
+    else
+        save_to_submit_buf(&data, &remote, sizeof(struct sockaddr_in6), 1);
+    __u16 protocol = IPPROTO_UDP;
+    save_to_submit_buf(&data, (void *)&protocol, sizeof(protocol), 2);
+    void *exe = get_exe_from_task(data.task);
+    save_str_to_buf(&data, exe, 3);
+    return events_perf_submit(&data);
+}
+
+SEC("kprobe/udp_sendmsg")
+int BPF_KPROBE(kprobe_udp_sendmsg_connect)
+{
+    return trace_udp_send(ctx);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int BPF_KPROBE(kprobe_udpv6_sendmsg_connect)
+{
+    return trace_udp_send(ctx);
+}
+
 /* For DNS */
-BPF_LRU_HASH(udpmsg, u64, struct msghdr *, 1024);
-// kprobe/kretprobe are used for get dns data. Proper way to get udp data,
-// is to hook the kretprobe of the udp_recvmsg just like Elkeid does. But
-// still, a uprobe of udp (like getaddrinfo and gethostbyname) to get this
-// all.
-// @Reference: https://www.nlnetlabs.nl/downloads/publications/DNS-augmentation-with-eBPF.pdf
-SEC("kprobe/udp_recvmsg")
-int BPF_KPROBE(kprobe_udp_recvmsg)
+// The DNS messages are copied as they are, and decoded in user space. Only
+// port 53 and 5353 are considered, 53 is well known for dns while 5353 is
+// the mDNS. The ports are in network byte order here.
+#define DNS_PORT      13568
+#define MDNS_PORT     59668
+#define DNS_HEADER_SIZE 12
+#define MAX_DNS_SIZE  512
+
+static __always_inline int is_dns_port(__u16 port)
+{
+    return port == DNS_PORT || port == MDNS_PORT;
+}
+
+// the user buffer of the first iovec, in msghdr->iov_iter. There are
+// different way to filter. What we need is iovec. In Elkeid, they judge by
+// the iov_len. In ehids-agent or https://github.com/trichimtrich/dns-tcp-ebpf,
+// they judge by the (type != ITER_IOVEC). But be careful about the name of
+// `type` or `iter_type`, it was changed in kernel 5.14.
+// @Reference: https://lwn.net/Articles/625077/
+static __always_inline void *get_msg_iov_base(struct msghdr *msg,
+                                              unsigned long *len)
+{
+    struct iovec *iov = (struct iovec *)READ_KERN(msg->msg_iter.iov);
+    if (iov == NULL)
+        return NULL;
+    *len = READ_KERN(iov->iov_len);
+    return READ_KERN(iov->iov_base);
+}
+
+// The query is read in the kprobe of udp(v6)_sendmsg, the port is from
+// msg_name of sendto, or the socket connected. sin_port and sin6_port are
+// at the same offset.
+static __always_inline int trace_dns_query(struct pt_regs *ctx)
+{
+    struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+    struct msghdr *msg = (struct msghdr *)PT_REGS_PARM2(ctx);
+    __u16 dport = 0;
+    struct sockaddr_in *sin = (struct sockaddr_in *)READ_KERN(msg->msg_name);
+    if (sin != NULL)
+        dport = READ_KERN(sin->sin_port);
+    else
+        dport = READ_KERN(((struct inet_sock *)sk)->inet_dport);
+    if (!is_dns_port(dport))
+        return 0;
+    unsigned long len = 0;
+    void *base = get_msg_iov_base(msg, &len);
+    if (base == NULL || len < DNS_HEADER_SIZE)
+        return 0;
+    if (len > MAX_DNS_SIZE)
+        len = MAX_DNS_SIZE;
+
+    event_data_t data = {};
+    if (!init_event_data(&data, ctx))
+        return 0;
+    if (context_filter(&data.context))
+        return 0;
+    data.context.type = UDP_SENDMSG;
+    save_user_bytes_to_buf(&data, base, len, 0);
+    void *exe = get_exe_from_task(data.task);
+    save_str_to_buf(&data, exe, 1);
+    return events_perf_submit(&data);
+}
+
+SEC("kprobe/udp_sendmsg")
+int BPF_KPROBE(kprobe_udp_sendmsg)
+{
+    return trace_dns_query(ctx);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int BPF_KPROBE(kprobe_udpv6_sendmsg)
+{
+    return trace_dns_query(ctx);
+}
+
+/*
+ * The buffer of the response is saved in the kprobe of udp(v6)_recvmsg, and
+ * read in the kretprobe by the bytes received. The iov_iter is advanced
+ * once it's filled, so the buffer, rather than the msghdr, is saved.
+ * kprobe/kretprobe are used for get dns data. Proper way to get udp data,
+ * is to hook the kretprobe of the udp_recvmsg just like Elkeid does.
+ * @Reference: https://www.nlnetlabs.nl/downloads/publications/DNS-augmentation-with-eBPF.pdf
+ */
+BPF_LRU_HASH(udpmsg, u64, void *, 1024);
+
+static __always_inline int trace_dns_response_entry(struct pt_regs *ctx)
 {
-    // get the sock
     struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
     struct inet_sock *inet = (struct inet_sock *)sk;
-    // only port 53 and 5353 is considered useful here. Port 53 is well
-    // known for dns while 5353 is the mDNS
-    __u16 dport = READ_KERN(inet->inet_dport);
     // @ Notice:
     // In some situation, when we use command 'dig', 'nslookup' etc., it actually
     // comes from other ports(not 53 or 5353).
     // if all udp traffic is required, remove the dport thing.
-    // By the way, I capture the Query part of dns structure and ignore TC flag,
-    // which is somehow inaccurate though, but I'll do a uprobe hook for this all.
-    if (dport == 13568 || dport == 59668)
-    {
-        struct msghdr *msg = (struct msghdr *)PT_REGS_PARM2(ctx);
-        // in msghdr->iov_iter. There are different way to filter. What we need
-        // is iovec. In Elkeid, they judge by the iov_len. In ehids-agent or
-        // https://github.com/trichimtrich/dns-tcp-ebpf, they judge by the
-        // (type != ITER_IOVEC). But just as I said, be careful about the name of
-        // `type` or `iter_type`
-        struct iovec *iov = (struct iovec *)READ_KERN(msg->msg_iter.iov);
-        if (iov == NULL)
-            return 0;
-        unsigned long iov_len = READ_KERN(iov->iov_len);
-        if (iov_len == 0)
-            return 0;
-        // maybe bpf_get_prandom_u32() as a key...
-        u64 pid_tgid = bpf_get_current_pid_tgid();
-        bpf_map_update_elem(&udpmsg, &pid_tgid, &msg, BPF_ANY);
-    }
+    __u16 dport = READ_KERN(inet->inet_dport);
+    if (!is_dns_port(dport))
+        return 0;
+    struct msghdr *msg = (struct msghdr *)PT_REGS_PARM2(ctx);
+    unsigned long len = 0;
+    void *base = get_msg_iov_base(msg, &len);
+    if (base == NULL || len < DNS_HEADER_SIZE)
+        return 0;
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_update_elem(&udpmsg, &pid_tgid, &base, BPF_ANY);
     return 0;
 }
 
-// in Elkeid, ip infomration is also collected, we'll add this later.
-struct udpdata
-{
-    int opcode;
-    int rcode;
-    int qtype; // dns: question type. 1 - A; 5 - cname; 28 - AAAA...
-    int atype; // dns: answer(rr) type. 1 - A; 5 - cname; 28 - AAAA... [just get first rr type]
-};
-
-// @Reference: https://en.wikipedia.org/wiki/Domain_Name_System
-SEC("kretprobe/udp_recvmsg")
-int BPF_KRETPROBE(kretprobe_udp_recvmsg)
+static __always_inline int trace_dns_response(struct pt_regs *ctx)
 {
     u64 pid_tgid = bpf_get_current_pid_tgid();
-    struct msghdr **msgpp = bpf_map_lookup_elem(&udpmsg, &pid_tgid);
-    if (msgpp == 0)
+    void **basep = bpf_map_lookup_elem(&udpmsg, &pid_tgid);
+    if (basep == NULL)
         return 0;
-    // Here are some information about msghdr:
-    // @Reference: https://www.cnblogs.com/wanpengcoder/p/11749287.html
-    // Shortly, the information that we need is in msghdr->msg_iter which
-    // stores the data. For the field in iovter, an article is here:
-    // @Reference: https://lwn.net/Articles/625077/
-    // iov_iter: iterator for working through an iovec structure
-    // Also something interestring: https://github.com/dmliscinsky/lkm-rootkit
-    // something funny is that the msg_iter.type was changed into iter_type
-    // in kernel 5.14, a define macro should be used to fix this...
-    // A reference here:
-    // @Reference: https://github.com/iovisor/bcc/issues/3859
-    //
-    // By the way this struct(msghdr) is defined in socket.h
-    struct msghdr *msg = (struct msghdr *)*msgpp;
-    // Check the msghdr length
-    // issue #39 BUG fix:
-    // due to wrong usage of READ_KERN
-    int ret = 0;
-    struct iov_iter msg_iter = {};
-    struct iovec iov;
-
-    msg_iter = READ_KERN(msg->msg_iter);
-    ret = bpf_probe_read(&iov, sizeof(iov), msg_iter.iov);
-    if (ret != 0)
+    void *base = *basep;
+    long len = PT_REGS_RC(ctx);
+    if (len < DNS_HEADER_SIZE)
         goto delete;
-    unsigned long iov_len = iov.iov_len;
-    if (iov_len < 20)
+    // truncated here, do not drop, the answers in the rest are skipped
+    if (len > MAX_DNS_SIZE)
+        len = MAX_DNS_SIZE;
+
+    event_data_t data = {};
+    if (!init_event_data(&data, ctx))
         goto delete;
-    // truncated here, do not drop, as in dns
-    if (iov_len > 512)
-        iov_len = 512;
-    // Firstly, we need to understand the dns data struct
-    // The reference is here: http://c.biancheng.net/view/6457.html
-    // |QR|Opcode|AA|TC|RD|RA|Z|rcode|
-    // QR equals 1 means is a response, so it's what we need
-    buf_t *string_p = get_buf(STRING_BUF_IDX);
-    if (string_p == NULL)
+    if (context_filter(&data.context))
         goto delete;
-    bpf_probe_read_user(&(string_p->buf[0]), iov_len & (512), iov.iov_base);
-    // The data structure of dns is here...
-    // |SessionID(2 bytes)|Flags(2 bytes)|Data(8 bytes)|Querys...|
-    // The datas that we need are flags & querys
-    int qr = (string_p->buf[2] & 0x80) ? 1 : 0;
-    if (qr == 1)
-    {
-        event_data_t data = {};
-        if (!init_event_data(&data, ctx))
-            return 0;
-        if (context_filter(&data.context))
-            return 0;
-        data.context.type = UDP_RECVMSG;
-
-        int opcode = (string_p->buf[2] >> 3) & 0x0f;
-        int rcode = string_p->buf[3] & 0x0f;
-        struct udpdata udata = {};
-        udata.opcode = opcode;
-        udata.rcode = rcode;
-        
-        int len;
-        int templen;
-        int end_flag = 0; // end_flag: question domain parse finished 
-// change the data to a string, as max, we support 10
-#pragma unroll
-        for (int i = 0; i < 10; i++)
-        {
-            // firstly get the length
-            if (i == 0)
-            {
-                len = string_p->buf[12];
-                len = 12 + len;
-            }
-            else
-            {
-                templen = string_p->buf[(len + 1) & (MAX_PERCPU_BUFSIZE - 1)];
-                if (templen == 0)
-                {
-                    end_flag = 1;
-                    break;
-                }
-                string_p->buf[(len + 1) & (MAX_PERCPU_BUFSIZE - 1)] = 46;
-                len = len + templen + 1;
-            }
-        }
+    data.context.type = UDP_RECVMSG;
+    save_user_bytes_to_buf(&data, base, len, 0);
+    void *exe = get_exe_from_task(data.task);
+    save_str_to_buf(&data, exe, 1);
+    events_perf_submit(&data);
+delete:
+    bpf_map_delete_elem(&udpmsg, &pid_tgid);
+    return 0;
+}
 
-        // bad case: we hav't finished domain parse
-        if (end_flag == 1) {
-            udata.qtype =  string_p->buf[(len + 3) & (MAX_PERCPU_BUFSIZE - 1)] | \
-                    string_p->buf[(len + 2) & (MAX_PERCPU_BUFSIZE - 1)]; 
-            udata.atype =  string_p->buf[(len + 5 + 3) & (MAX_PERCPU_BUFSIZE - 1)] | \
-                    string_p->buf[(len + 5 + 4) & (MAX_PERCPU_BUFSIZE - 1)];
-        } else { // bad case: default val
-            udata.qtype = 0;
-            udata.atype = 0;
-        }
+SEC("kprobe/udp_recvmsg")
+int BPF_KPROBE(kprobe_udp_recvmsg)
+{
+    return trace_dns_response_entry(ctx);
+}
+
+SEC("kretprobe/udp_recvmsg")
+int BPF_KRETPROBE(kretprobe_udp_recvmsg)
+{
+    return trace_dns_response(ctx);
+}
 
-        // commit: udata
-        save_to_submit_buf(&data, &udata, sizeof(struct udpdata), 0);
+SEC("kprobe/udpv6_recvmsg")
+int BPF_KPROBE(kprobe_udpv6_recvmsg)
+{
+    return trace_dns_response_entry(ctx);
+}
 
-        save_str_to_buf(&data, (void *)&string_p->buf[13], 1);
-        // get exe from task
-        void *exe = get_exe_from_task(data.task);
-        save_str_to_buf(&data, exe, 1);
-        events_perf_submit(&data);
-    }
-    delete : bpf_map_delete_elem(&udpmsg, &pid_tgid);
-    return 0;
+SEC("kretprobe/udpv6_recvmsg")
+int BPF_KRETPROBE(kretprobe_udpv6_recvmsg)
+{
+    return trace_dns_response(ctx);
 }
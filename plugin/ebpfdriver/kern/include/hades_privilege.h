@@ -13,10 +13,94 @@
 #include "bpf_core_read.h"
 #include "bpf_tracing.h"
 
+/*
+ * The setuid family syscalls change the creds by commit_creds as well, the
+ * syscall in progress is kept here, so the transition is told apart from
+ * the ones in exec or in kernel, which has no syscall.
+ */
+#define PRIV_SETUID    1
+#define PRIV_SETREUID  2
+#define PRIV_SETRESUID 3
+
+BPF_LRU_HASH(setuid_syscalls, u64, u32, 1024);
+
+static __always_inline int setuid_enter(u32 syscall)
+{
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_update_elem(&setuid_syscalls, &pid_tgid, &syscall, BPF_ANY);
+    return 0;
+}
+
+static __always_inline int setuid_exit(void)
+{
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_delete_elem(&setuid_syscalls, &pid_tgid);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_setuid")
+int sys_enter_setuid(void *ctx)
+{
+    return setuid_enter(PRIV_SETUID);
+}
+
+SEC("tracepoint/syscalls/sys_exit_setuid")
+int sys_exit_setuid(void *ctx)
+{
+    return setuid_exit();
+}
+
+SEC("tracepoint/syscalls/sys_enter_setreuid")
+int sys_enter_setreuid(void *ctx)
+{
+    return setuid_enter(PRIV_SETREUID);
+}
+
+SEC("tracepoint/syscalls/sys_exit_setreuid")
+int sys_exit_setreuid(void *ctx)
+{
+    return setuid_exit();
+}
+
+SEC("tracepoint/syscalls/sys_enter_setresuid")
+int sys_enter_setresuid(void *ctx)
+{
+    return setuid_enter(PRIV_SETRESUID);
+}
+
+SEC("tracepoint/syscalls/sys_exit_setresuid")
+int sys_exit_setresuid(void *ctx)
+{
+    return setuid_exit();
+}
+
 // Detection of privilege escalation
+// In Elkeid, only uid none zero to zero is detected, and in tracee, any uid
+// changes lead to the detection. Both are noisy since sudo and su do this
+// every time. Here, the transition is filtered in kernel, and reported only
+// if it's unexpected:
+// 1. the uid goes to 0 from none zero
+// 2. the old euid is not 0. The setuid binaries, like sudo or su, get euid
+//    0 by exec firstly (the uid is kept in exec), and then setuid(0) as a
+//    privileged one, which is expected.
+// 3. the parent is not root, the root may drop and regain the privilege
 SEC("kprobe/commit_creds")
 int BPF_KPROBE(kprobe_commit_creds)
 {
+    struct cred *new = (struct cred *)PT_REGS_PARM1(ctx);
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct cred *old = (struct cred *)get_task_real_cred(task);
+
+    unsigned int new_uid = READ_KERN(new->uid.val);
+    unsigned int old_uid = READ_KERN(old->uid.val);
+    unsigned int old_euid = READ_KERN(old->euid.val);
+    if (new_uid != 0 || old_uid == 0 || old_euid == 0)
+        return 0;
+    struct task_struct *parent = READ_KERN(task->real_parent);
+    struct cred *parent_cred = (struct cred *)get_task_real_cred(parent);
+    if (READ_KERN(parent_cred->uid.val) == 0)
+        return 0;
+
     event_data_t data = {};
     if (!init_event_data(&data, ctx))
         return 0;
@@ -24,23 +108,18 @@ int BPF_KPROBE(kprobe_commit_creds)
         return 0;
     data.context.type = COMMIT_CREDS;
 
-    struct cred *new = (struct cred *)PT_REGS_PARM1(ctx);
-    struct cred *old = (struct cred *)get_task_real_cred(data.task);
-
-    unsigned int new_uid = READ_KERN(new->uid.val);
-    unsigned int old_uid = READ_KERN(old->uid.val);
-
-    // in Elkeid: privilege escalation only detect uid none zero to zero
-    // But in tracee, any uid changes will lead to detection of this
-    if (new_uid == 0 && old_uid != 0)
-    {
-        save_to_submit_buf(&data, &new_uid, sizeof(unsigned int), 0);
-        save_to_submit_buf(&data, &old_uid, sizeof(unsigned int), 1);
-        void *exe = get_exe_from_task(data.task);
-        save_str_to_buf(&data, exe, 2);
-        save_pid_tree_to_buf(&data, 12, 3);
-        events_perf_submit(&data);
-        return 1;
-    }
-    return 0;
-}
\ No newline at end of file
+    u32 syscall = 0;
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    u32 *syscallp = bpf_map_lookup_elem(&setuid_syscalls, &pid_tgid);
+    if (syscallp != NULL)
+        syscall = *syscallp;
+    save_to_submit_buf(&data, &new_uid, sizeof(unsigned int), 0);
+    save_to_submit_buf(&data, &old_uid, sizeof(unsigned int), 1);
+    void *exe = get_exe_from_task(data.task);
+    save_str_to_buf(&data, exe, 2);
+    save_pid_tree_to_buf(&data, 12, 3);
+    save_to_submit_buf(&data, &old_euid, sizeof(unsigned int), 4);
+    save_to_submit_buf(&data, &syscall, sizeof(u32), 5);
+    events_perf_submit(&data);
+    return 1;
+}
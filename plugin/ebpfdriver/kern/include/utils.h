@@ -95,22 +95,64 @@ static __always_inline int init_context(context_t *context,
     return 0;
 }
 
+// policy_filter drops the key denied, or the one not allowed if there are
+// allow rules of the kind
+// 0 on false & 1 on true
+static __always_inline int policy_filter(void *map, void *key, __u32 flags,
+                                         __u32 allow)
+{
+    __u32 *action = bpf_map_lookup_elem(map, key);
+    if (action != NULL && *action == FILTER_DENY)
+        return 1;
+    if ((flags & allow) && (action == NULL || *action != FILTER_ALLOW))
+        return 1;
+    return 0;
+}
+
 // this is kernel space simple filter, also userspace filter will be supported
 // 0 on false & 1 on true
 static __always_inline int context_filter(context_t *context)
 {
+    __u32 flags = get_config(CONFIG_FILTERS);
     // ID filter for all
-    if (bpf_map_lookup_elem(&pid_filter, &context->tid) != 0)
+    if (policy_filter(&pid_filter, &context->tid, flags, FILTER_PID_ALLOW))
         return 1;
     if (bpf_map_lookup_elem(&uid_filter, &context->uid) != 0)
         return 1;
-    if (bpf_map_lookup_elem(&cgroup_id_filter, &context->cgroup_id) != 0)
+    if (policy_filter(&cgroup_id_filter, &context->cgroup_id, flags,
+                      FILTER_CGROUP_ALLOW))
+        return 1;
+    if (bpf_map_lookup_elem(&pns_filter, &context->pns) != 0)
         return 1;
-    if (bpf_map_lookup_elem(&cgroup_id_filter, &context->pns) != 0)
+    if ((flags & FILTER_EXE_ON) &&
+        policy_filter(&exe_filter, &context->tid, flags, FILTER_EXE_ALLOW))
         return 1;
     return 0;
 }
 
+// exe_filter_update matches the exe with the path prefixes in exec, and keeps
+// the action for the process, so the path is not read for every event. The
+// processes started before the policy are updated by the driver.
+static __always_inline void exe_filter_update(void *exe, __u32 tgid)
+{
+    if (exe == NULL || !(get_config(CONFIG_FILTERS) & FILTER_EXE_ON))
+        return;
+    __u32 zero = 0;
+    path_key_t *key = bpf_map_lookup_elem(&path_keys, &zero);
+    if (key == NULL)
+        return;
+    key->prefixlen = MAX_STR_FILTER_SIZE * 8;
+    __builtin_memset(key->data, 0, sizeof(key->data));
+    bpf_probe_read_str(key->data, sizeof(key->data), exe);
+    __u32 *action = bpf_map_lookup_elem(&path_filter, key);
+    if (action == NULL) {
+        bpf_map_delete_elem(&exe_filter, &tgid);
+        return;
+    }
+    __u32 value = *action;
+    bpf_map_update_elem(&exe_filter, &tgid, &value, BPF_ANY);
+}
+
 /*
  * Filter in kernel space, mainly for remote addr, cidr
  * is supported as well. Now, it's only ipv4, for test
@@ -809,12 +851,19 @@ static __always_inline int init_event_data(event_data_t *data, void *ctx)
 
 static __always_inline int events_perf_submit(event_data_t *data)
 {
+    if (policy_filter(&event_filter, &data->context.type,
+                      get_config(CONFIG_FILTERS), FILTER_EVENT_ALLOW))
+        return 0;
     bpf_probe_read(&(data->submit_p->buf[0]), sizeof(context_t),
                    &data->context);
     int size = data->buf_off & (MAX_PERCPU_BUFSIZE - 1);
     void *output_data = data->submit_p->buf;
+#ifdef RINGBUF
+    return bpf_ringbuf_output(&exec_ringbuf, output_data, size, 0);
+#else
     return bpf_perf_event_output(data->ctx, &exec_events, BPF_F_CURRENT_CPU,
                                  output_data, size);
+#endif
 }
 
 #endif //__UTILS_BUF_H
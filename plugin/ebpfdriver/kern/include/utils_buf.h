@@ -183,6 +183,38 @@ static __always_inline int save_to_submit_buf(event_data_t *data, void *ptr,
     return 0;
 }
 
+/*
+ * @function: save bytes in user space to buffer, at most
+ * MAX_BYTES_ARR_SIZE - 1
+ * @structure: [index][size][ ... bytes ... ]
+ */
+static __always_inline int save_user_bytes_to_buf(event_data_t *data,
+                                                  void *ptr, __u32 size,
+                                                  u8 index)
+{
+    size &= (MAX_BYTES_ARR_SIZE - 1);
+    if (size == 0)
+        return 0;
+    if (data->buf_off >
+        (MAX_PERCPU_BUFSIZE) - (MAX_BYTES_ARR_SIZE) - sizeof(int) - 1)
+        return 0;
+    data->submit_p->buf[(data->buf_off) & (MAX_PERCPU_BUFSIZE - 1)] = index;
+    // Satisfy validator for probe read
+    if ((data->buf_off + 1) <=
+        (MAX_PERCPU_BUFSIZE) - (MAX_BYTES_ARR_SIZE) - sizeof(int)) {
+        __builtin_memcpy(&(data->submit_p->buf[data->buf_off + 1]), &size,
+                         sizeof(int));
+        if (bpf_probe_read_user(
+                    &(data->submit_p->buf[data->buf_off + 1 + sizeof(int)]),
+                    size, ptr) == 0) {
+            data->buf_off += size + sizeof(int) + 1;
+            data->context.argnum++;
+            return 1;
+        }
+    }
+    return 0;
+}
+
 // Thiner than tracee. It's all we need now
 typedef struct slim_cred {
     uid_t uid;   // real UID of the task
@@ -1,46 +1,103 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"hades-ebpf/user"
 	"hades-ebpf/user/cache"
 	"hades-ebpf/user/decoder"
+	"hades-ebpf/user/filter"
 	"hades-ebpf/user/share"
 
 	"github.com/chriskaliX/SDK"
 	"github.com/chriskaliX/SDK/logger"
+	"github.com/chriskaliX/SDK/transport"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func driver(s SDK.ISandbox) error {
-	decoder.SetAllowList(share.EventFilter)
-	driver, err := user.NewDriver(s)
-	if err != nil {
-		zap.S().Error(err)
-		return err
+func driver(sandbox *SDK.Sandbox) func(SDK.ISandbox) error {
+	return func(s SDK.ISandbox) error {
+		driver, err := user.NewDriver(s)
+		if err != nil {
+			zap.S().Error(err)
+			return err
+		}
+		if err = driver.Start(); err != nil {
+			zap.S().Error(err)
+			return err
+		}
+		if err = driver.Init(); err != nil {
+			zap.S().Error(err)
+			return err
+		}
+		// the policy saved is applied before the one from the server
+		policy, err := filter.LoadPolicyFile(filter.PolicyFile)
+		if err == nil && policy != nil {
+			err = driver.ApplyPolicy(policy)
+		}
+		if err != nil {
+			zap.S().Errorf("policy saved is not applied: %s", err)
+		}
+		// registered before Run advertises the capabilities
+		sandbox.Client.OnTask(filter.TaskPolicy, func(ctx context.Context, task *transport.Task) (string, error) {
+			return "", applyPolicy(driver, task)
+		})
+		go handleTask(sandbox)
+		return nil
 	}
-	if err = driver.Start(); err != nil {
-		zap.S().Error(err)
-		return err
+}
+
+// applyPolicy applies the filter policy delivered by the task and saves it,
+// the policy applied but not saved is still reported as done
+func applyPolicy(driver *user.Driver, task *transport.Task) error {
+	policy, err := filter.LoadPolicyFromTask(task)
+	if err == nil {
+		err = driver.ApplyPolicy(policy)
 	}
-	if err = driver.Init(); err != nil {
-		zap.S().Error(err)
+	if err != nil {
+		zap.S().Errorf("policy is not applied: %s", err)
 		return err
 	}
+	if err = policy.Save(filter.PolicyFile); err != nil {
+		zap.S().Errorf("policy is not saved: %s", err)
+	}
 	return nil
 }
 
+// handleTask reports the tasks without a handler as failed, so they are not
+// waited for by the server
+func handleTask(sandbox *SDK.Sandbox) {
+	for {
+		select {
+		case <-sandbox.Context().Done():
+			return
+		case task := <-sandbox.Task:
+			err := fmt.Errorf("task %d is not supported", task.GetDataType())
+			if err := sandbox.Client.SendTaskResult(task, "", err); err != nil {
+				zap.S().Error(err)
+			}
+		}
+	}
+}
+
 func main() {
 	var debug bool
 	flag.BoolVar(&debug, "debug", false, "set to run in debug mode")
 	flag.StringVar(&share.EventFilter, "filter", "0", "set filter to specific the event id")
 	flag.Parse()
+	decoder.SetAllowList(share.EventFilter)
 	// start the sandbox
 	sconfig := &SDK.SandboxConfig{
 		Debug: debug,
 		Hash:  true,
 		Name:  "ebpfdriver",
+		// the task types are the ones registered by OnTask
+		Capabilities: transport.Capabilities{
+			// the events lost are in 999
+			DataTypes: append(decoder.DataTypes(), 999),
+		},
 		LogConfig: &logger.Config{
 			Path:        "ebpfdriver.log",
 			MaxSize:     10,
@@ -59,5 +116,5 @@ func main() {
 	// TODO: Dirty init jusr for now
 	cache.DefaultHashCache = sandbox.Hash
 	// inject into sandbox
-	sandbox.Run(driver)
+	sandbox.Run(driver(sandbox))
 }
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	containerCacheSize       = 4096
+	containerLimiterBurst    = 25
+	containerLimiterInterval = 40 * time.Millisecond
+	containerIDLength        = 64
+	// it's only there on the unified hierarchy of cgroup v2
+	cgroupControllers = "/sys/fs/cgroup/cgroup.controllers"
+)
+
+var DefaultContainerCache = NewContainerCache()
+
+// ContainerCache gets the container id of the process from its cgroup. The
+// processes in the same cgroup are in the same container, so it's cached
+// by the cgroup id from the kernel on the unified hierarchy. The id is of the
+// cgroup v2 one, which is shared by the containers on cgroup v1 or hybrid, so
+// it's cached by the process there.
+type ContainerCache struct {
+	cache    *utilcache.LRUExpireCache
+	rlimiter *rate.Limiter
+	unified  bool
+}
+
+// processKey is the key of the process, the starttime tells the pids reused
+type processKey struct {
+	pid       uint32
+	starttime uint64
+}
+
+func NewContainerCache() *ContainerCache {
+	_, err := os.Stat(cgroupControllers)
+	return &ContainerCache{
+		rlimiter: rate.NewLimiter(rate.Every(containerLimiterInterval), containerLimiterBurst),
+		cache:    utilcache.NewLRUExpireCacheWithClock(containerCacheSize, GTicker),
+		unified:  err == nil,
+	}
+}
+
+func (c *ContainerCache) key(pid uint32, starttime, cgroupID uint64) interface{} {
+	if c.unified {
+		return cgroupID
+	}
+	return processKey{pid: pid, starttime: starttime}
+}
+
+// Get returns the container id, or an empty string for the processes on the
+// host. The cgroup of the ones exited already is unknown.
+func (c *ContainerCache) Get(pid uint32, starttime, cgroupID uint64) string {
+	key := c.key(pid, starttime, cgroupID)
+	if item, ok := c.cache.Get(key); ok {
+		return item.(string)
+	}
+	if !c.rlimiter.Allow() {
+		return OverRate
+	}
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return InVaild
+	}
+	id := parseContainerID(content)
+	c.cache.Add(key, id, time.Hour)
+	return id
+}
+
+// parseContainerID finds the id in the cgroup paths of the runtimes, like
+// "/docker/<id>", "/kubepods/.../<id>", "cri-containerd-<id>.scope" and
+// "crio-<id>.scope"
+func parseContainerID(content []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(s.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, part := range strings.Split(fields[2], "/") {
+			part = strings.TrimSuffix(part, ".scope")
+			if index := strings.LastIndexByte(part, '-'); index >= 0 {
+				part = part[index+1:]
+			}
+			if isContainerID(part) {
+				return part
+			}
+		}
+	}
+	return ""
+}
+
+func isContainerID(s string) bool {
+	if len(s) != containerIDLength {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/lru"
+)
+
+const (
+	processCacheSize = 8192
+	// the ancestors in the lineage at most
+	lineageLimit = 8
+)
+
+var DefaultProcessCache = NewProcessCache()
+
+// Process is what the exec of a process leaves in the cache, for the events
+// of its children and its exit
+type Process struct {
+	Pid  uint32
+	Ppid uint32
+	Exe  string
+	Argv string
+	// Starttime is the ktime of the exec in nanoseconds
+	Starttime uint64
+}
+
+// ProcessCache keeps the processes by pid once they exec, and drops them
+// once they exit. The processes started before the driver are not in it.
+type ProcessCache struct {
+	cache *lru.Cache
+}
+
+func NewProcessCache() *ProcessCache {
+	return &ProcessCache{cache: lru.New(processCacheSize)}
+}
+
+func (p *ProcessCache) Get(pid uint32) (proc Process, ok bool) {
+	value, ok := p.cache.Get(pid)
+	if ok {
+		proc = value.(Process)
+	}
+	return
+}
+
+func (p *ProcessCache) Set(proc Process) {
+	p.cache.Add(proc.Pid, proc)
+}
+
+func (p *ProcessCache) Delete(pid uint32) {
+	p.cache.Remove(pid)
+}
+
+// Lineage returns the ancestors from the parent up as "pid.exe" joined by
+// "<", like the pid_tree. It stops at the first one missed, or a loop of
+// the pids reused.
+func (p *ProcessCache) Lineage(ppid uint32) string {
+	chain := make([]string, 0, lineageLimit)
+	seen := make(map[uint32]bool, lineageLimit)
+	for pid := ppid; pid != 0 && len(chain) < lineageLimit && !seen[pid]; {
+		proc, ok := p.Get(pid)
+		if !ok {
+			break
+		}
+		seen[pid] = true
+		chain = append(chain, strconv.FormatUint(uint64(pid), 10)+"."+proc.Exe)
+		pid = proc.Ppid
+	}
+	if len(chain) == 0 {
+		return InVaild
+	}
+	return strings.Join(chain, "<")
+}
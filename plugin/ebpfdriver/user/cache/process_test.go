@@ -0,0 +1,57 @@
+package cache
+
+import "testing"
+
+func TestLineage(t *testing.T) {
+	p := NewProcessCache()
+	p.Set(Process{Pid: 1, Exe: "/sbin/init"})
+	p.Set(Process{Pid: 100, Ppid: 1, Exe: "/usr/sbin/sshd"})
+	p.Set(Process{Pid: 200, Ppid: 100, Exe: "/bin/bash"})
+	if lineage := p.Lineage(200); lineage != "200./bin/bash<100./usr/sbin/sshd<1./sbin/init" {
+		t.Fatal("unexpected lineage: ", lineage)
+	}
+	p.Delete(100)
+	if lineage := p.Lineage(200); lineage != "200./bin/bash" {
+		t.Fatal("lineage goes on after the exited one: ", lineage)
+	}
+	if lineage := p.Lineage(300); lineage != InVaild {
+		t.Fatal("unexpected lineage of the unknown: ", lineage)
+	}
+	// the pids reused in a loop
+	p.Set(Process{Pid: 100, Ppid: 200, Exe: "/bin/sh"})
+	if lineage := p.Lineage(200); lineage != "200./bin/bash<100./bin/sh" {
+		t.Fatal("unexpected lineage of the loop: ", lineage)
+	}
+}
+
+func TestParseContainerID(t *testing.T) {
+	id := "4ffb2b3a7b46d4d6c4b5d6c2f1b7f3a1e2d3c4b5a69788796a5b4c3d2e1f0a9b"
+	for _, cgroup := range []string{
+		"12:pids:/docker/" + id + "\n",
+		"0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-" + id + ".scope\n",
+		"0::/system.slice/crio-" + id + ".scope\n",
+		"11:memory:/kubepods/besteffort/pod1234/" + id + "\n",
+	} {
+		if got := parseContainerID([]byte(cgroup)); got != id {
+			t.Fatalf("unexpected id of %q: %q", cgroup, got)
+		}
+	}
+	if got := parseContainerID([]byte("0::/user.slice/user-1000.slice/session-1.scope\n")); got != "" {
+		t.Fatal("id of the host: ", got)
+	}
+}
+
+func TestContainerCacheKey(t *testing.T) {
+	c := &ContainerCache{}
+	// the cgroup v2 id is shared by the containers on cgroup v1
+	if c.key(100, 1, 1) == c.key(200, 2, 1) {
+		t.Fatal("processes share the key on cgroup v1")
+	}
+	if c.key(100, 1, 1) == c.key(100, 2, 1) {
+		t.Fatal("pid reused shares the key on cgroup v1")
+	}
+	c.unified = true
+	if c.key(100, 1, 1) != c.key(200, 2, 1) {
+		t.Fatal("processes in the cgroup don't share the key")
+	}
+}
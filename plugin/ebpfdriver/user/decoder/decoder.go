@@ -179,6 +179,23 @@ func (decoder *EbpfDecoder) DecodeString() (s string, err error) {
 	return
 }
 
+// DecodeByteArray decodes the bytes saved by save_user_bytes_to_buf, the
+// slice returned is a copy
+func (decoder *EbpfDecoder) DecodeByteArray() (b []byte, err error) {
+	var size int32
+	if err = decoder.DecodeUint8(&decoder.index); err != nil {
+		return
+	}
+	if err = decoder.DecodeInt32(&size); err != nil {
+		return
+	}
+	if size < 0 || size >= 8192 {
+		err = fmt.Errorf("bytes size invalid, size: %d", size)
+		return
+	}
+	return decoder.ReadByteSliceFromBuff(int(size))
+}
+
 func (decoder *EbpfDecoder) DecodeRemoteAddr() (family, port uint16, addr string, err error) {
 	var (
 		_addr uint32
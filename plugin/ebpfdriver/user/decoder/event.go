@@ -1,7 +1,9 @@
 package decoder
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -52,6 +54,16 @@ func SetAllowList(allows ...string) {
 	}
 }
 
+// DataTypes returns the ids of the events allowed in order, which are the
+// data types of the records
+func DataTypes() (types []int32) {
+	for id := range Events {
+		types = append(types, int32(id))
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return
+}
+
 func RegistEvent(event Event) {
 	Events[event.ID()] = event
 }
@@ -85,3 +97,29 @@ func GetMap(m *manager.Manager, name string) (*ebpf.Map, error) {
 	}
 	return analyzeCache, nil
 }
+
+// ErrUnknownEvent is returned for the type which is not registered, or is
+// removed by the allow list
+var ErrUnknownEvent = errors.New("unknown event")
+
+// Decode decodes the raw event, which is the same from perf or ringbuf, by
+// the Event registered of its type. The context should be put back by
+// PutContext once the event is used. The error of DecodeEvent is returned
+// with the event, since the event may be ignored or filtered only. It's not
+// thread-safe, as DefaultDecoder.
+func Decode(data []byte) (event Event, err error) {
+	ctx := NewContext()
+	DefaultDecoder.ReInit(data)
+	if err = ctx.DecodeContext(DefaultDecoder); err != nil {
+		PutContext(ctx)
+		return
+	}
+	var ok bool
+	if event, ok = Events[ctx.Type]; !ok {
+		PutContext(ctx)
+		return nil, ErrUnknownEvent
+	}
+	event.SetContext(ctx)
+	err = event.DecodeEvent(DefaultDecoder)
+	return
+}
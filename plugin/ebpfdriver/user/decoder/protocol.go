@@ -65,6 +65,8 @@ type Context struct {
 	PpidArgv string `json:"ppid_argv"`
 	PgidArgv string `json:"pgid_argv"`
 	PodName  string `json:"pod_name"`
+	// ContainerID is parsed from the cgroup, empty for the ones on the host
+	ContainerID string `json:"container_id"`
 }
 
 // GetSizeBytes returns the bytes of the context in kern space
@@ -105,6 +107,7 @@ func (c *Context) FillContext(name, exe string) {
 	c.PpidArgv = cache.DefaultArgvCache.Get(c.Ppid)
 	c.PgidArgv = cache.DefaultArgvCache.Get(c.Pgid)
 	c.PodName = cache.DefaultNsCache.Get(c.Pid, c.Pns)
+	c.ContainerID = cache.DefaultContainerCache.Get(c.Pid, c.Starttime, c.CgroupID)
 	c.Username = cache.DefaultUserCache.Get(c.Uid)
 	c.ExeHash = cache.DefaultHashCache.GetHash(c.Exe)
 }
@@ -4,16 +4,21 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"hades-ebpf/user/decoder"
 	"hades-ebpf/user/event"
+	"hades-ebpf/user/filter"
 	"math"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/chriskaliX/SDK"
 	plugin "github.com/chriskaliX/SDK/transport"
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/ringbuf"
 	manager "github.com/ehids/ebpfmanager"
 	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
@@ -25,6 +30,15 @@ var _bytecode []byte
 const configMap = "config_map"
 const eventMap = "exec_events"
 
+// ringbufMap is in the driver built with RINGBUF, which needs kernel 5.8+.
+// Events are read from it instead of the perf buffer then, in order and
+// without the copies per cpu.
+const ringbufMap = "exec_ringbuf"
+
+// policyInterval is the interval the filter policy is applied again, for the
+// containers and the processes started later
+const policyInterval = time.Minute
+
 var rawdata = make(map[string]string, 1)
 
 // Driver contains the ebpfmanager and eventDecoder. By default, Driver
@@ -34,15 +48,32 @@ type Driver struct {
 	Manager *manager.Manager
 	context context.Context
 	cancel  context.CancelFunc
+	// set if the driver is built with the ringbuf
+	ringbuf bool
+	reader  *ringbuf.Reader
+	// the filter policy from the server, guarded by mu
+	mu     sync.Mutex
+	policy *filter.Policy
 }
 
 // New a driver with pre-set map and options
 func NewDriver(s SDK.ISandbox) (*Driver, error) {
 	driver := &Driver{}
 	driver.Sandbox = s
-	// init ebpfmanager with maps and perf_events
+	spec, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(_bytecode))
+	if err != nil {
+		return nil, err
+	}
+	_, driver.ringbuf = spec.Maps[ringbufMap]
+	// init ebpfmanager with maps and perf_events, or the ringbuf which is
+	// read by the driver itself
 	driver.Manager = &manager.Manager{
-		PerfMaps: []*manager.PerfMap{
+		Maps: []*manager.Map{{Name: configMap}},
+	}
+	if driver.ringbuf {
+		driver.Manager.Maps = append(driver.Manager.Maps, &manager.Map{Name: ringbufMap})
+	} else {
+		driver.Manager.PerfMaps = []*manager.PerfMap{
 			{
 				Map: manager.Map{Name: eventMap},
 				PerfMapOptions: manager.PerfMapOptions{
@@ -51,8 +82,7 @@ func NewDriver(s SDK.ISandbox) (*Driver, error) {
 					LostHandler:        driver.lostHandler,
 				},
 			},
-		},
-		Maps: []*manager.Map{{Name: configMap}},
+		}
 	}
 	// Get all registed events probes and maps, add into the manager
 	for _, event := range decoder.Events {
@@ -61,7 +91,7 @@ func NewDriver(s SDK.ISandbox) (*Driver, error) {
 	}
 	// init manager with options
 	// TODO: High CPU performance here
-	err := driver.Manager.InitWithOptions(bytes.NewReader(_bytecode), manager.Options{
+	err = driver.Manager.InitWithOptions(bytes.NewReader(_bytecode), manager.Options{
 		DefaultKProbeMaxActive: 512,
 		VerifierOptions: ebpf.CollectionOptions{
 			Programs: ebpf.ProgramOptions{
@@ -78,8 +108,34 @@ func NewDriver(s SDK.ISandbox) (*Driver, error) {
 	return driver, err
 }
 
-func (d *Driver) Start() error {
-	return d.Manager.Start()
+func (d *Driver) Start() (err error) {
+	if err = d.Manager.Start(); err != nil || !d.ringbuf {
+		return
+	}
+	events, err := decoder.GetMap(d.Manager, ringbufMap)
+	if err != nil {
+		return
+	}
+	if d.reader, err = ringbuf.NewReader(events); err != nil {
+		return
+	}
+	go d.readRingbuf()
+	return
+}
+
+// readRingbuf reads the events until the reader is closed by Stop
+func (d *Driver) readRingbuf() {
+	for {
+		record, err := d.reader.Read()
+		if err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return
+			}
+			zap.S().Errorf("read ringbuf: %s", err)
+			continue
+		}
+		d.handleEvent(record.RawSample)
+	}
 }
 
 // Init the driver with default value
@@ -118,11 +174,44 @@ func (d *Driver) Init() error {
 			}()
 		}
 	}
+	go func() {
+		ticker := time.NewTicker(policyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.reapplyPolicy(); err != nil {
+					zap.S().Errorf("apply policy: %s", err)
+				}
+			case <-d.context.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
 
-	// TODO: filters are not added for now
+// ApplyPolicy compiles the filter policy into the maps, and keeps it to be
+// applied again
+func (d *Driver) ApplyPolicy(policy *filter.Policy) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := policy.Apply(d.Manager); err != nil {
+		return err
+	}
+	d.policy = policy
 	return nil
 }
 
+func (d *Driver) reapplyPolicy() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.policy == nil {
+		return nil
+	}
+	return d.policy.Apply(d.Manager)
+}
+
 // close probes by uid
 func (d *Driver) Close(UID string) (err error) {
 	for _, probe := range d.Manager.Probes {
@@ -136,24 +225,25 @@ func (d *Driver) Close(UID string) (err error) {
 
 func (d *Driver) Stop() error {
 	d.cancel()
+	if d.reader != nil {
+		d.reader.Close()
+	}
 	return d.Manager.Stop(manager.CleanAll)
 }
 
 func (d *Driver) Filter() {}
 
 func (d *Driver) dataHandler(cpu int, data []byte, perfmap *manager.PerfMap, manager *manager.Manager) {
-	// get and decode the context
-	ctx := decoder.NewContext()
-	decoder.DefaultDecoder.ReInit(data)
-	err := ctx.DecodeContext(decoder.DefaultDecoder)
-	if err != nil {
-		return
+	d.handleEvent(data)
+}
+
+// handleEvent decodes the raw event from perf or ringbuf, and sends it as
+// the record of the type of the event
+func (d *Driver) handleEvent(data []byte) {
+	eventDecoder, err := decoder.Decode(data)
+	if eventDecoder != nil {
+		defer decoder.PutContext(eventDecoder.Context())
 	}
-	defer decoder.PutContext(ctx)
-	// get the event and set context into event
-	eventDecoder := decoder.Events[ctx.Type]
-	eventDecoder.SetContext(ctx)
-	eventDecoder.DecodeEvent(decoder.DefaultDecoder)
 	if err == event.ErrFilter {
 		// it's been filtered
 		return
@@ -163,7 +253,7 @@ func (d *Driver) dataHandler(cpu int, data []byte, perfmap *manager.PerfMap, man
 		return
 	}
 	// Fillup the context by the values that Event offers
-	ctx.FillContext(eventDecoder.Name(), eventDecoder.GetExe())
+	eventDecoder.Context().FillContext(eventDecoder.Name(), eventDecoder.GetExe())
 	// marshal the data
 	result, err := decoder.MarshalJson(eventDecoder)
 	if err != nil {
@@ -173,12 +263,16 @@ func (d *Driver) dataHandler(cpu int, data []byte, perfmap *manager.PerfMap, man
 	rawdata["data"] = result
 	// send the record
 	rec := &plugin.Record{
-		DataType: 1000,
+		DataType:  int32(eventDecoder.ID()),
+		Timestamp: time.Now().Unix(),
 		Data: &plugin.Payload{
 			Fields: rawdata,
 		},
 	}
 	d.Sandbox.SendRecord(rec)
+	// the caches like the lineage are updated once the event is sent, so
+	// it's not taken as the parent of itself
+	eventDecoder.FillCache()
 }
 
 func (d *Driver) lostHandler(CPU int, count uint64, perfMap *manager.PerfMap, manager *manager.Manager) {
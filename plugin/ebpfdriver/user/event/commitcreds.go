@@ -1,6 +1,7 @@
 package event
 
 import (
+	"hades-ebpf/user/cache"
 	"hades-ebpf/user/decoder"
 
 	manager "github.com/ehids/ebpfmanager"
@@ -8,13 +9,28 @@ import (
 
 var _ decoder.Event = (*CommitCreds)(nil)
 
+// setuid family syscalls in progress, from hades_privilege.h. The ones
+// without syscall come from the kernel, which is likely to be an exploit.
+var setuidSyscalls = map[uint32]string{
+	0: "none",
+	1: "setuid",
+	2: "setreuid",
+	3: "setresuid",
+}
+
+// CommitCreds is the unexpected privilege escalation, the uid goes to 0 from
+// none zero while the old euid and the parent's uid are not 0. The expected
+// ones, like sudo and su, are filtered in kernel.
 type CommitCreds struct {
 	decoder.BasicEvent `json:"-"`
 	Exe                string `json:"-"`
 	NewUid             uint32 `json:"newuid"`
 	OldUid             uint32 `json:"olduid"`
+	OldEuid            uint32 `json:"oldeuid"`
+	Syscall            string `json:"syscall"`
 	PidTree            string `json:"pid_tree"`
 	PrivEscalation     uint8  `json:"priv_esca"`
+	Lineage            string `json:"lineage"`
 }
 
 func (CommitCreds) ID() uint32 {
@@ -49,6 +65,21 @@ func (c *CommitCreds) DecodeEvent(e *decoder.EbpfDecoder) (err error) {
 	if c.PidTree, err = e.DecodePidTree(&c.PrivEscalation); err != nil {
 		return
 	}
+	if err = e.DecodeUint8(&index); err != nil {
+		return
+	}
+	if err = e.DecodeUint32(&c.OldEuid); err != nil {
+		return
+	}
+	if err = e.DecodeUint8(&index); err != nil {
+		return
+	}
+	var syscall uint32
+	if err = e.DecodeUint32(&syscall); err != nil {
+		return
+	}
+	c.Syscall = setuidSyscalls[syscall]
+	c.Lineage = cache.DefaultProcessCache.Lineage(c.Context().Ppid)
 	return
 }
 
@@ -60,6 +91,42 @@ func (CommitCreds) GetProbes() []*manager.Probe {
 			EbpfFuncName:     "kprobe_commit_creds",
 			AttachToFuncName: "commit_creds",
 		},
+		{
+			UID:              "TracepointSysEnterSetuid",
+			Section:          "tracepoint/syscalls/sys_enter_setuid",
+			EbpfFuncName:     "sys_enter_setuid",
+			AttachToFuncName: "sys_enter_setuid",
+		},
+		{
+			UID:              "TracepointSysExitSetuid",
+			Section:          "tracepoint/syscalls/sys_exit_setuid",
+			EbpfFuncName:     "sys_exit_setuid",
+			AttachToFuncName: "sys_exit_setuid",
+		},
+		{
+			UID:              "TracepointSysEnterSetreuid",
+			Section:          "tracepoint/syscalls/sys_enter_setreuid",
+			EbpfFuncName:     "sys_enter_setreuid",
+			AttachToFuncName: "sys_enter_setreuid",
+		},
+		{
+			UID:              "TracepointSysExitSetreuid",
+			Section:          "tracepoint/syscalls/sys_exit_setreuid",
+			EbpfFuncName:     "sys_exit_setreuid",
+			AttachToFuncName: "sys_exit_setreuid",
+		},
+		{
+			UID:              "TracepointSysEnterSetresuid",
+			Section:          "tracepoint/syscalls/sys_enter_setresuid",
+			EbpfFuncName:     "sys_enter_setresuid",
+			AttachToFuncName: "sys_enter_setresuid",
+		},
+		{
+			UID:              "TracepointSysExitSetresuid",
+			Section:          "tracepoint/syscalls/sys_exit_setresuid",
+			EbpfFuncName:     "sys_exit_setresuid",
+			AttachToFuncName: "sys_exit_setresuid",
+		},
 	}
 }
 
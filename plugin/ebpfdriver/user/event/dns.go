@@ -0,0 +1,136 @@
+package event
+
+import (
+	"hades-ebpf/user/cache"
+	"hades-ebpf/user/decoder"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/time/rate"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+)
+
+// The DNS messages are copied by the kernel as they are, and decoded here.
+// The same question of the same exe, with the same rcode for the response,
+// is reported once in dnsDedupTTL, and the messages over the rate limit
+// are dropped, as the resolvers may query a lot.
+const (
+	dnsDedupSize       = 4096
+	dnsDedupTTL        = time.Minute
+	dnsLimiterBurst    = 100
+	dnsLimiterInterval = 10 * time.Millisecond
+	// the answers decoded at most
+	dnsMaxAnswers = 8
+)
+
+var (
+	dnsDedup   = utilcache.NewLRUExpireCacheWithClock(dnsDedupSize, cache.GTicker)
+	dnsLimiter = rate.NewLimiter(rate.Every(dnsLimiterInterval), dnsLimiterBurst)
+)
+
+// DNS is shared by the queries and the responses, the fields of the answers
+// are empty for the queries
+type DNS struct {
+	Exe    string `json:"-"`
+	Opcode int32  `json:"opcode"`
+	Rcode  int32  `json:"rcode"`
+	Qtype  int32  `json:"qtype"`
+	// Atype is the type of the first answer
+	Atype int32 `json:"atype"`
+	// DnsData is the name in the question, without the dot at the end
+	DnsData string `json:"dns_data"`
+	// Answers are the addresses and the names of the answers joined by ","
+	Answers string `json:"answers"`
+}
+
+func (d *DNS) decode(e *decoder.EbpfDecoder, response bool) (err error) {
+	var msg []byte
+	if msg, err = e.DecodeByteArray(); err != nil {
+		return
+	}
+	if d.Exe, err = e.DecodeString(); err != nil {
+		return
+	}
+	if err = d.parse(msg, response); err != nil {
+		return ErrFilter
+	}
+	key := d.Exe + "|" + d.DnsData + "|" + strconv.Itoa(int(d.Qtype))
+	if response {
+		key += "|" + strconv.Itoa(int(d.Rcode))
+	}
+	if _, ok := dnsDedup.Get(key); ok {
+		return ErrFilter
+	}
+	if !dnsLimiter.Allow() {
+		return ErrFilter
+	}
+	dnsDedup.Add(key, struct{}{}, dnsDedupTTL)
+	return
+}
+
+// parse decodes the header, the first question and the answers. The message
+// truncated by the kernel keeps the answers parsed before.
+func (d *DNS) parse(msg []byte, response bool) error {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil {
+		return err
+	}
+	if header.Response != response {
+		return ErrIgnore
+	}
+	question, err := p.Question()
+	if err != nil {
+		return err
+	}
+	d.Opcode = int32(header.OpCode)
+	d.Rcode = int32(header.RCode)
+	d.Qtype = int32(question.Type)
+	d.DnsData = strings.TrimSuffix(question.Name.String(), ".")
+	d.Atype, d.Answers = 0, ""
+	if !response {
+		return nil
+	}
+	if err = p.SkipAllQuestions(); err != nil {
+		return nil
+	}
+	answers := make([]string, 0, 2)
+	for i := 0; len(answers) < dnsMaxAnswers; i++ {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		if i == 0 {
+			d.Atype = int32(h.Type)
+		}
+		answer, err := parseAnswer(&p, h.Type)
+		if err != nil {
+			break
+		}
+		if answer != "" {
+			answers = append(answers, answer)
+		}
+	}
+	d.Answers = strings.Join(answers, ",")
+	return nil
+}
+
+// parseAnswer returns the address or the name of the answer, the other types
+// are skipped
+func parseAnswer(p *dnsmessage.Parser, t dnsmessage.Type) (string, error) {
+	switch t {
+	case dnsmessage.TypeA:
+		r, err := p.AResource()
+		return net.IP(r.A[:]).String(), err
+	case dnsmessage.TypeAAAA:
+		r, err := p.AAAAResource()
+		return net.IP(r.AAAA[:]).String(), err
+	case dnsmessage.TypeCNAME:
+		r, err := p.CNAMEResource()
+		return strings.TrimSuffix(r.CNAME.String(), "."), err
+	}
+	return "", p.SkipAnswer()
+}
@@ -0,0 +1,40 @@
+package event
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSParse(t *testing.T) {
+	name := dnsmessage.MustNewName("example.com.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeSuccess})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	b.StartAnswers()
+	header := dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET}
+	b.CNAMEResource(header, dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("edge.example.net.")})
+	header.Type = dnsmessage.TypeA
+	b.AResource(header, dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d DNS
+	if err = d.parse(msg, false); err == nil {
+		t.Fatal("response is taken as the query")
+	}
+	if err = d.parse(msg, true); err != nil {
+		t.Fatal(err)
+	}
+	if d.DnsData != "example.com" || d.Qtype != 1 || d.Atype != 5 || d.Answers != "edge.example.net,93.184.216.34" {
+		t.Fatalf("unexpected message: %+v", d)
+	}
+	// truncated in the answers by the kernel
+	if err = d.parse(msg[:len(msg)-2], true); err != nil || d.Answers != "edge.example.net" {
+		t.Fatalf("unexpected truncated message: %+v, err: %v", d, err)
+	}
+	if err = d.parse(msg[:8], true); err == nil {
+		t.Fatal("message without the header is parsed")
+	}
+}
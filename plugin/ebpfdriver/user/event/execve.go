@@ -24,6 +24,7 @@ type Execve struct {
 	SocketPid          uint32 `json:"socket_pid"`
 	SocketArgv         string `json:"socket_argv"`
 	PidTree            string `json:"pid_tree"`
+	Lineage            string `json:"lineage"`
 	Argv               string `json:"argv"`
 	PrivEscalation     uint8  `json:"priv_esca"`
 	SSHConnection      string `json:"ssh_connection"`
@@ -103,11 +104,19 @@ func (e *Execve) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
 		e.LDPreload = "-1"
 	}
 	e.SocketArgv = cache.DefaultArgvCache.Get(e.SocketPid)
+	e.Lineage = cache.DefaultProcessCache.Lineage(e.Context().Ppid)
 	return
 }
 
 func (e Execve) FillCache() {
 	cache.DefaultArgvCache.Set(e.Context().Pid, e.Argv)
+	cache.DefaultProcessCache.Set(cache.Process{
+		Pid:       e.Context().Pid,
+		Ppid:      e.Context().Ppid,
+		Exe:       e.Exe,
+		Argv:      e.Argv,
+		Starttime: e.Context().Starttime,
+	})
 }
 
 func (Execve) GetProbes() []*manager.Probe {
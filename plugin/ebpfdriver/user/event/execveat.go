@@ -25,6 +25,7 @@ type ExecveAt struct {
 	SocketPid          uint32 `json:"socket_pid"`
 	SocketArgv         string `json:"socket_argv"`
 	PidTree            string `json:"pid_tree"`
+	Lineage            string `json:"lineage"`
 	Argv               string `json:"argv"`
 	PrivEscalation     uint8  `json:"priv_esca"`
 	SSHConnection      string `json:"ssh_connection"`
@@ -106,6 +107,7 @@ func (e *ExecveAt) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
 		e.LDPreload = "-1"
 	}
 	e.SocketArgv = cache.DefaultArgvCache.Get(e.SocketPid)
+	e.Lineage = cache.DefaultProcessCache.Lineage(e.Context().Ppid)
 	return
 }
 
@@ -128,6 +130,13 @@ func (ExecveAt) GetProbes() []*manager.Probe {
 
 func (e ExecveAt) FillCache() {
 	cache.DefaultArgvCache.Set(e.Context().Pid, e.Argv)
+	cache.DefaultProcessCache.Set(cache.Process{
+		Pid:       e.Context().Pid,
+		Ppid:      e.Context().Ppid,
+		Exe:       e.Exe,
+		Argv:      e.Argv,
+		Starttime: e.Context().Starttime,
+	})
 }
 
 func init() {
@@ -0,0 +1,87 @@
+package event
+
+import (
+	"hades-ebpf/user/cache"
+	"hades-ebpf/user/decoder"
+
+	manager "github.com/ehids/ebpfmanager"
+)
+
+var _ decoder.Event = (*Exit)(nil)
+
+// Exit is the exit of the process, the exe and the argv are from the exec
+// cached, so they are "-3" for the processes started before the driver
+type Exit struct {
+	decoder.BasicEvent `json:"-"`
+	Exe                string `json:"-"`
+	Argv               string `json:"argv"`
+	ExitCode           int32  `json:"exit_code"`
+	// Signal is the one killed the process, 0 if it exits itself
+	Signal int32 `json:"signal"`
+	// Duration is the milliseconds from the exec, 0 if it's unknown
+	Duration uint64 `json:"duration"`
+	Lineage  string `json:"lineage"`
+}
+
+func (Exit) ID() uint32 {
+	return 1032
+}
+
+func (Exit) Name() string {
+	return "sched_process_exit"
+}
+
+func (e *Exit) GetExe() string {
+	return e.Exe
+}
+
+func (e *Exit) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
+	var (
+		index  uint8
+		status int32
+	)
+	if err = decoder.DecodeUint8(&index); err != nil {
+		return
+	}
+	if err = decoder.DecodeInt32(&status); err != nil {
+		return
+	}
+	// as WEXITSTATUS and WTERMSIG
+	e.ExitCode = (status >> 8) & 0xff
+	e.Signal = status & 0x7f
+	ctx := e.Context()
+	// the tgid, the last thread exiting may not be the leader
+	proc, ok := cache.DefaultProcessCache.Get(ctx.Tid)
+	if !ok {
+		e.Exe, e.Argv, e.Duration = cache.InVaild, cache.InVaild, 0
+		e.Lineage = cache.DefaultProcessCache.Lineage(ctx.Ppid)
+		return
+	}
+	e.Exe, e.Argv = proc.Exe, proc.Argv
+	e.Duration = 0
+	if ctx.Starttime > proc.Starttime {
+		e.Duration = (ctx.Starttime - proc.Starttime) / 1e6
+	}
+	e.Lineage = cache.DefaultProcessCache.Lineage(proc.Ppid)
+	return
+}
+
+// FillCache drops the process, so the pid reused is not taken as it
+func (e *Exit) FillCache() {
+	cache.DefaultProcessCache.Delete(e.Context().Tid)
+}
+
+func (Exit) GetProbes() []*manager.Probe {
+	return []*manager.Probe{
+		{
+			UID:              "TracepointSchedProcessExit",
+			Section:          "tracepoint/sched/sched_process_exit",
+			EbpfFuncName:     "sched_process_exit",
+			AttachToFuncName: "sched_process_exit",
+		},
+	}
+}
+
+func init() {
+	decoder.RegistEvent(&Exit{})
+}
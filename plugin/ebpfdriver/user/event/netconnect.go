@@ -0,0 +1,86 @@
+package event
+
+import (
+	"hades-ebpf/user/decoder"
+	"strconv"
+
+	manager "github.com/ehids/ebpfmanager"
+)
+
+var _ decoder.Event = (*NetConnect)(nil)
+
+// NetConnect is the outbound connection of tcp, or the udp flow, which is
+// reported once a minute for the same process and the same remote by the
+// kernel. The owner is the process of the context, with the container id.
+type NetConnect struct {
+	decoder.BasicEvent `json:"-"`
+	Family             uint16 `json:"family"`
+	Sport              string `json:"sport"`
+	Sip                string `json:"sip"`
+	Dport              string `json:"dport"`
+	Dip                string `json:"dip"`
+	Protocol           uint16 `json:"protocol"`
+	Exe                string `json:"-"`
+}
+
+func (NetConnect) ID() uint32 {
+	return 1034
+}
+
+func (NetConnect) Name() string {
+	return "net_connect"
+}
+
+func (n *NetConnect) GetExe() string {
+	return n.Exe
+}
+
+func (n *NetConnect) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
+	var (
+		index uint8
+		port  uint16
+	)
+	if n.Family, port, n.Sip, err = decoder.DecodeRemoteAddr(); err != nil {
+		return
+	}
+	n.Sport = strconv.FormatUint(uint64(port), 10)
+	if _, port, n.Dip, err = decoder.DecodeRemoteAddr(); err != nil {
+		return
+	}
+	n.Dport = strconv.FormatUint(uint64(port), 10)
+	if err = decoder.DecodeUint8(&index); err != nil {
+		return
+	}
+	if err = decoder.DecodeUint16(&n.Protocol); err != nil {
+		return
+	}
+	n.Exe, err = decoder.DecodeString()
+	return
+}
+
+func (NetConnect) GetProbes() []*manager.Probe {
+	return []*manager.Probe{
+		{
+			UID:              "KprobeTcpConnect",
+			Section:          "kprobe/tcp_connect",
+			EbpfFuncName:     "kprobe_tcp_connect",
+			AttachToFuncName: "tcp_connect",
+		},
+		{
+			UID:              "KprobeUdpSendmsgConnect",
+			Section:          "kprobe/udp_sendmsg",
+			EbpfFuncName:     "kprobe_udp_sendmsg_connect",
+			AttachToFuncName: "udp_sendmsg",
+		},
+		{
+			UID:              "KprobeUdpv6SendmsgConnect",
+			Section:          "kprobe/udpv6_sendmsg",
+			EbpfFuncName:     "kprobe_udpv6_sendmsg_connect",
+			AttachToFuncName: "udpv6_sendmsg",
+		},
+	}
+}
+
+func init() {
+	decoder.RegistEvent(&NetConnect{})
+}
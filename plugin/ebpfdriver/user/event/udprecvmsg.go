@@ -8,14 +8,10 @@ import (
 
 var _ decoder.Event = (*UdpRecvmsg)(nil)
 
+// UdpRecvmsg is the DNS response received
 type UdpRecvmsg struct {
 	decoder.BasicEvent `json:"-"`
-	Exe                string `json:"-"`
-	Opcode             int32  `json:"opcode"`
-	Rcode              int32  `json:"rcode"`
-	Qtype              int32  `json:"qtype"`
-	Atype              int32  `json:"atype"`
-	DnsData            string `json:"dns_data"`
+	DNS
 }
 
 func (UdpRecvmsg) ID() uint32 {
@@ -31,29 +27,7 @@ func (u *UdpRecvmsg) GetExe() string {
 }
 
 func (u *UdpRecvmsg) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
-	var index uint8
-	if err = decoder.DecodeUint8(&index); err != nil {
-		return
-	}
-	if err = decoder.DecodeInt32(&u.Opcode); err != nil {
-		return
-	}
-	if err = decoder.DecodeInt32(&u.Rcode); err != nil {
-		return
-	}
-	if err = decoder.DecodeInt32(&u.Qtype); err != nil {
-		return
-	}
-	if err = decoder.DecodeInt32(&u.Atype); err != nil {
-		return
-	}
-	if u.DnsData, err = decoder.DecodeString(); err != nil {
-		return
-	}
-	if u.Exe, err = decoder.DecodeString(); err != nil {
-		return
-	}
-	return
+	return u.decode(decoder, true)
 }
 
 func (u *UdpRecvmsg) GetProbes() []*manager.Probe {
@@ -70,6 +44,18 @@ func (u *UdpRecvmsg) GetProbes() []*manager.Probe {
 			EbpfFuncName:     "kretprobe_udp_recvmsg",
 			AttachToFuncName: "udp_recvmsg",
 		},
+		{
+			UID:              "KprobeUdpv6Recvmsg",
+			Section:          "kprobe/udpv6_recvmsg",
+			EbpfFuncName:     "kprobe_udpv6_recvmsg",
+			AttachToFuncName: "udpv6_recvmsg",
+		},
+		{
+			UID:              "KretprobeUdpv6Recvmsg",
+			Section:          "kretprobe/udpv6_recvmsg",
+			EbpfFuncName:     "kretprobe_udpv6_recvmsg",
+			AttachToFuncName: "udpv6_recvmsg",
+		},
 	}
 }
 
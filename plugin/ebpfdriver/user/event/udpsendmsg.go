@@ -0,0 +1,52 @@
+package event
+
+import (
+	"hades-ebpf/user/decoder"
+
+	manager "github.com/ehids/ebpfmanager"
+)
+
+var _ decoder.Event = (*UdpSendmsg)(nil)
+
+// UdpSendmsg is the DNS query sent
+type UdpSendmsg struct {
+	decoder.BasicEvent `json:"-"`
+	DNS
+}
+
+func (UdpSendmsg) ID() uint32 {
+	return 1033
+}
+
+func (UdpSendmsg) Name() string {
+	return "udp_sendmsg"
+}
+
+func (u *UdpSendmsg) GetExe() string {
+	return u.Exe
+}
+
+func (u *UdpSendmsg) DecodeEvent(decoder *decoder.EbpfDecoder) (err error) {
+	return u.decode(decoder, false)
+}
+
+func (u *UdpSendmsg) GetProbes() []*manager.Probe {
+	return []*manager.Probe{
+		{
+			UID:              "KprobeUdpSendmsg",
+			Section:          "kprobe/udp_sendmsg",
+			EbpfFuncName:     "kprobe_udp_sendmsg",
+			AttachToFuncName: "udp_sendmsg",
+		},
+		{
+			UID:              "KprobeUdpv6Sendmsg",
+			Section:          "kprobe/udpv6_sendmsg",
+			EbpfFuncName:     "kprobe_udpv6_sendmsg",
+			AttachToFuncName: "udpv6_sendmsg",
+		},
+	}
+}
+
+func init() {
+	decoder.RegistEvent(&UdpSendmsg{})
+}
@@ -0,0 +1,366 @@
+package filter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hades-ebpf/user/decoder"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	plugin "github.com/chriskaliX/SDK/transport"
+	"github.com/cilium/ebpf"
+	manager "github.com/ehids/ebpfmanager"
+)
+
+// TaskPolicy delivers the filter policy in the data of the task
+const TaskPolicy = 7000
+
+// PolicyFile keeps the last policy applied in the working directory, so it's
+// applied again once the plugin restarts
+const PolicyFile = "policy.json"
+
+const (
+	EventFilter     = "event_filter"
+	PathFilter      = "path_filter"
+	ExeActionFilter = "exe_filter"
+	configMap       = "config_map"
+)
+
+// the actions and the bits of CONFIG_FILTERS, same as define.h
+const (
+	actionDeny uint32 = iota
+	actionAllow
+)
+
+const (
+	pidAllow uint32 = 1 << iota
+	cgroupAllow
+	exeAllow
+	eventAllow
+	exeOn
+)
+
+const (
+	configFilters uint32 = 1
+	// MAX_STR_FILTER_SIZE in define.h
+	maxPathSize = 128
+	// the short container id printed by docker
+	minContainerIDLength = 12
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Rule is the keys of the events to allow or deny
+type Rule struct {
+	Pids []uint32 `json:"pids"`
+	// Paths are the prefixes of the exe
+	Paths []string `json:"paths"`
+	// Containers are the ids, the short ones are fine, which are matched in
+	// the name of the cgroup
+	Containers []string `json:"containers"`
+	// Events are the ids of the events, like 700 for execve
+	Events []uint32 `json:"events"`
+}
+
+// Policy is the filter rules pushed by the server, which is compiled into
+// the maps, so the events are dropped in kernel space. The format is like:
+// {"allow": {"events": [700, 1022]}, "deny": {"paths": ["/usr/bin/dockerd"]}}
+// The deny one wins if a key is in both. If there are allow rules of a kind,
+// the events not allowed by them are dropped.
+type Policy struct {
+	Allow Rule `json:"allow"`
+	Deny  Rule `json:"deny"`
+}
+
+// LoadPolicyFromTask parses and checks the policy of the task
+func LoadPolicyFromTask(t *plugin.Task) (*Policy, error) {
+	return parsePolicy([]byte(t.GetData()))
+}
+
+// LoadPolicyFile loads the policy saved, it's nil if there is none
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicy(data)
+}
+
+// Save writes the policy to the path by renaming, so a policy half written
+// is never loaded
+func (p *Policy) Save(path string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func parsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	for _, rule := range []Rule{policy.Allow, policy.Deny} {
+		for _, path := range rule.Paths {
+			if path == "" || len(path) > maxPathSize {
+				return nil, fmt.Errorf("%w: path %q", ErrInvalidPolicy, path)
+			}
+		}
+		for _, id := range rule.Containers {
+			if len(id) < minContainerIDLength {
+				return nil, fmt.Errorf("%w: container %q", ErrInvalidPolicy, id)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Apply compiles the policy into the maps. The entries are updated before the
+// flags and the stale ones are deleted after, so the events are not dropped
+// by the allow rules half applied. It's applied again from time to time, for
+// the containers and the processes started later.
+func (p *Policy) Apply(m *manager.Manager) error {
+	entries := map[string]map[string]uint32{
+		PidFilter:      actions(p.Allow.Pids, p.Deny.Pids),
+		EventFilter:    actions(p.Allow.Events, p.Deny.Events),
+		PathFilter:     p.paths(),
+		CgroupIdFilter: p.cgroups(cgroupRoot()),
+	}
+	for name, keys := range entries {
+		if err := update(m, name, keys); err != nil {
+			return err
+		}
+	}
+	if err := p.updateExe(m); err != nil {
+		return err
+	}
+	config, err := decoder.GetMap(m, configMap)
+	if err != nil {
+		return err
+	}
+	if err = config.Update(configFilters, p.flags(), ebpf.UpdateAny); err != nil {
+		return err
+	}
+	for name, keys := range entries {
+		if err = prune(m, name, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Policy) flags() (flags uint32) {
+	if len(p.Allow.Pids) > 0 {
+		flags |= pidAllow
+	}
+	if len(p.Allow.Containers) > 0 {
+		flags |= cgroupAllow
+	}
+	if len(p.Allow.Paths) > 0 {
+		flags |= exeAllow
+	}
+	if len(p.Allow.Events) > 0 {
+		flags |= eventAllow
+	}
+	if len(p.Allow.Paths) > 0 || len(p.Deny.Paths) > 0 {
+		flags |= exeOn
+	}
+	return
+}
+
+// the keys are encoded as they are in the maps
+func actions(allow, deny []uint32) map[string]uint32 {
+	keys := make(map[string]uint32, len(allow)+len(deny))
+	for _, id := range allow {
+		keys[uint32Key(id)] = actionAllow
+	}
+	for _, id := range deny {
+		keys[uint32Key(id)] = actionDeny
+	}
+	return keys
+}
+
+func uint32Key(v uint32) string {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return string(b)
+}
+
+func uint64Key(v uint64) string {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return string(b)
+}
+
+// pathKey is the path_key_t of the lpm trie, the prefix length is in bits
+func pathKey(prefix string) string {
+	b := make([]byte, 4+maxPathSize)
+	binary.LittleEndian.PutUint32(b, uint32(len(prefix))*8)
+	copy(b[4:], prefix)
+	return string(b)
+}
+
+func (p *Policy) paths() map[string]uint32 {
+	keys := make(map[string]uint32, len(p.Allow.Paths)+len(p.Deny.Paths))
+	for _, path := range p.Allow.Paths {
+		keys[pathKey(path)] = actionAllow
+	}
+	for _, path := range p.Deny.Paths {
+		keys[pathKey(path)] = actionDeny
+	}
+	return keys
+}
+
+// match returns the action of the longest prefix of the exe, as the lpm trie
+func (p *Policy) match(exe string) (action uint32, ok bool) {
+	var length int
+	for _, rule := range []struct {
+		paths  []string
+		action uint32
+	}{{p.Allow.Paths, actionAllow}, {p.Deny.Paths, actionDeny}} {
+		for _, path := range rule.paths {
+			// the deny one wins for the same prefix
+			if strings.HasPrefix(exe, path) && len(path) >= length {
+				action, ok, length = rule.action, true, len(path)
+			}
+		}
+	}
+	return
+}
+
+// cgroups resolves the containers into the cgroup ids, which is the inode of
+// the cgroup directory in cgroup v2
+func (p *Policy) cgroups(root string) map[string]uint32 {
+	keys := make(map[string]uint32)
+	if root == "" || len(p.Allow.Containers)+len(p.Deny.Containers) == 0 {
+		return keys
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		action, ok := matchContainer(d.Name(), p.Allow.Containers, p.Deny.Containers)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			keys[uint64Key(stat.Ino)] = action
+		}
+		return nil
+	})
+	return keys
+}
+
+func matchContainer(name string, allow, deny []string) (action uint32, ok bool) {
+	for _, id := range deny {
+		if strings.Contains(name, id) {
+			return actionDeny, true
+		}
+	}
+	for _, id := range allow {
+		if strings.Contains(name, id) {
+			return actionAllow, true
+		}
+	}
+	return
+}
+
+// cgroupRoot returns the mount of cgroup v2, the unified one in hybrid mode,
+// since the cgroup id from the kernel is in v2
+func cgroupRoot() string {
+	for _, root := range []string{"/sys/fs/cgroup/unified", "/sys/fs/cgroup"} {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+			return root
+		}
+	}
+	return ""
+}
+
+// updateExe matches the exe of the running processes, the ones exec later
+// are matched in kernel
+func (p *Policy) updateExe(m *manager.Manager) error {
+	if len(p.Allow.Paths)+len(p.Deny.Paths) == 0 {
+		return nil
+	}
+	exeMap, err := decoder.GetMap(m, ExeActionFilter)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		exe, err := os.Readlink(filepath.Join("/proc", entry.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		if action, ok := p.match(exe); ok {
+			exeMap.Update(uint32(pid), action, ebpf.UpdateAny)
+		} else {
+			exeMap.Delete(uint32(pid))
+		}
+	}
+	return nil
+}
+
+func update(m *manager.Manager, name string, keys map[string]uint32) error {
+	_map, err := decoder.GetMap(m, name)
+	if err != nil {
+		return err
+	}
+	for key, action := range keys {
+		if err = _map.Update([]byte(key), action, ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("update %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// prune deletes the keys not in the policy
+func prune(m *manager.Manager, name string, keys map[string]uint32) error {
+	_map, err := decoder.GetMap(m, name)
+	if err != nil {
+		return err
+	}
+	var (
+		key    []byte
+		action uint32
+		stale  []string
+	)
+	iter := _map.Iterate()
+	for iter.Next(&key, &action) {
+		if _, ok := keys[string(key)]; !ok {
+			stale = append(stale, string(key))
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+	for _, key := range stale {
+		_map.Delete([]byte(key))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	plugin "github.com/chriskaliX/SDK/transport"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	task := &plugin.Task{Data: `{"allow": {"events": [700, 1022]}, "deny": {"pids": [1], "paths": ["/usr/bin/"]}}`}
+	policy, err := LoadPolicyFromTask(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := policy.flags(); flags != eventAllow|exeOn {
+		t.Fatalf("unexpected flags: %b", flags)
+	}
+	task.Data = `{"deny": {"containers": ["4ffb2b"]}}`
+	if _, err = LoadPolicyFromTask(task); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatal("short container id is loaded: ", err)
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PolicyFile)
+	policy, err := LoadPolicyFile(path)
+	if err != nil || policy != nil {
+		t.Fatal("policy is loaded without the file: ", policy, err)
+	}
+	saved := &Policy{Deny: Rule{Paths: []string{"/usr/bin/"}, Events: []uint32{700}}}
+	if err = saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if policy, err = LoadPolicyFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy, saved) {
+		t.Fatalf("unexpected policy loaded: %+v", policy)
+	}
+}
+
+func TestPolicyMatch(t *testing.T) {
+	policy := &Policy{
+		Allow: Rule{Paths: []string{"/usr/", "/usr/bin/curl"}},
+		Deny:  Rule{Paths: []string{"/usr/bin/", "/usr/"}},
+	}
+	for exe, expect := range map[string]uint32{
+		"/usr/sbin/sshd": actionDeny,
+		"/usr/bin/ls":    actionDeny,
+		"/usr/bin/curl":  actionAllow,
+	} {
+		if action, ok := policy.match(exe); !ok || action != expect {
+			t.Fatalf("unexpected action of %s: %d", exe, action)
+		}
+	}
+	if _, ok := policy.match("/bin/sh"); ok {
+		t.Fatal("/bin/sh is matched")
+	}
+	// the key of the lpm trie
+	if key := pathKey("/usr/"); len(key) != 4+maxPathSize || key[0] != 40 || key[4:9] != "/usr/" {
+		t.Fatalf("unexpected path key: %q", key)
+	}
+}
+
+func TestPolicyCgroups(t *testing.T) {
+	id := "4ffb2b3a7b46d4d6c4b5d6c2f1b7f3a1e2d3c4b5a69788796a5b4c3d2e1f0a9b"
+	root := t.TempDir()
+	dirs := []string{
+		filepath.Join(root, "system.slice", "docker-"+id+".scope"),
+		filepath.Join(root, "system.slice", "sshd.service"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy := &Policy{Deny: Rule{Containers: []string{id[:12]}}}
+	keys := policy.cgroups(root)
+	if len(keys) != 1 {
+		t.Fatalf("unexpected cgroups: %d", len(keys))
+	}
+	for _, action := range keys {
+		if action != actionDeny {
+			t.Fatal("unexpected action: ", action)
+		}
+	}
+}
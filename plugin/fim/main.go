@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fim/monitor"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/chriskaliX/SDK"
+	"github.com/chriskaliX/SDK/logger"
+	"github.com/chriskaliX/SDK/transport"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	debounce int
+	canary   bool
+)
+
+func fim(sandbox *SDK.Sandbox) func(SDK.ISandbox) error {
+	return func(SDK.ISandbox) error {
+		m, err := monitor.New(sandbox.SendRecord)
+		if err != nil {
+			return err
+		}
+		m.Debounce = monitor.DefaultDebounce * time.Duration(debounce)
+		if _, err = m.Apply(monitor.DefaultRules()); err != nil {
+			return err
+		}
+		go m.Run(sandbox.Context())
+		// the canaries are optional, fanotify needs CAP_SYS_ADMIN
+		c, err := monitor.NewCanaryMonitor(sandbox.SendRecord)
+		if err != nil {
+			sandbox.Logger.Error(fmt.Sprintf("canaries are disabled: %s", err.Error()))
+		} else {
+			if canary {
+				if _, err = c.Apply(monitor.DefaultCanaries()); err != nil {
+					sandbox.Logger.Error(fmt.Sprintf("canaries are not applied: %s", err.Error()))
+				}
+			}
+			go c.Run(sandbox.Context())
+		}
+		go handleTask(sandbox, m, c)
+		return nil
+	}
+}
+
+// handleTask applies the rules or the canaries delivered by the task, the
+// others are ignored
+func handleTask(sandbox *SDK.Sandbox, m *monitor.Monitor, c *monitor.CanaryMonitor) {
+	for {
+		select {
+		case <-sandbox.Context().Done():
+			return
+		case task := <-sandbox.Task:
+			var (
+				output string
+				err    error
+			)
+			switch task.GetDataType() {
+			case monitor.TaskRules:
+				var rules *monitor.Rules
+				if rules, err = monitor.ParseRules(task.GetData()); err == nil {
+					var watches int
+					watches, err = m.Apply(rules)
+					output = fmt.Sprintf("%d directories are watched", watches)
+				}
+			case monitor.TaskCanaries:
+				var canaries []monitor.Canary
+				if c == nil {
+					err = errors.New("canaries are disabled")
+				} else if canaries, err = monitor.ParseCanaries(task.GetData()); err == nil {
+					var watches int
+					watches, err = c.Apply(canaries)
+					output = fmt.Sprintf("%d canaries are watched", watches)
+				}
+			default:
+				continue
+			}
+			if err != nil {
+				sandbox.Logger.Error(fmt.Sprintf("task %d is not applied: %s", task.GetDataType(), err.Error()))
+			}
+			if err := sandbox.Client.SendTaskResult(task, output, err); err != nil {
+				sandbox.Logger.Error(err)
+			}
+		}
+	}
+}
+
+func main() {
+	var debug bool
+	flag.BoolVar(&debug, "debug", false, "set to run in debug mode")
+	flag.IntVar(&debounce, "debounce", 1, "seconds a file keeps quiet before the change is reported")
+	flag.BoolVar(&canary, "canary", false, "plant and watch the default canaries")
+	flag.Parse()
+	if debounce <= 0 {
+		debounce = 1
+	}
+	sconfig := &SDK.SandboxConfig{
+		Debug: debug,
+		Name:  "fim",
+		Capabilities: transport.Capabilities{
+			DataTypes: []int32{monitor.FIM_DATATYPE, monitor.CANARY_DATATYPE},
+			TaskTypes: []int32{monitor.TaskRules, monitor.TaskCanaries},
+		},
+		LogConfig: &logger.Config{
+			Path:        "fim.log",
+			MaxSize:     10,
+			MaxBackups:  10,
+			Compress:    true,
+			FileLevel:   zapcore.InfoLevel,
+			RemoteLevel: zapcore.ErrorLevel,
+		},
+	}
+	sandbox := SDK.NewSandbox()
+	if err := sandbox.Init(sconfig); err != nil {
+		return
+	}
+	sandbox.Run(fim(sandbox))
+}
@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case HashMD5:
+		return md5.New()
+	case HashSHA1:
+		return sha1.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// hashFile reads the file once for all the algorithms, the result is keyed
+// by the algorithm. At most maxSize bytes are read, in case the file grows
+// while it's hashed.
+func hashFile(path string, algorithms []string, maxSize int64) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, algorithm := range algorithms {
+		hashes[i] = newHash(algorithm)
+		writers[i] = hashes[i]
+	}
+	if _, err = io.Copy(io.MultiWriter(writers...), io.LimitReader(f, maxSize)); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(algorithms))
+	for i, algorithm := range algorithms {
+		sums[algorithm] = hex.EncodeToString(hashes[i].Sum(nil))
+	}
+	return sums, nil
+}
@@ -0,0 +1,289 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	plugin "github.com/chriskaliX/SDK/transport"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const FIM_DATATYPE = 6001
+
+// TaskRules delivers the rules in the data of the task
+const TaskRules = 6000
+
+// Actions of the change record
+const (
+	ActionCreate = "create"
+	ActionModify = "modify"
+	ActionDelete = "delete"
+	ActionChmod  = "chmod"
+)
+
+// DefaultDebounce is the quiet time of a path before the change is reported,
+// the events in between are merged into one record
+const DefaultDebounce = time.Second
+
+// change is the pending events of a path
+type change struct {
+	op   fsnotify.Op
+	last time.Time
+}
+
+// Monitor watches the paths of the rules with inotify, and reports the
+// changes of the files by send
+type Monitor struct {
+	Debounce time.Duration
+	watcher  *fsnotify.Watcher
+	send     func(*plugin.Record) error
+	mu       sync.Mutex
+	rules    *Rules
+	// directories watched by inotify
+	watches map[string]struct{}
+	pending map[string]*change
+}
+
+func New(send func(*plugin.Record) error) (*Monitor, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		Debounce: DefaultDebounce,
+		watcher:  watcher,
+		send:     send,
+		rules:    &Rules{},
+		watches:  make(map[string]struct{}),
+		pending:  make(map[string]*change),
+	}, nil
+}
+
+// Rules returns the rules in use
+func (m *Monitor) Rules() *Rules {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rules
+}
+
+// Apply replaces the rules, and the watches with the ones of the paths. The
+// paths not existing are watched by the parent, so the creation of them is
+// reported. It returns the number of directories watched.
+func (m *Monitor) Apply(rules *Rules) (int, error) {
+	if err := rules.Validate(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := range m.watches {
+		m.watcher.Remove(dir)
+		delete(m.watches, dir)
+	}
+	m.rules = rules
+	for _, path := range rules.Paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			m.watch(filepath.Dir(path))
+			continue
+		}
+		if !rules.Recursive {
+			m.watch(path)
+			continue
+		}
+		m.watchTree(path)
+	}
+	return len(m.watches), nil
+}
+
+// watch is called with the lock held
+func (m *Monitor) watch(dir string) {
+	if _, ok := m.watches[dir]; ok {
+		return
+	}
+	if err := m.watcher.Add(dir); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			zap.S().Errorf("watch %s failed: %s", dir, err.Error())
+		}
+		return
+	}
+	m.watches[dir] = struct{}{}
+}
+
+// watchTree watches the directory and the ones in it, except the excluded
+func (m *Monitor) watchTree(root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root && m.rules.Excluded(path) {
+			return filepath.SkipDir
+		}
+		m.watch(path)
+		return nil
+	})
+}
+
+// inScope reports whether the path is covered by the rules and not
+// excluded, it's called with the lock held
+func (m *Monitor) inScope(path string) bool {
+	if m.rules.Excluded(path) {
+		return false
+	}
+	for _, root := range m.rules.Paths {
+		if path == root {
+			return true
+		}
+		if _, ok := m.watches[root]; !ok || !under(path, root) {
+			continue
+		}
+		if m.rules.Recursive || filepath.Dir(path) == root {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) isRoot(path string) bool {
+	for _, root := range m.rules.Paths {
+		if path == root {
+			return true
+		}
+	}
+	return false
+}
+
+// Run merges the events and reports the changes until the context is done
+func (m *Monitor) Run(ctx context.Context) error {
+	defer m.watcher.Close()
+	if m.Debounce <= 0 {
+		m.Debounce = DefaultDebounce
+	}
+	ticker := time.NewTicker(m.Debounce / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-m.watcher.Events:
+			if !ok {
+				return nil
+			}
+			m.handle(event, time.Now())
+		case err, ok := <-m.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			zap.S().Error(err)
+		case now := <-ticker.C:
+			m.flush(now)
+		}
+	}
+}
+
+func (m *Monitor) handle(event fsnotify.Event, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := filepath.Clean(event.Name)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// inotify drops the watch of the removed directory itself
+		delete(m.watches, path)
+	}
+	if !m.inScope(path) {
+		return
+	}
+	// the new directory is watched before the files are created in it
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			if m.rules.Recursive {
+				m.watchTree(path)
+			} else if m.isRoot(path) {
+				m.watch(path)
+			}
+		}
+	}
+	c, ok := m.pending[path]
+	if !ok {
+		c = &change{}
+		m.pending[path] = c
+	}
+	c.op |= event.Op
+	c.last = now
+}
+
+// flush reports the paths quiet for the debounce
+func (m *Monitor) flush(now time.Time) {
+	m.mu.Lock()
+	rules := m.rules
+	ready := make(map[string]fsnotify.Op)
+	for path, c := range m.pending {
+		if now.Sub(c.last) < m.Debounce {
+			continue
+		}
+		delete(m.pending, path)
+		if m.inScope(path) {
+			ready[path] = c.op
+		}
+	}
+	m.mu.Unlock()
+	for path, op := range ready {
+		if err := m.send(m.record(rules, path, op)); err != nil {
+			zap.S().Error(err)
+		}
+	}
+}
+
+// record is the change of the path, by the state of it when it's reported
+func (m *Monitor) record(rules *Rules, path string, op fsnotify.Op) *plugin.Record {
+	fields := map[string]string{"path": path}
+	info, err := os.Lstat(path)
+	switch {
+	case err != nil:
+		fields["action"] = ActionDelete
+	case op&fsnotify.Create != 0:
+		fields["action"] = ActionCreate
+	case op&fsnotify.Write != 0:
+		fields["action"] = ActionModify
+	case op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		// replaced by another file with the same name
+		fields["action"] = ActionCreate
+	default:
+		fields["action"] = ActionChmod
+	}
+	if err == nil {
+		fields["size"] = strconv.FormatInt(info.Size(), 10)
+		fields["mode"] = info.Mode().String()
+		fields["mtime"] = strconv.FormatInt(info.ModTime().Unix(), 10)
+		fields["is_dir"] = strconv.FormatBool(info.IsDir())
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			fields["uid"] = strconv.FormatUint(uint64(stat.Uid), 10)
+			fields["gid"] = strconv.FormatUint(uint64(stat.Gid), 10)
+			fields["inode"] = strconv.FormatUint(stat.Ino, 10)
+		}
+		if info.Mode().IsRegular() && fields["action"] != ActionChmod {
+			if info.Size() > rules.MaxSize {
+				fields["hash_error"] = "file is too large"
+			} else if sums, err := hashFile(path, rules.Hash, rules.MaxSize); err != nil {
+				fields["hash_error"] = err.Error()
+			} else {
+				for algorithm, sum := range sums {
+					fields[algorithm] = sum
+				}
+			}
+		}
+	}
+	return &plugin.Record{
+		DataType:  FIM_DATATYPE,
+		Timestamp: time.Now().Unix(),
+		Data: &plugin.Payload{
+			Fields: fields,
+		},
+	}
+}
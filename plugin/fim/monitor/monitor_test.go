@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	plugin "github.com/chriskaliX/SDK/transport"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`{"paths": ["/etc/ssh/", "/tmp"], "exclude": ["*.swp", "/etc/ssh/moduli"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rules.Recursive || rules.MaxSize != DefaultMaxSize || len(rules.Hash) != 1 || rules.Hash[0] != HashSHA256 {
+		t.Fatalf("defaults are not set: %+v", rules)
+	}
+	if rules.Paths[0] != "/etc/ssh" {
+		t.Fatalf("path is not cleaned: %s", rules.Paths[0])
+	}
+	for path, excluded := range map[string]bool{
+		"/tmp/.a.swp":           true,
+		"/etc/ssh/moduli":       true,
+		"/etc/ssh/moduli/a":     true,
+		"/etc/ssh/moduli.d":     false,
+		"/etc/ssh/sshd_config":  false,
+		"/etc/ssh/sshd_config~": false,
+	} {
+		if rules.Excluded(path) != excluded {
+			t.Errorf("exclusion of %s should be %v", path, excluded)
+		}
+	}
+	for _, data := range []string{
+		`{"paths": []}`,
+		`{"paths": ["etc"]}`,
+		`{"paths": ["/etc"], "exclude": ["[a"]}`,
+		`{"paths": ["/etc"], "hash": ["crc32"]}`,
+		`{"paths": "/etc"}`,
+	} {
+		if _, err := ParseRules(data); err == nil {
+			t.Errorf("rules should be invalid: %s", data)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	dir := t.TempDir()
+	records := make(chan *plugin.Record, 16)
+	m, err := New(func(rec *plugin.Record) error {
+		records <- rec
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Debounce = 50 * time.Millisecond
+	if _, err = m.Apply(&Rules{Paths: []string{dir}, Exclude: []string{"*.swp"}, Hash: []string{HashSHA256, HashMD5}, Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	expect := func(path, action string) map[string]string {
+		t.Helper()
+		select {
+		case rec := <-records:
+			fields := rec.GetData().GetFields()
+			if rec.DataType != FIM_DATATYPE || fields["path"] != path || fields["action"] != action {
+				t.Fatalf("unexpected change: %v", fields)
+			}
+			return fields
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s of %s is not reported", action, path)
+		}
+		return nil
+	}
+	// the writes after the creation are merged
+	file := filepath.Join(dir, "passwd")
+	content := []byte("root:x:0:0::/root:/bin/sh\n")
+	if err = os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fields := expect(file, ActionCreate)
+	sum := sha256.Sum256(content)
+	if fields["sha256"] != hex.EncodeToString(sum[:]) || fields["md5"] == "" || fields["size"] != "26" {
+		t.Fatalf("file is not hashed: %v", fields)
+	}
+	os.WriteFile(file, []byte("root:x:0:0::/root:/bin/bash\n"), 0644)
+	expect(file, ActionModify)
+	os.Chmod(file, 0600)
+	if fields = expect(file, ActionChmod); fields["sha256"] != "" {
+		t.Fatalf("chmod is hashed: %v", fields)
+	}
+	// excluded files are not reported, the new directory is watched
+	os.WriteFile(filepath.Join(dir, ".passwd.swp"), nil, 0644)
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0755)
+	expect(sub, ActionCreate)
+	time.Sleep(100 * time.Millisecond)
+	os.WriteFile(filepath.Join(sub, "a"), nil, 0644)
+	expect(filepath.Join(sub, "a"), ActionCreate)
+	os.Remove(file)
+	expect(file, ActionDelete)
+
+	// the rules are replaced, the directory is not watched anymore
+	other := t.TempDir()
+	target := filepath.Join(other, "shadow")
+	if _, err = m.Apply(&Rules{Paths: []string{target}}); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "b"), nil, 0644)
+	os.WriteFile(filepath.Join(other, "gshadow"), nil, 0644)
+	os.WriteFile(target, nil, 0644)
+	expect(target, ActionCreate)
+	select {
+	case rec := <-records:
+		t.Fatalf("unexpected change: %v", rec.GetData().GetFields())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
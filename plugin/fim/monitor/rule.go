@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Hash algorithms of the changed files
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+// DefaultMaxSize is the limit of the files to be hashed, the larger ones are
+// reported without the hashes
+const DefaultMaxSize = 64 * 1024 * 1024
+
+// Rules of the monitor, received by the task in json:
+// {"paths": ["/etc"], "exclude": ["*.swp", "/etc/mtab"], "hash": ["sha256"]}
+// Paths are files or directories to watch, and exclude is either a path
+// prefix or a glob pattern matched with the full path and the base name.
+type Rules struct {
+	Paths     []string `json:"paths"`
+	Exclude   []string `json:"exclude"`
+	Hash      []string `json:"hash"`
+	Recursive bool     `json:"recursive"`
+	MaxSize   int64    `json:"max_size"`
+}
+
+// DefaultRules covers the files of the accounts, the ssh, the crontab, the
+// preload and the system binaries
+func DefaultRules() *Rules {
+	return &Rules{
+		Paths: []string{
+			"/etc/passwd",
+			"/etc/shadow",
+			"/etc/group",
+			"/etc/sudoers",
+			"/etc/sudoers.d",
+			"/etc/ssh",
+			"/etc/crontab",
+			"/etc/cron.d",
+			"/etc/ld.so.preload",
+			"/root/.ssh",
+			"/bin",
+			"/sbin",
+			"/usr/bin",
+			"/usr/sbin",
+		},
+		Exclude:   []string{"*.swp", "*.swx", "*~"},
+		Hash:      []string{HashSHA256},
+		Recursive: true,
+		MaxSize:   DefaultMaxSize,
+	}
+}
+
+// ParseRules parses the rules from the data of the task. Recursive is true
+// and the hash is sha256 if they are not set.
+func ParseRules(data string) (*Rules, error) {
+	rules := &Rules{Recursive: true}
+	if err := json.Unmarshal([]byte(data), rules); err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate checks the paths are absolute, the patterns are valid and the
+// hash algorithms are supported. Paths are cleaned, and the hash and the
+// max size are set to the default ones if they are not set.
+func (r *Rules) Validate() error {
+	if len(r.Paths) == 0 {
+		return errors.New("no path to watch")
+	}
+	if len(r.Hash) == 0 {
+		r.Hash = []string{HashSHA256}
+	}
+	if r.MaxSize <= 0 {
+		r.MaxSize = DefaultMaxSize
+	}
+	for i, path := range r.Paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("path %q is not absolute", path)
+		}
+		r.Paths[i] = filepath.Clean(path)
+	}
+	for _, pattern := range r.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("exclusion %q: %w", pattern, err)
+		}
+	}
+	for _, hash := range r.Hash {
+		switch hash {
+		case HashMD5, HashSHA1, HashSHA256:
+		default:
+			return fmt.Errorf("hash %q is not supported", hash)
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether the path matches any of the exclusions
+func (r *Rules) Excluded(path string) bool {
+	for _, pattern := range r.Exclude {
+		if filepath.IsAbs(pattern) && !strings.ContainsAny(pattern, "*?[") {
+			if under(path, filepath.Clean(pattern)) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// under reports whether the path is the root or in it
+func under(path, root string) bool {
+	if path == root || root == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, root+"/")
+}